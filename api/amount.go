@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Digits with optional _ separators, an optional decimal part and a k or m suffix
+var amountPattern = regexp.MustCompile(`^[+-]?[0-9]+(_[0-9]+)*(\.[0-9]+)?[kKmM]?$`)
+
+var amountSuffixes = map[byte]int64{'k': 1_000, 'K': 1_000, 'm': 1_000_000, 'M': 1_000_000}
+
+// Amount is a whole number of coins in request parameters. Besides plain integers it
+// accepts "1_000", "1k", "2.5m" and "100.00", as long as the result is a whole number.
+// Responses keep plain int64 amounts.
+type Amount int64
+
+// ParseAmount reads a human-friendly amount
+func ParseAmount(text string) (Amount, error) {
+	var value string = strings.TrimSpace(text)
+	if !amountPattern.MatchString(value) {
+		return 0, fmt.Errorf("%w %q: use digits, optionally with _ separators, a decimal point or a k/m suffix", ErrInvalidAmount, text)
+	}
+
+	var multiplier int64 = 1
+	if factor, ok := amountSuffixes[value[len(value)-1]]; ok {
+		multiplier = factor
+		value = value[:len(value)-1]
+	}
+
+	coins, ok := new(big.Rat).SetString(strings.ReplaceAll(value, "_", ""))
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrInvalidAmount, text)
+	}
+	coins.Mul(coins, new(big.Rat).SetInt64(multiplier))
+
+	if !coins.IsInt() {
+		return 0, fmt.Errorf("%w %q: coins are whole numbers", ErrInvalidAmount, text)
+	}
+	if !coins.Num().IsInt64() {
+		return 0, fmt.Errorf("%w %q: too large", ErrInvalidAmount, text)
+	}
+	return Amount(coins.Num().Int64()), nil
+}
+
+// UnmarshalText lets gorilla/schema decode query parameters into an Amount
+func (a *Amount) UnmarshalText(text []byte) error {
+	amount, err := ParseAmount(string(text))
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// UnmarshalJSON accepts a JSON number or a string in any form ParseAmount does
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var text string
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		err := json.Unmarshal(data, &text)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+		}
+	} else {
+		text = string(data)
+	}
+	return a.UnmarshalText([]byte(text))
+}
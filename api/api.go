@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 )
 
 // Coin Balance Params
@@ -17,43 +18,1585 @@ type CoinBalanceResponse struct {
 
 	// Account Balance
 	Balance int64
+
+	// Held by partial freezes, Available is what can be withdrawn or transferred
+	Frozen    int64
+	Available int64
+
+	// An admin froze the whole account, nothing can be withdrawn or transferred
+	AccountFrozen bool
+
+	// Balance = Available + Held. Pending is gifts waiting to be accepted and payment
+	// holds waiting to be captured. Outgoing ones are also in Held, incoming ones are
+	// not in Balance yet.
+	Held              int64
+	Pending           int64
+	LastTransactionAt *time.Time
+	Status            AccountStatus
+
+	// What the amounts above are minor units of, see Money
+	Currency string
+
+	// Set when storage is down and Balance is the last known value as of AsOf
+	Stale   bool
+	AsOf    *time.Time
+	Warning string
+}
+
+type CoinAdditionParams struct {
+	Username string
+	Amount   Amount
+}
+
+type CoinAdditionResponse struct {
+	Code    int
+	Message string
+	Balance int64
+}
+
+type CoinWithdrawParams struct {
+	Username string
+	Amount   Amount
+}
+
+type CoinWithdrawResponse struct {
+	Code    int
+	Message string
+	Amount  int64
+	Balance int64
+}
+
+type CoinTransferParams struct {
+	Username string
+
+	// Ignored, the account debited is always the authenticated caller's. Kept so
+	// older clients that send it aren't refused.
+	From   string
+	To     string
+	Amount Amount
+
+	// Settle with the pair's other netted transfers when the netting window closes
+	Net bool
+}
+
+// A netted transfer has no transaction ID or receipt yet, its coins move at SettlesAt
+type CoinTransferResponse struct {
+	Code        int
+	Message     string
+	FromBalance int64
+	ToBalance   int64
+
+	// ID of the ledger entry, GET /transaction/{id} returns it
+	TransactionID string
+	Receipt       *TransferReceipt
+	SettlesAt     *time.Time
+}
+
+// ContentHash is the hex SHA-256 of HashVersion, TransactionID, From, To, Amount and
+// the UTC RFC 3339 nanosecond Timestamp joined with newlines
+type TransferReceipt struct {
+	TransactionID string
+	From          string
+	To            string
+	Amount        int64
+	Timestamp     time.Time
+	HashVersion   string
+	ContentHash   string
+}
+
+type ReceiptParams struct {
+	Username string
+}
+
+type ReceiptResponse struct {
+	Code    int
+	Receipt TransferReceipt
+}
+
+type AccountSummaryParams struct {
+	Username string
+}
+
+type AccountAggregatesParams struct {
+	Username string
+
+	// Inclusive UTC months, YYYY-MM. Defaults to the last 12 months.
+	From string
+	To   string
+}
+
+type TransferPrecheckParams struct {
+	Username string
+	To       string
+	Amount   Amount
+}
+
+// Verdict for a transfer that has not been attempted
+type TransferPrecheckResponse struct {
+	Code    int
+	Allowed bool
+
+	// Every reason the transfer would be refused, e.g. insufficient_funds, daily_limit
+	BlockedBy      []string
+	Available      int64
+	DailyRemaining int64
+	Pair           PairAllowance
+
+	// Set while the sender's account is on probation
+	ProbationEndsAt *time.Time
+}
+
+// What can still move between the sender and recipient. -1 means no cap.
+type PairAllowance struct {
+	HourlyCountRemaining  int64
+	HourlyAmountRemaining int64
+	DailyCountRemaining   int64
+	DailyAmountRemaining  int64
+
+	// When the transfer would fit again, nil if it fits now or never will
+	RetryAt *time.Time
+}
+
+// Single ledger entry as returned to clients
+type Transaction struct {
+	ID        string
+	Type      string
+	From      string
+	To        string
+	Amount    int64
+	Timestamp time.Time
+	Status    string
+	Flow      string
+
+	// What Amount is minor units of, see Money
+	Currency string
+
+	// Position in the caller's own ledger, consecutive with no gaps. A jump between
+	// two entries means some were missed and should be fetched again.
+	Sequence int64
+
+	// Caller's private nickname for the other party, if they saved one
+	CounterpartyNickname string
+
+	// Amount and Timestamp formatted for the caller's locale and timezone, set once
+	// they choose a locale
+	Display *TransactionDisplay
+}
+
+type TransactionDisplay struct {
+	Amount    string
+	Timestamp string
+}
+
+type TransactionListParams struct {
+	Username string
+
+	// Entries per page, 50 by default and at most 200
+	Limit int
+
+	// NextCursor from the previous page, empty for the newest entries
+	Cursor string
+
+	// Only entries of this type (TRANSFER, DEPOSIT, ...) or status (SUCCESS, or
+	// FAILED for every failure), case-insensitive
+	Type   string
+	Status string
+}
+
+// Newest first. NextCursor is empty on the last page.
+type TransactionListResponse struct {
+	Code         int
+	Transactions []Transaction
+	NextCursor   string
+}
+
+type TransactionParams struct {
+	Username string
+}
+
+type TransactionResponse struct {
+	Code        int
+	Transaction Transaction
+}
+
+// Streams the user's new ledger entries as server-sent "transaction" events, each a
+// Transaction with its Sequence as the event id. Send the last id back as the
+// Last-Event-ID header to first get the entries logged since.
+type AccountEventParams struct {
+	Username string
+}
+
+// Opens the wallet socket, WalletSocketRequest and WalletSocketMessage are what goes
+// over it as JSON text messages
+type WalletSocketParams struct {
+	Username string
+}
+
+// Sent by the client. Type is "balance" to read the balance. ID is optional and comes
+// back on the reply, to match replies to requests.
+type WalletSocketRequest struct {
+	Type string
+	ID   string
+}
+
+// Sent by the server. Type is "transfer_received" with Transaction when a transfer to
+// the user succeeds, "balance" with Balance in reply to a request, or "error" with
+// Message when a request can't be answered.
+type WalletSocketMessage struct {
+	Type        string
+	ID          string
+	Balance     *CoinBalanceResponse
+	Transaction *Transaction
+	Message     string
+}
+
+// A GraphQL request, sent as the JSON body of POST /graphql. The response is the
+// GraphQL result, {"data": ..., "errors": [...]}, or for a subscription a stream of
+// them as server-sent events.
+type GraphQLParams struct {
+	Query         string
+	Variables     map[string]interface{}
+	OperationName string
+}
+
+type FaucetParams struct {
+	Username string
+}
+
+type ProfileParams struct {
+	Username string
+
+	// IANA name, e.g. Europe/Berlin
+	Timezone string
+
+	// Opt in to or out of the public leaderboard
+	Leaderboard *bool
+
+	// BCP 47 tag, e.g. de-DE
+	Locale string
+}
+
+type ProfileGetParams struct {
+	Username string
+}
+
+type Profile struct {
+	// Daily limits and statement local times use midnight in this timezone
+	Timezone    string
+	Leaderboard bool
+
+	// Messages and display fields use this locale, empty for the defaults
+	Locale    string
+	UpdatedAt *time.Time
+}
+
+type LeaderboardParams struct {
+	// Entries to return, 10 by default
+	Limit int
+}
+
+type LeaderboardEntry struct {
+	Rank     int
+	Username string
+	Coins    int64
+}
+
+type LeaderboardResponse struct {
+	Code       int
+	Entries    []LeaderboardEntry
+	ComputedAt time.Time
+}
+
+type ProfileResponse struct {
+	Code    int
+	Profile Profile
+}
+
+type ContactParams struct {
+	Username     string
+	Counterparty string
+	Nickname     string
+	Note         string
+}
+
+type ContactListParams struct {
+	Username string
+}
+
+type Contact struct {
+	Counterparty string
+	Nickname     string
+	Note         string
+	UpdatedAt    time.Time
+}
+
+type ContactResponse struct {
+	Code    int
+	Contact Contact
+}
+
+type ContactListResponse struct {
+	Code     int
+	Contacts []Contact
+}
+
+type ContactRemoveParams struct {
+	Username     string
+	Counterparty string
+}
+
+// Generic acknowledgement for operations that return no data
+type MessageResponse struct {
+	Code    int
+	Message string
+}
+
+// Everything the mobile home screen needs in one call
+// State is active, restricted (some funds frozen), dormant, sweepable or locked
+type AccountStatus struct {
+	State       string
+	LockedUntil *time.Time
+
+	// Active freezes making up Held
+	Freezes int
+}
+
+type AccountSummaryResponse struct {
+	Code    int
+	Balance int64
+
+	// Balance formatted for the caller's locale, set once they choose one
+	BalanceDisplay string
+
+	Available         int64
+	Held              int64
+	Pending           int64
+	LastTransactionAt *time.Time
+	Status            AccountStatus
+
+	// Set while the account is new enough for the stricter probation limits
+	ProbationEndsAt *time.Time
+
+	// Newest first
+	RecentTransactions []Transaction
+	Limits             PolicyLimits
+	Alerts             []string
+}
+
+// One UTC month of the caller's successful transactions. Out includes FeesPaid,
+// corrections aren't counted.
+type MonthlyAggregate struct {
+	Month    string
+	In       int64
+	Out      int64
+	FeesPaid int64
+	Count    int64
+}
+
+type AccountAggregatesResponse struct {
+	Code     int
+	Username string
+
+	// What the amounts are minor units of, see Money
+	Currency string
+
+	// Oldest first, months without transactions are left out
+	Months []MonthlyAggregate
+}
+
+// Limits for one currency and tier
+type PolicyLimits struct {
+	MaxBalance     int64
+	MaxTransaction int64
+	DailyLimit     int64
+}
+
+// Caps on transfers between the same two accounts, either direction, 0 for no cap
+type PolicyPairLimits struct {
+	HourlyCount  int64
+	HourlyAmount int64
+	DailyCount   int64
+	DailyAmount  int64
+}
+
+// Policy document, currency -> tier -> limits
+// Stricter limits for accounts opened less than Days ago, 0 Days turns probation off
+type PolicyProbation struct {
+	Days           int
+	MaxTransaction int64
+	DailyLimit     int64
+}
+
+type PolicyDocument struct {
+	// Version the update is based on, must match the current version
+	Version    int64
+	Limits     map[string]map[string]PolicyLimits
+	PairLimits PolicyPairLimits
+	Probation  PolicyProbation
+	UpdatedBy  string
+	UpdatedAt  time.Time
+}
+
+type PolicyResponse struct {
+	Code   int
+	Policy PolicyDocument
+}
+
+type PolicyHistoryResponse struct {
+	Code    int
+	History []PolicyDocument
+}
+
+type EventFeedParams struct {
+	Username string
+	// Only return events with an ID greater than After
+	After int64
+	Limit int
+}
+
+// One line of the NDJSON event feed
+type DomainEvent struct {
+	ID            int64
+	Type          string
+	SchemaVersion int
+	Subject       string
+	Data          map[string]interface{}
+	OccurredAt    time.Time
+}
+
+type AuditExportParams struct {
+	Username string
+	Account  string
+	Signed   bool
+}
+
+// Ledger entry exactly as hashed into an audit export digest
+type AuditEntry struct {
+	ID        string
+	Type      string
+	From      string
+	To        string
+	Amount    int64
+	Timestamp time.Time
+	Status    string
+	Flow      string
+
+	FromSequence int64
+	ToSequence   int64
+}
+
+// Digest is the hex SHA-256 of {Account, GeneratedAt, Entries} as JSON, Signature is
+// the base64 ed25519 signature of that digest
+type AuditExport struct {
+	Code        int
+	Account     string
+	GeneratedAt time.Time
+	Entries     []AuditEntry
+
+	Digest         string
+	Signature      string
+	PublicKey      string
+	TimestampToken string
+	TimestampedBy  string
+}
+
+type AuditTransactionsParams struct {
+	Username string
+
+	// Only this account's entries, every account when empty
+	Account string
+}
+
+type AuditTransactionsResponse struct {
+	Code         int
+	Transactions []AuditEntry
+}
+
+type AuditAccessParams struct {
+	Username string
+}
+
+// One request made through the audit viewer, credential query values are redacted
+type AuditAccessEntry struct {
+	Username string
+	Role     string
+	Method   string
+	Path     string
+	Query    string
+	IP       string
+	Status   int
+	At       time.Time
+}
+
+type AuditAccessResponse struct {
+	Code    int
+	Entries []AuditAccessEntry
+}
+
+type ExperimentsParams struct {
+	Username string
+}
+
+type ExperimentBucket struct {
+	Requests int64
+	Errors   int64
+}
+
+type Experiment struct {
+	Name string
+
+	// Share of users in the treatment bucket
+	Percent int
+
+	// control/treatment -> request counts since startup
+	Buckets map[string]ExperimentBucket
+}
+
+type ExperimentsResponse struct {
+	Code        int
+	Experiments []Experiment
+}
+
+type FreezeParams struct {
+	Username string
+	Account  string
+	Amount   Amount
+	Reason   string
+}
+
+type FreezeLiftParams struct {
+	Username string
+	Reason   string
+}
+
+type FreezeListParams struct {
+	Username string
+
+	// Only this account's freezes, every freeze when empty
+	Account string
+}
+
+type FreezeChange struct {
+	// placed, adjusted or lifted, or frozen and unfrozen for a whole account
+	Action string
+	Amount int64
+	Reason string
+	By     string
+	At     time.Time
+}
+
+type Freeze struct {
+	ID      string
+	Account string
+	Amount  int64
+	Reason  string
+	Active  bool
+	History []FreezeChange
+}
+
+type FreezeResponse struct {
+	Code   int
+	Freeze Freeze
+}
+
+type FreezeListResponse struct {
+	Code    int
+	Freezes []Freeze
+}
+
+type UserListParams struct {
+	Username string
+
+	// Last username of the previous page, empty for the first
+	After string
+
+	// Accounts per page, 100 by default and at most 500
+	Limit int
+}
+
+type UserCreateParams struct {
+	Username string
+
+	// The account to open
+	Account string
+
+	// user, admin or auditor, user by default
+	Role string
+}
+
+type User struct {
+	Username string
+	Role     string
+	Balance  int64
+
+	// Frozen as a whole, see /admin/users/{username}/freeze
+	Frozen bool
+}
+
+type UserListResponse struct {
+	Code  int
+	Users []User
+
+	// After for the next page, empty on the last one
+	NextCursor string
+}
+
+// AuthToken is only returned when the account is opened, pass it on to its owner
+type UserCreateResponse struct {
+	Code      int
+	User      User
+	AuthToken string
+}
+
+type AccountFreezeParams struct {
+	Username string
+	Reason   string
+}
+
+type AccountFreezeResponse struct {
+	Code    int
+	Account string
+	Frozen  bool
+
+	// Why it was last frozen or unfrozen
+	Reason  string
+	History []FreezeChange
+}
+
+type BalanceAdjustmentParams struct {
+	Username string
+
+	// Credited when positive, debited when negative
+	Amount Amount
+
+	// Required, recorded with the balance_adjusted event
+	Reason string
+}
+
+type BalanceAdjustmentResponse struct {
+	Code    int
+	Account string
+	Amount  int64
+	Balance int64
+	Reason  string
+}
+
+type DormancyParams struct {
+	Username string
+}
+
+// An account with no owner activity for the dormancy period
+type DormantAccount struct {
+	Username string
+	Balance  int64
+
+	// What a sweep would move, the balance minus active freezes
+	Available    int64
+	LastActivity time.Time
+	DormantAt    time.Time
+	SweepableAt  time.Time
+
+	// dormant or sweepable
+	Status string
+}
+
+type DormancyResponse struct {
+	Code     int
+	Accounts []DormantAccount
+}
+
+type SweepParams struct {
+	Username string
+}
+
+type SweepReverseParams struct {
+	Username string
+	Account  string
+	Reason   string
+}
+
+type SweepItem struct {
+	Account string
+	Amount  int64
+
+	// proposed, swept, skipped, failed or reversed
+	Status     string
+	Detail     string
+	ReversedBy string
+	ReversedAt *time.Time
+}
+
+type Sweep struct {
+	ID         string
+	To         string
+	Status     string
+	ProposedBy string
+	ProposedAt time.Time
+	ApprovedBy string
+	ApprovedAt *time.Time
+	Items      []SweepItem
+}
+
+type SweepResponse struct {
+	Code  int
+	Sweep Sweep
+}
+
+type SweepListResponse struct {
+	Code   int
+	Sweeps []Sweep
+}
+
+type RunbookListParams struct {
+	Username string
+}
+
+type RunbookParams struct {
+	Username string
+
+	// Why the runbook is being run, required and kept with the run
+	Reason string
+
+	// Snapshot to restore, the newest when empty. Only the restore runbook uses it.
+	Snapshot string
+}
+
+type RunbookRunParams struct {
+	Username string
+}
+
+type RunbookStep struct {
+	Name        string
+	Description string
+}
+
+type Runbook struct {
+	Name        string
+	Description string
+	Steps       []RunbookStep
+}
+
+type RunbookStepProgress struct {
+	Name string
+
+	// pending, running, completed, failed, undone or skipped
+	Status     string
+	Error      string
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+}
+
+// One run of a runbook. Result holds what its steps reported, such as the ID of the
+// snapshot taken, once it has finished.
+type RunbookRun struct {
+	ID      string
+	Runbook string
+
+	// running, completed or failed
+	Status     string
+	Error      string
+	StartedBy  string
+	Reason     string
+	Params     map[string]string
+	StartedAt  time.Time
+	FinishedAt *time.Time
+	Steps      []RunbookStepProgress
+	Result     map[string]interface{}
+}
+
+type RunbookListResponse struct {
+	Code         int
+	WritesPaused bool
+	Runbooks     []Runbook
+
+	// Newest first
+	Runs []RunbookRun
+}
+
+type RunbookRunResponse struct {
+	Code int
+	Run  RunbookRun
+}
+
+// Coarse, public service status for status pages
+// Readiness for load balancers, "ready" or "warming_up" with 503
+type ReadinessResponse struct {
+	Code   int
+	Status string
+
+	// Accounts read by the finished warmup
+	WarmedAccounts int
+}
+
+type StatusResponse struct {
+	Code int
+
+	// "up" or "degraded"
+	Status string
+
+	// Incident note published by admins, empty when there is none
+	Incident          string
+	IncidentUpdatedAt *time.Time
+}
+
+// Which build is serving, "dev" and "unknown" for details the build didn't record
+type VersionResponse struct {
+	Code      int
+	Version   string
+	Commit    string
+	BuildTime string
+	GoVersion string
+	Modified  bool
+}
+
+type IncidentParams struct {
+	Username string
+	Note     string
+}
+
+type EconomyReportParams struct {
+	Username string
+
+	// Inclusive UTC dates, YYYY-MM-DD. Defaults to the last 30 days.
+	From string
+	To   string
+}
+
+// Coins created (sources) and destroyed (sinks) on one UTC day, by transaction type
+type EconomyDay struct {
+	Date      string
+	Sources   map[string]int64
+	Sinks     map[string]int64
+	Created   int64
+	Destroyed int64
+	Net       int64
+}
+
+type EconomyReportResponse struct {
+	Code int
+	Days []EconomyDay
+}
+
+type TransactionExportParams struct {
+	Username string
+}
+
+// State of an asynchronous transaction export. DownloadURL is only set once Status
+// is "completed" and stops working at ExpiresAt; poll again for a fresh link.
+type TransactionExportResponse struct {
+	Code        int
+	JobID       string
+	Status      string
+	Rows        int
+	Error       string
+	DownloadURL string
+	ExpiresAt   *time.Time
+}
+
+type ReconciliationDiscrepancy struct {
+	TransactionID string
+
+	// e.g. missing_postings, unbalanced, wrong_accounts, orphan_postings,
+	// negative_balance
+	Kind   string
+	Detail string
+}
+
+type ReconciliationReport struct {
+	Code                int
+	GeneratedAt         time.Time
+	TransactionsChecked int
+	PostingsChecked     int
+	AccountsChecked     int
+	Discrepancies       []ReconciliationDiscrepancy
+	OK                  bool
 }
 
-type CoinAdditionParams struct {
+type AccountRepairParams struct {
 	Username string
-	Amount   int64
+
+	// Apply the correction, otherwise only report the difference
+	Confirm bool
 }
 
-type CoinAdditionResponse struct {
-	Code    int
-	Message string
+// One account's stored balance against the sum of its ledger postings
+type AccountRepairResponse struct {
+	Code            int
+	Account         string
+	Stored          int64
+	Derived         int64
+	Difference      int64
+	PostingsChecked int
+	Consistent      bool
+
+	// Whether the stored balance was set to Derived, Balance is the balance afterwards
+	Applied bool
 	Balance int64
 }
 
-type CoinWithdrawParams struct {
+type AuditDiffParams struct {
 	Username string
-	Amount   int64
+
+	// RFC 3339 times, or UTC dates (YYYY-MM-DD) covering the whole day. Default to the
+	// last 30 days.
+	From string
+	To   string
 }
 
-type CoinWithdrawResponse struct {
+// One change to the balance, Amount is signed and Balance is the balance after it
+type BalanceChange struct {
+	TransactionID string
+	Type          string
+	Counterparty  string
+	Amount        int64
+	Balance       int64
+	Timestamp     time.Time
+}
+
+type AuditDiffResponse struct {
+	Code         int
+	Account      string
+	From         time.Time
+	To           time.Time
+	StartBalance int64
+	EndBalance   int64
+	Net          int64
+	Changes      []BalanceChange
+}
+
+type WebhookParams struct {
+	Username string
+	URL      string
+
+	// Repeat to subscribe to several event types, omit for all of them
+	EventTypes []string
+
+	// Optional rules, see WebhookRulesParams
+	MinAmount Amount
+	Fields    []string
+}
+
+type WebhookListParams struct {
+	Username string
+}
+
+type WebhookRemoveParams struct {
+	Username string
+	ID       string
+}
+
+type WebhookRotateParams struct {
+	Username string
+	ID       string
+
+	// How long the previous secret keeps signing deliveries, defaults to 24, 0 revokes it now
+	OverlapHours *int
+}
+
+type WebhookDigestParams struct {
+	Username string
+	ID       string
+
+	// Batch events into one delivery this often, 0 delivers each event on its own
+	Minutes int
+}
+
+type WebhookRulesParams struct {
+	Username string
+	ID       string
+
+	// Skip events moving fewer coins than this, 0 for any amount
+	MinAmount Amount
+
+	// Repeat to only deliver these keys of an event's Data, omit for all of them
+	Fields []string
+}
+
+type WebhookMetrics struct {
+	Delivered      int64
+	Failed         int64
+	LastError      string
+	LastDeliveryAt *time.Time
+}
+
+// Secret is only returned when the webhook is created, use it to verify the
+// X-Goapi-Signature header on deliveries
+type Webhook struct {
+	ID         string
+	Tier       string
+	Owner      string
+	URL        string
+	EventTypes []string
+	MinAmount  int64
+	Fields     []string
+	Secret     string
+	CreatedAt  time.Time
+	Metrics    WebhookMetrics
+
+	// Set while deliveries are also signed with the secret from before the last rotation
+	SecretRotatedAt         *time.Time
+	PreviousSecretExpiresAt *time.Time
+
+	// Set when events are batched into a digest every DigestMinutes
+	DigestMinutes int
+	DigestPending int
+	NextDigestAt  *time.Time
+}
+
+type WebhookResponse struct {
 	Code    int
-	Message string
-	Amount  int64
-	Balance int64
+	Webhook Webhook
 }
 
-type CoinTransferParams struct {
+type WebhookListResponse struct {
+	Code     int
+	Webhooks []Webhook
+
+	// Totals over every webhook in the tier
+	Metrics WebhookMetrics
+}
+
+type LockoutListParams struct {
 	Username string
-	From     string
-	To       string
+}
+
+type LockoutRemoveParams struct {
+	Username string
+
+	// Exactly one of Account or IP
+	Account string
+	IP      string
+}
+
+// A username or client IP refused authorization until LockedUntil
+type Lockout struct {
+	Kind        string
+	Value       string
+	Failures    int
+	LockedUntil time.Time
+}
+
+type LockoutListResponse struct {
+	Code     int
+	Lockouts []Lockout
+}
+
+type RateLimitListParams struct {
+	Username string
+
+	// Only this client's windows and buckets, every client when both are empty
+	IP      string
+	Account string
+}
+
+// IP or Account is required
+type RateLimitClearParams struct {
+	Username string
+	IP       string
+	Account  string
+
+	// status, downloads or another per-IP window, or requests for the token buckets.
+	// Every scope when empty.
+	Scope string
+}
+
+// One client's fixed window on a public route, or, with the requests scope, one user's
+// or client IP's token bucket on the authenticated routes. Count is what was used of
+// Limit, ResetAt when the window resets or the bucket is full again.
+type RateLimitBucket struct {
+	Scope   string
+	IP      string
+	Account string
+
+	// For the requests scope, default or the route pattern with a limit of its own
+	Route   string
+	Count   int
+	Limit   int
+	ResetAt time.Time
+}
+
+type RateLimitListResponse struct {
+	Code    int
+	Buckets []RateLimitBucket
+}
+
+type SideEffectListParams struct {
+	Username string
+
+	// Only dead letters of this kind, e.g. webhook, every kind when empty
+	Kind string
+}
+
+type SideEffectRetryParams struct {
+	Username string
+}
+
+// Counters for one kind of side effect since startup, Queued and DeadLetters are current
+type SideEffectMetrics struct {
+	Queued       int
+	DeadLetters  int
+	Succeeded    int64
+	Retried      int64
+	DeadLettered int64
+	LastError    string
+	LastErrorAt  *time.Time
+}
+
+// A side effect that ran out of attempts, Key names what it was for within its kind
+type SideEffect struct {
+	ID        string
+	Kind      string
+	Key       string
+	EventID   int64
+	EventType string
+	Attempts  int
+	LastError string
+	QueuedAt  time.Time
+	DeadAt    *time.Time
+}
+
+type SideEffectListResponse struct {
+	Code        int
+	Pending     int
+	Kinds       map[string]SideEffectMetrics
+	DeadLetters []SideEffect
+}
+
+type SideEffectResponse struct {
+	Code       int
+	SideEffect SideEffect
+}
+
+type ScheduleListParams struct {
+	Username string
+}
+
+// A run that came due while the server was down, Action is skipped or ran
+type MissedRun struct {
+	ScheduledAt time.Time
+	Action      string
+	DetectedAt  time.Time
+}
+
+// A recurring job with its next few runs and the runs it missed
+type Schedule struct {
+	Name            string
+	IntervalSeconds int64
+	NextRunAt       time.Time
+	Upcoming        []time.Time
+	LastRunAt       *time.Time
+	Missed          []MissedRun
+}
+
+type ScheduleListResponse struct {
+	Code            int
+	MissedRunPolicy string
+	Schedules       []Schedule
+}
+
+type CapabilityParams struct {
+	Username string
+}
+
+// Optional features of the storage backend, a client should avoid ones it lacks
+type Capabilities struct {
+	Durable      bool
+	Transactions bool
+	TimeTravel   bool
+	Streaming    bool
+	Snapshots    bool
+	StaleReads   bool
+}
+
+type CapabilityResponse struct {
+	Code         int
+	Driver       string
+	Capabilities Capabilities
+}
+
+type DataExportParams struct {
+	Username string
+}
+
+// The caller's login, without the token
+type DataExportLogin struct {
+	Username string
+	Role     string
+}
+
+// Everything stored about the caller
+type DataExportResponse struct {
+	Code         int
+	GeneratedAt  time.Time
+	Login        DataExportLogin
+	Balance      int64
+	Profile      Profile
+	Transactions []Transaction
+	Contacts     []Contact
+	Webhooks     []Webhook
+	Freezes      []Freeze
+	Events       []DomainEvent
+}
+
+type DataDeletionParams struct {
+	Username string
+	Reason   string
+}
+
+type DataDeletionDecisionParams struct {
+	Username string
+
+	// Why a deletion was rejected
+	Reason string
+}
+
+// A request to erase an account's personal data, Username is the pseudonym once completed
+type DataDeletion struct {
+	ID          string
+	Username    string
+	Reason      string
+	Status      string
+	RequestedAt time.Time
+	DecidedBy   string
+	DecidedAt   *time.Time
+	Note        string
+}
+
+type DataDeletionResponse struct {
+	Code     int
+	Deletion DataDeletion
+}
+
+type DataDeletionListResponse struct {
+	Code      int
+	Deletions []DataDeletion
+}
+
+type HoldListParams struct {
+	Username string
+}
+
+// Part of the balance that can't be spent until it is released, Kind is freeze,
+// netting or gift
+type Hold struct {
+	ID       string
+	Kind     string
 	Amount   int64
+	Reason   string
+	PlacedAt time.Time
 }
 
-type CoinTransferResponse struct {
+// Why Available is less than Balance: Held is the sum of Holds
+type HoldListResponse struct {
+	Code      int
+	Balance   int64
+	Available int64
+	Held      int64
+	Holds     []Hold
+}
+
+type PendingListParams struct {
+	Username string
+}
+
+// Something started for the account that hasn't finished. Kind is data_deletion,
+// escheat_sweep, transaction_export, netted_transfers or gift. Amount is what it would take out of the
+// balance once it does.
+type PendingOperation struct {
+	ID          string
+	Kind        string
+	Status      string
+	Amount      int64
+	Description string
+	CreatedAt   time.Time
+}
+
+type PendingListResponse struct {
+	Code       int
+	Operations []PendingOperation
+}
+
+type GiftParams struct {
+	Username string
+	To       string
+	Amount   Amount
+	Message  string
+}
+
+// Status is pending, accepted, declined, returned or failed, empty for every gift
+type GiftListParams struct {
+	Username string
+	Status   string
+}
+
+type GiftDecisionParams struct {
+	Username string
+}
+
+// The coins stay in From's balance until To accepts, by ExpiresAt
+type Gift struct {
+	ID         string
+	From       string
+	To         string
+	Amount     int64
+	Message    string
+	Status     string
+	SentAt     time.Time
+	ExpiresAt  time.Time
+	ResolvedAt *time.Time
+}
+
+type GiftResponse struct {
+	Code int
+	Gift Gift
+}
+
+// PendingOutgoing and PendingIncoming total the gifts still waiting to be accepted
+type GiftListResponse struct {
+	Code            int
+	PendingOutgoing int64
+	PendingIncoming int64
+	Gifts           []Gift
+}
+
+type HoldParams struct {
+	Username string
+
+	// The payee, who captures or releases the hold
+	To     string
+	Amount Amount
+	Memo   string
+}
+
+// Amount is what to capture, at most the hold, the rest is released. Empty captures
+// the whole hold.
+type HoldCaptureParams struct {
+	Username string
+	Amount   Amount
+}
+
+type HoldReleaseParams struct {
+	Username string
+}
+
+// The coins stay in From's balance until To captures them, by ExpiresAt
+type PaymentHold struct {
+	ID            string
+	From          string
+	To            string
+	Amount        int64
+	Memo          string
+	Status        string
+	PlacedAt      time.Time
+	ExpiresAt     time.Time
+	Captured      int64
+	TransactionID string
+	ResolvedAt    *time.Time
+}
+
+type PaymentHoldResponse struct {
+	Code int
+	Hold PaymentHold
+}
+
+// Reference identifies what the coins are for, such as a cart ID, and is unique among
+// the account's open reservations
+type ReservationParams struct {
+	Username  string
+	Amount    Amount
+	Reference string
+}
+
+// All includes committed, cancelled and expired reservations
+type ReservationListParams struct {
+	Username string
+	All      bool
+}
+
+// Amount is what to spend, at most the reservation, the rest is released. Empty
+// commits the whole reservation.
+type ReservationCommitParams struct {
+	Username string
+	Amount   Amount
+}
+
+type ReservationCancelParams struct {
+	Username string
+}
+
+// The coins stay in the balance until committed, by ExpiresAt
+type Reservation struct {
+	ID         string
+	Amount     int64
+	Reference  string
+	Status     string
+	ReservedAt time.Time
+	ExpiresAt  time.Time
+	Committed  int64
+	ResolvedAt *time.Time
+}
+
+type ReservationResponse struct {
 	Code        int
-	Message     string
-	FromBalance int64
-	ToBalance   int64
+	Reservation Reservation
+}
+
+// Reserved totals the open reservations
+type ReservationListResponse struct {
+	Code         int
+	Reserved     int64
+	Reservations []Reservation
+}
+
+type AccountOwnerListParams struct {
+	Username string
+}
+
+// Permission is "view" or "transact"
+type AccountOwnerParams struct {
+	Username   string
+	Owner      string
+	Permission string
+}
+
+type AccountOwnerRemoveParams struct {
+	Username string
+	Owner    string
+}
+
+type AccountOwner struct {
+	Owner      string
+	Permission string
+	AddedAt    time.Time
+}
+
+type AccountOwnerResponse struct {
+	Code  int
+	Owner AccountOwner
+}
+
+// Owners never lists the holder, whose login is the account itself
+type AccountOwnerListResponse struct {
+	Code    int
+	Account string
+	Owners  []AccountOwner
+}
+
+// Interval is daily, weekly, monthly or a duration such as "12h". OnInsufficientFunds
+// is skip, the default, or queue.
+type StandingOrderParams struct {
+	Username            string
+	To                  string
+	Amount              Amount
+	Interval            string
+	Memo                string
+	OnInsufficientFunds string
+}
+
+type StandingOrderListParams struct {
+	Username string
+}
+
+type StandingOrderCancelParams struct {
+	Username string
+}
+
+type StandingOrderHistoryParams struct {
+	Username string
+}
+
+// Queued are the occurrences waiting for funds. NextRunAt is nil once cancelled.
+type StandingOrder struct {
+	ID                  string
+	To                  string
+	Amount              int64
+	Interval            string
+	Memo                string
+	OnInsufficientFunds string
+	Status              string
+	CreatedAt           time.Time
+	NextRunAt           *time.Time
+	CancelledAt         *time.Time
+	Queued              []time.Time
+}
+
+// Status is executed, skipped or failed, TransactionID is set once executed
+type StandingOrderOccurrence struct {
+	ScheduledAt   time.Time
+	At            time.Time
+	Status        string
+	Amount        int64
+	TransactionID string
+	Reason        string
+}
+
+type StandingOrderResponse struct {
+	Code  int
+	Order StandingOrder
+}
+
+type StandingOrderListResponse struct {
+	Code   int
+	Orders []StandingOrder
+}
+
+// Occurrences are newest first
+type StandingOrderHistoryResponse struct {
+	Code        int
+	ID          string
+	Occurrences []StandingOrderOccurrence
+}
+
+type LoginParams struct {
+	Username string
+}
+
+// An access token for the jwt auth mode, sent as "Authorization: Bearer <AccessToken>",
+// and the refresh token that replaces both at /auth/refresh
+type LoginResponse struct {
+	Code             int
+	AccessToken      string
+	TokenType        string
+	ExpiresAt        time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+type RefreshParams struct {
+	RefreshToken string
+}
+
+// Ends the session of RefreshToken, or every session of the user with All. The access
+// token the request is sent with is revoked either way.
+type LogoutParams struct {
+	Username     string
+	RefreshToken string
+	All          bool
+}
+
+type LogoutResponse struct {
+	Code    int
+	Revoked int
+}
+
+// Opens an account named Username, sent as the JSON body of POST /signup
+type SignupParams struct {
+	Username string
+}
+
+// AuthToken is the new account's static token, sent as the Authorization header. In
+// the jwt auth mode Session holds an access token and refresh token too. Balance
+// includes Bonus.
+type SignupResponse struct {
+	Code            int
+	Username        string
+	AuthToken       string
+	Session         *LoginResponse
+	Balance         int64
+	Bonus           int64
+	Currency        string
+	Limits          PolicyLimits
+	ProbationEndsAt *time.Time
 }
 
 // Error Response
@@ -81,6 +1624,33 @@ var (
 	RequestErrorHandler = func(w http.ResponseWriter, err error) {
 		writeError(w, err.Error(), http.StatusBadRequest)
 	}
+	ForbiddenErrorHandler = func(w http.ResponseWriter, err error) {
+		writeError(w, err.Error(), http.StatusForbidden)
+	}
+	NotFoundErrorHandler = func(w http.ResponseWriter, err error) {
+		writeError(w, err.Error(), http.StatusNotFound)
+	}
+	MethodNotAllowedErrorHandler = func(w http.ResponseWriter, err error) {
+		writeError(w, err.Error(), http.StatusMethodNotAllowed)
+	}
+	UnsupportedMediaTypeErrorHandler = func(w http.ResponseWriter, err error) {
+		writeError(w, err.Error(), http.StatusUnsupportedMediaType)
+	}
+	ConflictErrorHandler = func(w http.ResponseWriter, err error) {
+		writeError(w, err.Error(), http.StatusConflict)
+	}
+	LockedErrorHandler = func(w http.ResponseWriter, err error) {
+		writeError(w, err.Error(), http.StatusLocked)
+	}
+	TooManyRequestsErrorHandler = func(w http.ResponseWriter, err error) {
+		writeError(w, err.Error(), http.StatusTooManyRequests)
+	}
+	ServiceUnavailableErrorHandler = func(w http.ResponseWriter, err error) {
+		writeError(w, err.Error(), http.StatusServiceUnavailable)
+	}
+	NotImplementedErrorHandler = func(w http.ResponseWriter, err error) {
+		writeError(w, err.Error(), http.StatusNotImplemented)
+	}
 	InternalErrorHandler = func(w http.ResponseWriter) {
 		writeError(w, "An unexpected error occurred.", http.StatusInternalServerError)
 	}
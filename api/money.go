@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Currency is the code every amount leaving the server is labelled with
+const Currency = "COIN"
+
+// MinorUnitsPerCoin is how many minor units make a coin. Coins are indivisible, so an
+// amount in minor units is also a number of coins, but consumers should convert with
+// it rather than rely on that.
+const MinorUnitsPerCoin = 1
+
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// Money is the canonical serialization of an amount outside a request: an integer in
+// minor units of Currency. Responses, webhooks, events, exports and notifications all
+// carry amounts this way, so downstream consumers never guess the unit.
+type Money struct {
+	// Minor units, never a fraction
+	Amount   int64
+	Currency string
+}
+
+// Coins converts a number of coins to Money
+func Coins(coins int64) Money {
+	return Money{Amount: MinorUnits(coins), Currency: Currency}
+}
+
+// MinorUnits converts a number of coins to minor units
+func MinorUnits(coins int64) int64 {
+	return coins * MinorUnitsPerCoin
+}
+
+// Coins converts m back to a number of coins, refusing other currencies and amounts
+// that are not whole coins
+func (m Money) Coins() (int64, error) {
+	if m.Currency != Currency {
+		return 0, fmt.Errorf("%w %q, amounts are in %s", ErrUnknownCurrency, m.Currency, Currency)
+	}
+	if m.Amount%MinorUnitsPerCoin != 0 {
+		return 0, fmt.Errorf("%w: %d minor units is not a whole number of coins", ErrInvalidAmount, m.Amount)
+	}
+	return m.Amount / MinorUnitsPerCoin, nil
+}
+
+// String is the amount in minor units and the currency code, e.g. "250 COIN"
+func (m Money) String() string {
+	return strconv.FormatInt(m.Amount, 10) + " " + m.Currency
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/preflight"
+	log "github.com/sirupsen/logrus"
+)
+
+const configUsage = `Usage:
+  api config validate [-timeout 10s]    check the configuration and its backends, exit 1 on a problem
+  api config print [-redact-secrets]    print the configuration the server would start with
+`
+
+// runConfig runs an api config subcommand on the configuration from the environment,
+// without serving anything, and returns the exit code
+func runConfig(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, configUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "validate":
+		var flags = flag.NewFlagSet("config validate", flag.ContinueOnError)
+		var timeout = flags.Duration("timeout", 10*time.Second, "how long to wait for backends to answer")
+		if flags.Parse(args[1:]) != nil {
+			return 2
+		}
+		return validateConfig(os.Stdout, config.Load(), *timeout)
+	case "print":
+		var flags = flag.NewFlagSet("config print", flag.ContinueOnError)
+		var redact = flags.Bool("redact-secrets", false, "replace secrets such as DB_DSN and JWT_SECRET")
+		if flags.Parse(args[1:]) != nil {
+			return 2
+		}
+		var cfg config.Config = config.Load()
+		if *redact {
+			cfg = cfg.Redacted()
+		}
+		printConfig(os.Stdout, cfg)
+		return 0
+	}
+
+	fmt.Fprint(os.Stderr, configUsage)
+	return 2
+}
+
+// validateConfig reports every problem preflight finds, one per line
+func validateConfig(w io.Writer, cfg config.Config, timeout time.Duration) int {
+	// Loading files logs at info, which would bury the report
+	log.SetLevel(log.WarnLevel)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	problems := preflight.Run(ctx, cfg)
+	if len(problems) == 0 {
+		fmt.Fprintf(w, "Configuration is valid for the %s profile, backends answered\n", cfg.Profile)
+		return 0
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(w, "FAIL", problem)
+	}
+	fmt.Fprintf(w, "%d problem(s) found\n", len(problems))
+	return 1
+}
+
+// printConfig writes one Field=value line per setting, in declaration order
+func printConfig(w io.Writer, cfg config.Config) {
+	var value = reflect.ValueOf(cfg)
+	for i := 0; i < value.NumField(); i++ {
+		fmt.Fprintf(w, "%s=%v\n", value.Type().Field(i).Name, value.Field(i).Interface())
+	}
+}
@@ -1,27 +1,348 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/bryantjandra/goapi/internal/aggregates"
+	"github.com/bryantjandra/goapi/internal/breakglass"
+	"github.com/bryantjandra/goapi/internal/buildinfo"
+	"github.com/bryantjandra/goapi/internal/cachebus"
+	"github.com/bryantjandra/goapi/internal/certs"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/dormancy"
+	"github.com/bryantjandra/goapi/internal/exports"
+	"github.com/bryantjandra/goapi/internal/gifts"
 	"github.com/bryantjandra/goapi/internal/handlers"
+	"github.com/bryantjandra/goapi/internal/holds"
+	"github.com/bryantjandra/goapi/internal/leaderboard"
+	"github.com/bryantjandra/goapi/internal/messages"
+	"github.com/bryantjandra/goapi/internal/middleware"
+	"github.com/bryantjandra/goapi/internal/netting"
+	"github.com/bryantjandra/goapi/internal/publisher"
+	"github.com/bryantjandra/goapi/internal/reconcile"
+	"github.com/bryantjandra/goapi/internal/reservations"
+	"github.com/bryantjandra/goapi/internal/runbooks"
+	"github.com/bryantjandra/goapi/internal/scheduler"
+	"github.com/bryantjandra/goapi/internal/service"
+	"github.com/bryantjandra/goapi/internal/sideeffects"
+	"github.com/bryantjandra/goapi/internal/standingorders"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/warmup"
+	"github.com/bryantjandra/goapi/internal/webhooks"
 	"github.com/go-chi/chi"
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
+	// api config validate|print checks the configuration for CI instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(os.Args[2:]))
+	}
+
 	log.SetReportCaller(true)
 
-	log.Info("Initializing GO API Service...")
+	log.WithFields(buildinfo.Get().Fields()).Info("Initializing GO API Service...")
+
+	var cfg config.Config = config.Load()
+	err := config.Validate(cfg)
+	if err != nil {
+		log.Fatal("Refusing to start: ", err)
+	}
+	config.Set(cfg)
+	log.Info("Using the ", cfg.Profile, " profile")
+
+	if secret := config.Get().DownloadSigningSecret; secret != "" {
+		exports.SetSigningSecret([]byte(secret))
+	}
+
+	err = messages.Load(config.Get().MessageTemplatesFile)
+	if err != nil {
+		log.Fatal("Refusing to start: ", err)
+	}
+
+	webhooks.Start()
+	dormancy.Start()
+
+	err = tools.LoadLatencyProfiles(config.Get().MockLatencyProfilesFile)
+	if err != nil {
+		log.Fatal("Refusing to start: ", err)
+	}
+
+	// One database serves every request and background job, so its state lives as long as the process
+	database, err := tools.NewDatabase()
+	if err != nil {
+		log.Fatal("Refusing to start: ", err)
+	}
+
+	// While storage is down balances are served from what was last read, marked stale,
+	// and mutations are refused. The bus drops what other replicas changed.
+	var bus *cachebus.Bus
+	if cfg := config.Get(); cfg.DegradedReads {
+		var options = tools.DegradedOptions{FailureThreshold: cfg.DegradedThreshold, Cooldown: cfg.DegradedCooldown}
+		if cfg.CacheBusURL != "" {
+			transport, err := cachebus.NewRedisTransport(cfg.CacheBusURL, cfg.CacheBusChannel)
+			if err != nil {
+				log.Fatal("Refusing to start: ", err)
+			}
+			bus = cachebus.New(transport, cfg.CacheBusWindow)
+			options.Invalidator = bus
+		}
+		database, err = tools.NewDegradedDatabase(*database, options)
+		if err != nil {
+			log.Fatal("Refusing to start: ", err)
+		}
+	}
+
+	// Runbooks pause writes here, beneath everything that records successful ones
+	*database = runbooks.Wrap(*database)
+
+	// Every successful ledger operation goes through the outbox to the broker
+	*database, err = publisher.Start(config.Get(), *database)
+	if err != nil {
+		log.Fatal("Refusing to start: ", err)
+	}
+
+	// Monthly aggregates follow each transaction instead of scanning the ledger on read
+	*database = aggregates.Wrap(*database)
 
-	var r *chi.Mux = chi.NewRouter()
-	handlers.Handler(r)
+	var tracker *middleware.DrainTracker = middleware.NewDrainTracker()
+	var r *chi.Mux = handlers.New(*database, tracker.Middleware)
+
+	if names := middleware.DefaultRegistry.Names(); len(names) > 0 {
+		log.Info("Custom middleware: ", names)
+	}
+
+	servers, certificates, err := newServers(config.Get(), r)
+	if err != nil {
+		log.Fatal("Refusing to start: ", err)
+	}
+	go reloadOnHangup(certificates)
+
+	// Event streams never finish on their own, Shutdown would wait out the deadline
+	for _, server := range servers {
+		server.RegisterOnShutdown(handlers.CloseStreams)
+	}
+
+	// Background jobs stop when shutdown begins
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	var openDatabase = func() (tools.DatabaseInterface, error) {
+		return *database, nil
+	}
+
+	err = scheduler.Load(config.Get().SchedulerStateFile)
+	if err != nil {
+		log.Fatal("Refusing to start: ", err)
+	}
+	if interval := config.Get().ReconcileInterval; interval > 0 {
+		scheduler.Register("reconciliation", interval, func(time.Time) { reconcile.Scheduled(openDatabase) })
+	}
+	if interval := config.Get().DormancyScanInterval; interval > 0 {
+		scheduler.Register("dormancy_scan", interval, func(time.Time) { dormancy.Scheduled(openDatabase) })
+	}
+	if config.Get().ReservationTTL > 0 {
+		scheduler.Register("reservation_expiry", time.Minute, func(time.Time) { reservations.Scheduled(openDatabase) })
+	}
+
+	err = standingorders.Load(config.Get().StandingOrdersFile)
+	if err != nil {
+		log.Fatal("Refusing to start: ", err)
+	}
+	scheduler.Register("standing_orders", time.Minute, func(time.Time) {
+		standingorders.Scheduled(openDatabase, func(database tools.DatabaseInterface, from string, to string, amount int64) error {
+			return service.New(database).CheckScheduledTransfer(from, to, amount)
+		})
+	})
+
+	// The compact runbook rewrites each file-backed store, on a schedule or from the admin API
+	if config.Get().EventOutboxFile != "" {
+		runbooks.RegisterCompaction("event_outbox", "rewrite the event outbox with only the events not yet delivered", publisher.Compact)
+	}
+	if config.Get().StandingOrdersFile != "" {
+		runbooks.RegisterCompaction("standing_orders", "drop orders cancelled longer ago than COMPACTION_RETENTION", func() (int64, int64, error) {
+			return standingorders.Compact(time.Now(), config.Get().CompactionRetention)
+		})
+	}
+	if config.Get().SchedulerStateFile != "" {
+		runbooks.RegisterCompaction("scheduler", "drop jobs no longer registered that haven't run within COMPACTION_RETENTION", func() (int64, int64, error) {
+			return scheduler.Compact(time.Now(), config.Get().CompactionRetention)
+		})
+	}
+	if interval := config.Get().CompactionInterval; interval > 0 {
+		scheduler.Register("compaction", interval, func(time.Time) {
+			runbooks.ScheduledCompaction(openDatabase, time.Now(), tracker.InFlightMutations)
+		})
+	}
+	go scheduler.Run(jobs, time.Second, config.Get().SchedulerMissedRuns)
+	if bus != nil {
+		go bus.Run(jobs)
+	}
+	if path := config.Get().BreakGlassSocket; path != "" {
+		go func() {
+			err := breakglass.Serve(jobs, path, config.Get().BreakGlassTTL)
+			if err != nil {
+				log.Error("Break-glass tokens unavailable: ", err)
+			}
+		}()
+	}
+	go webhooks.ScheduleDigests(jobs, 30*time.Second)
+	go sideeffects.Run(jobs, 4, time.Second)
+	go publisher.Run(jobs, 250*time.Millisecond)
+	if interval := config.Get().LeaderboardInterval; interval > 0 {
+		go leaderboard.Schedule(jobs, interval, config.Get().LeaderboardSize, openDatabase)
+	}
+	if config.Get().NettingWindow > 0 {
+		go netting.Schedule(jobs, time.Second, openDatabase)
+	}
+	if config.Get().GiftAcceptWindow > 0 {
+		go gifts.Schedule(jobs, time.Second, openDatabase)
+	}
+	if config.Get().HoldTTL > 0 {
+		go holds.Schedule(jobs, time.Second, openDatabase)
+	}
+
+	// The hottest accounts of the last run, read before /readyz goes green
+	hot, err := warmup.Load(config.Get().WarmupStateFile)
+	if err != nil {
+		log.Error("Warming only the configured accounts: ", err)
+	}
+	if config.Get().LeaderboardInterval > 0 {
+		warmup.Register("leaderboard", func(database tools.DatabaseInterface, usernames []string) error {
+			_, err := leaderboard.Refresh(database, config.Get().LeaderboardSize)
+			return err
+		})
+	}
 
 	fmt.Println("Starting GO API Service...")
-	log.Info("Server starting on localhost:3000")
+	for _, server := range servers {
+		go serve(server)
+	}
+	go warmup.Run(*database, append(config.Get().WarmupAccounts, hot...), config.Get().WarmupConnections)
 
-	err := http.ListenAndServe("localhost:3000", r)
+	var stop = make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	stopJobs()
+	shutdown(servers, tracker, *database)
+}
+
+// newServers returns the plain HTTP server, the HTTPS one when it is configured and its
+// certificates. With HTTPS on, plain HTTP only redirects to it.
+func newServers(cfg config.Config, handler http.Handler) ([]*http.Server, *certs.Source, error) {
+	if !certs.Enabled(cfg) {
+		return []*http.Server{{Addr: cfg.HTTPAddr, Handler: handler}}, nil, nil
+	}
+
+	certificates, err := certs.New(cfg)
 	if err != nil {
+		return nil, nil, err
+	}
+
+	var servers = []*http.Server{{Addr: cfg.HTTPSAddr, Handler: handler, TLSConfig: certificates.TLSConfig()}}
+	if cfg.HTTPAddr != config.HTTPListenerOff {
+		servers = append(servers, &http.Server{Addr: cfg.HTTPAddr, Handler: certificates.HTTPHandler(certs.Redirect(cfg.HTTPSAddr))})
+	}
+	return servers, certificates, nil
+}
+
+func serve(server *http.Server) {
+	var err error
+	if server.TLSConfig != nil {
+		log.Info("HTTPS server starting on ", server.Addr)
+		// The certificate comes from TLSConfig
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		log.Info("Server starting on ", server.Addr)
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatal("Failed to start server: ", err)
 	}
 }
+
+// reloadOnHangup reloads the message templates and certificate files on SIGHUP. A bad
+// file keeps what was already loaded.
+func reloadOnHangup(certificates *certs.Source) {
+	var hangup = make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		err := messages.Load(config.Get().MessageTemplatesFile)
+		if err != nil {
+			log.Error("Keeping the previous message templates: ", err)
+		}
+		if certificates != nil {
+			err = certificates.Reload()
+			if err != nil {
+				log.Error("Keeping the previous TLS certificate: ", err)
+			}
+		}
+	}
+}
+
+// shutdown drains in-flight requests on every server and logs what happened to them
+func shutdown(servers []*http.Server, tracker *middleware.DrainTracker, database tools.DatabaseInterface) {
+	var timeout = config.Get().ShutdownTimeout
+	log.Info("Shutting down, draining in-flight requests for up to ", timeout)
+
+	tracker.BeginShutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, server := range servers {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			log.Error("Drain deadline passed, closing remaining connections: ", err)
+			server.Close()
+		}
+	}
+
+	report := tracker.Report()
+
+	// Queued digests go out now rather than being lost with the process
+	webhooks.FlushDigests(time.Now(), true)
+
+	// One last pass over due side effects, ones waiting to retry are lost
+	sideeffects.RunDue(time.Now())
+	if pending := sideeffects.Pending(); pending > 0 {
+		log.Warn("Shutting down with ", pending, " side effects still queued")
+	}
+
+	// The next start warms whatever was busiest in this one
+	err := warmup.Save(config.Get().WarmupStateFile, config.Get().WarmupTopN)
+	if err != nil {
+		log.Error("Failed to save warmup state: ", err)
+	}
+
+	// Open netting windows settle early, their transfers were accepted
+	if _, err = netting.Settle(database, time.Now(), true); err != nil {
+		log.Error("Failed to settle netting windows: ", err)
+	}
+
+	// After everything above that can still move coins
+	publisher.Stop()
+
+	var health = database.GetSystemHealth()
+	if health == nil {
+		health = map[string]interface{}{}
+	}
+	health["shutdown"] = report
+
+	log.WithFields(log.Fields{
+		"in_flight_at_shutdown": report.InFlightAtShutdown,
+		"drained":               report.Drained,
+		"aborted":               report.Aborted,
+		"mutations_interrupted": report.MutationsInterrupted,
+		"duration":              report.Duration.String(),
+	}).Info("Shutdown summary")
+
+	log.WithField("health", health).Info("Final health snapshot")
+}
@@ -0,0 +1,76 @@
+// Command breakglass mints, lists and revokes break-glass admin tokens over the
+// server's local socket, BREAK_GLASS_SOCKET. It has to run on the server's host as the
+// user the server runs as.
+//
+//	go run ./cmd/breakglass -reason "INC-1234: ledger stuck" -ttl 10m
+//	go run ./cmd/breakglass -list
+//	go run ./cmd/breakglass -revoke <grant>
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/breakglass"
+	log "github.com/sirupsen/logrus"
+)
+
+// currentUser is the OS user running the command, the default operator
+func currentUser() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
+func main() {
+	var socket = flag.String("socket", os.Getenv("BREAK_GLASS_SOCKET"), "the server's break-glass socket")
+	var reason = flag.String("reason", "", "why the token is needed, recorded with every request it makes")
+	var ttl = flag.Duration("ttl", 0, "how long the token lasts, 0 for BREAK_GLASS_TTL")
+	var operator = flag.String("operator", currentUser(), "who the token is for")
+	var list = flag.Bool("list", false, "list the grants minted since the server started")
+	var revoke = flag.String("revoke", "", "end the grant with this ID now")
+	flag.Parse()
+
+	if *socket == "" {
+		log.Fatal("No socket, set -socket or BREAK_GLASS_SOCKET")
+	}
+
+	var request = breakglass.Request{Command: breakglass.CommandMint, Operator: *operator, Reason: *reason}
+	if *ttl > 0 {
+		request.TTL = ttl.String()
+	}
+	switch {
+	case *list:
+		request = breakglass.Request{Command: breakglass.CommandList}
+	case *revoke != "":
+		request = breakglass.Request{Command: breakglass.CommandRevoke, Grant: *revoke}
+	}
+
+	response, err := breakglass.Send(*socket, request)
+	if err != nil {
+		log.Fatal("Break-glass command failed: ", err)
+	}
+
+	switch request.Command {
+	case breakglass.CommandMint:
+		fmt.Fprintf(os.Stderr, "Grant %s for %s expires at %s\n", response.Grant.ID, response.Grant.Operator, response.Grant.ExpiresAt.Format(time.RFC3339))
+		fmt.Fprintf(os.Stderr, "Send it as: Authorization: %s<token>\n", breakglass.Scheme)
+		fmt.Println(response.Token)
+	case breakglass.CommandRevoke:
+		fmt.Printf("Grant %s revoked\n", response.Grant.ID)
+	case breakglass.CommandList:
+		for _, grant := range response.Grants {
+			var state string = "active"
+			if !grant.RevokedAt.IsZero() {
+				state = "revoked"
+			} else if !grant.Active(time.Now()) {
+				state = "expired"
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", grant.ID, grant.Operator, state, grant.ExpiresAt.Format(time.RFC3339), grant.Reason)
+		}
+	}
+}
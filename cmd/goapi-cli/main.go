@@ -0,0 +1,277 @@
+// Command goapi-cli calls the API from a terminal, through package client. The server,
+// account and token come from a saved profile, and GOAPI_URL, GOAPI_USERNAME and
+// GOAPI_TOKEN override it.
+//
+//	go run ./cmd/goapi-cli profile save local -url http://localhost:3000 -username aaron -token 1 -use
+//	go run ./cmd/goapi-cli balance
+//	go run ./cmd/goapi-cli transfer bryan 1k
+//	go run ./cmd/goapi-cli -output json history -limit 10
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/pkg/client"
+)
+
+const usage = `Usage: goapi-cli [-profile name] [-output table|json] [-timeout 30s] <command>
+
+Commands:
+  balance                      show the account's balance
+  deposit <amount>             add coins
+  withdraw <amount>            take coins out
+  transfer <to> <amount>       send coins to another account
+  history [-limit n] [-cursor c] [-type t] [-status s]
+                               list ledger entries, newest first
+  profile list                 list saved profiles, * marks the current one
+  profile save <name> [-url u] [-username n] [-token t] [-use]
+                               save or update a profile
+  profile use <name>           make a profile the current one
+
+Amounts take the API's forms, such as 250, 1_000 or 1.5k.
+`
+
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitUsage  = 2
+)
+
+const (
+	tableFormat = "table"
+	jsonFormat  = "json"
+)
+
+// errUsage is a command line that doesn't parse, the usage is printed with it
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	var flags = flag.NewFlagSet("goapi-cli", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	var profileName = flags.String("profile", "", "saved profile to use, GOAPI_PROFILE or the current one by default")
+	var output = flags.String("output", tableFormat, "table or json")
+	var timeout = flags.Duration("timeout", 30*time.Second, "how long to wait for the server")
+	if flags.Parse(os.Args[1:]) != nil {
+		os.Exit(exitUsage)
+	}
+	if flags.NArg() == 0 || (*output != tableFormat && *output != jsonFormat) {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitUsage)
+	}
+
+	var err error = run(flags.Args(), *profileName, *output, *timeout)
+	var refused *client.Error
+	switch {
+	case err == nil:
+		os.Exit(exitOK)
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitUsage)
+	case errors.As(err, &refused):
+		fmt.Fprintln(os.Stderr, "Refused:", refused)
+		os.Exit(exitFailed)
+	default:
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitFailed)
+	}
+}
+
+func run(args []string, profileName string, output string, timeout time.Duration) error {
+	path, err := profilesPath()
+	if err != nil {
+		return err
+	}
+	profiles, err := loadProfiles(path)
+	if err != nil {
+		return err
+	}
+
+	var command string = args[0]
+	if command == "profile" {
+		return runProfile(args[1:], profiles, path)
+	}
+
+	profile, err := profiles.resolve(profileName)
+	if err != nil {
+		return err
+	}
+	var c *client.Client = client.New(profile.URL, profile.Username, profile.Token)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var out = &printer{w: os.Stdout, format: output}
+	switch command {
+	case "balance":
+		if len(args) != 1 {
+			return fmt.Errorf("%w: balance takes no arguments", errUsage)
+		}
+		balance, err := c.Balance(ctx)
+		if err != nil {
+			return err
+		}
+		return out.print(balance, func(w io.Writer) {
+			fmt.Fprintln(w, "USERNAME\tBALANCE\tAVAILABLE\tHELD\tPENDING\tFROZEN\tSTATE")
+			fmt.Fprintf(w, "%s\t%d %s\t%d\t%d\t%d\t%d\t%s\n", profile.Username, balance.Balance, balance.Currency,
+				balance.Available, balance.Held, balance.Pending, balance.Frozen, balance.Status.State)
+		})
+	case "deposit", "withdraw":
+		if len(args) != 2 {
+			return fmt.Errorf("%w: %s takes an amount", errUsage, command)
+		}
+		amount, err := parseAmount(args[1])
+		if err != nil {
+			return err
+		}
+		if command == "deposit" {
+			deposit, err := c.Deposit(ctx, amount)
+			if err != nil {
+				return err
+			}
+			return out.print(deposit, func(w io.Writer) {
+				fmt.Fprintln(w, "DEPOSITED\tBALANCE")
+				fmt.Fprintf(w, "%d\t%d\n", amount, deposit.Balance)
+			})
+		}
+		withdrawal, err := c.Withdraw(ctx, amount)
+		if err != nil {
+			return err
+		}
+		return out.print(withdrawal, func(w io.Writer) {
+			fmt.Fprintln(w, "WITHDRAWN\tBALANCE")
+			fmt.Fprintf(w, "%d\t%d\n", withdrawal.Amount, withdrawal.Balance)
+		})
+	case "transfer":
+		if len(args) != 3 {
+			return fmt.Errorf("%w: transfer takes a recipient and an amount", errUsage)
+		}
+		amount, err := parseAmount(args[2])
+		if err != nil {
+			return err
+		}
+		transfer, err := c.Transfer(ctx, args[1], amount)
+		if err != nil {
+			return err
+		}
+		return out.print(transfer, func(w io.Writer) {
+			fmt.Fprintln(w, "TRANSACTION\tTO\tAMOUNT\tBALANCE")
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", transfer.TransactionID, args[1], amount, transfer.FromBalance)
+		})
+	case "history":
+		var flags = flag.NewFlagSet("history", flag.ContinueOnError)
+		var options client.HistoryOptions
+		flags.IntVar(&options.Limit, "limit", 0, "entries per page, 50 by default and at most 200")
+		flags.StringVar(&options.Cursor, "cursor", "", "NextCursor from the previous page")
+		flags.StringVar(&options.Type, "type", "", "only entries of this type, such as transfer")
+		flags.StringVar(&options.Status, "status", "", "only entries with this status, such as failed")
+		if flags.Parse(args[1:]) != nil || flags.NArg() > 0 {
+			return fmt.Errorf("%w: history takes only flags", errUsage)
+		}
+		page, err := c.History(ctx, options)
+		if err != nil {
+			return err
+		}
+		return out.print(page, func(w io.Writer) {
+			fmt.Fprintln(w, "SEQ\tTIME\tTYPE\tFROM\tTO\tAMOUNT\tSTATUS\tID")
+			for _, tx := range page.Transactions {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", tx.Sequence, tx.Timestamp.Local().Format(time.DateTime),
+					tx.Type, tx.From, tx.To, tx.Amount, tx.Status, tx.ID)
+			}
+			if page.NextCursor != "" {
+				fmt.Fprintf(os.Stderr, "More entries, next page: goapi-cli history -cursor %s\n", page.NextCursor)
+			}
+		})
+	}
+	return fmt.Errorf("%w: unknown command %q", errUsage, command)
+}
+
+func runProfile(args []string, profiles Profiles, path string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: profile takes list, save or use", errUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		var w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "\tNAME\tURL\tUSERNAME")
+		for _, name := range profiles.names() {
+			var current string
+			if name == profiles.Current {
+				current = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", current, name, profiles.Profiles[name].URL, profiles.Profiles[name].Username)
+		}
+		return w.Flush()
+	case "save":
+		if len(args) < 2 {
+			return fmt.Errorf("%w: profile save takes a name", errUsage)
+		}
+		var name string = args[1]
+		var profile, ok = profiles.Profiles[name]
+		if !ok {
+			profile.URL = defaultURL
+		}
+		var flags = flag.NewFlagSet("profile save", flag.ContinueOnError)
+		flags.StringVar(&profile.URL, "url", profile.URL, "server URL")
+		flags.StringVar(&profile.Username, "username", profile.Username, "account to act as")
+		flags.StringVar(&profile.Token, "token", profile.Token, "Authorization header value, a static token or \"Bearer <access token>\"")
+		var use = flags.Bool("use", false, "make it the current profile")
+		if flags.Parse(args[2:]) != nil || flags.NArg() > 0 {
+			return fmt.Errorf("%w: profile save takes a name, then flags", errUsage)
+		}
+		profiles.Profiles[name] = profile
+		if *use || profiles.Current == "" {
+			profiles.Current = name
+		}
+		err := profiles.save(path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Saved profile %s to %s\n", name, path)
+		return nil
+	case "use":
+		if len(args) != 2 {
+			return fmt.Errorf("%w: profile use takes a name", errUsage)
+		}
+		if _, ok := profiles.Profiles[args[1]]; !ok {
+			return fmt.Errorf("no profile %q", args[1])
+		}
+		profiles.Current = args[1]
+		return profiles.save(path)
+	}
+	return fmt.Errorf("%w: unknown profile command %q", errUsage, args[0])
+}
+
+// printer writes a response as an aligned table or as the API's JSON
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func (p *printer) print(response interface{}, table func(w io.Writer)) error {
+	if p.format == jsonFormat {
+		var encoder = json.NewEncoder(p.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(response)
+	}
+	var w = tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+func parseAmount(text string) (int64, error) {
+	amount, err := api.ParseAmount(text)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errUsage, err)
+	}
+	return int64(amount), nil
+}
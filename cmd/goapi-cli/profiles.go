@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const defaultURL = "http://localhost:3000"
+
+// Profile is one server and the account used on it
+type Profile struct {
+	URL      string
+	Username string
+	Token    string
+}
+
+// Profiles is the config file, Current is used when no profile is named
+type Profiles struct {
+	Current  string
+	Profiles map[string]Profile
+}
+
+// profilesPath is GOAPI_CLI_CONFIG, or goapi/cli.json in the user's config directory
+func profilesPath() (string, error) {
+	if path := os.Getenv("GOAPI_CLI_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("finding the config directory, set GOAPI_CLI_CONFIG: %w", err)
+	}
+	return filepath.Join(dir, "goapi", "cli.json"), nil
+}
+
+// loadProfiles reads path, a missing file is no profiles
+func loadProfiles(path string) (Profiles, error) {
+	var profiles = Profiles{Profiles: map[string]Profile{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return profiles, nil
+	}
+	if err != nil {
+		return profiles, err
+	}
+	err = json.Unmarshal(data, &profiles)
+	if err != nil {
+		return profiles, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if profiles.Profiles == nil {
+		profiles.Profiles = map[string]Profile{}
+	}
+	return profiles, nil
+}
+
+// save writes the profiles readable only by the user, they hold tokens
+func (p Profiles) save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+func (p Profiles) names() []string {
+	var names = make([]string, 0, len(p.Profiles))
+	for name := range p.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolve picks the profile to use and lays GOAPI_URL, GOAPI_USERNAME and GOAPI_TOKEN
+// over it. name is the -profile flag, then GOAPI_PROFILE, then Current.
+func (p Profiles) resolve(name string) (Profile, error) {
+	if name == "" {
+		name = os.Getenv("GOAPI_PROFILE")
+	}
+	if name == "" {
+		name = p.Current
+	}
+
+	var profile = Profile{URL: defaultURL}
+	if name != "" {
+		found, ok := p.Profiles[name]
+		if !ok {
+			return profile, fmt.Errorf("no profile %q, save one with: goapi-cli profile save %s -url ... -username ... -token ...", name, name)
+		}
+		profile = found
+	}
+
+	for env, field := range map[string]*string{"GOAPI_URL": &profile.URL, "GOAPI_USERNAME": &profile.Username, "GOAPI_TOKEN": &profile.Token} {
+		if value := os.Getenv(env); value != "" {
+			*field = value
+		}
+	}
+	if profile.Username == "" {
+		return profile, errors.New("no username, save a profile or set GOAPI_USERNAME")
+	}
+	return profile, nil
+}
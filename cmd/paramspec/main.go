@@ -0,0 +1,20 @@
+// Command paramspec writes the parameter allowlist, handlers.Routes, as an OpenAPI 3
+// document to stdout. make params-spec keeps api/params.openapi.json up to date with it.
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/bryantjandra/goapi/internal/handlers"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	var encoder *json.Encoder = json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(handlers.ParamsSpec())
+	if err != nil {
+		log.Fatal("Failed to write the spec: ", err)
+	}
+}
@@ -0,0 +1,182 @@
+// Command soak runs a long randomized workload against the ledger in-process and keeps
+// checking its invariants. Every violation is logged with the seed that reproduces the
+// workload (goroutine interleaving still varies between runs).
+//
+//	go run ./cmd/soak -duration 10m -workers 16 -seed 42
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/reconcile"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+var accounts = []string{"aaron", "bryan"}
+
+type soak struct {
+	database tools.DatabaseInterface
+	seed     int64
+
+	// Workers hold the read side per operation, checkpoints take the write side so
+	// balances and counters are compared while nothing is in flight
+	quiesce sync.RWMutex
+
+	initialTotal int64
+	deposited    atomic.Int64
+	withdrawn    atomic.Int64
+	operations   atomic.Int64
+	violations   atomic.Int64
+}
+
+func (s *soak) violation(format string, args ...interface{}) {
+	s.violations.Add(1)
+	log.WithField("seed", s.seed).Error("Invariant violated: ", fmt.Sprintf(format, args...))
+}
+
+func (s *soak) worker(id int, deadline time.Time) {
+	var random = rand.New(rand.NewSource(s.seed + int64(id)))
+
+	// Versions this worker has seen, they must never go backwards
+	var lastVersion = map[string]int64{}
+
+	for time.Now().Before(deadline) {
+		var account = accounts[random.Intn(len(accounts))]
+		var amount = random.Int63n(50) + 1
+
+		s.quiesce.RLock()
+		switch random.Intn(4) {
+		case 0:
+			if _, err := s.database.AddUserCoins(account, amount); err == nil {
+				s.deposited.Add(amount)
+			}
+		case 1:
+			if _, err := s.database.WithdrawUserCoins(account, amount); err == nil {
+				s.withdrawn.Add(amount)
+			}
+		case 2:
+			var other = accounts[(random.Intn(len(accounts)-1)+1+indexOf(account))%len(accounts)]
+			s.database.TransferUserCoins(account, other, amount)
+		case 3:
+			// Read only
+		}
+
+		details, err := s.database.GetUserCoins(account)
+		s.quiesce.RUnlock()
+		s.operations.Add(1)
+
+		if err != nil {
+			s.violation("account %s disappeared: %v", account, err)
+			continue
+		}
+		if details.Coins < 0 {
+			s.violation("account %s has negative balance %d", account, details.Coins)
+		}
+		if details.Version < lastVersion[account] {
+			s.violation("account %s version went from %d to %d (worker %d)", account, lastVersion[account], details.Version, id)
+		}
+		lastVersion[account] = details.Version
+	}
+}
+
+// checkpoint pauses the workers and checks conservation and the double-entry postings
+func (s *soak) checkpoint() {
+	s.quiesce.Lock()
+	defer s.quiesce.Unlock()
+
+	var total int64
+	for _, account := range accounts {
+		details, err := s.database.GetUserCoins(account)
+		if err != nil {
+			s.violation("account %s disappeared: %v", account, err)
+			continue
+		}
+		total += details.Coins
+	}
+
+	var expected = s.initialTotal + s.deposited.Load() - s.withdrawn.Load()
+	if total != expected {
+		s.violation("total balance %d, expected %d", total, expected)
+	}
+
+	var report reconcile.Report = reconcile.Run(s.database)
+	for _, discrepancy := range report.Discrepancies {
+		s.violation("reconciliation %s on %s: %s", discrepancy.Kind, discrepancy.TransactionID, discrepancy.Detail)
+	}
+}
+
+func indexOf(account string) int {
+	for i, candidate := range accounts {
+		if candidate == account {
+			return i
+		}
+	}
+	return 0
+}
+
+func main() {
+	var duration = flag.Duration("duration", time.Minute, "how long to run the workload")
+	var workers = flag.Int("workers", 8, "concurrent workers")
+	var interval = flag.Duration("check", time.Second, "how often to check conservation and reconciliation")
+	var seed = flag.Int64("seed", time.Now().UnixNano(), "random seed, reuse it to reproduce a run")
+	flag.Parse()
+
+	log.SetLevel(log.WarnLevel)
+
+	database, err := tools.NewDatabase()
+	if err != nil {
+		log.Fatal("Failed to connect to database: ", err)
+	}
+
+	var s = &soak{database: *database, seed: *seed}
+	for _, account := range accounts {
+		details, err := s.database.GetUserCoins(account)
+		if err != nil {
+			log.Fatal("Failed to read ", account, ": ", err)
+		}
+		s.initialTotal += details.Coins
+	}
+
+	fmt.Printf("Soaking for %v with %d workers, seed %d\n", *duration, *workers, *seed)
+
+	var deadline = time.Now().Add(*duration)
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			s.worker(id, deadline)
+		}(i)
+	}
+
+	var done = make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var ticker = time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for running := true; running; {
+		select {
+		case <-ticker.C:
+			s.checkpoint()
+		case <-done:
+			running = false
+		}
+	}
+	s.checkpoint()
+
+	fmt.Printf("%d operations, %d violations, seed %d\n", s.operations.Load(), s.violations.Load(), *seed)
+	if s.violations.Load() > 0 {
+		os.Exit(1)
+	}
+}
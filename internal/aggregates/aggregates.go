@@ -0,0 +1,169 @@
+// Package aggregates keeps per-account monthly totals of the ledger, so a statement
+// summary reads a few numbers instead of scanning the account's history. Each account's
+// totals remember the last ledger sequence number they include, and only entries after
+// it are ever read: once when the account is first asked about, then one entry at a
+// time as Wrap sees transactions complete.
+package aggregates
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// MonthFormat is how months are named, always in UTC
+const MonthFormat = "2006-01"
+
+// Entries read per page while catching up on an account. The first page is small,
+// usually only an entry or two are new.
+const (
+	firstRefreshPage = 8
+	maxRefreshPage   = 200
+)
+
+// Month is one account's successful transactions in one UTC month. Out includes
+// FeesPaid. Corrections move no coins in the ledger and aren't counted.
+type Month struct {
+	Month    string
+	In       int64
+	Out      int64
+	FeesPaid int64
+	Count    int64
+}
+
+// account is the view of one account, through is the last sequence number it includes
+type account struct {
+	mu      sync.Mutex
+	through int64
+	months  map[string]*Month
+}
+
+// Views by database, since sequence numbers only mean something in the ledger that
+// handed them out
+var (
+	mu    sync.Mutex
+	views = map[tools.DatabaseInterface]map[string]*account{}
+)
+
+func accountFor(database tools.DatabaseInterface, username string) *account {
+	mu.Lock()
+	defer mu.Unlock()
+
+	accounts, ok := views[database]
+	if !ok {
+		accounts = map[string]*account{}
+		views[database] = accounts
+	}
+	view, ok := accounts[username]
+	if !ok {
+		view = &account{months: map[string]*Month{}}
+		accounts[username] = view
+	}
+	return view
+}
+
+// viewed reports whether username has a view in database
+func viewed(database tools.DatabaseInterface, username string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	_, ok := views[database][username]
+	return ok
+}
+
+// Refresh applies username's ledger entries the view doesn't include yet. It pages
+// back through the per-account index from the newest entry, so it reads only what is
+// new, or the whole history the first time.
+func Refresh(database tools.DatabaseInterface, username string) {
+	var view *account = accountFor(database, username)
+	view.mu.Lock()
+	defer view.mu.Unlock()
+
+	var fresh []tools.TransactionLog
+	var before int64
+	for size := firstRefreshPage; ; size = min(size*2, maxRefreshPage) {
+		var page []tools.TransactionLog = database.GetTransactionHistoryPage(username, before, size)
+
+		// A ledger put back to an earlier state, such as a restored snapshot, is read again
+		if before == 0 && (len(page) == 0 || page[0].SequenceFor(username) < view.through) {
+			view.through = 0
+			view.months = map[string]*Month{}
+		}
+
+		var caughtUp bool
+		for _, tx := range page {
+			if tx.SequenceFor(username) <= view.through {
+				caughtUp = true
+				break
+			}
+			fresh = append(fresh, tx)
+		}
+		if caughtUp || len(page) < size {
+			break
+		}
+		before = page[len(page)-1].SequenceFor(username)
+	}
+
+	// Pages are newest first
+	for i := len(fresh) - 1; i >= 0; i-- {
+		view.apply(username, fresh[i])
+	}
+}
+
+// apply adds one entry to the view, the caller holds view.mu
+func (view *account) apply(username string, tx tools.TransactionLog) {
+	view.through = max(view.through, tx.SequenceFor(username))
+	if tx.Status != "SUCCESS" || tx.Type == tools.CorrectionType {
+		return
+	}
+
+	var key string = tx.Timestamp.UTC().Format(MonthFormat)
+	month, ok := view.months[key]
+	if !ok {
+		month = &Month{Month: key}
+		view.months[key] = month
+	}
+	month.Count++
+	if tx.To == username && tx.From != username {
+		month.In += tx.Amount
+	}
+	if tx.From == username && tx.To != username {
+		month.Out += tx.Amount
+		if tx.Type == "FEE" {
+			month.FeesPaid += tx.Amount
+		}
+	}
+}
+
+// Months returns username's totals for the months from to to, both inclusive, oldest
+// first. Months without transactions are left out.
+func Months(database tools.DatabaseInterface, username string, from time.Time, to time.Time) []Month {
+	Refresh(database, username)
+
+	var view *account = accountFor(database, username)
+	view.mu.Lock()
+	defer view.mu.Unlock()
+
+	var first, last string = from.UTC().Format(MonthFormat), to.UTC().Format(MonthFormat)
+	var result = []Month{}
+	for key, month := range view.months {
+		if key >= first && key <= last {
+			result = append(result, *month)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Month < result[j].Month })
+	return result
+}
+
+// Forget drops the views of usernames in database, for accounts that were renamed or
+// removed
+func Forget(database tools.DatabaseInterface, usernames ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, username := range usernames {
+		delete(views[database], username)
+	}
+}
@@ -0,0 +1,91 @@
+package aggregates
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+// thisMonth is username's current month, zero when it has no transactions yet
+func thisMonth(database tools.DatabaseInterface, username string) Month {
+	var now time.Time = time.Now()
+	for _, month := range Months(database, username, now, now) {
+		return month
+	}
+	return Month{Month: now.UTC().Format(MonthFormat)}
+}
+
+func TestMonths(t *testing.T) {
+	t.Run("Counts_In_And_Out", func(t *testing.T) {
+		var database = toolstest.New(t, nil)
+		var before Month = thisMonth(database, "aaron")
+
+		database.TransferUserCoins("aaron", "bryan", 30)
+		database.AddUserCoins("aaron", 10)
+		database.WithdrawUserCoins("aaron", 5)
+		database.WithdrawUserCoins("aaron", 1_000_000)
+
+		var after Month = thisMonth(database, "aaron")
+		if after.In-before.In != 10 || after.Out-before.Out != 35 || after.Count-before.Count != 3 || after.FeesPaid != before.FeesPaid {
+			t.Errorf("Expected 10 in, 35 out over 3 transactions, went from %+v to %+v", before, after)
+		}
+	})
+
+	t.Run("Out_Of_Range_Months_Left_Out", func(t *testing.T) {
+		var database = toolstest.New(t, nil)
+		database.TransferUserCoins("aaron", "bryan", 30)
+
+		var past time.Time = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+		if months := Months(database, "aaron", past, past.AddDate(1, 0, 0)); len(months) != 0 {
+			t.Errorf("Expected no months in 2000, got %+v", months)
+		}
+	})
+
+	t.Run("Wrapper_Keeps_Views_Current", func(t *testing.T) {
+		var database = Wrap(toolstest.New(t, nil))
+		var before Month = thisMonth(database, "bryan")
+
+		database.TransferUserCoins("aaron", "bryan", 25)
+
+		// Read the view directly, Months would catch up by itself
+		var view *account = accountFor(database, "bryan")
+		view.mu.Lock()
+		var after Month = *view.months[before.Month]
+		view.mu.Unlock()
+		if after.In-before.In != 25 || after.Count-before.Count != 1 {
+			t.Errorf("Expected the transfer in the view, went from %+v to %+v", before, after)
+		}
+
+		if viewed(database, "aaron") {
+			t.Error("Expected no view for an account nobody asked about")
+		}
+	})
+
+	t.Run("Ledger_Behind_The_View_Is_Read_Again", func(t *testing.T) {
+		var database = toolstest.New(t, nil)
+		database.TransferUserCoins("aaron", "bryan", 30)
+		var before Month = thisMonth(database, "aaron")
+
+		// As if the ledger were restored to an earlier snapshot
+		var view *account = accountFor(database, "aaron")
+		view.mu.Lock()
+		view.through += 100
+		view.months[before.Month].Out += 1000
+		view.mu.Unlock()
+
+		if after := thisMonth(database, "aaron"); after != before {
+			t.Errorf("Expected the view rebuilt to %+v, got %+v", before, after)
+		}
+	})
+
+	t.Run("Forget_Drops_The_View", func(t *testing.T) {
+		var database = toolstest.New(t, nil)
+		thisMonth(database, "aaron")
+		Forget(database, "aaron")
+		if viewed(database, "aaron") {
+			t.Error("Expected the view dropped")
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package aggregates
+
+import (
+	"context"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// database brings the views of the accounts a successful transaction names up to date,
+// reading only the entry it added. Everything else passes straight through.
+type database struct {
+	tools.DatabaseInterface
+}
+
+// Wrap returns inner with the views kept current on each transaction. Months still
+// catches up on anything written around it, by another replica for instance.
+func Wrap(inner tools.DatabaseInterface) tools.DatabaseInterface {
+	return &database{DatabaseInterface: inner}
+}
+
+// refresh updates the views that exist. An account nobody has asked about yet is read
+// in full the first time Months is called for it, not on the write path.
+func (d *database) refresh(usernames ...string) {
+	for _, username := range usernames {
+		if viewed(d, username) {
+			Refresh(d, username)
+		}
+	}
+}
+
+func (d *database) AddUserCoins(username string, amount int64) (*tools.CoinDetails, error) {
+	details, err := d.DatabaseInterface.AddUserCoins(username, amount)
+	if err == nil {
+		d.refresh(username)
+	}
+	return details, err
+}
+
+func (d *database) WithdrawUserCoins(username string, amount int64) (*tools.CoinDetails, error) {
+	details, err := d.DatabaseInterface.WithdrawUserCoins(username, amount)
+	if err == nil {
+		d.refresh(username)
+	}
+	return details, err
+}
+
+func (d *database) TransferUserCoins(from string, to string, amount int64) (*tools.CoinDetails, *tools.CoinDetails) {
+	fromDetails, toDetails := d.DatabaseInterface.TransferUserCoins(from, to, amount)
+	if fromDetails != nil && toDetails != nil {
+		d.refresh(from, to)
+	}
+	return fromDetails, toDetails
+}
+
+func (d *database) TransferUserCoinsWithContext(ctx context.Context, from string, to string, amount int64) (*tools.CoinDetails, *tools.CoinDetails, error) {
+	fromDetails, toDetails, err := d.DatabaseInterface.TransferUserCoinsWithContext(ctx, from, to, amount)
+	if err == nil {
+		d.refresh(from, to)
+	}
+	return fromDetails, toDetails, err
+}
+
+func (d *database) CaptureHold(ctx context.Context, id string, to string, amount int64) (*tools.CoinDetails, *tools.CoinDetails, error) {
+	fromDetails, toDetails, err := d.DatabaseInterface.CaptureHold(ctx, id, to, amount)
+	if err == nil {
+		d.refresh(fromDetails.Username)
+		if toDetails != nil {
+			d.refresh(to)
+		}
+	}
+	return fromDetails, toDetails, err
+}
+
+func (d *database) AnonymizeUser(username string, pseudonym string) error {
+	err := d.DatabaseInterface.AnonymizeUser(username, pseudonym)
+	if err == nil {
+		Forget(d, username, pseudonym)
+	}
+	return err
+}
+
+func (d *database) DeleteUser(username string) error {
+	err := d.DatabaseInterface.DeleteUser(username)
+	if err == nil {
+		Forget(d, username)
+	}
+	return err
+}
+
+func (d *database) Subscribe(username string) (<-chan tools.TransactionLog, func()) {
+	return tools.Subscribe(d.DatabaseInterface, username)
+}
+
+// Capabilities are inner's, except the wrapper itself can't be snapshotted
+func (d *database) Capabilities() tools.Capabilities {
+	capabilities := d.DatabaseInterface.Capabilities()
+	capabilities.Snapshots = false
+	return capabilities
+}
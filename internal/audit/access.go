@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redacted replaces the value of anything that looks like a credential
+const Redacted = "[REDACTED]"
+
+// Substrings of field names treated as credentials
+var sensitiveFields = []string{"token", "secret", "password", "authorization", "signature", "key"}
+
+// Number of access entries kept in memory
+const maxAccessEntries = 1000
+
+// AccessEntry is one request made through the audit viewer
+type AccessEntry struct {
+	Username string
+	Role     string
+	Method   string
+	Path     string
+	Query    string
+	IP       string
+	Status   int
+	At       time.Time
+}
+
+var (
+	accessMu  sync.RWMutex
+	accessLog []AccessEntry
+)
+
+// IsSensitive reports whether a field name looks like it holds a credential
+func IsSensitive(field string) bool {
+	field = strings.ToLower(field)
+	for _, sensitive := range sensitiveFields {
+		if strings.Contains(field, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactQuery encodes query with credential values replaced
+func RedactQuery(query url.Values) string {
+	var redacted = url.Values{}
+	for field, values := range query {
+		if IsSensitive(field) {
+			redacted[field] = []string{Redacted}
+			continue
+		}
+		redacted[field] = values
+	}
+	return redacted.Encode()
+}
+
+// RedactData returns a copy of data with credential values replaced
+func RedactData(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+
+	var redacted = make(map[string]interface{}, len(data))
+	for field, value := range data {
+		if IsSensitive(field) {
+			value = Redacted
+		}
+		redacted[field] = value
+	}
+	return redacted
+}
+
+// RecordAccess appends to the audit viewer access log
+func RecordAccess(entry AccessEntry) {
+	accessMu.Lock()
+	defer accessMu.Unlock()
+
+	accessLog = append(accessLog, entry)
+	if len(accessLog) > maxAccessEntries {
+		accessLog = accessLog[len(accessLog)-maxAccessEntries:]
+	}
+}
+
+// AccessLog returns the recorded audit viewer requests, oldest first
+func AccessLog() []AccessEntry {
+	accessMu.RLock()
+	defer accessMu.RUnlock()
+
+	var entries = make([]AccessEntry, len(accessLog))
+	copy(entries, accessLog)
+	return entries
+}
@@ -0,0 +1,29 @@
+package audit
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRedaction(t *testing.T) {
+	t.Run("Query_Credentials_Redacted", func(t *testing.T) {
+		redacted := RedactQuery(url.Values{"account": {"aaron"}, "auth_token": {"1"}, "apiKey": {"abc"}})
+
+		parsed, _ := url.ParseQuery(redacted)
+		if parsed.Get("account") != "aaron" || parsed.Get("auth_token") != Redacted || parsed.Get("apiKey") != Redacted {
+			t.Errorf("Unexpected redaction: %s", redacted)
+		}
+	})
+
+	t.Run("Data_Copied_Not_Modified", func(t *testing.T) {
+		data := map[string]interface{}{"amount": 10, "Secret": "whsec_x"}
+
+		redacted := RedactData(data)
+		if redacted["Secret"] != Redacted || redacted["amount"] != 10 {
+			t.Errorf("Unexpected redaction: %v", redacted)
+		}
+		if data["Secret"] != "whsec_x" {
+			t.Errorf("Original data must not be modified")
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+var (
+	ErrInvalidSigningKey = errors.New("audit signing key must be a base64 encoded 32 byte ed25519 seed")
+	ErrDigestMismatch    = errors.New("export digest does not match its entries")
+	ErrBadSignature      = errors.New("export signature is invalid")
+)
+
+// Ledger export for one account. Digest covers Account, GeneratedAt and Entries,
+// Signature and TimestampToken cover Digest.
+type Export struct {
+	Account     string
+	GeneratedAt time.Time
+	Entries     []tools.TransactionLog
+
+	Digest         string
+	Signature      string
+	PublicKey      string
+	TimestampToken string
+	TimestampedBy  string
+}
+
+// Timestamper submits a digest to an external timestamping service and returns its proof
+type Timestamper interface {
+	Timestamp(ctx context.Context, digest []byte) (token string, err error)
+	Name() string
+}
+
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// NewSigner builds a signer from a base64 encoded ed25519 seed
+func NewSigner(encodedSeed string) (*Signer, error) {
+	seed, err := base64.StdEncoding.DecodeString(encodedSeed)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, ErrInvalidSigningKey
+	}
+
+	return &Signer{key: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// digest hashes the exported content, everything except the proofs themselves
+func digest(export Export) ([]byte, error) {
+	content, err := json.Marshal(struct {
+		Account     string
+		GeneratedAt time.Time
+		Entries     []tools.TransactionLog
+	}{export.Account, export.GeneratedAt, export.Entries})
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(content)
+	return sum[:], nil
+}
+
+// BuildExport assembles an export and, when a signer is given, signs its digest.
+// The timestamper is optional and only consulted for signed exports.
+func BuildExport(ctx context.Context, account string, entries []tools.TransactionLog, signer *Signer, timestamper Timestamper) (Export, error) {
+	// An empty ledger must hash the same way it is rendered, [] rather than null
+	if entries == nil {
+		entries = []tools.TransactionLog{}
+	}
+
+	var export = Export{
+		Account:     account,
+		GeneratedAt: time.Now().UTC(),
+		Entries:     entries,
+	}
+
+	sum, err := digest(export)
+	if err != nil {
+		return Export{}, err
+	}
+	export.Digest = hex.EncodeToString(sum)
+
+	if signer == nil {
+		return export, nil
+	}
+
+	export.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(signer.key, sum))
+	export.PublicKey = base64.StdEncoding.EncodeToString(signer.PublicKey())
+
+	if timestamper != nil {
+		token, err := timestamper.Timestamp(ctx, sum)
+		if err != nil {
+			return Export{}, fmt.Errorf("timestamping failed: %w", err)
+		}
+		export.TimestampToken = token
+		export.TimestampedBy = timestamper.Name()
+	}
+
+	return export, nil
+}
+
+// Verify recomputes the digest from the entries and checks the signature against publicKey
+func Verify(export Export, publicKey ed25519.PublicKey) error {
+	sum, err := digest(export)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(sum) != export.Digest {
+		return ErrDigestMismatch
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(export.Signature)
+	if err != nil || !ed25519.Verify(publicKey, sum, signature) {
+		return ErrBadSignature
+	}
+
+	return nil
+}
+
+// HTTPTimestamper posts {"Digest": "<hex>"} to URL and keeps the response body as the token
+type HTTPTimestamper struct {
+	URL    string
+	Client *http.Client
+}
+
+func (h *HTTPTimestamper) Name() string {
+	return h.URL
+}
+
+func (h *HTTPTimestamper) Timestamp(ctx context.Context, sum []byte) (string, error) {
+	body, err := json.Marshal(map[string]string{"Digest": hex.EncodeToString(sum)})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var client *http.Client = h.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	token, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("timestamping service returned %d", resp.StatusCode)
+	}
+
+	return string(token), nil
+}
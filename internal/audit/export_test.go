@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+var testSeed = base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+func TestSignedExport(t *testing.T) {
+	entries := []tools.TransactionLog{
+		{ID: "tx1", Type: "DEPOSIT", To: "aaron", Amount: 100, Timestamp: time.Unix(1700000000, 0).UTC(), Status: "SUCCESS"},
+		{ID: "tx2", Type: "TRANSFER", From: "aaron", To: "bryan", Amount: 40, Timestamp: time.Unix(1700000060, 0).UTC(), Status: "SUCCESS"},
+	}
+
+	signer, err := NewSigner(testSeed)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	t.Run("Signature_Verifies", func(t *testing.T) {
+		export, err := BuildExport(context.Background(), "aaron", entries, signer, nil)
+		if err != nil {
+			t.Fatalf("Failed to build export: %v", err)
+		}
+
+		if err := Verify(export, signer.PublicKey()); err != nil {
+			t.Errorf("Expected export to verify, got %v", err)
+		}
+	})
+
+	t.Run("Tampering_Detected", func(t *testing.T) {
+		export, err := BuildExport(context.Background(), "aaron", entries, signer, nil)
+		if err != nil {
+			t.Fatalf("Failed to build export: %v", err)
+		}
+
+		tampered := export
+		tampered.Entries = append([]tools.TransactionLog{}, export.Entries...)
+		tampered.Entries[1].Amount = 4
+
+		if err := Verify(tampered, signer.PublicKey()); err != ErrDigestMismatch {
+			t.Errorf("Expected ErrDigestMismatch, got %v", err)
+		}
+	})
+
+	t.Run("Digest_Submitted_To_Timestamper", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("proof-123"))
+		}))
+		defer server.Close()
+
+		export, err := BuildExport(context.Background(), "aaron", entries, signer, &HTTPTimestamper{URL: server.URL})
+		if err != nil {
+			t.Fatalf("Failed to build export: %v", err)
+		}
+
+		if export.TimestampToken != "proof-123" || export.TimestampedBy != server.URL {
+			t.Errorf("Expected timestamp proof from %s, got %q from %q", server.URL, export.TimestampToken, export.TimestampedBy)
+		}
+	})
+
+	t.Run("Invalid_Key_Rejected", func(t *testing.T) {
+		if _, err := NewSigner("not-a-key"); err != ErrInvalidSigningKey {
+			t.Errorf("Expected ErrInvalidSigningKey, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+// Package auth carries the caller Authorization verified through the request context,
+// so handlers never have to trust a username from the request itself.
+package auth
+
+import "context"
+
+// AccountHeader names the joint account a co-owner acts on. They still authenticate
+// as themselves.
+const AccountHeader = "X-Goapi-Account"
+
+// Principal is the account a request was authenticated as
+type Principal struct {
+	Username string
+	Role     string
+
+	// Set when a co-owner acts on the joint account Username, to who they are
+	Owner      string
+	Permission string
+
+	// Set to the grant ID when an operator authenticated with a break-glass token
+	BreakGlass string
+}
+
+// Actor is who made the request, the co-owner on a joint account
+func (p Principal) Actor() string {
+	if p.Owner != "" {
+		return p.Owner
+	}
+	return p.Username
+}
+
+// Holder is true unless a co-owner is acting on someone else's account
+func (p Principal) Holder() bool {
+	return p.Owner == ""
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns ctx carrying principal, only Authorization should call it
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// From returns the principal of the request, false if it didn't go through Authorization
+func From(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// UserFrom is the username of the request's principal, empty if it has none
+func UserFrom(ctx context.Context) string {
+	principal, _ := From(ctx)
+	return principal.Username
+}
+
+// RoleFrom is the role of the request's principal, empty if it has none
+func RoleFrom(ctx context.Context) string {
+	principal, _ := From(ctx)
+	return principal.Role
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPrincipal(t *testing.T) {
+	if _, ok := From(context.Background()); ok || UserFrom(context.Background()) != "" {
+		t.Error("Expected no principal on a bare context")
+	}
+
+	var ctx = WithPrincipal(context.Background(), Principal{Username: "aaron", Role: "user"})
+	principal, ok := From(ctx)
+	if !ok || principal.Username != "aaron" || UserFrom(ctx) != "aaron" || RoleFrom(ctx) != "user" {
+		t.Errorf("Expected aaron the user, got %+v", principal)
+	}
+}
+
+func TestJointAccountPrincipal(t *testing.T) {
+	var holder = Principal{Username: "aaron", Role: "user"}
+	if !holder.Holder() || holder.Actor() != "aaron" {
+		t.Errorf("Expected aaron to act on their own account, got %+v", holder)
+	}
+
+	var owner = Principal{Username: "aaron", Role: "user", Owner: "bryan", Permission: "view"}
+	if owner.Holder() || owner.Actor() != "bryan" {
+		t.Errorf("Expected bryan to act on aaron's account, got %+v", owner)
+	}
+}
@@ -0,0 +1,120 @@
+// Package bench holds the maintained benchmark suite: every storage backend and the
+// HTTP layer end to end. Run it with make bench, which writes benchstat-compatible
+// output, and compare two runs with benchstat old.txt new.txt.
+package bench
+
+import (
+	"os"
+	"strings"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// Accounts every backend is expected to have, each starting with plenty of coins
+const (
+	From = "bench_from"
+	To   = "bench_to"
+)
+
+// Backend opens a fresh database with the From and To accounts
+type Backend struct {
+	Name string
+	Open func() (tools.DatabaseInterface, error)
+}
+
+func memory() (tools.DatabaseInterface, error) {
+	logins, coins := tools.DemoAccounts()
+	for _, username := range []string{From, To} {
+		logins[username] = tools.LoginDetails{AuthToken: username, Username: username, Role: tools.RoleUser}
+		coins[username] = tools.CoinDetails{Coins: 1_000_000_000, Username: username, Version: 1}
+	}
+
+	database, err := tools.NewMemoryDatabase(logins, coins)
+	if err != nil {
+		return nil, err
+	}
+	return *database, nil
+}
+
+// Backends lists the storage backends to benchmark. MySQL and Redis are only included
+// when BENCH_MYSQL_DSN or BENCH_REDIS_URL is set, and must already have the From and To
+// accounts. BENCH_LATENCY_PROFILES adds the memory backend under each listed profile.
+func Backends() []Backend {
+	var backends = []Backend{
+		{Name: "memory", Open: memory},
+		{Name: "degraded", Open: func() (tools.DatabaseInterface, error) {
+			inner, err := memory()
+			if err != nil {
+				return nil, err
+			}
+			database, err := tools.NewDegradedDatabase(inner, tools.DegradedOptions{FailureThreshold: 3})
+			if err != nil {
+				return nil, err
+			}
+			return *database, nil
+		}},
+		{Name: "failover", Open: func() (tools.DatabaseInterface, error) {
+			primary, err := memory()
+			if err != nil {
+				return nil, err
+			}
+			secondary, err := memory()
+			if err != nil {
+				return nil, err
+			}
+			database, err := tools.NewFailoverDatabase(primary, secondary, tools.FailoverOptions{FailureThreshold: 3})
+			if err != nil {
+				return nil, err
+			}
+			return *database, nil
+		}},
+	}
+
+	if dsn := os.Getenv("BENCH_MYSQL_DSN"); dsn != "" {
+		backends = append(backends, Backend{Name: "mysql", Open: func() (tools.DatabaseInterface, error) {
+			var cfg config.Config = config.Get()
+			cfg.DatabaseDriver = config.DriverMySQL
+			cfg.DatabaseDSN = dsn
+			config.Set(cfg)
+
+			database, err := tools.NewDatabase()
+			if err != nil {
+				return nil, err
+			}
+			return *database, nil
+		}})
+	}
+
+	// The memory backend again, answering like the named kind of server
+	for _, name := range strings.Fields(strings.ReplaceAll(os.Getenv("BENCH_LATENCY_PROFILES"), ",", " ")) {
+		backends = append(backends, Backend{Name: "mock-" + name, Open: func() (tools.DatabaseInterface, error) {
+			profile, err := tools.LatencyProfileNamed(name)
+			if err != nil {
+				return nil, err
+			}
+			inner, err := memory()
+			if err != nil {
+				return nil, err
+			}
+			return tools.WithLatency(inner, profile), nil
+		}})
+	}
+
+	if url := os.Getenv("BENCH_REDIS_URL"); url != "" {
+		backends = append(backends, Backend{Name: "redis", Open: func() (tools.DatabaseInterface, error) {
+			var cfg config.Config = config.Get()
+			cfg.DatabaseDriver = config.DriverRedis
+			cfg.DatabaseDSN = url
+			config.Set(cfg)
+
+			database, err := tools.NewDatabase()
+			if err != nil {
+				return nil, err
+			}
+			return *database, nil
+		}})
+	}
+
+	return backends
+}
@@ -0,0 +1,198 @@
+package bench
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/policy"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/tools/apitest"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	// Per-request info logs would dominate the HTTP numbers
+	log.SetLevel(log.WarnLevel)
+
+	os.Exit(m.Run())
+}
+
+// liftLimits lifts the policy limits of server's database, benchmarks move coins
+// between the same two accounts far more often than the default limits allow
+func liftLimits(b *testing.B, server *apitest.Server) {
+	var doc policy.Document = policy.Current(server.Database)
+	for currency := range doc.Limits {
+		doc.Limits[currency][policy.DefaultTier] = policy.Limits{MaxBalance: 1 << 62, MaxTransaction: 1 << 62, DailyLimit: 1 << 62}
+	}
+	doc.PairLimits = policy.PairLimits{}
+	_, err := policy.Update(server.Database, doc, "bench")
+	if err != nil {
+		b.Fatal("Failed to lift limits for benchmarks: ", err)
+	}
+}
+
+// Sub-benchmarks are named backend=<name>/op=<operation> so benchstat can group them
+func BenchmarkStorage(b *testing.B) {
+	for _, backend := range Backends() {
+		database, err := backend.Open()
+		if err != nil {
+			b.Fatalf("Failed to open %s: %v", backend.Name, err)
+		}
+
+		b.Run("backend="+backend.Name+"/op=GetUserCoins", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				database.GetUserCoins(From)
+			}
+		})
+
+		b.Run("backend="+backend.Name+"/op=DepositWithdraw", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if i%2 == 0 {
+					database.AddUserCoins(From, 1)
+				} else {
+					database.WithdrawUserCoins(From, 1)
+				}
+			}
+		})
+
+		b.Run("backend="+backend.Name+"/op=Transfer", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				transfer(database, i)
+			}
+		})
+
+		// Opposite transfers from every CPU at once, where lock contention shows up
+		b.Run("backend="+backend.Name+"/op=TransferParallel", func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				var i int
+				for pb.Next() {
+					transfer(database, i)
+					i++
+				}
+			})
+		})
+	}
+}
+
+// transfer moves one coin back and forth so balances stay put however long it runs
+func transfer(database tools.DatabaseInterface, i int) {
+	if i%2 == 0 {
+		database.TransferUserCoins(From, To, 1)
+	} else {
+		database.TransferUserCoins(To, From, 1)
+	}
+}
+
+// Full router with every middleware against the memory backend. Authorization looks the
+// user up on every request, which the mock store delays by 5ms.
+func BenchmarkHTTP(b *testing.B) {
+	var server = apitest.New(b,
+		apitest.WithAccount(From, From, tools.RoleUser, 1_000_000_000),
+		apitest.WithAccount(To, To, tools.RoleUser, 1_000_000_000),
+	)
+	liftLimits(b, server)
+	var from, to = server.Client(From), server.Client(To)
+
+	do := func(b *testing.B, client *http.Client, method string, path string) {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			b.Fatalf("%s %s returned %d", method, path, resp.StatusCode)
+		}
+	}
+
+	b.Run("op=GetCoinBalance", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			do(b, from, http.MethodGet, "/account/coins")
+		}
+	})
+
+	b.Run("op=Transfer", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if i%2 == 0 {
+				do(b, from, http.MethodPost, "/account/coins/transfer?from="+From+"&to="+To+"&amount=1")
+			} else {
+				do(b, to, http.MethodPost, "/account/coins/transfer?from="+To+"&to="+From+"&amount=1")
+			}
+		}
+	})
+
+	b.Run("op=GetCoinBalanceParallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				do(b, from, http.MethodGet, "/account/coins")
+			}
+		})
+	})
+}
+
+// The router driven in-process, so allocs/op counts the server's work without the
+// loopback client. Mixed is the 80/20 workload: four balance reads per transfer.
+func BenchmarkHandlers(b *testing.B) {
+	var server = apitest.New(b,
+		apitest.WithAccount(From, From, tools.RoleUser, 1_000_000_000),
+		apitest.WithAccount(To, To, tools.RoleUser, 1_000_000_000),
+	)
+	liftLimits(b, server)
+	var handler http.Handler = server.Config.Handler
+
+	balance := func(b *testing.B) {
+		req := httptest.NewRequest(http.MethodGet, "/account/coins?username="+From, nil)
+		req.Header.Set("Authorization", From)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			b.Fatalf("Balance returned %d: %s", w.Code, w.Body)
+		}
+	}
+	transfer := func(b *testing.B, i int) {
+		from, to := From, To
+		if i%2 == 1 {
+			from, to = To, From
+		}
+		req := httptest.NewRequest(http.MethodPost, "/account/coins/transfer?username="+from,
+			strings.NewReader(`{"From":"`+from+`","To":"`+to+`","Amount":1}`))
+		req.Header.Set("Authorization", from)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			b.Fatalf("Transfer returned %d: %s", w.Code, w.Body)
+		}
+	}
+
+	b.Run("op=GetCoinBalance", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			balance(b)
+		}
+	})
+
+	b.Run("op=Transfer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			transfer(b, i)
+		}
+	})
+
+	b.Run("op=Mixed80_20", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if i%5 == 4 {
+				transfer(b, i/5)
+			} else {
+				balance(b)
+			}
+		}
+	})
+}
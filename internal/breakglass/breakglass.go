@@ -0,0 +1,160 @@
+// Package breakglass issues short-lived super-admin tokens for emergencies. Tokens are
+// only minted over a local Unix socket, each needs a reason, and both the minting and
+// every request made with one are recorded as events.
+package breakglass
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+)
+
+// Scheme is how a break-glass token is sent: "Authorization: BreakGlass <token>"
+const Scheme = "BreakGlass "
+
+// Longest reason a grant can carry, in bytes
+const MaxReasonLength = 500
+
+var (
+	ErrReasonRequired = errors.New("a reason is required to break glass")
+	ErrInvalidTTL     = errors.New("invalid break-glass TTL")
+	ErrInvalidToken   = errors.New("invalid or expired break-glass token")
+	ErrNotFound       = errors.New("break-glass grant not found")
+)
+
+// Grant is one minted token, never the token itself
+type Grant struct {
+	ID        string
+	Operator  string
+	Reason    string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+
+	// Set if the grant was revoked before it expired
+	RevokedAt time.Time
+}
+
+// Active is true until the grant expires or is revoked
+func (g Grant) Active(now time.Time) bool {
+	return g.RevokedAt.IsZero() && now.Before(g.ExpiresAt)
+}
+
+var (
+	mu sync.Mutex
+
+	// Every grant by the hash of its token, expired ones are kept for the record
+	grants = map[string]*Grant{}
+)
+
+// IsBreakGlass reports whether an Authorization header carries a break-glass token
+func IsBreakGlass(header string) bool {
+	return strings.HasPrefix(header, Scheme)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newSecret(n int) string {
+	bytes := make([]byte, n)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// Mint issues a token for operator valid for ttl, at most maxTTL, and returns it with
+// its grant. Only its hash is kept.
+func Mint(operator string, reason string, ttl time.Duration, maxTTL time.Duration, now time.Time) (Grant, string, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len(reason) > MaxReasonLength {
+		return Grant{}, "", ErrReasonRequired
+	}
+	if ttl <= 0 || ttl > maxTTL {
+		return Grant{}, "", ErrInvalidTTL
+	}
+	if operator == "" {
+		operator = "unknown"
+	}
+
+	var token string = newSecret(32)
+	var grant = &Grant{
+		ID:        newSecret(8),
+		Operator:  operator,
+		Reason:    reason,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	mu.Lock()
+	grants[hashToken(token)] = grant
+	var result = *grant
+	mu.Unlock()
+
+	// Grants belong to the process, not to a database, so their events go to its log
+	events.Record(nil, events.BreakGlassIssued, result.Operator, map[string]interface{}{
+		"grant":      result.ID,
+		"reason":     result.Reason,
+		"expires_at": result.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+	return result, token, nil
+}
+
+// Verify returns the active grant for an Authorization header carrying a break-glass token
+func Verify(header string, now time.Time) (Grant, error) {
+	if !IsBreakGlass(header) {
+		return Grant{}, ErrInvalidToken
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	grant, ok := grants[hashToken(strings.TrimPrefix(header, Scheme))]
+	if !ok || !grant.Active(now) {
+		return Grant{}, ErrInvalidToken
+	}
+	return *grant, nil
+}
+
+// Revoke ends a grant before it expires
+func Revoke(id string, now time.Time) (Grant, error) {
+	mu.Lock()
+	var result Grant
+	var found bool
+	for _, grant := range grants {
+		if grant.ID == id && grant.Active(now) {
+			grant.RevokedAt = now
+			result = *grant
+			found = true
+			break
+		}
+	}
+	mu.Unlock()
+
+	if !found {
+		return Grant{}, ErrNotFound
+	}
+	events.Record(nil, events.BreakGlassRevoked, result.Operator, map[string]interface{}{
+		"grant": result.ID,
+	})
+	return result, nil
+}
+
+// Grants returns every grant minted by this process, newest first
+func Grants() []Grant {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var result = make([]Grant, 0, len(grants))
+	for _, grant := range grants {
+		result = append(result, *grant)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].IssuedAt.After(result[j].IssuedAt) })
+	return result
+}
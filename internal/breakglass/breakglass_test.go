@@ -0,0 +1,105 @@
+package breakglass
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+)
+
+func TestBreakGlass(t *testing.T) {
+	var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Token_Works_Until_It_Expires", func(t *testing.T) {
+		grant, token, err := Mint("oncall", "INC-1: ledger stuck", 10*time.Minute, time.Hour, now)
+		if err != nil {
+			t.Fatalf("Failed to mint: %v", err)
+		}
+
+		verified, err := Verify(Scheme+token, now.Add(9*time.Minute))
+		if err != nil || verified.ID != grant.ID || verified.Reason != "INC-1: ledger stuck" {
+			t.Fatalf("Expected the grant back, got %+v, %v", verified, err)
+		}
+		if _, err := Verify(Scheme+token, now.Add(10*time.Minute)); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected the token refused once expired, got %v", err)
+		}
+		if _, err := Verify(token, now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected the token refused without its scheme, got %v", err)
+		}
+
+		var recorded bool
+		for _, event := range events.About(nil, "oncall") {
+			if event.Type == events.BreakGlassIssued && event.Data["grant"] == grant.ID {
+				recorded = event.Data["reason"] == "INC-1: ledger stuck"
+			}
+		}
+		if !recorded {
+			t.Error("Expected the reason in the issued event")
+		}
+	})
+
+	t.Run("Revoked_Token_Is_Refused", func(t *testing.T) {
+		grant, token, _ := Mint("oncall", "INC-2", time.Minute, time.Hour, now)
+		if _, err := Revoke(grant.ID, now); err != nil {
+			t.Fatalf("Failed to revoke: %v", err)
+		}
+		if _, err := Verify(Scheme+token, now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected the revoked token refused, got %v", err)
+		}
+		if _, err := Revoke(grant.ID, now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound revoking twice, got %v", err)
+		}
+	})
+
+	t.Run("Reason_And_TTL_Are_Enforced", func(t *testing.T) {
+		if _, _, err := Mint("oncall", "  ", time.Minute, time.Hour, now); !errors.Is(err, ErrReasonRequired) {
+			t.Errorf("Expected ErrReasonRequired, got %v", err)
+		}
+		if _, _, err := Mint("oncall", "INC-3", 2*time.Hour, time.Hour, now); !errors.Is(err, ErrInvalidTTL) {
+			t.Errorf("Expected ErrInvalidTTL past the maximum, got %v", err)
+		}
+	})
+
+	t.Run("Socket_Mints_Tokens", func(t *testing.T) {
+		var path string = filepath.Join(t.TempDir(), "break-glass.sock")
+		ctx, cancel := context.WithCancel(context.Background())
+		var done = make(chan error, 1)
+		go func() { done <- Serve(ctx, path, 15*time.Minute) }()
+
+		var response Response
+		var err error
+		for i := 0; i < 50; i++ {
+			response, err = Send(path, Request{Command: CommandMint, Operator: "oncall", Reason: "INC-4"})
+			if err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil || response.Token == "" || response.Grant.ExpiresAt.Sub(response.Grant.IssuedAt) != 15*time.Minute {
+			t.Fatalf("Expected a token for the longest TTL, got %+v, %v", response, err)
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+			t.Errorf("Expected the socket readable by its owner only, got %v, %v", info.Mode(), err)
+		}
+
+		if _, err := Send(path, Request{Command: CommandMint, Operator: "oncall"}); err == nil || err.Error() != ErrReasonRequired.Error() {
+			t.Errorf("Expected the socket to refuse a mint without a reason, got %v", err)
+		}
+		listed, err := Send(path, Request{Command: CommandList})
+		if err != nil || len(listed.Grants) == 0 || listed.Grants[0].ID != response.Grant.ID {
+			t.Errorf("Expected the new grant listed first, got %+v, %v", listed, err)
+		}
+
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Expected a clean stop, got %v", err)
+		}
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected the socket removed on stop, got %v", err)
+		}
+	})
+}
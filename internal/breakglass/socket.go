@@ -0,0 +1,164 @@
+package breakglass
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Socket commands
+const (
+	CommandMint   = "mint"
+	CommandRevoke = "revoke"
+	CommandList   = "list"
+)
+
+// How long one command may take before its connection is closed
+const commandTimeout = 5 * time.Second
+
+// Request is the one JSON object a connection to the socket sends. TTL is a duration
+// such as "10m", empty for the longest allowed.
+type Request struct {
+	Command  string
+	Operator string
+	Reason   string
+	TTL      string
+	Grant    string
+}
+
+// Response is what the socket answers, Error set if the command was refused. Token is
+// only ever sent once, in answer to mint.
+type Response struct {
+	Error  string
+	Token  string
+	Grant  *Grant
+	Grants []Grant
+}
+
+// Serve answers commands on a Unix socket at path, readable only by the server's own
+// user, until ctx is done. A socket left behind by a previous run is replaced, any
+// other file is not.
+func Serve(ctx context.Context, path string, maxTTL time.Duration) error {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("break-glass socket %s exists and is not a socket", path)
+		}
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("listening on break-glass socket: %w", err)
+	}
+	err = os.Chmod(path, 0o600)
+	if err != nil {
+		listener.Close()
+		return fmt.Errorf("restricting break-glass socket: %w", err)
+	}
+
+	// Closing the listener removes the socket
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	log.Info("Break-glass socket listening on ", path)
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			log.Error("Break-glass socket accept failed: ", err)
+			continue
+		}
+		go handle(conn, maxTTL)
+	}
+}
+
+func handle(conn net.Conn, maxTTL time.Duration) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(commandTimeout))
+
+	var request Request
+	var response Response
+	err := json.NewDecoder(conn).Decode(&request)
+	if err == nil {
+		response, err = run(request, maxTTL, time.Now())
+	}
+	if err != nil {
+		log.Error("Break-glass command refused: ", err)
+		response = Response{Error: err.Error()}
+	}
+
+	err = json.NewEncoder(conn).Encode(response)
+	if err != nil {
+		log.Error("Failed to answer break-glass command: ", err)
+	}
+}
+
+func run(request Request, maxTTL time.Duration, now time.Time) (Response, error) {
+	switch request.Command {
+	case CommandMint:
+		var ttl time.Duration = maxTTL
+		if request.TTL != "" {
+			parsed, err := time.ParseDuration(request.TTL)
+			if err != nil {
+				return Response{}, fmt.Errorf("%w: %v", ErrInvalidTTL, err)
+			}
+			ttl = parsed
+		}
+		grant, token, err := Mint(request.Operator, request.Reason, ttl, maxTTL, now)
+		if err != nil {
+			return Response{}, err
+		}
+		log.WithFields(log.Fields{
+			"grant":      grant.ID,
+			"operator":   grant.Operator,
+			"reason":     grant.Reason,
+			"expires_at": grant.ExpiresAt,
+		}).Warn("Break-glass token issued")
+		return Response{Token: token, Grant: &grant}, nil
+	case CommandRevoke:
+		grant, err := Revoke(request.Grant, now)
+		if err != nil {
+			return Response{}, err
+		}
+		log.WithFields(log.Fields{"grant": grant.ID, "operator": grant.Operator}).Warn("Break-glass token revoked")
+		return Response{Grant: &grant}, nil
+	case CommandList:
+		return Response{Grants: Grants()}, nil
+	}
+	return Response{}, fmt.Errorf("unknown command %q, expected %s, %s or %s", request.Command, CommandMint, CommandRevoke, CommandList)
+}
+
+// Send runs one command on the socket at path
+func Send(path string, request Request) (Response, error) {
+	conn, err := net.DialTimeout("unix", path, commandTimeout)
+	if err != nil {
+		return Response{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(commandTimeout))
+
+	err = json.NewEncoder(conn).Encode(request)
+	if err != nil {
+		return Response{}, err
+	}
+
+	var response Response
+	err = json.NewDecoder(conn).Decode(&response)
+	if err != nil {
+		return Response{}, err
+	}
+	if response.Error != "" {
+		return response, errors.New(response.Error)
+	}
+	return response, nil
+}
@@ -0,0 +1,87 @@
+// Package buildinfo identifies the running build. Version, Commit and BuildTime are set
+// at link time, as the Makefile's build target does:
+//
+//	go build -ldflags "-X github.com/bryantjandra/goapi/internal/buildinfo.Version=v1.2.0" ./cmd/api
+//
+// A build without them falls back to the module version and VCS revision the go tool
+// stamps into binaries built inside a checkout. The stamp has no build time.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Set with -ldflags -X, so they must stay uninitialized or string constants
+var (
+	Version   string
+	Commit    string
+	BuildTime string
+)
+
+type Info struct {
+	Version   string
+	Commit    string
+	BuildTime string
+	GoVersion string
+
+	// The checkout had uncommitted changes, only known from the VCS stamp
+	Modified bool
+}
+
+var (
+	once    sync.Once
+	current Info
+)
+
+// Get returns the build's details, "dev" and "unknown" for what neither the linker nor
+// the VCS stamp provided
+func Get() Info {
+	once.Do(func() {
+		current = resolve(Version, Commit, BuildTime)
+	})
+	return current
+}
+
+func resolve(version, commit, buildTime string) Info {
+	var info = Info{Version: version, Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
+
+// Fields are the details for structured logs and health reports
+func (i Info) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"version":    i.Version,
+		"commit":     i.Commit,
+		"build_time": i.BuildTime,
+		"go_version": i.GoVersion,
+		"modified":   i.Modified,
+	}
+}
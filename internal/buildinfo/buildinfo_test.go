@@ -0,0 +1,23 @@
+package buildinfo
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	t.Run("Linker_Values_Win", func(t *testing.T) {
+		info := resolve("v1.2.0", "abc123", "2026-03-01T12:00:00Z")
+		if info.Version != "v1.2.0" || info.Commit != "abc123" || info.BuildTime != "2026-03-01T12:00:00Z" {
+			t.Errorf("Expected the linker values, got %+v", info)
+		}
+		if info.GoVersion == "" {
+			t.Error("Expected the Go version")
+		}
+	})
+
+	t.Run("Missing_Values_Are_Named", func(t *testing.T) {
+		// Test binaries carry no VCS stamp
+		info := resolve("", "", "")
+		if info.Version != "dev" || info.Commit != "unknown" || info.BuildTime != "unknown" {
+			t.Errorf("Expected dev and unknown, got %+v", info)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+// Package cachebus tells every replica which cached entries a mutation on one of them
+// made stale. Transports only broadcast bytes. The bus adds the sender and send time,
+// ignores its own messages and measures how late the others arrive.
+package cachebus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrSubscriptionLost = errors.New("cache invalidation subscription lost")
+
+// How long Invalidate waits for the transport
+const publishTimeout = 2 * time.Second
+
+// Transport broadcasts payloads to every replica, this one included
+type Transport interface {
+	Publish(ctx context.Context, payload []byte) error
+
+	// Subscribe delivers nil once subscribed, then payloads until ctx is done. It returns
+	// an error as soon as the subscription is lost, since anything sent meanwhile is missed.
+	Subscribe(ctx context.Context, deliver func(payload []byte)) error
+}
+
+type message struct {
+	Origin string
+	Keys   []string
+	SentAt time.Time
+}
+
+type Metrics struct {
+	Published     int64
+	PublishFailed int64
+	Received      int64
+
+	// Received more than the staleness window after they were sent
+	Late int64
+
+	LastLag    time.Duration
+	MaxLag     time.Duration
+	AverageLag time.Duration
+
+	// Times every entry was dropped because invalidations may have been missed
+	Flushes   int64
+	Connected bool
+}
+
+type Bus struct {
+	transport Transport
+	node      string
+	window    time.Duration
+
+	mu       sync.Mutex
+	handlers []func(keys []string)
+	metrics  Metrics
+	totalLag time.Duration
+}
+
+// New returns a bus that keeps caches at most window behind the other replicas,
+// as long as the clocks agree. Run has to be started for it to receive anything.
+func New(transport Transport, window time.Duration) *Bus {
+	var node = make([]byte, 8)
+	rand.Read(node)
+	return &Bus{transport: transport, node: hex.EncodeToString(node), window: window}
+}
+
+// Invalidate tells the other replicas keys changed here
+func (b *Bus) Invalidate(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(message{Origin: b.node, Keys: keys, SentAt: time.Now()})
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		err = b.transport.Publish(ctx, payload)
+		cancel()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err != nil {
+		b.metrics.PublishFailed++
+		log.Error("Failed to publish cache invalidation: ", err)
+		return
+	}
+	b.metrics.Published++
+}
+
+// OnInvalidate registers handler for keys changed on another replica. A nil slice
+// means every entry may be stale and the whole cache should be dropped.
+func (b *Bus) OnInvalidate(handler func(keys []string)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+}
+
+// Run receives invalidations until ctx is done. While the subscription is down every
+// cache is dropped once per window, since invalidations are being missed.
+func (b *Bus) Run(ctx context.Context) {
+	for {
+		err := b.transport.Subscribe(ctx, func(payload []byte) {
+			if payload == nil {
+				b.setConnected(true)
+				return
+			}
+			b.receive(payload)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Warn("Cache invalidation bus disconnected, dropping cached entries: ", err)
+		b.setConnected(false)
+		b.flush()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(b.window):
+		}
+	}
+}
+
+func (b *Bus) setConnected(connected bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.metrics.Connected = connected
+}
+
+func (b *Bus) receive(payload []byte) {
+	var msg message
+	err := json.Unmarshal(payload, &msg)
+	if err != nil {
+		log.Error("Ignoring malformed cache invalidation: ", err)
+		return
+	}
+	if msg.Origin == b.node {
+		return
+	}
+
+	var lag time.Duration = time.Since(msg.SentAt)
+
+	b.mu.Lock()
+	b.metrics.Received++
+	b.metrics.LastLag = lag
+	b.metrics.MaxLag = max(b.metrics.MaxLag, lag)
+	b.totalLag += lag
+	b.metrics.AverageLag = b.totalLag / time.Duration(b.metrics.Received)
+	if lag > b.window {
+		b.metrics.Late++
+		log.Warn("Cache invalidation from ", msg.Origin, " arrived ", lag, " after it was sent")
+	}
+	var handlers = b.handlers
+	b.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(msg.Keys)
+	}
+}
+
+func (b *Bus) flush() {
+	b.mu.Lock()
+	b.metrics.Flushes++
+	var handlers = b.handlers
+	b.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(nil)
+	}
+}
+
+func (b *Bus) Metrics() Metrics {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.metrics
+}
+
+// Health reports the metrics in the shape of GetSystemHealth
+func (b *Bus) Health() map[string]interface{} {
+	var metrics Metrics = b.Metrics()
+	return map[string]interface{}{
+		"connected":      metrics.Connected,
+		"published":      metrics.Published,
+		"publish_failed": metrics.PublishFailed,
+		"received":       metrics.Received,
+		"late":           metrics.Late,
+		"last_lag_ms":    metrics.LastLag.Milliseconds(),
+		"max_lag_ms":     metrics.MaxLag.Milliseconds(),
+		"average_lag_ms": metrics.AverageLag.Milliseconds(),
+		"flushes":        metrics.Flushes,
+	}
+}
@@ -0,0 +1,111 @@
+package cachebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+var _ tools.Invalidator = (*Bus)(nil)
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	var deadline = time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReplicaInvalidation(t *testing.T) {
+	storage, err := tools.NewMemoryDatabase(nil, map[string]tools.CoinDetails{
+		"aaron": {Username: "aaron", Coins: 100, Version: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var hub *Hub = NewHub()
+	var buses []*Bus
+	var replicas []tools.DatabaseInterface
+	for i := 0; i < 2; i++ {
+		bus := New(hub.Transport(), time.Second)
+		go bus.Run(ctx)
+		waitFor(t, func() bool { return bus.Metrics().Connected })
+
+		replica, err := tools.NewDegradedDatabase(*storage, tools.DegradedOptions{FailureThreshold: 3, Invalidator: bus})
+		if err != nil {
+			t.Fatalf("Failed to create replica: %v", err)
+		}
+		buses = append(buses, bus)
+		replicas = append(replicas, *replica)
+	}
+
+	replicas[1].GetUserCoins("aaron")
+	if cached := replicas[1].GetSystemHealth()["cached_balances"]; cached != 1 {
+		t.Fatalf("Expected the second replica to cache aaron, got %v", cached)
+	}
+
+	replicas[0].AddUserCoins("aaron", 5)
+	if cached := replicas[1].GetSystemHealth()["cached_balances"]; cached != 0 {
+		t.Errorf("Expected the deposit on the first replica to drop the second's entry, got %v", cached)
+	}
+	if cached := replicas[0].GetSystemHealth()["cached_balances"]; cached != 1 {
+		t.Errorf("Expected the first replica to keep its own fresh entry, got %v", cached)
+	}
+
+	var sender, receiver Metrics = buses[0].Metrics(), buses[1].Metrics()
+	if sender.Published != 1 || sender.Received != 0 || receiver.Received != 1 || receiver.Late != 0 {
+		t.Errorf("Unexpected metrics, sender %+v, receiver %+v", sender, receiver)
+	}
+
+	// A failed deposit changes nothing and isn't published
+	replicas[0].AddUserCoins("nobody", 5)
+	if published := buses[0].Metrics().Published; published != 1 {
+		t.Errorf("Expected only successful mutations to be published, got %d", published)
+	}
+}
+
+type brokenTransport struct{}
+
+func (brokenTransport) Publish(ctx context.Context, payload []byte) error {
+	return errors.New("connection refused")
+}
+
+func (brokenTransport) Subscribe(ctx context.Context, deliver func(payload []byte)) error {
+	return errors.New("connection refused")
+}
+
+func TestLostSubscriptionFlushes(t *testing.T) {
+	var bus *Bus = New(brokenTransport{}, 10*time.Millisecond)
+	var flushes = make(chan []string, 10)
+	bus.OnInvalidate(func(keys []string) { flushes <- keys })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bus.Run(ctx)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case keys := <-flushes:
+			if keys != nil {
+				t.Errorf("Expected a flush of everything, got %v", keys)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the cache to be flushed once per window while disconnected")
+		}
+	}
+
+	bus.Invalidate("aaron")
+	if metrics := bus.Metrics(); metrics.PublishFailed != 1 || metrics.Connected {
+		t.Errorf("Unexpected metrics %+v", metrics)
+	}
+}
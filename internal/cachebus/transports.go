@@ -0,0 +1,98 @@
+package cachebus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Hub connects the buses of replicas running in one process, for tests and benchmarks
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[int]func(payload []byte)
+	nextID      int
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: map[int]func(payload []byte){}}
+}
+
+// Transport returns one replica's connection to the hub
+func (h *Hub) Transport() Transport {
+	return hubTransport{hub: h}
+}
+
+type hubTransport struct {
+	hub *Hub
+}
+
+func (t hubTransport) Publish(ctx context.Context, payload []byte) error {
+	t.hub.mu.Lock()
+	var subscribers = make([]func(payload []byte), 0, len(t.hub.subscribers))
+	for _, deliver := range t.hub.subscribers {
+		subscribers = append(subscribers, deliver)
+	}
+	t.hub.mu.Unlock()
+
+	for _, deliver := range subscribers {
+		deliver(payload)
+	}
+	return nil
+}
+
+func (t hubTransport) Subscribe(ctx context.Context, deliver func(payload []byte)) error {
+	t.hub.mu.Lock()
+	var id int = t.hub.nextID
+	t.hub.nextID++
+	t.hub.subscribers[id] = deliver
+	t.hub.mu.Unlock()
+
+	deliver(nil)
+	<-ctx.Done()
+
+	t.hub.mu.Lock()
+	delete(t.hub.subscribers, id)
+	t.hub.mu.Unlock()
+	return ctx.Err()
+}
+
+type redisTransport struct {
+	client  *redis.Client
+	channel string
+}
+
+// NewRedisTransport broadcasts over Redis pub/sub on channel. Pub/sub doesn't keep
+// messages, which is why a lost subscription drops every cache.
+func NewRedisTransport(url string, channel string) (Transport, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redis url: %w", err)
+	}
+	return redisTransport{client: redis.NewClient(options), channel: channel}, nil
+}
+
+func (t redisTransport) Publish(ctx context.Context, payload []byte) error {
+	return t.client.Publish(ctx, t.channel, payload).Err()
+}
+
+func (t redisTransport) Subscribe(ctx context.Context, deliver func(payload []byte)) error {
+	subscription := t.client.Subscribe(ctx, t.channel)
+	defer subscription.Close()
+
+	// The first reply confirms the subscription, only then is nothing missed
+	_, err := subscription.Receive(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSubscriptionLost, err)
+	}
+	deliver(nil)
+
+	for {
+		msg, err := subscription.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrSubscriptionLost, err)
+		}
+		deliver([]byte(msg.Payload))
+	}
+}
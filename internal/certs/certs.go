@@ -0,0 +1,131 @@
+// Package certs supplies the HTTPS listener's certificates, from files on disk or from
+// Let's Encrypt through autocert, and redirects plain HTTP requests to HTTPS.
+package certs
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var ErrNotConfigured = errors.New("no TLS certificate is configured")
+
+// Source hands the HTTPS listener its certificate
+type Source struct {
+	config *tls.Config
+
+	// Set for certificate files
+	files *keyPair
+
+	// Set for autocert
+	manager *autocert.Manager
+}
+
+// keyPair is a certificate loaded from files, swapped on Reload
+type keyPair struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+}
+
+func (k *keyPair) load() error {
+	certificate, err := tls.LoadX509KeyPair(k.certFile, k.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading %s and %s: %w", k.certFile, k.keyFile, err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.certificate = &certificate
+	return nil
+}
+
+func (k *keyPair) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.certificate, nil
+}
+
+// Enabled reports whether cfg turns HTTPS on
+func Enabled(cfg config.Config) bool {
+	return cfg.TLSCertFile != "" || len(cfg.TLSAutocertDomains) > 0
+}
+
+// New loads the certificate files, or sets up autocert for the configured domains
+func New(cfg config.Config) (*Source, error) {
+	if cfg.TLSCertFile != "" {
+		var files = &keyPair{certFile: cfg.TLSCertFile, keyFile: cfg.TLSKeyFile}
+		err := files.load()
+		if err != nil {
+			return nil, err
+		}
+		return &Source{
+			config: &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: files.get},
+			files:  files,
+		}, nil
+	}
+
+	if len(cfg.TLSAutocertDomains) > 0 {
+		var manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLSAutocertDomains...),
+			Cache:      autocert.DirCache(cfg.TLSAutocertCacheDir),
+			Email:      cfg.TLSAutocertEmail,
+		}
+		var tlsConfig = manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return &Source{config: tlsConfig, manager: manager}, nil
+	}
+
+	return nil, ErrNotConfigured
+}
+
+// TLSConfig is the HTTPS listener's configuration
+func (s *Source) TLSConfig() *tls.Config {
+	return s.config
+}
+
+// HTTPHandler wraps the plain HTTP listener's handler. Autocert answers Let's Encrypt's
+// HTTP challenges there before passing anything else on.
+func (s *Source) HTTPHandler(next http.Handler) http.Handler {
+	if s.manager != nil {
+		return s.manager.HTTPHandler(next)
+	}
+	return next
+}
+
+// Reload rereads the certificate files, keeping the current certificate if they don't
+// load. Autocert renews by itself, so there is nothing to do for it.
+func (s *Source) Reload() error {
+	if s.files == nil {
+		return nil
+	}
+	return s.files.load()
+}
+
+// Redirect sends every request to the same host and path over HTTPS on httpsAddr's
+// port. 308 keeps the method and body, so a POST is repeated as a POST.
+func Redirect(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		var target = "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
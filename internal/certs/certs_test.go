@@ -0,0 +1,133 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+)
+
+// writeKeyPair writes a self-signed certificate for name and returns the file paths
+func writeKeyPair(t *testing.T, dir string, name string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var template = x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func served(t *testing.T, source *Source) string {
+	t.Helper()
+
+	certificate, err := source.TLSConfig().GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestFiles(t *testing.T) {
+	var dir = t.TempDir()
+	var cfg config.Config = config.Default()
+	cfg.TLSCertFile, cfg.TLSKeyFile = writeKeyPair(t, dir, "old.example.com")
+
+	source, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to load the certificate: %v", err)
+	}
+	if name := served(t, source); name != "old.example.com" {
+		t.Errorf("Expected the loaded certificate, got %s", name)
+	}
+
+	writeKeyPair(t, dir, "new.example.com")
+	if err := source.Reload(); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if name := served(t, source); name != "new.example.com" {
+		t.Errorf("Expected the renewed certificate, got %s", name)
+	}
+
+	// A broken file keeps the certificate in use
+	os.WriteFile(cfg.TLSKeyFile, []byte("not a key"), 0o600)
+	if err := source.Reload(); err == nil {
+		t.Error("Expected a broken key to fail the reload")
+	}
+	if name := served(t, source); name != "new.example.com" {
+		t.Errorf("Expected the previous certificate to stay, got %s", name)
+	}
+
+	if _, err := New(config.Default()); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Expected ErrNotConfigured, got %v", err)
+	}
+}
+
+func TestAutocertPassesOtherRequestsOn(t *testing.T) {
+	var cfg config.Config = config.Default()
+	cfg.TLSAutocertDomains = []string{"api.example.com"}
+	cfg.TLSAutocertCacheDir = t.TempDir()
+
+	source, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	source.HTTPHandler(Redirect(":443")).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://api.example.com/status", nil))
+	if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != "https://api.example.com/status" {
+		t.Errorf("Expected the redirect, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	for _, test := range []struct {
+		httpsAddr string
+		url       string
+		want      string
+	}{
+		{":443", "http://api.example.com/account/coins?username=aaron", "https://api.example.com/account/coins?username=aaron"},
+		{"localhost:3443", "http://localhost:3000/status", "https://localhost:3443/status"},
+	} {
+		w := httptest.NewRecorder()
+		Redirect(test.httpsAddr).ServeHTTP(w, httptest.NewRequest(http.MethodPost, test.url, nil))
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != test.want {
+			t.Errorf("%s: expected 308 to %s, got %d %s", test.url, test.want, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package contacts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+const (
+	maxNicknameLength = 32
+	maxNoteLength     = 256
+)
+
+var (
+	ErrInvalidContact = errors.New("invalid contact")
+	ErrNicknameTaken  = errors.New("nickname already used for another counterparty")
+)
+
+// Private nickname and note an owner keeps about a counterparty
+type Contact struct {
+	Counterparty string
+	Nickname     string
+	Note         string
+	UpdatedAt    time.Time
+}
+
+// Record kind contacts are kept as, the Account is the owner, so every instance sees
+// the same ones
+const recordKind = "contact"
+
+// mu serializes the nickname check and the write within this process
+var mu sync.Mutex
+
+func recordID(owner string, counterparty string) string {
+	return owner + ":" + counterparty
+}
+
+// List returns the owner's contacts sorted by counterparty
+func List(database tools.DatabaseInterface, owner string) ([]Contact, error) {
+	records, err := database.ListRecords(recordKind, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = make([]Contact, 0, len(records))
+	for _, record := range records {
+		var contact Contact
+		err = json.Unmarshal(record.Data, &contact)
+		if err != nil {
+			return nil, fmt.Errorf("contact %s: %w", record.ID, err)
+		}
+		result = append(result, contact)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Counterparty < result[j].Counterparty
+	})
+	return result, nil
+}
+
+// Set creates or replaces the owner's contact for contact.Counterparty
+func Set(database tools.DatabaseInterface, owner string, contact Contact) (Contact, error) {
+	if contact.Counterparty == "" || contact.Counterparty == owner {
+		return Contact{}, fmt.Errorf("%w: counterparty must be another user", ErrInvalidContact)
+	}
+	if len(contact.Nickname) > maxNicknameLength {
+		return Contact{}, fmt.Errorf("%w: nickname longer than %d characters", ErrInvalidContact, maxNicknameLength)
+	}
+	if len(contact.Note) > maxNoteLength {
+		return Contact{}, fmt.Errorf("%w: note longer than %d characters", ErrInvalidContact, maxNoteLength)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if contact.Nickname != "" {
+		owned, err := List(database, owner)
+		if err != nil {
+			return Contact{}, err
+		}
+		for _, existing := range owned {
+			if existing.Counterparty != contact.Counterparty && existing.Nickname == contact.Nickname {
+				return Contact{}, ErrNicknameTaken
+			}
+		}
+	}
+
+	contact.UpdatedAt = time.Now()
+	data, err := json.Marshal(contact)
+	if err != nil {
+		return Contact{}, err
+	}
+	err = database.PutRecord(tools.Record{Kind: recordKind, ID: recordID(owner, contact.Counterparty), Account: owner, Data: data, UpdatedAt: contact.UpdatedAt})
+	if err != nil {
+		return Contact{}, err
+	}
+	return contact, nil
+}
+
+// Remove deletes the owner's contact, reporting whether one existed
+func Remove(database tools.DatabaseInterface, owner string, counterparty string) (bool, error) {
+	err := database.DeleteRecord(recordKind, recordID(owner, counterparty))
+	if errors.Is(err, tools.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Nicknames maps each counterparty the owner nicknamed to the nickname
+func Nicknames(database tools.DatabaseInterface, owner string) (map[string]string, error) {
+	owned, err := List(database, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = make(map[string]string, len(owned))
+	for _, contact := range owned {
+		if contact.Nickname != "" {
+			result[contact.Counterparty] = contact.Nickname
+		}
+	}
+	return result, nil
+}
+
+// Resolve maps one of the owner's nicknames to the counterparty's username, false
+// when it isn't one or the contacts can't be read
+func Resolve(database tools.DatabaseInterface, owner string, nickname string) (string, bool) {
+	if nickname == "" {
+		return "", false
+	}
+
+	owned, err := List(database, owner)
+	if err != nil {
+		return "", false
+	}
+	for _, contact := range owned {
+		if contact.Nickname == nickname {
+			return contact.Counterparty, true
+		}
+	}
+	return "", false
+}
+
+// Forget deletes the user's contacts and every contact others keep about them, whose
+// nicknames and notes could name them
+func Forget(database tools.DatabaseInterface, username string) error {
+	records, err := database.ListRecords(recordKind, "")
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		var contact Contact
+		if json.Unmarshal(record.Data, &contact) == nil && record.Account != username && contact.Counterparty != username {
+			continue
+		}
+		err = database.DeleteRecord(recordKind, record.ID)
+		if err != nil && !errors.Is(err, tools.ErrRecordNotFound) {
+			return err
+		}
+	}
+	return nil
+}
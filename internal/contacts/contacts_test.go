@@ -0,0 +1,69 @@
+package contacts
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+func TestContacts(t *testing.T) {
+	t.Run("Nickname_Resolves_Per_Owner", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+		_, err := Set(database, "aaron", Contact{Counterparty: "bryan", Nickname: "bro", Note: "lunch money"})
+		if err != nil {
+			t.Fatalf("Failed to save contact: %v", err)
+		}
+
+		username, ok := Resolve(database, "aaron", "bro")
+		if !ok || username != "bryan" {
+			t.Errorf("Expected bro to resolve to bryan, got %q", username)
+		}
+
+		// Nicknames are private to their owner
+		if _, ok := Resolve(database, "bryan", "bro"); ok {
+			t.Errorf("Another owner must not resolve aaron's nickname")
+		}
+	})
+
+	t.Run("Duplicate_Nickname_Rejected", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+		Set(database, "aaron", Contact{Counterparty: "bryan", Nickname: "bro"})
+
+		_, err := Set(database, "aaron", Contact{Counterparty: "carol", Nickname: "bro"})
+		if !errors.Is(err, ErrNicknameTaken) {
+			t.Errorf("Expected ErrNicknameTaken, got %v", err)
+		}
+
+		// Renaming the same counterparty is fine
+		_, err = Set(database, "aaron", Contact{Counterparty: "bryan", Nickname: "brother"})
+		if err != nil {
+			t.Errorf("Expected rename to succeed, got %v", err)
+		}
+	})
+
+	t.Run("Self_Contact_Rejected", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+		_, err := Set(database, "aaron", Contact{Counterparty: "aaron", Nickname: "me"})
+		if !errors.Is(err, ErrInvalidContact) {
+			t.Errorf("Expected ErrInvalidContact, got %v", err)
+		}
+	})
+
+	t.Run("Forget_Removes_Both_Sides", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+		Set(database, "aaron", Contact{Counterparty: "bryan", Nickname: "bro"})
+		Set(database, "bryan", Contact{Counterparty: "aaron", Nickname: "boss"})
+		Set(database, "bryan", Contact{Counterparty: "carol", Nickname: "sis"})
+
+		if err := Forget(database, "aaron"); err != nil {
+			t.Fatalf("Failed to forget: %v", err)
+		}
+		if owned, _ := List(database, "aaron"); len(owned) != 0 {
+			t.Errorf("Expected aaron's contacts gone, got %+v", owned)
+		}
+		if owned, _ := List(database, "bryan"); len(owned) != 1 || owned[0].Counterparty != "carol" {
+			t.Errorf("Expected only bryan's contact about carol left, got %+v", owned)
+		}
+	})
+}
@@ -0,0 +1,446 @@
+package dormancy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// Account statuses
+const (
+	StatusActive    = "active"
+	StatusDormant   = "dormant"
+	StatusSweepable = "sweepable"
+)
+
+type Policy struct {
+	// No owner activity for DormantAfter flags an account dormant, EscheatAfter
+	// after that its available balance can be swept to Account
+	DormantAfter time.Duration
+	EscheatAfter time.Duration
+	Account      string
+
+	// Emit account_dormant when an account is first flagged
+	Notify bool
+}
+
+// CurrentPolicy reads the policy from the active configuration
+func CurrentPolicy() Policy {
+	var cfg config.Config = config.Get()
+	return Policy{
+		DormantAfter: cfg.DormantAfter,
+		EscheatAfter: cfg.EscheatAfter,
+		Account:      cfg.EscheatAccount,
+		Notify:       cfg.DormancyNotify,
+	}
+}
+
+type Account struct {
+	Username string
+	Balance  int64
+
+	// What a sweep would move, the balance less the coins freezes hold back
+	Available int64
+
+	LastActivity time.Time
+	DormantAt    time.Time
+	SweepableAt  time.Time
+	Status       string
+}
+
+var (
+	mu sync.Mutex
+
+	// Activity before startup isn't known, accounts never seen count from here
+	startedAt    = time.Now()
+	lastActivity = map[string]time.Time{}
+
+	// Accounts already flagged dormant, so each is only notified once per dormancy
+	flagged = map[string]bool{}
+
+	startOnce sync.Once
+)
+
+// Start counts deposits, withdrawals and outgoing transfers as owner activity, safe
+// to call more than once. Incoming transfers don't count, the owner did nothing.
+func Start() {
+	startOnce.Do(func() {
+		events.Subscribe(func(_ tools.DatabaseInterface, event events.Event) {
+			switch event.Type {
+			case events.DepositCompleted, events.WithdrawalCompleted, events.TransferCompleted:
+				RecordActivity(event.Subject, event.OccurredAt)
+			}
+		})
+	})
+}
+
+// RecordActivity notes that the owner used the account at at
+func RecordActivity(username string, at time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if at.After(lastActivity[username]) {
+		lastActivity[username] = at
+	}
+	delete(flagged, username)
+}
+
+// assess works out an account's status at now, callers hold mu
+func assess(details tools.CoinDetails, policy Policy, now time.Time) Account {
+	last, ok := lastActivity[details.Username]
+	if !ok {
+		last = startedAt
+	}
+
+	var account = Account{
+		Username:     details.Username,
+		Balance:      details.Coins,
+		Available:    details.Available(),
+		LastActivity: last,
+		DormantAt:    last.Add(policy.DormantAfter),
+		Status:       StatusActive,
+	}
+	account.SweepableAt = account.DormantAt.Add(policy.EscheatAfter)
+
+	if !now.Before(account.SweepableAt) {
+		account.Status = StatusSweepable
+	} else if !now.Before(account.DormantAt) {
+		account.Status = StatusDormant
+	}
+	return account
+}
+
+// StatusOf is an account's dormancy status at now, without flagging it
+func StatusOf(username string, policy Policy, now time.Time) string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return assess(tools.CoinDetails{Username: username}, policy, now).Status
+}
+
+// Scan assesses every account except the escheat account itself, reading them a page
+// at a time and calling fn with each. Accounts that just became dormant are flagged,
+// and notified when the policy asks for it. It stops at the first error from storage,
+// fn or ctx and returns it.
+func Scan(ctx context.Context, database tools.DatabaseInterface, policy Policy, now time.Time, fn func(Account) error) error {
+	return tools.ForEachAccount(ctx, database, func(details tools.CoinDetails) error {
+		if details.Username == policy.Account {
+			return nil
+		}
+
+		mu.Lock()
+		account := assess(details, policy, now)
+		notify := account.Status != StatusActive && !flagged[account.Username]
+		if notify {
+			flagged[account.Username] = true
+		}
+		mu.Unlock()
+
+		if notify {
+			log.Info("Account ", account.Username, " flagged dormant, last activity ", account.LastActivity)
+			if policy.Notify {
+				events.Record(database, events.AccountDormant, account.Username, map[string]interface{}{
+					"last_activity": account.LastActivity,
+					"sweepable_at":  account.SweepableAt,
+				})
+			}
+		}
+		return fn(account)
+	})
+}
+
+// Scheduled scans once for the scheduler, so dormant accounts are flagged (and
+// notified) without anyone looking at the admin report
+func Scheduled(open func() (tools.DatabaseInterface, error)) {
+	database, err := open()
+	if err != nil {
+		log.Error("Dormancy scan could not open the database: ", err)
+		return
+	}
+
+	var counts = map[string]int{}
+	var scanned int
+	err = Scan(context.Background(), database, CurrentPolicy(), time.Now(), func(account Account) error {
+		counts[account.Status]++
+		scanned++
+		return nil
+	})
+	if err != nil {
+		log.Error("Dormancy scan stopped after ", scanned, " accounts: ", err)
+		return
+	}
+	log.WithFields(log.Fields{
+		"dormant":   counts[StatusDormant],
+		"sweepable": counts[StatusSweepable],
+	}).Info("Dormancy scan finished")
+}
+
+// Sweep statuses
+const (
+	SweepPending   = "pending_approval"
+	SweepCompleted = "completed"
+)
+
+// Item statuses
+const (
+	ItemProposed = "proposed"
+	ItemSwept    = "swept"
+	ItemSkipped  = "skipped"
+	ItemFailed   = "failed"
+	ItemReversed = "reversed"
+)
+
+var (
+	ErrInvalidSweep    = errors.New("invalid sweep")
+	ErrSweepNotFound   = errors.New("sweep not found")
+	ErrSweepNotPending = errors.New("sweep is not pending approval")
+	ErrNotSwept        = errors.New("account was not swept by this sweep")
+)
+
+// One account in a sweep
+type Item struct {
+	Account string
+	Amount  int64
+	Status  string
+
+	// Why it was skipped or failed, or why it was reversed
+	Detail     string
+	ReversedBy string
+	ReversedAt time.Time
+}
+
+// Sweep moves the available balance of sweepable accounts to the escheat account.
+// An admin proposes it, which only lists the accounts, and an admin approves it,
+// which moves the coins. Each swept account can be reversed on its own.
+type Sweep struct {
+	ID         string
+	To         string
+	Status     string
+	ProposedBy string
+	ProposedAt time.Time
+	ApprovedBy string
+	ApprovedAt time.Time
+	Items      []Item
+}
+
+var (
+	sweeps = map[string]*Sweep{}
+	nextID = 1
+)
+
+func copySweep(sweep *Sweep) Sweep {
+	copied := *sweep
+	copied.Items = append([]Item(nil), sweep.Items...)
+	return copied
+}
+
+// Propose lists every sweepable account with something available to sweep
+func Propose(database tools.DatabaseInterface, policy Policy, by string) (Sweep, error) {
+	var items []Item
+	err := Scan(context.Background(), database, policy, time.Now(), func(account Account) error {
+		if account.Status == StatusSweepable && account.Available > 0 {
+			items = append(items, Item{Account: account.Username, Amount: account.Available, Status: ItemProposed})
+		}
+		return nil
+	})
+	if err != nil {
+		return Sweep{}, err
+	}
+	if len(items) == 0 {
+		return Sweep{}, fmt.Errorf("%w: no account is sweepable", ErrInvalidSweep)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var sweep = &Sweep{
+		ID:         fmt.Sprintf("sweep_%d", nextID),
+		To:         policy.Account,
+		Status:     SweepPending,
+		ProposedBy: by,
+		ProposedAt: time.Now(),
+		Items:      items,
+	}
+	nextID++
+	sweeps[sweep.ID] = sweep
+
+	log.Info("Escheatment sweep ", sweep.ID, " of ", len(items), " accounts proposed by ", by)
+	return copySweep(sweep), nil
+}
+
+// Approve moves the coins. Accounts that became active, or whose available balance
+// dropped below the proposed amount, since the proposal are skipped.
+func Approve(database tools.DatabaseInterface, policy Policy, id string, by string) (Sweep, error) {
+	mu.Lock()
+
+	sweep, ok := sweeps[id]
+	if !ok {
+		mu.Unlock()
+		return Sweep{}, ErrSweepNotFound
+	}
+	if sweep.Status != SweepPending {
+		mu.Unlock()
+		return Sweep{}, ErrSweepNotPending
+	}
+
+	var now = time.Now()
+	sweep.Status = SweepCompleted
+	sweep.ApprovedBy = by
+	sweep.ApprovedAt = now
+
+	var swept []Item
+	for i := range sweep.Items {
+		item := &sweep.Items[i]
+
+		details, err := database.GetUserCoins(item.Account)
+		if err != nil {
+			item.Status, item.Detail = ItemFailed, err.Error()
+			continue
+		}
+
+		account := assess(*details, policy, now)
+		if account.Status != StatusSweepable {
+			item.Status, item.Detail = ItemSkipped, "account became active since the proposal"
+			continue
+		}
+		if account.Available < item.Amount {
+			item.Status, item.Detail = ItemSkipped, "available balance dropped since the proposal"
+			continue
+		}
+
+		fromDetails, _ := database.TransferUserCoins(item.Account, sweep.To, item.Amount)
+		if fromDetails == nil {
+			item.Status, item.Detail = ItemFailed, "transfer to "+sweep.To+" failed"
+			continue
+		}
+		item.Status = ItemSwept
+		swept = append(swept, *item)
+	}
+
+	var result = copySweep(sweep)
+	mu.Unlock()
+
+	log.Info("Escheatment sweep ", id, " approved by ", by, ", ", len(swept), " of ", len(result.Items), " accounts swept")
+	for _, item := range swept {
+		events.Record(database, events.AccountEscheated, item.Account, map[string]interface{}{
+			"sweep_id":    id,
+			"amount":      item.Amount,
+			"to":          result.To,
+			"approved_by": by,
+		})
+	}
+
+	return result, nil
+}
+
+// Reverse returns a swept balance to its owner and counts that as owner activity
+func Reverse(database tools.DatabaseInterface, id string, account string, by string, reason string) (Sweep, error) {
+	if reason == "" {
+		return Sweep{}, fmt.Errorf("%w: a reason is required", ErrInvalidSweep)
+	}
+
+	mu.Lock()
+
+	sweep, ok := sweeps[id]
+	if !ok {
+		mu.Unlock()
+		return Sweep{}, ErrSweepNotFound
+	}
+
+	var item *Item
+	for i := range sweep.Items {
+		if sweep.Items[i].Account == account && sweep.Items[i].Status == ItemSwept {
+			item = &sweep.Items[i]
+		}
+	}
+	if item == nil {
+		mu.Unlock()
+		return Sweep{}, ErrNotSwept
+	}
+
+	fromDetails, _ := database.TransferUserCoins(sweep.To, account, item.Amount)
+	if fromDetails == nil {
+		mu.Unlock()
+		return Sweep{}, fmt.Errorf("returning %d coins from %s to %s failed", item.Amount, sweep.To, account)
+	}
+
+	var now = time.Now()
+	item.Status = ItemReversed
+	item.Detail = reason
+	item.ReversedBy = by
+	item.ReversedAt = now
+	var amount = item.Amount
+
+	if now.After(lastActivity[account]) {
+		lastActivity[account] = now
+	}
+	delete(flagged, account)
+
+	var result = copySweep(sweep)
+	mu.Unlock()
+
+	log.Info("Escheatment of ", account, " in sweep ", id, " reversed by ", by, ": ", reason)
+	events.Record(database, events.EscheatmentReversed, account, map[string]interface{}{
+		"sweep_id":    id,
+		"amount":      amount,
+		"reversed_by": by,
+		"reason":      reason,
+	})
+
+	return result, nil
+}
+
+// Sweeps returns every sweep, newest first
+func Sweeps() []Sweep {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var result = []Sweep{}
+	for _, sweep := range sweeps {
+		result = append(result, copySweep(sweep))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ProposedAt.After(result[j].ProposedAt)
+	})
+	return result
+}
+
+// Pseudonymize replaces username with pseudonym in the activity record and in every
+// sweep, so a swept account can still be reversed
+func Pseudonymize(username string, pseudonym string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if last, ok := lastActivity[username]; ok {
+		lastActivity[pseudonym] = last
+		delete(lastActivity, username)
+	}
+	if flagged[username] {
+		flagged[pseudonym] = true
+		delete(flagged, username)
+	}
+
+	for _, sweep := range sweeps {
+		for _, by := range []*string{&sweep.ProposedBy, &sweep.ApprovedBy} {
+			if *by == username {
+				*by = pseudonym
+			}
+		}
+		for i := range sweep.Items {
+			if sweep.Items[i].Account == username {
+				sweep.Items[i].Account = pseudonym
+			}
+			if sweep.Items[i].ReversedBy == username {
+				sweep.Items[i].ReversedBy = pseudonym
+			}
+		}
+	}
+}
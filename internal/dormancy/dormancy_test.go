@@ -0,0 +1,88 @@
+package dormancy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+func TestEscheatment(t *testing.T) {
+	var db tools.DatabaseInterface = toolstest.New(t, nil)
+
+	var policy = Policy{DormantAfter: time.Hour, EscheatAfter: time.Hour, Account: "escheat"}
+
+	// aaron was last seen three hours ago, bryan just now
+	RecordActivity("aaron", time.Now().Add(-3*time.Hour))
+	RecordActivity("bryan", time.Now())
+
+	t.Run("Scan", func(t *testing.T) {
+		var statuses = map[string]string{}
+		err := Scan(t.Context(), db, policy, time.Now(), func(account Account) error {
+			statuses[account.Username] = account.Status
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		if statuses["aaron"] != StatusSweepable || statuses["bryan"] != StatusActive {
+			t.Errorf("Expected aaron sweepable and bryan active, got %v", statuses)
+		}
+		if _, ok := statuses["escheat"]; ok {
+			t.Errorf("The escheat account must not be scanned")
+		}
+	})
+
+	var sweep Sweep
+	var err error
+	t.Run("Propose_And_Approve", func(t *testing.T) {
+		sweep, err = Propose(db, policy, "admin")
+		if err != nil {
+			t.Fatalf("Propose failed: %v", err)
+		}
+		if aaron, _ := db.GetUserCoins("aaron"); aaron.Coins != 1000 {
+			t.Fatalf("Proposing must not move coins")
+		}
+
+		sweep, err = Approve(db, policy, sweep.ID, "admin")
+		if err != nil {
+			t.Fatalf("Approve failed: %v", err)
+		}
+		if len(sweep.Items) != 1 || sweep.Items[0].Account != "aaron" || sweep.Items[0].Status != ItemSwept {
+			t.Fatalf("Expected only aaron swept, got %+v", sweep.Items)
+		}
+		aaron, _ := db.GetUserCoins("aaron")
+		escheat, _ := db.GetUserCoins("escheat")
+		if aaron.Coins != 0 || escheat.Coins != 1000 {
+			t.Errorf("Expected aaron's 1000 coins in the escheat account")
+		}
+
+		if _, err := Approve(db, policy, sweep.ID, "admin"); !errors.Is(err, ErrSweepNotPending) {
+			t.Errorf("A sweep must only be approved once, got %v", err)
+		}
+	})
+
+	t.Run("Reverse", func(t *testing.T) {
+		if _, err := Reverse(db, sweep.ID, "bryan", "admin", "mistake"); !errors.Is(err, ErrNotSwept) {
+			t.Errorf("Expected bryan not to be reversible, got %v", err)
+		}
+
+		sweep, err = Reverse(db, sweep.ID, "aaron", "admin", "owner came back")
+		if err != nil {
+			t.Fatalf("Reverse failed: %v", err)
+		}
+		if aaron, _ := db.GetUserCoins("aaron"); sweep.Items[0].Status != ItemReversed || aaron.Coins != 1000 {
+			t.Errorf("Expected aaron's coins back, got %+v", sweep.Items[0])
+		}
+
+		// Reclaiming the coins is activity, aaron is no longer dormant
+		Scan(t.Context(), db, policy, time.Now(), func(account Account) error {
+			if account.Username == "aaron" && account.Status != StatusActive {
+				t.Errorf("Expected aaron active after the reversal, got %s", account.Status)
+			}
+			return nil
+		})
+	})
+}
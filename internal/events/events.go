@@ -0,0 +1,317 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// Bump when the shape of Data changes for any event type, consumers key off this.
+// Version 2 labels amounts with a currency.
+const SchemaVersion = 2
+
+// Data keys holding amounts. They are int64 minor units of api.Currency, and an event
+// with any of them carries the code as "currency".
+var amountKeys = []string{"amount", "balance"}
+
+// Domain event types, these names are part of the analytics contract
+const (
+	AccountCreated      = "account_created"
+	DepositCompleted    = "deposit_completed"
+	WithdrawalCompleted = "withdrawal_completed"
+	TransferCompleted   = "transfer_completed"
+	LimitChanged        = "limit_changed"
+	FreezeChanged       = "freeze_changed"
+
+	// Admin account management, the subject is the account and "by" the admin.
+	// account_freeze_changed is a whole account being frozen or unfrozen,
+	// balance_adjusted a credit or debit with the admin's reason.
+	AccountFreezeChanged = "account_freeze_changed"
+	BalanceAdjusted      = "balance_adjusted"
+
+	// Dormancy and escheatment of inactive accounts
+	AccountDormant      = "account_dormant"
+	AccountEscheated    = "account_escheated"
+	EscheatmentReversed = "escheatment_reversed"
+
+	// Data privacy requests. After approval the account's earlier events name the
+	// pseudonym instead of the username.
+	AccountDeletionRequested = "account_deletion_requested"
+	AccountAnonymized        = "account_anonymized"
+
+	// An admin reset a client's rate limit window, the subject is the admin
+	RateLimitCleared = "rate_limit_cleared"
+
+	// Gifts reserve coins until accepted, gift_returned is a decline or an expiry.
+	// Accepting one emits transfer_completed.
+	GiftSent     = "gift_sent"
+	GiftReturned = "gift_returned"
+
+	// Payment holds reserve coins until the payee captures them. hold_released is a
+	// release or an expiry, capturing emits transfer_completed.
+	HoldPlaced   = "hold_placed"
+	HoldReleased = "hold_released"
+
+	// Standing orders, the subject is the payer. standing_order_changed is one being
+	// created or cancelled, each payment it makes emits transfer_completed.
+	StandingOrderChanged = "standing_order_changed"
+
+	// Reservations set coins aside for a purchase. reservation_released is a cancel or
+	// an expiry, committing emits withdrawal_completed.
+	CoinsReserved       = "coins_reserved"
+	ReservationReleased = "reservation_released"
+
+	// Joint accounts, the subject is the account. account_owner_changed is the holder
+	// adding, changing or removing a co-owner, owner_operation a change a co-owner made.
+	AccountOwnerChanged = "account_owner_changed"
+	OwnerOperation      = "owner_operation"
+
+	// Break-glass admin tokens, the subject is the operator for the first two and the
+	// token's principal for break_glass_used, which is recorded for every request
+	BreakGlassIssued  = "break_glass_issued"
+	BreakGlassRevoked = "break_glass_revoked"
+	BreakGlassUsed    = "break_glass_used"
+
+	// Sent to a webhook whose signing secret was rotated, never contains the secret
+	WebhookSecretRotated = "webhook_secret_rotated"
+
+	// A runbook step started, finished, failed or was undone, the subject is the admin
+	// who started the run
+	RunbookProgress = "runbook_progress"
+)
+
+// Immutable domain event. Unlike TransactionLog this only records things that
+// happened, never failed attempts. Read back from storage, Data holds what its JSON
+// encoding decodes to, with whole numbers as int64.
+type Event struct {
+	ID            int64
+	Type          string
+	SchemaVersion int
+	Subject       string
+	Data          map[string]interface{}
+	OccurredAt    time.Time
+}
+
+var (
+	subscribersMu sync.RWMutex
+	subscribers   []func(database tools.DatabaseInterface, event Event)
+)
+
+// Record appends an event to database's log, which assigns its ID, and hands it to
+// subscribers. A nil database records to the configured backend. An event storage
+// refuses is logged and still handed on, with ID 0, since what it records happened.
+func Record(database tools.DatabaseInterface, eventType string, subject string, data map[string]interface{}) Event {
+	event := Event{
+		Type:          eventType,
+		SchemaVersion: SchemaVersion,
+		Subject:       subject,
+		Data:          withCurrency(copyData(data)),
+		OccurredAt:    time.Now(),
+	}
+
+	stored, err := storageFor(database)
+	if err == nil {
+		event.ID, err = stored.AppendEvent(encode(event))
+	}
+	if err != nil {
+		log.Error("Failed to store domain event ", event.Type, ": ", err)
+	} else {
+		log.Debug("Recorded domain event ", event.ID, ": ", event.Type)
+	}
+
+	subscribersMu.RLock()
+	listeners := subscribers
+	subscribersMu.RUnlock()
+
+	for _, listener := range listeners {
+		listener(database, copyEvent(event))
+	}
+
+	return copyEvent(event)
+}
+
+// Since returns up to limit events with an ID greater than afterID, oldest first
+func Since(database tools.DatabaseInterface, afterID int64, limit int) []Event {
+	return list(database, tools.EventFilter{AfterID: afterID, Limit: limit})
+}
+
+// First returns the oldest event of eventType with the given subject, from storage's
+// subject index rather than the whole log
+func First(database tools.DatabaseInterface, eventType string, subject string) (Event, bool) {
+	var found []Event = list(database, tools.EventFilter{Type: eventType, Subject: subject, Limit: 1})
+	if len(found) == 0 {
+		return Event{}, false
+	}
+	return found[0], true
+}
+
+// About returns every event whose subject is username or whose data names them
+func About(database tools.DatabaseInterface, username string) []Event {
+	var result = []Event{}
+	for _, event := range list(database, tools.EventFilter{}) {
+		if event.Subject == username || mentions(event.Data, username) {
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+func mentions(data map[string]interface{}, username string) bool {
+	for _, value := range data {
+		if value == username {
+			return true
+		}
+	}
+	return false
+}
+
+// Pseudonymize replaces username with pseudonym wherever it appears in the log and
+// returns how many events it rewrote. It is the one exception to events being
+// immutable, for erasing personal data.
+func Pseudonymize(database tools.DatabaseInterface, username string, pseudonym string) int {
+	stored, err := storageFor(database)
+	if err != nil {
+		log.Error("Failed to pseudonymize domain events: ", err)
+		return 0
+	}
+
+	var changed int
+	for _, event := range About(stored, username) {
+		if event.Subject == username {
+			event.Subject = pseudonym
+		}
+		for key, value := range event.Data {
+			if value == username {
+				event.Data[key] = pseudonym
+			}
+		}
+		err = stored.RewriteEvent(encode(event))
+		if err != nil {
+			log.Error("Failed to pseudonymize domain event ", event.ID, ": ", err)
+			continue
+		}
+		changed++
+	}
+	return changed
+}
+
+// storageFor is where database's events are kept, the configured backend for nil
+func storageFor(database tools.DatabaseInterface) (tools.DatabaseInterface, error) {
+	if database != nil {
+		return database, nil
+	}
+	opened, err := tools.NewDatabase()
+	if err != nil {
+		return nil, err
+	}
+	return *opened, nil
+}
+
+// list reads the events filter selects, none when storage can't be read
+func list(database tools.DatabaseInterface, filter tools.EventFilter) []Event {
+	stored, err := storageFor(database)
+	if err == nil {
+		var found []tools.Event
+		found, err = stored.ListEvents(filter)
+		if err == nil {
+			var result = make([]Event, 0, len(found))
+			for _, event := range found {
+				result = append(result, decode(event))
+			}
+			return result
+		}
+	}
+	log.Error("Failed to read domain events: ", err)
+	return nil
+}
+
+func encode(event Event) tools.Event {
+	data, _ := json.Marshal(event.Data)
+	return tools.Event{
+		ID:            event.ID,
+		Type:          event.Type,
+		SchemaVersion: event.SchemaVersion,
+		Subject:       event.Subject,
+		Data:          data,
+		OccurredAt:    event.OccurredAt,
+	}
+}
+
+// decode turns the JSON numbers in an event's data back into int64 where they are
+// whole, as amounts were recorded
+func decode(stored tools.Event) Event {
+	var data = map[string]interface{}{}
+	var decoder *json.Decoder = json.NewDecoder(bytes.NewReader(stored.Data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		log.Error("Failed to decode domain event ", stored.ID, ": ", err)
+	}
+	for key, value := range data {
+		number, ok := value.(json.Number)
+		if !ok {
+			continue
+		}
+		if whole, err := number.Int64(); err == nil {
+			data[key] = whole
+		} else {
+			data[key], _ = number.Float64()
+		}
+	}
+
+	return Event{
+		ID:            stored.ID,
+		Type:          stored.Type,
+		SchemaVersion: stored.SchemaVersion,
+		Subject:       stored.Subject,
+		Data:          data,
+		OccurredAt:    stored.OccurredAt,
+	}
+}
+
+// Subscribe registers a listener called synchronously after every recorded event,
+// with the database it was recorded for
+func Subscribe(listener func(database tools.DatabaseInterface, event Event)) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+
+	subscribers = append(subscribers, listener)
+}
+
+func copyEvent(event Event) Event {
+	event.Data = copyData(event.Data)
+	return event
+}
+
+func copyData(data map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		copied[k] = v
+	}
+	return copied
+}
+
+// withCurrency turns the amounts in data into minor units and labels them with the
+// currency, whichever integer type they were recorded as
+func withCurrency(data map[string]interface{}) map[string]interface{} {
+	var labelled bool
+	for _, key := range amountKeys {
+		switch amount := data[key].(type) {
+		case int64:
+			data[key] = api.MinorUnits(amount)
+		case int:
+			data[key] = api.MinorUnits(int64(amount))
+		default:
+			continue
+		}
+		labelled = true
+	}
+	if labelled {
+		data["currency"] = api.Currency
+	}
+	return data
+}
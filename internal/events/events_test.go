@@ -0,0 +1,87 @@
+package events
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+func TestEventLog(t *testing.T) {
+	t.Run("Concurrent_Records_Get_Dense_IDs", func(t *testing.T) {
+		start := int64(len(Since(nil, 0, 0)))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				Record(nil, TransferCompleted, "aaron", map[string]interface{}{"amount": int64(10)})
+			}()
+		}
+		wg.Wait()
+
+		recorded := Since(nil, start, 0)
+		if len(recorded) != 20 {
+			t.Fatalf("Expected 20 events, got %d", len(recorded))
+		}
+
+		for i, event := range recorded {
+			if event.ID != start+int64(i)+1 {
+				t.Errorf("Gap in event IDs: expected %d, got %d", start+int64(i)+1, event.ID)
+			}
+			if event.SchemaVersion != SchemaVersion {
+				t.Errorf("Event %d has schema version %d", event.ID, event.SchemaVersion)
+			}
+		}
+	})
+
+	t.Run("Amounts_Carry_Their_Currency", func(t *testing.T) {
+		event := Record(nil, DepositCompleted, "aaron", map[string]interface{}{"amount": 25, "balance": int64(125)})
+		if event.Data["amount"] != int64(25) || event.Data["balance"] != int64(125) || event.Data["currency"] != api.Currency {
+			t.Errorf("Expected int64 minor units labelled %s, got %v", api.Currency, event.Data)
+		}
+
+		event = Record(nil, LimitChanged, "admin", map[string]interface{}{"version": int64(3)})
+		if _, ok := event.Data["currency"]; ok {
+			t.Errorf("Expected no currency on an event without amounts, got %v", event.Data)
+		}
+	})
+
+	t.Run("Events_Are_Immutable", func(t *testing.T) {
+		event := Record(nil, LimitChanged, "admin", map[string]interface{}{"version": int64(2)})
+		event.Data["version"] = int64(99)
+
+		stored := Since(nil, event.ID-1, 1)
+		if len(stored) != 1 || stored[0].Data["version"] != int64(2) {
+			t.Errorf("Stored event was modified through a returned copy: %+v", stored)
+		}
+	})
+
+	t.Run("Kept_By_Each_Database", func(t *testing.T) {
+		logins, coins := tools.DemoAccounts()
+		first, _ := tools.NewMemoryDatabase(logins, coins)
+		second, _ := tools.NewMemoryDatabase(logins, coins)
+
+		created := Record(*first, AccountCreated, "aaron", nil)
+		Record(*first, TransferCompleted, "bryan", map[string]interface{}{"to": "aaron", "amount": int64(5)})
+		if created.ID != 1 || len(Since(*second, 0, 0)) != 0 {
+			t.Fatalf("Expected the first database to number its own events, got ID %d", created.ID)
+		}
+		if event, ok := First(*first, AccountCreated, "aaron"); !ok || event.ID != created.ID {
+			t.Errorf("Expected aaron's account_created, got %+v", event)
+		}
+
+		if changed := Pseudonymize(*first, "aaron", "deleted-1"); changed != 2 {
+			t.Fatalf("Expected both events rewritten, got %d", changed)
+		}
+		if about := About(*first, "aaron"); len(about) != 0 {
+			t.Errorf("Expected nothing left naming aaron, got %+v", about)
+		}
+		about := About(*first, "deleted-1")
+		if len(about) != 2 || about[1].Data["to"] != "deleted-1" || about[1].Data["amount"] != int64(5) {
+			t.Errorf("Expected both events to name the pseudonym, got %+v", about)
+		}
+	})
+}
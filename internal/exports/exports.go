@@ -0,0 +1,230 @@
+package exports
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+var (
+	ErrJobNotFound  = errors.New("export job not found")
+	ErrInvalidToken = errors.New("download link is invalid")
+	ErrTokenExpired = errors.New("download link has expired")
+	ErrNotReady     = errors.New("export is not ready yet")
+)
+
+// Asynchronous transaction export for one user
+type Job struct {
+	ID          string
+	Owner       string
+	Status      string
+	Error       string
+	CreatedAt   time.Time
+	CompletedAt time.Time
+	Rows        int
+
+	file []byte
+}
+
+// Jobs by ID, the process keeps one table and each isolated in-memory database its
+// own, see tools.ScopeOf
+type table map[string]*Job
+
+var (
+	mu     sync.RWMutex
+	tables = tools.NewScoped(func() *table { return &table{} })
+
+	// Signs download tokens. Replaced by SetSigningSecret when one is configured,
+	// otherwise links only survive until restart.
+	signingSecret = randomBytes(32)
+)
+
+func randomBytes(n int) []byte {
+	bytes := make([]byte, n)
+	rand.Read(bytes)
+	return bytes
+}
+
+func SetSigningSecret(secret []byte) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	signingSecret = secret
+}
+
+// Start creates a job in database's table and builds the CSV in the background from
+// whatever fetch returns, with local timestamps in location, the owner's profile timezone
+func Start(database tools.DatabaseInterface, owner string, location *time.Location, fetch func() []tools.TransactionLog) Job {
+	var job = &Job{
+		ID:        hex.EncodeToString(randomBytes(8)),
+		Owner:     owner,
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	}
+
+	var jobs table = *tables.For(database)
+	mu.Lock()
+	jobs[job.ID] = job
+	var started Job = *job
+	mu.Unlock()
+
+	go run(jobs, job.ID, location, fetch)
+
+	return started
+}
+
+func run(jobs table, id string, location *time.Location, fetch func() []tools.TransactionLog) {
+	var buf bytes.Buffer
+	var writer *csv.Writer = csv.NewWriter(&buf)
+
+	entries := fetch()
+
+	// local_timestamp is in the owner's profile timezone, amount is in minor units of currency
+	writer.Write([]string{"id", "type", "from", "to", "amount", "timestamp", "status", "local_timestamp", "currency"})
+	for _, tx := range entries {
+		writer.Write([]string{
+			tx.ID, tx.Type, tx.From, tx.To,
+			strconv.FormatInt(api.MinorUnits(tx.Amount), 10),
+			tx.Timestamp.UTC().Format(time.RFC3339Nano),
+			tx.Status,
+			tx.Timestamp.In(location).Format(time.RFC3339),
+			api.Currency,
+		})
+	}
+	writer.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Forget may have dropped the job while it ran
+	job, ok := jobs[id]
+	if !ok {
+		return
+	}
+	job.CompletedAt = time.Now()
+	if err := writer.Error(); err != nil {
+		log.Error("Export job ", id, " failed: ", err)
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		return
+	}
+
+	job.Status = StatusCompleted
+	job.Rows = len(entries)
+	job.file = buf.Bytes()
+	log.Info("Export job ", id, " completed with ", job.Rows, " rows")
+}
+
+// Get returns a job if it belongs to owner
+func Get(database tools.DatabaseInterface, owner string, id string) (Job, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	job, ok := (*tables.For(database))[id]
+	if !ok || job.Owner != owner {
+		return Job{}, ErrJobNotFound
+	}
+	return *job, nil
+}
+
+// List returns owner's jobs, oldest first
+func List(database tools.DatabaseInterface, owner string) []Job {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var result = []Job{}
+	for _, job := range *tables.For(database) {
+		if job.Owner == owner {
+			result = append(result, *job)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, signingSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DownloadToken returns a token for a completed job that stops working at expiresAt
+func DownloadToken(job Job, expiresAt time.Time) (string, error) {
+	if job.Status != StatusCompleted {
+		return "", ErrNotReady
+	}
+
+	payload := job.ID + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return payload + "." + sign(payload), nil
+}
+
+// Open verifies a download token and returns the job in database's table and its file
+func Open(database tools.DatabaseInterface, token string) (Job, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Job{}, nil, ErrInvalidToken
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(sign(payload)), []byte(parts[2])) {
+		return Job{}, nil, ErrInvalidToken
+	}
+
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return Job{}, nil, ErrInvalidToken
+	}
+	if time.Now().Unix() > expiry {
+		return Job{}, nil, ErrTokenExpired
+	}
+
+	job, ok := (*tables.For(database))[parts[0]]
+	if !ok || job.Status != StatusCompleted {
+		return Job{}, nil, fmt.Errorf("%w: job no longer available", ErrInvalidToken)
+	}
+
+	return *job, job.file, nil
+}
+
+// Forget drops the owner's export jobs and their files
+func Forget(database tools.DatabaseInterface, owner string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var jobs table = *tables.For(database)
+	for id, job := range jobs {
+		if job.Owner == owner {
+			delete(jobs, id)
+		}
+	}
+}
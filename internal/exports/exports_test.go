@@ -0,0 +1,101 @@
+package exports
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+func waitForJob(t *testing.T, database tools.DatabaseInterface, owner string, id string) Job {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		job, err := Get(database, owner, id)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if job.Status != StatusPending {
+			return job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Export job %s never finished", id)
+	return Job{}
+}
+
+func TestTransactionExport(t *testing.T) {
+	entries := []tools.TransactionLog{
+		{ID: "tx1", Type: "DEPOSIT", To: "aaron", Amount: 100, Timestamp: time.Now(), Status: "SUCCESS"},
+	}
+
+	var database = toolstest.New(t, nil)
+	job := Start(database, "aaron", time.UTC, func() []tools.TransactionLog { return entries })
+	job = waitForJob(t, database, "aaron", job.ID)
+
+	t.Run("Only_Owner_Sees_Job", func(t *testing.T) {
+		if _, err := Get(database, "bryan", job.ID); err != ErrJobNotFound {
+			t.Errorf("Expected ErrJobNotFound for another user, got %v", err)
+		}
+	})
+
+	t.Run("Kept_By_Each_Database", func(t *testing.T) {
+		var other = toolstest.New(t, nil)
+		if _, err := Get(other, "aaron", job.ID); err != ErrJobNotFound {
+			t.Errorf("Expected ErrJobNotFound from another database, got %v", err)
+		}
+		if jobs := List(other, "aaron"); len(jobs) != 0 {
+			t.Errorf("Expected no jobs in another database, got %+v", jobs)
+		}
+	})
+
+	t.Run("Signed_Link_Downloads_CSV", func(t *testing.T) {
+		token, err := DownloadToken(job, time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatalf("Failed to sign link: %v", err)
+		}
+
+		_, file, err := Open(database, token)
+		if err != nil {
+			t.Fatalf("Failed to open export: %v", err)
+		}
+		if !strings.Contains(string(file), "tx1,DEPOSIT,,aaron,100,") {
+			t.Errorf("Unexpected CSV contents:\n%s", file)
+		}
+	})
+
+	t.Run("Expired_And_Tampered_Links_Rejected", func(t *testing.T) {
+		expired, _ := DownloadToken(job, time.Now().Add(-time.Minute))
+		if _, _, err := Open(database, expired); err != ErrTokenExpired {
+			t.Errorf("Expected ErrTokenExpired, got %v", err)
+		}
+
+		valid, _ := DownloadToken(job, time.Now().Add(time.Minute))
+		parts := strings.Split(valid, ".")
+		tampered := parts[0] + "." + "9999999999" + "." + parts[2]
+		if _, _, err := Open(database, tampered); err != ErrInvalidToken {
+			t.Errorf("Expected ErrInvalidToken for a modified expiry, got %v", err)
+		}
+	})
+}
+
+func TestForgetWhileRunning(t *testing.T) {
+	var release = make(chan struct{})
+	var fetched = make(chan struct{})
+	var database = toolstest.New(t, nil)
+	job := Start(database, "carol", time.UTC, func() []tools.TransactionLog {
+		<-release
+		defer close(fetched)
+		return nil
+	})
+
+	Forget(database, "carol")
+	close(release)
+	<-fetched
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err := Get(database, "carol", job.ID); err != ErrJobNotFound {
+		t.Errorf("Expected the forgotten job to stay gone, got %v", err)
+	}
+}
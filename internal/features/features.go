@@ -0,0 +1,144 @@
+package features
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	Control   = "control"
+	Treatment = "treatment"
+)
+
+// Experiments the service layer knows how to vary
+const (
+	// Warn about the balance limit at 80% instead of 90%
+	EarlyBalanceWarning = "early_balance_warning"
+)
+
+// OverrideHeader forces buckets for a request, e.g. "early_balance_warning=treatment"
+const OverrideHeader = "X-Experiment-Bucket"
+
+// Experiment sends Percent of users to the treatment bucket
+type Experiment struct {
+	Name    string
+	Percent int
+}
+
+// Assignments maps experiment name to bucket for one request
+type Assignments map[string]string
+
+type contextKey struct{}
+
+// Assign buckets a user by hashing the experiment name with the username, so a user
+// stays in the same bucket across requests. Valid overrides win over the hash.
+func Assign(experiments []Experiment, username string, override string) Assignments {
+	var forced = map[string]string{}
+	for _, pair := range strings.Split(override, ",") {
+		name, bucket, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && (bucket == Control || bucket == Treatment) {
+			forced[name] = bucket
+		}
+	}
+
+	var assignments = Assignments{}
+	for _, experiment := range experiments {
+		if bucket, ok := forced[experiment.Name]; ok {
+			assignments[experiment.Name] = bucket
+			continue
+		}
+
+		hash := fnv.New32a()
+		hash.Write([]byte(experiment.Name + ":" + username))
+
+		if int(hash.Sum32()%100) < experiment.Percent {
+			assignments[experiment.Name] = Treatment
+		} else {
+			assignments[experiment.Name] = Control
+		}
+	}
+	return assignments
+}
+
+// Bucket returns the request's bucket, Control for experiments that aren't running
+func (a Assignments) Bucket(name string) string {
+	if bucket, ok := a[name]; ok {
+		return bucket
+	}
+	return Control
+}
+
+func (a Assignments) Enabled(name string) bool {
+	return a.Bucket(name) == Treatment
+}
+
+// String formats the assignments for a response header, sorted by name
+func (a Assignments) String() string {
+	var pairs []string
+	for name, bucket := range a {
+		pairs = append(pairs, name+"="+bucket)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func WithAssignments(ctx context.Context, assignments Assignments) context.Context {
+	return context.WithValue(ctx, contextKey{}, assignments)
+}
+
+// FromContext returns the request's assignments, empty (all Control) when there are none
+func FromContext(ctx context.Context) Assignments {
+	if assignments, ok := ctx.Value(contextKey{}).(Assignments); ok {
+		return assignments
+	}
+	return Assignments{}
+}
+
+type BucketMetrics struct {
+	Requests int64
+
+	// Responses with a 5xx status
+	Errors int64
+}
+
+var (
+	metricsMu sync.Mutex
+	metrics   = map[string]map[string]BucketMetrics{}
+)
+
+// RecordRequest counts a finished request against each of its buckets
+func RecordRequest(assignments Assignments, status int) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	for name, bucket := range assignments {
+		if metrics[name] == nil {
+			metrics[name] = map[string]BucketMetrics{}
+		}
+
+		counts := metrics[name][bucket]
+		counts.Requests++
+		if status >= 500 {
+			counts.Errors++
+		}
+		metrics[name][bucket] = counts
+	}
+}
+
+// Metrics returns experiment -> bucket -> counts
+func Metrics() map[string]map[string]BucketMetrics {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	var result = make(map[string]map[string]BucketMetrics, len(metrics))
+	for name, buckets := range metrics {
+		result[name] = make(map[string]BucketMetrics, len(buckets))
+		for bucket, counts := range buckets {
+			result[name][bucket] = counts
+		}
+	}
+	return result
+}
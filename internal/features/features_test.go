@@ -0,0 +1,45 @@
+package features
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestAssign(t *testing.T) {
+	var experiments = []Experiment{{Name: EarlyBalanceWarning, Percent: 25}}
+
+	t.Run("Sticky_And_Roughly_Proportional", func(t *testing.T) {
+		var treated int
+		for i := 0; i < 1000; i++ {
+			username := fmt.Sprintf("user_%d", i)
+			first := Assign(experiments, username, "")
+			if Assign(experiments, username, "").Bucket(EarlyBalanceWarning) != first.Bucket(EarlyBalanceWarning) {
+				t.Fatalf("%s changed bucket between requests", username)
+			}
+			if first.Enabled(EarlyBalanceWarning) {
+				treated++
+			}
+		}
+
+		if treated < 200 || treated > 300 {
+			t.Errorf("Expected about 250 of 1000 users in treatment, got %d", treated)
+		}
+	})
+
+	t.Run("Header_Override", func(t *testing.T) {
+		forced := Assign([]Experiment{{Name: EarlyBalanceWarning, Percent: 0}}, "aaron", "early_balance_warning=treatment, other=treatment")
+		if !forced.Enabled(EarlyBalanceWarning) {
+			t.Errorf("Override should force treatment")
+		}
+		if _, ok := forced["other"]; ok {
+			t.Errorf("Overrides must not create experiments that aren't running")
+		}
+	})
+
+	t.Run("Context_Defaults_To_Control", func(t *testing.T) {
+		if FromContext(context.Background()).Enabled(EarlyBalanceWarning) {
+			t.Errorf("Requests without assignments should be in control")
+		}
+	})
+}
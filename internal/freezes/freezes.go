@@ -0,0 +1,428 @@
+package freezes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+const maxReasonLength = 256
+
+var (
+	ErrInvalidFreeze = errors.New("invalid freeze")
+	ErrNotFound      = errors.New("freeze not found")
+	ErrLifted        = errors.New("freeze was already lifted")
+	ErrFrozen        = errors.New("account is already frozen")
+	ErrNotFrozen     = errors.New("account isn't frozen")
+)
+
+// Actions recorded in a freeze's history
+const (
+	ActionPlaced   = "placed"
+	ActionAdjusted = "adjusted"
+	ActionLifted   = "lifted"
+
+	// Whole-account freezes
+	ActionFrozen   = "frozen"
+	ActionUnfrozen = "unfrozen"
+)
+
+// Change is one audited action on a freeze
+type Change struct {
+	Action string
+	Amount int64
+	Reason string
+	By     string
+	At     time.Time
+}
+
+// Freeze holds back Amount of an account's balance, pending investigation
+type Freeze struct {
+	ID      string
+	Account string
+	Amount  int64
+	Reason  string
+	Active  bool
+	History []Change
+}
+
+// AccountFreeze stops an account sending or withdrawing any coins, unlike a Freeze
+// which only holds back an amount. History keeps every freeze and unfreeze.
+type AccountFreeze struct {
+	Account string
+	Frozen  bool
+	Reason  string
+	History []Change
+}
+
+// Record kinds freezes are kept as, so they last as long as the balances they hold
+// back. An account freeze's ID is the account.
+const (
+	recordKind        = "freeze"
+	accountRecordKind = "account_freeze"
+)
+
+var mu sync.Mutex
+
+func newID() string {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+func validate(amount int64, reason string) error {
+	if amount <= 0 {
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidFreeze)
+	}
+	if reason == "" || len(reason) > maxReasonLength {
+		return fmt.Errorf("%w: reason is required and at most %d characters", ErrInvalidFreeze, maxReasonLength)
+	}
+	return nil
+}
+
+func loadFreeze(database tools.DatabaseInterface, id string) (*Freeze, error) {
+	record, err := database.GetRecord(recordKind, id)
+	if errors.Is(err, tools.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var freeze Freeze
+	err = json.Unmarshal(record.Data, &freeze)
+	if err != nil {
+		return nil, err
+	}
+	return &freeze, nil
+}
+
+func saveFreeze(database tools.DatabaseInterface, freeze *Freeze) error {
+	data, err := json.Marshal(freeze)
+	if err != nil {
+		return err
+	}
+	return database.PutRecord(tools.Record{Kind: recordKind, ID: freeze.ID, Account: freeze.Account, Data: data, UpdatedAt: time.Now()})
+}
+
+// Place freezes amount of account's balance. Storage holds the amount back, so a debit
+// racing the freeze either lands first or can't spend it.
+func Place(database tools.DatabaseInterface, account string, amount int64, reason string, by string) (Freeze, error) {
+	err := validate(amount, reason)
+	if err != nil {
+		return Freeze{}, err
+	}
+	if account == "" {
+		return Freeze{}, fmt.Errorf("%w: account is required", ErrInvalidFreeze)
+	}
+
+	var freeze = &Freeze{
+		ID:      newID(),
+		Account: account,
+		Amount:  amount,
+		Reason:  reason,
+		Active:  true,
+		History: []Change{{Action: ActionPlaced, Amount: amount, Reason: reason, By: by, At: time.Now()}},
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	_, err = database.PlaceHold(tools.Hold{ID: freeze.ID, Account: account, Kind: tools.HoldFreeze, Amount: amount})
+	if err != nil {
+		return Freeze{}, err
+	}
+	err = saveFreeze(database, freeze)
+	if err != nil {
+		_, releaseErr := database.ReleaseHold(freeze.ID)
+		return Freeze{}, errors.Join(err, releaseErr)
+	}
+	return *freeze, nil
+}
+
+// Adjust changes the frozen amount of an active freeze
+func Adjust(database tools.DatabaseInterface, id string, amount int64, reason string, by string) (Freeze, error) {
+	err := validate(amount, reason)
+	if err != nil {
+		return Freeze{}, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	freeze, err := loadFreeze(database, id)
+	if err != nil {
+		return Freeze{}, err
+	}
+	if !freeze.Active {
+		return Freeze{}, ErrLifted
+	}
+
+	var previous int64 = freeze.Amount
+	_, err = database.PlaceHold(tools.Hold{ID: freeze.ID, Account: freeze.Account, Kind: tools.HoldFreeze, Amount: amount})
+	if err != nil {
+		return Freeze{}, err
+	}
+
+	freeze.Amount = amount
+	freeze.Reason = reason
+	freeze.History = append(freeze.History, Change{Action: ActionAdjusted, Amount: amount, Reason: reason, By: by, At: time.Now()})
+	err = saveFreeze(database, freeze)
+	if err != nil {
+		_, restoreErr := database.PlaceHold(tools.Hold{ID: freeze.ID, Account: freeze.Account, Kind: tools.HoldFreeze, Amount: previous})
+		return Freeze{}, errors.Join(err, restoreErr)
+	}
+	return *freeze, nil
+}
+
+// Lift releases a freeze, it stays listed with its history
+func Lift(database tools.DatabaseInterface, id string, reason string, by string) (Freeze, error) {
+	err := validReason(reason)
+	if err != nil {
+		return Freeze{}, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	freeze, err := loadFreeze(database, id)
+	if err != nil {
+		return Freeze{}, err
+	}
+	if !freeze.Active {
+		return Freeze{}, ErrLifted
+	}
+
+	_, err = database.ReleaseHold(freeze.ID)
+	if err != nil && !errors.Is(err, tools.ErrHoldNotFound) {
+		return Freeze{}, err
+	}
+
+	freeze.Active = false
+	freeze.History = append(freeze.History, Change{Action: ActionLifted, Amount: freeze.Amount, Reason: reason, By: by, At: time.Now()})
+	err = saveFreeze(database, freeze)
+	if err != nil {
+		_, restoreErr := database.PlaceHold(tools.Hold{ID: freeze.ID, Account: freeze.Account, Kind: tools.HoldFreeze, Amount: freeze.Amount})
+		return Freeze{}, errors.Join(err, restoreErr)
+	}
+	return *freeze, nil
+}
+
+// List returns account's freezes, or every freeze when account is empty, oldest first
+func List(database tools.DatabaseInterface, account string) ([]Freeze, error) {
+	records, err := database.ListRecords(recordKind, account)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = make([]Freeze, 0, len(records))
+	for _, record := range records {
+		var freeze Freeze
+		err = json.Unmarshal(record.Data, &freeze)
+		if err != nil {
+			return nil, fmt.Errorf("freeze %s: %w", record.ID, err)
+		}
+		result = append(result, freeze)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].History[0].At.Before(result[j].History[0].At)
+	})
+	return result, nil
+}
+
+// Totals aggregates the active freezes on one account
+type Totals struct {
+	Amount int64
+	Count  int
+}
+
+// Summarize sums the active freezes on account
+func Summarize(database tools.DatabaseInterface, account string) (Totals, error) {
+	list, err := List(database, account)
+	if err != nil {
+		return Totals{}, err
+	}
+
+	var totals Totals
+	for _, freeze := range list {
+		if freeze.Active {
+			totals.Amount += freeze.Amount
+			totals.Count++
+		}
+	}
+	return totals, nil
+}
+
+// Frozen sums the active freezes on account
+func Frozen(database tools.DatabaseInterface, account string) (int64, error) {
+	totals, err := Summarize(database, account)
+	return totals.Amount, err
+}
+
+func validReason(reason string) error {
+	if reason == "" || len(reason) > maxReasonLength {
+		return fmt.Errorf("%w: reason is required and at most %d characters", ErrInvalidFreeze, maxReasonLength)
+	}
+	return nil
+}
+
+// AccountFreezeOf returns account's whole-account freeze, unfrozen with no history if
+// it never was frozen. Whether the account is frozen now is the balance's Frozen, this
+// is the reason and audit trail that go with it.
+func AccountFreezeOf(database tools.DatabaseInterface, account string) (AccountFreeze, error) {
+	record, err := database.GetRecord(accountRecordKind, account)
+	if errors.Is(err, tools.ErrRecordNotFound) {
+		return AccountFreeze{Account: account}, nil
+	}
+	if err != nil {
+		return AccountFreeze{}, err
+	}
+
+	var freeze AccountFreeze
+	err = json.Unmarshal(record.Data, &freeze)
+	return freeze, err
+}
+
+func saveAccountFreeze(database tools.DatabaseInterface, freeze AccountFreeze) error {
+	data, err := json.Marshal(freeze)
+	if err != nil {
+		return err
+	}
+	return database.PutRecord(tools.Record{Kind: accountRecordKind, ID: freeze.Account, Account: freeze.Account, Data: data, UpdatedAt: time.Now()})
+}
+
+// FreezeAccount stops account sending or withdrawing coins until UnfreezeAccount.
+// Coins can still be paid in. Storage refuses the debits itself, so every replica and
+// job sees the freeze as soon as it is set.
+func FreezeAccount(database tools.DatabaseInterface, account string, reason string, by string) (AccountFreeze, error) {
+	err := validReason(reason)
+	if err != nil {
+		return AccountFreeze{}, err
+	}
+	if account == "" {
+		return AccountFreeze{}, fmt.Errorf("%w: account is required", ErrInvalidFreeze)
+	}
+	return setAccountFrozen(database, account, true, Change{Action: ActionFrozen, Reason: reason, By: by, At: time.Now()})
+}
+
+// UnfreezeAccount lets account move coins again, the freeze stays in its history
+func UnfreezeAccount(database tools.DatabaseInterface, account string, reason string, by string) (AccountFreeze, error) {
+	err := validReason(reason)
+	if err != nil {
+		return AccountFreeze{}, err
+	}
+	return setAccountFrozen(database, account, false, Change{Action: ActionUnfrozen, Reason: reason, By: by, At: time.Now()})
+}
+
+// setAccountFrozen flips the balance's flag and then records why. If the record can't
+// be written the flag is put back, so a freeze never goes unexplained.
+func setAccountFrozen(database tools.DatabaseInterface, account string, frozen bool, change Change) (AccountFreeze, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	details, err := database.GetUserCoins(account)
+	if err != nil {
+		return AccountFreeze{}, err
+	}
+	freeze, err := AccountFreezeOf(database, account)
+	if err != nil {
+		return AccountFreeze{}, err
+	}
+	if details.Frozen == frozen {
+		freeze.Frozen = details.Frozen
+		if frozen {
+			return freeze, ErrFrozen
+		}
+		return freeze, ErrNotFrozen
+	}
+
+	_, err = database.SetUserFrozen(account, frozen)
+	if err != nil {
+		return AccountFreeze{}, err
+	}
+
+	freeze.Frozen = frozen
+	freeze.Reason = change.Reason
+	freeze.History = append(freeze.History, change)
+	err = saveAccountFreeze(database, freeze)
+	if err != nil {
+		if _, restoreErr := database.SetUserFrozen(account, !frozen); restoreErr != nil {
+			return AccountFreeze{}, errors.Join(err, restoreErr)
+		}
+		return AccountFreeze{}, err
+	}
+	return freeze, nil
+}
+
+// Pseudonymize replaces username with pseudonym in every freeze and its history. The
+// balance's own flag moves with the account when storage anonymizes it.
+func Pseudonymize(database tools.DatabaseInterface, username string, pseudonym string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	list, err := List(database, "")
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		var freeze = &list[i]
+		var renamed = renameChanges(freeze.History, username, pseudonym)
+		if freeze.Account == username {
+			freeze.Account = pseudonym
+			renamed = true
+		}
+		if renamed {
+			if err = saveFreeze(database, freeze); err != nil {
+				return err
+			}
+		}
+	}
+
+	records, err := database.ListRecords(accountRecordKind, "")
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		var freeze AccountFreeze
+		if err = json.Unmarshal(record.Data, &freeze); err != nil {
+			return fmt.Errorf("account freeze %s: %w", record.ID, err)
+		}
+		var renamed = renameChanges(freeze.History, username, pseudonym)
+		if freeze.Account == username {
+			freeze.Account = pseudonym
+			renamed = true
+		}
+		if !renamed {
+			continue
+		}
+		if err = saveAccountFreeze(database, freeze); err != nil {
+			return err
+		}
+		if record.ID != freeze.Account {
+			if err = database.DeleteRecord(accountRecordKind, record.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renameChanges replaces username in history's By, true if it was there
+func renameChanges(history []Change, username string, pseudonym string) bool {
+	var renamed bool
+	for i := range history {
+		if history[i].By == username {
+			history[i].By = pseudonym
+			renamed = true
+		}
+	}
+	return renamed
+}
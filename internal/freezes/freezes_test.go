@@ -0,0 +1,176 @@
+package freezes
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+func TestPartialFreezes(t *testing.T) {
+	var database = toolstest.New(t, nil)
+	available := func(account string) int64 {
+		details, err := database.GetUserCoins(account)
+		if err != nil {
+			t.Fatalf("Failed to read balance: %v", err)
+		}
+		return details.Available()
+	}
+
+	t.Run("Place_Adjust_Lift", func(t *testing.T) {
+		freeze, err := Place(database, "aaron", 300, "chargeback investigation", "admin")
+		if err != nil {
+			t.Fatalf("Failed to place freeze: %v", err)
+		}
+		if available("aaron") != 700 {
+			t.Errorf("Expected 700 available, got %d", available("aaron"))
+		}
+
+		Adjust(database, freeze.ID, 1200, "chargeback grew", "admin")
+		if available("aaron") != 0 {
+			t.Errorf("Available must not go below zero, got %d", available("aaron"))
+		}
+
+		lifted, err := Lift(database, freeze.ID, "resolved", "admin")
+		if err != nil {
+			t.Fatalf("Failed to lift freeze: %v", err)
+		}
+		if frozen, _ := Frozen(database, "aaron"); frozen != 0 || available("aaron") != 1000 {
+			t.Errorf("Expected nothing frozen after lifting, got %d", frozen)
+		}
+
+		if len(lifted.History) != 3 || lifted.History[2].Action != ActionLifted || lifted.History[1].Amount != 1200 {
+			t.Errorf("Unexpected history: %+v", lifted.History)
+		}
+	})
+
+	t.Run("Lifted_Freeze_Is_Final", func(t *testing.T) {
+		freeze, _ := Place(database, "bryan", 10, "review", "admin")
+		Lift(database, freeze.ID, "done", "admin")
+
+		if _, err := Adjust(database, freeze.ID, 20, "again", "admin"); !errors.Is(err, ErrLifted) {
+			t.Errorf("Expected ErrLifted, got %v", err)
+		}
+	})
+
+	t.Run("Reason_Required", func(t *testing.T) {
+		if _, err := Place(database, "aaron", 10, "", "admin"); !errors.Is(err, ErrInvalidFreeze) {
+			t.Errorf("Expected ErrInvalidFreeze, got %v", err)
+		}
+	})
+
+	t.Run("Kept_In_Storage", func(t *testing.T) {
+		// Another database sees nothing, the freezes live with the balances
+		if list, _ := List(toolstest.New(t, nil), "aaron"); len(list) != 0 {
+			t.Errorf("Expected no freezes in a fresh database, got %+v", list)
+		}
+		if list, _ := List(database, "aaron"); len(list) != 1 {
+			t.Errorf("Expected aaron's freeze listed, got %+v", list)
+		}
+	})
+}
+
+func TestFrozenFundsRefusedByStorage(t *testing.T) {
+	var database = toolstest.New(t, nil)
+	if _, err := Place(database, "aaron", 900, "chargeback investigation", "admin"); err != nil {
+		t.Fatalf("Failed to place freeze: %v", err)
+	}
+
+	// Storage holds the frozen coins back itself, whatever the caller checked before
+	if _, err := database.WithdrawUserCoins("aaron", 101); !errors.Is(err, tools.ErrInsufficientFunds) {
+		t.Errorf("Expected ErrInsufficientFunds for a withdrawal of frozen coins, got %v", err)
+	}
+	if _, _, err := database.TransferUserCoinsWithContext(context.Background(), "aaron", "bryan", 101); !errors.Is(err, tools.ErrInsufficientFunds) {
+		t.Errorf("Expected ErrInsufficientFunds for a transfer of frozen coins, got %v", err)
+	}
+	if _, err := database.WithdrawUserCoins("aaron", 100); err != nil {
+		t.Errorf("Expected the unfrozen coins to be withdrawn, got %v", err)
+	}
+}
+
+func TestAccountFreezes(t *testing.T) {
+	var database = toolstest.New(t, nil)
+	frozen := func(account string) bool {
+		details, err := database.GetUserCoins(account)
+		return err == nil && details.Frozen
+	}
+
+	if _, err := UnfreezeAccount(database, "bryan", "never frozen", "admin"); !errors.Is(err, ErrNotFrozen) {
+		t.Errorf("Expected ErrNotFrozen, got %v", err)
+	}
+	if _, err := FreezeAccount(database, "nobody", "investigation", "admin"); !errors.Is(err, tools.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	if _, err := FreezeAccount(database, "bryan", "", "admin"); !errors.Is(err, ErrInvalidFreeze) {
+		t.Errorf("Expected ErrInvalidFreeze, got %v", err)
+	}
+	if _, err := FreezeAccount(database, "bryan", "investigation", "admin"); err != nil || !frozen("bryan") {
+		t.Fatalf("Expected bryan frozen, got %v", err)
+	}
+	if _, err := FreezeAccount(database, "bryan", "again", "admin"); !errors.Is(err, ErrFrozen) {
+		t.Errorf("Expected ErrFrozen, got %v", err)
+	}
+
+	freeze, err := UnfreezeAccount(database, "bryan", "cleared", "admin")
+	if err != nil || freeze.Frozen || frozen("bryan") {
+		t.Fatalf("Expected bryan unfrozen, got %+v, %v", freeze, err)
+	}
+	if len(freeze.History) != 2 || freeze.History[0].Action != ActionFrozen || freeze.History[1].Action != ActionUnfrozen {
+		t.Errorf("Unexpected history: %+v", freeze.History)
+	}
+	if stored, _ := AccountFreezeOf(database, "bryan"); len(stored.History) != 2 {
+		t.Errorf("Expected the history kept in storage, got %+v", stored)
+	}
+}
+
+func TestFrozenAccountRefusedByStorage(t *testing.T) {
+	var database = toolstest.New(t, nil)
+	if _, err := FreezeAccount(database, "aaron", "investigation", "admin"); err != nil {
+		t.Fatalf("Failed to freeze aaron: %v", err)
+	}
+
+	if _, err := database.WithdrawUserCoins("aaron", 10); !errors.Is(err, tools.ErrAccountFrozen) {
+		t.Errorf("Expected ErrAccountFrozen for a withdrawal, got %v", err)
+	}
+	if _, _, err := database.TransferUserCoinsWithContext(context.Background(), "aaron", "bryan", 10); !errors.Is(err, tools.ErrAccountFrozen) {
+		t.Errorf("Expected ErrAccountFrozen for a transfer, got %v", err)
+	}
+
+	// Coins still come in, and the balance reads as frozen
+	if _, err := database.AddUserCoins("aaron", 10); err != nil {
+		t.Errorf("Expected deposits to go on, got %v", err)
+	}
+	if _, _, err := database.TransferUserCoinsWithContext(context.Background(), "bryan", "aaron", 10); err != nil {
+		t.Errorf("Expected transfers to a frozen account to go on, got %v", err)
+	}
+	details, err := database.GetUserCoins("aaron")
+	if err != nil || !details.Frozen || details.Coins != 1020 {
+		t.Errorf("Expected a frozen balance of 1020, got %+v, %v", details, err)
+	}
+}
+
+func TestPseudonymize(t *testing.T) {
+	var database = toolstest.New(t, nil)
+	Place(database, "aaron", 10, "review", "bryan")
+	FreezeAccount(database, "aaron", "investigation", "bryan")
+
+	if err := Pseudonymize(database, "aaron", "deleted-1"); err != nil {
+		t.Fatalf("Failed to pseudonymize: %v", err)
+	}
+	if err := Pseudonymize(database, "bryan", "deleted-2"); err != nil {
+		t.Fatalf("Failed to pseudonymize: %v", err)
+	}
+
+	if list, _ := List(database, "deleted-1"); len(list) != 1 || list[0].History[0].By != "deleted-2" {
+		t.Errorf("Expected the freeze renamed, got %+v", list)
+	}
+	if freeze, _ := AccountFreezeOf(database, "deleted-1"); !freeze.Frozen || freeze.History[0].By != "deleted-2" {
+		t.Errorf("Expected the account freeze renamed, got %+v", freeze)
+	}
+	if freeze, _ := AccountFreezeOf(database, "aaron"); len(freeze.History) != 0 {
+		t.Errorf("Expected nothing left under aaron, got %+v", freeze)
+	}
+}
@@ -0,0 +1,391 @@
+// Package gifts holds coins sent as gifts until the recipient accepts them. The coins
+// stay in the sender's balance, held back in storage, and only move on acceptance. A
+// gift declined or not accepted in time is returned by releasing the hold.
+package gifts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// Longest message a gift can carry, in characters
+const MaxMessageLength = 280
+
+var (
+	ErrInvalidGift       = errors.New("invalid gift")
+	ErrDisabled          = errors.New("gifting is not enabled")
+	ErrNotFound          = errors.New("gift not found")
+	ErrNotPending        = errors.New("gift is no longer waiting to be accepted")
+	ErrInsufficientFunds = errors.New("insufficient funds once unaccepted gifts are reserved")
+	ErrTransferFailed    = errors.New("gift could not be transferred")
+)
+
+// Gift statuses, pending and accepting still reserve the coins
+const (
+	StatusPending   = "pending"
+	StatusAccepting = "accepting"
+	StatusAccepted  = "accepted"
+	StatusDeclined  = "declined"
+	StatusReturned  = "returned"
+	StatusFailed    = "failed"
+)
+
+type Gift struct {
+	ID        string
+	From      string
+	To        string
+	Amount    int64
+	Message   string
+	Status    string
+	SentAt    time.Time
+	ExpiresAt time.Time
+
+	// Set once the gift is accepted, declined, returned or failed
+	ResolvedAt time.Time
+}
+
+// Open is true until the gift is resolved
+func (g Gift) Open() bool {
+	return g.Status == StatusPending || g.Status == StatusAccepting
+}
+
+// Kinds a gift is kept as. Storage holds the coins back under the gift's ID, so a
+// gift is accepted or returned once however many processes race for it, and the gift
+// itself is a record next to the balances.
+const (
+	holdKind   = "gift"
+	recordKind = "gift"
+)
+
+var mu sync.Mutex
+
+func newID() string {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+func load(database tools.DatabaseInterface, id string) (*Gift, error) {
+	record, err := database.GetRecord(recordKind, id)
+	if errors.Is(err, tools.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var gift Gift
+	err = json.Unmarshal(record.Data, &gift)
+	if err != nil {
+		return nil, err
+	}
+	return &gift, nil
+}
+
+func save(database tools.DatabaseInterface, gift *Gift) error {
+	data, err := json.Marshal(gift)
+	if err != nil {
+		return err
+	}
+	return database.PutRecord(tools.Record{Kind: recordKind, ID: gift.ID, Account: gift.From, Data: data, UpdatedAt: time.Now()})
+}
+
+// all returns every gift, oldest first
+func all(database tools.DatabaseInterface) ([]Gift, error) {
+	records, err := database.ListRecords(recordKind, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var result = make([]Gift, 0, len(records))
+	for _, record := range records {
+		var gift Gift
+		err = json.Unmarshal(record.Data, &gift)
+		if err != nil {
+			return nil, fmt.Errorf("gift %s: %w", record.ID, err)
+		}
+		result = append(result, gift)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].SentAt.Before(result[j].SentAt) })
+	return result, nil
+}
+
+// Send reserves amount of from's coins for to, who has window from now to accept
+// them. Storage checks from has that much available as it holds it back.
+func Send(database tools.DatabaseInterface, from string, to string, amount int64, message string, window time.Duration, now time.Time) (Gift, error) {
+	if window <= 0 {
+		return Gift{}, ErrDisabled
+	}
+	if amount <= 0 || from == "" || to == "" || from == to {
+		return Gift{}, ErrInvalidGift
+	}
+	if utf8.RuneCountInString(message) > MaxMessageLength {
+		return Gift{}, fmt.Errorf("%w: message must be at most %d characters", ErrInvalidGift, MaxMessageLength)
+	}
+
+	var gift = &Gift{
+		ID:        newID(),
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Message:   message,
+		Status:    StatusPending,
+		SentAt:    now,
+		ExpiresAt: now.Add(window),
+	}
+
+	_, err := database.PlaceHold(tools.Hold{ID: gift.ID, Account: from, Kind: holdKind, Amount: amount, CreatedAt: now})
+	if errors.Is(err, tools.ErrInsufficientFunds) {
+		return Gift{}, ErrInsufficientFunds
+	}
+	if err != nil {
+		return Gift{}, err
+	}
+	err = save(database, gift)
+	if err != nil {
+		_, releaseErr := database.ReleaseHold(gift.ID)
+		return Gift{}, errors.Join(err, releaseErr)
+	}
+
+	events.Record(database, events.GiftSent, from, map[string]interface{}{
+		"gift":   gift.ID,
+		"from":   from,
+		"to":     to,
+		"amount": amount,
+	})
+	return *gift, nil
+}
+
+// Pending totals the unresolved gifts username sent and was sent
+func Pending(database tools.DatabaseInterface, username string) (outgoing int64, incoming int64, err error) {
+	open, err := Open(database, username)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, gift := range open {
+		if gift.From == username {
+			outgoing += gift.Amount
+		}
+		if gift.To == username {
+			incoming += gift.Amount
+		}
+	}
+	return outgoing, incoming, nil
+}
+
+// List returns the gifts username sent or was sent, newest first. An empty status
+// lists every gift.
+func List(database tools.DatabaseInterface, username string, status string) ([]Gift, error) {
+	gifts, err := all(database)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = []Gift{}
+	for i := len(gifts) - 1; i >= 0; i-- {
+		var gift = gifts[i]
+		if gift.From != username && gift.To != username {
+			continue
+		}
+		if status != "" && gift.Status != status {
+			continue
+		}
+		result = append(result, gift)
+	}
+	return result, nil
+}
+
+// Open lists the unresolved gifts username sent or was sent, oldest first
+func Open(database tools.DatabaseInterface, username string) ([]Gift, error) {
+	gifts, err := all(database)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = []Gift{}
+	for _, gift := range gifts {
+		if gift.Open() && (gift.From == username || gift.To == username) {
+			result = append(result, gift)
+		}
+	}
+	return result, nil
+}
+
+// claim loads a pending gift addressed to username. A gift past its deadline can't be
+// claimed, whether or not Expire has returned it yet. The caller holds mu.
+func claim(database tools.DatabaseInterface, id string, username string, now time.Time) (*Gift, error) {
+	gift, err := load(database, id)
+	if err != nil {
+		return nil, err
+	}
+	if gift.To != username {
+		return nil, ErrNotFound
+	}
+	if gift.Status != StatusPending || !now.Before(gift.ExpiresAt) {
+		return nil, ErrNotPending
+	}
+	return gift, nil
+}
+
+// Accept moves the gift's coins to its recipient, username. Storage releases the
+// reservation and moves the coins in one step, and only once for a gift.
+func Accept(database tools.DatabaseInterface, id string, username string, now time.Time) (Gift, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	gift, err := claim(database, id, username, now)
+	if err != nil {
+		return Gift{}, err
+	}
+
+	_, _, err = database.CaptureHold(context.Background(), gift.ID, gift.To, gift.Amount)
+	gift.ResolvedAt = now
+	gift.Status = StatusAccepted
+	switch {
+	case errors.Is(err, tools.ErrHoldNotFound):
+		return Gift{}, ErrNotPending
+	case errors.Is(err, tools.ErrAccountFrozen), errors.Is(err, tools.ErrUserNotFound),
+		errors.Is(err, tools.ErrInsufficientFunds), errors.Is(err, tools.ErrBalanceOverflow):
+		// Storage refused the move, so the coins go back to the sender
+		log.Error("Gift transfer failed for users: ", gift.From, " -> ", gift.To, " amount: ", gift.Amount, ": ", err)
+		gift.Status = StatusFailed
+		if _, releaseErr := database.ReleaseHold(gift.ID); releaseErr != nil && !errors.Is(releaseErr, tools.ErrHoldNotFound) {
+			return Gift{}, errors.Join(err, releaseErr)
+		}
+	case err != nil:
+		return Gift{}, err
+	}
+	if saveErr := save(database, gift); saveErr != nil {
+		log.Error("Failed to record gift ", gift.ID, " as ", gift.Status, ": ", saveErr)
+	}
+
+	if gift.Status == StatusFailed {
+		return *gift, ErrTransferFailed
+	}
+	events.Record(database, events.TransferCompleted, gift.From, map[string]interface{}{
+		"from":   gift.From,
+		"to":     gift.To,
+		"amount": gift.Amount,
+		"gift":   gift.ID,
+	})
+	return *gift, nil
+}
+
+// Decline returns the gift to its sender, username must be the recipient
+func Decline(database tools.DatabaseInterface, id string, username string, now time.Time) (Gift, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	gift, err := claim(database, id, username, now)
+	if err != nil {
+		return Gift{}, err
+	}
+
+	_, err = database.ReleaseHold(gift.ID)
+	if errors.Is(err, tools.ErrHoldNotFound) {
+		return Gift{}, ErrNotPending
+	}
+	if err != nil {
+		return Gift{}, err
+	}
+
+	gift.Status = StatusDeclined
+	gift.ResolvedAt = now
+	if err = save(database, gift); err != nil {
+		log.Error("Failed to record gift ", gift.ID, " as declined: ", err)
+	}
+
+	recordReturn(database, *gift)
+	return *gift, nil
+}
+
+// Expire returns every pending gift whose deadline has passed at now. A gift another
+// process resolved first is skipped.
+func Expire(database tools.DatabaseInterface, now time.Time) ([]Gift, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	gifts, err := all(database)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []Gift
+	for _, gift := range gifts {
+		if gift.Status != StatusPending || now.Before(gift.ExpiresAt) {
+			continue
+		}
+
+		_, err = database.ReleaseHold(gift.ID)
+		if errors.Is(err, tools.ErrHoldNotFound) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+
+		gift.Status = StatusReturned
+		gift.ResolvedAt = now
+		if err = save(database, &gift); err != nil {
+			log.Error("Failed to record gift ", gift.ID, " as returned: ", err)
+		}
+		recordReturn(database, gift)
+		expired = append(expired, gift)
+	}
+
+	sort.Slice(expired, func(i, j int) bool { return expired[i].ExpiresAt.Before(expired[j].ExpiresAt) })
+	return expired, nil
+}
+
+func recordReturn(database tools.DatabaseInterface, gift Gift) {
+	events.Record(database, events.GiftReturned, gift.From, map[string]interface{}{
+		"gift":   gift.ID,
+		"from":   gift.From,
+		"to":     gift.To,
+		"amount": gift.Amount,
+		"status": gift.Status,
+	})
+}
+
+// Schedule returns gifts as their deadlines pass, checking every tick until ctx is done
+func Schedule(ctx context.Context, tick time.Duration, open func() (tools.DatabaseInterface, error)) {
+	var ticker *time.Ticker = time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			database, err := open()
+			if err != nil {
+				log.Error("Gift expiry could not open the database: ", err)
+				continue
+			}
+			expired, err := Expire(database, now)
+			if err != nil {
+				log.Error("Gift expiry failed: ", err)
+			}
+			for _, gift := range expired {
+				log.WithFields(log.Fields{
+					"gift":   gift.ID,
+					"from":   gift.From,
+					"to":     gift.To,
+					"amount": gift.Amount,
+				}).Info("Gift not accepted in time, returned to sender")
+			}
+		}
+	}
+}
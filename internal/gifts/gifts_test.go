@@ -0,0 +1,135 @@
+package gifts
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+func TestGifts(t *testing.T) {
+	var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var week = 7 * 24 * time.Hour
+
+	t.Run("Accepted_Gift_Moves_Coins", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		gift, err := Send(database, "aaron", "bryan", 40, "Happy birthday", week, now)
+		if err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		if toolstest.Held(t, database, "aaron") != 40 {
+			t.Errorf("Expected 40 held for aaron, got %d", toolstest.Held(t, database, "aaron"))
+		}
+		outgoing, _, _ := Pending(database, "aaron")
+		_, incoming, _ := Pending(database, "bryan")
+		if outgoing != 40 || incoming != 40 {
+			t.Errorf("Expected 40 pending for both, got %d and %d", outgoing, incoming)
+		}
+
+		if _, err := Accept(database, gift.ID, "aaron", now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound when the sender accepts, got %v", err)
+		}
+		accepted, err := Accept(database, gift.ID, "bryan", now.Add(time.Hour))
+		if err != nil || accepted.Status != StatusAccepted || accepted.Message != "Happy birthday" {
+			t.Fatalf("Expected the gift to be accepted, got %+v, %v", accepted, err)
+		}
+
+		aaron, _ := database.GetUserCoins("aaron")
+		bryan, _ := database.GetUserCoins("bryan")
+		if aaron.Coins != 960 || bryan.Coins != 1040 {
+			t.Errorf("Expected 960 and 1040, got %d and %d", aaron.Coins, bryan.Coins)
+		}
+		if open, _ := Open(database, "bryan"); toolstest.Held(t, database, "aaron") != 0 || len(open) != 0 {
+			t.Error("Expected the reservation to end with the acceptance")
+		}
+		if _, err := Decline(database, gift.ID, "bryan", now); !errors.Is(err, ErrNotPending) {
+			t.Errorf("Expected ErrNotPending for a resolved gift, got %v", err)
+		}
+	})
+
+	t.Run("Declined_And_Expired_Gifts_Return", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		declined, _ := Send(database, "aaron", "bryan", 10, "", week, now)
+		expiring, _ := Send(database, "aaron", "bryan", 20, "", week, now)
+
+		if gift, err := Decline(database, declined.ID, "bryan", now); err != nil || gift.Status != StatusDeclined {
+			t.Fatalf("Expected the gift to be declined, got %+v, %v", gift, err)
+		}
+		if expired, _ := Expire(database, now.Add(week-time.Second)); len(expired) != 0 {
+			t.Fatalf("Expected nothing to expire before the deadline, got %+v", expired)
+		}
+		expired, err := Expire(database, now.Add(week))
+		if err != nil || len(expired) != 1 || expired[0].ID != expiring.ID || expired[0].Status != StatusReturned {
+			t.Fatalf("Expected the second gift to be returned, got %+v", expired)
+		}
+
+		if toolstest.Held(t, database, "aaron") != 0 {
+			t.Errorf("Expected nothing held, got %d", toolstest.Held(t, database, "aaron"))
+		}
+		if history := database.GetTransactionHistory("aaron"); len(history) != 0 {
+			t.Errorf("Expected no ledger entries, got %+v", history)
+		}
+		if list, _ := List(database, "bryan", StatusReturned); len(list) != 1 {
+			t.Errorf("Expected one returned gift, got %+v", list)
+		}
+	})
+
+	t.Run("Late_Acceptance_Is_Refused", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		gift, _ := Send(database, "aaron", "bryan", 10, "", week, now)
+		if _, err := Accept(database, gift.ID, "bryan", now.Add(week)); !errors.Is(err, ErrNotPending) {
+			t.Errorf("Expected ErrNotPending after the deadline, got %v", err)
+		}
+	})
+
+	t.Run("Gift_Resolved_Elsewhere_Is_Refused", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		// Another process returned the gift first, accepting it can't move the coins
+		gift, _ := Send(database, "aaron", "bryan", 10, "", week, now)
+		if _, err := database.ReleaseHold(gift.ID); err != nil {
+			t.Fatalf("Failed to release the storage hold: %v", err)
+		}
+		if _, err := Accept(database, gift.ID, "bryan", now); !errors.Is(err, ErrNotPending) {
+			t.Errorf("Expected ErrNotPending, got %v", err)
+		}
+		if history := database.GetTransactionHistory("aaron"); len(history) != 0 {
+			t.Errorf("Expected no ledger entries, got %+v", history)
+		}
+	})
+
+	t.Run("Reservations_Cap_Spending", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		if _, err := Send(database, "aaron", "bryan", 600, "", week, now); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		if _, err := Send(database, "aaron", "bryan", 500, "", week, now); !errors.Is(err, ErrInsufficientFunds) {
+			t.Errorf("Expected ErrInsufficientFunds, got %v", err)
+		}
+		if _, _, err := database.TransferUserCoinsWithContext(context.Background(), "aaron", "bryan", 401); !errors.Is(err, tools.ErrInsufficientFunds) {
+			t.Errorf("Expected the reserved coins to be out of a transfer's reach, got %v", err)
+		}
+	})
+
+	t.Run("Refuses_Invalid_Gifts", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		if _, err := Send(database, "aaron", "bryan", 10, "", 0, now); !errors.Is(err, ErrDisabled) {
+			t.Errorf("Expected ErrDisabled, got %v", err)
+		}
+		if _, err := Send(database, "aaron", "aaron", 10, "", week, now); !errors.Is(err, ErrInvalidGift) {
+			t.Errorf("Expected ErrInvalidGift for a gift to yourself, got %v", err)
+		}
+		if _, err := Send(database, "aaron", "bryan", 10, strings.Repeat("x", MaxMessageLength+1), week, now); !errors.Is(err, ErrInvalidGift) {
+			t.Errorf("Expected ErrInvalidGift for a long message, got %v", err)
+		}
+	})
+}
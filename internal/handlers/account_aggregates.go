@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/aggregates"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultAggregateMonths = 12
+
+// GetAccountAggregates returns the caller's monthly totals from the aggregates view
+// rather than the ledger, so a statement summary costs the same for any history
+func GetAccountAggregates(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.AccountAggregatesParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var now time.Time = time.Now().UTC()
+	var to time.Time = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if params.To != "" {
+		to, err = time.Parse(aggregates.MonthFormat, params.To)
+		if err != nil {
+			api.RequestErrorHandler(w, fmt.Errorf("to must be a month like 2006-01"))
+			return
+		}
+	}
+
+	var from time.Time = to.AddDate(0, 1-defaultAggregateMonths, 0)
+	if params.From != "" {
+		from, err = time.Parse(aggregates.MonthFormat, params.From)
+		if err != nil {
+			api.RequestErrorHandler(w, fmt.Errorf("from must be a month like 2006-01"))
+			return
+		}
+	}
+
+	if from.After(to) {
+		api.RequestErrorHandler(w, fmt.Errorf("from must not be after to"))
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	var months = []api.MonthlyAggregate{}
+	for _, month := range aggregates.Months(*database, username, from, to) {
+		months = append(months, api.MonthlyAggregate(month))
+	}
+
+	var response = api.AccountAggregatesResponse{
+		Code:     http.StatusOK,
+		Username: username,
+		Currency: api.Currency,
+		Months:   months,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// A comment line goes out this often, so proxies don't close an idle stream
+const eventHeartbeat = 15 * time.Second
+
+var errInvalidLastEventID = errors.New("invalid Last-Event-ID, send the id of the last event received")
+
+var errStreamingUnsupported = errors.New("the storage backend can't stream transactions")
+
+// Closed by CloseStreams, ending every open event stream and wallet socket
+var (
+	streamsClosed    = make(chan struct{})
+	closeStreamsOnce sync.Once
+)
+
+// CloseStreams ends every event stream and wallet socket, so graceful shutdown doesn't
+// wait on them. Clients reconnect to another instance, streams with Last-Event-ID.
+func CloseStreams() {
+	closeStreamsOnce.Do(func() { close(streamsClosed) })
+}
+
+// GetAccountEvents streams the caller's ledger entries as server-sent events as they
+// are logged. With Last-Event-ID the entries after that sequence number still in the
+// history are sent first.
+func GetAccountEvents(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.AccountEventParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var after int64
+	var lastEventID string = r.Header.Get("Last-Event-ID")
+	if lastEventID != "" {
+		after, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || after < 0 {
+			api.RequestErrorHandler(w, errInvalidLastEventID)
+			return
+		}
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+	if !(*database).Capabilities().Streaming {
+		api.NotImplementedErrorHandler(w, errStreamingUnsupported)
+		return
+	}
+	viewer, err := loadViewer(*database, username)
+	if err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+
+	// Subscribe before reading the history so nothing logged in between is missed,
+	// entries in both are skipped by sequence number
+	updates, unsubscribe := tools.Subscribe(*database, username)
+	defer unsubscribe()
+
+	var controller *http.ResponseController = http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	var send = func(tx tools.TransactionLog) error {
+		var sequence int64 = tx.SequenceFor(username)
+		if sequence <= after {
+			return nil
+		}
+		after = sequence
+
+		data, err := json.Marshal(toAPITransaction(tx, viewer))
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: transaction\ndata: %s\n\n", sequence, data)
+		return err
+	}
+
+	if lastEventID != "" {
+		for _, tx := range (*database).GetTransactionHistory(username) {
+			err = send(tx)
+			if err != nil {
+				log.Error("Failed to write event stream: ", err)
+				return
+			}
+		}
+	}
+
+	// Tell the client how long to wait before reconnecting
+	_, err = fmt.Fprintf(w, "retry: %d\n\n", time.Second.Milliseconds())
+	if err == nil {
+		err = controller.Flush()
+	}
+	if err != nil {
+		log.Error("Failed to write event stream: ", err)
+		return
+	}
+
+	var heartbeat = time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-streamsClosed:
+			return
+		case tx, ok := <-updates:
+			// Closed when the client fell behind, it resumes from the history
+			if !ok {
+				return
+			}
+			err = send(tx)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		if err == nil {
+			err = controller.Flush()
+		}
+		if err != nil {
+			// Headers are already sent, all we can do is stop
+			log.Error("Failed to write event stream: ", err)
+			return
+		}
+	}
+}
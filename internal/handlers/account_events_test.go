@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// sseEvent is one event read off a stream, comments are skipped
+type sseEvent struct {
+	id   string
+	name string
+	data string
+}
+
+func readEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	var event sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Stream ended early: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event.name != "":
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestAccountEvents(t *testing.T) {
+	logins, coins := tools.DemoAccounts()
+	database, err := tools.NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	var server = httptest.NewServer(New(*database))
+	defer server.Close()
+
+	// Sequences 1 to 3 for aaron
+	for i := 0; i < 3; i++ {
+		(*database).TransferUserCoins("aaron", "bryan", 10)
+	}
+
+	open := func(t *testing.T, lastEventID string) *bufio.Reader {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/account/events?username=aaron", nil)
+		req.Header.Set("Authorization", "1")
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		// Cuts off a stream that never sends what the test waits for
+		var client = &http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to open the stream: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		return bufio.NewReader(resp.Body)
+	}
+
+	t.Run("Resumes_After_Last_Event_ID_Then_Streams", func(t *testing.T) {
+		var reader = open(t, "1")
+		for _, id := range []string{"2", "3"} {
+			if event := readEvent(t, reader); event.id != id {
+				t.Fatalf("Expected event %s from the history, got %+v", id, event)
+			}
+		}
+
+		// The subscription is in place once the replay is written
+		(*database).TransferUserCoins("bryan", "aaron", 5)
+
+		var event = readEvent(t, reader)
+		var tx api.Transaction
+		if err := json.Unmarshal([]byte(event.data), &tx); err != nil {
+			t.Fatalf("Failed to decode %q: %v", event.data, err)
+		}
+		if event.id != "4" || event.name != "transaction" || tx.From != "bryan" || tx.Amount != 5 || tx.Sequence != 4 {
+			t.Errorf("Unexpected live event %+v, %+v", event, tx)
+		}
+	})
+
+	t.Run("Bad_Last_Event_ID_Refused", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/account/events?username=aaron", nil)
+		req.Header.Set("Authorization", "1")
+		req.Header.Set("Last-Event-ID", "abc")
+		w := httptest.NewRecorder()
+		New(*database).ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
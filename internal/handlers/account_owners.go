@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+var errNotHolder = errors.New("only the account holder can do this, not a co-owner")
+
+// refuseCoOwner writes a 403 and returns true if a co-owner, not the holder, is acting
+// on the account
+func refuseCoOwner(w http.ResponseWriter, r *http.Request) bool {
+	principal, _ := auth.From(r.Context())
+	if principal.Holder() {
+		return false
+	}
+	log.Error("Refused co-owner ", principal.Owner, " of ", principal.Username, ": ", r.Method, " ", r.URL.Path)
+	api.ForbiddenErrorHandler(w, errNotHolder)
+	return true
+}
+
+func toAPIAccountOwner(owner tools.AccountOwner) api.AccountOwner {
+	return api.AccountOwner{
+		Owner:      owner.Owner,
+		Permission: owner.Permission,
+		AddedAt:    owner.AddedAt,
+	}
+}
+
+// ListAccountOwners lists the co-owners of the account, the holder and co-owners can see them
+func ListAccountOwners(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.AccountOwnerListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	owners, err := (*database).GetAccountOwners(username)
+	if err != nil {
+		log.Error("Failed to read owners of ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.AccountOwnerListResponse{
+		Code:    http.StatusOK,
+		Account: username,
+		Owners:  []api.AccountOwner{},
+	}
+	for _, owner := range owners {
+		response.Owners = append(response.Owners, toAPIAccountOwner(owner))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// SetAccountOwner adds a co-owner to the holder's account or changes their permission
+func SetAccountOwner(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.AccountOwnerParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	if refuseCoOwner(w, r) {
+		return
+	}
+
+	if params.Permission != tools.OwnerView && params.Permission != tools.OwnerTransact {
+		api.RequestErrorHandler(w, fmt.Errorf("permission must be %q or %q", tools.OwnerView, tools.OwnerTransact))
+		return
+	}
+	if params.Owner == "" || params.Owner == username {
+		api.RequestErrorHandler(w, fmt.Errorf("owner must be another account"))
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	// Admins and auditors already reach every account through their own routes
+	var login *tools.LoginDetails = (*database).GetUserLoginDetails(params.Owner)
+	if login == nil {
+		api.NotFoundErrorHandler(w, tools.ErrUserNotFound)
+		return
+	}
+	if login.Role != tools.RoleUser {
+		api.RequestErrorHandler(w, fmt.Errorf("only user accounts can be co-owners"))
+		return
+	}
+
+	var owner = tools.AccountOwner{
+		Account:    username,
+		Owner:      params.Owner,
+		Permission: params.Permission,
+		AddedAt:    time.Now(),
+	}
+	err = (*database).SetAccountOwner(owner)
+	if err != nil {
+		log.Error("Failed to set owner ", params.Owner, " of ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	events.Record(*database, events.AccountOwnerChanged, username, map[string]interface{}{
+		"owner":      owner.Owner,
+		"permission": owner.Permission,
+	})
+
+	var response = api.AccountOwnerResponse{
+		Code:  http.StatusOK,
+		Owner: toAPIAccountOwner(owner),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// RemoveAccountOwner takes a co-owner off the holder's account, their next request
+// with it is refused
+func RemoveAccountOwner(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.AccountOwnerRemoveParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	if refuseCoOwner(w, r) {
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	err = (*database).RemoveAccountOwner(username, params.Owner)
+	if err != nil {
+		log.Error("Failed to remove owner ", params.Owner, " of ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	events.Record(*database, events.AccountOwnerChanged, username, map[string]interface{}{
+		"owner":      params.Owner,
+		"permission": "",
+	})
+
+	var response = api.MessageResponse{
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf("Owner %s removed.", params.Owner),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
@@ -2,22 +2,28 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/events"
 	"github.com/bryantjandra/goapi/internal/tools"
-	"github.com/gorilla/schema"
 	log "github.com/sirupsen/logrus"
 )
 
 func AddCoins(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
 	//parse params
 	var params = api.CoinAdditionParams{}
-	var decoder *schema.Decoder = schema.NewDecoder()
-
-	var err error = decoder.Decode(&params, r.URL.Query())
+	var err error = decodeMutation(w, r, &params)
 
+	if errors.Is(err, errUnsupportedMediaType) {
+		log.Error("Failed to parse request body: ", err)
+		api.UnsupportedMediaTypeErrorHandler(w, err)
+		return
+	}
 	if err != nil {
 		log.Error("Failed to parse request parameters: ", err)
 		api.RequestErrorHandler(w, err)
@@ -26,7 +32,7 @@ func AddCoins(w http.ResponseWriter, r *http.Request) {
 
 	//connect to DB
 	var database *tools.DatabaseInterface
-	database, err = tools.NewDatabase()
+	database, err = tools.OpenDatabase(r.Context())
 	if err != nil {
 		log.Error("Failed to connect to database: ", err)
 		api.InternalErrorHandler(w)
@@ -39,15 +45,21 @@ func AddCoins(w http.ResponseWriter, r *http.Request) {
 		api.RequestErrorHandler(w, fmt.Errorf("amount must be positive"))
 		return
 	}
+	var amount int64 = int64(params.Amount)
 
 	//update the coin balance
-	var updatedCoinBalance *tools.CoinDetails = (*database).AddUserCoins(params.Username, params.Amount)
-	if updatedCoinBalance == nil {
-		log.Error("Failed to add coins for user: ", params.Username)
-		api.RequestErrorHandler(w, fmt.Errorf("user not found or invalid amount"))
+	updatedCoinBalance, err := (*database).AddUserCoins(username, amount)
+	if err != nil {
+		log.Error("Failed to add coins for user: ", username, ": ", err)
+		storageErrorHandler(w, err)
 		return
 	}
 
+	events.Record(*database, events.DepositCompleted, username, map[string]interface{}{
+		"amount":  amount,
+		"balance": updatedCoinBalance.Coins,
+	})
+
 	//return the response
 	var response api.CoinAdditionResponse = api.CoinAdditionResponse{
 		Code:    http.StatusOK,
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/reconcile"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultAuditDiffDays = 30
+
+// parseDiffBound reads an RFC 3339 time, or a date standing for the start of the day,
+// or its end with endOfDay
+func parseDiffBound(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// GetAuditDiff shows how an account's balance changed between two points in time, one
+// ledger entry at a time, for answering "where did my coins go"
+func GetAuditDiff(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.AuditDiffParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var to time.Time = time.Now().UTC()
+	if params.To != "" {
+		to, err = parseDiffBound(params.To, true)
+		if err != nil {
+			api.RequestErrorHandler(w, fmt.Errorf("to must be an RFC 3339 time or a date like 2006-01-02"))
+			return
+		}
+	}
+
+	var from time.Time = to.AddDate(0, 0, -defaultAuditDiffDays)
+	if params.From != "" {
+		from, err = parseDiffBound(params.From, false)
+		if err != nil {
+			api.RequestErrorHandler(w, fmt.Errorf("from must be an RFC 3339 time or a date like 2006-01-02"))
+			return
+		}
+	}
+
+	if from.After(to) {
+		api.RequestErrorHandler(w, fmt.Errorf("from must not be after to"))
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	var account string = chi.URLParam(r, "username")
+	diff, err := reconcile.AuditDiff(*database, account, from, to)
+	if errors.Is(err, tools.ErrUserNotFound) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, reconcile.ErrBusyAccount) {
+		api.ConflictErrorHandler(w, err)
+		return
+	}
+	log.Info("Audit diff of ", account, " from ", from, " to ", to, " requested by ", username)
+
+	var changes = make([]api.BalanceChange, 0, len(diff.Changes))
+	for _, change := range diff.Changes {
+		changes = append(changes, api.BalanceChange(change))
+	}
+
+	var response = api.AuditDiffResponse{
+		Code:         http.StatusOK,
+		Account:      account,
+		From:         diff.From,
+		To:           diff.To,
+		StartBalance: diff.StartBalance,
+		EndBalance:   diff.EndBalance,
+		Net:          diff.Net,
+		Changes:      changes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/audit"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+func ExportAudit(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.AuditExportParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	if params.Account == "" {
+		api.RequestErrorHandler(w, fmt.Errorf("account is required"))
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	var signer *audit.Signer
+	var timestamper audit.Timestamper
+	if params.Signed {
+		var cfg config.Config = config.Get()
+		if cfg.AuditSigningKey == "" {
+			log.Error("Signed audit export requested but AUDIT_SIGNING_KEY is not set")
+			api.RequestErrorHandler(w, fmt.Errorf("signed exports are not configured"))
+			return
+		}
+
+		signer, err = audit.NewSigner(cfg.AuditSigningKey)
+		if err != nil {
+			log.Error("Failed to load audit signing key: ", err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		if cfg.AuditTimestampURL != "" {
+			timestamper = &audit.HTTPTimestamper{URL: cfg.AuditTimestampURL}
+		}
+	}
+
+	var entries []tools.TransactionLog = (*database).GetTransactionHistory(params.Account)
+
+	export, err := audit.BuildExport(r.Context(), params.Account, entries, signer, timestamper)
+	if err != nil {
+		log.Error("Failed to build audit export: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	log.Info("Audit export of ", params.Account, " (", len(entries), " entries, signed: ", params.Signed, ") requested by ", username)
+
+	var apiEntries = make([]api.AuditEntry, 0, len(export.Entries))
+	for _, entry := range export.Entries {
+		apiEntries = append(apiEntries, api.AuditEntry(entry))
+	}
+
+	var response = api.AuditExport{
+		Code:           http.StatusOK,
+		Account:        export.Account,
+		GeneratedAt:    export.GeneratedAt,
+		Entries:        apiEntries,
+		Digest:         export.Digest,
+		Signature:      export.Signature,
+		PublicKey:      export.PublicKey,
+		TimestampToken: export.TimestampToken,
+		TimestampedBy:  export.TimestampedBy,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
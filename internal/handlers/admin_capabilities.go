@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+func toAPICapabilities(capabilities tools.Capabilities) api.Capabilities {
+	return api.Capabilities{
+		Durable:      capabilities.Durable,
+		Transactions: capabilities.Transactions,
+		TimeTravel:   capabilities.TimeTravel,
+		Streaming:    capabilities.Streaming,
+		Snapshots:    capabilities.Snapshots,
+		StaleReads:   capabilities.StaleReads,
+	}
+}
+
+// GetCapabilities reports which optional features the storage backend supports
+func GetCapabilities(w http.ResponseWriter, r *http.Request) {
+	var params = api.CapabilityParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	var response = api.CapabilityResponse{
+		Code:         http.StatusOK,
+		Driver:       config.Get().DatabaseDriver,
+		Capabilities: toAPICapabilities((*database).Capabilities()),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
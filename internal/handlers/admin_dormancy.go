@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/dormancy"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+func toAPISweep(sweep dormancy.Sweep) api.Sweep {
+	var items = make([]api.SweepItem, 0, len(sweep.Items))
+	for _, item := range sweep.Items {
+		apiItem := api.SweepItem{
+			Account:    item.Account,
+			Amount:     item.Amount,
+			Status:     item.Status,
+			Detail:     item.Detail,
+			ReversedBy: item.ReversedBy,
+		}
+		if !item.ReversedAt.IsZero() {
+			reversedAt := item.ReversedAt
+			apiItem.ReversedAt = &reversedAt
+		}
+		items = append(items, apiItem)
+	}
+
+	var result = api.Sweep{
+		ID:         sweep.ID,
+		To:         sweep.To,
+		Status:     sweep.Status,
+		ProposedBy: sweep.ProposedBy,
+		ProposedAt: sweep.ProposedAt,
+		ApprovedBy: sweep.ApprovedBy,
+		Items:      items,
+	}
+	if !sweep.ApprovedAt.IsZero() {
+		approvedAt := sweep.ApprovedAt
+		result.ApprovedAt = &approvedAt
+	}
+	return result
+}
+
+func writeSweep(w http.ResponseWriter, sweep dormancy.Sweep, err error) {
+	if errors.Is(err, dormancy.ErrSweepNotFound) || errors.Is(err, dormancy.ErrNotSwept) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, dormancy.ErrSweepNotPending) {
+		api.ConflictErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Escheatment sweep rejected: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var response = api.SweepResponse{
+		Code:  http.StatusOK,
+		Sweep: toAPISweep(sweep),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// GetDormancyReport lists dormant and sweepable accounts
+func GetDormancyReport(w http.ResponseWriter, r *http.Request) {
+	var params = api.DormancyParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	var accounts = []api.DormantAccount{}
+	err = dormancy.Scan(r.Context(), *database, dormancy.CurrentPolicy(), time.Now(), func(account dormancy.Account) error {
+		if account.Status != dormancy.StatusActive {
+			accounts = append(accounts, api.DormantAccount(account))
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("Dormancy scan failed: ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.DormancyResponse{
+		Code:     http.StatusOK,
+		Accounts: accounts,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+func ListSweeps(w http.ResponseWriter, r *http.Request) {
+	var params = api.SweepParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var sweeps = []api.Sweep{}
+	for _, sweep := range dormancy.Sweeps() {
+		sweeps = append(sweeps, toAPISweep(sweep))
+	}
+
+	var response = api.SweepListResponse{
+		Code:   http.StatusOK,
+		Sweeps: sweeps,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// ProposeSweep lists what would be swept, nothing moves until it is approved
+func ProposeSweep(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.SweepParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	sweep, err := dormancy.Propose(*database, dormancy.CurrentPolicy(), username)
+	if err != nil && !errors.Is(err, dormancy.ErrInvalidSweep) {
+		log.Error("Escheatment sweep could not read the accounts: ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+	writeSweep(w, sweep, err)
+}
+
+func ApproveSweep(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.SweepParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	sweep, err := dormancy.Approve(*database, dormancy.CurrentPolicy(), chi.URLParam(r, "id"), username)
+	writeSweep(w, sweep, err)
+}
+
+func ReverseSweep(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.SweepReverseParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	sweep, err := dormancy.Reverse(*database, chi.URLParam(r, "id"), params.Account, username, params.Reason)
+	writeSweep(w, sweep, err)
+}
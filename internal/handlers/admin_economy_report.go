@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/service"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultEconomyReportDays = 30
+
+func GetEconomyReport(w http.ResponseWriter, r *http.Request) {
+	var params = api.EconomyReportParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var to time.Time = time.Now().UTC()
+	if params.To != "" {
+		to, err = time.Parse(time.DateOnly, params.To)
+		if err != nil {
+			api.RequestErrorHandler(w, fmt.Errorf("to must be a date like 2006-01-02"))
+			return
+		}
+	}
+	// Include the whole end day
+	to = to.Truncate(24 * time.Hour).Add(24*time.Hour - time.Nanosecond)
+
+	var from time.Time = to.AddDate(0, 0, -defaultEconomyReportDays).Add(time.Nanosecond)
+	if params.From != "" {
+		from, err = time.Parse(time.DateOnly, params.From)
+		if err != nil {
+			api.RequestErrorHandler(w, fmt.Errorf("from must be a date like 2006-01-02"))
+			return
+		}
+	}
+
+	if from.After(to) {
+		api.RequestErrorHandler(w, fmt.Errorf("from must not be after to"))
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	var days = []api.EconomyDay{}
+	for _, day := range service.New(*database).EconomyReport(from, to) {
+		days = append(days, api.EconomyDay(day))
+	}
+
+	var response = api.EconomyReportResponse{
+		Code: http.StatusOK,
+		Days: days,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/features"
+	log "github.com/sirupsen/logrus"
+)
+
+// experiments returns the configured experiments sorted by name
+func experiments() []features.Experiment {
+	var result []features.Experiment
+	for name, percent := range config.Get().Experiments {
+		result = append(result, features.Experiment{Name: name, Percent: percent})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// GetExperiments reports each running experiment with per-bucket request metrics
+func GetExperiments(w http.ResponseWriter, r *http.Request) {
+	var params = api.ExperimentsParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var metrics = features.Metrics()
+
+	var result = []api.Experiment{}
+	for _, experiment := range experiments() {
+		var buckets = map[string]api.ExperimentBucket{
+			features.Control:   {},
+			features.Treatment: {},
+		}
+		for bucket, counts := range metrics[experiment.Name] {
+			buckets[bucket] = api.ExperimentBucket(counts)
+		}
+
+		result = append(result, api.Experiment{
+			Name:    experiment.Name,
+			Percent: experiment.Percent,
+			Buckets: buckets,
+		})
+	}
+
+	var response = api.ExperimentsResponse{
+		Code:        http.StatusOK,
+		Experiments: result,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
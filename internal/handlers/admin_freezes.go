@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/freezes"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+func toAPIFreeze(freeze freezes.Freeze) api.Freeze {
+	var history = make([]api.FreezeChange, 0, len(freeze.History))
+	for _, change := range freeze.History {
+		history = append(history, api.FreezeChange(change))
+	}
+
+	return api.Freeze{
+		ID:      freeze.ID,
+		Account: freeze.Account,
+		Amount:  freeze.Amount,
+		Reason:  freeze.Reason,
+		Active:  freeze.Active,
+		History: history,
+	}
+}
+
+// writeFreeze records the change as a domain event and returns the freeze
+func writeFreeze(w http.ResponseWriter, database tools.DatabaseInterface, freeze freezes.Freeze, err error) {
+	if errors.Is(err, freezes.ErrNotFound) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, freezes.ErrLifted) {
+		api.ConflictErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, freezes.ErrInvalidFreeze) {
+		log.Error("Freeze change rejected: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to store freeze change: ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var change freezes.Change = freeze.History[len(freeze.History)-1]
+	log.Info("Freeze ", freeze.ID, " on ", freeze.Account, " ", change.Action, " by ", change.By, ": ", change.Amount, " (", change.Reason, ")")
+
+	events.Record(database, events.FreezeChanged, freeze.Account, map[string]interface{}{
+		"freeze_id": freeze.ID,
+		"action":    change.Action,
+		"amount":    change.Amount,
+		"reason":    change.Reason,
+		"by":        change.By,
+	})
+
+	var response = api.FreezeResponse{
+		Code:   http.StatusOK,
+		Freeze: toAPIFreeze(freeze),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+func ListFreezes(w http.ResponseWriter, r *http.Request) {
+	var params = api.FreezeListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	list, err := freezes.List(*database, params.Account)
+	if err != nil {
+		log.Error("Failed to read freezes: ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var result = []api.Freeze{}
+	for _, freeze := range list {
+		result = append(result, toAPIFreeze(freeze))
+	}
+
+	var response = api.FreezeListResponse{
+		Code:    http.StatusOK,
+		Freezes: result,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+func PlaceFreeze(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.FreezeParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	if _, err = (*database).GetUserCoins(params.Account); err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+
+	freeze, err := freezes.Place(*database, params.Account, int64(params.Amount), params.Reason, username)
+	writeFreeze(w, *database, freeze, err)
+}
+
+func AdjustFreeze(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.FreezeParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	freeze, err := freezes.Adjust(*database, chi.URLParam(r, "id"), int64(params.Amount), params.Reason, username)
+	writeFreeze(w, *database, freeze, err)
+}
+
+func LiftFreeze(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.FreezeLiftParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	freeze, err := freezes.Lift(*database, chi.URLParam(r, "id"), params.Reason, username)
+	writeFreeze(w, *database, freeze, err)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/lockout"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+func ListLockouts(w http.ResponseWriter, r *http.Request) {
+	var params = api.LockoutListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var lockouts = []api.Lockout{}
+	for _, lock := range lockout.Locked(tools.AttachedDatabase(r.Context())) {
+		lockouts = append(lockouts, api.Lockout{
+			Kind:        lock.Kind,
+			Value:       lock.Value,
+			Failures:    lock.Failures,
+			LockedUntil: lock.LockedUntil,
+		})
+	}
+
+	var response = api.LockoutListResponse{
+		Code:     http.StatusOK,
+		Lockouts: lockouts,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// RemoveLockout unlocks one account or client IP and resets its failure count
+func RemoveLockout(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.LockoutRemoveParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var key lockout.Key
+	switch {
+	case params.Account != "" && params.IP == "":
+		key = lockout.Username(params.Account)
+	case params.IP != "" && params.Account == "":
+		key = lockout.IP(params.IP)
+	default:
+		api.RequestErrorHandler(w, errors.New("exactly one of account or ip is required"))
+		return
+	}
+
+	if !lockout.Unlock(tools.AttachedDatabase(r.Context()), key, username) {
+		api.NotFoundErrorHandler(w, fmt.Errorf("no lockout for %s %s", key.Kind, key.Value))
+		return
+	}
+
+	var response = api.MessageResponse{
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf("Unlocked %s %s.", key.Kind, key.Value),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/policy"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+func GetPolicies(w http.ResponseWriter, r *http.Request) {
+	var response = api.PolicyResponse{
+		Code:   http.StatusOK,
+		Policy: toAPIPolicy(policy.Current(tools.AttachedDatabase(r.Context()))),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+func GetPolicyHistory(w http.ResponseWriter, r *http.Request) {
+	var history []api.PolicyDocument
+	for _, doc := range policy.History(tools.AttachedDatabase(r.Context())) {
+		history = append(history, toAPIPolicy(doc))
+	}
+
+	var response = api.PolicyHistoryResponse{
+		Code:    http.StatusOK,
+		History: history,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+func UpdatePolicies(w http.ResponseWriter, r *http.Request) {
+	var params api.PolicyDocument
+	var err error = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		log.Error("Failed to parse policy document: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var admin string = auth.UserFrom(r.Context())
+
+	updated, err := policy.Update(tools.AttachedDatabase(r.Context()), fromAPIPolicy(params), admin)
+	if errors.Is(err, policy.ErrVersionConflict) {
+		log.Error("Policy update rejected for ", admin, ": ", err)
+		api.ConflictErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Policy update rejected for ", admin, ": ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	events.Record(tools.AttachedDatabase(r.Context()), events.LimitChanged, admin, map[string]interface{}{
+		"version": updated.Version,
+	})
+
+	var response = api.PolicyResponse{
+		Code:   http.StatusOK,
+		Policy: toAPIPolicy(updated),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+func toAPIPolicy(doc policy.Document) api.PolicyDocument {
+	limits := make(map[string]map[string]api.PolicyLimits, len(doc.Limits))
+	for currency, tiers := range doc.Limits {
+		limits[currency] = make(map[string]api.PolicyLimits, len(tiers))
+		for tier, l := range tiers {
+			limits[currency][tier] = api.PolicyLimits(l)
+		}
+	}
+
+	return api.PolicyDocument{
+		Version:    doc.Version,
+		Limits:     limits,
+		PairLimits: api.PolicyPairLimits(doc.PairLimits),
+		Probation:  api.PolicyProbation(doc.Probation),
+		UpdatedBy:  doc.UpdatedBy,
+		UpdatedAt:  doc.UpdatedAt,
+	}
+}
+
+func fromAPIPolicy(doc api.PolicyDocument) policy.Document {
+	limits := make(map[string]map[string]policy.Limits, len(doc.Limits))
+	for currency, tiers := range doc.Limits {
+		limits[currency] = make(map[string]policy.Limits, len(tiers))
+		for tier, l := range tiers {
+			limits[currency][tier] = policy.Limits(l)
+		}
+	}
+
+	return policy.Document{
+		Version:    doc.Version,
+		Limits:     limits,
+		PairLimits: policy.PairLimits(doc.PairLimits),
+		Probation:  policy.Probation(doc.Probation),
+	}
+}
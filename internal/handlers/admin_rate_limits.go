@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/middleware"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+func ListRateLimits(w http.ResponseWriter, r *http.Request) {
+	var params = api.RateLimitListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var buckets = []api.RateLimitBucket{}
+	if params.Account == "" {
+		for _, bucket := range middleware.RateLimitBuckets(tools.AttachedDatabase(r.Context()), params.IP) {
+			buckets = append(buckets, api.RateLimitBucket{
+				Scope:   bucket.Scope,
+				IP:      bucket.IP,
+				Count:   bucket.Count,
+				Limit:   bucket.Limit,
+				ResetAt: bucket.ResetAt,
+			})
+		}
+	}
+
+	requestBuckets, err := middleware.RequestRateLimitBuckets(r.Context(), params.Account, params.IP)
+	if err != nil {
+		log.Error("Failed to read request rate limits: ", err)
+		api.ServiceUnavailableErrorHandler(w, err)
+		return
+	}
+	for _, bucket := range requestBuckets {
+		buckets = append(buckets, api.RateLimitBucket{
+			Scope:   middleware.RequestRateLimitScope,
+			IP:      bucket.IP,
+			Account: bucket.Account,
+			Route:   bucket.Route,
+			Count:   bucket.Limit - bucket.Remaining,
+			Limit:   bucket.Limit,
+			ResetAt: bucket.FullAt,
+		})
+	}
+
+	var response = api.RateLimitListResponse{
+		Code:    http.StatusOK,
+		Buckets: buckets,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// ClearRateLimits lets a client stuck behind its own retry loop back in straight away
+func ClearRateLimits(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.RateLimitClearParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	if params.IP == "" && params.Account == "" {
+		api.RequestErrorHandler(w, errors.New("ip or account is required"))
+		return
+	}
+
+	var cleared int
+	if params.IP != "" && params.Scope != middleware.RequestRateLimitScope {
+		cleared = middleware.ClearRateLimit(tools.AttachedDatabase(r.Context()), params.Scope, params.IP, username)
+	}
+	if params.Scope == "" || params.Scope == middleware.RequestRateLimitScope {
+		requestCleared, err := middleware.ClearRequestRateLimit(r.Context(), params.Account, params.IP, "", username)
+		if err != nil {
+			log.Error("Failed to clear request rate limits: ", err)
+			api.ServiceUnavailableErrorHandler(w, err)
+			return
+		}
+		cleared += requestCleared
+	}
+
+	var client string = strings.TrimSpace(params.Account + " " + params.IP)
+	if cleared == 0 {
+		api.NotFoundErrorHandler(w, fmt.Errorf("no rate limit window or bucket for %s", client))
+		return
+	}
+
+	events.Record(tools.AttachedDatabase(r.Context()), events.RateLimitCleared, username, map[string]interface{}{
+		"ip":      params.IP,
+		"account": params.Account,
+		"scope":   params.Scope,
+		"cleared": cleared,
+	})
+
+	var response = api.MessageResponse{
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf("Cleared %d rate limit window(s) and bucket(s) for %s.", cleared, client),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
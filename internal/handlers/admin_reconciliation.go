@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/reconcile"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+// RunReconciliation runs the double-entry checks now and returns the report
+func RunReconciliation(w http.ResponseWriter, r *http.Request) {
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	report := reconcile.Run(*database)
+
+	var discrepancies = make([]api.ReconciliationDiscrepancy, 0, len(report.Discrepancies))
+	for _, discrepancy := range report.Discrepancies {
+		discrepancies = append(discrepancies, api.ReconciliationDiscrepancy(discrepancy))
+	}
+
+	var response = api.ReconciliationReport{
+		Code:                http.StatusOK,
+		GeneratedAt:         report.GeneratedAt,
+		TransactionsChecked: report.TransactionsChecked,
+		PostingsChecked:     report.PostingsChecked,
+		AccountsChecked:     report.AccountsChecked,
+		Discrepancies:       discrepancies,
+		OK:                  report.OK,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// RepairAccount recomputes one account's balance from the ledger. With confirm=true a
+// difference is corrected so the stored balance matches the ledger.
+func RepairAccount(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.AccountRepairParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	var account string = chi.URLParam(r, "username")
+	check, err := reconcile.CheckAccount(*database, account)
+	if errors.Is(err, tools.ErrUserNotFound) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+
+	var response = api.AccountRepairResponse{
+		Code:            http.StatusOK,
+		Account:         account,
+		Stored:          check.Stored,
+		Derived:         check.Derived,
+		Difference:      check.Difference,
+		PostingsChecked: check.PostingsChecked,
+		Consistent:      check.Consistent,
+		Balance:         check.Stored,
+	}
+
+	if !check.Consistent {
+		log.WithFields(log.Fields{
+			"account":    account,
+			"stored":     check.Stored,
+			"derived":    check.Derived,
+			"difference": check.Difference,
+			"confirm":    params.Confirm,
+			"by":         username,
+		}).Warn("Account balance differs from the ledger")
+	}
+
+	if params.Confirm && !check.Consistent {
+		details, err := reconcile.RepairAccount(*database, check)
+		if errors.Is(err, reconcile.ErrNoLedgerHistory) || errors.Is(err, tools.ErrStaleVersion) {
+			api.ConflictErrorHandler(w, err)
+			return
+		}
+		if err != nil {
+			log.Error("Failed to repair account ", account, ": ", err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		response.Applied = true
+		response.Balance = details.Coins
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/runbooks"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+func toAPIRunbookRun(run runbooks.Run) api.RunbookRun {
+	var steps = make([]api.RunbookStepProgress, 0, len(run.Steps))
+	for _, step := range run.Steps {
+		steps = append(steps, api.RunbookStepProgress{
+			Name:       step.Name,
+			Status:     step.Status,
+			Error:      step.Error,
+			StartedAt:  optionalTime(step.StartedAt),
+			FinishedAt: optionalTime(step.FinishedAt),
+		})
+	}
+
+	return api.RunbookRun{
+		ID:         run.ID,
+		Runbook:    run.Runbook,
+		Status:     run.Status,
+		Error:      run.Error,
+		StartedBy:  run.StartedBy,
+		Reason:     run.Reason,
+		Params:     run.Params,
+		StartedAt:  run.StartedAt,
+		FinishedAt: optionalTime(run.FinishedAt),
+		Steps:      steps,
+		Result:     run.Result,
+	}
+}
+
+// optionalTime is nil for the zero time, so unset times are null in responses
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func writeRunbookRun(w http.ResponseWriter, status int, run runbooks.Run) {
+	var response = api.RunbookRunResponse{
+		Code: status,
+		Run:  toAPIRunbookRun(run),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	var err error = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		return
+	}
+}
+
+// ListRunbooks lists what can be run and the recent runs
+func ListRunbooks(w http.ResponseWriter, r *http.Request) {
+	var params = api.RunbookListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var response = api.RunbookListResponse{
+		Code:         http.StatusOK,
+		WritesPaused: runbooks.Paused(),
+		Runbooks:     []api.Runbook{},
+		Runs:         []api.RunbookRun{},
+	}
+	for _, runbook := range runbooks.Runbooks() {
+		var steps = make([]api.RunbookStep, 0, len(runbook.Steps))
+		for _, step := range runbook.Steps {
+			steps = append(steps, api.RunbookStep(step))
+		}
+		response.Runbooks = append(response.Runbooks, api.Runbook{Name: runbook.Name, Description: runbook.Description, Steps: steps})
+	}
+	for _, run := range runbooks.Runs() {
+		response.Runs = append(response.Runs, toAPIRunbookRun(run))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// StartRunbook starts a run and answers 202 at once, poll GetRunbookRun for progress
+func StartRunbook(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.RunbookParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	if params.Reason == "" {
+		api.RequestErrorHandler(w, fmt.Errorf("reason is required, it is kept with the run"))
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	var runParams = map[string]string{}
+	if params.Snapshot != "" {
+		runParams["snapshot"] = params.Snapshot
+	}
+	run, err := runbooks.Start(*database, chi.URLParam(r, "name"), username, params.Reason, runParams)
+	switch {
+	case errors.Is(err, runbooks.ErrRunbookNotFound):
+		api.NotFoundErrorHandler(w, err)
+		return
+	case errors.Is(err, runbooks.ErrRunInProgress):
+		api.ConflictErrorHandler(w, err)
+		return
+	case err != nil:
+		log.Error("Failed to start runbook: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	w.Header().Set("Location", "/admin/runbooks/runs/"+run.ID)
+	writeRunbookRun(w, http.StatusAccepted, run)
+}
+
+func GetRunbookRun(w http.ResponseWriter, r *http.Request) {
+	var params = api.RunbookRunParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	run, err := runbooks.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+	writeRunbookRun(w, http.StatusOK, run)
+}
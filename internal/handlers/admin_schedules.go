@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/scheduler"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListSchedules shows when each recurring job runs next and which runs it missed
+func ListSchedules(w http.ResponseWriter, r *http.Request) {
+	var params = api.ScheduleListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var schedules = []api.Schedule{}
+	for _, job := range scheduler.Jobs() {
+		var schedule = api.Schedule{
+			Name:            job.Name,
+			IntervalSeconds: int64(job.Interval.Seconds()),
+			NextRunAt:       job.NextRunAt,
+			Upcoming:        job.Upcoming(3),
+			Missed:          []api.MissedRun{},
+		}
+		if !job.LastRunAt.IsZero() {
+			lastRunAt := job.LastRunAt
+			schedule.LastRunAt = &lastRunAt
+		}
+		for _, missed := range job.Missed {
+			schedule.Missed = append(schedule.Missed, api.MissedRun{
+				ScheduledAt: missed.ScheduledAt,
+				Action:      missed.Action,
+				DetectedAt:  missed.DetectedAt,
+			})
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	var response = api.ScheduleListResponse{
+		Code:            http.StatusOK,
+		MissedRunPolicy: config.Get().SchedulerMissedRuns,
+		Schedules:       schedules,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
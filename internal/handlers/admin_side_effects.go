@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/sideeffects"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+func toAPISideEffect(effect sideeffects.Effect) api.SideEffect {
+	var result = api.SideEffect{
+		ID:        effect.ID,
+		Kind:      effect.Kind,
+		Key:       effect.Key,
+		EventID:   effect.Event.ID,
+		EventType: effect.Event.Type,
+		Attempts:  effect.Attempts,
+		LastError: effect.LastError,
+		QueuedAt:  effect.QueuedAt,
+	}
+	if !effect.DeadAt.IsZero() {
+		deadAt := effect.DeadAt
+		result.DeadAt = &deadAt
+	}
+	return result
+}
+
+// ListSideEffects reports each kind of side effect's metrics and the dead letters
+func ListSideEffects(w http.ResponseWriter, r *http.Request) {
+	var params = api.SideEffectListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var response = api.SideEffectListResponse{
+		Code:        http.StatusOK,
+		Pending:     sideeffects.Pending(),
+		Kinds:       map[string]api.SideEffectMetrics{},
+		DeadLetters: []api.SideEffect{},
+	}
+	for kind, metrics := range sideeffects.KindMetrics() {
+		var result = api.SideEffectMetrics{
+			Queued:       metrics.Queued,
+			DeadLetters:  metrics.DeadLetters,
+			Succeeded:    metrics.Succeeded,
+			Retried:      metrics.Retried,
+			DeadLettered: metrics.DeadLettered,
+			LastError:    metrics.LastError,
+		}
+		if !metrics.LastErrorAt.IsZero() {
+			lastErrorAt := metrics.LastErrorAt
+			result.LastErrorAt = &lastErrorAt
+		}
+		response.Kinds[kind] = result
+	}
+	for _, effect := range sideeffects.DeadLetters(params.Kind) {
+		response.DeadLetters = append(response.DeadLetters, toAPISideEffect(effect))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// RetrySideEffect requeues a dead letter, e.g. once its webhook endpoint is back
+func RetrySideEffect(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.SideEffectRetryParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	effect, err := sideeffects.Requeue(chi.URLParam(r, "id"), username)
+	if errors.Is(err, sideeffects.ErrNotFound) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+
+	var response = api.SideEffectResponse{
+		Code:       http.StatusAccepted,
+		SideEffect: toAPISideEffect(effect),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		return
+	}
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/freezes"
+	"github.com/bryantjandra/goapi/internal/service"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultUserPage = 100
+	maxUserPage     = 500
+)
+
+// ListUsers pages through every account in username order
+func ListUsers(w http.ResponseWriter, r *http.Request) {
+	var params = api.UserListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	if params.Limit <= 0 {
+		params.Limit = defaultUserPage
+	}
+	if params.Limit > maxUserPage {
+		params.Limit = maxUserPage
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	users, err := service.New(*database).Users(r.Context(), params.After, params.Limit)
+	if err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.UserListResponse{
+		Code:  http.StatusOK,
+		Users: make([]api.User, 0, len(users)),
+	}
+	for _, user := range users {
+		response.Users = append(response.Users, api.User(user))
+	}
+	if len(users) == params.Limit {
+		response.NextCursor = users[len(users)-1].Username
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// CreateAccount opens an account with a role and answers with its static token, the
+// only time the token is shown
+func CreateAccount(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.UserCreateParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	login, err := service.New(*database).CreateAccount(params.Account, params.Role, username)
+	switch {
+	case errors.Is(err, service.ErrInvalidUsername), errors.Is(err, service.ErrInvalidRole):
+		api.RequestErrorHandler(w, err)
+		return
+	case errors.Is(err, tools.ErrUserExists):
+		api.ConflictErrorHandler(w, fmt.Errorf("username %q is taken", params.Account))
+		return
+	case err != nil:
+		log.Error("Failed to open account ", params.Account, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.UserCreateResponse{
+		Code:      http.StatusCreated,
+		User:      api.User{Username: login.Username, Role: login.Role},
+		AuthToken: login.AuthToken,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		return
+	}
+}
+
+// writeAccountFreeze records the change as a domain event and returns the account's
+// freeze
+func writeAccountFreeze(w http.ResponseWriter, database tools.DatabaseInterface, freeze freezes.AccountFreeze, err error) {
+	if errors.Is(err, freezes.ErrFrozen) || errors.Is(err, freezes.ErrNotFrozen) {
+		api.ConflictErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, freezes.ErrInvalidFreeze) {
+		log.Error("Account freeze change rejected: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to store account freeze change: ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var change freezes.Change = freeze.History[len(freeze.History)-1]
+	log.Warn("Account ", freeze.Account, " ", change.Action, " by ", change.By, ": ", change.Reason)
+
+	events.Record(database, events.AccountFreezeChanged, freeze.Account, map[string]interface{}{
+		"action": change.Action,
+		"reason": change.Reason,
+		"by":     change.By,
+	})
+
+	var response = api.AccountFreezeResponse{
+		Code:    http.StatusOK,
+		Account: freeze.Account,
+		Frozen:  freeze.Frozen,
+		Reason:  freeze.Reason,
+		History: make([]api.FreezeChange, 0, len(freeze.History)),
+	}
+	for _, change := range freeze.History {
+		response.History = append(response.History, api.FreezeChange(change))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// FreezeAccount stops an account sending or withdrawing any coins until it is unfrozen
+func FreezeAccount(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.AccountFreezeParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	freeze, err := freezes.FreezeAccount(*database, chi.URLParam(r, "username"), params.Reason, username)
+	writeAccountFreeze(w, *database, freeze, err)
+}
+
+func UnfreezeAccount(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.AccountFreezeParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	freeze, err := freezes.UnfreezeAccount(*database, chi.URLParam(r, "username"), params.Reason, username)
+	writeAccountFreeze(w, *database, freeze, err)
+}
+
+// AdjustBalance credits or debits an account outside the usual limits and checks, for
+// corrections. The reason is required and goes into the audit trail.
+func AdjustBalance(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.BalanceAdjustmentParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	var account string = chi.URLParam(r, "username")
+	details, err := service.New(*database).AdjustBalance(account, int64(params.Amount), params.Reason, username)
+	switch {
+	case errors.Is(err, service.ErrInvalidAdjustment):
+		api.RequestErrorHandler(w, err)
+		return
+	case err != nil:
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.BalanceAdjustmentResponse{
+		Code:    http.StatusOK,
+		Account: account,
+		Amount:  int64(params.Amount),
+		Balance: details.Coins,
+		Reason:  params.Reason,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
@@ -1,23 +1,283 @@
 package handlers
 
 import (
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
 	"github.com/bryantjandra/goapi/internal/middleware"
+	"github.com/bryantjandra/goapi/internal/tools"
 	"github.com/go-chi/chi"
 	chimiddle "github.com/go-chi/chi/middleware"
 )
 
+// New builds a router that serves every request from database. The global middleware
+// run first, in order, ahead of everything Handler adds.
+func New(database tools.DatabaseInterface, global ...func(http.Handler) http.Handler) *chi.Mux {
+	var r *chi.Mux = chi.NewRouter()
+	r.Use(global...)
+	r.Use(middleware.Database(database))
+	Handler(r)
+	return r
+}
+
+// Handler builds the router. Custom middleware comes from middleware.DefaultRegistry,
+// see middleware.Position for the order everything runs in.
 func Handler(r *chi.Mux) {
+	var registry *middleware.Registry = middleware.DefaultRegistry
+	registry.Freeze()
+
 	// Global Middleware
 	r.Use(chimiddle.StripSlashes)
+	r.Use(enforceRoutes(r))
+	r.Use(middleware.PostOnly(config.Get().AllowGetMutations,
+		"/account/coins/add", "/account/coins/withdraw", "/account/coins/transfer"))
+	r.Use(middleware.Experiments(experiments()))
+	r.Use(registry.Chain(middleware.BeforeAuth)...)
+
+	// Shared by /account and /admin so the global cap covers both
+	var limiter *middleware.MutationLimiter = middleware.NewMutationLimiter(
+		config.Get().MaxInFlightMutations, config.Get().MaxInFlightMutationsByRole)
+
+	// Identical coin mutations from one user within the window are refused
+	var dedup *middleware.Deduplicator = middleware.NewDeduplicator(config.Get().DedupWindow,
+		"/account/coins/add", "/account/coins/withdraw", "/account/coins/transfer")
+
+	// Token buckets per user and per client IP, also shared by every authenticated route
+	var cfg config.Config = config.Get()
+	var requests *middleware.RequestLimiter = middleware.NewRequestLimiter(middleware.NewMemoryRateLimitStore(),
+		cfg.RequestRateLimit, cfg.RequestIPRateLimit, cfg.RequestRateLimitByRoute, time.Minute, routePattern(r))
+
+	// Public routes, no authentication
+	r.Group(func(router chi.Router) {
+		router.Use(middleware.PublicCORS(cfg.StatusAllowedOrigins))
+		router.Use(middleware.RateLimitByIP("status", cfg.StatusRateLimit, time.Minute))
+		router.Use(registry.Chain(middleware.BeforeHandler)...)
+
+		router.Get("/status", GetStatus)
+		router.Options("/status", GetStatus)
+		router.Get("/version", GetVersion)
+		router.Get("/readyz", GetReadiness)
+		router.Get("/leaderboard", GetLeaderboard)
+	})
+
+	// Export downloads, the signed token in the path is the credential
+	r.Group(func(router chi.Router) {
+		router.Use(middleware.RateLimitByIP("downloads", config.Get().StatusRateLimit, time.Minute))
+		router.Use(registry.Chain(middleware.BeforeHandler)...)
+
+		router.Get("/downloads/{token}", DownloadExport)
+	})
+
+	// The OpenAPI spec and Swagger UI for it
+	r.Group(func(router chi.Router) {
+		router.Use(middleware.RateLimitByIP("docs", config.Get().StatusRateLimit, time.Minute))
+		router.Use(registry.Chain(middleware.BeforeHandler)...)
+
+		router.Get("/openapi.json", GetOpenAPISpec)
+		router.Get("/docs", GetDocs)
+	})
+
+	// Starts and ends sessions in the jwt auth mode
+	r.Group(func(router chi.Router) {
+		router.Use(middleware.Authorization)
+		router.Use(registry.Chain(middleware.AfterAuth)...)
+		router.Use(registry.Chain(middleware.BeforeHandler)...)
+
+		router.Post(middleware.LoginPath, Login)
+		router.Post("/auth/logout", Logout)
+	})
+
+	// The refresh token in the body is the credential
+	r.Group(func(router chi.Router) {
+		router.Use(middleware.RateLimitByIP("refresh", config.Get().StatusRateLimit, time.Minute))
+		router.Use(registry.Chain(middleware.BeforeHandler)...)
+
+		router.Post("/auth/refresh", RefreshSession)
+	})
+
+	// Opens accounts, so nobody is authenticated yet
+	r.Group(func(router chi.Router) {
+		router.Use(middleware.RateLimitByIP("signup", config.Get().SignupRateLimit, time.Minute))
+		router.Use(registry.Chain(middleware.BeforeHandler)...)
+
+		router.Post("/signup", Signup)
+	})
+
+	// Wallet sockets, authenticated like /account when they open
+	r.Group(func(router chi.Router) {
+		router.Use(middleware.Authorization)
+		router.Use(requests.Middleware)
+		router.Use(registry.Chain(middleware.AfterAuth)...)
+		router.Use(registry.Chain(middleware.BeforeHandler)...)
+
+		router.Get("/ws", WalletSocket)
+	})
+
+	// GraphQL over the caller's own account, limited and authenticated like /account
+	r.Group(func(router chi.Router) {
+		router.Use(middleware.Authorization)
+		router.Use(requests.Middleware)
+		router.Use(limiter.Middleware)
+		router.Use(registry.Chain(middleware.AfterAuth)...)
+		router.Use(registry.Chain(middleware.BeforeHandler)...)
+
+		router.Post("/graphql", GraphQL)
+	})
+
+	// A single ledger entry by the TransactionID a transfer returned, authenticated and
+	// limited like /account, where the same lookup is also served
+	r.Group(func(router chi.Router) {
+		router.Use(middleware.Authorization)
+		router.Use(requests.Middleware)
+		router.Use(registry.Chain(middleware.AfterAuth)...)
+		router.Use(registry.Chain(middleware.BeforeHandler)...)
+
+		router.Get("/transaction/{id}", GetTransaction)
+	})
 
 	r.Route("/account", func(router chi.Router) {
 
 		// Middleware for /account route
 		router.Use(middleware.Authorization)
+		router.Use(requests.Middleware)
+		router.Use(middleware.TrackHotAccounts)
+		router.Use(limiter.Middleware)
+		router.Use(dedup.Middleware)
+		router.Use(middleware.SimulateFailures(config.Get().SimulatedFailureRate))
+		router.Use(registry.Chain(middleware.AfterAuth)...)
+		router.Use(registry.Chain(middleware.BeforeHandler)...)
 
 		router.Get("/coins", GetCoinBalance)
+		router.Get("/summary", GetAccountSummary)
+		router.Get("/aggregates", GetAccountAggregates)
+		router.Get("/holds", GetHolds)
+		router.Get("/pending", GetPendingOperations)
 		router.Post("/coins/add", AddCoins)
 		router.Post("/coins/withdraw", WithdrawCoins)
 		router.Post("/coins/transfer", TransferCoins)
+		router.Post("/coins/faucet", Faucet)
+		router.Post("/transfers/precheck", PrecheckTransfer)
+
+		router.Get("/gifts", ListGifts)
+		router.Post("/gifts", SendGift)
+		router.Post("/gifts/{id}/accept", AcceptGift)
+		router.Post("/gifts/{id}/decline", DeclineGift)
+
+		router.Post("/hold", PlaceHold)
+		router.Post("/hold/{id}/capture", CaptureHold)
+		router.Post("/hold/{id}/release", ReleaseHold)
+
+		router.Get("/reservations", ListReservations)
+		router.Post("/reservations", CreateReservation)
+		router.Post("/reservations/{id}/commit", CommitReservation)
+		router.Post("/reservations/{id}/cancel", CancelReservation)
+
+		router.Get("/standing-orders", ListStandingOrders)
+		router.Post("/standing-orders", CreateStandingOrder)
+		router.Delete("/standing-orders/{id}", CancelStandingOrder)
+		router.Get("/standing-orders/{id}/history", GetStandingOrderHistory)
+
+		router.Get("/transactions", GetTransactions)
+		router.Post("/transactions/export", StartTransactionExport)
+		router.Get("/transactions/export/{id}", GetTransactionExport)
+		router.Get("/transactions/{id}", GetTransaction)
+		router.Get("/transactions/{id}/receipt", GetTransferReceipt)
+		router.Get("/events", GetAccountEvents)
+		router.Post("/data-export", ExportAccountData)
+		router.Post("/data-deletion", RequestDataDeletion)
+
+		router.Get("/profile", GetProfile)
+		router.Put("/profile", UpdateProfile)
+
+		router.Get("/contacts", ListContacts)
+		router.Post("/contacts", SetContact)
+		router.Delete("/contacts", RemoveContact)
+
+		router.Get("/webhooks", ListAccountWebhooks)
+		router.Post("/webhooks", CreateAccountWebhook)
+		router.Delete("/webhooks", RemoveAccountWebhook)
+		router.Post("/webhooks/rotate", RotateAccountWebhook)
+		router.Put("/webhooks/digest", SetAccountWebhookDigest)
+		router.Put("/webhooks/rules", SetAccountWebhookRules)
+
+		router.Get("/owners", ListAccountOwners)
+		router.Post("/owners", SetAccountOwner)
+		router.Delete("/owners", RemoveAccountOwner)
+	})
+
+	// Read-only audit viewer for auditors and admins, every request is logged
+	r.Route("/audit", func(router chi.Router) {
+		router.Use(middleware.Authorization)
+		router.Use(middleware.RequireAuditAccess)
+		router.Use(requests.Middleware)
+		router.Use(registry.Chain(middleware.AfterAuth)...)
+		router.Use(registry.Chain(middleware.BeforeHandler)...)
+
+		router.Get("/transactions", GetAuditTransactions)
+		router.Get("/export", ExportAudit)
+		router.Get("/events", GetAuditEventFeed)
+		router.Get("/freezes", ListFreezes)
+	})
+
+	r.Route("/admin", func(router chi.Router) {
+
+		// Middleware for /admin route, admins authenticate like any other user
+		router.Use(middleware.Authorization)
+		router.Use(middleware.RequireAdmin)
+		router.Use(requests.Middleware)
+		router.Use(limiter.Middleware)
+		router.Use(registry.Chain(middleware.AfterAuth)...)
+		router.Use(registry.Chain(middleware.BeforeHandler)...)
+
+		router.Get("/policies", GetPolicies)
+		router.Put("/policies", UpdatePolicies)
+		router.Get("/policies/history", GetPolicyHistory)
+		router.Get("/events", GetEventFeed)
+		router.Get("/audit/export", ExportAudit)
+		router.Get("/audit/access", GetAuditAccessLog)
+		router.Get("/economy/report", GetEconomyReport)
+		router.Get("/reconciliation", RunReconciliation)
+		router.Get("/users", ListUsers)
+		router.Post("/users", CreateAccount)
+		router.Post("/users/{username}/freeze", FreezeAccount)
+		router.Post("/users/{username}/unfreeze", UnfreezeAccount)
+		router.Post("/users/{username}/adjust", AdjustBalance)
+		router.Post("/users/{username}/repair", RepairAccount)
+		router.Get("/users/{username}/audit-diff", GetAuditDiff)
+		router.Get("/schedules", ListSchedules)
+		router.Get("/capabilities", GetCapabilities)
+		router.Get("/side-effects", ListSideEffects)
+		router.Post("/side-effects/{id}/retry", RetrySideEffect)
+		router.Get("/data-deletions", ListDataDeletions)
+		router.Post("/data-deletions/{id}/approve", ApproveDataDeletion)
+		router.Post("/data-deletions/{id}/reject", RejectDataDeletion)
+		router.Get("/experiments", GetExperiments)
+		router.Get("/freezes", ListFreezes)
+		router.Post("/freezes", PlaceFreeze)
+		router.Put("/freezes/{id}", AdjustFreeze)
+		router.Delete("/freezes/{id}", LiftFreeze)
+		router.Get("/dormancy", GetDormancyReport)
+		router.Get("/dormancy/sweeps", ListSweeps)
+		router.Post("/dormancy/sweeps", ProposeSweep)
+		router.Post("/dormancy/sweeps/{id}/approve", ApproveSweep)
+		router.Post("/dormancy/sweeps/{id}/reverse", ReverseSweep)
+
+		router.Get("/runbooks", ListRunbooks)
+		router.Post("/runbooks/{name}/runs", StartRunbook)
+		router.Get("/runbooks/runs/{id}", GetRunbookRun)
+
+		router.Get("/lockouts", ListLockouts)
+		router.Delete("/lockouts", RemoveLockout)
+		router.Get("/rate-limits", ListRateLimits)
+		router.Delete("/rate-limits", ClearRateLimits)
+		router.Put("/status/incident", SetIncident)
+		router.Delete("/status/incident", ClearIncident)
+		router.Get("/webhooks", ListGlobalWebhooks)
+		router.Post("/webhooks", CreateGlobalWebhook)
+		router.Delete("/webhooks", RemoveGlobalWebhook)
+		router.Post("/webhooks/rotate", RotateGlobalWebhook)
+		router.Put("/webhooks/digest", SetGlobalWebhookDigest)
+		router.Put("/webhooks/rules", SetGlobalWebhookRules)
 	})
 }
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/audit"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetAuditTransactions returns the ledger for one account, or every account
+func GetAuditTransactions(w http.ResponseWriter, r *http.Request) {
+	var params = api.AuditTransactionsParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	var entries []tools.TransactionLog
+	if params.Account != "" {
+		entries = (*database).GetTransactionHistory(params.Account)
+	} else {
+		entries = (*database).GetAllTransactions()
+	}
+
+	var transactions = make([]api.AuditEntry, 0, len(entries))
+	for _, entry := range entries {
+		transactions = append(transactions, api.AuditEntry(entry))
+	}
+
+	var response = api.AuditTransactionsResponse{
+		Code:         http.StatusOK,
+		Transactions: transactions,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// GetAuditAccessLog lets admins review who used the audit viewer
+func GetAuditAccessLog(w http.ResponseWriter, r *http.Request) {
+	var params = api.AuditAccessParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var entries = []api.AuditAccessEntry{}
+	for _, entry := range audit.AccessLog() {
+		entries = append(entries, api.AuditAccessEntry(entry))
+	}
+
+	var response = api.AuditAccessResponse{
+		Code:    http.StatusOK,
+		Entries: entries,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/contacts"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+func ListContacts(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.ContactListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	list, err := contacts.List(*database, username)
+	if err != nil {
+		log.Error("Failed to list contacts: ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var result = []api.Contact{}
+	for _, contact := range list {
+		result = append(result, api.Contact(contact))
+	}
+
+	var response = api.ContactListResponse{
+		Code:     http.StatusOK,
+		Contacts: result,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+func SetContact(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.ContactParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	if _, err = (*database).GetUserCoins(params.Counterparty); err != nil {
+		log.Error("Contact counterparty lookup failed: ", params.Counterparty, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	// A nickname that is also a username would make transfers ambiguous
+	if _, err = (*database).GetUserCoins(params.Nickname); params.Nickname != "" && err == nil {
+		log.Error("Nickname collides with an existing username: ", params.Nickname)
+		api.RequestErrorHandler(w, fmt.Errorf("nickname cannot be an existing username"))
+		return
+	}
+
+	contact, err := contacts.Set(*database, username, contacts.Contact{
+		Counterparty: params.Counterparty,
+		Nickname:     params.Nickname,
+		Note:         params.Note,
+	})
+	if errors.Is(err, contacts.ErrNicknameTaken) {
+		api.ConflictErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, contacts.ErrInvalidContact) {
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to save contact: ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.ContactResponse{
+		Code:    http.StatusOK,
+		Contact: api.Contact(contact),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+func RemoveContact(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.ContactRemoveParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	removed, err := contacts.Remove(*database, username, params.Counterparty)
+	if err != nil {
+		log.Error("Failed to remove contact: ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+	if !removed {
+		api.RequestErrorHandler(w, fmt.Errorf("contact not found"))
+		return
+	}
+
+	var response = api.MessageResponse{
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf("Contact %s removed.", params.Counterparty),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
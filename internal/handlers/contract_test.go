@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/warmup"
+)
+
+// The contract tests work from the committed spec, not from Routes, so a handler
+// answering with something its api type doesn't describe, or a spec that no longer
+// matches either, fails here
+
+type specOperation struct {
+	Parameters []struct {
+		Name   string
+		In     string
+		Schema map[string]interface{}
+	}
+	RequestBody *struct {
+		Content map[string]struct{ Schema map[string]interface{} }
+	}
+	Responses map[string]struct {
+		Content map[string]struct{ Schema map[string]interface{} }
+	}
+}
+
+// responseSchema is the JSON schema the spec gives for status, nil if the body isn't JSON
+func (o specOperation) responseSchema(status int) map[string]interface{} {
+	var key string = "default"
+	if status >= 200 && status < 300 {
+		key = "2XX"
+	}
+	return o.Responses[key].Content["application/json"].Schema
+}
+
+// Values that pass validation for parameters of these names, anything else is left out
+var contractSamples = map[string]interface{}{
+	"to":           "bryan",
+	"account":      "bryan",
+	"counterparty": "bryan",
+	"owner":        "bryan",
+	"permission":   "view",
+	"reason":       "contract test",
+	"memo":         "contract test",
+	"message":      "contract test",
+	"nickname":     "b",
+	"timezone":     "UTC",
+	"locale":       "en-US",
+	"interval":     "daily",
+	"reference":    "contract test",
+	"query":        "{ balance { balance } }",
+}
+
+// Routes that stream until the client leaves, cut off once they have had time to answer
+var contractStreams = map[string]bool{
+	"/account/events": true,
+}
+
+type contractCase struct {
+	name      string
+	method    string
+	pattern   string
+	query     url.Values
+	body      string
+	operation specOperation
+
+	// Refused with a 4xx no matter who sends it
+	invalid bool
+}
+
+// contractCaller picks an account allowed on the route, so the request gets past
+// Authorization to the handler
+func contractCaller(pattern string) (username string, token string) {
+	switch {
+	case strings.HasPrefix(pattern, "/admin"):
+		return "admin", "admin"
+	case strings.HasPrefix(pattern, "/audit"):
+		return "auditor", "auditor"
+	}
+	return "aaron", "1"
+}
+
+// sampleValue is a valid value for a parameter or body field, false if there is none
+func sampleValue(name string, schema map[string]interface{}) (interface{}, bool) {
+	if value, ok := contractSamples[strings.ToLower(name)]; ok {
+		return value, true
+	}
+	switch schema["type"] {
+	case "integer":
+		return 1, true
+	case "boolean":
+		return false, true
+	}
+	return nil, false
+}
+
+// contractCases generates a valid request and the boundary-invalid ones for each
+// operation in the spec
+func contractCases(spec map[string]map[string]specOperation) []contractCase {
+	var cases []contractCase
+	for pattern, methods := range spec {
+		for method, operation := range methods {
+			var username, _ = contractCaller(pattern)
+			var valid = contractCase{
+				name:      strings.ToUpper(method) + " " + pattern,
+				method:    strings.ToUpper(method),
+				pattern:   pattern,
+				query:     url.Values{},
+				operation: operation,
+			}
+
+			var integers, booleans []string
+			for _, parameter := range operation.Parameters {
+				if parameter.In != "query" {
+					continue
+				}
+				if parameter.Name == "username" {
+					valid.query.Set("username", username)
+					continue
+				}
+				switch parameter.Schema["type"] {
+				case "integer":
+					integers = append(integers, parameter.Name)
+				case "boolean":
+					booleans = append(booleans, parameter.Name)
+				}
+				if operation.RequestBody != nil {
+					continue
+				}
+				if value, ok := sampleValue(parameter.Name, parameter.Schema); ok {
+					valid.query.Set(parameter.Name, fmt.Sprint(value))
+				}
+			}
+
+			var bodyIntegers []string
+			if operation.RequestBody != nil {
+				var schema = operation.RequestBody.Content["application/json"].Schema
+				properties, _ := schema["properties"].(map[string]interface{})
+				var body = map[string]interface{}{}
+				for name, property := range properties {
+					property, _ := property.(map[string]interface{})
+					if property["type"] == "integer" {
+						bodyIntegers = append(bodyIntegers, name)
+					}
+					if value, ok := sampleValue(name, property); ok && name != "Username" {
+						body[name] = value
+					}
+				}
+				encoded, _ := json.Marshal(body)
+				valid.body = string(encoded)
+			}
+			cases = append(cases, valid)
+
+			invalid := func(name string, change func(c *contractCase)) {
+				var c = valid
+				c.name = valid.name + " " + name
+				c.query = url.Values{}
+				for key, values := range valid.query {
+					c.query[key] = values
+				}
+				c.invalid = true
+				change(&c)
+				cases = append(cases, c)
+			}
+
+			invalid("undeclared parameter", func(c *contractCase) { c.query.Set("undeclared", "1") })
+			for _, name := range integers {
+				if operation.RequestBody != nil {
+					continue
+				}
+				invalid(name+" overflows", func(c *contractCase) { c.query.Set(name, "9223372036854775808") })
+				invalid(name+" not a number", func(c *contractCase) { c.query.Set(name, "ten") })
+			}
+			for _, name := range booleans {
+				if operation.RequestBody != nil {
+					continue
+				}
+				invalid(name+" not a boolean", func(c *contractCase) { c.query.Set(name, "maybe") })
+			}
+			if operation.RequestBody != nil {
+				invalid("malformed body", func(c *contractCase) { c.body = `{"Amount":` })
+				invalid("undeclared body field", func(c *contractCase) { c.body = `{"Undeclared":1}` })
+				for _, name := range bodyIntegers {
+					invalid(name+" overflows", func(c *contractCase) { c.body = fmt.Sprintf(`{%q:9223372036854775808}`, name) })
+					invalid(name+" not a number", func(c *contractCase) { c.body = fmt.Sprintf(`{%q:"ten"}`, name) })
+				}
+			}
+		}
+	}
+
+	sort.Slice(cases, func(i, j int) bool { return cases[i].name < cases[j].name })
+	return cases
+}
+
+// contractPath fills in a pattern's path parameters. Only accounts exist, so every other
+// lookup is a 404 that still has to match the spec.
+func contractPath(pattern string) string {
+	var segments = strings.Split(pattern, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "{username}":
+			segments[i] = "bryan"
+		case strings.HasPrefix(segment, "{"):
+			segments[i] = "missing"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// checkSchema returns where value breaks schema, empty if it conforms
+func checkSchema(schema map[string]interface{}, value interface{}, at string) []string {
+	if value == nil {
+		if schema["nullable"] == true || len(schema) == 0 {
+			return nil
+		}
+		return []string{at + ": null is not allowed"}
+	}
+
+	var problems []string
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object, got %T", at, value)}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		for name, field := range object {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				problems = append(problems, checkSchema(property, field, at+"."+name)...)
+			} else if additional != nil {
+				problems = append(problems, checkSchema(additional, field, at+"."+name)...)
+			} else {
+				problems = append(problems, at+"."+name+": not in the spec")
+			}
+		}
+		for name := range properties {
+			if _, ok := object[name]; !ok {
+				problems = append(problems, at+"."+name+": missing")
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an array, got %T", at, value)}
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range array {
+			problems = append(problems, checkSchema(items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected a string, got %T", at, value)}
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, text); err != nil {
+				problems = append(problems, at+": not a date-time: "+text)
+			}
+		}
+	case "integer":
+		number, ok := value.(json.Number)
+		if _, err := number.Int64(); !ok || err != nil {
+			problems = append(problems, fmt.Sprintf("%s: expected an integer, got %v", at, value))
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected a number, got %T", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected a boolean, got %T", at, value))
+		}
+	}
+	return problems
+}
+
+func TestContract(t *testing.T) {
+	defer config.Set(config.Get())
+	var cfg config.Config = config.Get()
+	cfg.StrictQueryParams = true
+	config.Set(cfg)
+
+	content, err := os.ReadFile("../../api/params.openapi.json")
+	if err != nil {
+		t.Fatalf("Failed to read the spec: %v", err)
+	}
+	var document struct {
+		Paths map[string]map[string]specOperation
+	}
+	if err = json.Unmarshal(content, &document); err != nil {
+		t.Fatalf("Failed to parse the spec: %v", err)
+	}
+
+	var router = newTestRouter(t)
+	var database, _ = tools.NewDatabase()
+	warmup.Run(*database, nil, 1)
+
+	var succeeded, valid int
+	for _, c := range contractCases(document.Paths) {
+		t.Run(c.name, func(t *testing.T) {
+			var _, token = contractCaller(c.pattern)
+			var target string = contractPath(c.pattern)
+			if len(c.query) > 0 {
+				target += "?" + c.query.Encode()
+			}
+			var req *http.Request = httptest.NewRequest(c.method, target, nil)
+			if c.body != "" {
+				req = httptest.NewRequest(c.method, target, strings.NewReader(c.body))
+				req.Header.Set("Content-Type", "application/json")
+			}
+			req.Header.Set("Authorization", token)
+			if contractStreams[c.pattern] {
+				ctx, cancel := context.WithTimeout(req.Context(), 100*time.Millisecond)
+				defer cancel()
+				req = req.WithContext(ctx)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code >= http.StatusInternalServerError && w.Code != http.StatusServiceUnavailable {
+				t.Fatalf("Got %d: %s", w.Code, w.Body.String())
+			}
+			if c.invalid && (w.Code < http.StatusBadRequest || w.Code >= http.StatusInternalServerError) {
+				t.Errorf("Expected an invalid request refused, got %d: %s", w.Code, w.Body.String())
+			}
+			if !c.invalid {
+				valid++
+				if w.Code < http.StatusMultipleChoices {
+					succeeded++
+				}
+			}
+
+			var schema = c.operation.responseSchema(w.Code)
+			if schema == nil || w.Code == http.StatusNoContent {
+				return
+			}
+			var decoder = json.NewDecoder(bytes.NewReader(w.Body.Bytes()))
+			decoder.UseNumber()
+			var body interface{}
+			if err := decoder.Decode(&body); err != nil {
+				t.Fatalf("Expected a JSON body with %d, got %q", w.Code, w.Body.String())
+			}
+			for _, problem := range checkSchema(schema, body, "body") {
+				t.Errorf("%d response doesn't match the spec, %s", w.Code, problem)
+			}
+		})
+	}
+
+	t.Logf("%d of %d valid requests succeeded", succeeded, valid)
+
+	// Mostly refusals would leave the success schemas untested
+	if succeeded < valid/2 {
+		t.Errorf("Expected most valid requests to succeed, only %d of %d did", succeeded, valid)
+	}
+}
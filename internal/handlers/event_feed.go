@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/audit"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+const maxEventFeedLimit = 1000
+
+// GetEventFeed streams domain events as newline-delimited JSON, resumable with ?after=<last ID>
+func GetEventFeed(w http.ResponseWriter, r *http.Request) {
+	writeEventFeed(w, r, false)
+}
+
+// GetAuditEventFeed is the event feed with credential-like fields redacted
+func GetAuditEventFeed(w http.ResponseWriter, r *http.Request) {
+	writeEventFeed(w, r, true)
+}
+
+func writeEventFeed(w http.ResponseWriter, r *http.Request, redact bool) {
+	var params = api.EventFeedParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	if params.Limit <= 0 || params.Limit > maxEventFeedLimit {
+		params.Limit = maxEventFeedLimit
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	var encoder *json.Encoder = json.NewEncoder(w)
+	for _, event := range events.Since(tools.AttachedDatabase(r.Context()), params.After, params.Limit) {
+		if redact {
+			event.Data = audit.RedactData(event.Data)
+		}
+
+		err = encoder.Encode(api.DomainEvent(event))
+		if err != nil {
+			// Headers are already sent, all we can do is stop
+			log.Error("Failed to write event feed: ", err)
+			return
+		}
+	}
+}
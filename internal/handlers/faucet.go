@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// Faucet credits the caller a fixed amount, only when the profile enables it
+func Faucet(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var cfg config.Config = config.Get()
+	if !cfg.FaucetEnabled {
+		api.NotFoundErrorHandler(w, fmt.Errorf("faucet is not available in the %s profile", cfg.Profile))
+		return
+	}
+
+	var params = api.FaucetParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	updatedCoinBalance, err := (*database).AddUserCoins(username, cfg.FaucetAmount)
+	if err != nil {
+		log.Error("Faucet failed for user: ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	events.Record(*database, events.DepositCompleted, username, map[string]interface{}{
+		"amount":  cfg.FaucetAmount,
+		"balance": updatedCoinBalance.Coins,
+		"faucet":  true,
+	})
+
+	var response = api.CoinAdditionResponse{
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf("The faucet added %d coins.", cfg.FaucetAmount),
+		Balance: updatedCoinBalance.Coins,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
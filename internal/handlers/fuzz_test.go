@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/go-chi/chi"
+)
+
+// Run with e.g. go test ./internal/handlers -fuzz FuzzRoutes -fuzztime 30s,
+// plain go test only replays the seeds below
+
+func FuzzDecodeQuery(f *testing.F) {
+	f.Add("username=aaron&amount=10")
+	f.Add("amount=-9223372036854775808")
+	f.Add("amount=1e400&amount=2")
+	f.Add("eventTypes=a&eventTypes=&limit=%zz")
+	f.Add("Username=aaron&USERNAME=bryan")
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		query, err := url.ParseQuery(raw)
+		if err != nil {
+			return
+		}
+
+		decodeQuery(&api.CoinAdditionParams{}, query)
+		decodeQuery(&api.CoinTransferParams{}, query)
+		decodeQuery(&api.EventFeedParams{}, query)
+		decodeQuery(&api.WebhookParams{}, query)
+	})
+}
+
+var fuzzRoutes = []struct {
+	method string
+	path   string
+}{
+	{http.MethodGet, "/account/coins"},
+	{http.MethodGet, "/account/summary"},
+	{http.MethodPost, "/account/coins/add"},
+	{http.MethodPost, "/account/coins/withdraw"},
+	{http.MethodPost, "/account/coins/transfer"},
+	{http.MethodPost, "/account/transfers/precheck"},
+	{http.MethodPost, "/account/contacts"},
+	{http.MethodGet, "/account/transactions/x/receipt"},
+	{http.MethodPut, "/admin/policies"},
+	{http.MethodGet, "/admin/economy/report"},
+}
+
+// FuzzRoutes sends arbitrary query strings, Authorization headers and bodies through
+// the full router. No input may panic or produce a 500.
+func FuzzRoutes(f *testing.F) {
+	var router = chi.NewRouter()
+	Handler(router)
+
+	f.Add(uint8(2), "username=aaron&amount=10", "1", "")
+	f.Add(uint8(3), "username=aaron&amount=9223372036854775807", "1", "")
+	f.Add(uint8(4), "username=aaron&from=aaron&to=aaron&amount=1", "1", "")
+	f.Add(uint8(4), "username=aaron&from=aaron&to=&amount=1", "1", "")
+	f.Add(uint8(0), "username=nobody", "", "")
+	f.Add(uint8(8), "username=admin", "admin", `{"Version":1,"Limits":{"":{"":{}}}}`)
+	f.Add(uint8(8), "username=admin", "admin", `null`)
+	f.Add(uint8(9), "username=admin&from=2026-13-40", "admin", "")
+
+	f.Fuzz(func(t *testing.T, route uint8, query string, token string, body string) {
+		var target = fuzzRoutes[int(route)%len(fuzzRoutes)]
+
+		req := httptest.NewRequest(target.method, target.path, strings.NewReader(body))
+		req.URL.RawQuery = query
+		req.Header.Set("Authorization", token)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code >= http.StatusInternalServerError {
+			t.Errorf("%s %s?%s returned %d: %s", target.method, target.path, query, w.Code, w.Body.String())
+		}
+	})
+}
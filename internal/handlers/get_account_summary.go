@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/features"
+	"github.com/bryantjandra/goapi/internal/locales"
+	"github.com/bryantjandra/goapi/internal/service"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+func GetAccountSummary(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.AccountSummaryParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	summary, err := service.New(*database).WithFeatures(features.FromContext(r.Context())).AccountSummary(username)
+	if err != nil {
+		log.Error("Failed to build account summary for user: ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+	viewer, err := loadViewer(*database, username)
+	if err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var transactions = make([]api.Transaction, 0, len(summary.RecentTransactions))
+	for _, tx := range summary.RecentTransactions {
+		transactions = append(transactions, toAPITransaction(tx, viewer))
+	}
+
+	var response = api.AccountSummaryResponse{
+		Code:               http.StatusOK,
+		Balance:            summary.Balance,
+		Available:          summary.Status.Available,
+		Held:               summary.Status.Held,
+		Pending:            summary.Status.Pending,
+		LastTransactionAt:  lastTransactionAt(summary.Status),
+		Status:             toAPIAccountStatus(summary.Status),
+		RecentTransactions: transactions,
+		Limits:             api.PolicyLimits(summary.Limits),
+		Alerts:             summary.Alerts,
+	}
+	if locale, ok := locales.Lookup(viewer.profile.Locale); ok {
+		response.BalanceDisplay = locale.Number(summary.Balance)
+	}
+	if !summary.ProbationEndsAt.IsZero() {
+		response.ProbationEndsAt = &summary.ProbationEndsAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
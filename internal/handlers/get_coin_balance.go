@@ -2,21 +2,23 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/service"
 	"github.com/bryantjandra/goapi/internal/tools"
-	"github.com/gorilla/schema"
 	log "github.com/sirupsen/logrus"
 )
 
 func GetCoinBalance(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
 	var params = api.CoinBalanceParams{}
-	var decoder *schema.Decoder = schema.NewDecoder()
 	var err error
 
-	err = decoder.Decode(&params, r.URL.Query())
+	err = decodeQuery(&params, r.URL.Query())
 
 	if err != nil {
 		log.Error("Failed to parse request parameters: ", err)
@@ -24,23 +26,32 @@ func GetCoinBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	database, err := tools.NewDatabase()
+	database, err := tools.OpenDatabase(r.Context())
 	if err != nil {
 		log.Error("Failed to connect to database: ", err)
 		api.InternalErrorHandler(w)
 		return
 	}
 
-	tokenDetails := (*database).GetUserCoins(params.Username)
-	if tokenDetails == nil {
-		log.Error("User not found: ", params.Username)
-		api.RequestErrorHandler(w, fmt.Errorf("user not found"))
+	tokenDetails, err := (*database).GetUserCoins(username)
+	if err != nil {
+		log.Error("Failed to read balance for user: ", username, ": ", err)
+		storageErrorHandler(w, err)
 		return
 	}
 
-	var response = api.CoinBalanceResponse{
-		Balance: (*tokenDetails).Coins,
-		Code:    http.StatusOK,
+	response, err := toAPICoinBalance(*database, username, tokenDetails)
+	if err != nil {
+		log.Error("Failed to read account status for user: ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	// Storage is down and this is the last balance we saw
+	if response.Stale {
+		var age time.Duration = time.Since(tokenDetails.CachedAt)
+		w.Header().Set("Warning", `110 goapi "Response is Stale"`)
+		w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -52,3 +63,48 @@ func GetCoinBalance(w http.ResponseWriter, r *http.Request) {
 	}
 
 }
+
+// toAPICoinBalance describes username's balance, details being what storage returned
+func toAPICoinBalance(database tools.DatabaseInterface, username string, details *tools.CoinDetails) (api.CoinBalanceResponse, error) {
+	status, err := service.New(database).Status(*details)
+	if err != nil {
+		return api.CoinBalanceResponse{}, err
+	}
+
+	var response = api.CoinBalanceResponse{
+		Balance:           details.Coins,
+		Frozen:            status.Frozen,
+		AccountFrozen:     status.State == service.StateFrozen,
+		Available:         status.Available,
+		Held:              status.Held,
+		Pending:           status.Pending,
+		LastTransactionAt: lastTransactionAt(status),
+		Status:            toAPIAccountStatus(status),
+		Currency:          api.Currency,
+		Code:              http.StatusOK,
+	}
+	if !details.CachedAt.IsZero() {
+		response.Stale = true
+		response.AsOf = &details.CachedAt
+		response.Warning = "Storage is unavailable, this balance may be out of date."
+	}
+	return response, nil
+}
+
+func toAPIAccountStatus(status service.AccountStatus) api.AccountStatus {
+	var result = api.AccountStatus{State: status.State, Freezes: status.Freezes}
+	if !status.LockedUntil.IsZero() {
+		lockedUntil := status.LockedUntil
+		result.LockedUntil = &lockedUntil
+	}
+	return result
+}
+
+// lastTransactionAt is nil for accounts without any successful transaction
+func lastTransactionAt(status service.AccountStatus) *time.Time {
+	if status.LastTransactionAt.IsZero() {
+		return nil
+	}
+	at := status.LastTransactionAt
+	return &at
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/contacts"
+	"github.com/bryantjandra/goapi/internal/gifts"
+	"github.com/bryantjandra/goapi/internal/service"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+func toAPIGift(gift gifts.Gift) api.Gift {
+	var result = api.Gift{
+		ID:        gift.ID,
+		From:      gift.From,
+		To:        gift.To,
+		Amount:    gift.Amount,
+		Message:   gift.Message,
+		Status:    gift.Status,
+		SentAt:    gift.SentAt,
+		ExpiresAt: gift.ExpiresAt,
+	}
+	if !gift.ResolvedAt.IsZero() {
+		resolvedAt := gift.ResolvedAt
+		result.ResolvedAt = &resolvedAt
+	}
+	return result
+}
+
+func writeGift(w http.ResponseWriter, code int, gift gifts.Gift, err error) {
+	if errors.Is(err, gifts.ErrNotFound) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, gifts.ErrNotPending) || errors.Is(err, gifts.ErrInsufficientFunds) || errors.Is(err, gifts.ErrTransferFailed) {
+		log.Error("Gift refused: ", err)
+		api.ConflictErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, gifts.ErrInvalidGift) || errors.Is(err, gifts.ErrDisabled) {
+		log.Error("Gift refused: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Gift refused: ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.GiftResponse{
+		Code: code,
+		Gift: toAPIGift(gift),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		return
+	}
+}
+
+// SendGift reserves coins for another account until they accept them, the checks a
+// transfer gets run now
+func SendGift(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+
+	var params = api.GiftParams{}
+	var err error = decodeMutation(w, r, &params)
+
+	if errors.Is(err, errUnsupportedMediaType) {
+		log.Error("Failed to parse request body: ", err)
+		api.UnsupportedMediaTypeErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	if params.Amount <= 0 {
+		log.Error("Invalid amount: must be positive, got: ", params.Amount)
+		api.RequestErrorHandler(w, fmt.Errorf("amount must be positive"))
+		return
+	}
+	var amount int64 = int64(params.Amount)
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	if counterparty, ok := contacts.Resolve(*database, username, params.To); ok {
+		params.To = counterparty
+	}
+
+	if _, err = (*database).GetUserCoins(params.To); err != nil {
+		log.Error("Gift recipient lookup failed: ", params.To, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+	if _, err = (*database).GetUserCoins(username); err != nil {
+		log.Error("Failed to read balance for user: ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var svc *service.Service = service.New(*database)
+
+	err = svc.CheckAvailable(username, amount)
+	if err != nil {
+		log.Error("Gift refused for user: ", username, ": ", err)
+		availabilityErrorHandler(w, err)
+		return
+	}
+
+	err = svc.CheckProbation(username, amount)
+	if err != nil {
+		log.Error("Gift refused for user: ", username, ": ", err)
+		api.TooManyRequestsErrorHandler(w, err)
+		return
+	}
+
+	err = svc.CheckLimits(username, amount)
+	if err != nil {
+		log.Error("Gift refused for user: ", username, ": ", err)
+		api.TooManyRequestsErrorHandler(w, err)
+		return
+	}
+
+	err = svc.CheckPairLimits(username, params.To, amount)
+	if err != nil {
+		log.Error("Gift refused for users: ", username, " -> ", params.To, ": ", err)
+		api.TooManyRequestsErrorHandler(w, err)
+		return
+	}
+
+	gift, err := gifts.Send(*database, username, params.To, amount, params.Message, config.Get().GiftAcceptWindow, time.Now())
+	writeGift(w, http.StatusAccepted, gift, err)
+}
+
+// ListGifts lists the gifts the caller sent and received, newest first
+func ListGifts(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.GiftListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	switch params.Status {
+	case "", gifts.StatusPending, gifts.StatusAccepted, gifts.StatusDeclined, gifts.StatusReturned, gifts.StatusFailed:
+	default:
+		api.RequestErrorHandler(w, fmt.Errorf("unknown gift status %q", params.Status))
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	outgoing, incoming, err := gifts.Pending(*database, username)
+	if err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+	list, err := gifts.List(*database, username, params.Status)
+	if err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.GiftListResponse{
+		Code:            http.StatusOK,
+		PendingOutgoing: outgoing,
+		PendingIncoming: incoming,
+		Gifts:           []api.Gift{},
+	}
+	for _, gift := range list {
+		response.Gifts = append(response.Gifts, toAPIGift(gift))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// AcceptGift moves a gift's coins to the caller, its recipient
+func AcceptGift(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.GiftDecisionParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	gift, err := gifts.Accept(*database, chi.URLParam(r, "id"), username, time.Now())
+	writeGift(w, http.StatusOK, gift, err)
+}
+
+// DeclineGift returns a gift to its sender
+func DeclineGift(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.GiftDecisionParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	gift, err := gifts.Decline(*database, chi.URLParam(r, "id"), username, time.Now())
+	writeGift(w, http.StatusOK, gift, err)
+}
@@ -0,0 +1,609 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/contacts"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/messages"
+	"github.com/bryantjandra/goapi/internal/profiles"
+	"github.com/bryantjandra/goapi/internal/receipts"
+	"github.com/bryantjandra/goapi/internal/service"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	log "github.com/sirupsen/logrus"
+)
+
+var errGraphQLQueryRequired = errors.New("query is required, send {\"query\": \"...\"}")
+
+var errGraphQLInternal = errors.New("internal error")
+
+// Everything a resolver needs from the request, resolvers only act as this user
+type graphQLContextKey struct{}
+
+type graphQLRequest struct {
+	username string
+	database tools.DatabaseInterface
+}
+
+func graphQLRequestFrom(ctx context.Context) graphQLRequest {
+	request, _ := ctx.Value(graphQLContextKey{}).(graphQLRequest)
+	return request
+}
+
+// amountScalar carries amounts both ways as int64 minor units, GraphQL's Int is only
+// 32 bits. Arguments also take the strings api.ParseAmount does, such as "1.5k".
+var amountScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Amount",
+	Description: "Integer minor units of " + api.Currency + ". Arguments also accept strings such as \"1_000\", \"1k\" and \"2.5m\".",
+	Serialize: func(value interface{}) interface{} {
+		switch value := value.(type) {
+		case int64:
+			return value
+		case int:
+			return int64(value)
+		}
+		return nil
+	},
+	ParseValue: func(value interface{}) interface{} {
+		switch value := value.(type) {
+		case float64:
+			return parseAmountArgument(fmt.Sprint(int64(value)), value == float64(int64(value)))
+		case string:
+			return parseAmountArgument(value, true)
+		}
+		return nil
+	},
+	ParseLiteral: func(value ast.Value) interface{} {
+		switch value := value.(type) {
+		case *ast.IntValue:
+			return parseAmountArgument(value.Value, true)
+		case *ast.StringValue:
+			return parseAmountArgument(value.Value, true)
+		}
+		return nil
+	},
+})
+
+// parseAmountArgument returns nil, which GraphQL reports as an invalid value, for
+// anything that isn't a whole number of coins
+func parseAmountArgument(text string, whole bool) interface{} {
+	amount, err := api.ParseAmount(text)
+	if err != nil || !whole {
+		return nil
+	}
+	return int64(amount)
+}
+
+var graphQLBalanceType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Balance",
+	Description: "Balance = available + held. Pending is incoming coins not in the balance yet.",
+	Fields: graphql.Fields{
+		"balance":   &graphql.Field{Type: graphql.NewNonNull(amountScalar), Resolve: balanceField(func(b api.CoinBalanceResponse) interface{} { return b.Balance })},
+		"available": &graphql.Field{Type: graphql.NewNonNull(amountScalar), Resolve: balanceField(func(b api.CoinBalanceResponse) interface{} { return b.Available })},
+		"held":      &graphql.Field{Type: graphql.NewNonNull(amountScalar), Resolve: balanceField(func(b api.CoinBalanceResponse) interface{} { return b.Held })},
+		"frozen":    &graphql.Field{Type: graphql.NewNonNull(amountScalar), Resolve: balanceField(func(b api.CoinBalanceResponse) interface{} { return b.Frozen })},
+		"pending":   &graphql.Field{Type: graphql.NewNonNull(amountScalar), Resolve: balanceField(func(b api.CoinBalanceResponse) interface{} { return b.Pending })},
+		"currency":  &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: balanceField(func(b api.CoinBalanceResponse) interface{} { return b.Currency })},
+		"state":     &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: balanceField(func(b api.CoinBalanceResponse) interface{} { return b.Status.State })},
+		"stale":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean), Resolve: balanceField(func(b api.CoinBalanceResponse) interface{} { return b.Stale })},
+	},
+})
+
+func balanceField(get func(api.CoinBalanceResponse) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(api.CoinBalanceResponse)), nil
+	}
+}
+
+var graphQLTransactionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Transaction",
+	Fields: graphql.Fields{
+		"id":                   &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: transactionField(func(tx api.Transaction) interface{} { return tx.ID })},
+		"type":                 &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: transactionField(func(tx api.Transaction) interface{} { return tx.Type })},
+		"from":                 &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: transactionField(func(tx api.Transaction) interface{} { return tx.From })},
+		"to":                   &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: transactionField(func(tx api.Transaction) interface{} { return tx.To })},
+		"amount":               &graphql.Field{Type: graphql.NewNonNull(amountScalar), Resolve: transactionField(func(tx api.Transaction) interface{} { return tx.Amount })},
+		"currency":             &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: transactionField(func(tx api.Transaction) interface{} { return tx.Currency })},
+		"timestamp":            &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: transactionField(func(tx api.Transaction) interface{} { return tx.Timestamp })},
+		"status":               &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: transactionField(func(tx api.Transaction) interface{} { return tx.Status })},
+		"flow":                 &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: transactionField(func(tx api.Transaction) interface{} { return tx.Flow })},
+		"sequence":             &graphql.Field{Type: graphql.NewNonNull(amountScalar), Resolve: transactionField(func(tx api.Transaction) interface{} { return tx.Sequence })},
+		"counterpartyNickname": &graphql.Field{Type: graphql.String, Resolve: transactionField(func(tx api.Transaction) interface{} { return tx.CounterpartyNickname })},
+	},
+})
+
+func transactionField(get func(api.Transaction) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(api.Transaction)), nil
+	}
+}
+
+var graphQLTransactionPageType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "TransactionPage",
+	Description: "Newest first. nextCursor is null on the last page.",
+	Fields: graphql.Fields{
+		"transactions": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphQLTransactionType))), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source.(api.TransactionListResponse).Transactions, nil
+		}},
+		"nextCursor": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if cursor := p.Source.(api.TransactionListResponse).NextCursor; cursor != "" {
+				return cursor, nil
+			}
+			return nil, nil
+		}},
+	},
+})
+
+var graphQLTransferType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Transfer",
+	Fields: graphql.Fields{
+		"transactionId": &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: transferField(func(t api.CoinTransferResponse) interface{} { return t.TransactionID })},
+		"fromBalance":   &graphql.Field{Type: graphql.NewNonNull(amountScalar), Resolve: transferField(func(t api.CoinTransferResponse) interface{} { return t.FromBalance })},
+		"toBalance":     &graphql.Field{Type: graphql.NewNonNull(amountScalar), Resolve: transferField(func(t api.CoinTransferResponse) interface{} { return t.ToBalance })},
+		"currency":      &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: transferField(func(t api.CoinTransferResponse) interface{} { return api.Currency })},
+		"message":       &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: transferField(func(t api.CoinTransferResponse) interface{} { return t.Message })},
+	},
+})
+
+func transferField(get func(api.CoinTransferResponse) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(api.CoinTransferResponse)), nil
+	}
+}
+
+var graphQLAmountArgs = graphql.FieldConfigArgument{
+	"amount": &graphql.ArgumentConfig{Type: graphql.NewNonNull(amountScalar)},
+}
+
+// GraphQLSchema is what /graphql serves, for the caller's own account only
+var GraphQLSchema graphql.Schema = mustGraphQLSchema()
+
+func mustGraphQLSchema() graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"balance": &graphql.Field{Type: graphql.NewNonNull(graphQLBalanceType), Resolve: resolveBalance},
+				"transactions": &graphql.Field{
+					Type: graphql.NewNonNull(graphQLTransactionPageType),
+					Args: graphql.FieldConfigArgument{
+						"limit":  &graphql.ArgumentConfig{Type: graphql.Int, Description: "Entries per page, 50 by default and at most 200"},
+						"cursor": &graphql.ArgumentConfig{Type: graphql.String, Description: "nextCursor from the previous page"},
+						"type":   &graphql.ArgumentConfig{Type: graphql.String},
+						"status": &graphql.ArgumentConfig{Type: graphql.String},
+					},
+					Resolve: resolveTransactions,
+				},
+				"transaction": &graphql.Field{
+					Type:    graphQLTransactionType,
+					Args:    graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+					Resolve: resolveTransaction,
+				},
+			},
+		}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Mutation",
+			Fields: graphql.Fields{
+				"deposit":  &graphql.Field{Type: graphql.NewNonNull(graphQLBalanceType), Args: graphQLAmountArgs, Resolve: resolveDeposit},
+				"withdraw": &graphql.Field{Type: graphql.NewNonNull(graphQLBalanceType), Args: graphQLAmountArgs, Resolve: resolveWithdraw},
+				"transfer": &graphql.Field{
+					Type: graphql.NewNonNull(graphQLTransferType),
+					Args: graphql.FieldConfigArgument{
+						"to":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "Username or saved contact nickname"},
+						"amount": &graphql.ArgumentConfig{Type: graphql.NewNonNull(amountScalar)},
+					},
+					Resolve: resolveTransfer,
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Subscription",
+			Fields: graphql.Fields{
+				"transactions": &graphql.Field{
+					Type:        graphql.NewNonNull(graphQLTransactionType),
+					Description: "Each new ledger entry of the caller's, as it is logged",
+					Subscribe:   subscribeTransactions,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// graphQLError keeps refusals the caller can act on and hides storage failures, as
+// storageErrorHandler does for REST
+func graphQLError(err error) error {
+	var accountFrozen *service.AccountFrozenError
+	var frozen *service.FrozenFundsError
+	var reserved *service.ReservedFundsError
+	var probation *service.ProbationError
+	var limit *service.LimitError
+	var pair *service.PairLimitError
+	switch {
+	case errors.Is(err, tools.ErrUserNotFound), errors.Is(err, tools.ErrOwnerNotFound),
+		errors.Is(err, tools.ErrInsufficientFunds), errors.Is(err, tools.ErrBalanceOverflow),
+		errors.Is(err, tools.ErrInvalidAmount), errors.Is(err, tools.ErrSelfTransfer), errors.Is(err, tools.ErrAccountFrozen),
+		errors.Is(err, tools.ErrStorageUnavailable), errors.Is(err, tools.ErrPrimaryUnavailable),
+		errors.As(err, &accountFrozen), errors.As(err, &frozen), errors.As(err, &reserved), errors.As(err, &probation), errors.As(err, &limit), errors.As(err, &pair):
+		return err
+	}
+	log.Error("GraphQL resolver failed: ", err)
+	return errGraphQLInternal
+}
+
+func resolveBalance(p graphql.ResolveParams) (interface{}, error) {
+	var request = graphQLRequestFrom(p.Context)
+	details, err := request.database.GetUserCoins(request.username)
+	if err != nil {
+		return nil, graphQLError(err)
+	}
+	balance, err := toAPICoinBalance(request.database, request.username, details)
+	if err != nil {
+		return nil, graphQLError(err)
+	}
+	return balance, nil
+}
+
+func resolveTransactions(p graphql.ResolveParams) (interface{}, error) {
+	var request = graphQLRequestFrom(p.Context)
+	var limit, _ = p.Args["limit"].(int)
+	var cursor, _ = p.Args["cursor"].(string)
+	var txType, _ = p.Args["type"].(string)
+	var status, _ = p.Args["status"].(string)
+
+	if limit <= 0 {
+		limit = defaultTransactionPage
+	}
+	limit = min(limit, maxTransactionPage)
+	before, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	viewer, err := loadViewer(request.database, request.username)
+	if err != nil {
+		return nil, err
+	}
+	page, next := pageTransactions(request.database, request.username, before, limit, func(tx tools.TransactionLog) bool {
+		return matchesTransactionFilter(tx, txType, status)
+	})
+	var result = api.TransactionListResponse{Transactions: make([]api.Transaction, 0, len(page))}
+	for _, tx := range page {
+		result.Transactions = append(result.Transactions, toAPITransaction(tx, viewer))
+	}
+	if next > 0 {
+		result.NextCursor = encodeCursor(next)
+	}
+	return result, nil
+}
+
+func resolveTransaction(p graphql.ResolveParams) (interface{}, error) {
+	var request = graphQLRequestFrom(p.Context)
+	var id, _ = p.Args["id"].(string)
+	tx, ok := receipts.Find(request.database, request.username, id)
+	if !ok {
+		return nil, nil
+	}
+	viewer, err := loadViewer(request.database, request.username)
+	if err != nil {
+		return nil, err
+	}
+	return toAPITransaction(tx, viewer), nil
+}
+
+// resolveDeposit credits the caller like POST /account/coins/add
+func resolveDeposit(p graphql.ResolveParams) (interface{}, error) {
+	var request = graphQLRequestFrom(p.Context)
+	var amount, _ = p.Args["amount"].(int64)
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	details, err := request.database.AddUserCoins(request.username, amount)
+	if err != nil {
+		log.Error("Failed to add coins for user: ", request.username, ": ", err)
+		return nil, graphQLError(err)
+	}
+	events.Record(request.database, events.DepositCompleted, request.username, map[string]interface{}{
+		"amount":  amount,
+		"balance": details.Coins,
+	})
+	balance, err := toAPICoinBalance(request.database, request.username, details)
+	if err != nil {
+		return nil, graphQLError(err)
+	}
+	return balance, nil
+}
+
+// resolveWithdraw debits the caller like POST /account/coins/withdraw, with the same checks
+func resolveWithdraw(p graphql.ResolveParams) (interface{}, error) {
+	var request = graphQLRequestFrom(p.Context)
+	var amount, _ = p.Args["amount"].(int64)
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	_, err := request.database.GetUserCoins(request.username)
+	if err != nil {
+		return nil, graphQLError(err)
+	}
+
+	var svc *service.Service = service.New(request.database)
+	err = svc.CheckAvailable(request.username, amount)
+	if err == nil {
+		err = svc.CheckProbation(request.username, amount)
+	}
+	if err != nil {
+		log.Error("Withdrawal refused for user: ", request.username, ": ", err)
+		return nil, graphQLError(err)
+	}
+
+	details, err := request.database.WithdrawUserCoins(request.username, amount)
+	if err != nil {
+		log.Error("Withdrawal failed for user: ", request.username, " amount: ", amount, ": ", err)
+		return nil, graphQLError(err)
+	}
+	events.Record(request.database, events.WithdrawalCompleted, request.username, map[string]interface{}{
+		"amount":  amount,
+		"balance": details.Coins,
+	})
+	balance, err := toAPICoinBalance(request.database, request.username, details)
+	if err != nil {
+		return nil, graphQLError(err)
+	}
+	return balance, nil
+}
+
+// resolveTransfer moves coins from the caller like POST /account/coins/transfer, with
+// the same checks. Netted transfers are only offered there.
+func resolveTransfer(p graphql.ResolveParams) (interface{}, error) {
+	var request = graphQLRequestFrom(p.Context)
+	var to, _ = p.Args["to"].(string)
+	var amount, _ = p.Args["amount"].(int64)
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+	if counterparty, ok := contacts.Resolve(request.database, request.username, to); ok {
+		to = counterparty
+	}
+
+	var svc *service.Service = service.New(request.database)
+	err := svc.CheckAvailable(request.username, amount)
+	if err == nil {
+		err = svc.CheckProbation(request.username, amount)
+	}
+	if err == nil {
+		err = svc.CheckLimits(request.username, amount)
+	}
+	if err == nil {
+		err = svc.CheckPairLimits(request.username, to, amount)
+	}
+	if err != nil {
+		log.Error("Transfer refused for users: ", request.username, " -> ", to, ": ", err)
+		return nil, graphQLError(err)
+	}
+
+	fromDetails, toDetails, err := request.database.TransferUserCoinsWithContext(p.Context, request.username, to, amount)
+	if err != nil {
+		log.Error("Transfer failed for users: ", request.username, " -> ", to, " amount: ", amount, ": ", err)
+		if coins, readErr := request.database.GetUserCoins(request.username); errors.Is(err, tools.ErrInsufficientFunds) && readErr == nil {
+			return nil, errors.New(messages.RenderIn(profiles.Locale(request.database, request.username), messages.InsufficientFunds, messages.Values{
+				"amount":  amount,
+				"balance": coins.Coins,
+			}))
+		}
+		return nil, graphQLError(err)
+	}
+
+	events.Record(request.database, events.TransferCompleted, request.username, map[string]interface{}{
+		"from":   request.username,
+		"to":     to,
+		"amount": amount,
+	})
+	return api.CoinTransferResponse{
+		Message:       messages.RenderIn(profiles.Locale(request.database, request.username), messages.TransferSuccess, messages.Values{"amount": amount, "to": to, "balance": fromDetails.Coins}),
+		FromBalance:   fromDetails.Coins,
+		ToBalance:     toDetails.Coins,
+		TransactionID: fromDetails.TransactionID,
+	}, nil
+}
+
+// subscribeTransactions feeds the caller's new ledger entries to the subscription until
+// the request ends or the server shuts down
+func subscribeTransactions(p graphql.ResolveParams) (interface{}, error) {
+	var request = graphQLRequestFrom(p.Context)
+	if !request.database.Capabilities().Streaming {
+		return nil, errStreamingUnsupported
+	}
+	viewer, err := loadViewer(request.database, request.username)
+	if err != nil {
+		return nil, err
+	}
+
+	updates, unsubscribe := tools.Subscribe(request.database, request.username)
+	var entries = make(chan interface{})
+	go func() {
+		defer close(entries)
+		defer unsubscribe()
+		for {
+			select {
+			case <-p.Context.Done():
+				return
+			case <-streamsClosed:
+				return
+			case tx, ok := <-updates:
+				// Closed when the client fell behind, it subscribes again
+				if !ok {
+					return
+				}
+				select {
+				case entries <- toAPITransaction(tx, viewer):
+				case <-p.Context.Done():
+					return
+				}
+			}
+		}
+	}()
+	return entries, nil
+}
+
+// operationOf parses query and returns the operation that would run, nil when
+// operationName doesn't pick exactly one
+func operationOf(query string, operationName string) (*ast.OperationDefinition, error) {
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(query), Name: "GraphQL request"})})
+	if err != nil {
+		return nil, err
+	}
+	var operation *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		candidate, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" && operation != nil {
+			return nil, errors.New("operationName is required when the query has several operations")
+		}
+		if operationName == "" || candidate.Name != nil && candidate.Name.Value == operationName {
+			operation = candidate
+		}
+	}
+	if operation == nil {
+		return nil, fmt.Errorf("no operation named %q in the query", operationName)
+	}
+	return operation, nil
+}
+
+// GraphQL runs a query or mutation against the caller's account and answers with the
+// GraphQL result. A subscription answers with a server-sent event per result instead,
+// "next" events until the client leaves, then "complete".
+func GraphQL(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		api.UnsupportedMediaTypeErrorHandler(w, errUnsupportedMediaType)
+		return
+	}
+	var params = api.GraphQLParams{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMutationBody)).Decode(&params)
+	if err != nil {
+		log.Error("Failed to parse request body: ", err)
+		api.RequestErrorHandler(w, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	if params.Query == "" {
+		api.RequestErrorHandler(w, errGraphQLQueryRequired)
+		return
+	}
+
+	// A document that doesn't parse never reaches execution, refuse it like any bad request
+	operation, err := operationOf(params.Query, params.OperationName)
+	if err != nil {
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	var ctx = context.WithValue(r.Context(), graphQLContextKey{}, graphQLRequest{username: username, database: *database})
+	var request = graphql.Params{
+		Schema:         GraphQLSchema,
+		RequestString:  params.Query,
+		VariableValues: params.Variables,
+		OperationName:  params.OperationName,
+		Context:        ctx,
+	}
+
+	if operation.Operation == ast.OperationTypeSubscription {
+		streamGraphQL(w, r, request)
+		return
+	}
+
+	var result *graphql.Result = graphql.Do(request)
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// streamGraphQL writes each subscription result as a "next" event
+func streamGraphQL(w http.ResponseWriter, r *http.Request, request graphql.Params) {
+	ctx, cancel := context.WithCancel(request.Context)
+	defer cancel()
+	request.Context = ctx
+
+	var results = graphql.Subscribe(request)
+	defer func() {
+		// The executor may be blocked handing over a result nobody will read
+		go func() {
+			for range results {
+			}
+		}()
+	}()
+
+	var controller *http.ResponseController = http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	err := controller.Flush()
+
+	var heartbeat = time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for err == nil {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-streamsClosed:
+			return
+		case result, ok := <-results:
+			if !ok {
+				_, err = fmt.Fprint(w, "event: complete\ndata:\n\n")
+				if err == nil {
+					err = controller.Flush()
+				}
+				return
+			}
+			data, marshalErr := json.Marshal(result)
+			if marshalErr != nil {
+				log.Error("Failed to encode subscription result: ", marshalErr)
+				return
+			}
+			_, err = fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		if err == nil {
+			err = controller.Flush()
+		}
+	}
+	// Headers are already sent, all we can do is stop
+	log.Error("Failed to write GraphQL stream: ", err)
+}
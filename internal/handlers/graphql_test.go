@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+type graphQLResult struct {
+	Data   map[string]interface{}
+	Errors []struct{ Message string }
+}
+
+func TestGraphQL(t *testing.T) {
+	logins, coins := tools.DemoAccounts()
+	database, err := tools.NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	var router = New(*database)
+
+	do := func(t *testing.T, body string) (int, graphQLResult) {
+		req := httptest.NewRequest(http.MethodPost, "/graphql?username=aaron", strings.NewReader(body))
+		req.Header.Set("Authorization", "1")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var result graphQLResult
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to decode %q: %v", w.Body.String(), err)
+			}
+		}
+		return w.Code, result
+	}
+
+	t.Run("Balance_Query", func(t *testing.T) {
+		code, result := do(t, `{"query": "{ balance { balance currency } }"}`)
+		var balance, _ = result.Data["balance"].(map[string]interface{})
+		if code != http.StatusOK || len(result.Errors) > 0 || balance["balance"] != float64(1000) || balance["currency"] != "COIN" {
+			t.Errorf("Unexpected result %d %+v", code, result)
+		}
+	})
+
+	t.Run("Transfer_Mutation_With_Variables", func(t *testing.T) {
+		code, result := do(t, `{"query": "mutation Pay($amount: Amount!) { transfer(to: \"bryan\", amount: $amount) { fromBalance toBalance } }", "variables": {"amount": "40"}}`)
+		var transfer, _ = result.Data["transfer"].(map[string]interface{})
+		if code != http.StatusOK || len(result.Errors) > 0 || transfer["fromBalance"] != float64(960) {
+			t.Errorf("Unexpected result %d %+v", code, result)
+		}
+
+		code, result = do(t, `{"query": "mutation { withdraw(amount: 1000000) { balance } }"}`)
+		if code != http.StatusOK || len(result.Errors) != 1 || result.Data["withdraw"] != nil {
+			t.Errorf("Expected the overdraft refused, got %d %+v", code, result)
+		}
+	})
+
+	t.Run("Transactions_Are_Paged", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			(*database).TransferUserCoins("aaron", "bryan", 1)
+		}
+		code, result := do(t, `{"query": "{ transactions(limit: 2) { transactions { id amount } nextCursor } }"}`)
+		var page, _ = result.Data["transactions"].(map[string]interface{})
+		var entries, _ = page["transactions"].([]interface{})
+		cursor, _ := page["nextCursor"].(string)
+		if code != http.StatusOK || len(entries) != 2 || cursor == "" {
+			t.Fatalf("Unexpected first page %d %+v", code, result)
+		}
+
+		var last = entries[1].(map[string]interface{})["id"]
+
+		code, result = do(t, `{"query": "query($cursor: String) { transactions(limit: 2, cursor: $cursor) { transactions { id } } }", "variables": {"cursor": "`+cursor+`"}}`)
+		page, _ = result.Data["transactions"].(map[string]interface{})
+		entries, _ = page["transactions"].([]interface{})
+		if code != http.StatusOK || len(entries) == 0 || entries[0].(map[string]interface{})["id"] == last {
+			t.Errorf("Expected the next page to carry on after %v, got %d %+v", last, code, result)
+		}
+	})
+
+	t.Run("Bad_Requests_Refused", func(t *testing.T) {
+		for _, body := range []string{`{}`, `{"query": "{ balance {"}`, `{"query": "query A { balance { balance } } query B { balance { held } }"}`} {
+			if code, _ := do(t, body); code != http.StatusBadRequest {
+				t.Errorf("Expected 400 for %s, got %d", body, code)
+			}
+		}
+	})
+
+	t.Run("Subscription_Streams_New_Transactions", func(t *testing.T) {
+		var server = httptest.NewServer(router)
+		defer server.Close()
+
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/graphql?username=aaron", strings.NewReader(`{"query": "subscription { transactions { from amount } }"}`))
+		req.Header.Set("Authorization", "1")
+		req.Header.Set("Content-Type", "application/json")
+		var client = &http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to open the stream: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+
+		// The subscription starts after the headers, transfer until one arrives
+		var done = make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				(*database).TransferUserCoins("bryan", "aaron", 5)
+				select {
+				case <-done:
+					return
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+		}()
+
+		var event = readEvent(t, bufio.NewReader(resp.Body))
+		var result graphQLResult
+		if err := json.Unmarshal([]byte(event.data), &result); err != nil {
+			t.Fatalf("Failed to decode %q: %v", event.data, err)
+		}
+		var tx, _ = result.Data["transactions"].(map[string]interface{})
+		if event.name != "next" || tx["from"] != "bryan" || tx["amount"] != float64(5) {
+			t.Errorf("Unexpected event %+v", event)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/service"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetHolds lists what is holding back part of the caller's balance
+func GetHolds(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.HoldListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	holds, err := service.New(*database).Holds(username)
+	if err != nil {
+		log.Error("Failed to read balance for user: ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.HoldListResponse{
+		Code:      http.StatusOK,
+		Balance:   holds.Balance,
+		Available: holds.Available,
+		Held:      holds.Held,
+		Holds:     []api.Hold{},
+	}
+	for _, hold := range holds.Holds {
+		response.Holds = append(response.Holds, api.Hold(hold))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// GetPendingOperations lists approvals and background jobs still open for the caller
+func GetPendingOperations(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.PendingListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	operations, err := service.New(*database).PendingOperations(username)
+	if err != nil {
+		log.Error("Failed to read balance for user: ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.PendingListResponse{Code: http.StatusOK, Operations: []api.PendingOperation{}}
+	for _, operation := range operations {
+		response.Operations = append(response.Operations, api.PendingOperation(operation))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/leaderboard"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetLeaderboard is public and serves the cached board, only accounts whose owners
+// opted in appear on it
+func GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	var params = api.LeaderboardParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var size int = config.Get().LeaderboardSize
+	if params.Limit == 0 {
+		params.Limit = 10
+	}
+	if params.Limit < 0 || params.Limit > size {
+		api.RequestErrorHandler(w, fmt.Errorf("limit must be between 1 and %d", size))
+		return
+	}
+
+	// Until the first scheduled refresh the board is computed here
+	board := leaderboard.Current()
+	if board.ComputedAt.IsZero() {
+		database, err := tools.OpenDatabase(r.Context())
+		if err != nil {
+			log.Error("Failed to connect to database: ", err)
+			api.InternalErrorHandler(w)
+			return
+		}
+		board, err = leaderboard.Refresh(*database, size)
+		if err != nil {
+			log.Error("Failed to compute leaderboard: ", err)
+			storageErrorHandler(w, err)
+			return
+		}
+	}
+
+	var entries = make([]api.LeaderboardEntry, 0, params.Limit)
+	for _, entry := range board.Entries {
+		if len(entries) == params.Limit {
+			break
+		}
+		entries = append(entries, api.LeaderboardEntry(entry))
+	}
+
+	var response = api.LeaderboardResponse{
+		Code:       http.StatusOK,
+		Entries:    entries,
+		ComputedAt: board.ComputedAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=10")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
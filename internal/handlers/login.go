@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/middleware"
+	"github.com/bryantjandra/goapi/internal/tokens"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+var errNotJWTMode = fmt.Errorf("sessions are only available in the %s auth mode", config.AuthModeJWT)
+
+// Login exchanges the static token Authorization checked for an access token and a
+// refresh token
+func Login(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var cfg config.Config = config.Get()
+	if cfg.AuthMode != config.AuthModeJWT {
+		api.NotFoundErrorHandler(w, errNotJWTMode)
+		return
+	}
+
+	var params = api.LoginParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	issuer, err := middleware.TokenIssuer(cfg)
+	if err != nil {
+		log.Error("Failed to load access token key: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	session, err := issuer.StartSession(*database, username)
+	if err != nil {
+		log.Error("Failed to issue tokens for ", username, ": ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+	log.Info("Issued access token for ", username, " until ", session.Access.ExpiresAt)
+
+	writeSession(w, session)
+}
+
+// RefreshSession trades a refresh token for a new access token and refresh token. The
+// refresh token is the only credential, so it isn't behind Authorization.
+func RefreshSession(w http.ResponseWriter, r *http.Request) {
+	var cfg config.Config = config.Get()
+	if cfg.AuthMode != config.AuthModeJWT {
+		api.NotFoundErrorHandler(w, errNotJWTMode)
+		return
+	}
+
+	var params = api.RefreshParams{}
+	var err error = json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMutationBody)).Decode(&params)
+	if err != nil {
+		log.Error("Failed to parse request body: ", err)
+		api.RequestErrorHandler(w, fmt.Errorf("invalid JSON body: %w", err))
+		return
+	}
+
+	issuer, err := middleware.TokenIssuer(cfg)
+	if err != nil {
+		log.Error("Failed to load access token key: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	session, err := issuer.Refresh(*database, params.RefreshToken)
+	if errors.Is(err, tokens.ErrInvalidRefreshToken) {
+		log.Error("Refresh failed: ", err)
+		api.RequestErrorHandler(w, tokens.ErrInvalidRefreshToken)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to refresh session: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	writeSession(w, session)
+}
+
+// Logout revokes the access token the request came with and the session of the refresh
+// token, or every session of the user
+func Logout(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var cfg config.Config = config.Get()
+	if cfg.AuthMode != config.AuthModeJWT {
+		api.NotFoundErrorHandler(w, errNotJWTMode)
+		return
+	}
+
+	var params = api.LogoutParams{}
+	var err error = decodeMutation(w, r, &params)
+	if errors.Is(err, errUnsupportedMediaType) {
+		api.UnsupportedMediaTypeErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	issuer, err := middleware.TokenIssuer(cfg)
+	if err != nil {
+		log.Error("Failed to load access token key: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	revoked, err := tokens.Logout(*database, username, params.RefreshToken, params.All)
+	if errors.Is(err, tokens.ErrInvalidRefreshToken) {
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to revoke refresh tokens for ", username, ": ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	// Authorization already verified it, so this only fails if it was never a bearer token
+	claims, err := issuer.VerifyClaims(r.Header.Get("Authorization"))
+	if err == nil {
+		tokens.Revoke(claims)
+	}
+	log.Info("Logged out ", username, ", revoked ", revoked, " refresh tokens")
+
+	var response = api.LogoutResponse{
+		Code:    http.StatusOK,
+		Revoked: revoked,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+func writeSession(w http.ResponseWriter, session tokens.Session) {
+	var response = api.LoginResponse{
+		Code:             http.StatusOK,
+		AccessToken:      session.Access.Value,
+		TokenType:        "Bearer",
+		ExpiresAt:        session.Access.ExpiresAt,
+		RefreshToken:     session.Refresh.Value,
+		RefreshExpiresAt: session.Refresh.ExpiresAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var err error = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
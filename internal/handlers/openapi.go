@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/buildinfo"
+	log "github.com/sirupsen/logrus"
+)
+
+// Routes anyone can call, every other one needs an Authorization header
+var publicRoutes = map[string]bool{
+	"/status":            true,
+	"/version":           true,
+	"/readyz":            true,
+	"/leaderboard":       true,
+	"/downloads/{token}": true,
+	"/auth/refresh":      true,
+	"/signup":            true,
+	"/openapi.json":      true,
+	"/docs":              true,
+}
+
+// Swagger UI from a CDN, pointed at /openapi.json. Try it out sends the token entered
+// under Authorize as the Authorization header.
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>goapi</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui", persistAuthorization: true});
+  </script>
+</body>
+</html>
+`
+
+var (
+	openAPIOnce sync.Once
+	openAPIBody []byte
+)
+
+// OpenAPISpec is the document served at /openapi.json: ParamsSpec, which comes from the
+// api structs in Routes, plus the service's version, how callers authenticate and a tag
+// per top-level path so the docs group related routes
+func OpenAPISpec() map[string]interface{} {
+	var spec = ParamsSpec()
+	spec["info"] = map[string]interface{}{
+		"title":       "goapi",
+		"version":     buildinfo.Get().Version,
+		"description": "Amounts are integers in minor units of " + api.Currency + ". Refusals are an Error with the HTTP status as Code.",
+	}
+	spec["components"] = map[string]interface{}{
+		"securitySchemes": map[string]interface{}{
+			"token": map[string]interface{}{"type": "apiKey", "in": "header", "name": "Authorization"},
+		},
+	}
+
+	for pattern, methods := range spec["paths"].(map[string]interface{}) {
+		var tag string = strings.SplitN(strings.TrimPrefix(pattern, "/"), "/", 2)[0]
+		for _, operation := range methods.(map[string]interface{}) {
+			var op = operation.(map[string]interface{})
+			op["tags"] = []string{tag}
+			if !publicRoutes[pattern] {
+				op["security"] = []interface{}{map[string]interface{}{"token": []string{}}}
+			}
+		}
+	}
+	return spec
+}
+
+// GetOpenAPISpec serves OpenAPISpec, which only changes with the binary
+func GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		body, err := json.Marshal(OpenAPISpec())
+		if err != nil {
+			log.Error("Failed to encode the OpenAPI spec: ", err)
+			return
+		}
+		openAPIBody = body
+	})
+	if openAPIBody == nil {
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIBody)
+}
+
+// GetDocs serves Swagger UI for the spec
+func GetDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
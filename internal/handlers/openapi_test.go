@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	var router = newTestRouter(t)
+
+	t.Run("Spec_Covers_Every_Route", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("Expected the spec, got %d %s", w.Code, w.Header().Get("Content-Type"))
+		}
+
+		var spec struct {
+			OpenAPI string
+			Paths   map[string]map[string]struct {
+				Security  []map[string][]string
+				Tags      []string
+				Responses map[string]struct {
+					Headers map[string]interface{}
+				}
+			}
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+			t.Fatalf("Failed to parse the spec: %v", err)
+		}
+		for _, route := range Routes {
+			if _, ok := spec.Paths[route.Pattern][strings.ToLower(route.Method)]; !ok {
+				t.Errorf("%s %s is missing from the spec", route.Method, route.Pattern)
+			}
+		}
+
+		var balance = spec.Paths["/account/coins"]["get"]
+		if len(balance.Security) != 1 || len(balance.Tags) != 1 || balance.Tags[0] != "account" {
+			t.Errorf("Expected /account/coins to need a token and be tagged account, got %+v", balance)
+		}
+		if status := spec.Paths["/status"]["get"]; len(status.Security) != 0 {
+			t.Errorf("Expected /status to be public, got %+v", status)
+		}
+
+		if limited := balance.Responses["429"]; limited.Headers["Retry-After"] == nil || balance.Responses["2XX"].Headers["RateLimit-Reset"] == nil {
+			t.Errorf("Expected /account/coins to document the rate limit headers, got %+v", balance.Responses)
+		}
+		if _, ok := spec.Paths["/login"]["post"].Responses["429"]; ok {
+			t.Errorf("Expected /login, which isn't rate limited, to have no 429")
+		}
+	})
+
+	t.Run("Docs_Load_The_Spec", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `url: "/openapi.json"`) {
+			t.Errorf("Expected Swagger UI for /openapi.json, got %d %s", w.Code, w.Body.String())
+		}
+	})
+}
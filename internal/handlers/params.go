@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/gorilla/schema"
+)
+
+// Largest JSON body a mutation accepts
+const maxMutationBody = 1 << 16
+
+var errUnsupportedMediaType = errors.New("request body must be JSON, send Content-Type: application/json")
+
+var errQueryMutation = errors.New("query parameters are no longer accepted here, send a JSON body with Content-Type: application/json")
+
+// Query decoders are shared so their per-type field cache survives between requests,
+// one per StrictQueryParams setting since it can change at runtime. schema.Decoder is
+// safe for concurrent use once configured.
+var strictDecoder, lenientDecoder = newQueryDecoder(true), newQueryDecoder(false)
+
+func newQueryDecoder(strict bool) *schema.Decoder {
+	var decoder *schema.Decoder = schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(!strict)
+	return decoder
+}
+
+// Parameter names by params type, see recognizedParams
+var paramNames sync.Map
+
+// decodeMutation decodes a mutation's parameters from its JSON body. The username stays
+// in the query, where Authorization checked it, and a body naming anyone else is refused.
+// Without a body the query is decoded as before while AllowQueryMutations is on, with
+// Deprecation and Warning headers.
+func decodeMutation(w http.ResponseWriter, r *http.Request, params interface{}) error {
+	var query url.Values = r.URL.Query()
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		if r.ContentLength != 0 {
+			return errUnsupportedMediaType
+		}
+		if !config.Get().AllowQueryMutations {
+			return errQueryMutation
+		}
+
+		w.Header().Set("Deprecation", "true")
+		w.Header().Add("Warning", `299 - "Query parameters are deprecated for this endpoint, send a JSON body"`)
+		return decodeQuery(params, query)
+	}
+
+	// Mixing the two would leave it unclear which value wins
+	for _, name := range recognizedParams(params) {
+		if name != "username" && query.Has(name) {
+			return fmt.Errorf("parameter %s belongs in the JSON body, only username goes in the query", name)
+		}
+	}
+
+	var decoder *json.Decoder = json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMutationBody))
+	if config.Get().StrictQueryParams {
+		decoder.DisallowUnknownFields()
+	}
+	var err error = decoder.Decode(params)
+	if errors.Is(err, api.ErrInvalidAmount) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+
+	var username reflect.Value = reflect.ValueOf(params).Elem().FieldByName("Username")
+	if named := username.String(); named != "" && named != query.Get("username") {
+		return fmt.Errorf("body username %q doesn't match the authenticated user", named)
+	}
+	username.SetString(query.Get("username"))
+	return nil
+}
+
+// decodeQuery decodes query parameters into params. In strict mode unknown keys are
+// rejected with the list of parameters the endpoint accepts, so typos like amout=100
+// are easy to spot.
+func decodeQuery(params interface{}, query url.Values) error {
+	var decoder *schema.Decoder = lenientDecoder
+	if config.Get().StrictQueryParams {
+		decoder = strictDecoder
+	}
+
+	var err error = decoder.Decode(params, query)
+	if err == nil {
+		return nil
+	}
+
+	var multiErr schema.MultiError
+	if !errors.As(err, &multiErr) {
+		return err
+	}
+
+	var unknown []string
+	for _, keyErr := range multiErr {
+		var unknownKey schema.UnknownKeyError
+		if errors.As(keyErr, &unknownKey) {
+			unknown = append(unknown, unknownKey.Key)
+		}
+
+		// Amount errors already say what is accepted, without schema's wrapping
+		var conversion schema.ConversionError
+		if errors.As(keyErr, &conversion) && errors.Is(conversion.Err, api.ErrInvalidAmount) {
+			return conversion.Err
+		}
+	}
+
+	if len(unknown) == 0 {
+		return err
+	}
+
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown parameter(s) %s, recognized parameters are: %s",
+		strings.Join(unknown, ", "), strings.Join(recognizedParams(params), ", "))
+}
+
+// recognizedParams lists the query keys a params struct accepts. The list is worked out
+// once per type and shared, callers must not modify it.
+func recognizedParams(params interface{}) []string {
+	var t reflect.Type = reflect.TypeOf(params)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if names, ok := paramNames.Load(t); ok {
+		return names.([]string)
+	}
+
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := strings.ToLower(field.Name)
+		if tag := strings.Split(field.Tag.Get("schema"), ",")[0]; tag != "" && tag != "-" {
+			name = tag
+		}
+		names = append(names, name)
+	}
+
+	paramNames.Store(t, names)
+	return names
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/config"
+)
+
+func TestDecodeQuery(t *testing.T) {
+	t.Run("Strict_Mode_Lists_Recognized_Fields", func(t *testing.T) {
+		config.Set(config.Config{StrictQueryParams: true})
+		defer config.Set(config.Default())
+
+		var params api.CoinAdditionParams
+		err := decodeQuery(&params, url.Values{"username": {"aaron"}, "amout": {"100"}})
+		if err == nil {
+			t.Fatalf("Expected typo to be rejected")
+		}
+
+		for _, expected := range []string{"amout", "username", "amount"} {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("Expected error to mention %q, got: %v", expected, err)
+			}
+		}
+	})
+
+	t.Run("Lenient_Mode_Ignores_Unknown_Fields", func(t *testing.T) {
+		config.Set(config.Config{StrictQueryParams: false})
+		defer config.Set(config.Default())
+
+		var params api.CoinAdditionParams
+		err := decodeQuery(&params, url.Values{"username": {"aaron"}, "amount": {"5"}, "extra": {"1"}})
+		if err != nil {
+			t.Fatalf("Expected unknown parameter to be ignored, got: %v", err)
+		}
+		if params.Amount != 5 {
+			t.Errorf("Expected amount 5, got %d", params.Amount)
+		}
+	})
+
+	t.Run("Human_Friendly_Amounts", func(t *testing.T) {
+		var cases = map[string]api.Amount{
+			"1000":   1000,
+			"1_000":  1000,
+			"1k":     1000,
+			"2.5K":   2500,
+			"1.5m":   1_500_000,
+			"100.00": 100,
+			" 42 ":   42,
+			"-5":     -5,
+		}
+		for value, expected := range cases {
+			var params api.CoinAdditionParams
+			err := decodeQuery(&params, url.Values{"username": {"aaron"}, "amount": {value}})
+			if err != nil || params.Amount != expected {
+				t.Errorf("Expected %q to decode to %d, got %d (%v)", value, expected, params.Amount, err)
+			}
+		}
+
+		for _, value := range []string{"2.5", "1e3", "1__000", "_1", "ten", "1kk", "9223372036854775808", "", "0x10"} {
+			var params api.CoinAdditionParams
+			err := decodeQuery(&params, url.Values{"username": {"aaron"}, "amount": {value}})
+			if !errors.Is(err, api.ErrInvalidAmount) {
+				t.Errorf("Expected %q to be rejected as an invalid amount, got %v", value, err)
+			}
+		}
+	})
+
+	t.Run("JSON_Amounts", func(t *testing.T) {
+		var params api.CoinTransferParams
+		err := json.Unmarshal([]byte(`{"Amount": "1_500"}`), &params)
+		if err != nil || params.Amount != 1500 {
+			t.Errorf("Expected a string amount, got %d (%v)", params.Amount, err)
+		}
+
+		err = json.Unmarshal([]byte(`{"Amount": 25}`), &params)
+		if err != nil || params.Amount != 25 {
+			t.Errorf("Expected a numeric amount, got %d (%v)", params.Amount, err)
+		}
+
+		err = json.Unmarshal([]byte(`{"Amount": 0.5}`), &params)
+		if !errors.Is(err, api.ErrInvalidAmount) {
+			t.Errorf("Expected a fractional amount to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestDecodeMutation(t *testing.T) {
+	var request = func(query string, contentType string, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/account/coins/transfer?"+query, strings.NewReader(body))
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		return r
+	}
+
+	t.Run("JSON_Body", func(t *testing.T) {
+		var params api.CoinTransferParams
+		w := httptest.NewRecorder()
+		err := decodeMutation(w, request("username=aaron", "application/json; charset=utf-8", `{"From":"aaron","To":"bryan","Amount":"1k"}`), &params)
+		if err != nil {
+			t.Fatalf("Expected body to decode, got: %v", err)
+		}
+		if params.Username != "aaron" || params.To != "bryan" || params.Amount != 1000 {
+			t.Errorf("Unexpected params: %+v", params)
+		}
+		if w.Header().Get("Deprecation") != "" {
+			t.Errorf("Expected no deprecation header for a JSON body")
+		}
+	})
+
+	t.Run("Body_Cannot_Name_Another_User", func(t *testing.T) {
+		var params api.CoinAdditionParams
+		err := decodeMutation(httptest.NewRecorder(), request("username=aaron", "application/json", `{"Username":"bryan","Amount":5}`), &params)
+		if err == nil {
+			t.Errorf("Expected mismatched username to be refused")
+		}
+	})
+
+	t.Run("Query_And_Body_Not_Mixed", func(t *testing.T) {
+		var params api.CoinAdditionParams
+		err := decodeMutation(httptest.NewRecorder(), request("username=aaron&amount=5", "application/json", `{"Amount":5}`), &params)
+		if err == nil {
+			t.Errorf("Expected amount in the query to be refused alongside a body")
+		}
+	})
+
+	t.Run("Other_Content_Types_Refused", func(t *testing.T) {
+		var params api.CoinAdditionParams
+		err := decodeMutation(httptest.NewRecorder(), request("username=aaron", "text/plain", "amount=5"), &params)
+		if !errors.Is(err, errUnsupportedMediaType) {
+			t.Errorf("Expected unsupported media type, got %v", err)
+		}
+	})
+
+	t.Run("Deprecated_Query_Parameters", func(t *testing.T) {
+		var params api.CoinAdditionParams
+		w := httptest.NewRecorder()
+		err := decodeMutation(w, request("username=aaron&amount=5", "", ""), &params)
+		if err != nil || params.Amount != 5 {
+			t.Fatalf("Expected query parameters to decode, got %d (%v)", params.Amount, err)
+		}
+		if w.Header().Get("Deprecation") != "true" {
+			t.Errorf("Expected a Deprecation header")
+		}
+
+		var cfg config.Config = config.Default()
+		cfg.AllowQueryMutations = false
+		config.Set(cfg)
+		defer config.Set(config.Default())
+
+		err = decodeMutation(httptest.NewRecorder(), request("username=aaron&amount=5", "", ""), &params)
+		if !errors.Is(err, errQueryMutation) {
+			t.Errorf("Expected query parameters to be refused once the flag is off, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/contacts"
+	"github.com/bryantjandra/goapi/internal/holds"
+	"github.com/bryantjandra/goapi/internal/service"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+func toAPIPaymentHold(hold holds.Hold) api.PaymentHold {
+	var result = api.PaymentHold{
+		ID:            hold.ID,
+		From:          hold.From,
+		To:            hold.To,
+		Amount:        hold.Amount,
+		Memo:          hold.Memo,
+		Status:        hold.Status,
+		PlacedAt:      hold.PlacedAt,
+		ExpiresAt:     hold.ExpiresAt,
+		Captured:      hold.Captured,
+		TransactionID: hold.TransactionID,
+	}
+	if !hold.ResolvedAt.IsZero() {
+		resolvedAt := hold.ResolvedAt
+		result.ResolvedAt = &resolvedAt
+	}
+	return result
+}
+
+func writePaymentHold(w http.ResponseWriter, code int, hold holds.Hold, err error) {
+	if errors.Is(err, holds.ErrNotFound) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, holds.ErrNotAuthorized) || errors.Is(err, holds.ErrInsufficientFunds) || errors.Is(err, holds.ErrCaptureFailed) {
+		log.Error("Hold refused: ", err)
+		api.ConflictErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, holds.ErrInvalidHold) || errors.Is(err, holds.ErrDisabled) {
+		log.Error("Hold refused: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Hold refused: ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.PaymentHoldResponse{
+		Code: code,
+		Hold: toAPIPaymentHold(hold),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		return
+	}
+}
+
+// PlaceHold authorizes a payment to another account without moving the coins, the
+// checks a transfer gets run now
+func PlaceHold(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+
+	var params = api.HoldParams{}
+	var err error = decodeMutation(w, r, &params)
+
+	if errors.Is(err, errUnsupportedMediaType) {
+		log.Error("Failed to parse request body: ", err)
+		api.UnsupportedMediaTypeErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	if params.Amount <= 0 {
+		log.Error("Invalid amount: must be positive, got: ", params.Amount)
+		api.RequestErrorHandler(w, fmt.Errorf("amount must be positive"))
+		return
+	}
+	var amount int64 = int64(params.Amount)
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	if counterparty, ok := contacts.Resolve(*database, username, params.To); ok {
+		params.To = counterparty
+	}
+
+	if _, err = (*database).GetUserCoins(params.To); err != nil {
+		log.Error("Hold payee lookup failed: ", params.To, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+	if _, err = (*database).GetUserCoins(username); err != nil {
+		log.Error("Failed to read balance for user: ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var svc *service.Service = service.New(*database)
+
+	err = svc.CheckAvailable(username, amount)
+	if err != nil {
+		log.Error("Hold refused for user: ", username, ": ", err)
+		availabilityErrorHandler(w, err)
+		return
+	}
+
+	err = svc.CheckProbation(username, amount)
+	if err != nil {
+		log.Error("Hold refused for user: ", username, ": ", err)
+		api.TooManyRequestsErrorHandler(w, err)
+		return
+	}
+
+	err = svc.CheckLimits(username, amount)
+	if err != nil {
+		log.Error("Hold refused for user: ", username, ": ", err)
+		api.TooManyRequestsErrorHandler(w, err)
+		return
+	}
+
+	err = svc.CheckPairLimits(username, params.To, amount)
+	if err != nil {
+		log.Error("Hold refused for users: ", username, " -> ", params.To, ": ", err)
+		api.TooManyRequestsErrorHandler(w, err)
+		return
+	}
+
+	hold, err := holds.Place(*database, username, params.To, amount, params.Memo, config.Get().HoldTTL, time.Now())
+	writePaymentHold(w, http.StatusCreated, hold, err)
+}
+
+// CaptureHold moves a hold's coins to the caller, its payee
+func CaptureHold(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+
+	var params = api.HoldCaptureParams{}
+	var err error = decodeMutation(w, r, &params)
+
+	if errors.Is(err, errUnsupportedMediaType) {
+		log.Error("Failed to parse request body: ", err)
+		api.UnsupportedMediaTypeErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	hold, err := holds.Capture(*database, chi.URLParam(r, "id"), username, int64(params.Amount), time.Now())
+	writePaymentHold(w, http.StatusOK, hold, err)
+}
+
+// ReleaseHold frees a hold's coins for its payer, only the payee can release it early
+func ReleaseHold(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.HoldReleaseParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	hold, err := holds.Release(*database, chi.URLParam(r, "id"), username, time.Now())
+	writePaymentHold(w, http.StatusOK, hold, err)
+}
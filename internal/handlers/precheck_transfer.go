@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/contacts"
+	"github.com/bryantjandra/goapi/internal/service"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// PrecheckTransfer tells front-ends whether a transfer would go through, it never moves coins
+func PrecheckTransfer(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.TransferPrecheckParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	if counterparty, ok := contacts.Resolve(*database, username, params.To); ok {
+		params.To = counterparty
+	}
+
+	verdict, err := service.New(*database).PrecheckTransfer(username, params.To, int64(params.Amount))
+	if err != nil {
+		log.Error("Failed to precheck transfer for user: ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.TransferPrecheckResponse{
+		Code:           http.StatusOK,
+		Allowed:        verdict.Allowed,
+		BlockedBy:      verdict.BlockedBy,
+		Available:      verdict.Available,
+		DailyRemaining: verdict.DailyRemaining,
+		Pair: api.PairAllowance{
+			HourlyCountRemaining:  verdict.Pair.HourlyCountRemaining,
+			HourlyAmountRemaining: verdict.Pair.HourlyAmountRemaining,
+			DailyCountRemaining:   verdict.Pair.DailyCountRemaining,
+			DailyAmountRemaining:  verdict.Pair.DailyAmountRemaining,
+		},
+	}
+	if !verdict.Pair.RetryAt.IsZero() {
+		response.Pair.RetryAt = &verdict.Pair.RetryAt
+	}
+	if !verdict.ProbationEndsAt.IsZero() {
+		response.ProbationEndsAt = &verdict.ProbationEndsAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
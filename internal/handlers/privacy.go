@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/contacts"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/freezes"
+	"github.com/bryantjandra/goapi/internal/privacy"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/webhooks"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+func toAPIDataDeletion(request privacy.Request) api.DataDeletion {
+	var result = api.DataDeletion{
+		ID:          request.ID,
+		Username:    request.Username,
+		Reason:      request.Reason,
+		Status:      request.Status,
+		RequestedAt: request.RequestedAt,
+		DecidedBy:   request.DecidedBy,
+		Note:        request.Note,
+	}
+	if !request.DecidedAt.IsZero() {
+		decidedAt := request.DecidedAt
+		result.DecidedAt = &decidedAt
+	}
+	return result
+}
+
+func writeDataDeletion(w http.ResponseWriter, status int, request privacy.Request, err error) {
+	if errors.Is(err, privacy.ErrRequestNotFound) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, privacy.ErrNotPending) || errors.Is(err, privacy.ErrAlreadyRequested) || errors.Is(err, privacy.ErrNotEmpty) {
+		api.ConflictErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, privacy.ErrSelfApproval) {
+		api.ForbiddenErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Account deletion failed: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var response = api.DataDeletionResponse{
+		Code:     status,
+		Deletion: toAPIDataDeletion(request),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		return
+	}
+}
+
+// ExportAccountData returns everything stored about the caller as one JSON document
+func ExportAccountData(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.DataExportParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	viewer, err := loadViewer(*database, username)
+	if err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.DataExportResponse{
+		Code:         http.StatusOK,
+		GeneratedAt:  time.Now(),
+		Login:        api.DataExportLogin{Username: username},
+		Profile:      toAPIProfile(viewer.profile),
+		Transactions: []api.Transaction{},
+		Contacts:     []api.Contact{},
+		Webhooks:     []api.Webhook{},
+		Freezes:      []api.Freeze{},
+		Events:       []api.DomainEvent{},
+	}
+	if login := (*database).GetUserLoginDetails(username); login != nil {
+		response.Login.Role = login.Role
+	}
+	if details, err := (*database).GetUserCoins(username); err == nil {
+		response.Balance = details.Coins
+	}
+	for _, tx := range (*database).GetTransactionHistory(username) {
+		response.Transactions = append(response.Transactions, toAPITransaction(tx, viewer))
+	}
+	contactList, err := contacts.List(*database, username)
+	if err != nil {
+		log.Error("Failed to read contacts for user: ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+	for _, contact := range contactList {
+		response.Contacts = append(response.Contacts, api.Contact(contact))
+	}
+	for _, subscription := range webhooks.List(*database, webhooks.TierAccount, username) {
+		response.Webhooks = append(response.Webhooks, toAPIWebhook(subscription))
+	}
+	accountFreezes, err := freezes.List(*database, username)
+	if err != nil {
+		log.Error("Failed to read freezes for user: ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+	for _, freeze := range accountFreezes {
+		response.Freezes = append(response.Freezes, toAPIFreeze(freeze))
+	}
+	for _, event := range events.About(*database, username) {
+		response.Events = append(response.Events, api.DomainEvent(event))
+	}
+
+	log.Info("Account data exported for ", username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"account-data-%s.json\"", username))
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// RequestDataDeletion asks for the caller's personal data to be erased, an admin has to approve it
+func RequestDataDeletion(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.DataDeletionParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	if refuseCoOwner(w, r) {
+		return
+	}
+
+	request, err := privacy.RequestDeletion(tools.AttachedDatabase(r.Context()), username, params.Reason)
+	writeDataDeletion(w, http.StatusAccepted, request, err)
+}
+
+func ListDataDeletions(w http.ResponseWriter, r *http.Request) {
+	var params = api.DataDeletionDecisionParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var deletions = []api.DataDeletion{}
+	for _, request := range privacy.List(tools.AttachedDatabase(r.Context())) {
+		deletions = append(deletions, toAPIDataDeletion(request))
+	}
+
+	var response = api.DataDeletionListResponse{
+		Code:      http.StatusOK,
+		Deletions: deletions,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// ApproveDataDeletion pseudonymizes the account, refused while it still holds coins
+func ApproveDataDeletion(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.DataDeletionDecisionParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	request, err := privacy.Approve(*database, chi.URLParam(r, "id"), username)
+	writeDataDeletion(w, http.StatusOK, request, err)
+}
+
+func RejectDataDeletion(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.DataDeletionDecisionParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	request, err := privacy.Reject(tools.AttachedDatabase(r.Context()), chi.URLParam(r, "id"), username, params.Reason)
+	writeDataDeletion(w, http.StatusOK, request, err)
+}
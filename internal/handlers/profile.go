@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/leaderboard"
+	"github.com/bryantjandra/goapi/internal/profiles"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+func toAPIProfile(profile profiles.Profile) api.Profile {
+	var result = api.Profile{Timezone: profile.Timezone, Leaderboard: profile.Leaderboard, Locale: profile.Locale}
+	if !profile.UpdatedAt.IsZero() {
+		updatedAt := profile.UpdatedAt
+		result.UpdatedAt = &updatedAt
+	}
+	return result
+}
+
+func writeProfile(w http.ResponseWriter, profile profiles.Profile) {
+	var response = api.ProfileResponse{
+		Code:    http.StatusOK,
+		Profile: toAPIProfile(profile),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// writeProfileError answers a refused or failed profile update
+func writeProfileError(w http.ResponseWriter, err error) {
+	if errors.Is(err, profiles.ErrInvalidProfile) {
+		log.Error("Profile update rejected: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	log.Error("Failed to store profile update: ", err)
+	storageErrorHandler(w, err)
+}
+
+func GetProfile(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.ProfileGetParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	profile, err := profiles.Get(*database, username)
+	if err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+	writeProfile(w, profile)
+}
+
+func UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.ProfileParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	if params.Timezone == "" && params.Leaderboard == nil && params.Locale == "" {
+		api.RequestErrorHandler(w, fmt.Errorf("%w: timezone, locale or leaderboard is required", profiles.ErrInvalidProfile))
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	profile, err := profiles.Get(*database, username)
+	if err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+	if params.Timezone != "" {
+		profile, err = profiles.SetTimezone(*database, username, params.Timezone)
+		if err != nil {
+			writeProfileError(w, err)
+			return
+		}
+		log.Info("Timezone for ", username, " set to ", profile.Timezone)
+	}
+
+	if params.Locale != "" {
+		profile, err = profiles.SetLocale(*database, username, params.Locale)
+		if err != nil {
+			writeProfileError(w, err)
+			return
+		}
+		log.Info("Locale for ", username, " set to ", profile.Locale)
+	}
+
+	if params.Leaderboard != nil {
+		profile, err = profiles.SetLeaderboard(*database, username, *params.Leaderboard)
+		if err != nil {
+			writeProfileError(w, err)
+			return
+		}
+		if !profile.Leaderboard {
+			leaderboard.Forget(username)
+		}
+		log.Info("Leaderboard opt-in for ", username, " set to ", profile.Leaderboard)
+	}
+
+	writeProfile(w, profile)
+}
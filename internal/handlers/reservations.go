@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/reservations"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+func toAPIReservation(reservation reservations.Reservation) api.Reservation {
+	var result = api.Reservation{
+		ID:         reservation.ID,
+		Amount:     reservation.Amount,
+		Reference:  reservation.Reference,
+		Status:     reservation.Status,
+		ReservedAt: reservation.ReservedAt,
+		ExpiresAt:  reservation.ExpiresAt,
+		Committed:  reservation.Committed,
+	}
+	if !reservation.ResolvedAt.IsZero() {
+		resolvedAt := reservation.ResolvedAt
+		result.ResolvedAt = &resolvedAt
+	}
+	return result
+}
+
+func writeReservation(w http.ResponseWriter, code int, reservation reservations.Reservation, err error) {
+	if errors.Is(err, reservations.ErrNotFound) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, reservations.ErrNotReserved) || errors.Is(err, reservations.ErrDuplicate) || errors.Is(err, reservations.ErrInsufficientFunds) || errors.Is(err, reservations.ErrCommitFailed) {
+		log.Error("Reservation refused: ", err)
+		api.ConflictErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, reservations.ErrInvalidReservation) || errors.Is(err, reservations.ErrDisabled) {
+		log.Error("Reservation refused: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Reservation refused: ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.ReservationResponse{
+		Code:        code,
+		Reservation: toAPIReservation(reservation),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		return
+	}
+}
+
+// ListReservations lists the account's open reservations newest first, or all of them
+func ListReservations(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.ReservationListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	reserved, err := reservations.Reserved(*database, username)
+	if err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+	list, err := reservations.List(*database, username, params.All)
+	if err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response = api.ReservationListResponse{
+		Code:         http.StatusOK,
+		Reserved:     reserved,
+		Reservations: []api.Reservation{},
+	}
+	for _, reservation := range list {
+		response.Reservations = append(response.Reservations, toAPIReservation(reservation))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// CreateReservation sets coins aside for a purchase until it is committed or cancelled
+func CreateReservation(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+
+	var params = api.ReservationParams{}
+	var err error = decodeMutation(w, r, &params)
+
+	if errors.Is(err, errUnsupportedMediaType) {
+		log.Error("Failed to parse request body: ", err)
+		api.UnsupportedMediaTypeErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	if params.Amount <= 0 {
+		log.Error("Invalid amount: must be positive, got: ", params.Amount)
+		api.RequestErrorHandler(w, fmt.Errorf("amount must be positive"))
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	reservation, err := reservations.Reserve(*database, username, int64(params.Amount), params.Reference, config.Get().ReservationTTL, time.Now())
+	writeReservation(w, http.StatusCreated, reservation, err)
+}
+
+// CommitReservation spends a reservation's coins, the purchase was fulfilled
+func CommitReservation(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+
+	var params = api.ReservationCommitParams{}
+	var err error = decodeMutation(w, r, &params)
+
+	if errors.Is(err, errUnsupportedMediaType) {
+		log.Error("Failed to parse request body: ", err)
+		api.UnsupportedMediaTypeErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	reservation, err := reservations.Commit(*database, chi.URLParam(r, "id"), username, int64(params.Amount), time.Now())
+	writeReservation(w, http.StatusOK, reservation, err)
+}
+
+// CancelReservation frees a reservation's coins without spending them
+func CancelReservation(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.ReservationCancelParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	reservation, err := reservations.Cancel(*database, chi.URLParam(r, "id"), username, time.Now())
+	writeReservation(w, http.StatusOK, reservation, err)
+}
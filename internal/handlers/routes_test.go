@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+)
+
+func newTestRouter(t *testing.T) *chi.Mux {
+	logins, coins := tools.DemoAccounts()
+	database, err := tools.NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	return New(*database)
+}
+
+func TestRouteAllowlist(t *testing.T) {
+	var router = newTestRouter(t)
+
+	t.Run("Every_Route_Is_Declared", func(t *testing.T) {
+		var registered = map[string]bool{}
+		chi.Walk(router, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+			registered[method+" "+route] = true
+			if _, ok := LookupRoute(method, route); !ok {
+				t.Errorf("%s %s is missing from Routes", method, route)
+			}
+			return nil
+		})
+		for _, route := range Routes {
+			if !registered[route.Method+" "+route.Pattern] {
+				t.Errorf("%s %s is declared but not routed", route.Method, route.Pattern)
+			}
+		}
+	})
+
+	t.Run("Only_Admins_Set_Privileged_Fields", func(t *testing.T) {
+		var privileged = []string{"role", "balance", "coins", "version", "admin"}
+		for _, route := range Routes {
+			if strings.HasPrefix(route.Pattern, "/admin/") {
+				continue
+			}
+			for _, name := range append(route.QueryNames(), route.BodyNames()...) {
+				for _, field := range privileged {
+					if strings.EqualFold(name, field) {
+						t.Errorf("%s %s accepts %s from untrusted input", route.Method, route.Pattern, name)
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("Undeclared_Parameters_Refused_Or_Dropped", func(t *testing.T) {
+		defer config.Set(config.Default())
+
+		config.Set(config.Config{StrictQueryParams: true})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version?role=admin", nil))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "role") {
+			t.Errorf("Expected an undeclared parameter to be refused, got %d %s", w.Code, w.Body.String())
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", strings.NewReader(`{"RefreshToken":"x","Role":"admin"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unknown body field(s) Role") {
+			t.Errorf("Expected an undeclared body field to be refused, got %d %s", w.Code, w.Body.String())
+		}
+
+		var seen string
+		var enforce = enforceRoutes(router)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = r.URL.RawQuery
+		}))
+		config.Set(config.Config{StrictQueryParams: false})
+		enforce.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/account/coins?username=aaron&role=admin", nil))
+		if seen != "username=aaron" {
+			t.Errorf("Expected the undeclared parameter to be dropped, handler saw %q", seen)
+		}
+	})
+	t.Run("Spec_Is_Up_To_Date", func(t *testing.T) {
+		committed, err := os.ReadFile("../../api/params.openapi.json")
+		if err != nil {
+			t.Fatalf("Failed to read the spec: %v", err)
+		}
+		var generated bytes.Buffer
+		var encoder = json.NewEncoder(&generated)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(ParamsSpec())
+		if !bytes.Equal(committed, generated.Bytes()) {
+			t.Error("api/params.openapi.json is out of date with Routes, run make params-spec")
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/middleware"
+	"github.com/bryantjandra/goapi/internal/service"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+var errSignupOIDC = fmt.Errorf("signup isn't available in the %s auth mode, accounts come from the identity provider", config.AuthModeOIDC)
+
+// Signup opens an account and returns what it signs in with. Anyone can call it, so it
+// is rate limited per client IP instead.
+func Signup(w http.ResponseWriter, r *http.Request) {
+	var cfg config.Config = config.Get()
+	if cfg.AuthMode == config.AuthModeOIDC {
+		api.NotFoundErrorHandler(w, errSignupOIDC)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		api.UnsupportedMediaTypeErrorHandler(w, errUnsupportedMediaType)
+		return
+	}
+	var params = api.SignupParams{}
+	var err error = json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMutationBody)).Decode(&params)
+	if err != nil {
+		log.Error("Failed to parse request body: ", err)
+		api.RequestErrorHandler(w, fmt.Errorf("invalid JSON body: %w", err))
+		return
+	}
+
+	var options = service.SignupOptions{Bonus: cfg.SignupBonus, BonusFrom: cfg.SignupBonusAccount}
+	if cfg.AuthMode == config.AuthModeJWT {
+		options.Issuer, err = middleware.TokenIssuer(cfg)
+		if err != nil {
+			log.Error("Failed to load access token key: ", err)
+			api.InternalErrorHandler(w)
+			return
+		}
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	signup, err := service.New(*database).Signup(r.Context(), params.Username, options)
+	switch {
+	case errors.Is(err, service.ErrInvalidUsername):
+		api.RequestErrorHandler(w, err)
+		return
+	case errors.Is(err, tools.ErrUserExists):
+		api.ConflictErrorHandler(w, fmt.Errorf("username %q is taken", params.Username))
+		return
+	case errors.Is(err, service.ErrSignupBonusUnavailable):
+		api.ServiceUnavailableErrorHandler(w, err)
+		return
+	case err != nil:
+		log.Error("Signup failed for ", params.Username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+	log.Info("Opened account ", signup.Login.Username, " through signup")
+
+	var response = api.SignupResponse{
+		Code:      http.StatusCreated,
+		Username:  signup.Login.Username,
+		AuthToken: signup.Login.AuthToken,
+		Balance:   signup.Balance,
+		Bonus:     signup.Bonus,
+		Currency:  api.Currency,
+		Limits:    api.PolicyLimits(signup.Limits),
+	}
+	if signup.Session != nil {
+		response.Session = &api.LoginResponse{
+			Code:             http.StatusOK,
+			AccessToken:      signup.Session.Access.Value,
+			TokenType:        "Bearer",
+			ExpiresAt:        signup.Session.Access.ExpiresAt,
+			RefreshToken:     signup.Session.Refresh.Value,
+			RefreshExpiresAt: signup.Session.Refresh.ExpiresAt,
+		}
+	}
+	if !signup.ProbationEndsAt.IsZero() {
+		response.ProbationEndsAt = &signup.ProbationEndsAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		return
+	}
+}
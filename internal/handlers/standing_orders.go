@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/contacts"
+	"github.com/bryantjandra/goapi/internal/standingorders"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+func toAPIStandingOrder(order standingorders.Order) api.StandingOrder {
+	var result = api.StandingOrder{
+		ID:                  order.ID,
+		To:                  order.To,
+		Amount:              order.Amount,
+		Interval:            order.Interval,
+		Memo:                order.Memo,
+		OnInsufficientFunds: order.OnInsufficientFunds,
+		Status:              order.Status,
+		CreatedAt:           order.CreatedAt,
+		Queued:              append([]time.Time{}, order.Queued...),
+	}
+	if order.Status == standingorders.StatusActive {
+		nextRunAt := order.NextRunAt
+		result.NextRunAt = &nextRunAt
+	}
+	if !order.CancelledAt.IsZero() {
+		cancelledAt := order.CancelledAt
+		result.CancelledAt = &cancelledAt
+	}
+	return result
+}
+
+func writeStandingOrder(w http.ResponseWriter, code int, order standingorders.Order, err error) {
+	if errors.Is(err, standingorders.ErrNotFound) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, standingorders.ErrCancelled) {
+		log.Error("Standing order refused: ", err)
+		api.ConflictErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Standing order refused: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var response = api.StandingOrderResponse{
+		Code:  code,
+		Order: toAPIStandingOrder(order),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		return
+	}
+}
+
+// ListStandingOrders lists the standing orders the account pays, cancelled ones included
+func ListStandingOrders(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.StandingOrderListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var response = api.StandingOrderListResponse{
+		Code:   http.StatusOK,
+		Orders: []api.StandingOrder{},
+	}
+	for _, order := range standingorders.List(username) {
+		response.Orders = append(response.Orders, toAPIStandingOrder(order))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// CreateStandingOrder sets up a payment to another account every interval. The
+// transfer checks run at each occurrence, not now.
+func CreateStandingOrder(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+
+	var params = api.StandingOrderParams{}
+	var err error = decodeMutation(w, r, &params)
+
+	if errors.Is(err, errUnsupportedMediaType) {
+		log.Error("Failed to parse request body: ", err)
+		api.UnsupportedMediaTypeErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	if params.Amount <= 0 {
+		log.Error("Invalid amount: must be positive, got: ", params.Amount)
+		api.RequestErrorHandler(w, fmt.Errorf("amount must be positive"))
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	if counterparty, ok := contacts.Resolve(*database, username, params.To); ok {
+		params.To = counterparty
+	}
+
+	if _, err = (*database).GetUserCoins(params.To); err != nil {
+		log.Error("Standing order payee lookup failed: ", params.To, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	order, err := standingorders.Create(*database, username, params.To, int64(params.Amount), params.Interval, params.Memo, params.OnInsufficientFunds, time.Now())
+	writeStandingOrder(w, http.StatusCreated, order, err)
+}
+
+// CancelStandingOrder stops one of the account's standing orders, its history is kept
+func CancelStandingOrder(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.StandingOrderCancelParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	order, err := standingorders.Cancel(tools.AttachedDatabase(r.Context()), chi.URLParam(r, "id"), username, time.Now())
+	writeStandingOrder(w, http.StatusOK, order, err)
+}
+
+// GetStandingOrderHistory lists what came of each occurrence of one of the account's
+// standing orders, newest first
+func GetStandingOrderHistory(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.StandingOrderHistoryParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	order, err := standingorders.Get(chi.URLParam(r, "id"), username)
+	if err != nil {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+
+	var response = api.StandingOrderHistoryResponse{
+		Code:        http.StatusOK,
+		ID:          order.ID,
+		Occurrences: []api.StandingOrderOccurrence{},
+	}
+	for i := len(order.Occurrences) - 1; i >= 0; i-- {
+		var occurrence = order.Occurrences[i]
+		response.Occurrences = append(response.Occurrences, api.StandingOrderOccurrence{
+			ScheduledAt:   occurrence.ScheduledAt,
+			At:            occurrence.At,
+			Status:        occurrence.Status,
+			Amount:        occurrence.Amount,
+			TransactionID: occurrence.TransactionID,
+			Reason:        occurrence.Reason,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
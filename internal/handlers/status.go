@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/buildinfo"
+	"github.com/bryantjandra/goapi/internal/status"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/warmup"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetStatus is public, so it only says up or degraded and never exposes health details
+func GetStatus(w http.ResponseWriter, r *http.Request) {
+	var response = api.StatusResponse{
+		Code:   http.StatusOK,
+		Status: "up",
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil || (*database).GetSystemHealth()["status"] != "healthy" {
+		response.Status = "degraded"
+	}
+
+	if incident, ok := status.CurrentIncident(); ok {
+		response.Status = "degraded"
+		response.Incident = incident.Note
+		response.IncidentUpdatedAt = &incident.SetAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=10")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// GetReadiness is green once warmup has primed the hottest accounts, so a new replica
+// only gets traffic with its caches and connections ready
+func GetReadiness(w http.ResponseWriter, r *http.Request) {
+	var response = api.ReadinessResponse{
+		Code:   http.StatusOK,
+		Status: "ready",
+	}
+	if !warmup.Ready() {
+		response.Code = http.StatusServiceUnavailable
+		response.Status = "warming_up"
+	} else {
+		response.WarmedAccounts = warmup.Last().Accounts
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(response.Code)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		return
+	}
+}
+
+// GetVersion is public like /status, build details are no secret once deployed
+func GetVersion(w http.ResponseWriter, r *http.Request) {
+	var info buildinfo.Info = buildinfo.Get()
+	var response = api.VersionResponse{
+		Code:      http.StatusOK,
+		Version:   info.Version,
+		Commit:    info.Commit,
+		BuildTime: info.BuildTime,
+		GoVersion: info.GoVersion,
+		Modified:  info.Modified,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+func SetIncident(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.IncidentParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	if params.Note == "" {
+		api.RequestErrorHandler(w, fmt.Errorf("note is required"))
+		return
+	}
+
+	incident := status.SetIncident(params.Note, username)
+	log.Warn("Incident note published by ", username, ": ", params.Note)
+
+	var response = api.StatusResponse{
+		Code:              http.StatusOK,
+		Status:            "degraded",
+		Incident:          incident.Note,
+		IncidentUpdatedAt: &incident.SetAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+func ClearIncident(w http.ResponseWriter, r *http.Request) {
+	status.ClearIncident()
+	log.Info("Incident note cleared by ", auth.UserFrom(r.Context()))
+
+	var response = api.MessageResponse{
+		Code:    http.StatusOK,
+		Message: "Incident note cleared.",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
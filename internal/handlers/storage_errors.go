@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/service"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// storageErrorHandler answers a refused DatabaseInterface call with the status its
+// sentinel calls for, anything else is a storage failure
+func storageErrorHandler(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, tools.ErrUserNotFound), errors.Is(err, tools.ErrOwnerNotFound):
+		api.NotFoundErrorHandler(w, err)
+	case errors.Is(err, tools.ErrInsufficientFunds), errors.Is(err, tools.ErrBalanceOverflow), errors.Is(err, tools.ErrAccountFrozen):
+		api.ConflictErrorHandler(w, err)
+	case errors.Is(err, tools.ErrInvalidAmount), errors.Is(err, tools.ErrSelfTransfer):
+		api.RequestErrorHandler(w, err)
+	case errors.Is(err, tools.ErrStorageUnavailable), errors.Is(err, tools.ErrPrimaryUnavailable):
+		api.ServiceUnavailableErrorHandler(w, err)
+	default:
+		log.Error("Storage operation failed: ", err)
+		api.InternalErrorHandler(w)
+	}
+}
+
+// availabilityErrorHandler answers a CheckAvailable refusal. A frozen account is 409,
+// the same as when storage refuses the debit itself, frozen or reserved funds are 400
+// and anything else is left to storageErrorHandler.
+func availabilityErrorHandler(w http.ResponseWriter, err error) {
+	var frozen *service.FrozenFundsError
+	var reserved *service.ReservedFundsError
+	switch {
+	case errors.Is(err, tools.ErrAccountFrozen):
+		api.ConflictErrorHandler(w, err)
+	case errors.As(err, &frozen), errors.As(err, &reserved):
+		api.RequestErrorHandler(w, err)
+	default:
+		storageErrorHandler(w, err)
+	}
+}
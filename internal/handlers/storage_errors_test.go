@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+func TestStorageErrorHandler(t *testing.T) {
+	var cases = map[string]struct {
+		err    error
+		status int
+	}{
+		"User_Not_Found":     {fmt.Errorf("lookup: %w", tools.ErrUserNotFound), http.StatusNotFound},
+		"Insufficient_Funds": {tools.ErrInsufficientFunds, http.StatusConflict},
+		"Balance_Overflow":   {tools.ErrBalanceOverflow, http.StatusConflict},
+		"Invalid_Amount":     {tools.ErrInvalidAmount, http.StatusBadRequest},
+		"Storage_Down":       {tools.ErrStorageUnavailable, http.StatusServiceUnavailable},
+		"Unrecognized":       {errors.New("disk on fire"), http.StatusInternalServerError},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			storageErrorHandler(w, c.err)
+			if w.Code != c.status {
+				t.Errorf("Expected %d for %v, got %d", c.status, c.err, w.Code)
+			}
+		})
+	}
+}
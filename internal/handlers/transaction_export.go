@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/exports"
+	"github.com/bryantjandra/goapi/internal/profiles"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+// StartTransactionExport queues a CSV export of the caller's transactions and returns immediately
+func StartTransactionExport(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.TransactionExportParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	var db tools.DatabaseInterface = *database
+	job := exports.Start(db, username, profiles.Location(db, username), func() []tools.TransactionLog {
+		return db.GetTransactionHistory(username)
+	})
+
+	var response = api.TransactionExportResponse{
+		Code:   http.StatusAccepted,
+		JobID:  job.ID,
+		Status: job.Status,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/account/transactions/export/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		return
+	}
+}
+
+// GetTransactionExport reports job progress and hands out a fresh signed link once done
+func GetTransactionExport(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+
+	job, err := exports.Get(tools.AttachedDatabase(r.Context()), username, chi.URLParam(r, "id"))
+	if err != nil {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+
+	var response = api.TransactionExportResponse{
+		Code:   http.StatusOK,
+		JobID:  job.ID,
+		Status: job.Status,
+		Rows:   job.Rows,
+		Error:  job.Error,
+	}
+
+	if job.Status == exports.StatusCompleted {
+		var expiresAt time.Time = time.Now().Add(config.Get().DownloadURLTTL)
+		token, err := exports.DownloadToken(job, expiresAt)
+		if err != nil {
+			log.Error("Failed to sign download link: ", err)
+			api.InternalErrorHandler(w)
+			return
+		}
+		response.DownloadURL = "/downloads/" + token
+		response.ExpiresAt = &expiresAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// DownloadExport streams a finished export to whoever holds a valid, unexpired link
+func DownloadExport(w http.ResponseWriter, r *http.Request) {
+	job, file, err := exports.Open(tools.AttachedDatabase(r.Context()), chi.URLParam(r, "token"))
+	if errors.Is(err, exports.ErrTokenExpired) || errors.Is(err, exports.ErrInvalidToken) {
+		log.Warn("Rejected download: ", err)
+		api.ForbiddenErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to open export: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"transactions-%s-%s.csv\"", job.Owner, job.ID))
+	w.Header().Set("Content-Length", strconv.Itoa(len(file)))
+	w.Header().Set("Cache-Control", "no-store")
+
+	_, err = w.Write(file)
+	if err != nil {
+		log.Error("Failed to stream export ", job.ID, ": ", err)
+	}
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/contacts"
+	"github.com/bryantjandra/goapi/internal/locales"
+	"github.com/bryantjandra/goapi/internal/profiles"
+	"github.com/bryantjandra/goapi/internal/receipts"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+// viewer is who ledger entries are shown to, with what they need to display them
+type viewer struct {
+	username  string
+	profile   profiles.Profile
+	nicknames map[string]string
+}
+
+// loadViewer reads username's profile and contact nicknames
+func loadViewer(database tools.DatabaseInterface, username string) (viewer, error) {
+	profile, err := profiles.Get(database, username)
+	if err != nil {
+		return viewer{}, err
+	}
+	nicknames, err := contacts.Nicknames(database, username)
+	if err != nil {
+		return viewer{}, err
+	}
+	return viewer{username: username, profile: profile, nicknames: nicknames}, nil
+}
+
+// toAPITransaction converts a ledger entry for display to the viewer, attaching their
+// nickname for the other party and formatting it for their profile
+func toAPITransaction(tx tools.TransactionLog, viewer viewer) api.Transaction {
+	var owner string = viewer.username
+	var profile profiles.Profile = viewer.profile
+	var counterparty string = tx.To
+	if tx.To == owner {
+		counterparty = tx.From
+	}
+
+	var result = api.Transaction{
+		ID:                   tx.ID,
+		Type:                 tx.Type,
+		From:                 tx.From,
+		To:                   tx.To,
+		Amount:               api.MinorUnits(tx.Amount),
+		Currency:             api.Currency,
+		Timestamp:            tx.Timestamp,
+		Status:               tx.Status,
+		Flow:                 tx.Flow,
+		Sequence:             tx.SequenceFor(owner),
+		CounterpartyNickname: viewer.nicknames[counterparty],
+	}
+	if locale, ok := locales.Lookup(profile.Locale); ok {
+		result.Display = &api.TransactionDisplay{
+			Amount:    locale.Number(tx.Amount),
+			Timestamp: locale.Time(tx.Timestamp, profile.Location()),
+		}
+	}
+	return result
+}
+
+const (
+	defaultTransactionPage = 50
+	maxTransactionPage     = 200
+)
+
+var errInvalidCursor = errors.New("invalid cursor, pass NextCursor from the previous page unchanged")
+
+// GetTransactions pages through the caller's own ledger entries, newest first
+func GetTransactions(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.TransactionListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	if params.Limit <= 0 {
+		params.Limit = defaultTransactionPage
+	}
+	if params.Limit > maxTransactionPage {
+		params.Limit = maxTransactionPage
+	}
+
+	before, err := decodeCursor(params.Cursor)
+	if err != nil {
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+	viewer, err := loadViewer(*database, username)
+	if err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+
+	page, next := pageTransactions(*database, username, before, params.Limit, func(tx tools.TransactionLog) bool {
+		return matchesTransactionFilter(tx, params.Type, params.Status)
+	})
+
+	var response = api.TransactionListResponse{
+		Code:         http.StatusOK,
+		Transactions: make([]api.Transaction, 0, len(page)),
+	}
+	for _, tx := range page {
+		response.Transactions = append(response.Transactions, toAPITransaction(tx, viewer))
+	}
+	if next > 0 {
+		response.NextCursor = encodeCursor(next)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// GetTransaction returns one of the caller's own ledger entries by ID, so a client can
+// reconcile the TransactionID a transfer returned
+func GetTransaction(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.TransactionParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+	viewer, err := loadViewer(*database, username)
+	if err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var id string = chi.URLParam(r, "id")
+
+	tx, ok := receipts.Find(*database, username, id)
+	if !ok {
+		api.NotFoundErrorHandler(w, fmt.Errorf("transaction %s not found", id))
+		return
+	}
+
+	var response = api.TransactionResponse{
+		Code:        http.StatusOK,
+		Transaction: toAPITransaction(tx, viewer),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// pageTransactions reads owner's entries newest first, from the newest or from the one
+// numbered just below before, and returns up to limit that match along with the number
+// to continue before, 0 after the last page. Storage is read a batch at a time, so an
+// unfiltered page costs about its own entries. A cursor entry that has aged out of the
+// ledger took everything older with it, so the page is empty.
+func pageTransactions(database tools.DatabaseInterface, owner string, before int64, limit int, match func(tools.TransactionLog) bool) ([]tools.TransactionLog, int64) {
+	// One more than a page tells whether another follows
+	var batchSize int = max(limit+1, defaultTransactionPage)
+
+	var page []tools.TransactionLog
+	for {
+		var batch []tools.TransactionLog = database.GetTransactionHistoryPage(owner, before, batchSize)
+		for _, tx := range batch {
+			if !match(tx) {
+				continue
+			}
+			if len(page) == limit {
+				return page, page[len(page)-1].SequenceFor(owner)
+			}
+			page = append(page, tx)
+		}
+		if len(batch) < batchSize {
+			return page, 0
+		}
+
+		before = batch[len(batch)-1].SequenceFor(owner)
+		if before <= 0 {
+			return page, 0
+		}
+	}
+}
+
+func matchesTransactionFilter(tx tools.TransactionLog, txType string, status string) bool {
+	if txType != "" && !strings.EqualFold(tx.Type, txType) {
+		return false
+	}
+	switch {
+	case status == "":
+		return true
+	case strings.EqualFold(status, "FAILED"):
+		return strings.HasPrefix(tx.Status, "FAILED_")
+	default:
+		return strings.EqualFold(tx.Status, status)
+	}
+}
+
+// Cursors are opaque to clients, so what they hold can change without breaking them.
+// They hold the Sequence of the last entry on the page.
+func encodeCursor(sequence int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(sequence, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+	sequence, err := strconv.ParseInt(string(decoded), 10, 64)
+	if err != nil || sequence <= 0 {
+		return 0, errInvalidCursor
+	}
+	return sequence, nil
+}
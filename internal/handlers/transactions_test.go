@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// historyBackend pages a fixed history for aaron and counts the entries it returns
+type historyBackend struct {
+	tools.DatabaseInterface
+	history []tools.TransactionLog
+	read    int
+}
+
+func (b *historyBackend) GetTransactionHistoryPage(username string, before int64, limit int) []tools.TransactionLog {
+	var page = tools.PageHistory(b.history, username, before, limit)
+	b.read += len(page)
+	return page
+}
+
+func TestPageTransactions(t *testing.T) {
+	// tx0 (oldest) to tx6, numbered 10 to 16 as if 1 to 9 had aged out, every third one failed
+	var backend = &historyBackend{}
+	for i := 0; i < 7; i++ {
+		var status = "SUCCESS"
+		if i%3 == 0 {
+			status = "FAILED_INSUFFICIENT_FUNDS"
+		}
+		backend.history = append(backend.history, tools.TransactionLog{
+			ID: fmt.Sprintf("tx%d", i), Type: "TRANSFER", Status: status, From: "aaron", To: "bryan", FromSequence: int64(10 + i),
+		})
+	}
+	var all = func(tools.TransactionLog) bool { return true }
+
+	ids := func(page []tools.TransactionLog) string {
+		var result string
+		for _, tx := range page {
+			result += tx.ID + " "
+		}
+		return result
+	}
+
+	t.Run("Walks_Newest_First", func(t *testing.T) {
+		var seen string
+		var before int64
+		for pages := 0; pages < 10; pages++ {
+			page, next := pageTransactions(backend, "aaron", before, 3, all)
+			seen += ids(page)
+			if next == 0 {
+				break
+			}
+			before = next
+		}
+		if seen != "tx6 tx5 tx4 tx3 tx2 tx1 tx0 " {
+			t.Errorf("Expected every entry once, newest first, got %q", seen)
+		}
+	})
+
+	t.Run("Last_Full_Page_Has_No_Cursor", func(t *testing.T) {
+		page, next := pageTransactions(backend, "aaron", 13, 3, all)
+		if ids(page) != "tx2 tx1 tx0 " || next != 0 {
+			t.Errorf("Expected the last three without a cursor, got %q and %d", ids(page), next)
+		}
+	})
+
+	t.Run("Filters_Before_Counting", func(t *testing.T) {
+		failed := func(tx tools.TransactionLog) bool { return matchesTransactionFilter(tx, "transfer", "failed") }
+		page, next := pageTransactions(backend, "aaron", 0, 2, failed)
+		if ids(page) != "tx6 tx3 " || next != 13 {
+			t.Errorf("Expected the two newest failures, got %q and %d", ids(page), next)
+		}
+	})
+
+	t.Run("Reads_About_One_Page", func(t *testing.T) {
+		for i := 7; i < 500; i++ {
+			backend.history = append(backend.history, tools.TransactionLog{ID: fmt.Sprintf("tx%d", i), From: "aaron", FromSequence: int64(10 + i)})
+		}
+		defer func() { backend.history = backend.history[:7] }()
+
+		backend.read = 0
+		page, _ := pageTransactions(backend, "aaron", 0, 10, all)
+		if len(page) != 10 || backend.read > defaultTransactionPage {
+			t.Errorf("Expected 10 entries from one batch, got %d after reading %d", len(page), backend.read)
+		}
+	})
+
+	t.Run("Aged_Out_Cursor_Is_Empty", func(t *testing.T) {
+		if page, next := pageTransactions(backend, "aaron", 5, 3, all); len(page) != 0 || next != 0 {
+			t.Errorf("Expected an empty last page, got %q and %d", ids(page), next)
+		}
+	})
+
+	t.Run("Cursor_Round_Trip", func(t *testing.T) {
+		sequence, err := decodeCursor(encodeCursor(14))
+		if err != nil || sequence != 14 {
+			t.Errorf("Expected 14 back, got %d, %v", sequence, err)
+		}
+		for _, cursor := range []string{"not base64!", base64.RawURLEncoding.EncodeToString([]byte("tx4")), encodeCursor(0)} {
+			if _, err := decodeCursor(cursor); err != errInvalidCursor {
+				t.Errorf("Expected errInvalidCursor for %q, got %v", cursor, err)
+			}
+		}
+	})
+}
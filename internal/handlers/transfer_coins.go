@@ -2,22 +2,37 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/contacts"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/messages"
+	"github.com/bryantjandra/goapi/internal/netting"
+	"github.com/bryantjandra/goapi/internal/profiles"
+	"github.com/bryantjandra/goapi/internal/receipts"
+	"github.com/bryantjandra/goapi/internal/service"
 	"github.com/bryantjandra/goapi/internal/tools"
-	"github.com/gorilla/schema"
 	log "github.com/sirupsen/logrus"
 )
 
 func TransferCoins(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+
 	//parse params
 	var params = api.CoinTransferParams{}
-	var decoder *schema.Decoder = schema.NewDecoder()
-
-	var err error = decoder.Decode(&params, r.URL.Query())
+	var err error = decodeMutation(w, r, &params)
 
+	if errors.Is(err, errUnsupportedMediaType) {
+		log.Error("Failed to parse request body: ", err)
+		api.UnsupportedMediaTypeErrorHandler(w, err)
+		return
+	}
 	if err != nil {
 		log.Error("Failed to parse request parameters: ", err)
 		api.RequestErrorHandler(w, err)
@@ -25,39 +40,103 @@ func TransferCoins(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var database *tools.DatabaseInterface
-	database, err = tools.NewDatabase()
+	database, err = tools.OpenDatabase(r.Context())
 	if err != nil {
 		log.Error("Failed to connect to database: ", err)
 		api.InternalErrorHandler(w)
 		return
 	}
 
+	// Allow paying a saved contact by nickname
+	if counterparty, ok := contacts.Resolve(*database, username, params.To); ok {
+		params.To = counterparty
+	}
+
 	// Validate amount is positive
 	if params.Amount <= 0 {
 		log.Error("Invalid amount: must be positive, got: ", params.Amount)
 		api.RequestErrorHandler(w, fmt.Errorf("amount must be positive"))
 		return
 	}
+	var amount int64 = int64(params.Amount)
+
+	// The account debited is always the authenticated principal's, from is ignored
+	params.From = username
+
+	var svc *service.Service = service.New(*database)
+
+	err = svc.CheckAvailable(params.From, amount)
+	if err != nil {
+		log.Error("Transfer refused for user: ", params.From, ": ", err)
+		availabilityErrorHandler(w, err)
+		return
+	}
+
+	// New accounts move less until their probation ends
+	err = svc.CheckProbation(params.From, amount)
+	if err != nil {
+		log.Error("Transfer refused for user: ", params.From, ": ", err)
+		api.TooManyRequestsErrorHandler(w, err)
+		return
+	}
+
+	// The policy's per-transaction and daily limits, netted transfers count as sent
+	err = svc.CheckLimits(params.From, amount)
+	if err != nil {
+		log.Error("Transfer refused for user: ", params.From, ": ", err)
+		api.TooManyRequestsErrorHandler(w, err)
+		return
+	}
 
-	// Validate username matches from parameter for security
-	if params.Username != params.From {
-		log.Error("Security violation: username doesn't match from parameter")
-		api.RequestErrorHandler(w, fmt.Errorf("cannot transfer from another user's account"))
+	// Caps on how much moves between the same two accounts
+	err = svc.CheckPairLimits(params.From, params.To, amount)
+	if err != nil {
+		log.Error("Transfer refused for users: ", params.From, " -> ", params.To, ": ", err)
+		api.TooManyRequestsErrorHandler(w, err)
 		return
 	}
 
-	fromDetails, toDetails := (*database).TransferUserCoins(params.From, params.To, params.Amount)
-	if fromDetails == nil || toDetails == nil {
-		log.Error("Transfer failed for users: ", params.From, " -> ", params.To, " amount: ", params.Amount)
-		api.RequestErrorHandler(w, fmt.Errorf("transfer failed: user not found, insufficient funds, or invalid parameters"))
+	// Netted transfers only reserve the coins, the pair's net moves when the window closes
+	if params.Net {
+		netTransfer(w, *database, params.From, params.To, amount)
 		return
 	}
 
+	fromDetails, toDetails, err := (*database).TransferUserCoinsWithContext(r.Context(), params.From, params.To, amount)
+	if err != nil {
+		log.Error("Transfer failed for users: ", params.From, " -> ", params.To, " amount: ", amount, ": ", err)
+		if coins, readErr := (*database).GetUserCoins(params.From); errors.Is(err, tools.ErrInsufficientFunds) && readErr == nil {
+			api.ConflictErrorHandler(w, errors.New(messages.RenderIn(profiles.Locale(*database, username), messages.InsufficientFunds, messages.Values{
+				"amount":  amount,
+				"balance": coins.Coins,
+			})))
+			return
+		}
+		storageErrorHandler(w, err)
+		return
+	}
+
+	events.Record(*database, events.TransferCompleted, params.From, map[string]interface{}{
+		"from":   params.From,
+		"to":     params.To,
+		"amount": amount,
+	})
+
 	var response api.CoinTransferResponse = api.CoinTransferResponse{
-		Code:        200,
-		Message:     fmt.Sprintf("You have successfully transferred %d to %s. Your current balance is %d", params.Amount, params.To, fromDetails.Coins),
-		FromBalance: fromDetails.Coins,
-		ToBalance:   toDetails.Coins,
+		Code:          200,
+		Message:       messages.RenderIn(profiles.Locale(*database, username), messages.TransferSuccess, messages.Values{"amount": amount, "to": params.To, "balance": fromDetails.Coins}),
+		FromBalance:   fromDetails.Coins,
+		ToBalance:     toDetails.Coins,
+		TransactionID: fromDetails.TransactionID,
+	}
+
+	tx, ok := receipts.Find(*database, params.From, fromDetails.TransactionID)
+	if ok {
+		receipt, err := receipts.FromTransaction(tx)
+		if err == nil {
+			var apiReceipt = api.TransferReceipt(receipt)
+			response.Receipt = &apiReceipt
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -70,3 +149,54 @@ func TransferCoins(w http.ResponseWriter, r *http.Request) {
 	}
 
 }
+
+// netTransfer adds the transfer to the pair's netting window and answers 202, the
+// checks every transfer gets have already passed
+func netTransfer(w http.ResponseWriter, database tools.DatabaseInterface, from string, to string, amount int64) {
+	toDetails, err := database.GetUserCoins(to)
+	if err != nil {
+		log.Error("Netted transfer refused for users: ", from, " -> ", to, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+	fromDetails, err := database.GetUserCoins(from)
+	if err != nil {
+		log.Error("Netted transfer refused for users: ", from, " -> ", to, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	window, err := netting.Add(database, from, to, amount, config.Get().NettingWindow, time.Now())
+	if errors.Is(err, netting.ErrInsufficientFunds) {
+		log.Error("Netted transfer refused for users: ", from, " -> ", to, ": ", err)
+		api.ConflictErrorHandler(w, err)
+		return
+	}
+	if errors.Is(err, netting.ErrInvalidTransfer) || errors.Is(err, netting.ErrDisabled) {
+		log.Error("Netted transfer refused for users: ", from, " -> ", to, ": ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Netted transfer refused for users: ", from, " -> ", to, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var response api.CoinTransferResponse = api.CoinTransferResponse{
+		Code:        http.StatusAccepted,
+		Message:     fmt.Sprintf("Transfer of %d to %s accepted for netting, the net of your transfers with them settles at %s", amount, to, window.ClosesAt.UTC().Format(time.RFC3339)),
+		FromBalance: fromDetails.Coins,
+		ToBalance:   toDetails.Coins,
+		SettlesAt:   &window.ClosesAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(response)
+
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		return
+	}
+}
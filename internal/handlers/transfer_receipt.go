@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/receipts"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetTransferReceipt rebuilds the receipt for a transfer from the ledger entry.
+// Only the sender and recipient can fetch it.
+func GetTransferReceipt(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.ReceiptParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+
+	var id string = chi.URLParam(r, "id")
+
+	tx, ok := receipts.Find(*database, username, id)
+	if !ok {
+		api.NotFoundErrorHandler(w, fmt.Errorf("transaction %s not found", id))
+		return
+	}
+
+	receipt, err := receipts.FromTransaction(tx)
+	if err != nil {
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var response = api.ReceiptResponse{
+		Code:    http.StatusOK,
+		Receipt: api.TransferReceipt(receipt),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/sockets"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// Largest message a client may send, requests are a few fields
+const walletSocketReadLimit = 4096
+
+// How long one message may take to go out before the socket is given up on
+const walletSocketWriteTimeout = 10 * time.Second
+
+var errUnknownSocketRequest = errors.New("unknown request type, send balance")
+
+// Keeps the default origin check, browsers may only connect from the API's own host.
+// A failed handshake is answered like any other error.
+var walletUpgrader = websocket.Upgrader{
+	Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		w.Header().Set("Sec-Websocket-Version", "13")
+		switch {
+		case status == http.StatusForbidden:
+			api.ForbiddenErrorHandler(w, reason)
+		case status == http.StatusMethodNotAllowed:
+			api.MethodNotAllowedErrorHandler(w, reason)
+		case status >= http.StatusInternalServerError:
+			api.InternalErrorHandler(w)
+		default:
+			api.RequestErrorHandler(w, reason)
+		}
+	},
+}
+
+// walletRequest is one message read off the socket, err set when it wasn't valid JSON
+type walletRequest struct {
+	request api.WalletSocketRequest
+	err     error
+}
+
+// WalletSocket upgrades to a WebSocket that pushes the caller's incoming transfers as
+// they succeed and answers balance requests, see api.WalletSocketMessage
+func WalletSocket(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.WalletSocketParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		log.Error("Failed to connect to database: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+	if !(*database).Capabilities().Streaming {
+		api.NotImplementedErrorHandler(w, errStreamingUnsupported)
+		return
+	}
+	viewer, err := loadViewer(*database, username)
+	if err != nil {
+		storageErrorHandler(w, err)
+		return
+	}
+
+	release, err := sockets.Acquire(username)
+	if errors.Is(err, sockets.ErrUserFull) {
+		api.TooManyRequestsErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		w.Header().Set("Retry-After", "1")
+		api.ServiceUnavailableErrorHandler(w, err)
+		return
+	}
+	defer release()
+
+	// Subscribed before the upgrade so a transfer right after it isn't missed
+	updates, unsubscribe := tools.Subscribe(*database, username)
+	defer unsubscribe()
+
+	// Upgrade answers a failed handshake itself
+	conn, err := walletUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Warn("Failed to open wallet socket for ", username, ": ", err)
+		return
+	}
+	defer conn.Close()
+
+	var interval time.Duration = config.Get().WalletSocketPingInterval
+	conn.SetReadLimit(walletSocketReadLimit)
+	conn.SetReadDeadline(time.Now().Add(2 * interval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * interval))
+	})
+
+	// Only this goroutine writes, the reader hands requests over
+	var requests = make(chan walletRequest)
+	var readDone = make(chan struct{})
+	var done = make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(readDone)
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var request walletRequest
+			request.err = json.Unmarshal(message, &request.request)
+			select {
+			case requests <- request:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var ping = time.NewTicker(interval)
+	defer ping.Stop()
+
+	for {
+		var message *api.WalletSocketMessage
+		select {
+		case <-readDone:
+			// Closed by the client, or no pong in time
+			return
+		case <-streamsClosed:
+			closeWalletSocket(conn, websocket.CloseGoingAway, "server shutting down")
+			return
+		case tx, ok := <-updates:
+			if !ok {
+				closeWalletSocket(conn, websocket.CloseTryAgainLater, "fell behind, reconnect")
+				return
+			}
+			if tx.Type != "TRANSFER" || tx.Status != "SUCCESS" || tx.To != username || tx.From == username {
+				continue
+			}
+			var transaction api.Transaction = toAPITransaction(tx, viewer)
+			message = &api.WalletSocketMessage{Type: "transfer_received", Transaction: &transaction}
+		case request := <-requests:
+			message = answerWalletRequest(*database, username, request)
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(walletSocketWriteTimeout))
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(walletSocketWriteTimeout))
+		err = conn.WriteJSON(message)
+		if err != nil {
+			log.Warn("Failed to write to wallet socket for ", username, ": ", err)
+			return
+		}
+	}
+}
+
+func answerWalletRequest(database tools.DatabaseInterface, username string, request walletRequest) *api.WalletSocketMessage {
+	if request.err != nil {
+		return &api.WalletSocketMessage{Type: "error", Message: "request must be a JSON object"}
+	}
+	if request.request.Type != "balance" {
+		return &api.WalletSocketMessage{Type: "error", ID: request.request.ID, Message: errUnknownSocketRequest.Error()}
+	}
+
+	details, err := database.GetUserCoins(username)
+	if err != nil {
+		log.Error("Failed to read balance for user: ", username, ": ", err)
+		return &api.WalletSocketMessage{Type: "error", ID: request.request.ID, Message: "failed to read the balance"}
+	}
+	balance, err := toAPICoinBalance(database, username, details)
+	if err != nil {
+		log.Error("Failed to read account status for user: ", username, ": ", err)
+		return &api.WalletSocketMessage{Type: "error", ID: request.request.ID, Message: "failed to read the balance"}
+	}
+	return &api.WalletSocketMessage{Type: "balance", ID: request.request.ID, Balance: &balance}
+}
+
+// closeWalletSocket tells the client why the socket is closing, it may already be gone
+func closeWalletSocket(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(walletSocketWriteTimeout))
+}
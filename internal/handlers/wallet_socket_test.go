@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/gorilla/websocket"
+)
+
+func TestWalletSocket(t *testing.T) {
+	defer config.Set(config.Get())
+	var cfg config.Config = config.Get()
+	cfg.WalletSocketMaxConnectionsPerUser = 1
+	config.Set(cfg)
+
+	logins, coins := tools.DemoAccounts()
+	database, err := tools.NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	var server = httptest.NewServer(New(*database))
+	defer server.Close()
+
+	var url string = "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?username=aaron"
+	var header = http.Header{"Authorization": {"1"}}
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("Failed to open the socket: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	read := func(t *testing.T) api.WalletSocketMessage {
+		var message api.WalletSocketMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("Failed to read from the socket: %v", err)
+		}
+		return message
+	}
+
+	t.Run("Answers_Balance_Requests", func(t *testing.T) {
+		conn.WriteJSON(api.WalletSocketRequest{Type: "balance", ID: "b1"})
+		if message := read(t); message.Type != "balance" || message.ID != "b1" || message.Balance == nil || message.Balance.Balance != 1000 {
+			t.Errorf("Unexpected reply %+v", message)
+		}
+
+		conn.WriteJSON(api.WalletSocketRequest{Type: "withdraw", ID: "w1"})
+		if message := read(t); message.Type != "error" || message.ID != "w1" {
+			t.Errorf("Expected an unknown request refused, got %+v", message)
+		}
+	})
+
+	t.Run("Pushes_Incoming_Transfers_Only", func(t *testing.T) {
+		(*database).TransferUserCoins("aaron", "bryan", 10)
+		(*database).TransferUserCoins("bryan", "aaron", 25)
+
+		message := read(t)
+		if message.Type != "transfer_received" || message.Transaction == nil || message.Transaction.From != "bryan" || message.Transaction.Amount != 25 {
+			t.Errorf("Expected bryan's transfer pushed, got %+v", message)
+		}
+	})
+
+	t.Run("Per_User_Limit", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(url, header)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("Expected a second socket refused with 429, got %v, %v", resp, err)
+		}
+	})
+}
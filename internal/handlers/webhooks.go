@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/webhooks"
+	log "github.com/sirupsen/logrus"
+)
+
+func toAPIWebhookMetrics(metrics webhooks.Metrics) api.WebhookMetrics {
+	var result = api.WebhookMetrics{
+		Delivered: metrics.Delivered,
+		Failed:    metrics.Failed,
+		LastError: metrics.LastError,
+	}
+	if !metrics.LastDeliveryAt.IsZero() {
+		lastDeliveryAt := metrics.LastDeliveryAt
+		result.LastDeliveryAt = &lastDeliveryAt
+	}
+	return result
+}
+
+func toAPIWebhook(subscription webhooks.Subscription) api.Webhook {
+	var eventTypes = subscription.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	var fields = subscription.Rules.Fields
+	if fields == nil {
+		fields = []string{}
+	}
+
+	var result = api.Webhook{
+		ID:         subscription.ID,
+		Tier:       subscription.Tier,
+		Owner:      subscription.Owner,
+		URL:        subscription.URL,
+		EventTypes: eventTypes,
+		MinAmount:  subscription.Rules.MinAmount,
+		Fields:     fields,
+		Secret:     subscription.Secret,
+		CreatedAt:  subscription.CreatedAt,
+		Metrics:    toAPIWebhookMetrics(subscription.Metrics),
+	}
+	if !subscription.SecretRotatedAt.IsZero() {
+		rotatedAt := subscription.SecretRotatedAt
+		result.SecretRotatedAt = &rotatedAt
+	}
+	if subscription.PreviousSecretExpiresAt.After(time.Now()) {
+		expiresAt := subscription.PreviousSecretExpiresAt
+		result.PreviousSecretExpiresAt = &expiresAt
+	}
+	if subscription.Digest > 0 {
+		nextDigestAt := subscription.NextDigestAt
+		result.DigestMinutes = int(subscription.Digest / time.Minute)
+		result.DigestPending = subscription.DigestPending
+		result.NextDigestAt = &nextDigestAt
+	}
+	return result
+}
+
+func listWebhooks(tier string, w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.WebhookListParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var database tools.DatabaseInterface = tools.AttachedDatabase(r.Context())
+	var result = []api.Webhook{}
+	for _, subscription := range webhooks.List(database, tier, username) {
+		result = append(result, toAPIWebhook(subscription))
+	}
+
+	// Account owners only see metrics for their own webhooks
+	var metrics = webhooks.TierMetrics(database, tier)
+	if tier == webhooks.TierAccount {
+		metrics = webhooks.Metrics{}
+		for _, webhook := range result {
+			metrics.Delivered += webhook.Metrics.Delivered
+			metrics.Failed += webhook.Metrics.Failed
+		}
+	}
+
+	var response = api.WebhookListResponse{
+		Code:     http.StatusOK,
+		Webhooks: result,
+		Metrics:  toAPIWebhookMetrics(metrics),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+func createWebhook(tier string, w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.WebhookParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var rules = webhooks.Rules{MinAmount: int64(params.MinAmount), Fields: params.Fields}
+	subscription, err := webhooks.Create(tools.AttachedDatabase(r.Context()), tier, username, params.URL, params.EventTypes, rules)
+	if err != nil {
+		log.Error("Failed to create webhook: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var response = api.WebhookResponse{
+		Code:    http.StatusOK,
+		Webhook: toAPIWebhook(subscription),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+func removeWebhook(tier string, w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.WebhookRemoveParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	err = webhooks.Delete(tools.AttachedDatabase(r.Context()), tier, username, params.ID)
+	if errors.Is(err, webhooks.ErrNotFound) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+
+	var response = api.MessageResponse{
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf("Webhook %s removed.", params.ID),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// rotateWebhook issues a new secret and notifies the webhook with a
+// webhook_secret_rotated event signed with both secrets
+func rotateWebhook(tier string, w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.WebhookRotateParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var overlap time.Duration = 24 * time.Hour
+	if params.OverlapHours != nil {
+		overlap = time.Duration(*params.OverlapHours) * time.Hour
+	}
+
+	subscription, err := webhooks.Rotate(tools.AttachedDatabase(r.Context()), tier, username, params.ID, overlap)
+	if errors.Is(err, webhooks.ErrNotFound) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to rotate webhook secret: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	log.Info("Webhook ", subscription.ID, " secret rotated by ", username, ", previous secret valid until ", subscription.PreviousSecretExpiresAt)
+	events.Record(tools.AttachedDatabase(r.Context()), events.WebhookSecretRotated, subscription.Owner, map[string]interface{}{
+		"webhook_id":                 subscription.ID,
+		"rotated_by":                 username,
+		"previous_secret_expires_at": subscription.PreviousSecretExpiresAt,
+	})
+
+	var response = api.WebhookResponse{
+		Code:    http.StatusOK,
+		Webhook: toAPIWebhook(subscription),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// setWebhookDigest switches a webhook between one delivery per event and a digest
+func setWebhookDigest(tier string, w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.WebhookDigestParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	subscription, err := webhooks.SetDigest(tools.AttachedDatabase(r.Context()), tier, username, params.ID, time.Duration(params.Minutes)*time.Minute)
+	if errors.Is(err, webhooks.ErrNotFound) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to set webhook digest: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	log.Info("Webhook ", subscription.ID, " digest set to ", subscription.Digest, " by ", username)
+
+	var response = api.WebhookResponse{
+		Code:    http.StatusOK,
+		Webhook: toAPIWebhook(subscription),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// setWebhookRules replaces a webhook's amount threshold and field selection
+func setWebhookRules(tier string, w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
+	var params = api.WebhookRulesParams{}
+	var err error = decodeQuery(&params, r.URL.Query())
+	if err != nil {
+		log.Error("Failed to parse request parameters: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	var rules = webhooks.Rules{MinAmount: int64(params.MinAmount), Fields: params.Fields}
+	subscription, err := webhooks.SetRules(tools.AttachedDatabase(r.Context()), tier, username, params.ID, rules)
+	if errors.Is(err, webhooks.ErrNotFound) {
+		api.NotFoundErrorHandler(w, err)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to set webhook rules: ", err)
+		api.RequestErrorHandler(w, err)
+		return
+	}
+
+	log.Info("Webhook ", subscription.ID, " rules set by ", username)
+
+	var response = api.WebhookResponse{
+		Code:    http.StatusOK,
+		Webhook: toAPIWebhook(subscription),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error("Failed to encode response: ", err)
+		api.InternalErrorHandler(w)
+		return
+	}
+}
+
+// Account webhooks, managed by the user and only receive events involving them
+
+func ListAccountWebhooks(w http.ResponseWriter, r *http.Request) {
+	listWebhooks(webhooks.TierAccount, w, r)
+}
+
+func CreateAccountWebhook(w http.ResponseWriter, r *http.Request) {
+	createWebhook(webhooks.TierAccount, w, r)
+}
+
+func RemoveAccountWebhook(w http.ResponseWriter, r *http.Request) {
+	removeWebhook(webhooks.TierAccount, w, r)
+}
+
+func RotateAccountWebhook(w http.ResponseWriter, r *http.Request) {
+	rotateWebhook(webhooks.TierAccount, w, r)
+}
+
+func SetAccountWebhookDigest(w http.ResponseWriter, r *http.Request) {
+	setWebhookDigest(webhooks.TierAccount, w, r)
+}
+
+func SetAccountWebhookRules(w http.ResponseWriter, r *http.Request) {
+	setWebhookRules(webhooks.TierAccount, w, r)
+}
+
+// Global webhooks, managed by admins and receive every event
+
+func ListGlobalWebhooks(w http.ResponseWriter, r *http.Request) {
+	listWebhooks(webhooks.TierGlobal, w, r)
+}
+
+func CreateGlobalWebhook(w http.ResponseWriter, r *http.Request) {
+	createWebhook(webhooks.TierGlobal, w, r)
+}
+
+func RemoveGlobalWebhook(w http.ResponseWriter, r *http.Request) {
+	removeWebhook(webhooks.TierGlobal, w, r)
+}
+
+func RotateGlobalWebhook(w http.ResponseWriter, r *http.Request) {
+	rotateWebhook(webhooks.TierGlobal, w, r)
+}
+
+func SetGlobalWebhookDigest(w http.ResponseWriter, r *http.Request) {
+	setWebhookDigest(webhooks.TierGlobal, w, r)
+}
+
+func SetGlobalWebhookRules(w http.ResponseWriter, r *http.Request) {
+	setWebhookRules(webhooks.TierGlobal, w, r)
+}
@@ -2,22 +2,31 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/messages"
+	"github.com/bryantjandra/goapi/internal/profiles"
+	"github.com/bryantjandra/goapi/internal/service"
 	"github.com/bryantjandra/goapi/internal/tools"
-	"github.com/gorilla/schema"
 	log "github.com/sirupsen/logrus"
 )
 
 func WithdrawCoins(w http.ResponseWriter, r *http.Request) {
+	var username string = auth.UserFrom(r.Context())
 	//parse params
 	var params = api.CoinWithdrawParams{}
-	var decoder *schema.Decoder = schema.NewDecoder()
-
-	var err error = decoder.Decode(&params, r.URL.Query())
+	var err error = decodeMutation(w, r, &params)
 
+	if errors.Is(err, errUnsupportedMediaType) {
+		log.Error("Failed to parse request body: ", err)
+		api.UnsupportedMediaTypeErrorHandler(w, err)
+		return
+	}
 	if err != nil {
 		log.Error("Failed to parse request parameters: ", err)
 		api.RequestErrorHandler(w, err)
@@ -25,7 +34,7 @@ func WithdrawCoins(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var database *tools.DatabaseInterface
-	database, err = tools.NewDatabase()
+	database, err = tools.OpenDatabase(r.Context())
 	if err != nil {
 		log.Error("Failed to connect to database: ", err)
 		api.InternalErrorHandler(w)
@@ -38,26 +47,59 @@ func WithdrawCoins(w http.ResponseWriter, r *http.Request) {
 		api.RequestErrorHandler(w, fmt.Errorf("amount must be positive"))
 		return
 	}
+	var amount int64 = int64(params.Amount)
+
+	_, err = (*database).GetUserCoins(username)
+	if err != nil {
+		log.Error("Failed to read balance for user: ", username, ": ", err)
+		storageErrorHandler(w, err)
+		return
+	}
+
+	var svc *service.Service = service.New(*database)
+
+	err = svc.CheckAvailable(username, amount)
+	if err != nil {
+		log.Error("Withdrawal refused for user: ", username, ": ", err)
+		availabilityErrorHandler(w, err)
+		return
+	}
 
-	// Get original balance before withdrawal
-	var originalBalance *tools.CoinDetails = (*database).GetUserCoins(params.Username)
-	if originalBalance == nil {
-		log.Error("User not found: ", params.Username)
-		api.RequestErrorHandler(w, fmt.Errorf("user not found"))
+	// New accounts move less until their probation ends
+	err = svc.CheckProbation(username, amount)
+	if err != nil {
+		log.Error("Withdrawal refused for user: ", username, ": ", err)
+		api.TooManyRequestsErrorHandler(w, err)
 		return
 	}
 
-	var updatedCoinBalance *tools.CoinDetails = (*database).WithdrawUserCoins(params.Username, params.Amount)
-	if updatedCoinBalance == nil {
-		log.Error("Withdrawal failed for user: ", params.Username, " amount: ", params.Amount)
-		api.RequestErrorHandler(w, fmt.Errorf("insufficient funds or invalid amount"))
+	updatedCoinBalance, err := (*database).WithdrawUserCoins(username, amount)
+	if err != nil {
+		log.Error("Withdrawal failed for user: ", username, " amount: ", amount, ": ", err)
+		if coins, readErr := (*database).GetUserCoins(username); errors.Is(err, tools.ErrInsufficientFunds) && readErr == nil {
+			api.ConflictErrorHandler(w, errors.New(messages.RenderIn(profiles.Locale(*database, username), messages.InsufficientFunds, messages.Values{
+				"amount":  amount,
+				"balance": coins.Coins,
+			})))
+			return
+		}
+		storageErrorHandler(w, err)
 		return
 	}
 
+	// Derived from the result rather than read separately, another request can change
+	// or remove the account between two reads
+	var originalBalance int64 = updatedCoinBalance.Coins + amount
+
+	events.Record(*database, events.WithdrawalCompleted, username, map[string]interface{}{
+		"amount":  amount,
+		"balance": updatedCoinBalance.Coins,
+	})
+
 	var response api.CoinWithdrawResponse = api.CoinWithdrawResponse{
 		Code:    200,
-		Message: fmt.Sprintf("You have successfully withdrawn %d. Your original coin balance was %d, now it is %d", params.Amount, originalBalance.Coins, updatedCoinBalance.Coins),
-		Amount:  params.Amount,
+		Message: fmt.Sprintf("You have successfully withdrawn %d. Your original coin balance was %d, now it is %d", amount, originalBalance, updatedCoinBalance.Coins),
+		Amount:  amount,
 		Balance: updatedCoinBalance.Coins,
 	}
 
@@ -0,0 +1,385 @@
+// Package holds authorizes payments now and moves the coins later. A hold reserves
+// part of the payer's balance for a payee, who captures all or part of it or releases
+// it. A hold neither captured nor released in time expires and the coins are free again.
+package holds
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// Longest memo a hold can carry, in bytes
+const MaxMemoLength = 140
+
+var (
+	ErrInvalidHold       = errors.New("invalid hold")
+	ErrDisabled          = errors.New("payment holds are not enabled")
+	ErrNotFound          = errors.New("hold not found")
+	ErrNotAuthorized     = errors.New("hold is no longer authorized")
+	ErrInsufficientFunds = errors.New("insufficient funds once existing holds are reserved")
+	ErrCaptureFailed     = errors.New("hold could not be captured")
+)
+
+// Hold statuses, authorized and capturing still reserve the coins
+const (
+	StatusAuthorized = "authorized"
+	StatusCapturing  = "capturing"
+	StatusCaptured   = "captured"
+	StatusReleased   = "released"
+	StatusExpired    = "expired"
+	StatusFailed     = "failed"
+)
+
+type Hold struct {
+	ID        string
+	From      string
+	To        string
+	Amount    int64
+	Memo      string
+	Status    string
+	PlacedAt  time.Time
+	ExpiresAt time.Time
+
+	// Set once captured, Captured may be less than Amount
+	Captured      int64
+	TransactionID string
+
+	// Set once the hold is captured, released, expired or failed
+	ResolvedAt time.Time
+}
+
+// Open is true until the hold is resolved
+func (h Hold) Open() bool {
+	return h.Status == StatusAuthorized || h.Status == StatusCapturing
+}
+
+// Kinds a hold is kept as. Storage holds the coins back under the same ID, so a hold
+// is captured or released once however many processes race for it, and its terms
+// live in a record next to the balances.
+const (
+	holdKind   = "payment"
+	recordKind = "payment_hold"
+)
+
+var mu sync.Mutex
+
+func newID() string {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+func load(database tools.DatabaseInterface, id string) (*Hold, error) {
+	record, err := database.GetRecord(recordKind, id)
+	if errors.Is(err, tools.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var hold Hold
+	err = json.Unmarshal(record.Data, &hold)
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+func save(database tools.DatabaseInterface, hold *Hold) error {
+	data, err := json.Marshal(hold)
+	if err != nil {
+		return err
+	}
+	return database.PutRecord(tools.Record{Kind: recordKind, ID: hold.ID, Account: hold.From, Data: data, UpdatedAt: time.Now()})
+}
+
+// list returns every hold, oldest first
+func list(database tools.DatabaseInterface) ([]Hold, error) {
+	records, err := database.ListRecords(recordKind, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var result = make([]Hold, 0, len(records))
+	for _, record := range records {
+		var hold Hold
+		err = json.Unmarshal(record.Data, &hold)
+		if err != nil {
+			return nil, fmt.Errorf("hold %s: %w", record.ID, err)
+		}
+		result = append(result, hold)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].PlacedAt.Before(result[j].PlacedAt) })
+	return result, nil
+}
+
+// Place reserves amount of from's coins for to until now plus ttl. Storage checks from
+// has that much available as it holds it back.
+func Place(database tools.DatabaseInterface, from string, to string, amount int64, memo string, ttl time.Duration, now time.Time) (Hold, error) {
+	if ttl <= 0 {
+		return Hold{}, ErrDisabled
+	}
+	if amount <= 0 || from == "" || to == "" || from == to {
+		return Hold{}, ErrInvalidHold
+	}
+	if len(memo) > MaxMemoLength {
+		return Hold{}, fmt.Errorf("%w: memo must be at most %d bytes", ErrInvalidHold, MaxMemoLength)
+	}
+
+	var hold = &Hold{
+		ID:        newID(),
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Memo:      memo,
+		Status:    StatusAuthorized,
+		PlacedAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	_, err := database.PlaceHold(tools.Hold{ID: hold.ID, Account: from, Kind: holdKind, Amount: amount, CreatedAt: now})
+	if errors.Is(err, tools.ErrInsufficientFunds) {
+		return Hold{}, ErrInsufficientFunds
+	}
+	if err != nil {
+		return Hold{}, err
+	}
+	err = save(database, hold)
+	if err != nil {
+		_, releaseErr := database.ReleaseHold(hold.ID)
+		return Hold{}, errors.Join(err, releaseErr)
+	}
+
+	events.Record(database, events.HoldPlaced, from, map[string]interface{}{
+		"hold":   hold.ID,
+		"from":   from,
+		"to":     to,
+		"amount": amount,
+	})
+	return *hold, nil
+}
+
+// Pending totals the open holds username placed and can capture
+func Pending(database tools.DatabaseInterface, username string) (outgoing int64, incoming int64, err error) {
+	open, err := Open(database, username)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, hold := range open {
+		if hold.From == username {
+			outgoing += hold.Amount
+		}
+		if hold.To == username {
+			incoming += hold.Amount
+		}
+	}
+	return outgoing, incoming, nil
+}
+
+// Open lists the unresolved holds username placed or can capture, oldest first
+func Open(database tools.DatabaseInterface, username string) ([]Hold, error) {
+	all, err := list(database)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = []Hold{}
+	for _, hold := range all {
+		if hold.Open() && (hold.From == username || hold.To == username) {
+			result = append(result, hold)
+		}
+	}
+	return result, nil
+}
+
+// claim loads an authorized hold payable to username. A hold past its expiry can't be
+// claimed, whether or not Expire has released it yet. The caller holds mu.
+func claim(database tools.DatabaseInterface, id string, username string, now time.Time) (*Hold, error) {
+	hold, err := load(database, id)
+	if err != nil {
+		return nil, err
+	}
+	if hold.To != username {
+		return nil, ErrNotFound
+	}
+	if hold.Status != StatusAuthorized || !now.Before(hold.ExpiresAt) {
+		return nil, ErrNotAuthorized
+	}
+	return hold, nil
+}
+
+// Capture moves amount of the hold to its payee, username, and releases the rest. 0
+// captures the whole hold. Storage does both in one step, and only once for a hold.
+func Capture(database tools.DatabaseInterface, id string, username string, amount int64, now time.Time) (Hold, error) {
+	if amount < 0 {
+		return Hold{}, ErrInvalidHold
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	hold, err := claim(database, id, username, now)
+	if err != nil {
+		return Hold{}, err
+	}
+	if amount == 0 {
+		amount = hold.Amount
+	}
+	if amount > hold.Amount {
+		return Hold{}, fmt.Errorf("%w: can capture at most the %d held", ErrInvalidHold, hold.Amount)
+	}
+
+	fromDetails, _, err := database.CaptureHold(context.Background(), hold.ID, hold.To, amount)
+	hold.ResolvedAt = now
+	hold.Status = StatusCaptured
+	switch {
+	case errors.Is(err, tools.ErrHoldNotFound):
+		return Hold{}, ErrNotAuthorized
+	case errors.Is(err, tools.ErrAccountFrozen), errors.Is(err, tools.ErrUserNotFound),
+		errors.Is(err, tools.ErrInsufficientFunds), errors.Is(err, tools.ErrBalanceOverflow):
+		// Storage refused the move, so the coins go back to the payer
+		log.Error("Hold capture failed for users: ", hold.From, " -> ", hold.To, " amount: ", amount, ": ", err)
+		hold.Status = StatusFailed
+		if _, releaseErr := database.ReleaseHold(hold.ID); releaseErr != nil && !errors.Is(releaseErr, tools.ErrHoldNotFound) {
+			return Hold{}, errors.Join(err, releaseErr)
+		}
+	case err != nil:
+		return Hold{}, err
+	default:
+		hold.Captured = amount
+		hold.TransactionID = fromDetails.TransactionID
+	}
+	if saveErr := save(database, hold); saveErr != nil {
+		log.Error("Failed to record hold ", hold.ID, " as ", hold.Status, ": ", saveErr)
+	}
+
+	if hold.Status == StatusFailed {
+		return *hold, ErrCaptureFailed
+	}
+	events.Record(database, events.TransferCompleted, hold.From, map[string]interface{}{
+		"from":   hold.From,
+		"to":     hold.To,
+		"amount": hold.Captured,
+		"hold":   hold.ID,
+	})
+	return *hold, nil
+}
+
+// Release frees the hold's coins without moving them, username must be the payee
+func Release(database tools.DatabaseInterface, id string, username string, now time.Time) (Hold, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	hold, err := claim(database, id, username, now)
+	if err != nil {
+		return Hold{}, err
+	}
+
+	_, err = database.ReleaseHold(hold.ID)
+	if errors.Is(err, tools.ErrHoldNotFound) {
+		return Hold{}, ErrNotAuthorized
+	}
+	if err != nil {
+		return Hold{}, err
+	}
+
+	hold.Status = StatusReleased
+	hold.ResolvedAt = now
+	if err = save(database, hold); err != nil {
+		log.Error("Failed to record hold ", hold.ID, " as released: ", err)
+	}
+
+	recordRelease(database, *hold)
+	return *hold, nil
+}
+
+// Expire releases every authorized hold whose expiry has passed at now. A hold another
+// process resolved first is skipped.
+func Expire(database tools.DatabaseInterface, now time.Time) ([]Hold, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	all, err := list(database)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []Hold
+	for _, hold := range all {
+		if hold.Status != StatusAuthorized || now.Before(hold.ExpiresAt) {
+			continue
+		}
+
+		_, err = database.ReleaseHold(hold.ID)
+		if errors.Is(err, tools.ErrHoldNotFound) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+
+		hold.Status = StatusExpired
+		hold.ResolvedAt = now
+		if err = save(database, &hold); err != nil {
+			log.Error("Failed to record hold ", hold.ID, " as expired: ", err)
+		}
+		recordRelease(database, hold)
+		expired = append(expired, hold)
+	}
+
+	sort.Slice(expired, func(i, j int) bool { return expired[i].ExpiresAt.Before(expired[j].ExpiresAt) })
+	return expired, nil
+}
+
+func recordRelease(database tools.DatabaseInterface, hold Hold) {
+	events.Record(database, events.HoldReleased, hold.From, map[string]interface{}{
+		"hold":   hold.ID,
+		"from":   hold.From,
+		"to":     hold.To,
+		"amount": hold.Amount,
+		"status": hold.Status,
+	})
+}
+
+// Schedule releases holds as they expire, checking every tick until ctx is done
+func Schedule(ctx context.Context, tick time.Duration, open func() (tools.DatabaseInterface, error)) {
+	var ticker *time.Ticker = time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			database, err := open()
+			if err != nil {
+				log.Error("Hold expiry could not open the database: ", err)
+				continue
+			}
+			expired, err := Expire(database, now)
+			if err != nil {
+				log.Error("Hold expiry failed: ", err)
+			}
+			for _, hold := range expired {
+				log.WithFields(log.Fields{
+					"hold":   hold.ID,
+					"from":   hold.From,
+					"to":     hold.To,
+					"amount": hold.Amount,
+				}).Info("Hold not captured in time, released")
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package holds
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+func TestHolds(t *testing.T) {
+	var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var ttl = 7 * 24 * time.Hour
+
+	t.Run("Partial_Capture_Releases_The_Rest", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		hold, err := Place(database, "aaron", "bryan", 100, "Order 42", ttl, now)
+		if err != nil {
+			t.Fatalf("Failed to place: %v", err)
+		}
+		if toolstest.Held(t, database, "aaron") != 100 {
+			t.Errorf("Expected 100 held for aaron, got %d", toolstest.Held(t, database, "aaron"))
+		}
+		outgoing, _, _ := Pending(database, "aaron")
+		_, incoming, _ := Pending(database, "bryan")
+		if outgoing != 100 || incoming != 100 {
+			t.Errorf("Expected 100 pending for both, got %d and %d", outgoing, incoming)
+		}
+
+		if _, err := Capture(database, hold.ID, "aaron", 0, now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound when the payer captures, got %v", err)
+		}
+		if _, err := Capture(database, hold.ID, "bryan", 101, now); !errors.Is(err, ErrInvalidHold) {
+			t.Errorf("Expected ErrInvalidHold for capturing more than held, got %v", err)
+		}
+
+		captured, err := Capture(database, hold.ID, "bryan", 60, now.Add(time.Hour))
+		if err != nil || captured.Status != StatusCaptured || captured.Captured != 60 || captured.TransactionID == "" {
+			t.Fatalf("Expected 60 captured, got %+v, %v", captured, err)
+		}
+
+		aaron, _ := database.GetUserCoins("aaron")
+		bryan, _ := database.GetUserCoins("bryan")
+		if aaron.Coins != 940 || bryan.Coins != 1060 {
+			t.Errorf("Expected 940 and 1060, got %d and %d", aaron.Coins, bryan.Coins)
+		}
+		if open, _ := Open(database, "bryan"); toolstest.Held(t, database, "aaron") != 0 || len(open) != 0 {
+			t.Error("Expected the reservation to end with the capture")
+		}
+		if _, err := Release(database, hold.ID, "bryan", now); !errors.Is(err, ErrNotAuthorized) {
+			t.Errorf("Expected ErrNotAuthorized for a captured hold, got %v", err)
+		}
+	})
+
+	t.Run("Released_And_Expired_Holds_Move_Nothing", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		released, _ := Place(database, "aaron", "bryan", 10, "", ttl, now)
+		expiring, _ := Place(database, "aaron", "bryan", 20, "", ttl, now)
+
+		if _, err := Release(database, released.ID, "aaron", now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound when the payer releases, got %v", err)
+		}
+		if hold, err := Release(database, released.ID, "bryan", now); err != nil || hold.Status != StatusReleased {
+			t.Fatalf("Expected the hold to be released, got %+v, %v", hold, err)
+		}
+		if expired, _ := Expire(database, now.Add(ttl-time.Second)); len(expired) != 0 {
+			t.Fatalf("Expected nothing to expire early, got %+v", expired)
+		}
+		expired, err := Expire(database, now.Add(ttl))
+		if err != nil || len(expired) != 1 || expired[0].ID != expiring.ID || expired[0].Status != StatusExpired {
+			t.Fatalf("Expected the second hold to expire, got %+v", expired)
+		}
+
+		if toolstest.Held(t, database, "aaron") != 0 {
+			t.Errorf("Expected nothing held, got %d", toolstest.Held(t, database, "aaron"))
+		}
+		if history := database.GetTransactionHistory("aaron"); len(history) != 0 {
+			t.Errorf("Expected no ledger entries, got %+v", history)
+		}
+	})
+
+	t.Run("Late_Capture_Is_Refused", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		hold, _ := Place(database, "aaron", "bryan", 10, "", ttl, now)
+		if _, err := Capture(database, hold.ID, "bryan", 0, now.Add(ttl)); !errors.Is(err, ErrNotAuthorized) {
+			t.Errorf("Expected ErrNotAuthorized after expiry, got %v", err)
+		}
+	})
+
+	t.Run("Hold_Resolved_Elsewhere_Is_Refused", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		// Another process released the storage hold first, the capture can't move the coins
+		hold, _ := Place(database, "aaron", "bryan", 10, "", ttl, now)
+		if _, err := database.ReleaseHold(hold.ID); err != nil {
+			t.Fatalf("Failed to release the storage hold: %v", err)
+		}
+		if _, err := Capture(database, hold.ID, "bryan", 0, now); !errors.Is(err, ErrNotAuthorized) {
+			t.Errorf("Expected ErrNotAuthorized, got %v", err)
+		}
+		if history := database.GetTransactionHistory("aaron"); len(history) != 0 {
+			t.Errorf("Expected no ledger entries, got %+v", history)
+		}
+	})
+
+	t.Run("Holds_Cap_Spending", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		// Storage refuses the second hold whatever the caller thought was spendable
+		if _, err := Place(database, "aaron", "bryan", 600, "", ttl, now); err != nil {
+			t.Fatalf("Failed to place: %v", err)
+		}
+		if _, err := Place(database, "aaron", "bryan", 500, "", ttl, now); !errors.Is(err, ErrInsufficientFunds) {
+			t.Errorf("Expected ErrInsufficientFunds, got %v", err)
+		}
+		if _, err := database.WithdrawUserCoins("aaron", 401); !errors.Is(err, tools.ErrInsufficientFunds) {
+			t.Errorf("Expected the held coins to be out of a withdrawal's reach, got %v", err)
+		}
+	})
+
+	t.Run("Refuses_Invalid_Holds", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		if _, err := Place(database, "aaron", "bryan", 10, "", 0, now); !errors.Is(err, ErrDisabled) {
+			t.Errorf("Expected ErrDisabled, got %v", err)
+		}
+		if _, err := Place(database, "aaron", "aaron", 10, "", ttl, now); !errors.Is(err, ErrInvalidHold) {
+			t.Errorf("Expected ErrInvalidHold for a hold payable to yourself, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+// Package leaderboard ranks the accounts whose owners opted in by balance. The board is
+// recomputed on a schedule and served from memory, so reads never touch storage.
+package leaderboard
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/profiles"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+type Entry struct {
+	// Equal balances share a rank, the next one skips, e.g. 1, 2, 2, 4
+	Rank     int
+	Username string
+	Coins    int64
+}
+
+type Board struct {
+	Entries    []Entry
+	ComputedAt time.Time
+}
+
+var (
+	mu      sync.RWMutex
+	current Board
+)
+
+// Refresh ranks the top size opted-in accounts and caches the result. The cached board
+// is kept when the opt-ins can't be read.
+func Refresh(database tools.DatabaseInterface, size int) (Board, error) {
+	optIns, err := profiles.LeaderboardOptIns(database)
+	if err != nil {
+		return Board{}, err
+	}
+	var balances []tools.CoinDetails = database.TopUserCoins(optIns, size)
+
+	var board = Board{Entries: make([]Entry, 0, len(balances)), ComputedAt: time.Now()}
+	for i, details := range balances {
+		var rank int = i + 1
+		if i > 0 && details.Coins == balances[i-1].Coins {
+			rank = board.Entries[i-1].Rank
+		}
+		board.Entries = append(board.Entries, Entry{Rank: rank, Username: details.Username, Coins: details.Coins})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	current = board
+	return board, nil
+}
+
+// Current returns the cached board, ComputedAt is zero before the first Refresh
+func Current() Board {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return Board{Entries: append([]Entry(nil), current.Entries...), ComputedAt: current.ComputedAt}
+}
+
+// Forget drops username from the cached board, so opting out takes effect before the
+// next refresh. Ranks below it are left as computed.
+func Forget(username string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var entries = make([]Entry, 0, len(current.Entries))
+	for _, entry := range current.Entries {
+		if entry.Username != username {
+			entries = append(entries, entry)
+		}
+	}
+	current.Entries = entries
+}
+
+// Schedule refreshes the board every interval until ctx is done
+func Schedule(ctx context.Context, interval time.Duration, size int, open func() (tools.DatabaseInterface, error)) {
+	var ticker *time.Ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		database, err := open()
+		if err != nil {
+			log.Error("Leaderboard refresh could not open the database: ", err)
+			continue
+		}
+
+		board, err := Refresh(database, size)
+		if err != nil {
+			log.Error("Leaderboard refresh failed: ", err)
+			continue
+		}
+		log.Debug("Leaderboard refreshed with ", len(board.Entries), " entries")
+	}
+}
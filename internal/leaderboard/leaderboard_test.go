@@ -0,0 +1,55 @@
+package leaderboard
+
+import (
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/profiles"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+func TestRefresh(t *testing.T) {
+	database, err := tools.NewMemoryDatabase(nil, map[string]tools.CoinDetails{
+		"lb_whale":   {Username: "lb_whale", Coins: 900},
+		"lb_private": {Username: "lb_private", Coins: 5000},
+		"lb_tie_a":   {Username: "lb_tie_a", Coins: 300},
+		"lb_tie_b":   {Username: "lb_tie_b", Coins: 300},
+		"lb_small":   {Username: "lb_small", Coins: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, username := range []string{"lb_whale", "lb_tie_b", "lb_tie_a", "lb_small"} {
+		profiles.SetLeaderboard(*database, username, true)
+	}
+
+	board, err := Refresh(*database, 3)
+	if err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+
+	// lb_private never opted in, lb_small falls outside the top 3
+	var expected = []Entry{
+		{Rank: 1, Username: "lb_whale", Coins: 900},
+		{Rank: 2, Username: "lb_tie_a", Coins: 300},
+		{Rank: 2, Username: "lb_tie_b", Coins: 300},
+	}
+	if len(board.Entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %+v", len(expected), board.Entries)
+	}
+	for i := range expected {
+		if board.Entries[i] != expected[i] {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, expected[i], board.Entries[i])
+		}
+	}
+
+	profiles.SetLeaderboard(*database, "lb_whale", false)
+	Forget("lb_whale")
+	if entries := Current().Entries; len(entries) != 2 || entries[0].Username != "lb_tie_a" {
+		t.Errorf("Expected lb_whale gone from the cached board, got %+v", entries)
+	}
+
+	if board, _ := Refresh(*database, 3); len(board.Entries) != 3 || board.Entries[2].Username != "lb_small" || board.Entries[0].Rank != 1 {
+		t.Errorf("Expected lb_small to move up after the refresh, got %+v", board.Entries)
+	}
+}
@@ -0,0 +1,83 @@
+// Package locales formats numbers and times for the locales users can pick on their
+// profile. Only the display copies of values are formatted, raw fields stay as they are.
+package locales
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locale is how one locale writes coin amounts and timestamps
+type Locale struct {
+	Tag string
+
+	// Separator between groups of three digits. Only numbers of at least 3+MinGrouping
+	// digits are grouped, so es-ES writes 1000 but 10.000.
+	Group       string
+	MinGrouping int
+
+	// Go layout for a date and time of day
+	DateTime string
+}
+
+var supported = map[string]Locale{
+	"en-US": {Tag: "en-US", Group: ",", MinGrouping: 1, DateTime: "01/02/2006 3:04 PM"},
+	"en-GB": {Tag: "en-GB", Group: ",", MinGrouping: 1, DateTime: "02/01/2006 15:04"},
+	"de-DE": {Tag: "de-DE", Group: ".", MinGrouping: 1, DateTime: "02.01.2006 15:04"},
+	"fr-FR": {Tag: "fr-FR", Group: "\u202f", MinGrouping: 1, DateTime: "02/01/2006 15:04"},
+	"es-ES": {Tag: "es-ES", Group: ".", MinGrouping: 2, DateTime: "02/01/2006 15:04"},
+}
+
+// Lookup finds a supported locale by its BCP 47 tag, ignoring case and accepting _
+// for -
+func Lookup(tag string) (Locale, bool) {
+	tag = strings.ReplaceAll(tag, "_", "-")
+	for key, locale := range supported {
+		if strings.EqualFold(key, tag) {
+			return locale, true
+		}
+	}
+	return Locale{}, false
+}
+
+// Tags lists the supported locales, sorted
+func Tags() []string {
+	var tags = make([]string, 0, len(supported))
+	for tag := range supported {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Number writes n with the locale's digit grouping
+func (l Locale) Number(n int64) string {
+	digits := strconv.FormatInt(n, 10)
+	var sign string
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if len(digits) < 3+l.MinGrouping {
+		return sign + digits
+	}
+
+	var builder strings.Builder
+	builder.WriteString(sign)
+	var first = len(digits) % 3
+	if first == 0 {
+		first = 3
+	}
+	builder.WriteString(digits[:first])
+	for i := first; i < len(digits); i += 3 {
+		builder.WriteString(l.Group)
+		builder.WriteString(digits[i : i+3])
+	}
+	return builder.String()
+}
+
+// Time writes t in location with the locale's date layout
+func (l Locale) Time(t time.Time, location *time.Location) string {
+	return t.In(location).Format(l.DateTime)
+}
@@ -0,0 +1,50 @@
+package locales
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNumber(t *testing.T) {
+	for _, test := range []struct {
+		tag  string
+		n    int64
+		want string
+	}{
+		{"en-US", 999, "999"},
+		{"en-US", 1000, "1,000"},
+		{"en-US", -1234567, "-1,234,567"},
+		{"de-DE", 1234567, "1.234.567"},
+		{"fr-FR", 12345, "12\u202f345"},
+		{"es-ES", 1000, "1000"},
+		{"es-ES", 10000, "10.000"},
+	} {
+		locale, ok := Lookup(test.tag)
+		if !ok {
+			t.Fatalf("Expected %s to be supported", test.tag)
+		}
+		if got := locale.Number(test.n); got != test.want {
+			t.Errorf("%s %d: expected %q, got %q", test.tag, test.n, test.want, got)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	var at = time.Date(2026, 3, 10, 20, 5, 0, 0, time.UTC)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("No zoneinfo for Europe/Berlin")
+	}
+
+	german, _ := Lookup("de-DE")
+	if got := german.Time(at, berlin); got != "10.03.2026 21:05" {
+		t.Errorf("Unexpected German time: %q", got)
+	}
+	american, _ := Lookup("en_us")
+	if got := american.Time(at, time.UTC); got != "03/10/2026 8:05 PM" {
+		t.Errorf("Unexpected American time: %q", got)
+	}
+	if _, ok := Lookup("xx-XX"); ok {
+		t.Error("Expected an unsupported tag to be refused")
+	}
+}
@@ -0,0 +1,152 @@
+package lockout
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// What a lock applies to
+const (
+	KindUsername = "username"
+	KindIP       = "ip"
+)
+
+type Key struct {
+	Kind  string
+	Value string
+}
+
+func Username(username string) Key {
+	return Key{Kind: KindUsername, Value: username}
+}
+
+func IP(ip string) Key {
+	return Key{Kind: KindIP, Value: ip}
+}
+
+// Lock is the failure count for one key, locked while LockedUntil is in the future
+type Lock struct {
+	Key
+	Failures     int
+	FirstFailure time.Time
+	LockedUntil  time.Time
+}
+
+// Locks by key, the process keeps one table and each isolated in-memory database its
+// own, see tools.ScopeOf
+type table map[Key]*Lock
+
+var (
+	mu     sync.Mutex
+	tables = tools.NewScoped(func() *table { return &table{} })
+)
+
+// Check returns when the latest lock on any of keys expires, zero if none is locked
+func Check(database tools.DatabaseInterface, keys ...Key) time.Time {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var locks table = *tables.For(database)
+	var until time.Time
+	var now = time.Now()
+	for _, key := range keys {
+		lock, ok := locks[key]
+		if ok && lock.LockedUntil.After(now) && lock.LockedUntil.After(until) {
+			until = lock.LockedUntil
+		}
+	}
+	return until
+}
+
+// RecordFailure counts a failed attempt against key. Reaching threshold failures
+// within duration locks the key for duration. Returns when the lock expires, zero
+// if the key isn't locked.
+func RecordFailure(database tools.DatabaseInterface, key Key, threshold int, duration time.Duration) time.Time {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var locks table = *tables.For(database)
+	var now = time.Now()
+	lock, ok := locks[key]
+	if !ok || (!lock.LockedUntil.After(now) && now.Sub(lock.FirstFailure) >= duration) {
+		lock = &Lock{Key: key, FirstFailure: now}
+		locks[key] = lock
+	}
+
+	lock.Failures++
+	if lock.Failures >= threshold && !lock.LockedUntil.After(now) {
+		lock.LockedUntil = now.Add(duration)
+		log.WithFields(log.Fields{
+			"kind":     key.Kind,
+			"value":    key.Value,
+			"failures": lock.Failures,
+			"until":    lock.LockedUntil,
+		}).Warn("Locked out after repeated failed authorization")
+	}
+
+	locks.forgetExpired(now, duration)
+	if !lock.LockedUntil.After(now) {
+		return time.Time{}
+	}
+	return lock.LockedUntil
+}
+
+// forgetExpired drops keys with no lock and no recent failures, callers hold mu
+func (locks table) forgetExpired(now time.Time, duration time.Duration) {
+	for key, lock := range locks {
+		if !lock.LockedUntil.After(now) && now.Sub(lock.FirstFailure) >= duration {
+			delete(locks, key)
+		}
+	}
+}
+
+// RecordSuccess clears the failure count of key, unless it is currently locked
+func RecordSuccess(database tools.DatabaseInterface, key Key) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var locks table = *tables.For(database)
+	lock, ok := locks[key]
+	if ok && !lock.LockedUntil.After(time.Now()) {
+		delete(locks, key)
+	}
+}
+
+// Unlock removes the lock and failure count of key, reporting whether there was one
+func Unlock(database tools.DatabaseInterface, key Key, by string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var locks table = *tables.For(database)
+	_, ok := locks[key]
+	delete(locks, key)
+
+	if ok {
+		log.WithFields(log.Fields{"kind": key.Kind, "value": key.Value, "by": by}).Info("Lockout lifted")
+	}
+	return ok
+}
+
+// Locked returns the keys that are locked right now, soonest expiry first
+func Locked(database tools.DatabaseInterface) []Lock {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var locks table = *tables.For(database)
+	var now = time.Now()
+	var result = []Lock{}
+	for _, lock := range locks {
+		if lock.LockedUntil.After(now) {
+			result = append(result, *lock)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LockedUntil.Before(result[j].LockedUntil)
+	})
+	return result
+}
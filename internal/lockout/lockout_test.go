@@ -0,0 +1,54 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	t.Run("Locks_At_Threshold", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if !RecordFailure(nil, Username("mallory"), 3, time.Minute).IsZero() {
+				t.Fatalf("Locked after only %d failures", i+1)
+			}
+		}
+		if RecordFailure(nil, Username("mallory"), 3, time.Minute).IsZero() {
+			t.Fatalf("Expected a lock after 3 failures")
+		}
+
+		if Check(nil, IP("10.0.0.1"), Username("mallory")).IsZero() {
+			t.Errorf("Expected mallory to be locked")
+		}
+		if !Check(nil, Username("aaron")).IsZero() {
+			t.Errorf("Other usernames must not be locked")
+		}
+
+		// A correct token doesn't lift an active lock
+		RecordSuccess(nil, Username("mallory"))
+		if Check(nil, Username("mallory")).IsZero() {
+			t.Errorf("Success must not clear an active lock")
+		}
+	})
+
+	t.Run("Admin_Unlock", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			RecordFailure(nil, Username("trudy"), 3, time.Minute)
+		}
+		if !Unlock(nil, Username("trudy"), "admin") {
+			t.Fatalf("Expected a lock to remove")
+		}
+		if !Check(nil, Username("trudy")).IsZero() {
+			t.Errorf("Expected trudy to be unlocked")
+		}
+	})
+
+	t.Run("Success_Resets_Count", func(t *testing.T) {
+		RecordFailure(nil, Username("eve"), 3, time.Minute)
+		RecordFailure(nil, Username("eve"), 3, time.Minute)
+		RecordSuccess(nil, Username("eve"))
+
+		if !RecordFailure(nil, Username("eve"), 3, time.Minute).IsZero() {
+			t.Errorf("Failures before a success should not count")
+		}
+	})
+}
@@ -0,0 +1,225 @@
+// Package messages renders user-facing messages from templates operators can reword,
+// for white-label deployments. Templates name their values in braces, like {amount},
+// and only the placeholders listed for each message are accepted. Messages rendered for
+// a locale use its translation, when there is one, and its number format.
+package messages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/bryantjandra/goapi/internal/locales"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrInvalidTemplate = errors.New("invalid message template")
+
+// Message names, as used in the templates file
+const (
+	TransferSuccess   = "transfer_success"
+	InsufficientFunds = "insufficient_funds"
+)
+
+var defaults = map[string]string{
+	TransferSuccess:   "You have successfully transferred {amount} to {to}. Your current balance is {balance}",
+	InsufficientFunds: "insufficient funds: {amount} requested but the balance is {balance}",
+}
+
+// Built-in translations of the defaults by locale, others use the defaults
+var translations = map[string]map[string]string{
+	"de-DE": {
+		TransferSuccess:   "Sie haben {amount} an {to} überwiesen. Ihr aktueller Kontostand beträgt {balance}",
+		InsufficientFunds: "Guthaben nicht ausreichend: {amount} angefordert, der Kontostand beträgt {balance}",
+	},
+	"fr-FR": {
+		TransferSuccess:   "Vous avez transféré {amount} à {to}. Votre solde actuel est de {balance}",
+		InsufficientFunds: "fonds insuffisants : {amount} demandés mais le solde est de {balance}",
+	},
+	"es-ES": {
+		TransferSuccess:   "Ha transferido {amount} a {to}. Su saldo actual es {balance}",
+		InsufficientFunds: "fondos insuficientes: se solicitaron {amount} pero el saldo es {balance}",
+	},
+}
+
+// Placeholders each message may use
+var placeholders = map[string][]string{
+	TransferSuccess:   {"amount", "to", "balance"},
+	InsufficientFunds: {"amount", "balance"},
+}
+
+// Values fills a template's placeholders
+type Values map[string]interface{}
+
+// segment is literal text, or a placeholder when name is set
+type segment struct {
+	text string
+	name string
+}
+
+var (
+	mu sync.RWMutex
+
+	// Locale tag -> message -> template, "" holds the defaults
+	compiled = mustCompile(nil)
+)
+
+// compile parses one template, rejecting unknown placeholders and stray braces
+func compile(message string, text string) ([]segment, error) {
+	var segments []segment
+	for text != "" {
+		open := strings.IndexAny(text, "{}")
+		if open < 0 {
+			segments = append(segments, segment{text: text})
+			break
+		}
+		if text[open] == '}' {
+			return nil, fmt.Errorf("%w: %s has an unmatched }", ErrInvalidTemplate, message)
+		}
+
+		end := strings.IndexByte(text[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: %s has an unclosed {", ErrInvalidTemplate, message)
+		}
+		var name string = text[open+1 : open+end]
+		if !slices.Contains(placeholders[message], name) {
+			return nil, fmt.Errorf("%w: %s has unknown placeholder {%s}, it accepts {%s}",
+				ErrInvalidTemplate, message, name, strings.Join(placeholders[message], "}, {"))
+		}
+
+		if open > 0 {
+			segments = append(segments, segment{text: text[:open]})
+		}
+		segments = append(segments, segment{name: name})
+		text = text[open+end+1:]
+	}
+	return segments, nil
+}
+
+// compileAll compiles overrides on top of the defaults and translations. An override
+// named message replaces the default, one named locale:message that locale's wording.
+func compileAll(overrides map[string]string) (map[string]map[string][]segment, error) {
+	var templates = map[string]map[string]string{"": maps.Clone(defaults)}
+	for tag, translated := range translations {
+		templates[tag] = maps.Clone(translated)
+	}
+
+	for name, text := range overrides {
+		tag, message, localized := strings.Cut(name, ":")
+		if !localized {
+			tag, message = "", name
+		}
+		if _, ok := defaults[message]; !ok {
+			return nil, fmt.Errorf("%w: unknown message %s", ErrInvalidTemplate, message)
+		}
+		if localized {
+			locale, ok := locales.Lookup(tag)
+			if !ok {
+				return nil, fmt.Errorf("%w: unsupported locale %s in %s", ErrInvalidTemplate, tag, name)
+			}
+			tag = locale.Tag
+			if templates[tag] == nil {
+				templates[tag] = map[string]string{}
+			}
+		}
+		templates[tag][message] = text
+	}
+
+	var result = map[string]map[string][]segment{}
+	for tag, messages := range templates {
+		result[tag] = map[string][]segment{}
+		for message, text := range messages {
+			segments, err := compile(message, text)
+			if err != nil {
+				return nil, err
+			}
+			result[tag][message] = segments
+		}
+	}
+	return result, nil
+}
+
+func mustCompile(templates map[string]string) map[string]map[string][]segment {
+	result, err := compileAll(templates)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// Load replaces the templates with the defaults plus the overrides in the JSON file at
+// path, an object from message name to template. Nothing changes unless every template
+// compiles, so a bad edit on reload keeps the previous wording. An empty path restores
+// the defaults.
+func Load(path string) error {
+	var overrides = map[string]string{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading message templates: %w", err)
+		}
+		err = json.Unmarshal(data, &overrides)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+		}
+	}
+
+	result, err := compileAll(overrides)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	compiled = result
+	log.Info("Loaded ", len(overrides), " message template override(s)")
+	return nil
+}
+
+// Render fills in message. Placeholders without a value are left out.
+func Render(message string, values Values) string {
+	return RenderIn("", message, values)
+}
+
+// RenderIn fills in message for the locale tag, with its wording when there is one
+// and its grouping for whole numbers. An unsupported or empty tag renders as Render.
+func RenderIn(tag string, message string, values Values) string {
+	locale, localized := locales.Lookup(tag)
+
+	mu.RLock()
+	segments, ok := compiled[locale.Tag][message]
+	if !ok {
+		segments = compiled[""][message]
+	}
+	mu.RUnlock()
+
+	var builder strings.Builder
+	for _, segment := range segments {
+		if segment.name == "" {
+			builder.WriteString(segment.text)
+			continue
+		}
+		value, ok := values[segment.name]
+		if !ok {
+			continue
+		}
+		switch number := value.(type) {
+		case int64:
+			if localized {
+				value = locale.Number(number)
+			}
+		case int:
+			if localized {
+				value = locale.Number(int64(number))
+			}
+		}
+		builder.WriteString(fmt.Sprint(value))
+	}
+	return builder.String()
+}
@@ -0,0 +1,81 @@
+package messages
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	defer Load("")
+
+	var write = func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "messages.json")
+		err := os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("Failed to write templates: %v", err)
+		}
+		return path
+	}
+	var values = Values{"amount": 5, "to": "bryan", "balance": 995}
+
+	err := Load(write(t, `{"transfer_success": "Sent {amount} credits to {to}! {balance} left."}`))
+	if err != nil {
+		t.Fatalf("Expected templates to load, got: %v", err)
+	}
+	if got := Render(TransferSuccess, values); got != "Sent 5 credits to bryan! 995 left." {
+		t.Errorf("Unexpected message: %q", got)
+	}
+	if got := Render(InsufficientFunds, values); got != "insufficient funds: 5 requested but the balance is 995" {
+		t.Errorf("Expected the default for messages not overridden, got %q", got)
+	}
+
+	for _, content := range []string{
+		`{"transfer_success": "Sent {amount} from {from}"}`,
+		`{"transfer_success": "Sent {amount"}`,
+		`{"transfer_success": "Sent amount}"}`,
+		`{"welcome": "Hello"}`,
+		`not json`,
+	} {
+		err := Load(write(t, content))
+		if !errors.Is(err, ErrInvalidTemplate) {
+			t.Errorf("Expected %s to be rejected, got %v", content, err)
+		}
+	}
+
+	// The rejected files left the last good templates in place
+	if got := Render(TransferSuccess, values); got != "Sent 5 credits to bryan! 995 left." {
+		t.Errorf("Expected previous templates to be kept, got %q", got)
+	}
+}
+
+func TestRenderIn(t *testing.T) {
+	defer Load("")
+	var values = Values{"amount": int64(1500), "to": "bryan", "balance": int64(1234567)}
+
+	if got := RenderIn("de-DE", TransferSuccess, values); got != "Sie haben 1.500 an bryan überwiesen. Ihr aktueller Kontostand beträgt 1.234.567" {
+		t.Errorf("Unexpected German message: %q", got)
+	}
+	if got := RenderIn("", TransferSuccess, values); got != Render(TransferSuccess, values) {
+		t.Errorf("Expected no locale to render the default, got %q", got)
+	}
+	// en-GB has no translation, only its number format
+	if got := RenderIn("en_gb", TransferSuccess, values); got != "You have successfully transferred 1,500 to bryan. Your current balance is 1,234,567" {
+		t.Errorf("Unexpected British message: %q", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "messages.json")
+	os.WriteFile(path, []byte(`{"de-DE:transfer_success": "{amount} an {to} gesendet"}`), 0o600)
+	if err := Load(path); err != nil {
+		t.Fatalf("Expected a locale override to load, got: %v", err)
+	}
+	if got := RenderIn("de-DE", TransferSuccess, values); got != "1.500 an bryan gesendet" {
+		t.Errorf("Expected the override, got %q", got)
+	}
+
+	os.WriteFile(path, []byte(`{"xx-XX:transfer_success": "{amount}"}`), 0o600)
+	if err := Load(path); !errors.Is(err, ErrInvalidTemplate) {
+		t.Errorf("Expected an unsupported locale to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+var ForbiddenError = errors.New("Admin role required")
+
+// RequireAdmin must run after Authorization, which has already verified the token
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Break-glass tokens have no login, Authorization already made them admins
+		if principal, _ := auth.From(r.Context()); principal.BreakGlass != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var username string = r.URL.Query().Get("username")
+
+		database, err := tools.OpenDatabase(r.Context())
+		if err != nil {
+			log.Error("Failed to connect to database during admin check: ", err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		loginDetails := (*database).GetUserLoginDetails(username)
+
+		if loginDetails == nil || loginDetails.Role != tools.RoleAdmin {
+			log.Error("Admin access denied for user: ", username)
+			api.ForbiddenErrorHandler(w, ForbiddenError)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
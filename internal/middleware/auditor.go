@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/audit"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/tools"
+	chimiddle "github.com/go-chi/chi/middleware"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	AuditorRoleError = errors.New("Auditor or admin role required")
+	ReadOnlyError    = errors.New("Auditors have read-only access")
+)
+
+// RequireAuditAccess guards the read-only audit viewer. Auditors and admins may use it,
+// only for reads, and every request is logged. Must run after Authorization.
+func RequireAuditAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var username string = r.URL.Query().Get("username")
+
+		database, err := tools.OpenDatabase(r.Context())
+		if err != nil {
+			log.Error("Failed to connect to database during audit access check: ", err)
+			api.InternalErrorHandler(w)
+			return
+		}
+
+		loginDetails := (*database).GetUserLoginDetails(username)
+
+		var role string
+		if loginDetails != nil {
+			role = loginDetails.Role
+		}
+		if principal, _ := auth.From(r.Context()); principal.BreakGlass != "" {
+			role = principal.Role
+		}
+
+		var wrapped = chimiddle.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			// Nothing written means the handler returned an empty 200
+			var status int = wrapped.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			var entry = audit.AccessEntry{
+				Username: username,
+				Role:     role,
+				Method:   r.Method,
+				Path:     r.URL.Path,
+				Query:    audit.RedactQuery(r.URL.Query()),
+				IP:       ClientIP(r),
+				Status:   status,
+				At:       time.Now(),
+			}
+			audit.RecordAccess(entry)
+
+			log.WithFields(log.Fields{
+				"username": entry.Username,
+				"role":     entry.Role,
+				"method":   entry.Method,
+				"path":     entry.Path,
+				"ip":       entry.IP,
+				"status":   entry.Status,
+			}).Info("Audit viewer access")
+		}()
+
+		if role != tools.RoleAuditor && role != tools.RoleAdmin {
+			log.Error("Audit access denied for user: ", username)
+			api.ForbiddenErrorHandler(wrapped, AuditorRoleError)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			api.ForbiddenErrorHandler(wrapped, ReadOnlyError)
+			return
+		}
+
+		next.ServeHTTP(wrapped, r)
+	})
+}
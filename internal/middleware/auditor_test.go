@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/audit"
+)
+
+func TestRequireAuditAccess(t *testing.T) {
+	var handler = RequireAuditAccess(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	var cases = []struct {
+		name     string
+		method   string
+		username string
+		expected int
+	}{
+		{"Auditor_Reads", http.MethodGet, "auditor", http.StatusOK},
+		{"Admin_Reads", http.MethodGet, "admin", http.StatusOK},
+		{"Auditor_Cannot_Mutate", http.MethodPost, "auditor", http.StatusForbidden},
+		{"User_Denied", http.MethodGet, "aaron", http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			before := len(audit.AccessLog())
+
+			req := httptest.NewRequest(c.method, "/audit/transactions?username="+c.username+"&token=hunter2", nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != c.expected {
+				t.Errorf("Expected %d, got %d", c.expected, w.Code)
+			}
+
+			entries := audit.AccessLog()
+			if len(entries) != before+1 {
+				t.Fatalf("Expected the request to be logged")
+			}
+			last := entries[len(entries)-1]
+			if last.Username != c.username || last.Status != c.expected || last.Query != "token=%5BREDACTED%5D&username="+c.username {
+				t.Errorf("Unexpected access entry: %+v", last)
+			}
+		})
+	}
+}
@@ -3,18 +3,141 @@ package middleware
 import (
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/breakglass"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/dormancy"
+	"github.com/bryantjandra/goapi/internal/lockout"
+	"github.com/bryantjandra/goapi/internal/oidc"
+	"github.com/bryantjandra/goapi/internal/signing"
+	"github.com/bryantjandra/goapi/internal/tokens"
 	"github.com/bryantjandra/goapi/internal/tools"
 	log "github.com/sirupsen/logrus"
 )
 
 var UnAuthorizedError = errors.New("Invalid username or token")
 
+var LockedError = errors.New("Too many failed authorization attempts, try again later")
+
+// lockoutKeys pairs each lockout key with its threshold, keys with a 0 threshold are skipped
+func lockoutKeys(cfg config.Config, username string, ip string) map[lockout.Key]int {
+	var keys = map[lockout.Key]int{}
+	if cfg.LockoutThreshold > 0 && username != "" {
+		keys[lockout.Username(username)] = cfg.LockoutThreshold
+	}
+	if cfg.LockoutIPThreshold > 0 {
+		keys[lockout.IP(ip)] = cfg.LockoutIPThreshold
+	}
+	return keys
+}
+
+// recordAuthFailure counts the failure against every key and returns the latest lock expiry
+func recordAuthFailure(database tools.DatabaseInterface, cfg config.Config, keys map[lockout.Key]int) time.Time {
+	var until time.Time
+	for key, threshold := range keys {
+		locked := lockout.RecordFailure(database, key, threshold, cfg.LockoutDuration)
+		if locked.After(until) {
+			until = locked
+		}
+	}
+	return until
+}
+
+// refuseLocked writes a 423 with Retry-After if until is set
+func refuseLocked(w http.ResponseWriter, until time.Time) bool {
+	if until.IsZero() {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+	api.LockedErrorHandler(w, LockedError)
+	return true
+}
+
+// verifySignature checks an HMAC signed request for username. A replayed nonce or stale
+// timestamp gets its own message, anything else is the usual UnAuthorizedError.
+func verifySignature(r *http.Request, cfg config.Config, username string, header string) error {
+	credentials, err := signing.Parse(header)
+	if err != nil || credentials.Username != username {
+		return UnAuthorizedError
+	}
+
+	secret, ok := cfg.SigningSecrets[username]
+	if !ok {
+		return UnAuthorizedError
+	}
+
+	err = signing.Verify(r, credentials, secret, cfg.SigningMaxSkew, cfg.SigningNonceCache)
+	if errors.Is(err, signing.ErrExpired) || errors.Is(err, signing.ErrReplayed) {
+		return err
+	}
+	if err != nil {
+		return UnAuthorizedError
+	}
+	return nil
+}
+
 func Authorization(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var username string = r.URL.Query().Get("username")
 		var token = r.Header.Get("Authorization")
+		var cfg config.Config = config.Get()
+		var ip string = ClientIP(r)
+
+		// Break-glass tokens stand for no login, the grant is the whole credential
+		if breakglass.IsBreakGlass(token) {
+			breakGlass(next, w, r, cfg, ip)
+			return
+		}
+
+		// Identity provider and access tokens name the user themselves, the username
+		// parameter is optional. An access token can't be exchanged for a new one at /login.
+		var identity *oidc.Identity
+		var bearer bool = oidc.IsBearer(token) && (cfg.AuthMode == config.AuthModeOIDC ||
+			cfg.AuthMode == config.AuthModeJWT && r.URL.Path != LoginPath)
+		if bearer {
+			if refuseLocked(w, lockout.Check(tools.AttachedDatabase(r.Context()), lockout.IP(ip))) {
+				log.Warn("Authorization refused for locked out client ", ip)
+				return
+			}
+
+			verified, err := verifyBearer(r.Context(), cfg, token)
+			if errors.Is(err, tokens.ErrInvalidKey) {
+				log.Error("Failed to load access token key: ", err)
+				api.InternalErrorHandler(w)
+				return
+			}
+			if err != nil {
+				log.Error("Authorization failed: ", err)
+				if refuseLocked(w, recordAuthFailure(tools.AttachedDatabase(r.Context()), cfg, lockoutKeys(cfg, "", ip))) {
+					return
+				}
+				api.RequestErrorHandler(w, UnAuthorizedError)
+				return
+			}
+			if username != "" && username != verified.Username {
+				log.Error("Authorization failed: token for ", verified.Username, " used as ", username)
+				api.ForbiddenErrorHandler(w, WrongUserError)
+				return
+			}
+
+			username = verified.Username
+			withUsername(r, username)
+			if cfg.AuthMode == config.AuthModeOIDC {
+				identity = &verified
+			}
+		}
+
+		// The jwt auth mode only takes static tokens at /login
+		if cfg.AuthMode == config.AuthModeJWT && !bearer && !signing.IsSigned(token) && r.URL.Path != LoginPath {
+			log.Error("Authorization failed for user: ", username, " - static token outside ", LoginPath)
+			api.RequestErrorHandler(w, AccessTokenRequiredError)
+			return
+		}
 
 		if username == "" || token == "" {
 			log.Error("Authorization failed: missing username or token")
@@ -22,7 +145,19 @@ func Authorization(next http.Handler) http.Handler {
 			return
 		}
 
-		database, err := tools.NewDatabase()
+		// Usernames and client IPs are locked out after repeated bad credentials
+		var keys = lockoutKeys(cfg, username, ip)
+
+		var checked []lockout.Key
+		for key := range keys {
+			checked = append(checked, key)
+		}
+		if refuseLocked(w, lockout.Check(tools.AttachedDatabase(r.Context()), checked...)) {
+			log.Warn("Authorization refused for locked out user ", username, " from ", ip)
+			return
+		}
+
+		database, err := tools.OpenDatabase(r.Context())
 		if err != nil {
 			log.Error("Failed to connect to database during authorization: ", err)
 			api.InternalErrorHandler(w)
@@ -30,13 +165,64 @@ func Authorization(next http.Handler) http.Handler {
 		}
 
 		loginDetails := (*database).GetUserLoginDetails(username)
+		if loginDetails == nil && identity != nil && cfg.OIDCAutoProvision {
+			loginDetails = provision(*database, username)
+		}
+
+		var valid bool
+		var failure error = UnAuthorizedError
+		if bearer {
+			valid = loginDetails != nil
+		} else if signing.IsSigned(token) {
+			// Server-to-server callers sign the request instead of sending the token
+			failure = verifySignature(r, cfg, username, token)
+			valid = loginDetails != nil && failure == nil
+		} else if cfg.AuthMode != config.AuthModeOIDC {
+			// The demo profile lets playground clients use one shared token
+			var demoToken bool = cfg.AuthMode == config.AuthModeDemo && token == config.DemoToken
+			valid = loginDetails != nil && (token == (*loginDetails).AuthToken || demoToken)
+		}
 
-		if loginDetails == nil || (token != (*loginDetails).AuthToken) {
+		if !valid {
 			log.Error("Authorization failed for user: ", username, " - invalid credentials")
-			api.RequestErrorHandler(w, UnAuthorizedError)
+			if refuseLocked(w, recordAuthFailure(tools.AttachedDatabase(r.Context()), cfg, keys)) {
+				return
+			}
+			api.RequestErrorHandler(w, failure)
+			return
+		}
+		lockout.RecordSuccess(*database, lockout.Username(username))
+		dormancy.RecordActivity(username, time.Now())
+
+		// Provider tokens only reach what their scopes allow, on top of the account's role
+		if identity != nil && !identity.HasScope(requiredScope(r)) {
+			log.Error("Request refused for ", username, ": token lacks scope ", requiredScope(r))
+			api.ForbiddenErrorHandler(w, missingScope(requiredScope(r)))
+			return
+		}
+
+		// Auditors are read-only everywhere, not just in the audit viewer, but may still log in
+		if loginDetails.Role == tools.RoleAuditor && isMutation(r.Method) && r.URL.Path != LoginPath {
+			log.Error("Mutation refused for auditor: ", username, " ", r.Method, " ", r.URL.Path)
+			api.ForbiddenErrorHandler(w, ReadOnlyError)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		var principal = auth.Principal{Username: username, Role: loginDetails.Role}
+
+		// A co-owner names the joint account they act on
+		if account := r.Header.Get(auth.AccountHeader); account != "" && account != username {
+			var ok bool
+			principal, ok = jointAccount(w, r, *database, principal, account)
+			if !ok {
+				return
+			}
+			if isMutation(r.Method) {
+				recordOwnerOperation(next, w, r.WithContext(auth.WithPrincipal(r.Context(), principal)), principal)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
 	})
 }
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/audit"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/breakglass"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/lockout"
+	"github.com/bryantjandra/goapi/internal/tools"
+	chimiddle "github.com/go-chi/chi/middleware"
+	log "github.com/sirupsen/logrus"
+)
+
+var BreakGlassScopeError = errors.New("Break-glass tokens can only be used under /admin and /audit")
+
+// breakGlass serves a request sent with a break-glass token as an admin named after the
+// operator, and records it whatever the outcome
+func breakGlass(next http.Handler, w http.ResponseWriter, r *http.Request, cfg config.Config, ip string) {
+	if refuseLocked(w, lockout.Check(tools.AttachedDatabase(r.Context()), lockout.IP(ip))) {
+		log.Warn("Break-glass authorization refused for locked out client ", ip)
+		return
+	}
+
+	grant, err := breakglass.Verify(r.Header.Get("Authorization"), time.Now())
+	if err != nil {
+		log.Error("Break-glass authorization failed from ", ip, ": ", err)
+		if refuseLocked(w, recordAuthFailure(tools.AttachedDatabase(r.Context()), cfg, lockoutKeys(cfg, "", ip))) {
+			return
+		}
+		api.RequestErrorHandler(w, UnAuthorizedError)
+		return
+	}
+
+	var principal = auth.Principal{Username: "break-glass:" + grant.Operator, Role: tools.RoleAdmin, BreakGlass: grant.ID}
+	withUsername(r, principal.Username)
+
+	var wrapped = chimiddle.NewWrapResponseWriter(w, r.ProtoMajor)
+	if strings.HasPrefix(r.URL.Path, "/admin/") || strings.HasPrefix(r.URL.Path, "/audit/") {
+		next.ServeHTTP(wrapped, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	} else {
+		api.ForbiddenErrorHandler(wrapped, BreakGlassScopeError)
+	}
+
+	// Nothing written means the handler returned an empty 200
+	var status int = wrapped.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	events.Record(tools.AttachedDatabase(r.Context()), events.BreakGlassUsed, principal.Username, map[string]interface{}{
+		"grant":  grant.ID,
+		"reason": grant.Reason,
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"query":  audit.RedactQuery(r.URL.Query()),
+		"ip":     ip,
+		"status": status,
+	})
+	log.WithFields(log.Fields{
+		"grant":    grant.ID,
+		"operator": grant.Operator,
+		"method":   r.Method,
+		"path":     r.URL.Path,
+		"ip":       ip,
+		"status":   status,
+	}).Warn("Break-glass request")
+}
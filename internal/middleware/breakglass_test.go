@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/breakglass"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+func TestBreakGlass(t *testing.T) {
+	database, err := tools.NewDatabase()
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	grant, token, err := breakglass.Mint("oncall", "INC-9: stuck freeze", time.Minute, time.Hour, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to mint: %v", err)
+	}
+
+	var seen auth.Principal
+	var handler = Authorization(RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = auth.From(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	serve := func(path string, header string) int {
+		seen = auth.Principal{}
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(tools.WithDatabase(req.Context(), *database))
+		req.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("Acts_As_An_Admin_And_Is_Recorded", func(t *testing.T) {
+		if code := serve("/admin/freezes", breakglass.Scheme+token); code != http.StatusOK {
+			t.Fatalf("Expected the break-glass token through, got %d", code)
+		}
+		if seen.Role != tools.RoleAdmin || seen.BreakGlass != grant.ID || seen.Username != "break-glass:oncall" {
+			t.Errorf("Expected an admin principal for the grant, got %+v", seen)
+		}
+
+		var used bool
+		for _, event := range events.Since(*database, 0, 0) {
+			if event.Type == events.BreakGlassUsed && event.Data["grant"] == grant.ID {
+				used = event.Data["path"] == "/admin/freezes" && event.Data["reason"] == "INC-9: stuck freeze"
+			}
+		}
+		if !used {
+			t.Error("Expected the request recorded with the grant's reason")
+		}
+	})
+
+	t.Run("Only_Admin_And_Audit_Routes", func(t *testing.T) {
+		if code := serve("/account/coins?username=aaron", breakglass.Scheme+token); code != http.StatusForbidden {
+			t.Errorf("Expected the token refused under /account, got %d", code)
+		}
+	})
+
+	t.Run("Revoked_Token_Is_Refused", func(t *testing.T) {
+		breakglass.Revoke(grant.ID, time.Now())
+		if code := serve("/admin/freezes", breakglass.Scheme+token); code != http.StatusBadRequest {
+			t.Errorf("Expected the revoked token refused, got %d", code)
+		}
+		if code := serve("/admin/freezes", breakglass.Scheme+"guess"); code != http.StatusBadRequest {
+			t.Errorf("Expected an unknown token refused, got %d", code)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/bryantjandra/goapi/internal/config"
+)
+
+var (
+	proxiesMu   sync.Mutex
+	proxiesFrom []string
+	proxies     []netip.Prefix
+)
+
+// trustedProxies parses config.TrustedProxies, again only when the list changes
+func trustedProxies() []netip.Prefix {
+	var configured []string = config.Get().TrustedProxies
+
+	proxiesMu.Lock()
+	defer proxiesMu.Unlock()
+
+	if strings.Join(configured, ",") != strings.Join(proxiesFrom, ",") || proxies == nil {
+		proxies = []netip.Prefix{}
+		for _, proxy := range configured {
+			// Validate already refused anything unparseable
+			if prefix, err := config.ParseProxy(proxy); err == nil {
+				proxies = append(proxies, prefix)
+			}
+		}
+		proxiesFrom = configured
+	}
+	return proxies
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHop reads one forwarded address, some proxies include the port
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.TrimSpace(hop)
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(strings.Trim(hop, "[]"))
+	return addr.Unmap(), err == nil
+}
+
+// ClientIP is the address of the client that sent the request. Forwarding headers
+// are only believed when the peer is a trusted proxy. X-Forwarded-For is then read
+// from the right, skipping trusted proxies, since each proxy appends the address it
+// received from and anything further left could have been sent by the client.
+// X-Real-IP is used when there is no X-Forwarded-For.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, ok := parseHop(host)
+	var trusted []netip.Prefix = trustedProxies()
+	if !ok || !isTrusted(peer, trusted) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	if len(hops) == 0 {
+		if realIP, ok := parseHop(r.Header.Get("X-Real-IP")); ok {
+			return realIP.String()
+		}
+		return peer.String()
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseHop(hops[i])
+		if !ok {
+			// Garbage can't be trusted, the last proxy that added it is the client
+			break
+		}
+		peer = hop
+		if !isTrusted(hop, trusted) {
+			break
+		}
+	}
+	return peer.String()
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/config"
+)
+
+func TestClientIP(t *testing.T) {
+	var cfg config.Config = config.Default()
+	cfg.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.1"}
+	config.Set(cfg)
+	defer config.Set(config.Default())
+
+	cases := []struct {
+		name      string
+		peer      string
+		forwarded []string
+		realIP    string
+		expected  string
+	}{
+		{"Direct_Client", "203.0.113.9:5000", nil, "", "203.0.113.9"},
+		{"Untrusted_Peer_Headers_Ignored", "203.0.113.9:5000", []string{"1.2.3.4"}, "5.6.7.8", "203.0.113.9"},
+		{"Trusted_Proxy", "10.1.2.3:5000", []string{"198.51.100.7"}, "", "198.51.100.7"},
+		{"Spoofed_Left_Entries_Ignored", "10.1.2.3:5000", []string{"6.6.6.6, 198.51.100.7"}, "", "198.51.100.7"},
+		{"Chain_Of_Trusted_Proxies", "192.168.1.1:5000", []string{"198.51.100.7, 10.9.9.9", "10.0.0.2"}, "", "198.51.100.7"},
+		{"All_Hops_Trusted", "10.1.2.3:5000", []string{"10.0.0.5"}, "", "10.0.0.5"},
+		{"Garbage_Hop", "10.1.2.3:5000", []string{"nonsense, 10.0.0.5"}, "", "10.0.0.5"},
+		{"Hop_With_Port", "10.1.2.3:5000", []string{"[2001:db8::1]:443"}, "", "2001:db8::1"},
+		{"Real_IP", "10.1.2.3:5000", nil, "198.51.100.8", "198.51.100.8"},
+		{"Forwarded_For_Wins_Over_Real_IP", "10.1.2.3:5000", []string{"198.51.100.7"}, "198.51.100.8", "198.51.100.7"},
+		{"Untrusted_Neighbour_Address", "192.168.1.2:5000", []string{"198.51.100.7"}, "", "192.168.1.2"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/status", nil)
+			request.RemoteAddr = c.peer
+			for _, value := range c.forwarded {
+				request.Header.Add("X-Forwarded-For", value)
+			}
+			if c.realIP != "" {
+				request.Header.Set("X-Real-IP", c.realIP)
+			}
+
+			if ip := ClientIP(request); ip != c.expected {
+				t.Errorf("Expected %s, got %s", c.expected, ip)
+			}
+		})
+	}
+}
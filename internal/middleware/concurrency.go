@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+var OverloadedError = errors.New("Too many changes in progress, retry shortly")
+
+// How long refused callers are asked to wait
+const overloadRetryAfter = time.Second
+
+// MutationLimiter caps how many mutations run at once, across the server and per role,
+// so a spike queues up in clients instead of in front of storage. Reads are never limited.
+type MutationLimiter struct {
+	global chan struct{}
+	roles  map[string]chan struct{}
+}
+
+// NewMutationLimiter allows global mutations in flight and limits[role] per role,
+// 0 or a missing role is unlimited
+func NewMutationLimiter(global int, limits map[string]int) *MutationLimiter {
+	var limiter = &MutationLimiter{roles: map[string]chan struct{}{}}
+	if global > 0 {
+		limiter.global = make(chan struct{}, global)
+	}
+	for role, limit := range limits {
+		if limit > 0 {
+			limiter.roles[role] = make(chan struct{}, limit)
+		}
+	}
+	return limiter
+}
+
+// acquire takes a slot from slots without waiting, a nil semaphore is unlimited
+func acquire(slots chan struct{}) bool {
+	if slots == nil {
+		return true
+	}
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func release(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+// role looks up the caller's role, Authorization has already checked the token
+func role(r *http.Request) string {
+	database, err := tools.OpenDatabase(r.Context())
+	if err != nil {
+		return ""
+	}
+	loginDetails := (*database).GetUserLoginDetails(r.URL.Query().Get("username"))
+	if loginDetails == nil {
+		return ""
+	}
+	return loginDetails.Role
+}
+
+// Middleware must run after Authorization
+func (l *MutationLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isMutation(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var slots chan struct{}
+		var scope string = "global"
+		if len(l.roles) > 0 {
+			scope = role(r)
+			slots = l.roles[scope]
+		}
+
+		if !acquire(slots) {
+			refuseOverloaded(w, r, scope)
+			return
+		}
+		defer release(slots)
+
+		if !acquire(l.global) {
+			refuseOverloaded(w, r, "global")
+			return
+		}
+		defer release(l.global)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func refuseOverloaded(w http.ResponseWriter, r *http.Request, scope string) {
+	log.Warn("Mutation limit reached for ", scope, ", refusing ", r.Method, " ", r.URL.Path)
+	w.Header().Set("Retry-After", strconv.Itoa(int(overloadRetryAfter.Seconds())))
+	api.ServiceUnavailableErrorHandler(w, OverloadedError)
+}
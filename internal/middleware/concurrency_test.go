@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+func TestMutationLimiter(t *testing.T) {
+	logins, coins := tools.DemoAccounts()
+	database, err := tools.NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	limiter := NewMutationLimiter(2, map[string]int{tools.RoleUser: 1})
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			started <- struct{}{}
+			<-release
+		}
+	}))
+
+	var serve = func(method string, username string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/?username="+username, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r.WithContext(tools.WithDatabase(r.Context(), *database)))
+		return w
+	}
+
+	// One user mutation and one admin mutation fill the user and global limits
+	var wg sync.WaitGroup
+	for _, username := range []string{"aaron", "admin"} {
+		wg.Add(1)
+		go func(username string) {
+			defer wg.Done()
+			serve(http.MethodPost, username)
+		}(username)
+	}
+	<-started
+	<-started
+
+	if w := serve(http.MethodPost, "bryan"); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected the user limit to refuse with Retry-After, got %d", w.Code)
+	}
+	if w := serve(http.MethodPost, "auditor"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the global limit to refuse, got %d", w.Code)
+	}
+	if w := serve(http.MethodGet, "bryan"); w.Code != http.StatusOK {
+		t.Errorf("Expected reads to be unlimited, got %d", w.Code)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if w := serve(http.MethodPost, "bryan"); w.Code != http.StatusOK {
+		t.Errorf("Expected slots to be released, got %d", w.Code)
+	}
+}
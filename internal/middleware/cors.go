@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// PublicCORS lets browsers on the given origins read GET responses. It never allows
+// credentials, so it is only safe on unauthenticated endpoints.
+func PublicCORS(allowedOrigins []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var origin string = r.Header.Get("Origin")
+
+			for _, allowed := range allowedOrigins {
+				if allowed == "*" {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+					break
+				}
+				if origin != "" && allowed == origin {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Add("Vary", "Origin")
+					break
+				}
+			}
+
+			if r.Method == http.MethodOptions {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// Database attaches database to every request, so tools.OpenDatabase returns the same
+// instance in each handler instead of opening a new connection per request
+func Database(database tools.DatabaseInterface) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(tools.WithDatabase(r.Context(), database)))
+		})
+	}
+}
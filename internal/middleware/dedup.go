@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	log "github.com/sirupsen/logrus"
+)
+
+// Bodies larger than this aren't hashed, the request goes through undeduplicated
+const maxDedupBody = 64 << 10
+
+// How much of a response is kept to find the TransactionID in
+const maxDedupResponse = 16 << 10
+
+// dedupEntry is one request seen within the window. done closes when it finishes,
+// succeeded entries stay until the window passes and failed ones are removed.
+type dedupEntry struct {
+	done          chan struct{}
+	succeeded     bool
+	at            time.Time
+	transactionID string
+}
+
+// Deduplicator refuses a mutation identical to one that succeeded within the window,
+// for clients that retry without idempotency keys. Requests are identical when the
+// user, method, path, query and body all match.
+type Deduplicator struct {
+	window time.Duration
+	paths  map[string]bool
+
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+}
+
+// NewDeduplicator deduplicates mutations of paths within window, 0 turns it off
+func NewDeduplicator(window time.Duration, paths ...string) *Deduplicator {
+	var d = &Deduplicator{window: window, paths: map[string]bool{}, entries: map[string]*dedupEntry{}}
+	for _, path := range paths {
+		d.paths[path] = true
+	}
+	return d
+}
+
+// dedupKey hashes what makes two requests the same. Co-owners of a joint account are
+// told apart, and the query is re-encoded so parameter order doesn't matter.
+func dedupKey(r *http.Request, body []byte) string {
+	principal, _ := auth.From(r.Context())
+	var hash = sha256.New()
+	for _, part := range []string{principal.Username, principal.Actor(), r.Method, r.URL.Path, r.URL.Query().Encode()} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// dedupRecorder passes the response through, keeping its status and the start of its
+// body
+type dedupRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *dedupRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *dedupRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if remaining := maxDedupResponse - r.body.Len(); remaining > 0 {
+		r.body.Write(data[:min(len(data), remaining)])
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// transactionID reads TransactionID from a JSON response, empty when there is none
+func (r *dedupRecorder) transactionID() string {
+	var response struct{ TransactionID string }
+	json.Unmarshal(r.body.Bytes(), &response)
+	return response.TransactionID
+}
+
+// claim returns the entry an identical request holds, or adds one for this request
+// and returns nil. Expired entries are dropped on the way.
+func (d *Deduplicator) claim(key string, now time.Time) *dedupEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for other, entry := range d.entries {
+		if entry.succeeded && now.Sub(entry.at) >= d.window {
+			delete(d.entries, other)
+		}
+	}
+
+	if entry, ok := d.entries[key]; ok {
+		return entry
+	}
+	d.entries[key] = &dedupEntry{done: make(chan struct{}), at: now}
+	return nil
+}
+
+// finish keeps the entry for the window when the request succeeded, otherwise an
+// identical request may try again
+func (d *Deduplicator) finish(key string, succeeded bool, transactionID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var entry *dedupEntry = d.entries[key]
+	if succeeded {
+		entry.succeeded = true
+		entry.at = time.Now()
+		entry.transactionID = transactionID
+	} else {
+		delete(d.entries, key)
+	}
+	close(entry.done)
+}
+
+// Middleware must run after Authorization. An identical request still running is
+// waited for, then refused if it succeeded.
+func (d *Deduplicator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.window <= 0 || !isMutation(r.Method) || !d.paths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxDedupBody+1))
+		if err != nil {
+			api.RequestErrorHandler(w, fmt.Errorf("failed to read request body: %w", err))
+			return
+		}
+		if len(body) > maxDedupBody {
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var key string = dedupKey(r, body)
+		for {
+			var original *dedupEntry = d.claim(key, time.Now())
+			if original == nil {
+				break
+			}
+
+			select {
+			case <-original.done:
+			case <-r.Context().Done():
+				return
+			}
+			d.mu.Lock()
+			var succeeded, at, transactionID = original.succeeded, original.at, original.transactionID
+			d.mu.Unlock()
+			if succeeded && time.Since(at) < d.window {
+				d.refuseDuplicate(w, r, at, transactionID)
+				return
+			}
+		}
+
+		// A panicking handler counts as failed, so identical requests aren't stuck waiting
+		var recorder = &dedupRecorder{ResponseWriter: w}
+		var succeeded bool
+		defer func() {
+			var transactionID string
+			if succeeded {
+				transactionID = recorder.transactionID()
+			}
+			d.finish(key, succeeded, transactionID)
+		}()
+		next.ServeHTTP(recorder, r)
+		succeeded = recorder.status >= 200 && recorder.status < 300
+	})
+}
+
+// refuseDuplicate answers 409, with Location pointing at the original's ledger entry
+// when its response named one. Retry-After is when the window passes.
+func (d *Deduplicator) refuseDuplicate(w http.ResponseWriter, r *http.Request, at time.Time, transactionID string) {
+	var ago time.Duration = time.Since(at).Round(time.Millisecond)
+	log.Warn("Refusing a duplicate ", r.Method, " ", r.URL.Path, " from ", auth.UserFrom(r.Context()), ", the original succeeded ", ago, " ago")
+
+	var message = fmt.Sprintf("an identical request succeeded %s ago, change it or wait before sending it again", ago)
+	if transactionID != "" {
+		w.Header().Set("Location", "/transaction/"+transactionID)
+		message = fmt.Sprintf("an identical request succeeded %s ago as transaction %s, change it or wait before sending it again", ago, transactionID)
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int((d.window-time.Since(at)).Seconds())+1))
+	api.ConflictErrorHandler(w, errors.New(message))
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/auth"
+)
+
+func TestDeduplicator(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	var status = http.StatusOK
+	var release = make(chan struct{})
+	close(release)
+
+	dedup := NewDeduplicator(time.Minute, "/account/coins/transfer")
+	handler := dedup.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		mu.Lock()
+		calls++
+		var id, code = fmt.Sprintf("tx%d", calls), status
+		mu.Unlock()
+		w.WriteHeader(code)
+		fmt.Fprintf(w, `{"Code":%d,"TransactionID":%q}`, code, id)
+	}))
+
+	var serve = func(username string, target string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		r = r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{Username: username}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("Refuses_An_Identical_Request", func(t *testing.T) {
+		if w := serve("aaron", "/account/coins/transfer?to=bryan&amount=5", "{}"); w.Code != http.StatusOK {
+			t.Fatalf("Expected the first transfer through, got %d", w.Code)
+		}
+
+		// The same parameters in another order are the same request
+		w := serve("aaron", "/account/coins/transfer?amount=5&to=bryan", "{}")
+		if w.Code != http.StatusConflict || w.Header().Get("Location") != "/transaction/tx1" || !strings.Contains(w.Body.String(), "tx1") {
+			t.Errorf("Expected 409 pointing at tx1, got %d %v %s", w.Code, w.Header(), w.Body.String())
+		}
+
+		for _, w := range []*httptest.ResponseRecorder{
+			serve("bryan", "/account/coins/transfer?to=bryan&amount=5", "{}"),
+			serve("aaron", "/account/coins/transfer?to=bryan&amount=6", "{}"),
+			serve("aaron", "/account/coins/transfer?to=bryan&amount=5", `{"note":1}`),
+			serve("aaron", "/account/coins/add?amount=5", "{}"),
+		} {
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected a different request through, got %d", w.Code)
+			}
+		}
+	})
+
+	t.Run("Failures_Can_Be_Retried", func(t *testing.T) {
+		status = http.StatusServiceUnavailable
+		serve("carol", "/account/coins/transfer?to=bryan&amount=5", "")
+		status = http.StatusOK
+
+		if w := serve("carol", "/account/coins/transfer?to=bryan&amount=5", ""); w.Code != http.StatusOK {
+			t.Errorf("Expected the retry after a failure through, got %d", w.Code)
+		}
+	})
+
+	t.Run("Waits_For_The_Original", func(t *testing.T) {
+		release = make(chan struct{})
+		var codes = make(chan int, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				codes <- serve("dana", "/account/coins/transfer?to=bryan&amount=5", "").Code
+			}()
+		}
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+
+		var first, second = <-codes, <-codes
+		if first+second != http.StatusOK+http.StatusConflict {
+			t.Errorf("Expected one transfer and one 409, got %d and %d", first, second)
+		}
+	})
+
+	t.Run("Off_Without_A_Window", func(t *testing.T) {
+		handler := NewDeduplicator(0, "/account/coins/transfer").Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		for i := 0; i < 2; i++ {
+			r := httptest.NewRequest(http.MethodPost, "/account/coins/transfer?amount=1", nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected nothing refused, got %d", w.Code)
+			}
+		}
+	})
+}
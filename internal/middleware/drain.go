@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ShutdownReport summarizes what happened to in-flight requests during graceful shutdown
+type ShutdownReport struct {
+	InFlightAtShutdown int64
+	Drained            int64
+	Aborted            int64
+
+	// Mutating requests cut off by the deadline. Storage applies each mutation
+	// atomically, so these either fully committed or never happened.
+	MutationsInterrupted int64
+
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// DrainTracker counts in-flight requests so shutdown can report how many were drained
+type DrainTracker struct {
+	mu                sync.Mutex
+	inFlight          int64
+	inFlightMutations int64
+	shuttingDown      bool
+	inFlightAtStart   int64
+	drained           int64
+	startedAt         time.Time
+}
+
+func NewDrainTracker() *DrainTracker {
+	return &DrainTracker{}
+}
+
+func isMutation(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
+
+func (t *DrainTracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var mutation bool = isMutation(r.Method)
+
+		t.mu.Lock()
+		t.inFlight++
+		if mutation {
+			t.inFlightMutations++
+		}
+		t.mu.Unlock()
+
+		defer func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			t.inFlight--
+			if mutation {
+				t.inFlightMutations--
+			}
+			if t.shuttingDown {
+				t.drained++
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// InFlightMutations returns how many mutating requests are being served right now
+func (t *DrainTracker) InFlightMutations() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.inFlightMutations
+}
+
+// BeginShutdown marks the start of draining, requests finishing after this count as drained
+func (t *DrainTracker) BeginShutdown() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.shuttingDown = true
+	t.inFlightAtStart = t.inFlight
+	t.startedAt = time.Now()
+}
+
+// Report is called once the server has stopped or the drain deadline passed;
+// anything still in flight then was aborted
+func (t *DrainTracker) Report() ShutdownReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return ShutdownReport{
+		InFlightAtShutdown:   t.inFlightAtStart,
+		Drained:              t.drained,
+		Aborted:              t.inFlight,
+		MutationsInterrupted: t.inFlightMutations,
+		StartedAt:            t.startedAt,
+		Duration:             time.Since(t.startedAt),
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestDrainTracker(t *testing.T) {
+	tracker := NewDrainTracker()
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handler := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	var wg sync.WaitGroup
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		wg.Add(1)
+		go func(method string) {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/", nil))
+		}(method)
+	}
+	<-started
+	<-started
+
+	tracker.BeginShutdown()
+
+	// Deadline passes with both requests still running
+	report := tracker.Report()
+	if report.InFlightAtShutdown != 2 || report.Aborted != 2 || report.MutationsInterrupted != 1 {
+		t.Errorf("Unexpected report before draining: %+v", report)
+	}
+
+	close(release)
+	wg.Wait()
+
+	report = tracker.Report()
+	if report.Drained != 2 || report.Aborted != 0 || report.MutationsInterrupted != 0 {
+		t.Errorf("Unexpected report after draining: %+v", report)
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/bryantjandra/goapi/internal/features"
+	chimiddle "github.com/go-chi/chi/middleware"
+)
+
+// Experiments assigns each request to a bucket per running experiment, by username hash
+// or the X-Experiment-Bucket override header. Handlers read the buckets with
+// features.FromContext, the response lists them in X-Experiment-Buckets.
+func Experiments(experiments []features.Experiment) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(experiments) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var assignments = features.Assign(experiments, r.URL.Query().Get("username"), r.Header.Get(features.OverrideHeader))
+			w.Header().Set("X-Experiment-Buckets", assignments.String())
+
+			var wrapped = chimiddle.NewWrapResponseWriter(w, r.ProtoMajor)
+			defer func() {
+				var status int = wrapped.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				features.RecordRequest(assignments, status)
+			}()
+
+			next.ServeHTTP(wrapped, r.WithContext(features.WithAssignments(r.Context(), assignments)))
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/oidc"
+	"github.com/bryantjandra/goapi/internal/tokens"
+)
+
+// LoginPath is where the jwt auth mode exchanges static tokens for access tokens
+const LoginPath = "/login"
+
+var AccessTokenRequiredError = errors.New("Exchange your token for an access token at " + LoginPath + " and send it as a bearer token")
+
+// TokenIssuer returns the issuer of the jwt auth mode's access tokens
+func TokenIssuer(cfg config.Config) (*tokens.Issuer, error) {
+	return tokens.For(tokens.Settings{
+		Algorithm:      cfg.JWTAlgorithm,
+		Secret:         cfg.JWTSecret,
+		PrivateKeyFile: cfg.JWTPrivateKeyFile,
+		TTL:            cfg.JWTTTL,
+		RefreshTTL:     cfg.JWTRefreshTTL,
+	})
+}
+
+// verifyBearer checks a bearer token with the identity provider, or against our own
+// key in the jwt auth mode, where it carries nothing but the username
+func verifyBearer(ctx context.Context, cfg config.Config, token string) (oidc.Identity, error) {
+	if cfg.AuthMode == config.AuthModeOIDC {
+		return oidcProvider(cfg).Verify(ctx, token)
+	}
+
+	issuer, err := TokenIssuer(cfg)
+	if err != nil {
+		return oidc.Identity{}, err
+	}
+	username, err := issuer.Verify(token)
+	return oidc.Identity{Username: username}, err
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/config"
+)
+
+func TestJWTAuthorization(t *testing.T) {
+	var original config.Config = config.Get()
+	var cfg config.Config = original
+	cfg.AuthMode = config.AuthModeJWT
+	cfg.JWTAlgorithm = "HS256"
+	cfg.JWTSecret = "0123456789abcdef0123456789abcdef"
+	cfg.JWTTTL = time.Minute
+	config.Set(cfg)
+	defer config.Set(original)
+
+	issuer, err := TokenIssuer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := issuer.Issue("aaron")
+	var bearer string = "Bearer " + token.Value
+
+	var seenUsername, seenAuthenticated string
+	var handler = Authorization(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenUsername = r.URL.Query().Get("username")
+		seenAuthenticated = auth.UserFrom(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	var cases = []struct {
+		name     string
+		method   string
+		target   string
+		token    string
+		expected int
+	}{
+		{"Access_Token", http.MethodGet, "/account/coins", bearer, http.StatusOK},
+		{"Access_Token_With_Matching_Username", http.MethodGet, "/account/coins?username=aaron", bearer, http.StatusOK},
+		{"Access_Token_For_Another_User", http.MethodGet, "/account/coins?username=bryan", bearer, http.StatusForbidden},
+		{"Tampered_Token", http.MethodGet, "/account/coins", bearer + "x", http.StatusBadRequest},
+		{"Static_Token_Outside_Login", http.MethodGet, "/account/coins?username=aaron", "1", http.StatusBadRequest},
+		{"Static_Token_At_Login", http.MethodPost, "/login?username=aaron", "1", http.StatusOK},
+		{"Access_Token_At_Login", http.MethodPost, "/login", bearer, http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			seenUsername, seenAuthenticated = "", ""
+			req := httptest.NewRequest(c.method, c.target, nil)
+			req.Header.Set("Authorization", c.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != c.expected {
+				t.Fatalf("Expected %d, got %d: %s", c.expected, w.Code, w.Body.String())
+			}
+			if c.expected == http.StatusOK && (seenUsername != "aaron" || seenAuthenticated != "aaron") {
+				t.Errorf("Expected the handler to see aaron, got %q and %q", seenUsername, seenAuthenticated)
+			}
+		})
+	}
+}
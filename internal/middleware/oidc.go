@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/oidc"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+var WrongUserError = errors.New("Token was issued for a different user")
+
+func oidcProvider(cfg config.Config) *oidc.Provider {
+	return oidc.For(oidc.Settings{
+		Issuer:        cfg.OIDCIssuer,
+		Audience:      cfg.OIDCAudience,
+		JWKSURL:       cfg.OIDCJWKSURL,
+		UsernameClaim: cfg.OIDCUsernameClaim,
+	})
+}
+
+// requiredScope is the token scope a request needs, by route and method
+func requiredScope(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/admin"):
+		return oidc.ScopeAdmin
+	case strings.HasPrefix(r.URL.Path, "/audit"):
+		return oidc.ScopeAudit
+	case isMutation(r.Method):
+		return oidc.ScopeWrite
+	}
+	return oidc.ScopeRead
+}
+
+// withUsername points the username parameter at the token's user, handlers read it from there
+func withUsername(r *http.Request, username string) {
+	query := r.URL.Query()
+	query.Set("username", username)
+	r.URL.RawQuery = query.Encode()
+}
+
+// provision creates an empty account for a user the identity provider vouched for.
+// The account has no token of its own, so it can only sign in through the provider.
+func provision(database tools.DatabaseInterface, username string) *tools.LoginDetails {
+	var login = tools.LoginDetails{Username: username, Role: tools.RoleUser}
+	_, err := database.CreateUser(login)
+	if err != nil && !errors.Is(err, tools.ErrUserExists) {
+		log.Error("Failed to provision account for ", username, ": ", err)
+		return nil
+	}
+	if err == nil {
+		log.Info("Provisioned account for identity provider user ", username)
+		events.Record(database, events.AccountCreated, username, map[string]interface{}{
+			"provisioned_by": "oidc",
+		})
+	}
+	return database.GetUserLoginDetails(username)
+}
+
+// missingScope is the error for a token without scope
+func missingScope(scope string) error {
+	return fmt.Errorf("%w: %s", oidc.ErrMissingScope, scope)
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestOIDCAuthorization(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "k", "kty": "RSA",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+
+	var original config.Config = config.Get()
+	var cfg config.Config = original
+	cfg.AuthMode = config.AuthModeOIDC
+	cfg.OIDCIssuer = "https://idp.example.com"
+	cfg.OIDCAudience = "goapi"
+	cfg.OIDCJWKSURL = jwks.URL
+	cfg.OIDCUsernameClaim = "preferred_username"
+	cfg.OIDCAutoProvision = true
+	config.Set(cfg)
+	defer config.Set(original)
+
+	bearer := func(username string, scope string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss": cfg.OIDCIssuer, "aud": "goapi", "sub": "00u1", "preferred_username": username,
+			"scope": scope, "exp": time.Now().Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = "k"
+		signed, _ := token.SignedString(key)
+		return "Bearer " + signed
+	}
+
+	var seenUsername string
+	var handler = Authorization(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenUsername = r.URL.Query().Get("username")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	var cases = []struct {
+		name     string
+		method   string
+		target   string
+		token    string
+		expected int
+	}{
+		{"Provisions_New_User", http.MethodGet, "/account/coins", bearer("oidc_newcomer", "goapi:read"), http.StatusOK},
+		{"Read_Scope_Cannot_Write", http.MethodPost, "/account/coins/add?amount=5", bearer("oidc_newcomer", "goapi:read"), http.StatusForbidden},
+		{"Write_Scope", http.MethodPost, "/account/coins/add?amount=5", bearer("oidc_newcomer", "goapi:write"), http.StatusOK},
+		{"Token_For_Another_User", http.MethodGet, "/account/coins?username=aaron", bearer("oidc_newcomer", "goapi:read"), http.StatusForbidden},
+		{"Static_Tokens_Disabled", http.MethodGet, "/account/coins?username=aaron", "1", http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			seenUsername = ""
+			req := httptest.NewRequest(c.method, c.target, nil)
+			req.Header.Set("Authorization", c.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != c.expected {
+				t.Fatalf("Expected %d, got %d: %s", c.expected, w.Code, w.Body.String())
+			}
+			if c.expected == http.StatusOK && seenUsername != "oidc_newcomer" {
+				t.Errorf("Expected the handler to see the token's username, got %q", seenUsername)
+			}
+		})
+	}
+
+	database, _ := tools.NewDatabase()
+	if login := (*database).GetUserLoginDetails("oidc_newcomer"); login == nil || login.AuthToken != "" || login.Role != tools.RoleUser {
+		t.Errorf("Expected a provisioned user without a token, got %+v", login)
+	}
+}
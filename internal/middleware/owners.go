@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/dormancy"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+	chimiddle "github.com/go-chi/chi/middleware"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	NotOwnerError      = errors.New("Not an owner of that account")
+	ViewOnlyOwnerError = errors.New("View-only owners can't make changes to the account")
+	JointAccountError  = errors.New("Joint accounts can only be used under /account")
+)
+
+// jointAccount turns principal, who authenticated as themselves, into a co-owner acting
+// on account. It writes the refusal and returns false if they may not.
+func jointAccount(w http.ResponseWriter, r *http.Request, database tools.DatabaseInterface, principal auth.Principal, account string) (auth.Principal, bool) {
+	if !strings.HasPrefix(r.URL.Path, "/account/") || principal.Role != tools.RoleUser {
+		log.Error("Joint account refused for ", principal.Username, " at ", r.URL.Path)
+		api.RequestErrorHandler(w, JointAccountError)
+		return principal, false
+	}
+
+	owners, err := database.GetAccountOwners(account)
+	if err != nil {
+		log.Error("Failed to read owners of ", account, ": ", err)
+		api.InternalErrorHandler(w)
+		return principal, false
+	}
+
+	for _, owner := range owners {
+		if owner.Owner != principal.Username {
+			continue
+		}
+		if owner.Permission != tools.OwnerTransact && isMutation(r.Method) {
+			log.Error("Mutation refused for view-only owner ", owner.Owner, " of ", account, ": ", r.Method, " ", r.URL.Path)
+			api.ForbiddenErrorHandler(w, ViewOnlyOwnerError)
+			return principal, false
+		}
+
+		dormancy.RecordActivity(account, time.Now())
+		return auth.Principal{Username: account, Role: principal.Role, Owner: owner.Owner, Permission: owner.Permission}, true
+	}
+
+	log.Error("Joint account refused, ", principal.Username, " is not an owner of ", account)
+	api.ForbiddenErrorHandler(w, NotOwnerError)
+	return principal, false
+}
+
+// recordOwnerOperation serves a co-owner's change and records it against the account,
+// so its history shows which owner made it. Refused requests change nothing and aren't
+// recorded.
+func recordOwnerOperation(next http.Handler, w http.ResponseWriter, r *http.Request, principal auth.Principal) {
+	var wrapped = chimiddle.NewWrapResponseWriter(w, r.ProtoMajor)
+	next.ServeHTTP(wrapped, r)
+
+	// Nothing written means the handler returned an empty 200
+	var status int = wrapped.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status >= http.StatusBadRequest {
+		return
+	}
+
+	events.Record(tools.AttachedDatabase(r.Context()), events.OwnerOperation, principal.Username, map[string]interface{}{
+		"owner":  principal.Owner,
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"status": status,
+	})
+	log.WithFields(log.Fields{
+		"account": principal.Username,
+		"owner":   principal.Owner,
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"status":  status,
+	}).Info("Joint account changed by co-owner")
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/lockout"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+func TestJointAccounts(t *testing.T) {
+	logins, coins := tools.DemoAccounts()
+	logins["carol"] = tools.LoginDetails{AuthToken: "3", Username: "carol", Role: tools.RoleUser}
+	database, err := tools.NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	for _, owner := range []tools.AccountOwner{
+		{Account: "aaron", Owner: "bryan", Permission: tools.OwnerTransact, AddedAt: time.Now()},
+		{Account: "aaron", Owner: "carol", Permission: tools.OwnerView, AddedAt: time.Now()},
+	} {
+		if err := (*database).SetAccountOwner(owner); err != nil {
+			t.Fatalf("Failed to set owner: %v", err)
+		}
+	}
+
+	defer lockout.RecordSuccess(*database, lockout.Username("bryan"))
+
+	var seen auth.Principal
+	var handler = Authorization(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = auth.From(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(method string, path string, caller string, token string, account string) int {
+		seen = auth.Principal{}
+		req := httptest.NewRequest(method, path+"?username="+caller, nil)
+		req = req.WithContext(tools.WithDatabase(req.Context(), *database))
+		req.Header.Set("Authorization", token)
+		req.Header.Set(auth.AccountHeader, account)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("Transacting_Owner_Acts_On_The_Account", func(t *testing.T) {
+		if code := serve(http.MethodPost, "/account/coins/add", "bryan", "2", "aaron"); code != http.StatusOK {
+			t.Fatalf("Expected bryan through, got %d", code)
+		}
+		if seen.Username != "aaron" || seen.Owner != "bryan" || seen.Actor() != "bryan" {
+			t.Errorf("Expected bryan acting on aaron, got %+v", seen)
+		}
+
+		recorded, ok := events.First(*database, events.OwnerOperation, "aaron")
+		if !ok || recorded.Data["owner"] != "bryan" || recorded.Data["path"] != "/account/coins/add" {
+			t.Errorf("Expected the change recorded against aaron with bryan as owner, got %+v", recorded)
+		}
+	})
+
+	t.Run("View_Only_Owner_Can_Only_Read", func(t *testing.T) {
+		if code := serve(http.MethodGet, "/account/coins", "carol", "3", "aaron"); code != http.StatusOK || seen.Username != "aaron" {
+			t.Errorf("Expected carol to read aaron's balance, got %d %+v", code, seen)
+		}
+		if code := serve(http.MethodPost, "/account/coins/withdraw", "carol", "3", "aaron"); code != http.StatusForbidden {
+			t.Errorf("Expected carol's withdrawal refused, got %d", code)
+		}
+	})
+
+	t.Run("Strangers_And_Other_Routes_Are_Refused", func(t *testing.T) {
+		if code := serve(http.MethodGet, "/account/coins", "aaron", "1", "bryan"); code != http.StatusForbidden {
+			t.Errorf("Expected aaron refused on bryan's account, got %d", code)
+		}
+		if code := serve(http.MethodGet, "/audit/transactions", "bryan", "2", "aaron"); code != http.StatusBadRequest {
+			t.Errorf("Expected joint accounts refused outside /account, got %d", code)
+		}
+		if code := serve(http.MethodGet, "/account/coins", "bryan", "1", "aaron"); code != http.StatusBadRequest {
+			t.Errorf("Expected bryan's own credentials required, got %d", code)
+		}
+	})
+
+	t.Run("Holder_Is_Unaffected", func(t *testing.T) {
+		if code := serve(http.MethodGet, "/account/coins", "aaron", "1", "aaron"); code != http.StatusOK || !seen.Holder() {
+			t.Errorf("Expected aaron as holder, got %d %+v", code, seen)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// PostOnly guards mutation endpoints that older clients called with GET, which proxies
+// may prefetch or cache. GET on one of paths is refused with 405 and a hint to use POST.
+// During the migration grace period (allowGet) it is served as a POST instead, so auth
+// and everything after it treats it as a mutation, with Deprecation and Warning headers.
+func PostOnly(allowGet bool, paths ...string) func(http.Handler) http.Handler {
+	var guarded = map[string]bool{}
+	for _, path := range paths {
+		guarded[path] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || !guarded[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !allowGet {
+				w.Header().Set("Allow", http.MethodPost)
+				api.MethodNotAllowedErrorHandler(w, fmt.Errorf("%s changes balances and only accepts POST with the same query parameters", r.URL.Path))
+				return
+			}
+
+			log.Warn("Deprecated GET mutation served as POST: ", r.URL.Path)
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Warning", `299 - "GET is deprecated for this endpoint, use POST"`)
+
+			var post *http.Request = r.Clone(r.Context())
+			post.Method = http.MethodPost
+			next.ServeHTTP(w, post)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostOnly(t *testing.T) {
+	var seen string
+	var next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Method
+		w.WriteHeader(http.StatusOK)
+	})
+
+	var cases = []struct {
+		name     string
+		allowGet bool
+		method   string
+		path     string
+		expected int
+		seen     string
+	}{
+		{"Get_Refused", false, http.MethodGet, "/account/coins/add", http.StatusMethodNotAllowed, ""},
+		{"Post_Passes", false, http.MethodPost, "/account/coins/add", http.StatusOK, http.MethodPost},
+		{"Other_Get_Passes", false, http.MethodGet, "/account/coins", http.StatusOK, http.MethodGet},
+		{"Grace_Period_Serves_As_Post", true, http.MethodGet, "/account/coins/add", http.StatusOK, http.MethodPost},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			seen = ""
+			w := httptest.NewRecorder()
+			PostOnly(c.allowGet, "/account/coins/add")(next).ServeHTTP(w, httptest.NewRequest(c.method, c.path+"?username=aaron", nil))
+
+			if w.Code != c.expected {
+				t.Errorf("Expected %d, got %d", c.expected, w.Code)
+			}
+			if seen != c.seen {
+				t.Errorf("Expected the handler to see %q, got %q", c.seen, seen)
+			}
+			if c.expected == http.StatusMethodNotAllowed && w.Header().Get("Allow") != http.MethodPost {
+				t.Errorf("Expected Allow: POST, got %q", w.Header().Get("Allow"))
+			}
+			if c.allowGet && w.Header().Get("Deprecation") != "true" {
+				t.Errorf("Expected a Deprecation header in the grace period")
+			}
+		})
+	}
+}
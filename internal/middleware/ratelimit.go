@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+var TooManyRequestsError = errors.New("Too many requests, slow down")
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// rateLimiter is the state of one RateLimitByIP, kept by scope so admins can
+// inspect and clear it
+type rateLimiter struct {
+	limit   int
+	period  time.Duration
+	windows map[string]*window
+}
+
+// Limiters by scope for the databases they served, the process keeps one registry and
+// each isolated in-memory database its own, see tools.ScopeOf
+type rateLimiters map[string]*rateLimiter
+
+var (
+	rateLimitMu sync.Mutex
+	rateLimits  = tools.NewScoped(func() *rateLimiters { return &rateLimiters{} })
+)
+
+// RateLimitBucket is one client's window on one rate limited scope
+type RateLimitBucket struct {
+	Scope   string
+	IP      string
+	Count   int
+	Limit   int
+	ResetAt time.Time
+}
+
+// RateLimitByIP allows limit requests per client IP in each fixed window. Every
+// response carries RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset (seconds
+// until the window resets) so clients can pace themselves before hitting a 429.
+// scope names the limiter for RateLimitBuckets and ClearRateLimit, which see it once it
+// served a request for their database.
+func RateLimitByIP(scope string, limit int, period time.Duration) func(http.Handler) http.Handler {
+	var limiter = &rateLimiter{limit: limit, period: period, windows: map[string]*window{}}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := ClientIP(r)
+			now := time.Now()
+
+			rateLimitMu.Lock()
+			(*rateLimits.For(tools.AttachedDatabase(r.Context())))[scope] = limiter
+			current, ok := limiter.windows[host]
+			if !ok || now.Sub(current.start) >= period {
+				current = &window{start: now}
+				limiter.windows[host] = current
+
+				// Forget idle clients so the map doesn't grow forever
+				for key, other := range limiter.windows {
+					if now.Sub(other.start) >= period {
+						delete(limiter.windows, key)
+					}
+				}
+			}
+			current.count++
+			allowed := current.count <= limit
+			remaining := limit - current.count
+			reset := period - now.Sub(current.start)
+			rateLimitMu.Unlock()
+
+			if remaining < 0 {
+				remaining = 0
+			}
+			resetSeconds := strconv.Itoa(int(reset.Seconds()) + 1)
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("RateLimit-Reset", resetSeconds)
+
+			if !allowed {
+				log.Warn("Rate limit exceeded for ", host, " on ", r.URL.Path)
+				w.Header().Set("Retry-After", resetSeconds)
+				api.TooManyRequestsErrorHandler(w, TooManyRequestsError)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimitBuckets lists the open windows of ip on database's limiters, or of every
+// client when ip is empty
+func RateLimitBuckets(database tools.DatabaseInterface, ip string) []RateLimitBucket {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+
+	var now = time.Now()
+	var buckets = []RateLimitBucket{}
+	for scope, limiter := range *rateLimits.For(database) {
+		for host, current := range limiter.windows {
+			if (ip != "" && host != ip) || now.Sub(current.start) >= limiter.period {
+				continue
+			}
+			buckets = append(buckets, RateLimitBucket{
+				Scope:   scope,
+				IP:      host,
+				Count:   current.count,
+				Limit:   limiter.limit,
+				ResetAt: current.start.Add(limiter.period),
+			})
+		}
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Scope != buckets[j].Scope {
+			return buckets[i].Scope < buckets[j].Scope
+		}
+		return buckets[i].IP < buckets[j].IP
+	})
+	return buckets
+}
+
+// ClearRateLimit resets ip's windows on database's limiter for scope, or on every scope
+// when scope is empty, and returns how many were cleared
+func ClearRateLimit(database tools.DatabaseInterface, scope string, ip string, by string) int {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+
+	var cleared int
+	for name, limiter := range *rateLimits.For(database) {
+		if scope != "" && name != scope {
+			continue
+		}
+		if _, ok := limiter.windows[ip]; ok {
+			delete(limiter.windows, ip)
+			cleared++
+		}
+	}
+
+	if cleared > 0 {
+		log.WithFields(log.Fields{"scope": scope, "ip": ip, "by": by}).Info("Rate limit cleared")
+	}
+	return cleared
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	handler := RateLimitByIP("test", 2, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	expected := []struct {
+		code      int
+		remaining string
+	}{
+		{http.StatusOK, "1"},
+		{http.StatusOK, "0"},
+		{http.StatusTooManyRequests, "0"},
+	}
+
+	for i, e := range expected {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/status", nil)
+		request.RemoteAddr = "10.0.0.1:5000"
+
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != e.code {
+			t.Errorf("Request %d: expected status %d, got %d", i+1, e.code, recorder.Code)
+		}
+		if recorder.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("Request %d: expected RateLimit-Limit 2, got %q", i+1, recorder.Header().Get("RateLimit-Limit"))
+		}
+		if recorder.Header().Get("RateLimit-Remaining") != e.remaining {
+			t.Errorf("Request %d: expected RateLimit-Remaining %s, got %q", i+1, e.remaining, recorder.Header().Get("RateLimit-Remaining"))
+		}
+		if recorder.Header().Get("RateLimit-Reset") == "" {
+			t.Errorf("Request %d: missing RateLimit-Reset", i+1)
+		}
+	}
+}
+
+func TestClearRateLimit(t *testing.T) {
+	handler := RateLimitByIP("clear-test", 1, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var serve = func(ip string) int {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/status", nil)
+		request.RemoteAddr = ip + ":5000"
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	serve("10.0.0.2")
+	serve("10.0.0.3")
+	if code := serve("10.0.0.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the second request to be limited, got %d", code)
+	}
+
+	buckets := RateLimitBuckets(nil, "10.0.0.2")
+	if len(buckets) != 1 || buckets[0].Scope != "clear-test" || buckets[0].Count != 2 || buckets[0].Limit != 1 {
+		t.Errorf("Unexpected buckets: %+v", buckets)
+	}
+	if other := RateLimitBuckets(toolstest.New(t, nil), "10.0.0.2"); len(other) != 0 {
+		t.Errorf("Expected another database's limiters to be empty, got %+v", other)
+	}
+
+	if cleared := ClearRateLimit(nil, "clear-test", "10.0.0.2", "admin"); cleared != 1 {
+		t.Errorf("Expected one window cleared, got %d", cleared)
+	}
+	if code := serve("10.0.0.2"); code != http.StatusOK {
+		t.Errorf("Expected the client to be let back in, got %d", code)
+	}
+
+	// Other clients keep their windows
+	if code := serve("10.0.0.3"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the other client to stay limited, got %d", code)
+	}
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Position in the request pipeline where custom middleware runs. Positions always
+// execute in this order:
+//
+//	global (StripSlashes) -> BeforeAuth -> Authorization [-> RequireAdmin] -> AfterAuth -> BeforeHandler -> handler
+//
+// BeforeAuth and BeforeHandler wrap every route, including public ones. AfterAuth
+// only wraps authenticated routes. Within a position middleware runs in registration order.
+type Position int
+
+const (
+	BeforeAuth Position = iota
+	AfterAuth
+	BeforeHandler
+)
+
+func (p Position) String() string {
+	switch p {
+	case BeforeAuth:
+		return "before-auth"
+	case AfterAuth:
+		return "after-auth"
+	case BeforeHandler:
+		return "before-handler"
+	}
+	return fmt.Sprintf("position(%d)", int(p))
+}
+
+var (
+	ErrRegistryFrozen  = errors.New("middleware registry is frozen, register before building the router")
+	ErrUnknownPosition = errors.New("unknown middleware position")
+	ErrDuplicateName   = errors.New("middleware name already registered")
+)
+
+type namedMiddleware struct {
+	name       string
+	middleware func(http.Handler) http.Handler
+}
+
+// Registry holds custom middleware by position so embedders can extend the
+// pipeline without editing handlers.Handler
+type Registry struct {
+	mu      sync.Mutex
+	entries map[Position][]namedMiddleware
+	frozen  bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{entries: map[Position][]namedMiddleware{}}
+}
+
+// DefaultRegistry is the registry handlers.Handler builds the router from
+var DefaultRegistry = NewRegistry()
+
+// Register adds middleware at a position. Names must be unique across positions.
+func (r *Registry) Register(position Position, name string, middleware func(http.Handler) http.Handler) error {
+	if position < BeforeAuth || position > BeforeHandler {
+		return fmt.Errorf("%w: %s", ErrUnknownPosition, position)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.frozen {
+		return ErrRegistryFrozen
+	}
+
+	for _, entries := range r.entries {
+		for _, entry := range entries {
+			if entry.name == name {
+				return fmt.Errorf("%w: %s", ErrDuplicateName, name)
+			}
+		}
+	}
+
+	r.entries[position] = append(r.entries[position], namedMiddleware{name: name, middleware: middleware})
+	return nil
+}
+
+// Chain returns the middleware registered at a position in registration order
+func (r *Registry) Chain(position Position) []func(http.Handler) http.Handler {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var chain []func(http.Handler) http.Handler
+	for _, entry := range r.entries[position] {
+		chain = append(chain, entry.middleware)
+	}
+	return chain
+}
+
+// Names lists registered middleware as "position/name" in execution order, for startup logs
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var names []string
+	for position := BeforeAuth; position <= BeforeHandler; position++ {
+		for _, entry := range r.entries[position] {
+			names = append(names, position.String()+"/"+entry.name)
+		}
+	}
+	return names
+}
+
+// Freeze stops further registration. Middleware added after the router is built
+// would silently never run, so that is an error instead.
+func (r *Registry) Freeze() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.frozen = true
+}
+
+// Register adds middleware to DefaultRegistry
+func Register(position Position, name string, middleware func(http.Handler) http.Handler) error {
+	return DefaultRegistry.Register(position, name, middleware)
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func recordingMiddleware(name string, order *[]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*order = append(*order, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestMiddlewareRegistry(t *testing.T) {
+	t.Run("Positions_Run_In_Order", func(t *testing.T) {
+		registry := NewRegistry()
+		var order []string
+
+		// Registered out of order on purpose
+		registry.Register(BeforeHandler, "handler-1", recordingMiddleware("handler-1", &order))
+		registry.Register(AfterAuth, "after-1", recordingMiddleware("after-1", &order))
+		registry.Register(BeforeAuth, "before-1", recordingMiddleware("before-1", &order))
+		registry.Register(BeforeAuth, "before-2", recordingMiddleware("before-2", &order))
+
+		var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		var chain []func(http.Handler) http.Handler
+		for position := BeforeAuth; position <= BeforeHandler; position++ {
+			chain = append(chain, registry.Chain(position)...)
+		}
+		for i := len(chain) - 1; i >= 0; i-- {
+			handler = chain[i](handler)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if strings.Join(order, ",") != "before-1,before-2,after-1,handler-1" {
+			t.Errorf("Unexpected execution order: %v", order)
+		}
+		if strings.Join(registry.Names(), ",") != "before-auth/before-1,before-auth/before-2,after-auth/after-1,before-handler/handler-1" {
+			t.Errorf("Unexpected names: %v", registry.Names())
+		}
+	})
+
+	t.Run("Registration_Rules_Enforced", func(t *testing.T) {
+		registry := NewRegistry()
+		noop := func(next http.Handler) http.Handler { return next }
+
+		if err := registry.Register(Position(42), "bad", noop); !errors.Is(err, ErrUnknownPosition) {
+			t.Errorf("Expected ErrUnknownPosition, got %v", err)
+		}
+
+		registry.Register(AfterAuth, "audit", noop)
+		if err := registry.Register(BeforeAuth, "audit", noop); !errors.Is(err, ErrDuplicateName) {
+			t.Errorf("Expected ErrDuplicateName, got %v", err)
+		}
+
+		registry.Freeze()
+		if err := registry.Register(BeforeAuth, "late", noop); !errors.Is(err, ErrRegistryFrozen) {
+			t.Errorf("Expected ErrRegistryFrozen, got %v", err)
+		}
+	})
+}
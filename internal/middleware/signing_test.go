@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/lockout"
+	"github.com/bryantjandra/goapi/internal/signing"
+)
+
+func TestSignedAuthorization(t *testing.T) {
+	var original config.Config = config.Get()
+	var cfg config.Config = original
+	cfg.SigningSecrets = map[string]string{"aaron": "shared-secret"}
+	config.Set(cfg)
+	defer config.Set(original)
+	defer lockout.RecordSuccess(nil, lockout.Username("aaron"))
+
+	var received string
+	var handler = Authorization(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	newRequest := func(secret string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/account/coins/add?username=aaron&amount=5", strings.NewReader(`{"note":"x"}`))
+		if err := signing.SignRequest(req, "aaron", secret); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	req := newRequest("shared-secret")
+	var header string = req.Header.Get("Authorization")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || received != `{"note":"x"}` {
+		t.Fatalf("Expected the signed request through with its body, got %d %q", w.Code, received)
+	}
+
+	// Same nonce again
+	replay := httptest.NewRequest(http.MethodPost, "/account/coins/add?username=aaron&amount=5", strings.NewReader(`{"note":"x"}`))
+	replay.Header.Set("Authorization", header)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, replay)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), signing.ErrReplayed.Error()) {
+		t.Errorf("Expected the replay refused, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Amount changed after signing
+	tampered := newRequest("shared-secret")
+	tampered.URL.RawQuery = "username=aaron&amount=500"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, tampered)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a tampered request refused, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest("wrong-secret"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the wrong secret refused, got %d", w.Code)
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+
+	"github.com/bryantjandra/goapi/api"
+)
+
+var SimulatedFailureError = errors.New("Simulated failure, retry the request")
+
+// SimulateFailures fails the given fraction of requests with 503 so sandbox clients
+// can exercise their retry handling. Failures carry X-Simulated-Failure: true.
+func SimulateFailures(rate float64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rate > 0 && rand.Float64() < rate {
+				w.Header().Set("X-Simulated-Failure", "true")
+				api.ServiceUnavailableErrorHandler(w, SimulatedFailureError)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
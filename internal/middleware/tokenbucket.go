@@ -0,0 +1,381 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// TokenBucket is what taking a token left behind
+type TokenBucket struct {
+	Allowed   bool
+	Remaining int
+
+	// How long until the bucket is full again
+	Reset time.Duration
+
+	// How long until a token is back, only set when refused
+	RetryAfter time.Duration
+}
+
+// BucketRequest asks for a token from key's bucket, which holds up to Limit tokens
+type BucketRequest struct {
+	Key   string
+	Limit int
+}
+
+// StoredBucket is one bucket as a store holds it
+type StoredBucket struct {
+	Key       string
+	Limit     int
+	Remaining int
+	FullAt    time.Time
+}
+
+// RateLimitStore keeps token buckets, each holding up to limit tokens and refilling
+// limit of them every period. Replicas sharing a store share their buckets.
+type RateLimitStore interface {
+	// TakeAll spends one token from every bucket requested, or none of them when any
+	// is empty, and returns what each bucket was left with. A new bucket starts full.
+	TakeAll(ctx context.Context, requests []BucketRequest, period time.Duration, now time.Time) ([]TokenBucket, error)
+
+	// Buckets lists the buckets that aren't full, keys starting with prefix only
+	Buckets(ctx context.Context, prefix string, now time.Time) ([]StoredBucket, error)
+
+	// Clear fills the buckets keys name back up and returns how many there were
+	Clear(ctx context.Context, keys []string) (int, error)
+}
+
+type bucket struct {
+	tokens  float64
+	limit   int
+	updated time.Time
+	period  time.Duration
+}
+
+// refill tops up tokens for the time since the last update
+func (b *bucket) refill(now time.Time) {
+	var rate float64 = float64(b.limit) / b.period.Seconds()
+	b.tokens = math.Min(float64(b.limit), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+}
+
+// until is how long refilling to tokens takes
+func (b *bucket) until(tokens float64) time.Duration {
+	var rate float64 = float64(b.limit) / b.period.Seconds()
+	return time.Duration(math.Max(0, tokens-b.tokens) / rate * float64(time.Second))
+}
+
+// MemoryRateLimitStore keeps buckets in this process
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*bucket{}}
+}
+
+// Take spends one token from key's bucket
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit int, period time.Duration, now time.Time) (TokenBucket, error) {
+	results, err := s.TakeAll(ctx, []BucketRequest{{Key: key, Limit: limit}}, period, now)
+	if err != nil {
+		return TokenBucket{}, err
+	}
+	return results[0], nil
+}
+
+func (s *MemoryRateLimitStore) TakeAll(ctx context.Context, requests []BucketRequest, period time.Duration, now time.Time) ([]TokenBucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Forget buckets that have refilled, a new one starts full anyway
+	if now.Sub(s.pruned) >= period {
+		for name, other := range s.buckets {
+			if now.Sub(other.updated) >= other.period {
+				delete(s.buckets, name)
+			}
+		}
+		s.pruned = now
+	}
+
+	var current = make([]*bucket, len(requests))
+	var allowed = true
+	for i, request := range requests {
+		found, ok := s.buckets[request.Key]
+		if !ok {
+			found = &bucket{tokens: float64(request.Limit), updated: now}
+			s.buckets[request.Key] = found
+		}
+		found.limit, found.period = request.Limit, period
+		found.refill(now)
+		current[i] = found
+		allowed = allowed && found.tokens >= 1
+	}
+
+	var results = make([]TokenBucket, len(requests))
+	for i, found := range current {
+		if allowed {
+			found.tokens--
+		} else if found.tokens < 1 {
+			results[i].RetryAfter = found.until(1)
+		}
+		results[i].Allowed = allowed
+		results[i].Remaining = int(found.tokens)
+		results[i].Reset = found.until(float64(found.limit))
+	}
+	return results, nil
+}
+
+func (s *MemoryRateLimitStore) Buckets(ctx context.Context, prefix string, now time.Time) ([]StoredBucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result = []StoredBucket{}
+	for key, found := range s.buckets {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		found.refill(now)
+		if found.tokens >= float64(found.limit) {
+			continue
+		}
+		result = append(result, StoredBucket{
+			Key:       key,
+			Limit:     found.limit,
+			Remaining: int(found.tokens),
+			FullAt:    now.Add(found.until(float64(found.limit))),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result, nil
+}
+
+func (s *MemoryRateLimitStore) Clear(ctx context.Context, keys []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var cleared int
+	for _, key := range keys {
+		if _, ok := s.buckets[key]; ok {
+			delete(s.buckets, key)
+			cleared++
+		}
+	}
+	return cleared, nil
+}
+
+// RequestLimiter gives each user and each client IP a token bucket. A route with its
+// own limit gets its own buckets, every other route shares the default ones.
+type RequestLimiter struct {
+	store   RateLimitStore
+	perUser int
+	perIP   int
+	routes  map[string]int
+	period  time.Duration
+
+	// Names the route a request is for, the keys of routes
+	route func(*http.Request) string
+}
+
+// The scope admins see token buckets under, RateLimitByIP's scopes are the others
+const RequestRateLimitScope = "requests"
+
+// servingLimiter is the newest limiter that served a request for a database, whose store
+// admins inspect and clear. The process keeps one and each isolated in-memory database
+// its own, see tools.ScopeOf.
+type servingLimiter struct {
+	limiter *RequestLimiter
+}
+
+var (
+	requestLimiterMu sync.Mutex
+	requestLimiters  = tools.NewScoped(func() *servingLimiter { return &servingLimiter{} })
+)
+
+// NewRequestLimiter allows perUser requests per user and perIP per client IP each
+// period, or routes[route] of each on a route listed there. 0 is unlimited.
+func NewRequestLimiter(store RateLimitStore, perUser int, perIP int, routes map[string]int, period time.Duration, route func(*http.Request) string) *RequestLimiter {
+	return &RequestLimiter{store: store, perUser: perUser, perIP: perIP, routes: routes, period: period, route: route}
+}
+
+// requestBucketKey names the bucket of one user or client IP on scope, the route or
+// default
+func requestBucketKey(kind string, scope string, who string) string {
+	return kind + ":" + scope + ":" + who
+}
+
+// RequestRateLimitBucket is one user's or client IP's token bucket that isn't full
+type RequestRateLimitBucket struct {
+	// default, or the route pattern with a limit of its own
+	Route     string
+	Account   string
+	IP        string
+	Limit     int
+	Remaining int
+	FullAt    time.Time
+}
+
+// currentRequestLimiter is the limiter serving the database attached to ctx
+func currentRequestLimiter(ctx context.Context) *RequestLimiter {
+	requestLimiterMu.Lock()
+	defer requestLimiterMu.Unlock()
+
+	return requestLimiters.For(tools.AttachedDatabase(ctx)).limiter
+}
+
+// serving records l as the limiter for the database r is served from
+func (l *RequestLimiter) serving(r *http.Request) {
+	requestLimiterMu.Lock()
+	defer requestLimiterMu.Unlock()
+
+	requestLimiters.For(tools.AttachedDatabase(r.Context())).limiter = l
+}
+
+// requestBuckets lists the buckets of account and ip, every one when both are empty
+func requestBuckets(ctx context.Context, store RateLimitStore, account string, ip string) ([]RequestRateLimitBucket, error) {
+	stored, err := store.Buckets(ctx, "", time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var result = []RequestRateLimitBucket{}
+	for _, found := range stored {
+		var parts = strings.SplitN(found.Key, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		var kind, who string = parts[0], parts[2]
+		switch {
+		case account == "" && ip == "":
+		case kind == "user" && who == account:
+		case kind == "ip" && who == ip:
+		default:
+			continue
+		}
+
+		var entry = RequestRateLimitBucket{Route: parts[1], Limit: found.Limit, Remaining: found.Remaining, FullAt: found.FullAt}
+		if kind == "user" {
+			entry.Account = who
+		} else {
+			entry.IP = who
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// RequestRateLimitBuckets lists the token buckets of account and ip that aren't full,
+// every one when both are empty, on the limiter serving the database attached to ctx
+func RequestRateLimitBuckets(ctx context.Context, account string, ip string) ([]RequestRateLimitBucket, error) {
+	var limiter *RequestLimiter = currentRequestLimiter(ctx)
+	if limiter == nil {
+		return []RequestRateLimitBucket{}, nil
+	}
+	return requestBuckets(ctx, limiter.store, account, ip)
+}
+
+// ClearRequestRateLimit fills account's and ip's token buckets back up on the limiter
+// serving the database attached to ctx, on route only when it isn't empty, and returns
+// how many were cleared
+func ClearRequestRateLimit(ctx context.Context, account string, ip string, route string, by string) (int, error) {
+	var limiter *RequestLimiter = currentRequestLimiter(ctx)
+	if limiter == nil || (account == "" && ip == "") {
+		return 0, nil
+	}
+
+	buckets, err := requestBuckets(ctx, limiter.store, account, ip)
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	for _, found := range buckets {
+		if route != "" && found.Route != route {
+			continue
+		}
+		if found.Account != "" {
+			keys = append(keys, requestBucketKey("user", found.Route, found.Account))
+		} else {
+			keys = append(keys, requestBucketKey("ip", found.Route, found.IP))
+		}
+	}
+
+	cleared, err := limiter.store.Clear(ctx, keys)
+	if err == nil && cleared > 0 {
+		log.WithFields(log.Fields{"account": account, "ip": ip, "route": route, "by": by}).Info("Request rate limit cleared")
+	}
+	return cleared, err
+}
+
+// Middleware must run after Authorization. Requests are let through if the store
+// fails, so rate limiting never takes the API down with it.
+func (l *RequestLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.serving(r)
+
+		var scope string = "default"
+		var perUser, perIP int = l.perUser, l.perIP
+		if route := l.route(r); route != "" {
+			if limit, ok := l.routes[route]; ok {
+				scope, perUser, perIP = route, limit, limit
+			}
+		}
+
+		// A token is only spent when every bucket has one, so a request the IP's bucket
+		// refuses costs the user nothing
+		var requests []BucketRequest
+		if perUser > 0 {
+			requests = append(requests, BucketRequest{Key: requestBucketKey("user", scope, auth.UserFrom(r.Context())), Limit: perUser})
+		}
+		if perIP > 0 {
+			requests = append(requests, BucketRequest{Key: requestBucketKey("ip", scope, ClientIP(r)), Limit: perIP})
+		}
+		if len(requests) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		results, err := l.store.TakeAll(r.Context(), requests, l.period, time.Now())
+		if err != nil {
+			log.Error("Rate limit store failed, letting request through: ", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The headers describe whichever bucket is closest to empty, the one that refused
+		// the request when one did
+		var tightest int
+		for i, result := range results {
+			if result.Allowed && result.Remaining < results[tightest].Remaining {
+				tightest = i
+			}
+			if !result.Allowed && result.RetryAfter > results[tightest].RetryAfter {
+				tightest = i
+			}
+		}
+		var result TokenBucket = results[tightest]
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(requests[tightest].Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+
+		if !result.Allowed {
+			log.Warn("Rate limit exceeded for ", requests[tightest].Key, " on ", r.URL.Path)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			api.TooManyRequestsErrorHandler(w, TooManyRequestsError)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/auth"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		result, _ := store.Take(context.Background(), "aaron", 3, time.Minute, start)
+		if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("Take %d: expected allowed with %d left, got %+v", i+1, 2-i, result)
+		}
+	}
+
+	result, _ := store.Take(context.Background(), "aaron", 3, time.Minute, start)
+	if result.Allowed || result.RetryAfter != 20*time.Second {
+		t.Errorf("Expected an empty bucket to wait 20s for a token, got %+v", result)
+	}
+
+	// A third of the minute refills one of three tokens
+	result, _ = store.Take(context.Background(), "aaron", 3, time.Minute, start.Add(20*time.Second))
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected one refilled token, got %+v", result)
+	}
+
+	result, _ = store.Take(context.Background(), "bryan", 3, time.Minute, start)
+	if !result.Allowed || result.Remaining != 2 {
+		t.Errorf("Expected other keys to have their own bucket, got %+v", result)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) TakeAll(ctx context.Context, requests []BucketRequest, period time.Duration, now time.Time) ([]TokenBucket, error) {
+	return nil, errors.New("store down")
+}
+
+func (failingStore) Buckets(ctx context.Context, prefix string, now time.Time) ([]StoredBucket, error) {
+	return nil, errors.New("store down")
+}
+
+func (failingStore) Clear(ctx context.Context, keys []string) (int, error) {
+	return 0, errors.New("store down")
+}
+
+func TestRequestLimiter(t *testing.T) {
+	var route = func(r *http.Request) string { return r.URL.Path }
+	limiter := NewRequestLimiter(NewMemoryRateLimitStore(), 2, 3, map[string]int{"/transfer": 1}, time.Minute, route)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var serve = func(path string, username string, ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = ip + ":5000"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{Username: username})))
+		return w
+	}
+
+	t.Run("Per_User", func(t *testing.T) {
+		serve("/coins", "aaron", "10.1.0.1")
+		serve("/coins", "aaron", "10.1.0.2")
+		w := serve("/coins", "aaron", "10.1.0.3")
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected the user's third request to be limited, got %d", w.Code)
+		}
+		if w.Header().Get("Retry-After") != "30" || w.Header().Get("RateLimit-Reset") != "60" {
+			t.Errorf("Expected Retry-After 30 and RateLimit-Reset 60, got %q and %q", w.Header().Get("Retry-After"), w.Header().Get("RateLimit-Reset"))
+		}
+	})
+
+	t.Run("Per_IP", func(t *testing.T) {
+		for _, username := range []string{"u1", "u2", "u3"} {
+			if w := serve("/coins", username, "10.2.0.1"); w.Code != http.StatusOK {
+				t.Fatalf("Expected %s to be let through, got %d", username, w.Code)
+			}
+		}
+		if w := serve("/coins", "u4", "10.2.0.1"); w.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected the IP's fourth request to be limited, got %d", w.Code)
+		}
+
+		// The refusal cost u4 nothing, both its tokens are left for another IP
+		for i := 0; i < 2; i++ {
+			if w := serve("/coins", "u4", "10.2.0.2"); w.Code != http.StatusOK {
+				t.Errorf("Expected u4's request %d from another IP through, got %d", i+1, w.Code)
+			}
+		}
+	})
+
+	t.Run("Per_Route", func(t *testing.T) {
+		if w := serve("/transfer", "bryan", "10.3.0.1"); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "1" {
+			t.Fatalf("Expected the route's own limit, got %d with limit %q", w.Code, w.Header().Get("RateLimit-Limit"))
+		}
+		if w := serve("/transfer", "bryan", "10.3.0.2"); w.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected the stricter route to be limited, got %d", w.Code)
+		}
+
+		// The default buckets are untouched
+		if w := serve("/coins", "bryan", "10.3.0.1"); w.Code != http.StatusOK {
+			t.Errorf("Expected other routes to be let through, got %d", w.Code)
+		}
+	})
+
+	t.Run("Store_Failure_Lets_Through", func(t *testing.T) {
+		handler := NewRequestLimiter(failingStore{}, 1, 1, nil, time.Minute, route).Middleware(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		for i := 0; i < 3; i++ {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/coins", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Request %d: expected to be let through, got %d", i+1, w.Code)
+			}
+		}
+	})
+}
+
+func TestRequestRateLimitAdmin(t *testing.T) {
+	var route = func(r *http.Request) string { return r.URL.Path }
+	limiter := NewRequestLimiter(NewMemoryRateLimitStore(), 1, 5, nil, time.Minute, route)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var serve = func(username string) int {
+		r := httptest.NewRequest(http.MethodGet, "/coins", nil)
+		r.RemoteAddr = "10.4.0.1:5000"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{Username: username})))
+		return w.Code
+	}
+
+	serve("erin")
+	if code := serve("erin"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected erin limited, got %d", code)
+	}
+
+	buckets, err := RequestRateLimitBuckets(context.Background(), "erin", "")
+	if err != nil || len(buckets) != 1 || buckets[0].Account != "erin" || buckets[0].Route != "default" || buckets[0].Remaining != 0 {
+		t.Fatalf("Expected erin's empty bucket, got %+v, %v", buckets, err)
+	}
+	if all, _ := RequestRateLimitBuckets(context.Background(), "", ""); len(all) != 2 {
+		t.Errorf("Expected erin's and the IP's buckets, got %+v", all)
+	}
+
+	cleared, err := ClearRequestRateLimit(context.Background(), "erin", "", "", "admin")
+	if err != nil || cleared != 1 {
+		t.Fatalf("Expected one bucket cleared, got %d, %v", cleared, err)
+	}
+	if code := serve("erin"); code != http.StatusOK {
+		t.Errorf("Expected erin let back in, got %d", code)
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/bryantjandra/goapi/internal/auth"
+	"github.com/bryantjandra/goapi/internal/warmup"
+)
+
+// TrackHotAccounts counts requests per account so the next startup can warm the
+// busiest ones, it must run after Authorization
+func TrackHotAccounts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		warmup.Track(auth.UserFrom(r.Context()))
+		next.ServeHTTP(w, r)
+	})
+}
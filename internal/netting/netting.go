@@ -0,0 +1,349 @@
+// Package netting accumulates transfers between the same two accounts over a
+// settlement window and settles what they add up to as one transfer when the window
+// closes, so a pair trading back and forth writes one ledger entry per window.
+package netting
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInvalidTransfer   = errors.New("invalid netted transfer")
+	ErrDisabled          = errors.New("netting is not enabled")
+	ErrInsufficientFunds = errors.New("insufficient funds once netted transfers awaiting settlement are reserved")
+)
+
+// Window and settlement statuses
+const (
+	StatusOpen    = "open"
+	StatusSettled = "settled"
+	StatusNoNet   = "no_net"
+	StatusFailed  = "failed"
+)
+
+// Window holds the transfers accepted for one pair of accounts, A sorting before B.
+// Coins only move when it is settled.
+type Window struct {
+	ID        string
+	A         string
+	B         string
+	AToB      int64
+	BToA      int64
+	Transfers int
+	OpenedAt  time.Time
+	ClosesAt  time.Time
+}
+
+// Net is the single transfer that settles the window, amount 0 when both directions
+// cancel out
+func (w Window) Net() (from string, to string, amount int64) {
+	if w.AToB >= w.BToA {
+		return w.A, w.B, w.AToB - w.BToA
+	}
+	return w.B, w.A, w.BToA - w.AToB
+}
+
+// Outgoing is what username has sent in the window, before netting
+func (w Window) Outgoing(username string) int64 {
+	switch username {
+	case w.A:
+		return w.AToB
+	case w.B:
+		return w.BToA
+	}
+	return 0
+}
+
+// Settlement is the outcome of settling a closed window
+type Settlement struct {
+	Window    Window
+	From      string
+	To        string
+	Amount    int64
+	Status    string
+	SettledAt time.Time
+}
+
+// Kinds a window is kept as. Each side's outgoing total is a storage hold, so what
+// they sent can't be spent twice and the net payer's is captured once however many
+// processes settle, and the window lives in a record next to the balances.
+const (
+	holdKind   = "netting"
+	recordKind = "netting_window"
+)
+
+// state is what this process knows of the windows it opened, kept once for the process
+// and once for each isolated in-memory database, see tools.ScopeOf
+type state struct {
+	// Windows this process adds transfers to, by pair. Only the process that opened a
+	// window adds to it, so its totals are never written from two places.
+	windows map[[2]string]*Window
+
+	// IDs of the windows this process opened and hasn't settled yet
+	opened map[string]bool
+}
+
+func newState() *state {
+	return &state{windows: map[[2]string]*Window{}, opened: map[string]bool{}}
+}
+
+var (
+	mu     sync.Mutex
+	states = tools.NewScoped(newState)
+)
+
+func newID() string {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+func pairKey(from, to string) [2]string {
+	if to < from {
+		return [2]string{to, from}
+	}
+	return [2]string{from, to}
+}
+
+// holdID is the storage hold for what username sent in the window
+func holdID(window Window, username string) string {
+	return window.ID + ":" + username
+}
+
+func save(database tools.DatabaseInterface, window *Window) error {
+	data, err := json.Marshal(window)
+	if err != nil {
+		return err
+	}
+	return database.PutRecord(tools.Record{Kind: recordKind, ID: window.ID, Account: window.A, Data: data, UpdatedAt: time.Now()})
+}
+
+// list returns every window not yet settled, oldest first
+func list(database tools.DatabaseInterface) ([]Window, error) {
+	records, err := database.ListRecords(recordKind, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var result = make([]Window, 0, len(records))
+	for _, record := range records {
+		var window Window
+		err = json.Unmarshal(record.Data, &window)
+		if err != nil {
+			return nil, fmt.Errorf("netting window %s: %w", record.ID, err)
+		}
+		result = append(result, window)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].OpenedAt.Before(result[j].OpenedAt) })
+	return result, nil
+}
+
+// Add accepts a transfer into the pair's open window, opening one that closes length
+// from now if there isn't one. Storage checks from has the amount available as it
+// grows their hold on the window, the transfer is refused otherwise.
+func Add(database tools.DatabaseInterface, from string, to string, amount int64, length time.Duration, now time.Time) (Window, error) {
+	if length <= 0 {
+		return Window{}, ErrDisabled
+	}
+	if amount <= 0 || from == "" || to == "" || from == to {
+		return Window{}, ErrInvalidTransfer
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var local *state = states.For(database)
+	var key = pairKey(from, to)
+	var window Window
+	if current, ok := local.windows[key]; ok && now.Before(current.ClosesAt) {
+		window = *current
+	} else {
+		window = Window{ID: newID(), A: key[0], B: key[1], OpenedAt: now, ClosesAt: now.Add(length)}
+	}
+	var previous int64 = window.Outgoing(from)
+	if from == window.A {
+		window.AToB += amount
+	} else {
+		window.BToA += amount
+	}
+	window.Transfers++
+
+	var hold = tools.Hold{ID: holdID(window, from), Account: from, Kind: holdKind, Amount: window.Outgoing(from), CreatedAt: now}
+	_, err := database.PlaceHold(hold)
+	if errors.Is(err, tools.ErrInsufficientFunds) {
+		return Window{}, ErrInsufficientFunds
+	}
+	if err != nil {
+		return Window{}, err
+	}
+	err = save(database, &window)
+	if err != nil {
+		var restoreErr error
+		if previous > 0 {
+			hold.Amount = previous
+			_, restoreErr = database.PlaceHold(hold)
+		} else {
+			_, restoreErr = database.ReleaseHold(hold.ID)
+		}
+		return Window{}, errors.Join(err, restoreErr)
+	}
+
+	local.windows[key] = &window
+	local.opened[window.ID] = true
+	return window, nil
+}
+
+// Open lists the windows naming username that haven't settled yet, oldest first
+func Open(database tools.DatabaseInterface, username string) ([]Window, error) {
+	all, err := list(database)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = []Window{}
+	for _, window := range all {
+		if window.A == username || window.B == username {
+			result = append(result, window)
+		}
+	}
+	return result, nil
+}
+
+// takeDue returns the windows to settle at now, every window this process opened with
+// all. A transfer for the pair from then on opens a new window. A window another
+// process opened is only taken a whole window length after it closed, when that
+// process, say one that restarted, should have settled it.
+func takeDue(database tools.DatabaseInterface, now time.Time, all bool) ([]Window, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	stored, err := list(database)
+	if err != nil {
+		return nil, err
+	}
+
+	var local *state = states.For(database)
+	var due []Window
+	for _, window := range stored {
+		if local.opened[window.ID] {
+			if !all && window.ClosesAt.After(now) {
+				continue
+			}
+			delete(local.opened, window.ID)
+			if current, ok := local.windows[pairKey(window.A, window.B)]; ok && current.ID == window.ID {
+				delete(local.windows, pairKey(window.A, window.B))
+			}
+		} else if window.ClosesAt.Add(window.ClosesAt.Sub(window.OpenedAt)).After(now) {
+			continue
+		}
+		due = append(due, window)
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ClosesAt.Before(due[j].ClosesAt) })
+	return due, nil
+}
+
+// Settle moves the net of every window closed at now, with all every window this
+// process has open. The net payer's hold is captured, moving the net and freeing the
+// rest in one step, and the other side's hold is released. A settlement refused by the
+// storage layer is logged and left in its audit log, a window another process settled
+// first isn't reported again and one that fails otherwise is left for a later run.
+func Settle(database tools.DatabaseInterface, now time.Time, all bool) ([]Settlement, error) {
+	due, err := takeDue(database, now, all)
+	if err != nil {
+		return nil, err
+	}
+
+	var settlements []Settlement
+	for _, window := range due {
+		from, to, amount := window.Net()
+		var settlement = Settlement{Window: window, From: from, To: to, Amount: amount, Status: StatusNoNet, SettledAt: now}
+
+		var release = []string{window.A, window.B}
+		var elsewhere bool
+		if amount > 0 {
+			_, _, err = database.CaptureHold(context.Background(), holdID(window, from), to, amount)
+			switch {
+			case errors.Is(err, tools.ErrHoldNotFound):
+				// Captured by another process, or by a run of this one that stopped
+				// before cleaning up, which the rest of this finishes
+				elsewhere = true
+				release = []string{to}
+			case errors.Is(err, tools.ErrAccountFrozen), errors.Is(err, tools.ErrUserNotFound),
+				errors.Is(err, tools.ErrInsufficientFunds), errors.Is(err, tools.ErrBalanceOverflow):
+				settlement.Status = StatusFailed
+				log.Error("Netting settlement failed for users: ", from, " -> ", to, " amount: ", amount, ": ", err)
+			case err != nil:
+				return settlements, err
+			default:
+				settlement.Status = StatusSettled
+				release = []string{to}
+				events.Record(database, events.TransferCompleted, from, map[string]interface{}{
+					"from":   from,
+					"to":     to,
+					"amount": amount,
+				})
+			}
+		}
+
+		for _, username := range release {
+			if window.Outgoing(username) == 0 {
+				continue
+			}
+			_, err = database.ReleaseHold(holdID(window, username))
+			if err != nil && !errors.Is(err, tools.ErrHoldNotFound) {
+				return settlements, err
+			}
+		}
+		if err = database.DeleteRecord(recordKind, window.ID); err != nil && !errors.Is(err, tools.ErrRecordNotFound) {
+			log.Error("Failed to remove settled netting window ", window.ID, ": ", err)
+		}
+		if elsewhere {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"window":    window.ID,
+			"from":      from,
+			"to":        to,
+			"net":       amount,
+			"transfers": window.Transfers,
+			"status":    settlement.Status,
+		}).Info("Netting window settled")
+		settlements = append(settlements, settlement)
+	}
+	return settlements, nil
+}
+
+// Schedule settles windows as they close, checking every tick until ctx is done
+func Schedule(ctx context.Context, tick time.Duration, open func() (tools.DatabaseInterface, error)) {
+	var ticker *time.Ticker = time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			database, err := open()
+			if err != nil {
+				log.Error("Netting settlement could not open the database: ", err)
+				continue
+			}
+			if _, err = Settle(database, now, false); err != nil {
+				log.Error("Netting settlement failed: ", err)
+			}
+		}
+	}
+}
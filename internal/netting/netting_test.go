@@ -0,0 +1,136 @@
+package netting
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+// reset forgets which windows this process opened, as a restart would
+func reset(database tools.DatabaseInterface) {
+	mu.Lock()
+	defer mu.Unlock()
+	*states.For(database) = *newState()
+}
+
+func TestNetting(t *testing.T) {
+	var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("High_Frequency_Pair_Settles_Once", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		// aaron sends 10 a hundred times, bryan sends 7 back a hundred times
+		for i := 0; i < 100; i++ {
+			if _, err := Add(database, "aaron", "bryan", 10, time.Minute, now); err != nil {
+				t.Fatalf("Failed to add: %v", err)
+			}
+			if _, err := Add(database, "bryan", "aaron", 7, time.Minute, now); err != nil {
+				t.Fatalf("Failed to add: %v", err)
+			}
+		}
+		if reserved := toolstest.Held(t, database, "aaron"); reserved != 1000 {
+			t.Errorf("Expected aaron's 1000 gross to be held, got %d", reserved)
+		}
+
+		if settled, _ := Settle(database, now.Add(59*time.Second), false); len(settled) != 0 {
+			t.Fatalf("Expected nothing to settle before the window closes, got %+v", settled)
+		}
+		settled, err := Settle(database, now.Add(time.Minute), false)
+		if err != nil {
+			t.Fatalf("Failed to settle: %v", err)
+		}
+		if len(settled) != 1 || settled[0].Status != StatusSettled || settled[0].From != "aaron" || settled[0].Amount != 300 {
+			t.Fatalf("Expected one 300 coin settlement from aaron, got %+v", settled)
+		}
+
+		aaron, _ := database.GetUserCoins("aaron")
+		bryan, _ := database.GetUserCoins("bryan")
+		if aaron.Coins != 700 || bryan.Coins != 1300 {
+			t.Errorf("Expected 700 and 1300, got %d and %d", aaron.Coins, bryan.Coins)
+		}
+		if history := database.GetTransactionHistory("aaron"); len(history) != 1 {
+			t.Errorf("Expected one ledger entry for 200 transfers, got %d", len(history))
+		}
+		if open, _ := Open(database, "aaron"); aaron.Held != 0 || bryan.Held != 0 || len(open) != 0 {
+			t.Error("Expected the holds to end with the settlement")
+		}
+	})
+
+	t.Run("Holds_Cap_Spending", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		if _, err := Add(database, "aaron", "bryan", 600, time.Minute, now); err != nil {
+			t.Fatalf("Failed to add: %v", err)
+		}
+		// Incoming coins don't count until they settle
+		Add(database, "bryan", "aaron", 500, time.Minute, now)
+		if _, err := Add(database, "aaron", "bryan", 500, time.Minute, now); !errors.Is(err, ErrInsufficientFunds) {
+			t.Errorf("Expected ErrInsufficientFunds, got %v", err)
+		}
+		if toolstest.Held(t, database, "aaron") != 600 {
+			t.Errorf("Expected the refused transfer to leave the hold at 600, got %d", toolstest.Held(t, database, "aaron"))
+		}
+		if _, err := database.WithdrawUserCoins("aaron", 500); !errors.Is(err, tools.ErrInsufficientFunds) {
+			t.Errorf("Expected storage to refuse spending netted coins, got %v", err)
+		}
+	})
+
+	t.Run("Cancelled_Out_Moves_Nothing", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		Add(database, "aaron", "bryan", 50, time.Minute, now)
+		Add(database, "bryan", "aaron", 50, time.Minute, now)
+		settled, _ := Settle(database, now, true)
+		if len(settled) != 1 || settled[0].Status != StatusNoNet {
+			t.Fatalf("Expected a settlement with nothing to move, got %+v", settled)
+		}
+		if history := database.GetTransactionHistory("aaron"); len(history) != 0 {
+			t.Errorf("Expected no ledger entries, got %+v", history)
+		}
+		if toolstest.Held(t, database, "aaron") != 0 || toolstest.Held(t, database, "bryan") != 0 {
+			t.Error("Expected both holds released")
+		}
+	})
+
+	t.Run("Window_Outlives_A_Restart", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		Add(database, "aaron", "bryan", 40, time.Minute, now)
+		reset(database)
+
+		if open, _ := Open(database, "bryan"); len(open) != 1 || open[0].AToB != 40 {
+			t.Fatalf("Expected the window to be kept in storage, got %+v", open)
+		}
+		// Left for whoever opened it until a window length after it closed
+		if settled, _ := Settle(database, now.Add(time.Minute), true); len(settled) != 0 {
+			t.Fatalf("Expected another process's window to wait, got %+v", settled)
+		}
+		settled, err := Settle(database, now.Add(2*time.Minute), false)
+		if err != nil || len(settled) != 1 || settled[0].Status != StatusSettled {
+			t.Fatalf("Expected the window to settle late, got %+v: %v", settled, err)
+		}
+		if settled, _ := Settle(database, now.Add(3*time.Minute), false); len(settled) != 0 {
+			t.Errorf("Expected the window to settle once, got %+v", settled)
+		}
+		if bryan, _ := database.GetUserCoins("bryan"); bryan.Coins != 1040 {
+			t.Errorf("Expected 1040, got %d", bryan.Coins)
+		}
+	})
+
+	t.Run("Refuses_Invalid_Transfers", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		if _, err := Add(database, "aaron", "bryan", 10, 0, now); !errors.Is(err, ErrDisabled) {
+			t.Errorf("Expected ErrDisabled, got %v", err)
+		}
+		if _, err := Add(database, "aaron", "aaron", 10, time.Minute, now); !errors.Is(err, ErrInvalidTransfer) {
+			t.Errorf("Expected ErrInvalidTransfer for a self-transfer, got %v", err)
+		}
+		if _, err := Add(database, "aaron", "bryan", 0, time.Minute, now); !errors.Is(err, ErrInvalidTransfer) {
+			t.Errorf("Expected ErrInvalidTransfer for no amount, got %v", err)
+		}
+	})
+}
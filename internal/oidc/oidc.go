@@ -0,0 +1,315 @@
+// Package oidc validates access tokens issued by an external OpenID Connect identity
+// provider. Signing keys come from the provider's JWKS, found through discovery unless
+// configured, and are refetched when a token names a key that isn't cached.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+// Scopes a token needs, by what the request does
+const (
+	ScopeRead  = "goapi:read"
+	ScopeWrite = "goapi:write"
+	ScopeAudit = "goapi:audit"
+	ScopeAdmin = "goapi:admin"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid identity provider token")
+	ErrMissingScope = errors.New("token is missing a required scope")
+)
+
+const (
+	// Cached keys are refetched after keysTTL, or on an unknown key ID at most every keysMinRefresh
+	keysTTL        = time.Hour
+	keysMinRefresh = time.Minute
+
+	// Clock skew allowed on exp, nbf and iat
+	leeway = 30 * time.Second
+)
+
+// Asymmetric algorithms only, an HMAC token would be signed with a public key
+var validMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+type Settings struct {
+	Issuer   string
+	Audience string
+
+	// Discovered from the issuer when empty
+	JWKSURL string
+
+	// Claim holding the account username, e.g. sub or preferred_username
+	UsernameClaim string
+}
+
+// Identity is what a verified token says about the caller
+type Identity struct {
+	Username  string
+	Subject   string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// HasScope reports whether the token was granted scope
+func (i Identity) HasScope(scope string) bool {
+	for _, granted := range i.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type Provider struct {
+	settings Settings
+	client   *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+var (
+	providersMu sync.Mutex
+	providers   = map[Settings]*Provider{}
+)
+
+// For returns the provider for settings, sharing its key cache between requests
+func For(settings Settings) *Provider {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	provider, ok := providers[settings]
+	if !ok {
+		provider = &Provider{settings: settings, client: &http.Client{Timeout: 5 * time.Second}}
+		providers[settings] = provider
+	}
+	return provider
+}
+
+// IsBearer reports whether an Authorization header carries a bearer token
+func IsBearer(header string) bool {
+	return strings.HasPrefix(header, "Bearer ")
+}
+
+// Verify checks the signature, issuer, audience and lifetime of a bearer token and
+// returns the identity it carries
+func (p *Provider) Verify(ctx context.Context, header string) (Identity, error) {
+	var raw string = strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+
+	token, err := jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods(validMethods),
+		jwt.WithIssuer(p.settings.Issuer),
+		jwt.WithAudience(p.settings.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(leeway),
+	)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return Identity{}, ErrInvalidToken
+	}
+
+	username, _ := claims[p.settings.UsernameClaim].(string)
+	if username == "" || len(username) > 64 {
+		return Identity{}, fmt.Errorf("%w: claim %s must be a username of at most 64 characters", ErrInvalidToken, p.settings.UsernameClaim)
+	}
+
+	var identity = Identity{Username: username, Scopes: scopes(claims)}
+	identity.Subject, _ = claims.GetSubject()
+	if expiresAt, err := claims.GetExpirationTime(); err == nil && expiresAt != nil {
+		identity.ExpiresAt = expiresAt.Time
+	}
+	return identity, nil
+}
+
+// scopes reads the space separated scope claim, or the scp list some providers use
+func scopes(claims jwt.MapClaims) []string {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+
+	switch scp := claims["scp"].(type) {
+	case string:
+		return strings.Fields(scp)
+	case []interface{}:
+		var result []string
+		for _, value := range scp {
+			if scope, ok := value.(string); ok {
+				result = append(result, scope)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// key returns the signing key with ID kid, refreshing the JWKS when it is stale or
+// doesn't have the key yet
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var age time.Duration = time.Since(p.fetchedAt)
+	key, ok := p.keys[kid]
+	if ok && age < keysTTL {
+		return key, nil
+	}
+
+	if p.keys == nil || age >= keysMinRefresh {
+		keys, err := p.fetchKeys(ctx)
+		if err != nil {
+			log.Error("Failed to fetch identity provider keys: ", err)
+		} else {
+			p.keys = keys
+			p.fetchedAt = time.Now()
+		}
+	}
+
+	key, ok = p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var jwksURL string = p.settings.JWKSURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		err := p.getJSON(ctx, strings.TrimSuffix(p.settings.Issuer, "/")+"/.well-known/openid-configuration", &discovery)
+		if err != nil {
+			return nil, err
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err := p.getJSON(ctx, jwksURL, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys = map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Warn("Skipping identity provider key ", jwk.Kid, ": ", err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(jwk.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on %s", jwk.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
@@ -0,0 +1,139 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIssuer serves discovery and a JWKS with the keys in keys
+type testIssuer struct {
+	server *httptest.Server
+	keys   map[string]*rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	var issuer = &testIssuer{keys: map[string]*rsa.PrivateKey{}}
+	issuer.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"jwks_uri": issuer.server.URL + "/jwks"})
+		case "/jwks":
+			var keys []map[string]string
+			for kid, key := range issuer.keys {
+				keys = append(keys, map[string]string{
+					"kid": kid, "kty": "RSA", "use": "sig",
+					"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(issuer.server.Close)
+	issuer.addKey(t, "key-1")
+	return issuer
+}
+
+func (i *testIssuer) addKey(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.keys[kid] = key
+}
+
+func (i *testIssuer) token(t *testing.T, kid string, claims jwt.MapClaims) string {
+	var base = jwt.MapClaims{
+		"iss":   i.server.URL,
+		"aud":   "goapi",
+		"sub":   "aaron",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "openid goapi:read",
+	}
+	for name, value := range claims {
+		base[name] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, base)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(i.keys[kid])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + signed
+}
+
+func TestVerify(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := For(Settings{Issuer: issuer.server.URL, Audience: "goapi", UsernameClaim: "sub"})
+	ctx := context.Background()
+
+	identity, err := provider.Verify(ctx, issuer.token(t, "key-1", nil))
+	if err != nil {
+		t.Fatalf("Expected a valid token, got %v", err)
+	}
+	if identity.Username != "aaron" || !identity.HasScope(ScopeRead) || identity.HasScope(ScopeWrite) {
+		t.Errorf("Unexpected identity: %+v", identity)
+	}
+
+	var rejected = map[string]jwt.MapClaims{
+		"Wrong_Audience":   {"aud": "other"},
+		"Wrong_Issuer":     {"iss": "https://evil.example.com"},
+		"Expired":          {"exp": time.Now().Add(-time.Hour).Unix()},
+		"No_Expiry":        {"exp": nil},
+		"Missing_Username": {"sub": ""},
+	}
+	for name, claims := range rejected {
+		t.Run(name, func(t *testing.T) {
+			if _, err := provider.Verify(ctx, issuer.token(t, "key-1", claims)); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Expected the token to be rejected, got %v", err)
+			}
+		})
+	}
+
+	t.Run("HMAC_Rejected", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": issuer.server.URL, "aud": "goapi", "sub": "aaron", "exp": time.Now().Add(time.Hour).Unix()})
+		token.Header["kid"] = "key-1"
+		signed, _ := token.SignedString([]byte("secret"))
+		if _, err := provider.Verify(ctx, "Bearer "+signed); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected an HS256 token to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Key_Rotation", func(t *testing.T) {
+		issuer.addKey(t, "key-2")
+
+		// Within the refresh interval an unknown key isn't refetched
+		if _, err := provider.Verify(ctx, issuer.token(t, "key-2", nil)); err == nil {
+			t.Errorf("Expected the new key to be unknown until the next refresh")
+		}
+
+		provider.mu.Lock()
+		provider.fetchedAt = time.Now().Add(-keysMinRefresh)
+		provider.mu.Unlock()
+
+		if _, err := provider.Verify(ctx, issuer.token(t, "key-2", nil)); err != nil {
+			t.Errorf("Expected the rotated key to be fetched, got %v", err)
+		}
+	})
+
+	t.Run("Scp_Claim", func(t *testing.T) {
+		identity, err := provider.Verify(ctx, issuer.token(t, "key-1", jwt.MapClaims{"scope": nil, "scp": []string{ScopeWrite}}))
+		if err != nil || !identity.HasScope(ScopeWrite) {
+			t.Errorf("Expected scopes from scp, got %+v (%v)", identity, err)
+		}
+	})
+}
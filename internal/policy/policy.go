@@ -0,0 +1,243 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultCurrency = "COIN"
+	DefaultTier     = "standard"
+)
+
+var (
+	ErrVersionConflict = errors.New("policy document was modified by someone else, reload and retry")
+	ErrInvalidPolicy   = errors.New("invalid policy document")
+)
+
+// Limits for a single currency and account tier
+type Limits struct {
+	MaxBalance     int64
+	MaxTransaction int64
+	DailyLimit     int64
+}
+
+// Caps on transfers between the same two accounts in either direction, over rolling
+// windows. Zero means no cap.
+type PairLimits struct {
+	HourlyCount  int64
+	HourlyAmount int64
+	DailyCount   int64
+	DailyAmount  int64
+}
+
+// Stricter limits for accounts opened less than Days ago, on top of their tier's.
+// Zero Days turns probation off.
+type Probation struct {
+	Days           int
+	MaxTransaction int64
+	DailyLimit     int64
+}
+
+// Versioned policy document, currency -> tier -> limits
+type Document struct {
+	Version    int64
+	Limits     map[string]map[string]Limits
+	PairLimits PairLimits
+	Probation  Probation
+	UpdatedBy  string
+	UpdatedAt  time.Time
+}
+
+// Every accepted document, oldest first. This is the audit trail of who changed limits
+// when. The process keeps one history and each isolated in-memory database its own,
+// see tools.ScopeOf.
+type history []Document
+
+var (
+	mu        sync.RWMutex
+	histories = tools.NewScoped(func() *history { return &history{defaultDocument()} })
+)
+
+// active is the newest document in database's history, callers hold mu
+func active(database tools.DatabaseInterface) Document {
+	var documents history = *histories.For(database)
+	return documents[len(documents)-1]
+}
+
+func defaultDocument() Document {
+	return Document{
+		Version: 1,
+		Limits: map[string]map[string]Limits{
+			DefaultCurrency: {
+				DefaultTier: {
+					MaxBalance:     1000000,
+					MaxTransaction: 10000,
+					DailyLimit:     50000,
+				},
+				"premium": {
+					MaxBalance:     10000000,
+					MaxTransaction: 100000,
+					DailyLimit:     500000,
+				},
+			},
+		},
+		PairLimits: PairLimits{
+			HourlyCount:  10,
+			HourlyAmount: 5000,
+			DailyCount:   50,
+			DailyAmount:  20000,
+		},
+		Probation: Probation{
+			Days:           7,
+			MaxTransaction: 500,
+			DailyLimit:     1000,
+		},
+		UpdatedBy: "system",
+		UpdatedAt: time.Now(),
+	}
+}
+
+// Current returns the policy document active for database
+func Current(database tools.DatabaseInterface) Document {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return copyDocument(active(database))
+}
+
+// LimitsFor returns the limits for a currency and tier in the active document
+func LimitsFor(database tools.DatabaseInterface, currency string, tier string) (Limits, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	tiers, ok := active(database).Limits[currency]
+	if !ok {
+		return Limits{}, false
+	}
+
+	limits, ok := tiers[tier]
+	return limits, ok
+}
+
+// CurrentPairLimits returns the counterparty pair caps in the active document
+func CurrentPairLimits(database tools.DatabaseInterface) PairLimits {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return active(database).PairLimits
+}
+
+// CurrentProbation returns the probation limits in the active document
+func CurrentProbation(database tools.DatabaseInterface) Probation {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return active(database).Probation
+}
+
+// History returns every policy document accepted for database, oldest first
+func History(database tools.DatabaseInterface) []Document {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var documents history = *histories.For(database)
+	docs := make([]Document, 0, len(documents))
+	for _, doc := range documents {
+		docs = append(docs, copyDocument(doc))
+	}
+	return docs
+}
+
+// Update replaces the document active for database. The caller must send the version
+// it read (optimistic locking) so concurrent admins cannot silently overwrite each other.
+func Update(database tools.DatabaseInterface, doc Document, updatedBy string) (Document, error) {
+	err := Validate(doc)
+	if err != nil {
+		return Document{}, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	documents := histories.For(database)
+	current := (*documents)[len(*documents)-1]
+	if doc.Version != current.Version {
+		return Document{}, ErrVersionConflict
+	}
+
+	next := copyDocument(doc)
+	next.Version = current.Version + 1
+	next.UpdatedBy = updatedBy
+	next.UpdatedAt = time.Now()
+	*documents = append(*documents, next)
+
+	log.Info("Policy document updated to version ", next.Version, " by ", updatedBy)
+
+	return copyDocument(next), nil
+}
+
+// Validate checks that a document is internally consistent
+func Validate(doc Document) error {
+	if len(doc.Limits) == 0 {
+		return fmt.Errorf("%w: at least one currency is required", ErrInvalidPolicy)
+	}
+
+	for currency, tiers := range doc.Limits {
+		if currency == "" {
+			return fmt.Errorf("%w: currency code cannot be empty", ErrInvalidPolicy)
+		}
+		if len(tiers) == 0 {
+			return fmt.Errorf("%w: currency %s has no tiers", ErrInvalidPolicy, currency)
+		}
+
+		for tier, limits := range tiers {
+			if tier == "" {
+				return fmt.Errorf("%w: tier name cannot be empty in currency %s", ErrInvalidPolicy, currency)
+			}
+			if limits.MaxBalance <= 0 || limits.MaxTransaction <= 0 || limits.DailyLimit <= 0 {
+				return fmt.Errorf("%w: limits for %s/%s must be positive", ErrInvalidPolicy, currency, tier)
+			}
+			if limits.MaxTransaction > limits.DailyLimit {
+				return fmt.Errorf("%w: max transaction for %s/%s exceeds its daily limit", ErrInvalidPolicy, currency, tier)
+			}
+		}
+	}
+
+	var pair = doc.PairLimits
+	if pair.HourlyCount < 0 || pair.HourlyAmount < 0 || pair.DailyCount < 0 || pair.DailyAmount < 0 {
+		return fmt.Errorf("%w: pair limits cannot be negative", ErrInvalidPolicy)
+	}
+
+	var probation = doc.Probation
+	if probation.Days < 0 {
+		return fmt.Errorf("%w: probation days cannot be negative", ErrInvalidPolicy)
+	}
+	if probation.Days > 0 {
+		if probation.MaxTransaction <= 0 || probation.DailyLimit <= 0 {
+			return fmt.Errorf("%w: probation limits must be positive", ErrInvalidPolicy)
+		}
+		if probation.MaxTransaction > probation.DailyLimit {
+			return fmt.Errorf("%w: probation max transaction exceeds its daily limit", ErrInvalidPolicy)
+		}
+	}
+
+	return nil
+}
+
+func copyDocument(doc Document) Document {
+	limits := make(map[string]map[string]Limits, len(doc.Limits))
+	for currency, tiers := range doc.Limits {
+		limits[currency] = make(map[string]Limits, len(tiers))
+		for tier, l := range tiers {
+			limits[currency][tier] = l
+		}
+	}
+	doc.Limits = limits
+	return doc
+}
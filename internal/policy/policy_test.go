@@ -0,0 +1,95 @@
+package policy
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+func TestPolicyDocuments(t *testing.T) {
+	t.Run("Update_Increments_Version", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		doc := Current(database)
+		doc.Limits[DefaultCurrency][DefaultTier] = Limits{MaxBalance: 500, MaxTransaction: 50, DailyLimit: 100}
+
+		updated, err := Update(database, doc, "admin")
+		if err != nil {
+			t.Fatalf("Failed to update policy: %v", err)
+		}
+
+		if updated.Version != doc.Version+1 {
+			t.Errorf("Expected version %d, got %d", doc.Version+1, updated.Version)
+		}
+		if updated.UpdatedBy != "admin" {
+			t.Errorf("Expected change to be attributed to admin, got %q", updated.UpdatedBy)
+		}
+
+		limits, ok := LimitsFor(database, DefaultCurrency, DefaultTier)
+		if !ok || limits.DailyLimit != 100 {
+			t.Errorf("Expected new daily limit 100, got %+v", limits)
+		}
+
+		if len(History(database)) != 2 {
+			t.Errorf("Expected 2 documents in history, got %d", len(History(database)))
+		}
+
+		// Other databases keep their own documents
+		if other := Current(toolstest.New(t, nil)); other.Version != 1 {
+			t.Errorf("Expected another database to keep version 1, got %d", other.Version)
+		}
+	})
+
+	t.Run("Stale_Version_Rejected", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		stale := Current(database)
+		var wg sync.WaitGroup
+		var conflicts int
+		var mu sync.Mutex
+
+		// Two admins editing the same version, only one may win
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := Update(database, stale, "admin")
+				if errors.Is(err, ErrVersionConflict) {
+					mu.Lock()
+					conflicts++
+					mu.Unlock()
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if conflicts != 1 {
+			t.Errorf("Expected exactly 1 conflict, got %d", conflicts)
+		}
+	})
+
+	t.Run("Invalid_Documents_Rejected", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		invalid := []Document{
+			{Version: 1},
+			{Version: 1, Limits: map[string]map[string]Limits{"COIN": {}}},
+			{Version: 1, Limits: map[string]map[string]Limits{"COIN": {"standard": {MaxBalance: 10, MaxTransaction: 0, DailyLimit: 10}}}},
+			{Version: 1, Limits: map[string]map[string]Limits{"COIN": {"standard": {MaxBalance: 10, MaxTransaction: 20, DailyLimit: 10}}}},
+		}
+
+		for _, doc := range invalid {
+			_, err := Update(database, doc, "admin")
+			if !errors.Is(err, ErrInvalidPolicy) {
+				t.Errorf("Expected invalid policy error for %+v, got %v", doc, err)
+			}
+		}
+
+		if Current(database).Version != 1 {
+			t.Errorf("Rejected documents must not change the version")
+		}
+	})
+}
@@ -0,0 +1,240 @@
+// Package preflight checks a configuration the way startup would, without serving
+// anything: it must pass config.Validate, the files it names must load and the backends
+// it names must answer. api config validate runs it so CI can stop a bad deploy.
+package preflight
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/audit"
+	"github.com/bryantjandra/goapi/internal/certs"
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/messages"
+	"github.com/bryantjandra/goapi/internal/middleware"
+	"github.com/bryantjandra/goapi/internal/publisher"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/pkg/storage"
+	"github.com/go-sql-driver/mysql"
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+)
+
+// Problem is a check that failed, Err says what to fix
+type Problem struct {
+	Check string
+	Err   error
+}
+
+func (p Problem) String() string {
+	return p.Check + ": " + p.Err.Error()
+}
+
+type check struct {
+	name string
+	run  func(ctx context.Context, cfg config.Config) error
+}
+
+// Files are checked before backends, which are only dialed once the configuration is
+// valid since an unknown driver or publisher has nothing to dial
+var (
+	fileChecks = []check{
+		{"message_templates", checkMessageTemplates},
+		{"latency_profiles", checkLatencyProfiles},
+		{"jwt", checkJWT},
+		{"audit_signing_key", checkAuditSigningKey},
+		{"tls", checkTLS},
+		{"event_topics", checkEventTopics},
+	}
+	backendChecks = []check{
+		{"database", checkDatabase},
+		{"event_brokers", checkEventBrokers},
+	}
+)
+
+// Run checks cfg and returns every problem found, none when it can be served. ctx bounds
+// the time spent dialing backends.
+func Run(ctx context.Context, cfg config.Config) []Problem {
+	var problems []Problem
+	var valid bool = true
+
+	err := config.Validate(cfg)
+	if err != nil {
+		problems = append(problems, Problem{Check: "config", Err: err})
+		valid = false
+	}
+
+	for _, c := range fileChecks {
+		if err := c.run(ctx, cfg); err != nil {
+			problems = append(problems, Problem{Check: c.name, Err: err})
+		}
+	}
+	if !valid {
+		return problems
+	}
+	for _, c := range backendChecks {
+		if err := c.run(ctx, cfg); err != nil {
+			problems = append(problems, Problem{Check: c.name, Err: err})
+		}
+	}
+	return problems
+}
+
+func checkMessageTemplates(ctx context.Context, cfg config.Config) error {
+	if cfg.MessageTemplatesFile == "" {
+		return nil
+	}
+	err := messages.Load(cfg.MessageTemplatesFile)
+	if err != nil {
+		return fmt.Errorf("MESSAGE_TEMPLATES_FILE: %w", err)
+	}
+	return nil
+}
+
+func checkLatencyProfiles(ctx context.Context, cfg config.Config) error {
+	err := tools.LoadLatencyProfiles(cfg.MockLatencyProfilesFile)
+	if err != nil {
+		return fmt.Errorf("MOCK_LATENCY_PROFILES_FILE: %w", err)
+	}
+	if cfg.MockLatencyProfile == "" {
+		return nil
+	}
+	_, err = tools.LatencyProfileNamed(cfg.MockLatencyProfile)
+	if err != nil {
+		return fmt.Errorf("MOCK_LATENCY_PROFILE: %w", err)
+	}
+	return nil
+}
+
+// checkJWT loads the signing key, which for RS256 is only read when the first token is
+// issued
+func checkJWT(ctx context.Context, cfg config.Config) error {
+	if cfg.AuthMode != config.AuthModeJWT {
+		return nil
+	}
+	_, err := middleware.TokenIssuer(cfg)
+	if err != nil {
+		return fmt.Errorf("JWT_SECRET or JWT_PRIVATE_KEY_FILE: %w", err)
+	}
+	return nil
+}
+
+// checkAuditSigningKey decodes the key, which is otherwise only used on the first export
+func checkAuditSigningKey(ctx context.Context, cfg config.Config) error {
+	if cfg.AuditSigningKey == "" {
+		return nil
+	}
+	_, err := audit.NewSigner(cfg.AuditSigningKey)
+	if err != nil {
+		return fmt.Errorf("AUDIT_SIGNING_KEY: %w", err)
+	}
+	return nil
+}
+
+func checkTLS(ctx context.Context, cfg config.Config) error {
+	if !certs.Enabled(cfg) {
+		return nil
+	}
+	_, err := certs.New(cfg)
+	if err != nil {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE: %w", err)
+	}
+	return nil
+}
+
+func checkEventTopics(ctx context.Context, cfg config.Config) error {
+	_, err := publisher.TopicsFor(cfg)
+	if err != nil {
+		return fmt.Errorf("EVENT_TOPICS: %w", err)
+	}
+	return nil
+}
+
+// checkDatabase connects to the backend and pings it. Unlike startup it runs no
+// migrations, a check leaves the database as it found it.
+func checkDatabase(ctx context.Context, cfg config.Config) error {
+	switch cfg.DatabaseDriver {
+	case config.DriverMock:
+		return nil
+	case config.DriverMySQL:
+		dsn, err := mysql.ParseDSN(cfg.DatabaseDSN)
+		if err != nil {
+			return fmt.Errorf("DB_DSN is not a mysql DSN: %w", err)
+		}
+		db, err := sql.Open("mysql", dsn.FormatDSN())
+		if err != nil {
+			return fmt.Errorf("DB_DSN: %w", err)
+		}
+		defer db.Close()
+
+		err = db.PingContext(ctx)
+		if err != nil {
+			return fmt.Errorf("mysql at %s did not answer: %w", dsn.Addr, err)
+		}
+		return nil
+	case config.DriverRedis:
+		options, err := redis.ParseURL(cfg.DatabaseDSN)
+		if err != nil {
+			return fmt.Errorf("DB_DSN is not a redis URL: %w", err)
+		}
+		var client *redis.Client = redis.NewClient(options)
+		defer client.Close()
+
+		err = client.Ping(ctx).Err()
+		if err != nil {
+			return fmt.Errorf("redis at %s did not answer: %w", options.Addr, err)
+		}
+		return nil
+	}
+
+	// Registered backends connect in SetupDatabase, which may change the database, so
+	// only their arguments are checked
+	_, err := storage.Open(cfg.DatabaseDriver, cfg.DatabaseDSN)
+	if err != nil {
+		return fmt.Errorf("DB_DSN: %w", err)
+	}
+	return nil
+}
+
+// checkEventBrokers connects to every NATS server, or opens a connection to every Kafka
+// broker
+func checkEventBrokers(ctx context.Context, cfg config.Config) error {
+	switch cfg.EventPublisher {
+	case config.EventPublisherNATS:
+		var options = []nats.Option{nats.Name("goapi-preflight")}
+		if deadline, ok := ctx.Deadline(); ok {
+			options = append(options, nats.Timeout(time.Until(deadline)))
+		}
+		var failed []string
+		for _, server := range cfg.EventBrokers {
+			conn, err := nats.Connect(server, options...)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s (%v)", config.RedactURL(server), err))
+				continue
+			}
+			conn.Close()
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("NATS servers in EVENT_BROKERS did not answer: %s", strings.Join(failed, ", "))
+		}
+	case config.EventPublisherKafka:
+		var dialer net.Dialer
+		var failed []string
+		for _, broker := range cfg.EventBrokers {
+			conn, err := dialer.DialContext(ctx, "tcp", broker)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s (%v)", broker, err))
+				continue
+			}
+			conn.Close()
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("Kafka brokers in EVENT_BROKERS did not answer: %s", strings.Join(failed, ", "))
+		}
+	}
+	return nil
+}
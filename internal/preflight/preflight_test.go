@@ -0,0 +1,69 @@
+package preflight
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+)
+
+func checks(problems []Problem) []string {
+	var names []string
+	for _, problem := range problems {
+		names = append(names, problem.Check)
+	}
+	return names
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("Defaults_Pass", func(t *testing.T) {
+		if problems := Run(ctx, config.Default()); len(problems) > 0 {
+			t.Errorf("Expected the defaults to pass, got %v", problems)
+		}
+	})
+
+	t.Run("Files_Are_Loaded", func(t *testing.T) {
+		var templates string = filepath.Join(t.TempDir(), "messages.json")
+		if err := os.WriteFile(templates, []byte("{not json"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		var cfg config.Config = config.Default()
+		cfg.MessageTemplatesFile = templates
+		cfg.AuditSigningKey = "not base64"
+		problems := Run(ctx, cfg)
+		if len(problems) != 2 || problems[0].Check != "message_templates" || problems[1].Check != "audit_signing_key" {
+			t.Errorf("Expected both bad files to be reported, got %v", checks(problems))
+		}
+	})
+
+	t.Run("Backends_Must_Answer", func(t *testing.T) {
+		// Nothing listens on port 1, the dial is refused right away
+		var cfg config.Config = config.Default()
+		cfg.DatabaseDriver = config.DriverRedis
+		cfg.DatabaseDSN = "redis://127.0.0.1:1/0"
+		cfg.EventPublisher = config.EventPublisherKafka
+		cfg.EventBrokers = []string{"127.0.0.1:1"}
+
+		problems := Run(ctx, cfg)
+		if len(problems) != 2 || problems[0].Check != "database" || problems[1].Check != "event_brokers" {
+			t.Errorf("Expected the database and the broker to be reported, got %v", problems)
+		}
+	})
+
+	t.Run("Invalid_Config_Skips_Backends", func(t *testing.T) {
+		var cfg config.Config = config.Default()
+		cfg.DatabaseDriver = config.DriverMySQL
+
+		problems := Run(ctx, cfg)
+		if len(problems) != 1 || problems[0].Check != "config" {
+			t.Errorf("Expected only the missing DB_DSN to be reported, got %v", problems)
+		}
+	})
+}
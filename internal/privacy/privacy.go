@@ -0,0 +1,232 @@
+// Package privacy erases an account's personal data on request. The owner asks, an
+// admin approves, and the account is renamed to a pseudonym everywhere, so the ledger
+// still balances and counterparties keep a complete history of their own.
+package privacy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/contacts"
+	"github.com/bryantjandra/goapi/internal/dormancy"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/exports"
+	"github.com/bryantjandra/goapi/internal/freezes"
+	"github.com/bryantjandra/goapi/internal/leaderboard"
+	"github.com/bryantjandra/goapi/internal/lockout"
+	"github.com/bryantjandra/goapi/internal/profiles"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/webhooks"
+	log "github.com/sirupsen/logrus"
+)
+
+const maxReasonLength = 256
+
+// Deletion request statuses
+const (
+	StatusPending   = "pending_approval"
+	StatusCompleted = "completed"
+	StatusRejected  = "rejected"
+)
+
+var (
+	ErrInvalidRequest   = errors.New("invalid deletion request")
+	ErrRequestNotFound  = errors.New("deletion request not found")
+	ErrNotPending       = errors.New("deletion request is not pending approval")
+	ErrAlreadyRequested = errors.New("account deletion already requested")
+	ErrNotEmpty         = errors.New("account must be empty before its data is deleted")
+	ErrSelfApproval     = errors.New("a deletion must be approved by another admin")
+)
+
+// Request asks for an account's personal data to be erased. Once completed Username
+// is the pseudonym, so the request doesn't keep the name either.
+type Request struct {
+	ID          string
+	Username    string
+	Reason      string
+	Status      string
+	RequestedAt time.Time
+	DecidedBy   string
+	DecidedAt   time.Time
+	Note        string
+}
+
+// Requests by ID, the process keeps one table and each isolated in-memory database its
+// own, see tools.ScopeOf
+type table map[string]*Request
+
+var (
+	mu     sync.Mutex
+	tables = tools.NewScoped(func() *table { return &table{} })
+)
+
+func randomHex(n int) string {
+	bytes := make([]byte, n)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// RequestDeletion records the owner's request for an admin to approve
+func RequestDeletion(database tools.DatabaseInterface, username string, reason string) (Request, error) {
+	if len(reason) > maxReasonLength {
+		return Request{}, fmt.Errorf("%w: reason longer than %d characters", ErrInvalidRequest, maxReasonLength)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var requests table = *tables.For(database)
+	for _, existing := range requests {
+		if existing.Username == username && existing.Status == StatusPending {
+			return Request{}, fmt.Errorf("%w: request %s is pending approval", ErrAlreadyRequested, existing.ID)
+		}
+	}
+
+	var request = &Request{
+		ID:          randomHex(8),
+		Username:    username,
+		Reason:      reason,
+		Status:      StatusPending,
+		RequestedAt: time.Now(),
+	}
+	requests[request.ID] = request
+
+	log.Info("Account deletion ", request.ID, " requested by ", username)
+	events.Record(database, events.AccountDeletionRequested, username, map[string]interface{}{
+		"request_id": request.ID,
+	})
+	return *request, nil
+}
+
+// List returns every request, oldest first
+func List(database tools.DatabaseInterface) []Request {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var requests table = *tables.For(database)
+	var result = make([]Request, 0, len(requests))
+	for _, request := range requests {
+		result = append(result, *request)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].RequestedAt.Before(result[j].RequestedAt) })
+	return result
+}
+
+// pending finds a request that can still be decided, callers hold mu
+func (requests table) pending(id string) (*Request, error) {
+	request, ok := requests[id]
+	if !ok {
+		return nil, ErrRequestNotFound
+	}
+	if request.Status != StatusPending {
+		return nil, ErrNotPending
+	}
+	return request, nil
+}
+
+// Reject closes a request without touching the account
+func Reject(database tools.DatabaseInterface, id string, by string, note string) (Request, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	request, err := tables.For(database).pending(id)
+	if err != nil {
+		return Request{}, err
+	}
+
+	request.Status = StatusRejected
+	request.DecidedBy = by
+	request.DecidedAt = time.Now()
+	request.Note = note
+
+	log.Info("Account deletion ", id, " rejected by ", by, ": ", note)
+	return *request, nil
+}
+
+// Approve erases the account's personal data. The balance must be zero with no
+// active freezes, otherwise the request stays pending until the owner empties it.
+func Approve(database tools.DatabaseInterface, id string, by string) (Request, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	request, err := tables.For(database).pending(id)
+	if err != nil {
+		return Request{}, err
+	}
+	if request.Username == by {
+		return Request{}, ErrSelfApproval
+	}
+
+	var username string = request.Username
+	details, err := database.GetUserCoins(username)
+	if err != nil {
+		return Request{}, fmt.Errorf("%w: %s", err, username)
+	}
+	if details.Coins != 0 {
+		return Request{}, fmt.Errorf("%w: balance is %d", ErrNotEmpty, details.Coins)
+	}
+	totals, err := freezes.Summarize(database, username)
+	if err != nil {
+		return Request{}, fmt.Errorf("reading freezes: %w", err)
+	}
+	if totals.Count > 0 {
+		return Request{}, fmt.Errorf("%w: %d active freezes", ErrNotEmpty, totals.Count)
+	}
+
+	// Sessions end first, so none can outlive the account
+	_, err = database.RevokeRefreshTokens(username, "")
+	if err != nil {
+		return Request{}, fmt.Errorf("revoking sessions: %w", err)
+	}
+
+	var pseudonym string = "deleted-" + randomHex(6)
+	err = database.AnonymizeUser(username, pseudonym)
+	if err != nil {
+		return Request{}, fmt.Errorf("anonymizing account: %w", err)
+	}
+	// Freezes are stored next to the balance, the account is gone so this can't be retried
+	err = freezes.Pseudonymize(database, username, pseudonym)
+	if err != nil {
+		log.Error("Failed to pseudonymize the freezes of ", pseudonym, ": ", err)
+	}
+	err = profiles.Delete(database, username)
+	if err != nil {
+		log.Error("Failed to delete the profile of ", pseudonym, ": ", err)
+	}
+	erase(database, username, pseudonym, by)
+
+	request.Username = pseudonym
+	request.Status = StatusCompleted
+	request.DecidedBy = by
+	request.DecidedAt = time.Now()
+
+	log.Info("Account deletion ", id, " approved by ", by, ", account is now ", pseudonym)
+	events.Record(database, events.AccountAnonymized, pseudonym, map[string]interface{}{
+		"request_id":  id,
+		"approved_by": by,
+	})
+	return *request, nil
+}
+
+// erase removes or pseudonymizes everything else kept about username
+func erase(database tools.DatabaseInterface, username string, pseudonym string, by string) {
+	err := contacts.Forget(database, username)
+	if err != nil {
+		log.Error("Failed to delete the contacts of ", pseudonym, ": ", err)
+	}
+	exports.Forget(database, username)
+	leaderboard.Forget(username)
+	lockout.Unlock(database, lockout.Username(username), by)
+
+	for _, subscription := range webhooks.List(database, webhooks.TierAccount, username) {
+		webhooks.Delete(database, webhooks.TierAccount, username, subscription.ID)
+	}
+
+	dormancy.Pseudonymize(username, pseudonym)
+	events.Pseudonymize(database, username, pseudonym)
+}
@@ -0,0 +1,95 @@
+package privacy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/contacts"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/profiles"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+func TestDeletion(t *testing.T) {
+	database, err := tools.NewMemoryDatabase(map[string]tools.LoginDetails{
+		"erin":  {AuthToken: "e", Username: "erin", Role: tools.RoleUser},
+		"frank": {AuthToken: "f", Username: "frank", Role: tools.RoleUser},
+	}, map[string]tools.CoinDetails{
+		"erin":  {Username: "erin", Coins: 100, Version: 1},
+		"frank": {Username: "frank", Coins: 100, Version: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	var db tools.DatabaseInterface = *database
+
+	db.TransferUserCoins("erin", "frank", 40)
+	profiles.SetTimezone(db, "erin", "Europe/Berlin")
+	contacts.Set(db, "frank", contacts.Contact{Counterparty: "erin", Nickname: "Erin Smith"})
+	events.Record(db, events.TransferCompleted, "erin", map[string]interface{}{"to": "frank", "amount": 40})
+
+	request, err := RequestDeletion(db, "erin", "closing my account")
+	if err != nil {
+		t.Fatalf("Failed to request deletion: %v", err)
+	}
+	if _, err := RequestDeletion(db, "erin", ""); !errors.Is(err, ErrAlreadyRequested) {
+		t.Errorf("Expected a second request to be refused, got %v", err)
+	}
+	if _, err := Approve(db, request.ID, "erin"); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("Expected self approval to be refused, got %v", err)
+	}
+	if _, err := Approve(db, request.ID, "admin"); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("Expected a non-empty account to be refused, got %v", err)
+	}
+
+	db.WithdrawUserCoins("erin", 60)
+	approved, err := Approve(db, request.ID, "admin")
+	if err != nil {
+		t.Fatalf("Failed to approve deletion: %v", err)
+	}
+	var pseudonym string = approved.Username
+	if approved.Status != StatusCompleted || !strings.HasPrefix(pseudonym, "deleted-") {
+		t.Fatalf("Expected a completed request naming the pseudonym, got %+v", approved)
+	}
+
+	if _, err := db.GetUserCoins("erin"); db.GetUserLoginDetails("erin") != nil || !errors.Is(err, tools.ErrUserNotFound) {
+		t.Errorf("Expected the username to be gone")
+	}
+	if db.GetUserLoginDetails(pseudonym) != nil {
+		t.Errorf("Expected the pseudonym to have no login")
+	}
+
+	// Frank's history still shows the transfer, from the pseudonym
+	var history = db.GetTransactionHistory("frank")
+	if len(history) != 1 || history[0].From != pseudonym {
+		t.Errorf("Expected frank's transfer from %s, got %+v", pseudonym, history)
+	}
+
+	var sums = map[string]int64{}
+	for _, posting := range db.GetPostings() {
+		if posting.Account == "erin" {
+			t.Errorf("Expected postings to be pseudonymized, got %+v", posting)
+		}
+		sums[posting.TransactionID] += posting.Amount
+	}
+	for id, sum := range sums {
+		if sum != 0 {
+			t.Errorf("Expected transaction %s to still balance, sums to %d", id, sum)
+		}
+	}
+
+	if profile, _ := profiles.Get(db, "erin"); profile.Timezone != "UTC" {
+		t.Errorf("Expected the profile to be deleted")
+	}
+	if names, _ := contacts.Nicknames(db, "frank"); names["erin"] != "" {
+		t.Errorf("Expected frank's contact naming erin to be deleted")
+	}
+	if len(events.About(db, "erin")) != 0 || len(events.About(db, pseudonym)) < 2 {
+		t.Errorf("Expected erin's events to name the pseudonym instead")
+	}
+
+	if _, err := Reject(db, request.ID, "admin", "too late"); !errors.Is(err, ErrNotPending) {
+		t.Errorf("Expected a decided request to stay decided, got %v", err)
+	}
+}
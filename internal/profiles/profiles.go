@@ -0,0 +1,177 @@
+package profiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	// Timezone names must resolve even where the host has no zoneinfo
+	_ "time/tzdata"
+
+	"github.com/bryantjandra/goapi/internal/locales"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+var ErrInvalidProfile = errors.New("invalid profile")
+
+// Per-user settings
+type Profile struct {
+	// IANA name such as Europe/Berlin, day boundaries for the user fall at its midnight
+	Timezone string
+
+	// Opted in to appearing on the public leaderboard
+	Leaderboard bool
+
+	// BCP 47 tag such as de-DE for messages and display formatting, empty until chosen
+	Locale string
+
+	UpdatedAt time.Time
+}
+
+// Record kind profiles are kept as, the ID and Account are the username, so settings
+// last as long as the account and every instance sees the same ones
+const recordKind = "profile"
+
+var mu sync.Mutex
+
+// Get returns the user's profile, UTC when they never set a timezone
+func Get(database tools.DatabaseInterface, username string) (Profile, error) {
+	record, err := database.GetRecord(recordKind, username)
+	if errors.Is(err, tools.ErrRecordNotFound) {
+		return Profile{Timezone: "UTC"}, nil
+	}
+	if err != nil {
+		return Profile{}, err
+	}
+
+	var profile Profile
+	err = json.Unmarshal(record.Data, &profile)
+	if err != nil {
+		return Profile{}, fmt.Errorf("profile of %s: %w", username, err)
+	}
+	return profile, nil
+}
+
+// update applies change to the user's stored profile and saves it
+func update(database tools.DatabaseInterface, username string, change func(*Profile)) (Profile, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	profile, err := Get(database, username)
+	if err != nil {
+		return Profile{}, err
+	}
+	change(&profile)
+	profile.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return Profile{}, err
+	}
+	err = database.PutRecord(tools.Record{Kind: recordKind, ID: username, Account: username, Data: data, UpdatedAt: profile.UpdatedAt})
+	if err != nil {
+		return Profile{}, err
+	}
+	return profile, nil
+}
+
+// SetTimezone stores the user's timezone after checking it is a known IANA name
+func SetTimezone(database tools.DatabaseInterface, username string, timezone string) (Profile, error) {
+	if timezone == "" || timezone == "Local" {
+		return Profile{}, fmt.Errorf("%w: timezone must be an IANA name such as Europe/Berlin", ErrInvalidProfile)
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return Profile{}, fmt.Errorf("%w: unknown timezone %q", ErrInvalidProfile, timezone)
+	}
+
+	return update(database, username, func(profile *Profile) {
+		profile.Timezone = timezone
+	})
+}
+
+// SetLocale stores the user's locale, one of locales.Tags
+func SetLocale(database tools.DatabaseInterface, username string, tag string) (Profile, error) {
+	locale, ok := locales.Lookup(tag)
+	if !ok {
+		return Profile{}, fmt.Errorf("%w: unsupported locale %q, use one of %s", ErrInvalidProfile, tag, strings.Join(locales.Tags(), ", "))
+	}
+
+	return update(database, username, func(profile *Profile) {
+		profile.Locale = locale.Tag
+	})
+}
+
+// SetLeaderboard opts the user in to or out of the public leaderboard
+func SetLeaderboard(database tools.DatabaseInterface, username string, optIn bool) (Profile, error) {
+	return update(database, username, func(profile *Profile) {
+		profile.Leaderboard = optIn
+	})
+}
+
+// LeaderboardOptIns lists the users who opted in to the leaderboard, sorted
+func LeaderboardOptIns(database tools.DatabaseInterface) ([]string, error) {
+	records, err := database.ListRecords(recordKind, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var usernames []string
+	for _, record := range records {
+		var profile Profile
+		err = json.Unmarshal(record.Data, &profile)
+		if err != nil {
+			return nil, fmt.Errorf("profile of %s: %w", record.ID, err)
+		}
+		if profile.Leaderboard {
+			usernames = append(usernames, record.ID)
+		}
+	}
+	sort.Strings(usernames)
+	return usernames, nil
+}
+
+// Locale is the user's locale tag, empty when unset or the profile can't be read
+func Locale(database tools.DatabaseInterface, username string) string {
+	profile, err := Get(database, username)
+	if err != nil {
+		return ""
+	}
+	return profile.Locale
+}
+
+// Location is the profile's timezone, UTC when unset
+func (p Profile) Location() *time.Location {
+	location, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Location is the user's timezone, UTC when unset or the profile can't be read
+func Location(database tools.DatabaseInterface, username string) *time.Location {
+	profile, err := Get(database, username)
+	if err != nil {
+		return time.UTC
+	}
+	return profile.Location()
+}
+
+// StartOfDay is midnight of t's calendar day in the user's timezone
+func StartOfDay(database tools.DatabaseInterface, username string, t time.Time) time.Time {
+	local := t.In(Location(database, username))
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+}
+
+// Delete forgets the user's profile
+func Delete(database tools.DatabaseInterface, username string) error {
+	err := database.DeleteRecord(recordKind, username)
+	if errors.Is(err, tools.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
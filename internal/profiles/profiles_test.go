@@ -0,0 +1,76 @@
+package profiles
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+func TestTimezone(t *testing.T) {
+	database := toolstest.New(t, nil)
+
+	t.Run("Defaults_To_UTC", func(t *testing.T) {
+		var at = time.Date(2026, 3, 10, 1, 30, 0, 0, time.UTC)
+		if got := StartOfDay(database, "nobody", at); !got.Equal(time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("Expected UTC midnight, got %s", got)
+		}
+	})
+
+	t.Run("Day_Boundary_In_User_Timezone", func(t *testing.T) {
+		if _, err := SetTimezone(database, "tokyo_user", "Asia/Tokyo"); err != nil {
+			t.Fatalf("SetTimezone failed: %v", err)
+		}
+
+		// 20:00 UTC on the 10th is already the 11th in Tokyo, whose day began at 15:00 UTC
+		var at = time.Date(2026, 3, 10, 20, 0, 0, 0, time.UTC)
+		if got := StartOfDay(database, "tokyo_user", at); !got.Equal(time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)) {
+			t.Errorf("Expected Tokyo midnight at 15:00 UTC, got %s", got.UTC())
+		}
+	})
+
+	t.Run("DST_Day", func(t *testing.T) {
+		SetTimezone(database, "ny_user", "America/New_York")
+
+		// Clocks spring forward on 2026-03-08, midnight is still EST (UTC-5)
+		var at = time.Date(2026, 3, 8, 23, 0, 0, 0, time.UTC)
+		if got := StartOfDay(database, "ny_user", at); !got.Equal(time.Date(2026, 3, 8, 5, 0, 0, 0, time.UTC)) {
+			t.Errorf("Expected 05:00 UTC, got %s", got.UTC())
+		}
+	})
+
+	t.Run("Unknown_Timezone_Rejected", func(t *testing.T) {
+		for _, timezone := range []string{"", "Local", "Mars/Olympus"} {
+			if _, err := SetTimezone(database, "aaron", timezone); !errors.Is(err, ErrInvalidProfile) {
+				t.Errorf("Expected %q to be rejected, got %v", timezone, err)
+			}
+		}
+	})
+}
+
+func TestSetLocale(t *testing.T) {
+	database := toolstest.New(t, nil)
+
+	profile, err := SetLocale(database, "locale_user", "de_de")
+	if err != nil {
+		t.Fatalf("SetLocale failed: %v", err)
+	}
+	if profile.Locale != "de-DE" || profile.Timezone != "UTC" {
+		t.Errorf("Expected the canonical tag and a UTC default, got %+v", profile)
+	}
+	if _, err := SetLocale(database, "locale_user", "tlh"); !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("Expected an unsupported locale to be rejected, got %v", err)
+	}
+
+	// Kept in storage, so every instance reads the same profile
+	if stored, err := Get(database, "locale_user"); err != nil || stored.Locale != "de-DE" {
+		t.Errorf("Expected the stored profile to have the locale, got %+v: %v", stored, err)
+	}
+	if err := Delete(database, "locale_user"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if stored, _ := Get(database, "locale_user"); stored.Locale != "" || stored.Timezone != "UTC" {
+		t.Errorf("Expected the default profile after Delete, got %+v", stored)
+	}
+}
@@ -0,0 +1,96 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+// Header carrying Message.ID. JetStream drops a message whose Nats-Msg-Id it has seen.
+const (
+	kafkaIDHeader = "event-id"
+	natsIDHeader  = "Nats-Msg-Id"
+)
+
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// NewKafka publishes to the Kafka cluster the brokers belong to. Every replica has to
+// acknowledge a message before it counts as delivered. Topics are not created.
+func NewKafka(brokers []string) Publisher {
+	return &kafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+
+		// The relay already batches, waiting for more would only add latency
+		BatchTimeout: 10 * time.Millisecond,
+	}}
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, messages []Message) error {
+	var batch = make([]kafka.Message, len(messages))
+	for i, message := range messages {
+		batch[i] = kafka.Message{
+			Topic:   message.Topic,
+			Key:     []byte(message.Key),
+			Value:   message.Payload,
+			Headers: []kafka.Header{{Key: kafkaIDHeader, Value: []byte(message.ID)}},
+		}
+	}
+	return p.writer.WriteMessages(ctx, batch...)
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+type natsPublisher struct {
+	conn *nats.Conn
+}
+
+// NewNATS publishes to the NATS servers at urls. A server that is down at startup is
+// retried in the background like a lost connection.
+func NewNATS(urls []string) (Publisher, error) {
+	conn, err := nats.Connect(strings.Join(urls, ","),
+		nats.Name("goapi"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+
+		// Fail publishes while disconnected, the outbox keeps them instead
+		nats.ReconnectBufSize(-1),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to nats: %w", err)
+	}
+	return &natsPublisher{conn: conn}, nil
+}
+
+// Publish returns once the server has the messages. Core NATS keeps nothing, capture the
+// subjects in a JetStream stream for consumers that can be offline.
+func (p *natsPublisher) Publish(ctx context.Context, messages []Message) error {
+	if !p.conn.IsConnected() {
+		return nats.ErrConnectionReconnecting
+	}
+	for _, message := range messages {
+		var msg = nats.NewMsg(message.Topic)
+		msg.Data = message.Payload
+		msg.Header.Set(natsIDHeader, message.ID)
+
+		err := p.conn.PublishMsg(msg)
+		if err != nil {
+			return err
+		}
+	}
+	return p.conn.FlushWithContext(ctx)
+}
+
+func (p *natsPublisher) Close() error {
+	p.conn.Close()
+	return nil
+}
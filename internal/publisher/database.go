@@ -0,0 +1,166 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// database adds an event to the outbox for every ledger operation inner completes.
+// Reads, tokens and co-owners pass straight through.
+type database struct {
+	tools.DatabaseInterface
+	outbox Outbox
+	topics Topics
+}
+
+// Wrap returns inner with its successful operations published through outbox. The
+// outbox write isn't part of the operation, if it fails the operation still stands
+// and only its event is lost.
+func Wrap(inner tools.DatabaseInterface, outbox Outbox, topics Topics) tools.DatabaseInterface {
+	return &database{DatabaseInterface: inner, outbox: outbox, topics: topics}
+}
+
+func (d *database) record(event Event, key string) {
+	event.ID = newID()
+	event.Currency = api.Currency
+	event.OccurredAt = time.Now().UTC()
+
+	payload, err := json.Marshal(event)
+	if err == nil {
+		err = d.outbox.Add(Message{ID: event.ID, Topic: d.topics.For(event.Type), Key: key, Payload: payload}, event.OccurredAt)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"type": event.Type, "key": key}).Error("Event lost, failed to add it to the outbox: ", err)
+	}
+}
+
+func (d *database) CreateUser(login tools.LoginDetails) (*tools.CoinDetails, error) {
+	details, err := d.DatabaseInterface.CreateUser(login)
+	if err == nil {
+		d.record(Event{Type: TypeAccountCreated, To: details.Username, ToBalance: details.Coins}, details.Username)
+	}
+	return details, err
+}
+
+func (d *database) DeleteUser(username string) error {
+	err := d.DatabaseInterface.DeleteUser(username)
+	if err == nil {
+		d.record(Event{Type: TypeAccountDeleted, From: username}, username)
+	}
+	return err
+}
+
+func (d *database) AddUserCoins(username string, amount int64) (*tools.CoinDetails, error) {
+	details, err := d.DatabaseInterface.AddUserCoins(username, amount)
+	if err == nil {
+		d.record(Event{
+			Type:          TypeDeposit,
+			TransactionID: details.TransactionID,
+			From:          tools.MintAccount,
+			To:            username,
+			Amount:        amount,
+			ToBalance:     details.Coins,
+		}, username)
+	}
+	return details, err
+}
+
+func (d *database) WithdrawUserCoins(username string, amount int64) (*tools.CoinDetails, error) {
+	details, err := d.DatabaseInterface.WithdrawUserCoins(username, amount)
+	if err == nil {
+		d.record(Event{
+			Type:          TypeWithdrawal,
+			TransactionID: details.TransactionID,
+			From:          username,
+			To:            tools.BurnAccount,
+			Amount:        amount,
+			FromBalance:   details.Coins,
+		}, username)
+	}
+	return details, err
+}
+
+func (d *database) recordTransfer(from string, to string, amount int64, fromDetails *tools.CoinDetails, toDetails *tools.CoinDetails) {
+	d.record(Event{
+		Type:          TypeTransfer,
+		TransactionID: fromDetails.TransactionID,
+		From:          from,
+		To:            to,
+		Amount:        amount,
+		FromBalance:   fromDetails.Coins,
+		ToBalance:     toDetails.Coins,
+	}, from)
+}
+
+func (d *database) TransferUserCoins(from string, to string, amount int64) (*tools.CoinDetails, *tools.CoinDetails) {
+	fromDetails, toDetails := d.DatabaseInterface.TransferUserCoins(from, to, amount)
+	if fromDetails != nil && toDetails != nil {
+		d.recordTransfer(from, to, amount, fromDetails, toDetails)
+	}
+	return fromDetails, toDetails
+}
+
+func (d *database) TransferUserCoinsWithContext(ctx context.Context, from string, to string, amount int64) (*tools.CoinDetails, *tools.CoinDetails, error) {
+	fromDetails, toDetails, err := d.DatabaseInterface.TransferUserCoinsWithContext(ctx, from, to, amount)
+	if err == nil {
+		d.recordTransfer(from, to, amount, fromDetails, toDetails)
+	}
+	return fromDetails, toDetails, err
+}
+
+// CaptureHold records a transfer, or a withdrawal when the hold paid no one
+func (d *database) CaptureHold(ctx context.Context, id string, to string, amount int64) (*tools.CoinDetails, *tools.CoinDetails, error) {
+	fromDetails, toDetails, err := d.DatabaseInterface.CaptureHold(ctx, id, to, amount)
+	switch {
+	case err != nil:
+	case toDetails == nil:
+		d.record(Event{
+			Type:          TypeWithdrawal,
+			TransactionID: fromDetails.TransactionID,
+			From:          fromDetails.Username,
+			To:            tools.BurnAccount,
+			Amount:        amount,
+			FromBalance:   fromDetails.Coins,
+		}, fromDetails.Username)
+	default:
+		d.recordTransfer(fromDetails.Username, to, amount, fromDetails, toDetails)
+	}
+	return fromDetails, toDetails, err
+}
+
+func (d *database) CorrectUserCoins(username string, version int64, balance int64) (*tools.CoinDetails, error) {
+	details, err := d.DatabaseInterface.CorrectUserCoins(username, version, balance)
+	if err == nil {
+		d.record(Event{
+			Type:          TypeCorrection,
+			TransactionID: details.TransactionID,
+			To:            username,
+			ToBalance:     details.Coins,
+		}, username)
+	}
+	return details, err
+}
+
+func (d *database) GetSystemHealth() map[string]interface{} {
+	health := d.DatabaseInterface.GetSystemHealth()
+	if outbox := Health(); health != nil && outbox != nil {
+		health["event_outbox"] = outbox
+	}
+	return health
+}
+
+func (d *database) Subscribe(username string) (<-chan tools.TransactionLog, func()) {
+	return tools.Subscribe(d.DatabaseInterface, username)
+}
+
+// Capabilities are inner's, except the wrapper itself can't be snapshotted
+func (d *database) Capabilities() tools.Capabilities {
+	capabilities := d.DatabaseInterface.Capabilities()
+	capabilities.Snapshots = false
+	return capabilities
+}
@@ -0,0 +1,246 @@
+package publisher
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// Entry is a message waiting in an outbox, Seq orders it
+type Entry struct {
+	Seq       int64
+	Message   Message
+	CreatedAt time.Time
+}
+
+// Outbox keeps messages until the broker has them
+type Outbox interface {
+	// Add keeps message until it is delivered
+	Add(message Message, now time.Time) error
+
+	// Pending returns up to limit entries, oldest first
+	Pending(limit int) ([]Entry, error)
+
+	// Delivered removes the entries with these sequence numbers
+	Delivered(seqs []int64) error
+
+	Len() (int, error)
+}
+
+// OpenOutbox returns the configured outbox: the event_outbox table with the mysql
+// driver, otherwise the EventOutboxFile, or memory when that is empty
+func OpenOutbox(cfg config.Config) (Outbox, error) {
+	if cfg.DatabaseDriver == config.DriverMySQL {
+		pool, ok := tools.MySQLPool(cfg.DatabaseDSN)
+		if !ok {
+			return nil, errors.New("the event outbox needs the mysql database set up first")
+		}
+		return NewMySQLOutbox(pool), nil
+	}
+	if cfg.EventOutboxFile != "" {
+		return OpenFileOutbox(cfg.EventOutboxFile)
+	}
+	return NewMemoryOutbox(), nil
+}
+
+type memoryOutbox struct {
+	mu      sync.Mutex
+	entries []Entry
+	nextSeq int64
+}
+
+// NewMemoryOutbox keeps messages in memory, a restart loses any not yet delivered
+func NewMemoryOutbox() Outbox {
+	return &memoryOutbox{nextSeq: 1}
+}
+
+func (o *memoryOutbox) Add(message Message, now time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.addLocked(Entry{Seq: o.nextSeq, Message: message, CreatedAt: now})
+	return nil
+}
+
+func (o *memoryOutbox) addLocked(entry Entry) {
+	o.entries = append(o.entries, entry)
+	o.nextSeq = entry.Seq + 1
+}
+
+func (o *memoryOutbox) Pending(limit int) ([]Entry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var count int = min(limit, len(o.entries))
+	return append([]Entry(nil), o.entries[:count]...), nil
+}
+
+func (o *memoryOutbox) Delivered(seqs []int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.deliveredLocked(seqs)
+	return nil
+}
+
+func (o *memoryOutbox) deliveredLocked(seqs []int64) {
+	var kept []Entry
+	for _, entry := range o.entries {
+		if !slices.Contains(seqs, entry.Seq) {
+			kept = append(kept, entry)
+		}
+	}
+	o.entries = kept
+}
+
+func (o *memoryOutbox) Len() (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries), nil
+}
+
+// fileRecord is one line of an outbox file, either a new entry or a delivery
+type fileRecord struct {
+	Entry     *Entry  `json:",omitempty"`
+	Delivered []int64 `json:",omitempty"`
+}
+
+// fileOutbox keeps its entries in memory and appends every change to a file, which is
+// replayed on startup, emptied whenever everything has been delivered and rewritten
+// with only what is pending by Compact
+type fileOutbox struct {
+	memoryOutbox
+	path string
+	file *os.File
+}
+
+// OpenFileOutbox keeps messages in the file at path, creating it if needed, so the ones
+// not yet delivered survive a restart
+func OpenFileOutbox(path string) (Outbox, error) {
+	var outbox = &fileOutbox{memoryOutbox: memoryOutbox{nextSeq: 1}, path: path}
+
+	contents, err := os.Open(path)
+	if err == nil {
+		var scanner = bufio.NewScanner(contents)
+		scanner.Buffer(nil, 16*1024*1024)
+		for scanner.Scan() {
+			var record fileRecord
+			err = json.Unmarshal(scanner.Bytes(), &record)
+			if err != nil {
+				// A crash can leave the last line half written
+				break
+			}
+			if record.Entry != nil {
+				outbox.addLocked(*record.Entry)
+			} else {
+				outbox.deliveredLocked(record.Delivered)
+			}
+		}
+		contents.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading event outbox: %w", err)
+	}
+
+	err = outbox.rewriteLocked()
+	if err != nil {
+		return nil, err
+	}
+	return outbox, nil
+}
+
+// rewriteLocked replaces the file with only what is still pending, then appends from
+// there. The old file stays in place until the new one is complete.
+func (o *fileOutbox) rewriteLocked() error {
+	var tmp string = filepath.Join(filepath.Dir(o.path), "."+filepath.Base(o.path)+".tmp")
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("writing event outbox: %w", err)
+	}
+	var previous *os.File = o.file
+	o.file = file
+	for i := range o.entries {
+		err = o.appendLocked(fileRecord{Entry: &o.entries[i]})
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp, o.path)
+	}
+	if err != nil {
+		file.Close()
+		o.file = previous
+		return fmt.Errorf("writing event outbox: %w", err)
+	}
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// Compact rewrites the file with only the entries not yet delivered, dropping the
+// delivered ones and their delivery records. Returns the file's size in bytes before
+// and after.
+func (o *fileOutbox) Compact() (int64, int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	info, err := o.file.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("compacting event outbox: %w", err)
+	}
+	err = o.rewriteLocked()
+	if err != nil {
+		return info.Size(), info.Size(), err
+	}
+	compacted, err := o.file.Stat()
+	if err != nil {
+		return info.Size(), 0, fmt.Errorf("compacting event outbox: %w", err)
+	}
+	return info.Size(), compacted.Size(), nil
+}
+
+func (o *fileOutbox) appendLocked(record fileRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = o.file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	return o.file.Sync()
+}
+
+func (o *fileOutbox) Add(message Message, now time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var entry = Entry{Seq: o.nextSeq, Message: message, CreatedAt: now}
+	err := o.appendLocked(fileRecord{Entry: &entry})
+	if err != nil {
+		return err
+	}
+	o.addLocked(entry)
+	return nil
+}
+
+func (o *fileOutbox) Delivered(seqs []int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.deliveredLocked(seqs)
+	if len(o.entries) == 0 {
+		return o.file.Truncate(0)
+	}
+	return o.appendLocked(fileRecord{Delivered: seqs})
+}
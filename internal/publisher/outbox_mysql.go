@@ -0,0 +1,63 @@
+package publisher
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type mysqlOutbox struct {
+	db *sql.DB
+}
+
+// NewMySQLOutbox keeps messages in the event_outbox table, which the MySQL backend's
+// migrations create
+func NewMySQLOutbox(db *sql.DB) Outbox {
+	return &mysqlOutbox{db: db}
+}
+
+func (o *mysqlOutbox) Add(message Message, now time.Time) error {
+	_, err := o.db.Exec("INSERT INTO event_outbox (event_id, topic, event_key, payload, created_at) VALUES (?, ?, ?, ?, ?)",
+		message.ID, message.Topic, message.Key, message.Payload, now.UTC())
+	return err
+}
+
+func (o *mysqlOutbox) Pending(limit int) ([]Entry, error) {
+	rows, err := o.db.Query("SELECT seq, event_id, topic, event_key, payload, created_at FROM event_outbox ORDER BY seq LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		err = rows.Scan(&entry.Seq, &entry.Message.ID, &entry.Message.Topic, &entry.Message.Key, &entry.Message.Payload, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Delivered deletes exactly the rows sent. A row with a lower seq can still be
+// committing when later ones are read, deleting everything up to seq would lose it.
+func (o *mysqlOutbox) Delivered(seqs []int64) error {
+	if len(seqs) == 0 {
+		return nil
+	}
+	var placeholders = strings.Repeat(",?", len(seqs))[1:]
+	var args = make([]interface{}, len(seqs))
+	for i, seq := range seqs {
+		args[i] = seq
+	}
+	_, err := o.db.Exec("DELETE FROM event_outbox WHERE seq IN ("+placeholders+")", args...)
+	return err
+}
+
+func (o *mysqlOutbox) Len() (int, error) {
+	var count int
+	err := o.db.QueryRow("SELECT COUNT(*) FROM event_outbox").Scan(&count)
+	return count, err
+}
@@ -0,0 +1,113 @@
+// Package publisher streams every successful ledger operation to a message broker. The
+// database wrapper writes each operation to an outbox as it completes, and Relay moves
+// them on to Kafka or NATS, so while the broker is down events wait instead of being lost.
+package publisher
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+)
+
+var (
+	ErrUnknownPublisher = errors.New("unknown event publisher")
+	ErrUnknownEventType = errors.New("unknown event type")
+)
+
+// Event types, one per kind of ledger operation
+const (
+	TypeAccountCreated = "account_created"
+	TypeDeposit        = "deposit"
+	TypeWithdrawal     = "withdrawal"
+	TypeTransfer       = "transfer"
+	TypeCorrection     = "correction"
+	TypeAccountDeleted = "account_deleted"
+)
+
+// Types lists every event type, for validating topic overrides
+var Types = []string{TypeAccountCreated, TypeDeposit, TypeWithdrawal, TypeTransfer, TypeCorrection, TypeAccountDeleted}
+
+// Event is what the broker receives, JSON encoded. Deposits come from
+// storage.MintAccount and withdrawals go to storage.BurnAccount, as in the ledger.
+// A correction only sets ToBalance, and a deleted account only From. Amount and the
+// balances are minor units of Currency.
+type Event struct {
+	// Unique per event. A batch the broker may have half taken is sent again, so
+	// consumers should drop IDs they have already seen.
+	ID            string
+	Type          string
+	TransactionID string
+	From          string
+	To            string
+	Amount        int64
+	FromBalance   int64
+	ToBalance     int64
+	Currency      string
+	OccurredAt    time.Time
+}
+
+// Message is one event ready for the broker. Key is the account the event is about, the
+// sender for a transfer, so a broker partitioning by key keeps each account's events in order.
+type Message struct {
+	ID      string
+	Topic   string
+	Key     string
+	Payload []byte
+}
+
+// Publisher delivers messages to a broker
+type Publisher interface {
+	// Publish returns once the broker has every message, in order. After an error some
+	// may have arrived anyway, they are sent again with the rest.
+	Publish(ctx context.Context, messages []Message) error
+	Close() error
+}
+
+// Topics picks the topic, or NATS subject, for each event type
+type Topics struct {
+	Default string
+	ByType  map[string]string
+}
+
+// For returns eventType's topic
+func (t Topics) For(eventType string) string {
+	if topic, ok := t.ByType[eventType]; ok {
+		return topic
+	}
+	return t.Default
+}
+
+// TopicsFor returns the configured topics, refusing overrides for types that don't exist
+func TopicsFor(cfg config.Config) (Topics, error) {
+	for eventType := range cfg.EventTopics {
+		if !slices.Contains(Types, eventType) {
+			return Topics{}, fmt.Errorf("%w %q in EVENT_TOPICS, expected one of %v", ErrUnknownEventType, eventType, Types)
+		}
+	}
+	return Topics{Default: cfg.EventTopic, ByType: cfg.EventTopics}, nil
+}
+
+// Open connects the configured publisher, nil when publishing is off
+func Open(cfg config.Config) (Publisher, error) {
+	switch cfg.EventPublisher {
+	case config.EventPublisherNone:
+		return nil, nil
+	case config.EventPublisherKafka:
+		return NewKafka(cfg.EventBrokers), nil
+	case config.EventPublisherNATS:
+		return NewNATS(cfg.EventBrokers)
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownPublisher, cfg.EventPublisher)
+}
+
+func newID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,195 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+// fakeBroker keeps what it was sent, or refuses everything while down
+type fakeBroker struct {
+	down     bool
+	received []Message
+}
+
+func (b *fakeBroker) Publish(ctx context.Context, messages []Message) error {
+	if b.down {
+		return errors.New("broker unreachable")
+	}
+	b.received = append(b.received, messages...)
+	return nil
+}
+
+func (b *fakeBroker) Close() error {
+	return nil
+}
+
+func newTestDatabase(t *testing.T, outbox Outbox) tools.DatabaseInterface {
+	return Wrap(toolstest.New(t, nil), outbox, Topics{Default: "goapi.transactions", ByType: map[string]string{TypeTransfer: "goapi.transfers"}})
+}
+
+func decode(t *testing.T, message Message) Event {
+	var event Event
+	err := json.Unmarshal(message.Payload, &event)
+	if err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if event.ID != message.ID {
+		t.Errorf("Expected the message ID %s to be the event's, got %s", message.ID, event.ID)
+	}
+	return event
+}
+
+func TestPublisher(t *testing.T) {
+	t.Run("Successful_Operations_Fill_The_Outbox", func(t *testing.T) {
+		var outbox = NewMemoryOutbox()
+		database := newTestDatabase(t, outbox)
+
+		database.AddUserCoins("aaron", 50)
+		database.TransferUserCoins("aaron", "bryan", 30)
+		database.WithdrawUserCoins("bryan", 10)
+
+		// Refused operations leave nothing to publish
+		database.TransferUserCoins("aaron", "bryan", 1000000)
+		database.WithdrawUserCoins("aaron", -1)
+
+		entries, _ := outbox.Pending(10)
+		if len(entries) != 3 {
+			t.Fatalf("Expected 3 events, got %d", len(entries))
+		}
+
+		deposit := decode(t, entries[0].Message)
+		if deposit.Type != TypeDeposit || deposit.From != tools.MintAccount || deposit.To != "aaron" || deposit.Amount != 50 || deposit.ToBalance != 1050 {
+			t.Errorf("Unexpected deposit %+v", deposit)
+		}
+
+		transfer := decode(t, entries[1].Message)
+		if transfer.Type != TypeTransfer || transfer.TransactionID == "" || transfer.FromBalance != 1020 || transfer.ToBalance != 1030 {
+			t.Errorf("Unexpected transfer %+v", transfer)
+		}
+		if entries[1].Message.Topic != "goapi.transfers" || entries[1].Message.Key != "aaron" {
+			t.Errorf("Expected the transfer on its own topic keyed by the sender, got %+v", entries[1].Message)
+		}
+
+		withdrawal := decode(t, entries[2].Message)
+		if withdrawal.Type != TypeWithdrawal || withdrawal.To != tools.BurnAccount || withdrawal.FromBalance != 1020 {
+			t.Errorf("Unexpected withdrawal %+v", withdrawal)
+		}
+		if entries[2].Message.Topic != "goapi.transactions" {
+			t.Errorf("Expected the default topic, got %s", entries[2].Message.Topic)
+		}
+	})
+
+	t.Run("Events_Wait_Out_A_Broker_That_Is_Down", func(t *testing.T) {
+		var outbox = NewMemoryOutbox()
+		database := newTestDatabase(t, outbox)
+		var broker = &fakeBroker{down: true}
+
+		for i := 0; i < batchSize+5; i++ {
+			database.AddUserCoins("aaron", 1)
+		}
+
+		sent, err := Flush(context.Background(), outbox, broker)
+		if err == nil || sent != 0 {
+			t.Fatalf("Expected nothing sent while the broker is down, got %d, %v", sent, err)
+		}
+		if pending, _ := outbox.Len(); pending != batchSize+5 {
+			t.Fatalf("Expected every event kept, got %d", pending)
+		}
+
+		broker.down = false
+		sent, err = Flush(context.Background(), outbox, broker)
+		if err != nil || sent != batchSize+5 {
+			t.Fatalf("Expected every event sent once the broker is back, got %d, %v", sent, err)
+		}
+		if pending, _ := outbox.Len(); pending != 0 {
+			t.Errorf("Expected an empty outbox, got %d", pending)
+		}
+		for i, message := range broker.received {
+			if event := decode(t, message); event.ToBalance != int64(1001+i) {
+				t.Fatalf("Expected events in order, event %d has balance %d", i, event.ToBalance)
+			}
+		}
+	})
+
+	t.Run("File_Outbox_Survives_A_Restart", func(t *testing.T) {
+		var path = filepath.Join(t.TempDir(), "outbox.jsonl")
+		var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+		outbox, err := OpenFileOutbox(path)
+		if err != nil {
+			t.Fatalf("Failed to open outbox: %v", err)
+		}
+		for _, id := range []string{"a", "b", "c"} {
+			outbox.Add(Message{ID: id, Topic: "goapi.transactions", Key: "aaron", Payload: []byte(`{}`)}, now)
+		}
+		entries, _ := outbox.Pending(1)
+		outbox.Delivered([]int64{entries[0].Seq})
+
+		reopened, err := OpenFileOutbox(path)
+		if err != nil {
+			t.Fatalf("Failed to reopen outbox: %v", err)
+		}
+		entries, _ = reopened.Pending(10)
+		if len(entries) != 2 || entries[0].Message.ID != "b" || entries[1].Message.ID != "c" {
+			t.Fatalf("Expected b and c still pending, got %+v", entries)
+		}
+
+		// New entries carry on after the ones kept
+		reopened.Add(Message{ID: "d", Topic: "goapi.transactions", Key: "aaron", Payload: []byte(`{}`)}, now)
+		entries, _ = reopened.Pending(10)
+		if len(entries) != 3 || entries[2].Seq <= entries[1].Seq {
+			t.Fatalf("Expected d after c, got %+v", entries)
+		}
+
+		reopened.Delivered([]int64{entries[0].Seq, entries[1].Seq, entries[2].Seq})
+		reopened, err = OpenFileOutbox(path)
+		if err != nil {
+			t.Fatalf("Failed to reopen outbox: %v", err)
+		}
+		if pending, _ := reopened.Len(); pending != 0 {
+			t.Errorf("Expected nothing pending, got %d", pending)
+		}
+	})
+
+	t.Run("File_Outbox_Compacts_While_Open", func(t *testing.T) {
+		var path = filepath.Join(t.TempDir(), "outbox.jsonl")
+		var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+		opened, err := OpenFileOutbox(path)
+		if err != nil {
+			t.Fatalf("Failed to open outbox: %v", err)
+		}
+		var outbox = opened.(*fileOutbox)
+		// The first entry stays pending, so delivering the rest never empties the file
+		for i := 0; i < 50; i++ {
+			outbox.Add(Message{ID: fmt.Sprint(i), Topic: "goapi.transactions", Key: "aaron", Payload: []byte(`{}`)}, now)
+			entries, _ := outbox.Pending(2)
+			if i > 0 {
+				outbox.Delivered([]int64{entries[1].Seq})
+			}
+		}
+
+		before, after, err := outbox.Compact()
+		if err != nil || after >= before/10 {
+			t.Fatalf("Expected the file to shrink to the one pending entry, %d to %d bytes: %v", before, after, err)
+		}
+		outbox.Add(Message{ID: "50", Topic: "goapi.transactions", Key: "aaron", Payload: []byte(`{}`)}, now)
+
+		reopened, err := OpenFileOutbox(path)
+		if err != nil {
+			t.Fatalf("Failed to reopen outbox: %v", err)
+		}
+		entries, _ := reopened.Pending(10)
+		if len(entries) != 2 || entries[0].Message.ID != "0" || entries[1].Message.ID != "50" {
+			t.Fatalf("Expected 0 and 50 pending after compacting, got %+v", entries)
+		}
+	})
+}
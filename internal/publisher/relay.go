@@ -0,0 +1,211 @@
+package publisher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// Messages sent to the broker at a time
+const batchSize = 100
+
+// How long the broker gets to take one batch
+const publishTimeout = 10 * time.Second
+
+// relay is the outbox Start opened and the broker it is flushed to
+type relay struct {
+	outbox    Outbox
+	publisher Publisher
+
+	// Run and Stop never send the same entries at once
+	flushing sync.Mutex
+
+	published int64
+	failures  int64
+	lastError string
+	lastSent  time.Time
+}
+
+var (
+	mu      sync.Mutex
+	current *relay
+)
+
+// Flush sends everything in outbox to publisher, a batch at a time, oldest first. A
+// batch is only removed once the broker has it, so after an error it is sent again, and
+// nothing after it goes out first.
+func Flush(ctx context.Context, outbox Outbox, publisher Publisher) (int, error) {
+	var sent int
+	for {
+		entries, err := outbox.Pending(batchSize)
+		if err != nil || len(entries) == 0 {
+			return sent, err
+		}
+
+		var messages = make([]Message, len(entries))
+		var seqs = make([]int64, len(entries))
+		for i, entry := range entries {
+			messages[i] = entry.Message
+			seqs[i] = entry.Seq
+		}
+
+		publishCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+		err = publisher.Publish(publishCtx, messages)
+		cancel()
+		if err != nil {
+			return sent, err
+		}
+
+		err = outbox.Delivered(seqs)
+		if err != nil {
+			return sent, err
+		}
+		sent += len(entries)
+	}
+}
+
+// Start opens the configured publisher and outbox and returns inner wrapped to fill
+// the outbox. inner is returned as is when publishing is off.
+func Start(cfg config.Config, inner tools.DatabaseInterface) (tools.DatabaseInterface, error) {
+	broker, err := Open(cfg)
+	if err != nil || broker == nil {
+		return inner, err
+	}
+	topics, err := TopicsFor(cfg)
+	if err != nil {
+		broker.Close()
+		return nil, err
+	}
+	outbox, err := OpenOutbox(cfg)
+	if err != nil {
+		broker.Close()
+		return nil, err
+	}
+
+	mu.Lock()
+	current = &relay{outbox: outbox, publisher: broker}
+	mu.Unlock()
+
+	log.Info("Publishing events to ", cfg.EventPublisher, " at ", cfg.EventBrokers)
+	return Wrap(inner, outbox, topics), nil
+}
+
+// Compact rewrites the outbox file Start opened with only the events not yet
+// delivered, returning its size in bytes before and after. There is nothing to compact
+// unless events wait in an EventOutboxFile.
+func Compact() (int64, int64, error) {
+	var r *relay = started()
+	if r == nil {
+		return 0, 0, nil
+	}
+	outbox, ok := r.outbox.(*fileOutbox)
+	if !ok {
+		return 0, 0, nil
+	}
+	return outbox.Compact()
+}
+
+func started() *relay {
+	mu.Lock()
+	defer mu.Unlock()
+	return current
+}
+
+// Run flushes the outbox every tick until ctx is done. It returns at once if Start
+// didn't turn publishing on.
+func Run(ctx context.Context, tick time.Duration) {
+	var r *relay = started()
+	if r == nil {
+		return
+	}
+
+	var ticker = time.NewTicker(tick)
+	defer ticker.Stop()
+
+	var failing bool
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := r.flush(ctx)
+
+		// Log once per outage rather than every tick
+		if err != nil && !failing && ctx.Err() == nil {
+			pending, _ := r.outbox.Len()
+			log.Error("Event publishing failed, ", pending, " events are waiting in the outbox: ", err)
+		}
+		if err == nil && failing {
+			log.Info("Event publishing recovered")
+		}
+		failing = err != nil
+	}
+}
+
+// Stop makes one last flush, for the events of requests drained during shutdown, and
+// disconnects from the broker. Whatever is left stays in the outbox.
+func Stop() {
+	var r *relay = started()
+	if r == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	err := r.flush(ctx)
+	if err != nil {
+		pending, _ := r.outbox.Len()
+		log.Warn("Shutting down with ", pending, " events still in the outbox: ", err)
+	}
+	r.publisher.Close()
+}
+
+func (r *relay) flush(ctx context.Context) error {
+	r.flushing.Lock()
+	sent, err := Flush(ctx, r.outbox, r.publisher)
+	r.flushing.Unlock()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	r.published += int64(sent)
+	if sent > 0 {
+		r.lastSent = time.Now()
+	}
+	if err != nil {
+		r.failures++
+		r.lastError = err.Error()
+	}
+	return err
+}
+
+// Health reports what is waiting in the outbox and how flushing it has gone
+func Health() map[string]interface{} {
+	var r *relay = started()
+	if r == nil {
+		return nil
+	}
+	pending, err := r.outbox.Len()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var health = map[string]interface{}{
+		"pending":    pending,
+		"published":  r.published,
+		"failures":   r.failures,
+		"last_error": r.lastError,
+		"last_sent":  r.lastSent,
+	}
+	if err != nil {
+		health["pending_error"] = err.Error()
+	}
+	return health
+}
@@ -0,0 +1,99 @@
+package receipts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// HashVersion names the canonical form below, bump it if the fields ever change
+const HashVersion = "v1"
+
+var ErrNotATransfer = errors.New("transaction is not a completed transfer")
+
+type Receipt struct {
+	TransactionID string
+	From          string
+	To            string
+	Amount        int64
+	Timestamp     time.Time
+	HashVersion   string
+	ContentHash   string
+}
+
+// canonical is the text that gets hashed: one field per line, timestamp in UTC with
+// nanoseconds, so anyone holding the ledger entry can rebuild it exactly
+func canonical(tx tools.TransactionLog) string {
+	return strings.Join([]string{
+		HashVersion,
+		tx.ID,
+		tx.From,
+		tx.To,
+		fmt.Sprint(tx.Amount),
+		tx.Timestamp.UTC().Format(time.RFC3339Nano),
+	}, "\n")
+}
+
+// Hash returns the hex SHA-256 content hash of a ledger entry
+func Hash(tx tools.TransactionLog) string {
+	sum := sha256.Sum256([]byte(canonical(tx)))
+	return hex.EncodeToString(sum[:])
+}
+
+// FromTransaction builds the receipt for a successful transfer
+func FromTransaction(tx tools.TransactionLog) (Receipt, error) {
+	if tx.Type != "TRANSFER" || tx.Status != "SUCCESS" {
+		return Receipt{}, ErrNotATransfer
+	}
+
+	return Receipt{
+		TransactionID: tx.ID,
+		From:          tx.From,
+		To:            tx.To,
+		Amount:        tx.Amount,
+		Timestamp:     tx.Timestamp.UTC(),
+		HashVersion:   HashVersion,
+		ContentHash:   Hash(tx),
+	}, nil
+}
+
+// Verify reports whether a presented receipt matches the stored ledger entry
+func Verify(receipt Receipt, tx tools.TransactionLog) bool {
+	if receipt.HashVersion != HashVersion || receipt.TransactionID != tx.ID {
+		return false
+	}
+
+	var presented = tools.TransactionLog{
+		ID:        receipt.TransactionID,
+		From:      receipt.From,
+		To:        receipt.To,
+		Amount:    receipt.Amount,
+		Timestamp: receipt.Timestamp,
+	}
+	return Hash(presented) == Hash(tx) && receipt.ContentHash == Hash(tx)
+}
+
+// LatestTransfer finds the newest successful transfer from one party to another
+func LatestTransfer(history []tools.TransactionLog, from string, to string, amount int64) (tools.TransactionLog, bool) {
+	for i := len(history) - 1; i >= 0; i-- {
+		tx := history[i]
+		if tx.Type == "TRANSFER" && tx.Status == "SUCCESS" && tx.From == from && tx.To == to && tx.Amount == amount {
+			return tx, true
+		}
+	}
+	return tools.TransactionLog{}, false
+}
+
+// Find looks one of username's transactions up by ID, without reading their history
+func Find(database tools.DatabaseInterface, username string, id string) (tools.TransactionLog, bool) {
+	tx, ok := database.GetTransaction(id)
+	if !ok || (tx.From != username && tx.To != username) {
+		return tools.TransactionLog{}, false
+	}
+	return tx, true
+}
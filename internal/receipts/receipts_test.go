@@ -0,0 +1,53 @@
+package receipts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+func TestReceipts(t *testing.T) {
+	var tx = tools.TransactionLog{
+		ID:        "abc123",
+		Type:      "TRANSFER",
+		From:      "aaron",
+		To:        "bryan",
+		Amount:    50,
+		Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 6, time.FixedZone("WIB", 7*3600)),
+		Status:    "SUCCESS",
+	}
+
+	t.Run("Hash_Is_Reproducible", func(t *testing.T) {
+		receipt, err := FromTransaction(tx)
+		if err != nil {
+			t.Fatalf("Failed to build receipt: %v", err)
+		}
+
+		// Same instant in another zone must hash the same
+		var utc = tx
+		utc.Timestamp = tx.Timestamp.UTC()
+		if Hash(utc) != receipt.ContentHash {
+			t.Errorf("Hash changed with the timestamp's zone")
+		}
+		if !Verify(receipt, tx) {
+			t.Errorf("Receipt should verify against its own ledger entry")
+		}
+	})
+
+	t.Run("Tampered_Receipt_Fails", func(t *testing.T) {
+		receipt, _ := FromTransaction(tx)
+		receipt.Amount = 500
+		if Verify(receipt, tx) {
+			t.Errorf("Receipt with a changed amount must not verify")
+		}
+	})
+
+	t.Run("Only_Successful_Transfers", func(t *testing.T) {
+		var failed = tx
+		failed.Status = "FAILED_INSUFFICIENT_FUNDS"
+		if _, err := FromTransaction(failed); err != ErrNotATransfer {
+			t.Errorf("Expected ErrNotATransfer, got %v", err)
+		}
+	})
+}
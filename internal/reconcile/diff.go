@@ -0,0 +1,117 @@
+package reconcile
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// Reads of the balance and the ledger that keep racing a write give up after this many tries
+const diffAttempts = 3
+
+var ErrBusyAccount = errors.New("account kept changing while its audit diff was assembled, try again")
+
+// BalanceChange is one posting or correction on an account. Amount is signed, Balance
+// is the running balance after it.
+type BalanceChange struct {
+	TransactionID string
+	Type          string
+	Counterparty  string
+	Amount        int64
+	Balance       int64
+	Timestamp     time.Time
+}
+
+// Diff is how an account's balance got from StartBalance at From to EndBalance at To
+type Diff struct {
+	Username     string
+	From         time.Time
+	To           time.Time
+	StartBalance int64
+	EndBalance   int64
+	Net          int64
+	Changes      []BalanceChange
+}
+
+// AuditDiff itemizes every change to username's balance in [from, to], oldest first.
+// Balances are worked back from the stored balance, so opening balances that predate
+// the ledger still add up, and corrections count even though they have no postings.
+func AuditDiff(database tools.DatabaseInterface, username string, from time.Time, to time.Time) (Diff, error) {
+	for attempt := 0; attempt < diffAttempts; attempt++ {
+		details, err := database.GetUserCoins(username)
+		if err != nil {
+			return Diff{}, err
+		}
+		var changes []BalanceChange = accountChanges(database, username)
+
+		// A write between the reads would leave the balance and the changes out of step
+		after, err := database.GetUserCoins(username)
+		if err != nil {
+			return Diff{}, err
+		}
+		if after.Version != details.Version {
+			continue
+		}
+
+		var diff = Diff{Username: username, From: from, To: to, Changes: []BalanceChange{}}
+		var balance int64 = details.Coins
+		for i := len(changes) - 1; i >= 0 && !changes[i].Timestamp.Before(from); i-- {
+			balance -= changes[i].Amount
+		}
+
+		diff.StartBalance = balance
+		for _, change := range changes {
+			if change.Timestamp.Before(from) || change.Timestamp.After(to) {
+				continue
+			}
+			balance += change.Amount
+			change.Balance = balance
+			diff.Changes = append(diff.Changes, change)
+		}
+		diff.EndBalance = balance
+		diff.Net = diff.EndBalance - diff.StartBalance
+		return diff, nil
+	}
+	return Diff{}, ErrBusyAccount
+}
+
+// accountChanges joins username's postings to the audit log, adds its corrections, and
+// sorts them oldest first
+func accountChanges(database tools.DatabaseInterface, username string) []BalanceChange {
+	var logs = map[string]tools.TransactionLog{}
+	var changes []BalanceChange
+	for _, tx := range database.GetTransactionHistory(username) {
+		logs[tx.ID] = tx
+
+		if tx.Type == tools.CorrectionType && tx.Status == "SUCCESS" {
+			var amount int64 = tx.Amount
+			if tx.From == username {
+				amount = -amount
+			}
+			changes = append(changes, BalanceChange{TransactionID: tx.ID, Type: tx.Type, Amount: amount, Timestamp: tx.Timestamp})
+		}
+	}
+
+	for _, posting := range database.GetPostings() {
+		if posting.Account != username {
+			continue
+		}
+
+		var change = BalanceChange{TransactionID: posting.TransactionID, Amount: posting.Amount, Timestamp: posting.Timestamp}
+		if tx, ok := logs[posting.TransactionID]; ok {
+			change.Type = tx.Type
+			change.Counterparty = tx.To
+			if tx.To == username {
+				change.Counterparty = tx.From
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Timestamp.Before(changes[j].Timestamp)
+	})
+	return changes
+}
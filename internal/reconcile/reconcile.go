@@ -0,0 +1,264 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// Discrepancy kinds, stable strings for alerting rules
+const (
+	KindMissingPostings    = "missing_postings"
+	KindEntryCount         = "entry_count"
+	KindUnbalanced         = "unbalanced"
+	KindWrongAccounts      = "wrong_accounts"
+	KindAmountMismatch     = "amount_mismatch"
+	KindFailedWithPostings = "failed_with_postings"
+	KindCorrectionPostings = "correction_with_postings"
+	KindOrphanPostings     = "orphan_postings"
+	KindLedgerImbalance    = "ledger_imbalance"
+	KindNegativeBalance    = "negative_balance"
+	KindIncompleteScan     = "incomplete_scan"
+)
+
+type Discrepancy struct {
+	TransactionID string
+	Kind          string
+	Detail        string
+}
+
+// Machine-readable result of one reconciliation run
+type Report struct {
+	GeneratedAt         time.Time
+	TransactionsChecked int
+	PostingsChecked     int
+	AccountsChecked     int
+	Discrepancies       []Discrepancy
+	OK                  bool
+}
+
+// expectedPostings is the booking every successful transaction type must produce
+func expectedPostings(tx tools.TransactionLog) map[string]int64 {
+	switch tx.Type {
+	case "TRANSFER":
+		return map[string]int64{tx.From: -tx.Amount, tx.To: tx.Amount}
+	case "DEPOSIT":
+		return map[string]int64{tools.MintAccount: -tx.Amount, tx.To: tx.Amount}
+	case "WITHDRAWAL":
+		return map[string]int64{tx.From: -tx.Amount, tools.BurnAccount: tx.Amount}
+	}
+	return nil
+}
+
+// Run checks the audit log and the double-entry postings against each other. Each
+// successful transaction must have exactly one debit and one credit of equal amount
+// on the expected accounts (mint/burn for deposits and withdrawals), failed ones
+// none, and the whole ledger must sum to zero. No stored balance may be negative.
+func Run(database tools.DatabaseInterface) Report {
+	var logs []tools.TransactionLog = database.GetAllTransactions()
+	var postings []tools.Posting = database.GetPostings()
+
+	var report = Report{
+		GeneratedAt:         time.Now(),
+		TransactionsChecked: len(logs),
+		PostingsChecked:     len(postings),
+		Discrepancies:       []Discrepancy{},
+	}
+
+	byTransaction := make(map[string][]tools.Posting)
+	var ledgerTotal int64
+	for _, posting := range postings {
+		byTransaction[posting.TransactionID] = append(byTransaction[posting.TransactionID], posting)
+		ledgerTotal += posting.Amount
+	}
+
+	add := func(txID string, kind string, format string, args ...interface{}) {
+		report.Discrepancies = append(report.Discrepancies, Discrepancy{
+			TransactionID: txID,
+			Kind:          kind,
+			Detail:        fmt.Sprintf(format, args...),
+		})
+	}
+
+	seen := make(map[string]bool)
+	for _, tx := range logs {
+		seen[tx.ID] = true
+		actual := byTransaction[tx.ID]
+
+		// Corrections only touch the stored balance
+		if tx.Type == tools.CorrectionType {
+			if len(actual) > 0 {
+				add(tx.ID, KindCorrectionPostings, "correction has %d postings", len(actual))
+			}
+			continue
+		}
+
+		if tx.Status != "SUCCESS" {
+			if len(actual) > 0 {
+				add(tx.ID, KindFailedWithPostings, "%s with status %s has %d postings", tx.Type, tx.Status, len(actual))
+			}
+			continue
+		}
+
+		if len(actual) == 0 {
+			add(tx.ID, KindMissingPostings, "%s of %d has no postings", tx.Type, tx.Amount)
+			continue
+		}
+
+		var debits, credits int
+		var sum int64
+		got := make(map[string]int64)
+		for _, posting := range actual {
+			if posting.Amount < 0 {
+				debits++
+			} else {
+				credits++
+			}
+			sum += posting.Amount
+			got[posting.Account] += posting.Amount
+		}
+
+		if debits != 1 || credits != 1 {
+			add(tx.ID, KindEntryCount, "expected 1 debit and 1 credit, got %d and %d", debits, credits)
+		}
+		if sum != 0 {
+			add(tx.ID, KindUnbalanced, "postings sum to %d", sum)
+		}
+
+		expected := expectedPostings(tx)
+		for account, amount := range expected {
+			value, ok := got[account]
+			if !ok {
+				add(tx.ID, KindWrongAccounts, "%s did not touch %s", tx.Type, account)
+			} else if value != amount {
+				add(tx.ID, KindAmountMismatch, "%s posted %d, expected %d", account, value, amount)
+			}
+		}
+		for account := range got {
+			if _, ok := expected[account]; !ok {
+				add(tx.ID, KindWrongAccounts, "%s unexpectedly touched %s", tx.Type, account)
+			}
+		}
+	}
+
+	var orphans []string
+	for txID := range byTransaction {
+		if !seen[txID] {
+			orphans = append(orphans, txID)
+		}
+	}
+	sort.Strings(orphans)
+	for _, txID := range orphans {
+		add(txID, KindOrphanPostings, "%d postings without an audit log entry", len(byTransaction[txID]))
+	}
+
+	if ledgerTotal != 0 {
+		add("", KindLedgerImbalance, "all postings sum to %d", ledgerTotal)
+	}
+
+	// Balances are read a page at a time, only the broken ones are kept
+	err := tools.ForEachAccount(context.Background(), database, func(details tools.CoinDetails) error {
+		report.AccountsChecked++
+		if details.Coins < 0 {
+			add("", KindNegativeBalance, "%s has a balance of %d", details.Username, details.Coins)
+		}
+		return nil
+	})
+	if err != nil {
+		add("", KindIncompleteScan, "balances checked for %d accounts, then: %v", report.AccountsChecked, err)
+	}
+
+	report.OK = len(report.Discrepancies) == 0
+
+	return report
+}
+
+var ErrNoLedgerHistory = errors.New("account has no postings, refusing to overwrite its balance")
+
+// Stored balance of one account against the sum of its postings
+type AccountCheck struct {
+	Username        string
+	Stored          int64
+	Derived         int64
+	PostingsChecked int
+
+	// Stored - Derived
+	Difference int64
+	Consistent bool
+
+	version int64
+}
+
+// CheckAccount recomputes one account's balance from the ledger
+func CheckAccount(database tools.DatabaseInterface, username string) (AccountCheck, error) {
+	// Balance first: a transfer landing between the two reads shows up as a
+	// difference, but bumps the version so RepairAccount won't act on it
+	details, err := database.GetUserCoins(username)
+	if err != nil {
+		return AccountCheck{}, err
+	}
+
+	var check = AccountCheck{Username: username, Stored: details.Coins, version: details.Version}
+	for _, posting := range database.GetPostings() {
+		if posting.Account == username {
+			check.Derived += posting.Amount
+			check.PostingsChecked++
+		}
+	}
+	check.Difference = check.Stored - check.Derived
+	check.Consistent = check.Difference == 0
+
+	return check, nil
+}
+
+// RepairAccount sets the stored balance to the ledger's, logged as a correction.
+// An account without postings is left alone: its ledger history is missing rather
+// than its balance being wrong.
+func RepairAccount(database tools.DatabaseInterface, check AccountCheck) (*tools.CoinDetails, error) {
+	if check.PostingsChecked == 0 {
+		return nil, ErrNoLedgerHistory
+	}
+
+	details, err := database.CorrectUserCoins(check.Username, check.version, check.Derived)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"account":    check.Username,
+		"stored":     check.Stored,
+		"derived":    check.Derived,
+		"difference": check.Difference,
+	}).Warn("Balance corrected to match the ledger")
+	return details, nil
+}
+
+// Scheduled runs reconciliation once for the scheduler, logging each discrepancy as
+// a structured error so log-based alerting can pick it up
+func Scheduled(open func() (tools.DatabaseInterface, error)) {
+	database, err := open()
+	if err != nil {
+		log.Error("Reconciliation could not open the database: ", err)
+		return
+	}
+
+	report := Run(database)
+	for _, discrepancy := range report.Discrepancies {
+		log.WithFields(log.Fields{
+			"transaction_id": discrepancy.TransactionID,
+			"kind":           discrepancy.Kind,
+		}).Error("Reconciliation discrepancy: ", discrepancy.Detail)
+	}
+
+	log.WithFields(log.Fields{
+		"transactions":  report.TransactionsChecked,
+		"postings":      report.PostingsChecked,
+		"accounts":      report.AccountsChecked,
+		"discrepancies": len(report.Discrepancies),
+	}).Info("Reconciliation finished")
+}
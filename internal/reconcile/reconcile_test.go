@@ -0,0 +1,218 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// ledgerStub serves a hand-made ledger, everything else comes from the embedded database
+type ledgerStub struct {
+	tools.DatabaseInterface
+	logs     []tools.TransactionLog
+	postings []tools.Posting
+}
+
+func (s ledgerStub) GetAllTransactions() []tools.TransactionLog { return s.logs }
+
+func (s ledgerStub) GetPostings() []tools.Posting { return s.postings }
+
+func (s ledgerStub) ListUserCoins(ctx context.Context, after string, limit int) ([]tools.CoinDetails, error) {
+	return nil, nil
+}
+
+func hasKind(report Report, txID string, kind string) bool {
+	for _, discrepancy := range report.Discrepancies {
+		if discrepancy.TransactionID == txID && discrepancy.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReconciliation(t *testing.T) {
+	t.Run("Real_Operations_Reconcile", func(t *testing.T) {
+		database, err := tools.NewDatabase()
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+		db := *database
+
+		db.AddUserCoins("aaron", 100)
+		db.WithdrawUserCoins("aaron", 20)
+		db.TransferUserCoins("aaron", "bryan", 30)
+		db.WithdrawUserCoins("aaron", 1000000)
+
+		report := Run(db)
+		if !report.OK {
+			t.Errorf("Expected a clean ledger, got %+v", report.Discrepancies)
+		}
+		if report.PostingsChecked != 6 {
+			t.Errorf("Expected 6 postings for 3 successful transactions, got %d", report.PostingsChecked)
+		}
+	})
+
+	t.Run("Broken_Bookings_Reported", func(t *testing.T) {
+		now := time.Now()
+		stub := ledgerStub{
+			logs: []tools.TransactionLog{
+				{ID: "t1", Type: "TRANSFER", From: "aaron", To: "bryan", Amount: 10, Status: "SUCCESS", Timestamp: now},
+				{ID: "d1", Type: "DEPOSIT", To: "aaron", Amount: 5, Status: "SUCCESS", Timestamp: now},
+				{ID: "w1", Type: "WITHDRAWAL", From: "aaron", Amount: 5, Status: "FAILED_INSUFFICIENT_FUNDS", Timestamp: now},
+				{ID: "t2", Type: "TRANSFER", From: "aaron", To: "bryan", Amount: 10, Status: "SUCCESS", Timestamp: now},
+			},
+			postings: []tools.Posting{
+				// Credit larger than the debit
+				{TransactionID: "t1", Account: "aaron", Amount: -10},
+				{TransactionID: "t1", Account: "bryan", Amount: 12},
+				// Deposit that skipped the mint account
+				{TransactionID: "d1", Account: "bryan", Amount: -5},
+				{TransactionID: "d1", Account: "aaron", Amount: 5},
+				// Failed withdrawal that still booked
+				{TransactionID: "w1", Account: "aaron", Amount: -5},
+				{TransactionID: "w1", Account: tools.BurnAccount, Amount: 5},
+				// No audit entry at all
+				{TransactionID: "ghost", Account: "aaron", Amount: 1},
+			},
+		}
+
+		report := Run(stub)
+
+		expected := []struct{ txID, kind string }{
+			{"t1", KindUnbalanced},
+			{"t1", KindAmountMismatch},
+			{"d1", KindWrongAccounts},
+			{"w1", KindFailedWithPostings},
+			{"t2", KindMissingPostings},
+			{"ghost", KindOrphanPostings},
+			{"", KindLedgerImbalance},
+		}
+		for _, e := range expected {
+			if !hasKind(report, e.txID, e.kind) {
+				t.Errorf("Expected %s discrepancy for %q, got %+v", e.kind, e.txID, report.Discrepancies)
+			}
+		}
+
+		if report.OK {
+			t.Errorf("Report must not be OK with discrepancies")
+		}
+	})
+}
+
+func TestAccountRepair(t *testing.T) {
+	database, err := tools.NewMemoryDatabase(nil, map[string]tools.CoinDetails{
+		"aaron": {Username: "aaron", Version: 1},
+		"carol": {Username: "carol", Coins: 500, Version: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db := *database
+
+	db.AddUserCoins("aaron", 100)
+
+	// Simulate a stored balance drifting from the ledger
+	drifted, _ := db.GetUserCoins("aaron")
+	db.CorrectUserCoins("aaron", drifted.Version, 150)
+
+	check, err := CheckAccount(db, "aaron")
+	if err != nil {
+		t.Fatalf("CheckAccount failed: %v", err)
+	}
+	if check.Consistent || check.Stored != 150 || check.Derived != 100 || check.Difference != 50 {
+		t.Fatalf("Expected a difference of 50, got %+v", check)
+	}
+
+	details, err := RepairAccount(db, check)
+	if err != nil || details.Coins != 100 {
+		t.Fatalf("Expected the balance repaired to 100, got %+v, %v", details, err)
+	}
+	if check, _ := CheckAccount(db, "aaron"); !check.Consistent {
+		t.Errorf("Expected a consistent account after the repair, got %+v", check)
+	}
+	if report := Run(db); !report.OK {
+		t.Errorf("Corrections must not upset reconciliation, got %+v", report.Discrepancies)
+	}
+
+	t.Run("Stale_Check_Refused", func(t *testing.T) {
+		current, _ := db.GetUserCoins("aaron")
+		db.CorrectUserCoins("aaron", current.Version, 90)
+		check, _ := CheckAccount(db, "aaron")
+		db.AddUserCoins("aaron", 5)
+
+		if _, err := RepairAccount(db, check); err != tools.ErrStaleVersion {
+			t.Errorf("Expected a stale version error, got %v", err)
+		}
+	})
+
+	t.Run("No_Ledger_History", func(t *testing.T) {
+		check, _ := CheckAccount(db, "carol")
+		if _, err := RepairAccount(db, check); err != ErrNoLedgerHistory {
+			t.Errorf("Expected carol's balance to be left alone, got %v", err)
+		}
+	})
+}
+
+func TestAuditDiff(t *testing.T) {
+	database, err := tools.NewMemoryDatabase(nil, map[string]tools.CoinDetails{
+		"aaron": {Username: "aaron", Coins: 1000, Version: 1},
+		"bryan": {Username: "bryan", Coins: 1000, Version: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := *database
+
+	db.AddUserCoins("aaron", 100)
+	time.Sleep(time.Millisecond)
+	var mid time.Time = time.Now()
+	time.Sleep(time.Millisecond)
+	db.TransferUserCoins("aaron", "bryan", 30)
+	db.WithdrawUserCoins("aaron", 1000000)
+	details, _ := db.GetUserCoins("aaron")
+	db.CorrectUserCoins("aaron", details.Version, details.Coins-5)
+
+	t.Run("Whole_History", func(t *testing.T) {
+		diff, err := AuditDiff(db, "aaron", time.Time{}, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff.StartBalance != 1000 || diff.EndBalance != 1065 || diff.Net != 65 {
+			t.Errorf("Expected 1000 to 1065, got %d to %d (net %d)", diff.StartBalance, diff.EndBalance, diff.Net)
+		}
+		if len(diff.Changes) != 3 {
+			t.Fatalf("Expected the deposit, transfer and correction, got %+v", diff.Changes)
+		}
+		var transfer BalanceChange = diff.Changes[1]
+		if transfer.Type != "TRANSFER" || transfer.Counterparty != "bryan" || transfer.Amount != -30 || transfer.Balance != 1070 {
+			t.Errorf("Unexpected transfer %+v", transfer)
+		}
+		if correction := diff.Changes[2]; correction.Type != tools.CorrectionType || correction.Amount != -5 || correction.Balance != 1065 {
+			t.Errorf("Unexpected correction %+v", correction)
+		}
+	})
+
+	t.Run("Window", func(t *testing.T) {
+		diff, err := AuditDiff(db, "aaron", mid, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff.StartBalance != 1100 || diff.EndBalance != 1065 || len(diff.Changes) != 2 {
+			t.Errorf("Expected 1100 to 1065 over 2 changes, got %d to %d over %d", diff.StartBalance, diff.EndBalance, len(diff.Changes))
+		}
+
+		diff, _ = AuditDiff(db, "bryan", time.Time{}, mid)
+		if diff.StartBalance != 1000 || diff.EndBalance != 1000 || len(diff.Changes) != 0 {
+			t.Errorf("Expected bryan unchanged before the transfer, got %+v", diff)
+		}
+	})
+
+	t.Run("Unknown_Account", func(t *testing.T) {
+		if _, err := AuditDiff(db, "nobody", time.Time{}, time.Now()); !errors.Is(err, tools.ErrUserNotFound) {
+			t.Errorf("Expected ErrUserNotFound, got %v", err)
+		}
+	})
+}
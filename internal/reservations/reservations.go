@@ -0,0 +1,379 @@
+// Package reservations sets coins aside for a purchase before it is fulfilled. A
+// reservation is made against a reference such as a cart ID, then committed, which
+// spends the coins, or cancelled. One that is neither in time expires and the coins are
+// free again.
+package reservations
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// Longest reference a reservation can carry, in bytes
+const MaxReferenceLength = 140
+
+var (
+	ErrInvalidReservation = errors.New("invalid reservation")
+	ErrDisabled           = errors.New("reservations are not enabled")
+	ErrNotFound           = errors.New("reservation not found")
+	ErrNotReserved        = errors.New("reservation is no longer reserved")
+	ErrDuplicate          = errors.New("an open reservation already has this reference")
+	ErrInsufficientFunds  = errors.New("insufficient funds once existing reservations are set aside")
+	ErrCommitFailed       = errors.New("reservation could not be committed")
+)
+
+// Reservation statuses, reserved and committing still set the coins aside
+const (
+	StatusReserved   = "reserved"
+	StatusCommitting = "committing"
+	StatusCommitted  = "committed"
+	StatusCancelled  = "cancelled"
+	StatusExpired    = "expired"
+	StatusFailed     = "failed"
+)
+
+type Reservation struct {
+	ID         string
+	Username   string
+	Amount     int64
+	Reference  string
+	Status     string
+	ReservedAt time.Time
+	ExpiresAt  time.Time
+
+	// Set once committed, may be less than Amount
+	Committed int64
+
+	// Set once the reservation is committed, cancelled, expired or failed
+	ResolvedAt time.Time
+}
+
+// Open is true until the reservation is resolved
+func (r Reservation) Open() bool {
+	return r.Status == StatusReserved || r.Status == StatusCommitting
+}
+
+// Kinds a reservation is kept as. Storage holds the coins back under the
+// reservation's ID, so it is committed or released once however many processes race
+// for it, and the reservation itself is a record next to the balances.
+const (
+	holdKind   = "reservation"
+	recordKind = "reservation"
+)
+
+var mu sync.Mutex
+
+func newID() string {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+func load(database tools.DatabaseInterface, id string) (*Reservation, error) {
+	record, err := database.GetRecord(recordKind, id)
+	if errors.Is(err, tools.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var reservation Reservation
+	err = json.Unmarshal(record.Data, &reservation)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+func save(database tools.DatabaseInterface, reservation *Reservation) error {
+	data, err := json.Marshal(reservation)
+	if err != nil {
+		return err
+	}
+	return database.PutRecord(tools.Record{Kind: recordKind, ID: reservation.ID, Account: reservation.Username, Data: data, UpdatedAt: time.Now()})
+}
+
+// list returns username's reservations, or everyone's when username is empty, oldest
+// first
+func list(database tools.DatabaseInterface, username string) ([]Reservation, error) {
+	records, err := database.ListRecords(recordKind, username)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = make([]Reservation, 0, len(records))
+	for _, record := range records {
+		var reservation Reservation
+		err = json.Unmarshal(record.Data, &reservation)
+		if err != nil {
+			return nil, fmt.Errorf("reservation %s: %w", record.ID, err)
+		}
+		result = append(result, reservation)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ReservedAt.Before(result[j].ReservedAt) })
+	return result, nil
+}
+
+// Reserve sets amount of username's coins aside for reference until now plus ttl.
+// Storage checks username has that much available as it holds it back.
+func Reserve(database tools.DatabaseInterface, username string, amount int64, reference string, ttl time.Duration, now time.Time) (Reservation, error) {
+	if ttl <= 0 {
+		return Reservation{}, ErrDisabled
+	}
+	if amount <= 0 || username == "" || reference == "" {
+		return Reservation{}, fmt.Errorf("%w: amount must be positive and reference is required", ErrInvalidReservation)
+	}
+	if len(reference) > MaxReferenceLength {
+		return Reservation{}, fmt.Errorf("%w: reference must be at most %d bytes", ErrInvalidReservation, MaxReferenceLength)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	existing, err := list(database, username)
+	if err != nil {
+		return Reservation{}, err
+	}
+	for _, other := range existing {
+		if other.Reference == reference && other.Open() {
+			return Reservation{}, ErrDuplicate
+		}
+	}
+
+	var reservation = &Reservation{
+		ID:         newID(),
+		Username:   username,
+		Amount:     amount,
+		Reference:  reference,
+		Status:     StatusReserved,
+		ReservedAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	_, err = database.PlaceHold(tools.Hold{ID: reservation.ID, Account: username, Kind: holdKind, Amount: amount, CreatedAt: now})
+	if errors.Is(err, tools.ErrInsufficientFunds) {
+		return Reservation{}, ErrInsufficientFunds
+	}
+	if err != nil {
+		return Reservation{}, err
+	}
+	err = save(database, reservation)
+	if err != nil {
+		_, releaseErr := database.ReleaseHold(reservation.ID)
+		return Reservation{}, errors.Join(err, releaseErr)
+	}
+
+	events.Record(database, events.CoinsReserved, username, map[string]interface{}{
+		"reservation": reservation.ID,
+		"amount":      amount,
+		"reference":   reference,
+	})
+	return *reservation, nil
+}
+
+// Reserved is what username's open reservations set aside from their balance
+func Reserved(database tools.DatabaseInterface, username string) (int64, error) {
+	open, err := List(database, username, false)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, reservation := range open {
+		total += reservation.Amount
+	}
+	return total, nil
+}
+
+// List returns username's reservations, newest first. Only open ones unless all.
+func List(database tools.DatabaseInterface, username string, all bool) ([]Reservation, error) {
+	reservations, err := list(database, username)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = []Reservation{}
+	for i := len(reservations) - 1; i >= 0; i-- {
+		if all || reservations[i].Open() {
+			result = append(result, reservations[i])
+		}
+	}
+	return result, nil
+}
+
+// claim loads username's reservation. A reservation past its expiry can't be claimed,
+// whether or not Expire has released it yet. The caller holds mu.
+func claim(database tools.DatabaseInterface, id string, username string, now time.Time) (*Reservation, error) {
+	reservation, err := load(database, id)
+	if err != nil {
+		return nil, err
+	}
+	if reservation.Username != username {
+		return nil, ErrNotFound
+	}
+	if reservation.Status != StatusReserved || !now.Before(reservation.ExpiresAt) {
+		return nil, ErrNotReserved
+	}
+	return reservation, nil
+}
+
+// Commit spends amount of the reservation, the purchase was fulfilled, and releases
+// the rest. 0 commits the whole reservation. Storage withdraws the coins and releases
+// the reservation in one step, and only once for a reservation.
+func Commit(database tools.DatabaseInterface, id string, username string, amount int64, now time.Time) (Reservation, error) {
+	if amount < 0 {
+		return Reservation{}, ErrInvalidReservation
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	reservation, err := claim(database, id, username, now)
+	if err != nil {
+		return Reservation{}, err
+	}
+	if amount == 0 {
+		amount = reservation.Amount
+	}
+	if amount > reservation.Amount {
+		return Reservation{}, fmt.Errorf("%w: can commit at most the %d reserved", ErrInvalidReservation, reservation.Amount)
+	}
+
+	details, _, err := database.CaptureHold(context.Background(), reservation.ID, "", amount)
+	reservation.ResolvedAt = now
+	reservation.Status = StatusCommitted
+	switch {
+	case errors.Is(err, tools.ErrHoldNotFound):
+		return Reservation{}, ErrNotReserved
+	case errors.Is(err, tools.ErrAccountFrozen), errors.Is(err, tools.ErrInsufficientFunds):
+		// Storage refused the withdrawal, so the coins are free again
+		log.Error("Reservation commit failed for user: ", username, " amount: ", amount, ": ", err)
+		reservation.Status = StatusFailed
+		if _, releaseErr := database.ReleaseHold(reservation.ID); releaseErr != nil && !errors.Is(releaseErr, tools.ErrHoldNotFound) {
+			return Reservation{}, errors.Join(err, releaseErr)
+		}
+	case err != nil:
+		return Reservation{}, err
+	default:
+		reservation.Committed = amount
+	}
+	if saveErr := save(database, reservation); saveErr != nil {
+		log.Error("Failed to record reservation ", reservation.ID, " as ", reservation.Status, ": ", saveErr)
+	}
+
+	if reservation.Status == StatusFailed {
+		return *reservation, fmt.Errorf("%w: %v", ErrCommitFailed, err)
+	}
+	events.Record(database, events.WithdrawalCompleted, username, map[string]interface{}{
+		"amount":      reservation.Committed,
+		"balance":     details.Coins,
+		"reservation": reservation.ID,
+		"reference":   reservation.Reference,
+	})
+	return *reservation, nil
+}
+
+// Cancel frees the reservation's coins without spending them
+func Cancel(database tools.DatabaseInterface, id string, username string, now time.Time) (Reservation, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	reservation, err := claim(database, id, username, now)
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	_, err = database.ReleaseHold(reservation.ID)
+	if errors.Is(err, tools.ErrHoldNotFound) {
+		return Reservation{}, ErrNotReserved
+	}
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	reservation.Status = StatusCancelled
+	reservation.ResolvedAt = now
+	if err = save(database, reservation); err != nil {
+		log.Error("Failed to record reservation ", reservation.ID, " as cancelled: ", err)
+	}
+
+	recordRelease(database, *reservation)
+	return *reservation, nil
+}
+
+// Expire releases every reservation whose expiry has passed at now. One another
+// process resolved first is skipped.
+func Expire(database tools.DatabaseInterface, now time.Time) ([]Reservation, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	reservations, err := list(database, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []Reservation
+	for _, reservation := range reservations {
+		if reservation.Status != StatusReserved || now.Before(reservation.ExpiresAt) {
+			continue
+		}
+
+		_, err = database.ReleaseHold(reservation.ID)
+		if errors.Is(err, tools.ErrHoldNotFound) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+
+		reservation.Status = StatusExpired
+		reservation.ResolvedAt = now
+		if err = save(database, &reservation); err != nil {
+			log.Error("Failed to record reservation ", reservation.ID, " as expired: ", err)
+		}
+		recordRelease(database, reservation)
+		log.WithFields(log.Fields{
+			"reservation": reservation.ID,
+			"username":    reservation.Username,
+			"amount":      reservation.Amount,
+			"reference":   reservation.Reference,
+		}).Info("Reservation not committed in time, released")
+		expired = append(expired, reservation)
+	}
+
+	sort.Slice(expired, func(i, j int) bool { return expired[i].ExpiresAt.Before(expired[j].ExpiresAt) })
+	return expired, nil
+}
+
+// Scheduled expires reservations once for the scheduler
+func Scheduled(open func() (tools.DatabaseInterface, error)) {
+	database, err := open()
+	if err != nil {
+		log.Error("Reservation expiry could not open the database: ", err)
+		return
+	}
+	if _, err = Expire(database, time.Now()); err != nil {
+		log.Error("Reservation expiry failed: ", err)
+	}
+}
+
+func recordRelease(database tools.DatabaseInterface, reservation Reservation) {
+	events.Record(database, events.ReservationReleased, reservation.Username, map[string]interface{}{
+		"reservation": reservation.ID,
+		"amount":      reservation.Amount,
+		"reference":   reservation.Reference,
+		"status":      reservation.Status,
+	})
+}
@@ -0,0 +1,137 @@
+package reservations
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+// reserved is what username's open reservations set aside, failing the test if it
+// can't be read
+func reserved(t *testing.T, database tools.DatabaseInterface, username string) int64 {
+	total, err := Reserved(database, username)
+	if err != nil {
+		t.Fatalf("Failed to read reservations: %v", err)
+	}
+	return total
+}
+
+// count is how many of username's reservations List returns
+func count(t *testing.T, database tools.DatabaseInterface, username string, all bool) int {
+	list, err := List(database, username, all)
+	if err != nil {
+		t.Fatalf("Failed to list reservations: %v", err)
+	}
+	return len(list)
+}
+
+func TestReservations(t *testing.T) {
+	var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var ttl = 15 * time.Minute
+
+	t.Run("Partial_Commit_Releases_The_Rest", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		reservation, err := Reserve(database, "aaron", 100, "cart-42", ttl, now)
+		if err != nil {
+			t.Fatalf("Failed to reserve: %v", err)
+		}
+		if reserved(t, database, "aaron") != 100 || count(t, database, "aaron", false) != 1 {
+			t.Errorf("Expected 100 reserved for aaron, got %d", reserved(t, database, "aaron"))
+		}
+		if aaron, _ := database.GetUserCoins("aaron"); aaron.Held != 100 {
+			t.Errorf("Expected storage to hold 100 back, got %d", aaron.Held)
+		}
+
+		if _, err := Commit(database, reservation.ID, "bryan", 0, now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound committing someone else's reservation, got %v", err)
+		}
+		if _, err := Commit(database, reservation.ID, "aaron", 101, now); !errors.Is(err, ErrInvalidReservation) {
+			t.Errorf("Expected ErrInvalidReservation committing more than reserved, got %v", err)
+		}
+
+		committed, err := Commit(database, reservation.ID, "aaron", 60, now.Add(time.Minute))
+		if err != nil || committed.Status != StatusCommitted || committed.Committed != 60 {
+			t.Fatalf("Expected 60 committed, got %+v, %v", committed, err)
+		}
+
+		aaron, _ := database.GetUserCoins("aaron")
+		if aaron.Coins != 940 {
+			t.Errorf("Expected 940 left, got %d", aaron.Coins)
+		}
+		if aaron.Held != 0 || reserved(t, database, "aaron") != 0 || count(t, database, "aaron", false) != 0 || count(t, database, "aaron", true) != 1 {
+			t.Error("Expected the reservation to end with the commit")
+		}
+		if _, err := Cancel(database, reservation.ID, "aaron", now); !errors.Is(err, ErrNotReserved) {
+			t.Errorf("Expected ErrNotReserved for a committed reservation, got %v", err)
+		}
+	})
+
+	t.Run("Cancelled_And_Expired_Reservations_Spend_Nothing", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		cancelled, _ := Reserve(database, "aaron", 10, "cart-1", ttl, now)
+		expiring, _ := Reserve(database, "aaron", 20, "cart-2", ttl, now)
+
+		if reservation, err := Cancel(database, cancelled.ID, "aaron", now); err != nil || reservation.Status != StatusCancelled {
+			t.Fatalf("Expected the reservation cancelled, got %+v, %v", reservation, err)
+		}
+		if expired, _ := Expire(database, now.Add(ttl-time.Second)); len(expired) != 0 {
+			t.Fatalf("Expected nothing to expire early, got %+v", expired)
+		}
+		expired, err := Expire(database, now.Add(ttl))
+		if err != nil || len(expired) != 1 || expired[0].ID != expiring.ID || expired[0].Status != StatusExpired {
+			t.Fatalf("Expected the second reservation to expire, got %+v", expired)
+		}
+
+		if aaron, _ := database.GetUserCoins("aaron"); aaron.Held != 0 || reserved(t, database, "aaron") != 0 {
+			t.Errorf("Expected nothing reserved, got %+v", aaron)
+		}
+		if history := database.GetTransactionHistory("aaron"); len(history) != 0 {
+			t.Errorf("Expected no ledger entries, got %+v", history)
+		}
+	})
+
+	t.Run("Late_Commit_Is_Refused", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		reservation, _ := Reserve(database, "aaron", 10, "cart-1", ttl, now)
+		if _, err := Commit(database, reservation.ID, "aaron", 0, now.Add(ttl)); !errors.Is(err, ErrNotReserved) {
+			t.Errorf("Expected ErrNotReserved after expiry, got %v", err)
+		}
+	})
+
+	t.Run("Reservations_Cap_Spending", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		if _, err := Reserve(database, "aaron", 600, "cart-1", ttl, now); err != nil {
+			t.Fatalf("Failed to reserve: %v", err)
+		}
+		if _, err := Reserve(database, "aaron", 500, "cart-2", ttl, now); !errors.Is(err, ErrInsufficientFunds) {
+			t.Errorf("Expected ErrInsufficientFunds, got %v", err)
+		}
+		if _, err := database.WithdrawUserCoins("aaron", 401); !errors.Is(err, tools.ErrInsufficientFunds) {
+			t.Errorf("Expected the reserved coins to be out of a withdrawal's reach, got %v", err)
+		}
+	})
+
+	t.Run("Refuses_Invalid_Reservations", func(t *testing.T) {
+		database := toolstest.New(t, nil)
+
+		if _, err := Reserve(database, "aaron", 10, "cart-1", 0, now); !errors.Is(err, ErrDisabled) {
+			t.Errorf("Expected ErrDisabled, got %v", err)
+		}
+		if _, err := Reserve(database, "aaron", 10, "", ttl, now); !errors.Is(err, ErrInvalidReservation) {
+			t.Errorf("Expected ErrInvalidReservation without a reference, got %v", err)
+		}
+		if _, err := Reserve(database, "aaron", 10, "cart-1", ttl, now); err != nil {
+			t.Fatalf("Failed to reserve: %v", err)
+		}
+		if _, err := Reserve(database, "aaron", 10, "cart-1", ttl, now); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("Expected ErrDuplicate for a reference already reserved, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package runbooks
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// RegisterCompaction adds a step to the compact runbook that rewrites one file-backed
+// store without what it no longer needs. compact returns the file's size in bytes
+// before and after, which the run reports under name. The runbook exists once a store
+// registers.
+func RegisterCompaction(name string, description string, compact func() (int64, int64, error)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var runbook Runbook = runbooks["compact"]
+	var steps = append(runbook.steps, step{
+		name:        "compact_" + name,
+		description: description,
+		do: func(ctx context.Context, run *execution) error {
+			before, after, err := compact()
+			if err != nil {
+				return err
+			}
+			run.result[name] = map[string]int64{"bytes_before": before, "bytes_after": after}
+			return nil
+		},
+	})
+	runbooks["compact"] = newRunbook("compact", "Rewrite the file-backed stores without what they no longer need, one at a time under each store's own lock", steps)
+}
+
+// ScheduledCompaction starts the compact runbook at now, unless now is outside
+// COMPACTION_WINDOW or more than COMPACTION_MAX_INFLIGHT_MUTATIONS writes are in flight,
+// in which case it waits for the next run. Progress shows in the run and the event feed
+// like any other runbook.
+func ScheduledCompaction(open func() (tools.DatabaseInterface, error), now time.Time, inFlight func() int64) {
+	var cfg config.Config = config.Get()
+	window, err := config.ParseDailyWindow(cfg.CompactionWindow)
+	if err != nil {
+		log.Error("Compaction skipped: ", err)
+		return
+	}
+	if !window.Contains(now) {
+		log.Debug("Compaction skipped outside COMPACTION_WINDOW ", cfg.CompactionWindow)
+		return
+	}
+	if limit := cfg.CompactionMaxInFlightMutations; limit > 0 && inFlight() > int64(limit) {
+		log.Info("Compaction postponed, ", inFlight(), " writes in flight")
+		return
+	}
+
+	database, err := open()
+	if err != nil {
+		log.Error("Compaction could not open the database: ", err)
+		return
+	}
+	_, err = Start(database, "compact", "scheduler", "scheduled compaction", nil)
+	switch {
+	case errors.Is(err, ErrRunInProgress):
+		log.Info("Compaction postponed, another runbook is running")
+	case errors.Is(err, ErrRunbookNotFound):
+		log.Debug("Compaction skipped, no file-backed stores")
+	case err != nil:
+		log.Error("Compaction failed to start: ", err)
+	}
+}
@@ -0,0 +1,246 @@
+package runbooks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// ErrWritesPaused wraps tools.ErrStorageUnavailable, so callers answer 503 and retry
+var ErrWritesPaused = fmt.Errorf("%w: writes are paused for maintenance, retry shortly", tools.ErrStorageUnavailable)
+
+// How often pause checks whether the writes in flight have finished
+const drainPoll = 5 * time.Millisecond
+
+// gate counts the writes in flight and refuses new ones while paused
+type gate struct {
+	mu       sync.Mutex
+	paused   bool
+	inFlight int
+}
+
+var (
+	writes gate
+
+	// What Wrap wrapped, the storage snapshots are taken from
+	storageMu sync.Mutex
+	storage   tools.DatabaseInterface
+)
+
+func (g *gate) enter() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.paused {
+		return ErrWritesPaused
+	}
+	g.inFlight++
+	return nil
+}
+
+func (g *gate) leave() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.inFlight--
+}
+
+// pause refuses new writes at once, then waits for the ones in flight. Writes stay
+// paused when ctx ends first, the caller resumes them.
+func (g *gate) pause(ctx context.Context) error {
+	g.mu.Lock()
+	g.paused = true
+	g.mu.Unlock()
+
+	var ticker = time.NewTicker(drainPoll)
+	defer ticker.Stop()
+	for {
+		g.mu.Lock()
+		var inFlight int = g.inFlight
+		g.mu.Unlock()
+		if inFlight == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d write(s) still in flight: %w", inFlight, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *gate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.paused = false
+}
+
+// Paused reports whether a runbook has paused writes
+func Paused() bool {
+	writes.mu.Lock()
+	defer writes.mu.Unlock()
+
+	return writes.paused
+}
+
+// database refuses changes to balances, accounts, co-owners and records while writes
+// are paused. Reads, and the refresh tokens logins need, pass straight through.
+type database struct {
+	tools.DatabaseInterface
+}
+
+// Wrap returns inner with writes that runbooks can pause. Wrap the storage itself,
+// under anything that records successful writes elsewhere such as the publisher, so a
+// refused write is never recorded. Snapshots are taken from inner.
+func Wrap(inner tools.DatabaseInterface) tools.DatabaseInterface {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+
+	storage = inner
+	return &database{DatabaseInterface: inner}
+}
+
+func (d *database) CreateUser(login tools.LoginDetails) (*tools.CoinDetails, error) {
+	if err := writes.enter(); err != nil {
+		return nil, err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.CreateUser(login)
+}
+
+func (d *database) DeleteUser(username string) error {
+	if err := writes.enter(); err != nil {
+		return err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.DeleteUser(username)
+}
+
+func (d *database) AddUserCoins(username string, amount int64) (*tools.CoinDetails, error) {
+	if err := writes.enter(); err != nil {
+		return nil, err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.AddUserCoins(username, amount)
+}
+
+func (d *database) WithdrawUserCoins(username string, amount int64) (*tools.CoinDetails, error) {
+	if err := writes.enter(); err != nil {
+		return nil, err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.WithdrawUserCoins(username, amount)
+}
+
+func (d *database) SetUserFrozen(username string, frozen bool) (*tools.CoinDetails, error) {
+	if err := writes.enter(); err != nil {
+		return nil, err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.SetUserFrozen(username, frozen)
+}
+
+func (d *database) PlaceHold(hold tools.Hold) (*tools.CoinDetails, error) {
+	if err := writes.enter(); err != nil {
+		return nil, err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.PlaceHold(hold)
+}
+
+func (d *database) ReleaseHold(id string) (*tools.CoinDetails, error) {
+	if err := writes.enter(); err != nil {
+		return nil, err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.ReleaseHold(id)
+}
+
+func (d *database) CaptureHold(ctx context.Context, id string, to string, amount int64) (*tools.CoinDetails, *tools.CoinDetails, error) {
+	if err := writes.enter(); err != nil {
+		return nil, nil, err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.CaptureHold(ctx, id, to, amount)
+}
+
+func (d *database) TransferUserCoins(from string, to string, amount int64) (*tools.CoinDetails, *tools.CoinDetails) {
+	if writes.enter() != nil {
+		return nil, nil
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.TransferUserCoins(from, to, amount)
+}
+
+func (d *database) TransferUserCoinsWithContext(ctx context.Context, from string, to string, amount int64) (*tools.CoinDetails, *tools.CoinDetails, error) {
+	if err := writes.enter(); err != nil {
+		return nil, nil, err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.TransferUserCoinsWithContext(ctx, from, to, amount)
+}
+
+func (d *database) CorrectUserCoins(username string, version int64, balance int64) (*tools.CoinDetails, error) {
+	if err := writes.enter(); err != nil {
+		return nil, err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.CorrectUserCoins(username, version, balance)
+}
+
+func (d *database) AnonymizeUser(username string, pseudonym string) error {
+	if err := writes.enter(); err != nil {
+		return err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.AnonymizeUser(username, pseudonym)
+}
+
+func (d *database) SetAccountOwner(owner tools.AccountOwner) error {
+	if err := writes.enter(); err != nil {
+		return err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.SetAccountOwner(owner)
+}
+
+func (d *database) RemoveAccountOwner(account string, owner string) error {
+	if err := writes.enter(); err != nil {
+		return err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.RemoveAccountOwner(account, owner)
+}
+
+func (d *database) PutRecord(record tools.Record) error {
+	if err := writes.enter(); err != nil {
+		return err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.PutRecord(record)
+}
+
+func (d *database) DeleteRecord(kind string, id string) error {
+	if err := writes.enter(); err != nil {
+		return err
+	}
+	defer writes.leave()
+	return d.DatabaseInterface.DeleteRecord(kind, id)
+}
+
+func (d *database) Subscribe(username string) (<-chan tools.TransactionLog, func()) {
+	return tools.Subscribe(d.DatabaseInterface, username)
+}
+
+// Capabilities are inner's, except the wrapper itself can't be snapshotted. The
+// snapshot runbook goes to inner.
+func (d *database) Capabilities() tools.Capabilities {
+	capabilities := d.DatabaseInterface.Capabilities()
+	capabilities.Snapshots = false
+	return capabilities
+}
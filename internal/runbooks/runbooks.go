@@ -0,0 +1,417 @@
+// Package runbooks runs maintenance procedures of several steps, such as pausing
+// writes, snapshotting the ledger and resuming them, in the background and one at a
+// time. Each run records its steps' progress as it goes. A step that fails undoes the
+// steps before it, newest first, so a procedure that stops half way never leaves
+// writes paused.
+package runbooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/reconcile"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// Run and step statuses. A step is undone when a later one failed and its undo ran.
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusUndone    = "undone"
+	StatusSkipped   = "skipped"
+)
+
+var (
+	ErrRunbookNotFound      = errors.New("runbook not found")
+	ErrRunNotFound          = errors.New("runbook run not found")
+	ErrRunInProgress        = errors.New("another runbook is running, wait for it to finish")
+	ErrSnapshotsUnsupported = errors.New("the storage backend doesn't support snapshots")
+	ErrSnapshotNotFound     = errors.New("snapshot not found")
+)
+
+// Finished runs and snapshots kept for the admin view, oldest are dropped first
+const (
+	maxRuns      = 50
+	maxSnapshots = 3
+)
+
+// step is one part of a runbook. do leaves nothing behind when it fails, undo, when
+// set, reverses it after a later step failed.
+type step struct {
+	name        string
+	description string
+	do          func(ctx context.Context, run *execution) error
+	undo        func() error
+}
+
+// Runbook is a named procedure and its steps in order
+type Runbook struct {
+	Name        string
+	Description string
+	Steps       []StepInfo
+	steps       []step
+}
+
+type StepInfo struct {
+	Name        string
+	Description string
+}
+
+type StepProgress struct {
+	Name       string
+	Status     string
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Run is one execution of a runbook. Result holds what the steps reported, such as
+// the ID of the snapshot taken.
+type Run struct {
+	ID         string
+	Runbook    string
+	Status     string
+	Error      string
+	StartedBy  string
+	Reason     string
+	Params     map[string]string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Steps      []StepProgress
+	Result     map[string]interface{}
+}
+
+// execution is what a step sees of its run
+type execution struct {
+	database tools.DatabaseInterface
+	params   map[string]string
+	result   map[string]interface{}
+}
+
+// snapshot is a copy of the ledger a runbook took, kept in memory
+type snapshot struct {
+	ID      string
+	TakenAt time.Time
+	state   tools.Snapshot
+}
+
+var (
+	mu        sync.Mutex
+	runs      = map[string]*Run{}
+	running   string
+	snapshots []snapshot
+)
+
+func newID() string {
+	var id = make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Pausing writes is the first step of every runbook that needs a still ledger, and
+// resuming them the last. The pause is undone if anything in between fails.
+var (
+	pauseWrites = step{
+		name:        "pause_writes",
+		description: "refuse new writes with 503 and wait for the ones in flight",
+		do: func(ctx context.Context, run *execution) error {
+			ctx, cancel := context.WithTimeout(ctx, config.Get().RunbookDrainTimeout)
+			defer cancel()
+			var err error = writes.pause(ctx)
+			if err != nil {
+				writes.resume()
+			}
+			return err
+		},
+		undo: func() error {
+			writes.resume()
+			return nil
+		},
+	}
+	resumeWrites = step{
+		name:        "resume_writes",
+		description: "accept writes again",
+		do: func(ctx context.Context, run *execution) error {
+			writes.resume()
+			return nil
+		},
+	}
+)
+
+// The compact runbook is added by RegisterCompaction, runbooks is guarded by mu
+var runbooks = map[string]Runbook{
+	"snapshot": newRunbook("snapshot", "Take an in-memory snapshot of the ledger while nothing changes it", []step{
+		pauseWrites,
+		{
+			name:        "snapshot",
+			description: "copy accounts, ledger and postings, keeping the newest 3 snapshots",
+			do:          takeSnapshot,
+		},
+		resumeWrites,
+	}),
+	"restore": newRunbook("restore", "Put the ledger back to a snapshot, the newest unless the snapshot parameter names one", []step{
+		pauseWrites,
+		{
+			name:        "restore",
+			description: "replace accounts, ledger and postings with the snapshot's",
+			do:          restoreSnapshot,
+		},
+		resumeWrites,
+	}),
+	"reconcile": newRunbook("reconcile", "Reconcile the double-entry postings against balances while nothing changes them", []step{
+		pauseWrites,
+		{
+			name:        "reconcile",
+			description: "check every transaction's postings and every balance",
+			do: func(ctx context.Context, run *execution) error {
+				var report reconcile.Report = reconcile.Run(run.database)
+				run.result["transactions_checked"] = report.TransactionsChecked
+				run.result["discrepancies"] = len(report.Discrepancies)
+				return nil
+			},
+		},
+		resumeWrites,
+	}),
+}
+
+func newRunbook(name string, description string, steps []step) Runbook {
+	var runbook = Runbook{Name: name, Description: description, steps: steps}
+	for _, step := range steps {
+		runbook.Steps = append(runbook.Steps, StepInfo{Name: step.name, Description: step.description})
+	}
+	return runbook
+}
+
+// snapshotter is the storage Wrap wrapped, if it can be snapshotted
+func snapshotter() (tools.Snapshotter, error) {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+
+	snapshotter, ok := storage.(tools.Snapshotter)
+	if !ok || !storage.Capabilities().Snapshots {
+		return nil, ErrSnapshotsUnsupported
+	}
+	return snapshotter, nil
+}
+
+func takeSnapshot(ctx context.Context, run *execution) error {
+	storage, err := snapshotter()
+	if err != nil {
+		return err
+	}
+
+	var taken = snapshot{ID: newID(), TakenAt: time.Now(), state: storage.Snapshot()}
+	mu.Lock()
+	snapshots = append(snapshots, taken)
+	if len(snapshots) > maxSnapshots {
+		snapshots = snapshots[len(snapshots)-maxSnapshots:]
+	}
+	mu.Unlock()
+
+	run.result["snapshot"] = taken.ID
+	return nil
+}
+
+func restoreSnapshot(ctx context.Context, run *execution) error {
+	storage, err := snapshotter()
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	var found snapshot
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if run.params["snapshot"] == "" || snapshots[i].ID == run.params["snapshot"] {
+			found = snapshots[i]
+			break
+		}
+	}
+	mu.Unlock()
+	if found.ID == "" {
+		return ErrSnapshotNotFound
+	}
+
+	storage.Restore(found.state)
+	run.result["snapshot"] = found.ID
+	run.result["taken_at"] = found.TakenAt
+	return nil
+}
+
+// Runbooks lists the runbooks by name
+func Runbooks() []Runbook {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var result = make([]Runbook, 0, len(runbooks))
+	for _, runbook := range runbooks {
+		result = append(result, runbook)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Start runs the named runbook against database in the background and returns the run
+// as it starts. Only one runbook runs at a time.
+func Start(database tools.DatabaseInterface, name string, startedBy string, reason string, params map[string]string) (Run, error) {
+	mu.Lock()
+	runbook, ok := runbooks[name]
+	if !ok {
+		mu.Unlock()
+		return Run{}, fmt.Errorf("%w: %q", ErrRunbookNotFound, name)
+	}
+	if running != "" {
+		mu.Unlock()
+		return Run{}, ErrRunInProgress
+	}
+	var run = &Run{
+		ID:        newID(),
+		Runbook:   name,
+		Status:    StatusRunning,
+		StartedBy: startedBy,
+		Reason:    reason,
+		Params:    params,
+		StartedAt: time.Now(),
+		Result:    map[string]interface{}{},
+	}
+	for _, step := range runbook.steps {
+		run.Steps = append(run.Steps, StepProgress{Name: step.name, Status: StatusPending})
+	}
+	runs[run.ID] = run
+	running = run.ID
+	prune()
+	var started Run = run.copy()
+	mu.Unlock()
+
+	log.Info("Runbook ", name, " started by ", startedBy, " as run ", run.ID, ": ", reason)
+	go execute(database, runbook, run)
+	return started, nil
+}
+
+// execute runs the steps in order, then undoes the finished ones if a step failed
+func execute(database tools.DatabaseInterface, runbook Runbook, run *Run) {
+	var env = &execution{database: database, params: run.Params, result: map[string]interface{}{}}
+	var failed = -1
+	for i, step := range runbook.steps {
+		progress(database, run, i, StatusRunning, nil)
+		var err error = step.do(context.Background(), env)
+		if err != nil {
+			progress(database, run, i, StatusFailed, err)
+			failed = i
+			break
+		}
+		progress(database, run, i, StatusCompleted, nil)
+	}
+
+	if failed >= 0 {
+		for i := failed - 1; i >= 0; i-- {
+			if runbook.steps[i].undo == nil {
+				continue
+			}
+			if err := runbook.steps[i].undo(); err != nil {
+				log.Error("Runbook ", runbook.Name, " run ", run.ID, " failed to undo ", runbook.steps[i].name, ": ", err)
+				continue
+			}
+			progress(database, run, i, StatusUndone, nil)
+		}
+		for i := failed + 1; i < len(runbook.steps); i++ {
+			progress(database, run, i, StatusSkipped, nil)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	run.FinishedAt = time.Now()
+	run.Result = env.result
+	run.Status = StatusCompleted
+	if failed >= 0 {
+		run.Status = StatusFailed
+		run.Error = run.Steps[failed].Error
+	}
+	running = ""
+	log.Info("Runbook ", runbook.Name, " run ", run.ID, " ", run.Status)
+}
+
+// progress moves step i of run to status and records it, so the admin event feed
+// shows a run's progress as well as polling it
+func progress(database tools.DatabaseInterface, run *Run, i int, status string, err error) {
+	mu.Lock()
+	var step = &run.Steps[i]
+	step.Status = status
+	switch status {
+	case StatusRunning:
+		step.StartedAt = time.Now()
+	case StatusCompleted, StatusFailed:
+		step.FinishedAt = time.Now()
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	var name string = step.Name
+	mu.Unlock()
+
+	events.Record(database, events.RunbookProgress, run.StartedBy, map[string]interface{}{
+		"run":     run.ID,
+		"runbook": run.Runbook,
+		"step":    name,
+		"status":  status,
+	})
+}
+
+// prune drops the oldest finished runs over maxRuns, the caller holds mu
+func prune() {
+	if len(runs) <= maxRuns {
+		return
+	}
+	var finished []*Run
+	for _, run := range runs {
+		if run.ID != running {
+			finished = append(finished, run)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].StartedAt.Before(finished[j].StartedAt) })
+	for _, run := range finished[:len(runs)-maxRuns] {
+		delete(runs, run.ID)
+	}
+}
+
+func (r *Run) copy() Run {
+	var result = *r
+	result.Steps = append([]StepProgress(nil), r.Steps...)
+	return result
+}
+
+// Get returns a run as it is now
+func Get(id string) (Run, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	run, ok := runs[id]
+	if !ok {
+		return Run{}, ErrRunNotFound
+	}
+	return run.copy(), nil
+}
+
+// Runs lists the kept runs, newest first
+func Runs() []Run {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var result = make([]Run, 0, len(runs))
+	for _, run := range runs {
+		result = append(result, run.copy())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].StartedAt.After(result[j].StartedAt) })
+	return result
+}
@@ -0,0 +1,175 @@
+package runbooks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+func newTestDatabase(t *testing.T) tools.DatabaseInterface {
+	return Wrap(toolstest.New(t, nil))
+}
+
+// finish starts name and waits for the run to end
+func finish(t *testing.T, database tools.DatabaseInterface, name string, params map[string]string) Run {
+	t.Helper()
+
+	run, err := Start(database, name, "admin", "test", params)
+	if err != nil {
+		t.Fatalf("Failed to start %s: %v", name, err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		run, err = Get(run.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.Status != StatusRunning {
+			return run
+		}
+	}
+	t.Fatalf("Run %s of %s didn't finish", run.ID, name)
+	return run
+}
+
+func statuses(run Run) []string {
+	var result []string
+	for _, step := range run.Steps {
+		result = append(result, step.Status)
+	}
+	return result
+}
+
+func TestRunbooks(t *testing.T) {
+	t.Run("Writes_Refused_While_Paused", func(t *testing.T) {
+		var database = newTestDatabase(t)
+		if err := writes.pause(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := database.AddUserCoins("aaron", 10)
+		if !errors.Is(err, ErrWritesPaused) || !errors.Is(err, tools.ErrStorageUnavailable) {
+			t.Errorf("Expected the deposit refused, got %v", err)
+		}
+		if _, err := database.SetUserFrozen("aaron", true); !errors.Is(err, ErrWritesPaused) {
+			t.Errorf("Expected the freeze refused, got %v", err)
+		}
+		if err := database.PutRecord(tools.Record{Kind: "note", ID: "a"}); !errors.Is(err, ErrWritesPaused) {
+			t.Errorf("Expected the record refused, got %v", err)
+		}
+		if _, err := database.GetUserCoins("aaron"); err != nil {
+			t.Errorf("Expected reads to go on, got %v", err)
+		}
+
+		writes.resume()
+		if _, err := database.AddUserCoins("aaron", 10); err != nil {
+			t.Errorf("Expected the deposit after resuming, got %v", err)
+		}
+	})
+
+	t.Run("Snapshot_Then_Restore", func(t *testing.T) {
+		var database = newTestDatabase(t)
+		var run Run = finish(t, database, "snapshot", nil)
+		if run.Status != StatusCompleted || run.Result["snapshot"] == nil || Paused() {
+			t.Fatalf("Unexpected snapshot run %+v", run)
+		}
+
+		database.TransferUserCoins("aaron", "bryan", 100)
+
+		run = finish(t, database, "restore", map[string]string{"snapshot": run.Result["snapshot"].(string)})
+		coins, _ := database.GetUserCoins("aaron")
+		if run.Status != StatusCompleted || coins.Coins != 1000 {
+			t.Errorf("Expected aaron back to 1000, got %d after %+v", coins.Coins, run)
+		}
+	})
+
+	t.Run("Failed_Step_Undoes_The_Pause", func(t *testing.T) {
+		// Snapshots come from what Wrap wrapped, another wrapper can't be snapshotted
+		var database = Wrap(newTestDatabase(t))
+		var run Run = finish(t, database, "snapshot", nil)
+
+		var expected = []string{StatusUndone, StatusFailed, StatusSkipped}
+		var got = statuses(run)
+		if run.Status != StatusFailed || len(got) != 3 || got[0] != expected[0] || got[1] != expected[1] || got[2] != expected[2] {
+			t.Errorf("Expected steps %v, got %v", expected, got)
+		}
+		if Paused() {
+			t.Error("Expected writes resumed after the failure")
+		}
+	})
+
+	t.Run("Drain_Timeout_Gives_Up", func(t *testing.T) {
+		var original config.Config = config.Get()
+		var cfg config.Config = original
+		cfg.RunbookDrainTimeout = 50 * time.Millisecond
+		config.Set(cfg)
+		defer config.Set(original)
+
+		var database = newTestDatabase(t)
+
+		// A write that never finishes
+		writes.enter()
+		defer writes.leave()
+
+		run, err := Start(database, "reconcile", "admin", "test", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Start(database, "snapshot", "admin", "test", nil); !errors.Is(err, ErrRunInProgress) {
+			t.Errorf("Expected a second run refused, got %v", err)
+		}
+
+		for run.Status == StatusRunning {
+			time.Sleep(5 * time.Millisecond)
+			run, _ = Get(run.ID)
+		}
+		if run.Status != StatusFailed || run.Steps[0].Status != StatusFailed || Paused() {
+			t.Errorf("Expected the pause to give up, got %+v", run)
+		}
+	})
+
+	t.Run("Scheduled_Compaction_Waits_For_Quiet", func(t *testing.T) {
+		var original config.Config = config.Get()
+		var cfg config.Config = original
+		cfg.CompactionWindow = "02:00-04:00"
+		cfg.CompactionMaxInFlightMutations = 10
+		config.Set(cfg)
+		defer config.Set(original)
+
+		var calls int
+		RegisterCompaction("test", "shrink a test file", func() (int64, int64, error) {
+			calls++
+			return 300, 100, nil
+		})
+		var database = newTestDatabase(t)
+		var open = func() (tools.DatabaseInterface, error) { return database, nil }
+		var quiet = func() int64 { return 2 }
+
+		ScheduledCompaction(open, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), quiet)
+		ScheduledCompaction(open, time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC), func() int64 { return 11 })
+		if calls != 0 {
+			t.Fatalf("Expected no compaction outside the window or while busy, got %d", calls)
+		}
+
+		ScheduledCompaction(open, time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC), quiet)
+		var run Run = Runs()[0]
+		for run.Status == StatusRunning {
+			time.Sleep(5 * time.Millisecond)
+			run, _ = Get(run.ID)
+		}
+		result, _ := run.Result["test"].(map[string]int64)
+		if run.Runbook != "compact" || run.Status != StatusCompleted || calls != 1 || result["bytes_after"] != 100 {
+			t.Errorf("Expected one compaction reporting 100 bytes after, got %+v", run)
+		}
+	})
+
+	t.Run("Unknown_Runbook", func(t *testing.T) {
+		if _, err := Start(newTestDatabase(t), "nope", "admin", "test", nil); !errors.Is(err, ErrRunbookNotFound) {
+			t.Errorf("Expected ErrRunbookNotFound, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,318 @@
+// Package scheduler runs recurring jobs and remembers when each one is next due, so a
+// restart can tell which runs were missed while the server was down and apply the
+// missed-run policy to them.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Missed run actions
+const (
+	MissedSkipped = "skipped"
+	MissedRan     = "ran"
+)
+
+// The all policy runs at most this many missed runs, older ones are skipped
+const maxCatchUp = 100
+
+// Missed runs kept per job for the admin view
+const maxMissed = 50
+
+// A run that came due while the server was down
+type Missed struct {
+	ScheduledAt time.Time
+	Action      string
+	DetectedAt  time.Time
+}
+
+type Job struct {
+	Name      string
+	Interval  time.Duration
+	NextRunAt time.Time
+
+	// Zero until the job has run, including runs before a restart
+	LastRunAt time.Time
+	Missed    []Missed
+
+	run func(scheduledAt time.Time)
+}
+
+// Upcoming returns the next n times the job is due
+func (j Job) Upcoming(n int) []time.Time {
+	var times = make([]time.Time, 0, n)
+	for i := 0; i < n; i++ {
+		times = append(times, j.NextRunAt.Add(time.Duration(i)*j.Interval))
+	}
+	return times
+}
+
+// What is kept in the state file for each job
+type state struct {
+	NextRunAt time.Time
+	LastRunAt time.Time
+}
+
+var (
+	mu        sync.Mutex
+	jobs      = map[string]*Job{}
+	saved     = map[string]state{}
+	statePath string
+)
+
+// Load reads next-run times from path and writes them back there after every run.
+// A missing file is a first start. With no path nothing survives a restart.
+func Load(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	statePath = path
+	saved = map[string]state{}
+	if path == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading scheduler state: %w", err)
+	}
+
+	err = json.Unmarshal(content, &saved)
+	if err != nil {
+		return fmt.Errorf("parsing scheduler state %s: %w", path, err)
+	}
+	return nil
+}
+
+// Register adds a job that runs every interval. A job known from the state file keeps
+// its next-run time, a new one first runs an interval from now.
+func Register(name string, interval time.Duration, run func(scheduledAt time.Time)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var job = &Job{Name: name, Interval: interval, NextRunAt: time.Now().Add(interval), run: run}
+	if previous, ok := saved[name]; ok && !previous.NextRunAt.IsZero() {
+		job.NextRunAt = previous.NextRunAt
+		job.LastRunAt = previous.LastRunAt
+	}
+	jobs[name] = job
+	saveLocked()
+}
+
+// Jobs returns the registered jobs ordered by name
+func Jobs() []Job {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var result = make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		var copied Job = *job
+		copied.Missed = append([]Missed(nil), job.Missed...)
+		result = append(result, copied)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Run applies policy to the runs missed while the server was down, then runs jobs as
+// they come due, checking every tick until ctx is done
+func Run(ctx context.Context, tick time.Duration, policy string) {
+	CatchUp(time.Now(), policy)
+
+	var ticker *time.Ticker = time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			runDue(now)
+		}
+	}
+}
+
+// CatchUp finds the runs every job missed before now and skips or runs them as policy says
+func CatchUp(now time.Time, policy string) {
+	type pending struct {
+		job   *Job
+		times []time.Time
+	}
+	var catchUp []pending
+
+	mu.Lock()
+	for _, job := range jobs {
+		var missed []time.Time
+		for next := job.NextRunAt; !next.After(now); next = next.Add(job.Interval) {
+			missed = append(missed, next)
+		}
+		if len(missed) == 0 {
+			continue
+		}
+
+		var run []time.Time
+		switch policy {
+		case config.MissedRunsOnce:
+			run = missed[len(missed)-1:]
+		case config.MissedRunsAll:
+			run = missed[max(0, len(missed)-maxCatchUp):]
+		}
+
+		for _, scheduledAt := range missed[:len(missed)-len(run)] {
+			recordMissedLocked(job, Missed{ScheduledAt: scheduledAt, Action: MissedSkipped, DetectedAt: now})
+		}
+		for _, scheduledAt := range run {
+			recordMissedLocked(job, Missed{ScheduledAt: scheduledAt, Action: MissedRan, DetectedAt: now})
+		}
+		job.NextRunAt = missed[len(missed)-1].Add(job.Interval)
+
+		log.WithFields(log.Fields{
+			"job":    job.Name,
+			"missed": len(missed),
+			"run":    len(run),
+			"policy": policy,
+		}).Warn("Scheduled job missed runs while the server was down")
+
+		if len(run) > 0 {
+			catchUp = append(catchUp, pending{job: job, times: run})
+		}
+	}
+	saveLocked()
+	mu.Unlock()
+
+	for _, pending := range catchUp {
+		for _, scheduledAt := range pending.times {
+			execute(pending.job, scheduledAt)
+		}
+	}
+}
+
+// runDue runs every job whose next run is at or before now. Runs that came due while
+// a slow job was still running are folded into this one, as a ticker would.
+func runDue(now time.Time) {
+	type due struct {
+		job         *Job
+		scheduledAt time.Time
+	}
+	var runs []due
+
+	mu.Lock()
+	for _, job := range jobs {
+		if job.NextRunAt.After(now) {
+			continue
+		}
+		runs = append(runs, due{job: job, scheduledAt: job.NextRunAt})
+		for !job.NextRunAt.After(now) {
+			job.NextRunAt = job.NextRunAt.Add(job.Interval)
+		}
+	}
+	if len(runs) > 0 {
+		saveLocked()
+	}
+	mu.Unlock()
+
+	for _, run := range runs {
+		execute(run.job, run.scheduledAt)
+	}
+}
+
+func execute(job *Job, scheduledAt time.Time) {
+	job.run(scheduledAt)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	job.LastRunAt = time.Now()
+	saveLocked()
+}
+
+func recordMissedLocked(job *Job, missed Missed) {
+	job.Missed = append(job.Missed, missed)
+	if len(job.Missed) > maxMissed {
+		job.Missed = job.Missed[len(job.Missed)-maxMissed:]
+	}
+}
+
+// saveLocked writes every job's next-run time to the state file. Jobs in the file that
+// are not registered in this process are kept until Compact drops them.
+func saveLocked() {
+	if err := writeLocked(); err != nil {
+		log.Error("Failed to save scheduler state: ", err)
+	}
+}
+
+func writeLocked() error {
+	if statePath == "" {
+		return nil
+	}
+
+	for name, job := range jobs {
+		saved[name] = state{NextRunAt: job.NextRunAt, LastRunAt: job.LastRunAt}
+	}
+
+	content, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write then rename, so a crash mid-write leaves the previous state intact
+	var temporary string = statePath + ".tmp"
+	err = os.WriteFile(temporary, content, 0o600)
+	if err == nil {
+		err = os.Rename(temporary, statePath)
+	}
+	return err
+}
+
+// Compact drops jobs that are not registered in this process and haven't run since
+// now minus retention from the state file. Returns the file's size in bytes before
+// and after.
+func Compact(now time.Time, retention time.Duration) (int64, int64, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var before int64 = fileSize(statePath)
+	var dropped []string
+	for name, previous := range saved {
+		var last time.Time = previous.LastRunAt
+		if last.IsZero() {
+			last = previous.NextRunAt
+		}
+		if _, ok := jobs[name]; !ok && last.Before(now.Add(-retention)) {
+			delete(saved, name)
+			dropped = append(dropped, name)
+		}
+	}
+	if len(dropped) == 0 {
+		return before, before, nil
+	}
+
+	err := writeLocked()
+	if err != nil {
+		return before, before, fmt.Errorf("compacting scheduler state: %w", err)
+	}
+	log.Info("Compacted scheduler state, dropped ", dropped)
+	return before, fileSize(statePath), nil
+}
+
+// fileSize is the size of the file at path, 0 if there is none
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
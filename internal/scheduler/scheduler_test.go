@@ -0,0 +1,141 @@
+package scheduler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+)
+
+func TestCatchUp(t *testing.T) {
+	var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Simulates a restart: the state file says the job was due 3.5 hours ago
+	var restart = func(t *testing.T, policy string) ([]time.Time, string) {
+		var path string = filepath.Join(t.TempDir(), "schedule.json")
+		var content = `{"hourly": {"NextRunAt": "2026-03-01T08:30:00Z", "LastRunAt": "2026-03-01T07:30:00Z"}}`
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write state: %v", err)
+		}
+
+		mu.Lock()
+		jobs = map[string]*Job{}
+		mu.Unlock()
+		t.Cleanup(func() {
+			mu.Lock()
+			jobs = map[string]*Job{}
+			mu.Unlock()
+			Load("")
+		})
+
+		if err := Load(path); err != nil {
+			t.Fatalf("Failed to load state: %v", err)
+		}
+
+		var ran []time.Time
+		Register("hourly", time.Hour, func(scheduledAt time.Time) { ran = append(ran, scheduledAt) })
+		CatchUp(now, policy)
+		return ran, path
+	}
+
+	t.Run("Skip", func(t *testing.T) {
+		ran, _ := restart(t, config.MissedRunsSkip)
+		if len(ran) != 0 {
+			t.Errorf("Expected no runs, got %v", ran)
+		}
+
+		var job Job = Jobs()[0]
+		if len(job.Missed) != 4 || job.Missed[0].Action != MissedSkipped {
+			t.Errorf("Expected 4 skipped runs, got %+v", job.Missed)
+		}
+		if !job.NextRunAt.Equal(now.Add(30 * time.Minute)) {
+			t.Errorf("Expected the next run at 12:30, got %s", job.NextRunAt)
+		}
+	})
+
+	t.Run("Once", func(t *testing.T) {
+		ran, _ := restart(t, config.MissedRunsOnce)
+		if len(ran) != 1 || !ran[0].Equal(now.Add(-30*time.Minute)) {
+			t.Errorf("Expected one run for 11:30, got %v", ran)
+		}
+
+		var job Job = Jobs()[0]
+		if job.Missed[2].Action != MissedSkipped || job.Missed[3].Action != MissedRan {
+			t.Errorf("Expected earlier runs skipped and the latest ran, got %+v", job.Missed)
+		}
+	})
+
+	t.Run("All_Survives_Restart", func(t *testing.T) {
+		ran, path := restart(t, config.MissedRunsAll)
+		if len(ran) != 4 || !ran[0].Equal(now.Add(-210*time.Minute)) {
+			t.Errorf("Expected 4 runs from 08:30, got %v", ran)
+		}
+
+		// The new next-run time is on disk for the next restart
+		if err := Load(path); err != nil {
+			t.Fatalf("Failed to reload state: %v", err)
+		}
+		if next := saved["hourly"].NextRunAt; !next.Equal(now.Add(30 * time.Minute)) {
+			t.Errorf("Expected 12:30 persisted, got %s", next)
+		}
+	})
+
+	t.Run("Nothing_Missed", func(t *testing.T) {
+		mu.Lock()
+		jobs = map[string]*Job{}
+		mu.Unlock()
+		Load("")
+
+		var runs int
+		Register("fresh", time.Hour, func(time.Time) { runs++ })
+		CatchUp(time.Now(), config.MissedRunsAll)
+		if runs != 0 || len(Jobs()[0].Missed) != 0 {
+			t.Errorf("Expected a new job to miss nothing, got %d runs", runs)
+		}
+
+		mu.Lock()
+		jobs = map[string]*Job{}
+		mu.Unlock()
+	})
+}
+
+func TestCompact(t *testing.T) {
+	var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var path string = filepath.Join(t.TempDir(), "schedule.json")
+	var content = `{
+		"hourly": {"NextRunAt": "2026-03-01T13:00:00Z", "LastRunAt": "2026-03-01T12:00:00Z"},
+		"renamed": {"NextRunAt": "2026-01-01T01:00:00Z", "LastRunAt": "2026-01-01T00:00:00Z"},
+		"paused": {"NextRunAt": "2026-02-28T13:00:00Z", "LastRunAt": "2026-02-28T12:00:00Z"}
+	}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write state: %v", err)
+	}
+
+	mu.Lock()
+	jobs = map[string]*Job{}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		jobs = map[string]*Job{}
+		mu.Unlock()
+		Load("")
+	})
+	if err := Load(path); err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	Register("hourly", time.Hour, func(time.Time) {})
+
+	// Only the job gone for longer than the retention is dropped
+	before, after, err := Compact(now, 30*24*time.Hour)
+	if err != nil || after >= before {
+		t.Fatalf("Expected the file to shrink, %d to %d bytes: %v", before, after, err)
+	}
+	if err := Load(path); err != nil {
+		t.Fatalf("Failed to reload state: %v", err)
+	}
+	if _, ok := saved["renamed"]; ok || len(saved) != 2 {
+		t.Errorf("Expected hourly and paused kept, got %+v", saved)
+	}
+}
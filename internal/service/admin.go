@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// The longest reason an admin can give, as for freezes
+const maxAdjustmentReason = 256
+
+var (
+	ErrInvalidRole       = fmt.Errorf("role must be %s, %s or %s", tools.RoleUser, tools.RoleAdmin, tools.RoleAuditor)
+	ErrInvalidAdjustment = errors.New("invalid adjustment")
+)
+
+// User is one account as the admin list shows it
+type User struct {
+	Username string
+	Role     string
+	Balance  int64
+	Frozen   bool
+}
+
+// Users lists up to limit accounts after after, in username order. The last username
+// is after for the next page, an empty page is the end.
+func (s *Service) Users(ctx context.Context, after string, limit int) ([]User, error) {
+	coins, err := s.database.ListUserCoins(ctx, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var users = make([]User, 0, len(coins))
+	for _, details := range coins {
+		var user = User{Username: details.Username, Balance: details.Coins, Frozen: details.Frozen}
+		if login := s.database.GetUserLoginDetails(details.Username); login != nil {
+			user.Role = login.Role
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// CreateAccount opens username with role and a new static token, for by. Unlike
+// Signup there is no bonus and no session, and an admin can open admin and auditor
+// accounts.
+func (s *Service) CreateAccount(username string, role string, by string) (tools.LoginDetails, error) {
+	if !usernamePattern.MatchString(username) {
+		return tools.LoginDetails{}, ErrInvalidUsername
+	}
+	if role == "" {
+		role = tools.RoleUser
+	}
+	if role != tools.RoleUser && role != tools.RoleAdmin && role != tools.RoleAuditor {
+		return tools.LoginDetails{}, ErrInvalidRole
+	}
+
+	var login = tools.LoginDetails{Username: username, AuthToken: newAuthToken(), Role: role}
+	_, err := s.database.CreateUser(login)
+	if err != nil {
+		return tools.LoginDetails{}, err
+	}
+
+	log.Info("Account ", username, " opened by admin ", by, " with role ", role)
+	events.Record(s.database, events.AccountCreated, username, map[string]interface{}{
+		"provisioned_by": "admin",
+		"by":             by,
+		"role":           role,
+	})
+	return login, nil
+}
+
+// AdjustBalance credits username amount coins, or debits them when amount is
+// negative, and records the admin's reason as a balance_adjusted event. The ledger
+// entry is an ordinary deposit or withdrawal, the event says why.
+func (s *Service) AdjustBalance(username string, amount int64, reason string, by string) (*tools.CoinDetails, error) {
+	if amount == 0 {
+		return nil, fmt.Errorf("%w: amount must not be zero", ErrInvalidAdjustment)
+	}
+	if reason == "" || len(reason) > maxAdjustmentReason {
+		return nil, fmt.Errorf("%w: reason is required and at most %d characters", ErrInvalidAdjustment, maxAdjustmentReason)
+	}
+
+	var details *tools.CoinDetails
+	var err error
+	if amount > 0 {
+		details, err = s.database.AddUserCoins(username, amount)
+	} else {
+		details, err = s.database.WithdrawUserCoins(username, -amount)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"account": username,
+		"amount":  amount,
+		"balance": details.Coins,
+		"by":      by,
+	}).Warn("Balance adjusted by an admin: ", reason)
+	events.Record(s.database, events.BalanceAdjusted, username, map[string]interface{}{
+		"amount":  amount,
+		"balance": details.Coins,
+		"reason":  reason,
+		"by":      by,
+	})
+	return details, nil
+}
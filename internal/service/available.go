@@ -0,0 +1,84 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/bryantjandra/goapi/internal/freezes"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// FrozenFundsError means the balance covers the amount but frozen funds don't leave enough
+type FrozenFundsError struct {
+	Balance   int64
+	Frozen    int64
+	Available int64
+}
+
+func (e *FrozenFundsError) Error() string {
+	return fmt.Sprintf("only %d of your %d coins are available, %d are frozen pending investigation", e.Available, e.Balance, e.Frozen)
+}
+
+// AccountFrozenError means an admin froze the whole account, nothing can leave it
+type AccountFrozenError struct {
+	Reason string
+}
+
+func (e *AccountFrozenError) Error() string {
+	return "your account is frozen pending investigation, no coins can be sent or withdrawn"
+}
+
+// Unwrap makes it the storage layer's tools.ErrAccountFrozen too, whichever refused it
+func (e *AccountFrozenError) Unwrap() error {
+	return tools.ErrAccountFrozen
+}
+
+// ReservedFundsError means netted transfers still waiting to settle, gifts still
+// waiting to be accepted, payment holds not yet captured or reservations not yet
+// committed have reserved too much of the balance
+type ReservedFundsError struct {
+	Balance   int64
+	Reserved  int64
+	Available int64
+}
+
+func (e *ReservedFundsError) Error() string {
+	return fmt.Sprintf("only %d of your %d coins are available, %d are reserved by netted transfers, gifts, payment holds and reservations awaiting settlement", e.Available, e.Balance, e.Reserved)
+}
+
+// CheckAvailable returns an *AccountFrozenError when the whole account is frozen, a
+// *FrozenFundsError when a partial freeze is what stops username from moving amount,
+// and a *ReservedFundsError when reservations are. Unknown users and plain
+// insufficient funds are left to the storage layer to report.
+//
+// It only explains a refusal ahead of time. Storage checks the frozen flag and what
+// holds set aside again in the step that moves the coins, so a freeze placed after
+// this check still stops the debit.
+func (s *Service) CheckAvailable(username string, amount int64) error {
+	coins, err := s.database.GetUserCoins(username)
+	if err != nil {
+		return nil
+	}
+	if coins.Frozen {
+		freeze, err := freezes.AccountFreezeOf(s.database, username)
+		if err != nil {
+			return err
+		}
+		return &AccountFrozenError{Reason: freeze.Reason}
+	}
+	if amount > coins.Coins {
+		return nil
+	}
+
+	frozen, err := freezes.Frozen(s.database, username)
+	if err != nil {
+		return err
+	}
+	unfrozen := max(0, coins.Coins-frozen)
+	if amount > unfrozen {
+		return &FrozenFundsError{Balance: coins.Coins, Frozen: frozen, Available: unfrozen}
+	}
+	if available := coins.Available(); amount > available {
+		return &ReservedFundsError{Balance: coins.Coins, Reserved: unfrozen - available, Available: available}
+	}
+	return nil
+}
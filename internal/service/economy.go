@@ -0,0 +1,60 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// Coins created and destroyed on one UTC day, broken down by transaction type
+type EconomyDay struct {
+	Date      string
+	Sources   map[string]int64
+	Sinks     map[string]int64
+	Created   int64
+	Destroyed int64
+	Net       int64
+}
+
+// EconomyReport aggregates successful source and sink transactions per UTC day
+// for days in [from, to], oldest first
+func (s *Service) EconomyReport(from time.Time, to time.Time) []EconomyDay {
+	var days = map[string]*EconomyDay{}
+
+	for _, tx := range s.database.GetAllTransactions() {
+		if tx.Status != "SUCCESS" || tx.Flow == tools.FlowNeutral {
+			continue
+		}
+		if tx.Timestamp.Before(from) || tx.Timestamp.After(to) {
+			continue
+		}
+
+		date := tx.Timestamp.UTC().Format(time.DateOnly)
+		day, ok := days[date]
+		if !ok {
+			day = &EconomyDay{Date: date, Sources: map[string]int64{}, Sinks: map[string]int64{}}
+			days[date] = day
+		}
+
+		switch tx.Flow {
+		case tools.FlowSource:
+			day.Sources[tx.Type] += tx.Amount
+			day.Created += tx.Amount
+		case tools.FlowSink:
+			day.Sinks[tx.Type] += tx.Amount
+			day.Destroyed += tx.Amount
+		}
+		day.Net = day.Created - day.Destroyed
+	}
+
+	var report = make([]EconomyDay, 0, len(days))
+	for _, day := range days {
+		report = append(report, *day)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Date < report[j].Date
+	})
+
+	return report
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/bryantjandra/goapi/internal/policy"
+)
+
+// LimitError means the policy's per-transaction or daily limit refuses the amount
+type LimitError struct {
+	Reason string
+	Limit  int64
+}
+
+func (e *LimitError) Error() string {
+	if e.Reason == BlockedDailyLimit {
+		return fmt.Sprintf("at most %d coins can be sent per day", e.Limit)
+	}
+	return fmt.Sprintf("at most %d coins can be sent in one transfer", e.Limit)
+}
+
+// limitBlocks lists the policy limits amount would exceed, and what username can still
+// send today
+func (s *Service) limitBlocks(username string, amount int64) ([]*LimitError, int64) {
+	limits, ok := policy.LimitsFor(s.database, policy.DefaultCurrency, policy.DefaultTier)
+	if !ok {
+		return nil, 0
+	}
+
+	var blocks []*LimitError
+	if amount > limits.MaxTransaction {
+		blocks = append(blocks, &LimitError{Reason: BlockedMaxTransaction, Limit: limits.MaxTransaction})
+	}
+	var remaining int64 = max(0, limits.DailyLimit-s.OutgoingToday(username))
+	if amount > remaining {
+		blocks = append(blocks, &LimitError{Reason: BlockedDailyLimit, Limit: limits.DailyLimit})
+	}
+	return blocks, remaining
+}
+
+// CheckLimits returns a *LimitError when sending amount from username would exceed the
+// policy's per-transaction or daily limit
+func (s *Service) CheckLimits(username string, amount int64) error {
+	if blocks, _ := s.limitBlocks(username, amount); len(blocks) > 0 {
+		return blocks[0]
+	}
+	return nil
+}
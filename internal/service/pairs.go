@@ -0,0 +1,178 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/policy"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// Pair limit reasons, reported alongside the PrecheckTransfer reasons
+const (
+	BlockedPairHourlyCount  = "pair_hourly_count"
+	BlockedPairHourlyAmount = "pair_hourly_amount"
+	BlockedPairDailyCount   = "pair_daily_count"
+	BlockedPairDailyAmount  = "pair_daily_amount"
+)
+
+// Unlimited is reported as the remaining allowance of a window without a cap
+const Unlimited int64 = -1
+
+type PairAllowance struct {
+	Allowed   bool
+	BlockedBy []string
+
+	HourlyCountRemaining  int64
+	HourlyAmountRemaining int64
+	DailyCountRemaining   int64
+	DailyAmountRemaining  int64
+
+	// Earliest time the transfer would fit, zero if it fits now or never will
+	RetryAt time.Time
+}
+
+// PairLimitError is returned by CheckPairLimits when a transfer would exceed a pair cap
+type PairLimitError struct {
+	From      string
+	To        string
+	Allowance PairAllowance
+}
+
+func (e *PairLimitError) Error() string {
+	var message = fmt.Sprintf("transfer limit between %s and %s reached (%s): %s this hour, %s today",
+		e.From, e.To, strings.Join(e.Allowance.BlockedBy, ", "),
+		describeRemaining(e.Allowance.HourlyAmountRemaining, e.Allowance.HourlyCountRemaining),
+		describeRemaining(e.Allowance.DailyAmountRemaining, e.Allowance.DailyCountRemaining))
+
+	if !e.Allowance.RetryAt.IsZero() {
+		message += ", retry after " + e.Allowance.RetryAt.UTC().Format(time.RFC3339)
+	}
+	return message
+}
+
+func describeRemaining(amount int64, count int64) string {
+	var coins = "unlimited coins"
+	if amount != Unlimited {
+		coins = fmt.Sprintf("%d coins", amount)
+	}
+	var transfers = "unlimited transfers"
+	if count != Unlimited {
+		transfers = fmt.Sprintf("%d transfers", count)
+	}
+	return coins + " and " + transfers + " left"
+}
+
+// pairWindow tracks one rolling window against its caps
+type pairWindow struct {
+	length      time.Duration
+	countCap    int64
+	amountCap   int64
+	countCause  string
+	amountCause string
+}
+
+// PairAllowance reports what can still move between two accounts, counting successful
+// transfers in both directions over the last hour and the last 24 hours
+func (s *Service) PairAllowance(from string, to string, amount int64) PairAllowance {
+	var limits policy.PairLimits = policy.CurrentPairLimits(s.database)
+	var now = time.Now()
+	var windows = []pairWindow{
+		{time.Hour, limits.HourlyCount, limits.HourlyAmount, BlockedPairHourlyCount, BlockedPairHourlyAmount},
+		{24 * time.Hour, limits.DailyCount, limits.DailyAmount, BlockedPairDailyCount, BlockedPairDailyAmount},
+	}
+
+	// Only the last, longest window's transfers are read, oldest first for the retry
+	// calculation, which walks them in order
+	var oldest = now.Add(-windows[len(windows)-1].length)
+	var transfers []tools.TransactionLog
+	s.recent(from, func(tx tools.TransactionLog) bool {
+		if !tx.Timestamp.After(oldest) {
+			return false
+		}
+		if tx.Type == "TRANSFER" && tx.Status == "SUCCESS" && ((tx.From == from && tx.To == to) || (tx.From == to && tx.To == from)) {
+			transfers = append(transfers, tx)
+		}
+		return true
+	})
+	slices.SortStableFunc(transfers, func(a, b tools.TransactionLog) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	var allowance = PairAllowance{BlockedBy: []string{}}
+
+	for i, window := range windows {
+		// Sorted by time, so the window is a suffix of transfers
+		var since = now.Add(-window.length)
+		var inWindow = transfers[sort.Search(len(transfers), func(i int) bool {
+			return transfers[i].Timestamp.After(since)
+		}):]
+		var used int64
+		for _, tx := range inWindow {
+			used += tx.Amount
+		}
+
+		var countRemaining, amountRemaining = Unlimited, Unlimited
+		if window.countCap > 0 {
+			countRemaining = max(window.countCap-int64(len(inWindow)), 0)
+			if countRemaining == 0 {
+				allowance.BlockedBy = append(allowance.BlockedBy, window.countCause)
+				allowance.RetryAt = later(allowance.RetryAt, inWindow[0].Timestamp.Add(window.length))
+			}
+		}
+		if window.amountCap > 0 {
+			amountRemaining = max(window.amountCap-used, 0)
+			if amount > amountRemaining {
+				allowance.BlockedBy = append(allowance.BlockedBy, window.amountCause)
+				if amount <= window.amountCap {
+					allowance.RetryAt = later(allowance.RetryAt, amountFreesAt(inWindow, window, amount-amountRemaining))
+				}
+			}
+		}
+
+		if i == 0 {
+			allowance.HourlyCountRemaining, allowance.HourlyAmountRemaining = countRemaining, amountRemaining
+		} else {
+			allowance.DailyCountRemaining, allowance.DailyAmountRemaining = countRemaining, amountRemaining
+		}
+	}
+
+	// A transfer bigger than a cap never fits, a retry time would be misleading
+	if (limits.HourlyAmount > 0 && amount > limits.HourlyAmount) || (limits.DailyAmount > 0 && amount > limits.DailyAmount) {
+		allowance.RetryAt = time.Time{}
+	}
+
+	allowance.Allowed = len(allowance.BlockedBy) == 0
+	return allowance
+}
+
+// amountFreesAt returns when enough of the window's oldest transfers age out to free need coins
+func amountFreesAt(inWindow []tools.TransactionLog, window pairWindow, need int64) time.Time {
+	var freed int64
+	for _, tx := range inWindow {
+		freed += tx.Amount
+		if freed >= need {
+			return tx.Timestamp.Add(window.length)
+		}
+	}
+	return time.Time{}
+}
+
+func later(a time.Time, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// CheckPairLimits returns a *PairLimitError when the transfer would exceed a pair cap
+func (s *Service) CheckPairLimits(from string, to string, amount int64) error {
+	allowance := s.PairAllowance(from, to, amount)
+	if !allowance.Allowed {
+		return &PairLimitError{From: from, To: to, Allowance: allowance}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/dormancy"
+	"github.com/bryantjandra/goapi/internal/exports"
+	"github.com/bryantjandra/goapi/internal/freezes"
+	"github.com/bryantjandra/goapi/internal/gifts"
+	"github.com/bryantjandra/goapi/internal/holds"
+	"github.com/bryantjandra/goapi/internal/netting"
+	"github.com/bryantjandra/goapi/internal/privacy"
+	"github.com/bryantjandra/goapi/internal/reservations"
+)
+
+// Hold kinds
+const (
+	HoldFreeze      = "freeze"
+	HoldNetting     = "netting"
+	HoldGift        = "gift"
+	HoldPayment     = "payment"
+	HoldReservation = "reservation"
+)
+
+// Pending operation kinds
+const (
+	PendingDataDeletion      = "data_deletion"
+	PendingEscheatSweep      = "escheat_sweep"
+	PendingTransactionExport = "transaction_export"
+	PendingNettedTransfers   = "netted_transfers"
+	PendingGift              = "gift"
+	PendingPaymentHold       = "payment_hold"
+	PendingReservation       = "reservation"
+)
+
+// Hold is part of the balance that can't be spent until it is released
+type Hold struct {
+	ID       string
+	Kind     string
+	Amount   int64
+	Reason   string
+	PlacedAt time.Time
+}
+
+// Holds explains why Available is less than Balance, Held is the sum of the holds
+type Holds struct {
+	Balance   int64
+	Available int64
+	Held      int64
+	Holds     []Hold
+}
+
+// PendingOperation is something started for the account that hasn't finished. Amount
+// is what it would take out of the balance once it does, 0 for none.
+type PendingOperation struct {
+	ID          string
+	Kind        string
+	Status      string
+	Amount      int64
+	Description string
+	CreatedAt   time.Time
+}
+
+// Holds lists the active holds on the account, oldest first
+func (s *Service) Holds(username string) (Holds, error) {
+	coins, err := s.database.GetUserCoins(username)
+	if err != nil {
+		return Holds{}, err
+	}
+
+	var available int64 = coins.Available()
+	active, err := freezes.List(s.database, username)
+	if err != nil {
+		return Holds{}, err
+	}
+
+	var result = Holds{
+		Balance:   coins.Coins,
+		Available: available,
+		Holds:     []Hold{},
+	}
+	result.Held = result.Balance - result.Available
+
+	for _, freeze := range active {
+		if !freeze.Active {
+			continue
+		}
+		result.Holds = append(result.Holds, Hold{
+			ID:       freeze.ID,
+			Kind:     HoldFreeze,
+			Amount:   freeze.Amount,
+			Reason:   freeze.Reason,
+			PlacedAt: freeze.History[0].At,
+		})
+	}
+	windows, err := netting.Open(s.database, username)
+	if err != nil {
+		return Holds{}, err
+	}
+	for _, window := range windows {
+		if outgoing := window.Outgoing(username); outgoing > 0 {
+			result.Holds = append(result.Holds, Hold{
+				ID:       window.ID,
+				Kind:     HoldNetting,
+				Amount:   outgoing,
+				Reason:   fmt.Sprintf("Netted transfers settling at %s", window.ClosesAt.UTC().Format(time.RFC3339)),
+				PlacedAt: window.OpenedAt,
+			})
+		}
+	}
+	sent, err := gifts.Open(s.database, username)
+	if err != nil {
+		return Holds{}, err
+	}
+	for _, gift := range sent {
+		if gift.From == username {
+			result.Holds = append(result.Holds, Hold{
+				ID:       gift.ID,
+				Kind:     HoldGift,
+				Amount:   gift.Amount,
+				Reason:   fmt.Sprintf("Gift to %s, returned unless accepted by %s", gift.To, gift.ExpiresAt.UTC().Format(time.RFC3339)),
+				PlacedAt: gift.SentAt,
+			})
+		}
+	}
+	payments, err := holds.Open(s.database, username)
+	if err != nil {
+		return Holds{}, err
+	}
+	for _, hold := range payments {
+		if hold.From == username {
+			result.Holds = append(result.Holds, Hold{
+				ID:       hold.ID,
+				Kind:     HoldPayment,
+				Amount:   hold.Amount,
+				Reason:   fmt.Sprintf("Payment to %s, released unless captured by %s", hold.To, hold.ExpiresAt.UTC().Format(time.RFC3339)),
+				PlacedAt: hold.PlacedAt,
+			})
+		}
+	}
+	reserved, err := reservations.List(s.database, username, false)
+	if err != nil {
+		return Holds{}, err
+	}
+	for _, reservation := range reserved {
+		result.Holds = append(result.Holds, Hold{
+			ID:       reservation.ID,
+			Kind:     HoldReservation,
+			Amount:   reservation.Amount,
+			Reason:   fmt.Sprintf("Reserved for %s, released unless committed by %s", reservation.Reference, reservation.ExpiresAt.UTC().Format(time.RFC3339)),
+			PlacedAt: reservation.ReservedAt,
+		})
+	}
+	return result, nil
+}
+
+// PendingOperations lists what is waiting on an approval or still running for the
+// account, oldest first. Transfers settle immediately unless they were netted, sent
+// as gifts or authorized as payment holds, and purchases unless coins were reserved.
+func (s *Service) PendingOperations(username string) ([]PendingOperation, error) {
+	if _, err := s.database.GetUserCoins(username); err != nil {
+		return nil, err
+	}
+
+	var operations = []PendingOperation{}
+	for _, request := range privacy.List(s.database) {
+		if request.Username == username && request.Status == privacy.StatusPending {
+			operations = append(operations, PendingOperation{
+				ID:          request.ID,
+				Kind:        PendingDataDeletion,
+				Status:      request.Status,
+				Description: "Deletion of your personal data, waiting for an admin to approve it",
+				CreatedAt:   request.RequestedAt,
+			})
+		}
+	}
+
+	for _, sweep := range dormancy.Sweeps() {
+		if sweep.Status != dormancy.SweepPending {
+			continue
+		}
+		for _, item := range sweep.Items {
+			if item.Account == username && item.Status == dormancy.ItemProposed {
+				operations = append(operations, PendingOperation{
+					ID:          sweep.ID,
+					Kind:        PendingEscheatSweep,
+					Status:      sweep.Status,
+					Amount:      item.Amount,
+					Description: fmt.Sprintf("Dormant balance proposed for transfer to %s, any activity before it is approved cancels it", sweep.To),
+					CreatedAt:   sweep.ProposedAt,
+				})
+			}
+		}
+	}
+
+	windows, err := netting.Open(s.database, username)
+	if err != nil {
+		return nil, err
+	}
+	for _, window := range windows {
+		var operation = PendingOperation{
+			ID:          window.ID,
+			Kind:        PendingNettedTransfers,
+			Status:      netting.StatusOpen,
+			Description: fmt.Sprintf("%d netted transfers between %s and %s, settling at %s", window.Transfers, window.A, window.B, window.ClosesAt.UTC().Format(time.RFC3339)),
+			CreatedAt:   window.OpenedAt,
+		}
+		if from, _, amount := window.Net(); from == username {
+			operation.Amount = amount
+		}
+		operations = append(operations, operation)
+	}
+
+	open, err := gifts.Open(s.database, username)
+	if err != nil {
+		return nil, err
+	}
+	for _, gift := range open {
+		var operation = PendingOperation{
+			ID:          gift.ID,
+			Kind:        PendingGift,
+			Status:      gift.Status,
+			Description: fmt.Sprintf("Gift of %d from %s, accept it by %s", gift.Amount, gift.From, gift.ExpiresAt.UTC().Format(time.RFC3339)),
+			CreatedAt:   gift.SentAt,
+		}
+		if gift.From == username {
+			operation.Amount = gift.Amount
+			operation.Description = fmt.Sprintf("Gift of %d to %s, returned unless accepted by %s", gift.Amount, gift.To, gift.ExpiresAt.UTC().Format(time.RFC3339))
+		}
+		operations = append(operations, operation)
+	}
+
+	payments, err := holds.Open(s.database, username)
+	if err != nil {
+		return nil, err
+	}
+	for _, hold := range payments {
+		var operation = PendingOperation{
+			ID:          hold.ID,
+			Kind:        PendingPaymentHold,
+			Status:      hold.Status,
+			Description: fmt.Sprintf("Payment of up to %d from %s, capture it by %s", hold.Amount, hold.From, hold.ExpiresAt.UTC().Format(time.RFC3339)),
+			CreatedAt:   hold.PlacedAt,
+		}
+		if hold.From == username {
+			operation.Amount = hold.Amount
+			operation.Description = fmt.Sprintf("Payment of up to %d to %s, released unless captured by %s", hold.Amount, hold.To, hold.ExpiresAt.UTC().Format(time.RFC3339))
+		}
+		operations = append(operations, operation)
+	}
+
+	reserved, err := reservations.List(s.database, username, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, reservation := range reserved {
+		operations = append(operations, PendingOperation{
+			ID:          reservation.ID,
+			Kind:        PendingReservation,
+			Status:      reservation.Status,
+			Amount:      reservation.Amount,
+			Description: fmt.Sprintf("Coins reserved for %s, released unless committed by %s", reservation.Reference, reservation.ExpiresAt.UTC().Format(time.RFC3339)),
+			CreatedAt:   reservation.ReservedAt,
+		})
+	}
+
+	for _, job := range exports.List(s.database, username) {
+		if job.Status == exports.StatusPending {
+			operations = append(operations, PendingOperation{
+				ID:          job.ID,
+				Kind:        PendingTransactionExport,
+				Status:      job.Status,
+				Description: "Transaction export being prepared",
+				CreatedAt:   job.CreatedAt,
+			})
+		}
+	}
+
+	sort.SliceStable(operations, func(i, j int) bool {
+		return operations[i].CreatedAt.Before(operations[j].CreatedAt)
+	})
+	return operations, nil
+}
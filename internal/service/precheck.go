@@ -0,0 +1,124 @@
+package service
+
+import (
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/freezes"
+	"github.com/bryantjandra/goapi/internal/netting"
+	"github.com/bryantjandra/goapi/internal/profiles"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// Reasons a transfer would be refused, reported by PrecheckTransfer
+const (
+	BlockedInvalidAmount     = "invalid_amount"
+	BlockedSelfTransfer      = "self_transfer"
+	BlockedUnknownSender     = "unknown_sender"
+	BlockedUnknownRecipient  = "unknown_recipient"
+	BlockedInsufficientFunds = "insufficient_funds"
+	BlockedMaxTransaction    = "max_transaction"
+	BlockedDailyLimit        = "daily_limit"
+	BlockedFrozen            = "frozen"
+	BlockedFrozenFunds       = "frozen_funds"
+	BlockedReservedFunds     = "reserved_funds"
+)
+
+type TransferVerdict struct {
+	Allowed   bool
+	BlockedBy []string
+
+	// What the sender could still move right now
+	Available      int64
+	DailyRemaining int64
+	Pair           PairAllowance
+
+	// Set while the sender's account is on probation
+	ProbationEndsAt time.Time
+}
+
+// PrecheckTransfer reports every reason a transfer would be refused without moving
+// any coins or writing to the audit log. An error means the freezes couldn't be read.
+func (s *Service) PrecheckTransfer(from string, to string, amount int64) (TransferVerdict, error) {
+	var verdict = TransferVerdict{BlockedBy: []string{}}
+
+	if amount <= 0 {
+		verdict.BlockedBy = append(verdict.BlockedBy, BlockedInvalidAmount)
+	}
+	if from == to {
+		verdict.BlockedBy = append(verdict.BlockedBy, BlockedSelfTransfer)
+	}
+
+	if _, err := s.database.GetUserCoins(to); err != nil {
+		verdict.BlockedBy = append(verdict.BlockedBy, BlockedUnknownRecipient)
+	}
+
+	fromCoins, err := s.database.GetUserCoins(from)
+	if err != nil {
+		verdict.BlockedBy = append(verdict.BlockedBy, BlockedUnknownSender)
+		return verdict, nil
+	}
+
+	// An admin froze the whole account, storage refuses any debit
+	if fromCoins.Frozen {
+		verdict.BlockedBy = append(verdict.BlockedBy, BlockedFrozen)
+	}
+
+	frozen, err := freezes.Frozen(s.database, from)
+	if err != nil {
+		return verdict, err
+	}
+	var unfrozen int64 = max(0, fromCoins.Coins-frozen)
+	verdict.Available = fromCoins.Available()
+	if amount > fromCoins.Coins {
+		verdict.BlockedBy = append(verdict.BlockedBy, BlockedInsufficientFunds)
+	} else if amount > unfrozen {
+		verdict.BlockedBy = append(verdict.BlockedBy, BlockedFrozenFunds)
+	} else if amount > verdict.Available {
+		verdict.BlockedBy = append(verdict.BlockedBy, BlockedReservedFunds)
+	}
+
+	blocks, remaining := s.limitBlocks(from, amount)
+	verdict.DailyRemaining = remaining
+	for _, block := range blocks {
+		verdict.BlockedBy = append(verdict.BlockedBy, block.Reason)
+	}
+
+	verdict.ProbationEndsAt = ProbationEndsAt(s.database, from, time.Now())
+	if !verdict.ProbationEndsAt.IsZero() {
+		for _, block := range s.probationBlocks(from, amount, verdict.ProbationEndsAt) {
+			verdict.BlockedBy = append(verdict.BlockedBy, block.Reason)
+		}
+	}
+
+	verdict.Pair = s.PairAllowance(from, to, amount)
+	verdict.BlockedBy = append(verdict.BlockedBy, verdict.Pair.BlockedBy...)
+
+	verdict.Allowed = len(verdict.BlockedBy) == 0
+	return verdict, nil
+}
+
+// OutgoingToday sums successful transfers and withdrawals from username since midnight
+// in the user's timezone, and what username sent in netted transfers opened since then
+// that haven't settled yet
+func (s *Service) OutgoingToday(username string) int64 {
+	var midnight time.Time = profiles.StartOfDay(s.database, username, time.Now())
+
+	var total int64
+	s.recent(username, func(tx tools.TransactionLog) bool {
+		if tx.Timestamp.Before(midnight) {
+			return false
+		}
+		if tx.From == username && tx.Status == "SUCCESS" && (tx.Type == "TRANSFER" || tx.Type == "WITHDRAWAL") {
+			total += tx.Amount
+		}
+		return true
+	})
+
+	windows, _ := netting.Open(s.database, username)
+	for _, window := range windows {
+		if !window.OpenedAt.Before(midnight) {
+			total += window.Outgoing(username)
+		}
+	}
+	return total
+}
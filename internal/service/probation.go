@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/policy"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// Probation reasons, reported alongside the PrecheckTransfer reasons
+const (
+	BlockedProbationMaxTransaction = "probation_max_transaction"
+	BlockedProbationDailyLimit     = "probation_daily_limit"
+)
+
+// ProbationError means a new account's stricter limits refuse the amount
+type ProbationError struct {
+	Reason string
+	Limit  int64
+	EndsAt time.Time
+}
+
+func (e *ProbationError) Error() string {
+	var scope = "per transaction"
+	if e.Reason == BlockedProbationDailyLimit {
+		scope = "per day"
+	}
+	return fmt.Sprintf("new accounts can move at most %d coins %s until their probation ends at %s",
+		e.Limit, scope, e.EndsAt.UTC().Format(time.RFC3339))
+}
+
+// OpenedAt returns when username's account was created, zero for accounts that weren't
+// opened through the API, such as seeded ones
+func OpenedAt(database tools.DatabaseInterface, username string) time.Time {
+	event, ok := events.First(database, events.AccountCreated, username)
+	if !ok {
+		return time.Time{}
+	}
+	return event.OccurredAt
+}
+
+// ProbationEndsAt returns when username's probation ends, zero if it isn't on probation
+func ProbationEndsAt(database tools.DatabaseInterface, username string, now time.Time) time.Time {
+	var probation policy.Probation = policy.CurrentProbation(database)
+	var opened time.Time = OpenedAt(database, username)
+	if probation.Days <= 0 || opened.IsZero() {
+		return time.Time{}
+	}
+
+	var endsAt time.Time = opened.AddDate(0, 0, probation.Days)
+	if !endsAt.After(now) {
+		return time.Time{}
+	}
+	return endsAt
+}
+
+// probationBlocks lists the probation limits amount would exceed
+func (s *Service) probationBlocks(username string, amount int64, endsAt time.Time) []*ProbationError {
+	var probation policy.Probation = policy.CurrentProbation(s.database)
+
+	var blocks []*ProbationError
+	if amount > probation.MaxTransaction {
+		blocks = append(blocks, &ProbationError{Reason: BlockedProbationMaxTransaction, Limit: probation.MaxTransaction, EndsAt: endsAt})
+	}
+	if s.OutgoingToday(username)+amount > probation.DailyLimit {
+		blocks = append(blocks, &ProbationError{Reason: BlockedProbationDailyLimit, Limit: probation.DailyLimit, EndsAt: endsAt})
+	}
+	return blocks
+}
+
+// CheckProbation returns a *ProbationError when username is on probation and moving
+// amount out would exceed its limits
+func (s *Service) CheckProbation(username string, amount int64) error {
+	var endsAt time.Time = ProbationEndsAt(s.database, username, time.Now())
+	if endsAt.IsZero() {
+		return nil
+	}
+
+	if blocks := s.probationBlocks(username, amount, endsAt); len(blocks) > 0 {
+		return blocks[0]
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// CheckScheduledTransfer runs the checks a transfer from the API gets for one the server
+// makes on from's behalf, such as a standing order. Unlike CheckAvailable it also
+// refuses plain insufficient funds, with tools.ErrInsufficientFunds.
+func (s *Service) CheckScheduledTransfer(from string, to string, amount int64) error {
+	coins, err := s.database.GetUserCoins(from)
+	if err != nil {
+		return err
+	}
+	if amount > coins.Coins {
+		return fmt.Errorf("%w: %d of %d coins", tools.ErrInsufficientFunds, coins.Coins, amount)
+	}
+
+	err = s.CheckAvailable(from, amount)
+	if err != nil {
+		return err
+	}
+	err = s.CheckProbation(from, amount)
+	if err != nil {
+		return err
+	}
+	err = s.CheckLimits(from, amount)
+	if err != nil {
+		return err
+	}
+	return s.CheckPairLimits(from, to, amount)
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/features"
+	"github.com/bryantjandra/goapi/internal/policy"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// ErrUserNotFound is the storage layer's, so either package's can be checked for
+var ErrUserNotFound = tools.ErrUserNotFound
+
+// Service assembles responses that need more than one store
+type Service struct {
+	database tools.DatabaseInterface
+	features features.Assignments
+}
+
+func New(database tools.DatabaseInterface) *Service {
+	return &Service{database: database}
+}
+
+// WithFeatures varies behavior by the request's experiment buckets
+func (s *Service) WithFeatures(assignments features.Assignments) *Service {
+	s.features = assignments
+	return s
+}
+
+// Number of transactions included in an account summary
+const summaryTransactionCount = 5
+
+// How many entries the walks through recent history read from storage at a time
+const historyBatch = 50
+
+// Alert codes raised on the account summary
+const (
+	AlertNearBalanceLimit = "near_balance_limit"
+	AlertZeroBalance      = "zero_balance"
+)
+
+type AccountSummary struct {
+	Username           string
+	Balance            int64
+	RecentTransactions []tools.TransactionLog
+	Limits             policy.Limits
+	Alerts             []string
+	Status             AccountStatus
+
+	// Set while the account is on probation
+	ProbationEndsAt time.Time
+}
+
+// AccountSummary collects everything a mobile home screen needs in one call
+func (s *Service) AccountSummary(username string) (*AccountSummary, error) {
+	coins, err := s.database.GetUserCoins(username)
+	if err != nil {
+		return nil, err
+	}
+	status, err := s.Status(*coins)
+	if err != nil {
+		return nil, err
+	}
+
+	var recent []tools.TransactionLog = s.database.GetTransactionHistoryPage(username, 0, summaryTransactionCount)
+
+	limits, _ := policy.LimitsFor(s.database, policy.DefaultCurrency, policy.DefaultTier)
+
+	var alerts = []string{}
+	if coins.Coins == 0 {
+		alerts = append(alerts, AlertZeroBalance)
+	}
+	// Treatment warns earlier, at 80% of the limit
+	var warnAt int64 = 9
+	if s.features.Enabled(features.EarlyBalanceWarning) {
+		warnAt = 8
+	}
+	if limits.MaxBalance > 0 && coins.Coins*10 >= limits.MaxBalance*warnAt {
+		alerts = append(alerts, AlertNearBalanceLimit)
+	}
+
+	return &AccountSummary{
+		Username:           username,
+		Balance:            coins.Coins,
+		RecentTransactions: recent,
+		Limits:             limits,
+		Alerts:             alerts,
+		Status:             status,
+		ProbationEndsAt:    ProbationEndsAt(s.database, username, time.Now()),
+	}, nil
+}
+
+// recent calls visit with username's entries newest first, reading a batch at a time,
+// until visit returns false or the history runs out. Walks that stop at a time window
+// only read what is inside it.
+func (s *Service) recent(username string, visit func(tx tools.TransactionLog) bool) {
+	var before int64
+	for {
+		var batch []tools.TransactionLog = s.database.GetTransactionHistoryPage(username, before, historyBatch)
+		for _, tx := range batch {
+			if !visit(tx) {
+				return
+			}
+		}
+		if len(batch) < historyBatch {
+			return
+		}
+		before = batch[len(batch)-1].SequenceFor(username)
+		if before <= 1 {
+			return
+		}
+	}
+}
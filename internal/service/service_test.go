@@ -0,0 +1,516 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/features"
+	"github.com/bryantjandra/goapi/internal/freezes"
+	"github.com/bryantjandra/goapi/internal/policy"
+	"github.com/bryantjandra/goapi/internal/privacy"
+	"github.com/bryantjandra/goapi/internal/tokens"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+func TestAccountSummary(t *testing.T) {
+	t.Run("Recent_Transactions_Newest_First", func(t *testing.T) {
+		database, err := tools.NewDatabase()
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+		db := *database
+
+		for i := int64(1); i <= 7; i++ {
+			db.AddUserCoins("aaron", i)
+		}
+
+		summary, err := New(db).AccountSummary("aaron")
+		if err != nil {
+			t.Fatalf("Failed to build summary: %v", err)
+		}
+
+		if len(summary.RecentTransactions) != summaryTransactionCount {
+			t.Fatalf("Expected %d transactions, got %d", summaryTransactionCount, len(summary.RecentTransactions))
+		}
+		if summary.RecentTransactions[0].Amount != 7 {
+			t.Errorf("Expected newest deposit of 7 first, got %d", summary.RecentTransactions[0].Amount)
+		}
+		if summary.Limits.MaxBalance == 0 {
+			t.Errorf("Expected limits from the default policy, got %+v", summary.Limits)
+		}
+	})
+
+	t.Run("Unknown_User", func(t *testing.T) {
+		database, err := tools.NewDatabase()
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+
+		_, err = New(*database).AccountSummary("nobody")
+		if err != ErrUserNotFound {
+			t.Errorf("Expected ErrUserNotFound, got %v", err)
+		}
+	})
+}
+
+func TestPrecheckTransfer(t *testing.T) {
+	database, err := tools.NewDatabase()
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db := *database
+
+	t.Run("Reports_Every_Reason", func(t *testing.T) {
+		bryan, _ := db.GetUserCoins("bryan")
+		var before int64 = bryan.Coins
+
+		verdict, _ := New(db).PrecheckTransfer("bryan", "bryan", before+1)
+
+		if verdict.Allowed {
+			t.Fatalf("Expected transfer to be blocked")
+		}
+		for _, reason := range []string{BlockedSelfTransfer, BlockedInsufficientFunds} {
+			found := false
+			for _, blocked := range verdict.BlockedBy {
+				found = found || blocked == reason
+			}
+			if !found {
+				t.Errorf("Expected %s in %v", reason, verdict.BlockedBy)
+			}
+		}
+
+		if bryan, _ = db.GetUserCoins("bryan"); bryan.Coins != before {
+			t.Errorf("Precheck must not move coins")
+		}
+	})
+
+	t.Run("Allowed_Transfer", func(t *testing.T) {
+		verdict, _ := New(db).PrecheckTransfer("bryan", "aaron", 1)
+		if !verdict.Allowed || len(verdict.BlockedBy) != 0 {
+			t.Errorf("Expected transfer to be allowed, got %+v", verdict)
+		}
+	})
+}
+
+func TestEconomyReport(t *testing.T) {
+	database, err := tools.NewDatabase()
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db := *database
+
+	db.AddUserCoins("aaron", 100)
+	db.WithdrawUserCoins("aaron", 30)
+	db.TransferUserCoins("aaron", "bryan", 10)
+	db.WithdrawUserCoins("aaron", 1000000) // fails, must not count
+
+	report := New(db).EconomyReport(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if len(report) != 1 {
+		t.Fatalf("Expected one day in the report, got %d", len(report))
+	}
+
+	day := report[0]
+	if day.Created != 100 || day.Destroyed != 30 || day.Net != 70 {
+		t.Errorf("Expected created 100, destroyed 30, net 70, got %+v", day)
+	}
+	if day.Sources["DEPOSIT"] != 100 || day.Sinks["WITHDRAWAL"] != 30 {
+		t.Errorf("Expected breakdown by type, got sources %v sinks %v", day.Sources, day.Sinks)
+	}
+}
+
+func TestPairLimits(t *testing.T) {
+	database, err := tools.NewDatabase()
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db := *database
+	svc := New(db)
+
+	// Both directions count towards the same pair
+	for i := 0; i < 5; i++ {
+		db.TransferUserCoins("aaron", "bryan", 1)
+		db.TransferUserCoins("bryan", "aaron", 1)
+	}
+
+	t.Run("Hourly_Count_Blocks", func(t *testing.T) {
+		err := svc.CheckPairLimits("aaron", "bryan", 1)
+		limitErr, ok := err.(*PairLimitError)
+		if !ok {
+			t.Fatalf("Expected *PairLimitError after 10 transfers, got %v", err)
+		}
+
+		allowance := limitErr.Allowance
+		if allowance.HourlyCountRemaining != 0 || allowance.DailyCountRemaining != 40 {
+			t.Errorf("Unexpected remaining allowance: %+v", allowance)
+		}
+		if allowance.RetryAt.IsZero() || allowance.RetryAt.Before(time.Now().Add(59*time.Minute)) {
+			t.Errorf("Expected retry in about an hour, got %v", allowance.RetryAt)
+		}
+		t.Logf("Refused with: %v", err)
+	})
+
+	t.Run("Other_Pairs_Unaffected", func(t *testing.T) {
+		allowance := svc.PairAllowance("aaron", "carol", 1)
+		if !allowance.Allowed || allowance.HourlyAmountRemaining != 5000 {
+			t.Errorf("Expected a fresh allowance for another pair, got %+v", allowance)
+		}
+	})
+
+	t.Run("Amount_Over_Cap_Never_Fits", func(t *testing.T) {
+		allowance := svc.PairAllowance("aaron", "carol", 6000)
+		if allowance.Allowed || !allowance.RetryAt.IsZero() {
+			t.Errorf("Expected refusal without a retry time, got %+v", allowance)
+		}
+	})
+}
+
+func TestEarlyBalanceWarningExperiment(t *testing.T) {
+	database, err := tools.NewDatabase()
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db := *database
+
+	// Put aaron at about 85% of the default 1,000,000 limit
+	aaron, _ := db.GetUserCoins("aaron")
+	var topUp int64 = 850000 - aaron.Coins
+	db.AddUserCoins("aaron", topUp)
+	defer db.WithdrawUserCoins("aaron", topUp)
+
+	control, _ := New(db).AccountSummary("aaron")
+	treatment, _ := New(db).WithFeatures(features.Assignments{features.EarlyBalanceWarning: features.Treatment}).AccountSummary("aaron")
+
+	if len(control.Alerts) != 0 {
+		t.Errorf("Control should not warn at 85%%, got %v", control.Alerts)
+	}
+	if len(treatment.Alerts) != 1 || treatment.Alerts[0] != AlertNearBalanceLimit {
+		t.Errorf("Treatment should warn at 85%%, got %v", treatment.Alerts)
+	}
+}
+
+func TestPartialFreezeEnforcement(t *testing.T) {
+	database, err := tools.NewDatabase()
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	svc := New(*database)
+	bryan, _ := (*database).GetUserCoins("bryan")
+	var balance int64 = bryan.Coins
+
+	freeze, _ := freezes.Place(*database, "bryan", balance-100, "investigation", "admin")
+	defer freezes.Lift(*database, freeze.ID, "test done", "admin")
+
+	if err := svc.CheckAvailable("bryan", 100); err != nil {
+		t.Errorf("The unfrozen 100 should be available, got %v", err)
+	}
+
+	err = svc.CheckAvailable("bryan", 101)
+	if _, ok := err.(*FrozenFundsError); !ok {
+		t.Fatalf("Expected *FrozenFundsError, got %v", err)
+	}
+
+	verdict, _ := svc.PrecheckTransfer("bryan", "aaron", 101)
+	if verdict.Available != 100 || len(verdict.BlockedBy) == 0 || verdict.BlockedBy[0] != BlockedFrozenFunds {
+		t.Errorf("Expected frozen_funds with 100 available, got %+v", verdict)
+	}
+
+	// Standing orders get the same checks, and plain insufficient funds too
+	if err := svc.CheckScheduledTransfer("bryan", "aaron", 101); !errors.As(err, new(*FrozenFundsError)) {
+		t.Errorf("Expected *FrozenFundsError for a scheduled transfer, got %v", err)
+	}
+	if err := svc.CheckScheduledTransfer("bryan", "aaron", balance+1); !errors.Is(err, tools.ErrInsufficientFunds) {
+		t.Errorf("Expected ErrInsufficientFunds for a scheduled transfer, got %v", err)
+	}
+}
+
+func TestAccountStatus(t *testing.T) {
+	database, err := tools.NewMemoryDatabase(nil, map[string]tools.CoinDetails{
+		"status_user": {Username: "status_user", Coins: 500, Version: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	svc := New(*database)
+
+	details, _ := (*database).GetUserCoins("status_user")
+	status, _ := svc.Status(*details)
+	if status.State != StateActive || status.Available != 500 || status.Held != 0 || !status.LastTransactionAt.IsZero() {
+		t.Errorf("Expected an active account with everything available, got %+v", status)
+	}
+
+	(*database).AddUserCoins("status_user", 100)
+	freeze, _ := freezes.Place(*database, "status_user", 250, "investigation", "admin")
+	defer freezes.Lift(*database, freeze.ID, "test done", "admin")
+
+	details, _ = (*database).GetUserCoins("status_user")
+	status, _ = svc.Status(*details)
+	if status.State != StateRestricted || status.Balance != 600 || status.Available != 350 || status.Held != 250 || status.Freezes != 1 {
+		t.Errorf("Expected a restricted account with 250 held, got %+v", status)
+	}
+	if time.Since(status.LastTransactionAt) > time.Minute {
+		t.Errorf("Expected the deposit as the last transaction, got %s", status.LastTransactionAt)
+	}
+}
+
+func TestProbation(t *testing.T) {
+	database, err := tools.NewMemoryDatabase(nil, map[string]tools.CoinDetails{
+		"probation_new": {Username: "probation_new", Coins: 5000, Version: 1},
+		"probation_old": {Username: "probation_old", Coins: 5000, Version: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	svc := New(*database)
+	events.Record(*database, events.AccountCreated, "probation_new", nil)
+
+	var probation policy.Probation = policy.CurrentProbation(*database)
+	if err := svc.CheckProbation("probation_old", probation.MaxTransaction+1); err != nil {
+		t.Errorf("Accounts without a creation record are established, got %v", err)
+	}
+
+	err = svc.CheckProbation("probation_new", probation.MaxTransaction+1)
+	var probationErr *ProbationError
+	if !errors.As(err, &probationErr) || probationErr.Reason != BlockedProbationMaxTransaction {
+		t.Fatalf("Expected the probation max transaction to refuse, got %v", err)
+	}
+	if days := time.Until(probationErr.EndsAt).Hours() / 24; days < float64(probation.Days)-1 || days > float64(probation.Days) {
+		t.Errorf("Expected probation to end in %d days, got %s", probation.Days, probationErr.EndsAt)
+	}
+
+	// Earlier withdrawals today count against the daily limit
+	(*database).WithdrawUserCoins("probation_new", probation.DailyLimit)
+	verdict, _ := svc.PrecheckTransfer("probation_new", "probation_old", 1)
+	if verdict.Allowed || !slices.Contains(verdict.BlockedBy, BlockedProbationDailyLimit) || verdict.ProbationEndsAt.IsZero() {
+		t.Errorf("Expected the probation daily limit in the verdict, got %+v", verdict)
+	}
+}
+
+func TestPolicyLimits(t *testing.T) {
+	database, err := tools.NewMemoryDatabase(nil, map[string]tools.CoinDetails{
+		"limits_payer": {Username: "limits_payer", Coins: 1000000, Version: 1},
+		"limits_payee": {Username: "limits_payee", Coins: 0, Version: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db := *database
+	svc := New(db)
+	limits, _ := policy.LimitsFor(db, policy.DefaultCurrency, policy.DefaultTier)
+
+	var limitErr *LimitError
+	if err := svc.CheckLimits("limits_payer", limits.MaxTransaction+1); !errors.As(err, &limitErr) || limitErr.Reason != BlockedMaxTransaction {
+		t.Errorf("Expected the max transaction to refuse, got %v", err)
+	}
+
+	// Transfers go through until the day's total would pass the daily limit
+	var amount int64 = limits.MaxTransaction
+	var sent int
+	for ; svc.CheckLimits("limits_payer", amount) == nil; sent++ {
+		if _, _, err := db.TransferUserCoinsWithContext(context.Background(), "limits_payer", "limits_payee", amount); err != nil {
+			t.Fatalf("Failed to transfer: %v", err)
+		}
+	}
+	if int64(sent)*amount > limits.DailyLimit || int64(sent+1)*amount <= limits.DailyLimit {
+		t.Errorf("Expected transfers to stop at the %d daily limit, %d of %d went through", limits.DailyLimit, sent, amount)
+	}
+
+	// The precheck verdict is what the transfer gets
+	err = svc.CheckLimits("limits_payer", amount)
+	verdict, _ := svc.PrecheckTransfer("limits_payer", "limits_payee", amount)
+	if !errors.As(err, &limitErr) || limitErr.Reason != BlockedDailyLimit || !slices.Contains(verdict.BlockedBy, BlockedDailyLimit) {
+		t.Errorf("Expected the daily limit from both, got %v and %+v", err, verdict)
+	}
+}
+
+func TestOutgoingTodayAcrossBatches(t *testing.T) {
+	database, err := tools.NewMemoryDatabase(nil, map[string]tools.CoinDetails{
+		"batch_payer": {Username: "batch_payer", Coins: 1000, Version: 1},
+		"batch_payee": {Username: "batch_payee", Coins: 0, Version: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db := *database
+
+	// More entries than one batch, with deposits in between that don't count
+	for i := 0; i < historyBatch*2+10; i++ {
+		db.TransferUserCoins("batch_payer", "batch_payee", 1)
+		db.AddUserCoins("batch_payer", 1)
+	}
+	if outgoing := New(db).OutgoingToday("batch_payer"); outgoing != int64(historyBatch*2+10) {
+		t.Errorf("Expected every transfer today counted, got %d", outgoing)
+	}
+	summary, _ := New(db).AccountSummary("batch_payer")
+	if len(summary.RecentTransactions) != summaryTransactionCount || summary.RecentTransactions[0].Type != "DEPOSIT" {
+		t.Errorf("Expected the newest %d entries, newest first, got %+v", summaryTransactionCount, summary.RecentTransactions)
+	}
+}
+
+func TestHoldsAndPendingOperations(t *testing.T) {
+	database, err := tools.NewMemoryDatabase(nil, map[string]tools.CoinDetails{
+		"pending_user": {Username: "pending_user", Coins: 500, Version: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	svc := New(*database)
+
+	freeze, _ := freezes.Place(*database, "pending_user", 200, "chargeback review", "admin")
+	defer freezes.Lift(*database, freeze.ID, "test done", "admin")
+	lifted, _ := freezes.Place(*database, "pending_user", 50, "resolved", "admin")
+	freezes.Lift(*database, lifted.ID, "resolved", "admin")
+
+	holds, err := svc.Holds("pending_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holds.Balance != 500 || holds.Available != 300 || holds.Held != 200 || len(holds.Holds) != 1 || holds.Holds[0].Reason != "chargeback review" {
+		t.Errorf("Expected one active hold of 200, got %+v", holds)
+	}
+
+	request, _ := privacy.RequestDeletion(*database, "pending_user", "")
+	defer privacy.Reject(*database, request.ID, "admin", "test done")
+
+	operations, err := svc.PendingOperations("pending_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(operations) != 1 || operations[0].Kind != PendingDataDeletion || operations[0].ID != request.ID {
+		t.Errorf("Expected the pending deletion request, got %+v", operations)
+	}
+
+	if _, err := svc.Holds("nobody"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestSignup(t *testing.T) {
+	issuer, err := tokens.For(tokens.Settings{Algorithm: "HS256", Secret: "0123456789abcdef0123456789abcdef", TTL: time.Minute, RefreshTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := tools.NewMemoryDatabase(nil, map[string]tools.CoinDetails{
+		"signup_bank": {Username: "signup_bank", Coins: 30, Version: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	var db tools.DatabaseInterface = *database
+	var options = SignupOptions{Issuer: issuer, Bonus: 20, BonusFrom: "signup_bank"}
+
+	t.Run("Opens_A_Funded_Account", func(t *testing.T) {
+		signup, err := New(db).Signup(context.Background(), "signup_new", options)
+		if err != nil {
+			t.Fatalf("Signup failed: %v", err)
+		}
+		if login := db.GetUserLoginDetails("signup_new"); login == nil || login.AuthToken == "" || login.AuthToken != signup.Login.AuthToken {
+			t.Errorf("Expected the returned token stored, got %+v", login)
+		}
+		if signup.Session == nil || signup.Session.Access.Value == "" {
+			t.Errorf("Expected a session, got %+v", signup.Session)
+		}
+		if coins, _ := db.GetUserCoins("signup_new"); coins == nil || coins.Coins != 20 || signup.Balance != 20 || signup.Bonus != 20 {
+			t.Errorf("Expected the bonus paid, got %+v, %+v", coins, signup)
+		}
+		if _, ok := events.First(db, events.AccountCreated, "signup_new"); !ok || signup.ProbationEndsAt.IsZero() || signup.Limits.MaxBalance == 0 {
+			t.Errorf("Expected the account created on probation with default limits, got %+v", signup)
+		}
+	})
+
+	t.Run("Failed_Bonus_Undoes_Everything", func(t *testing.T) {
+		_, err := New(db).Signup(context.Background(), "signup_broke", options)
+		if !errors.Is(err, ErrSignupBonusUnavailable) {
+			t.Fatalf("Expected the bonus refused with 10 coins left, got %v", err)
+		}
+		if _, err := db.GetUserCoins("signup_broke"); !errors.Is(err, ErrUserNotFound) || db.GetUserLoginDetails("signup_broke") != nil {
+			t.Errorf("Expected the account removed, got %v", err)
+		}
+		if revoked, _ := db.RevokeRefreshTokens("signup_broke", ""); revoked != 0 {
+			t.Errorf("Expected the session revoked, %d refresh tokens were live", revoked)
+		}
+		if coins, _ := db.GetUserCoins("signup_bank"); coins.Coins != 10 {
+			t.Errorf("Expected the bonus account untouched, got %d", coins.Coins)
+		}
+		if _, ok := events.First(db, events.AccountCreated, "signup_broke"); ok {
+			t.Errorf("Expected no account_created event for an undone signup")
+		}
+
+		if _, err := New(db).Signup(context.Background(), "signup_broke", SignupOptions{}); err != nil {
+			t.Errorf("Expected the name free again, got %v", err)
+		}
+	})
+
+	t.Run("Refusals", func(t *testing.T) {
+		if _, err := New(db).Signup(context.Background(), "signup_new", SignupOptions{}); !errors.Is(err, tools.ErrUserExists) {
+			t.Errorf("Expected a taken name refused, got %v", err)
+		}
+		for _, username := range []string{"", "_mint", "Aaron", "a b", "ab"} {
+			if _, err := New(db).Signup(context.Background(), username, SignupOptions{}); !errors.Is(err, ErrInvalidUsername) {
+				t.Errorf("Expected %q refused, got %v", username, err)
+			}
+		}
+	})
+}
+
+func TestAdminAccounts(t *testing.T) {
+	database, err := tools.NewMemoryDatabase(nil, map[string]tools.CoinDetails{
+		"admin_held": {Username: "admin_held", Coins: 100, Version: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	svc := New(*database)
+
+	t.Run("Creates_With_A_Role", func(t *testing.T) {
+		login, err := svc.CreateAccount("admin_auditor", tools.RoleAuditor, "admin")
+		if err != nil || login.AuthToken == "" || login.Role != tools.RoleAuditor {
+			t.Fatalf("Expected an auditor account, got %+v, %v", login, err)
+		}
+		if _, err := svc.CreateAccount("admin_other", "owner", "admin"); !errors.Is(err, ErrInvalidRole) {
+			t.Errorf("Expected an unknown role refused, got %v", err)
+		}
+
+		users, err := svc.Users(context.Background(), "", 10)
+		if err != nil || len(users) != 2 || users[0].Username != "admin_auditor" || users[0].Role != tools.RoleAuditor || users[1].Balance != 100 {
+			t.Errorf("Expected both accounts listed, got %+v, %v", users, err)
+		}
+	})
+
+	t.Run("Adjusts_With_A_Reason", func(t *testing.T) {
+		if _, err := svc.AdjustBalance("admin_held", 50, "", "admin"); !errors.Is(err, ErrInvalidAdjustment) {
+			t.Errorf("Expected a missing reason refused, got %v", err)
+		}
+		details, err := svc.AdjustBalance("admin_held", -30, "duplicate deposit", "admin")
+		if err != nil || details.Coins != 70 {
+			t.Fatalf("Expected 70 left, got %+v, %v", details, err)
+		}
+		if _, ok := events.First(*database, events.BalanceAdjusted, "admin_held"); !ok {
+			t.Errorf("Expected a balance_adjusted event")
+		}
+		if _, err := svc.AdjustBalance("admin_held", -71, "too much", "admin"); !errors.Is(err, tools.ErrInsufficientFunds) {
+			t.Errorf("Expected ErrInsufficientFunds, got %v", err)
+		}
+	})
+
+	t.Run("Frozen_Account_Moves_Nothing", func(t *testing.T) {
+		if _, err := freezes.FreezeAccount(*database, "admin_held", "investigation", "admin"); err != nil {
+			t.Fatal(err)
+		}
+		defer freezes.UnfreezeAccount(*database, "admin_held", "test done", "admin")
+
+		if err := svc.CheckAvailable("admin_held", 1); !errors.As(err, new(*AccountFrozenError)) {
+			t.Errorf("Expected *AccountFrozenError, got %v", err)
+		}
+		if verdict, _ := svc.PrecheckTransfer("admin_held", "aaron", 1); verdict.Allowed || !slices.Contains(verdict.BlockedBy, BlockedFrozen) {
+			t.Errorf("Expected precheck to report the frozen account, got %+v", verdict)
+		}
+		details, _ := (*database).GetUserCoins("admin_held")
+		if status, _ := svc.Status(*details); status.State != StateFrozen {
+			t.Errorf("Expected a frozen account, got %+v", status)
+		}
+	})
+}
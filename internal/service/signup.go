@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/policy"
+	"github.com/bryantjandra/goapi/internal/tokens"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrInvalidUsername = errors.New("username must be 3 to 64 lowercase letters, digits, '.', '_' or '-', starting with a letter or digit")
+
+// Names starting with '_' are the ledger's counter-accounts, such as storage.MintAccount
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{2,63}$`)
+
+// ErrSignupBonusUnavailable means the bonus account couldn't pay, the signup is undone
+// rather than opening an account without the bonus it was promised
+var ErrSignupBonusUnavailable = errors.New("the signup bonus can't be paid right now, try again later")
+
+// SignupOptions are the deployment's, not the caller's
+type SignupOptions struct {
+	// Issues a session as well as the static token, set in the jwt auth mode
+	Issuer *tokens.Issuer
+
+	// Coins moved from BonusFrom to the new account, 0 for none
+	Bonus     int64
+	BonusFrom string
+}
+
+// Signup is an account Signup opened, with everything it needs to start
+type Signup struct {
+	Login   tools.LoginDetails
+	Session *tokens.Session
+	Balance int64
+	Bonus   int64
+
+	// Every account starts on the default tier, and on probation while it lasts
+	Limits          policy.Limits
+	ProbationEndsAt time.Time
+}
+
+// Signup opens username's account in steps: the account with a new token, a session
+// when options.Issuer is set, then the bonus. A step that fails undoes the ones before
+// it, so the name is free again and no coins moved. AccountCreated, which starts the
+// probation clock, is only recorded once every step succeeded.
+func (s *Service) Signup(ctx context.Context, username string, options SignupOptions) (*Signup, error) {
+	if !usernamePattern.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+
+	var login = tools.LoginDetails{Username: username, AuthToken: newAuthToken(), Role: tools.RoleUser}
+	details, err := s.database.CreateUser(login)
+	if err != nil {
+		return nil, err
+	}
+	var result = &Signup{Login: login, Balance: details.Coins}
+
+	// Undo steps, run newest first
+	var undo []func() error
+	rollback := func(cause error) error {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil {
+				log.Error("Failed to undo signup of ", username, ", the account needs repair: ", err)
+			}
+		}
+		return cause
+	}
+	undo = append(undo, func() error {
+		return s.database.DeleteUser(username)
+	})
+
+	if options.Issuer != nil {
+		session, err := options.Issuer.StartSession(s.database, username)
+		if err != nil {
+			return nil, rollback(fmt.Errorf("issuing session: %w", err))
+		}
+		result.Session = &session
+		undo = append(undo, func() error {
+			_, err := tokens.Logout(s.database, username, "", true)
+			return err
+		})
+	}
+
+	if options.Bonus > 0 {
+		err = s.CheckAvailable(options.BonusFrom, options.Bonus)
+		if err != nil {
+			log.Error("Signup bonus refused from ", options.BonusFrom, ": ", err)
+			return nil, rollback(ErrSignupBonusUnavailable)
+		}
+		_, toDetails, err := s.database.TransferUserCoinsWithContext(ctx, options.BonusFrom, username, options.Bonus)
+		if err != nil {
+			log.Error("Signup bonus failed from ", options.BonusFrom, ": ", err)
+			return nil, rollback(ErrSignupBonusUnavailable)
+		}
+		result.Balance = toDetails.Coins
+		result.Bonus = options.Bonus
+	}
+
+	events.Record(s.database, events.AccountCreated, username, map[string]interface{}{
+		"provisioned_by": "signup",
+	})
+	if result.Bonus > 0 {
+		events.Record(s.database, events.TransferCompleted, options.BonusFrom, map[string]interface{}{
+			"from":         options.BonusFrom,
+			"to":           username,
+			"amount":       result.Bonus,
+			"signup_bonus": true,
+		})
+	}
+
+	result.Limits, _ = policy.LimitsFor(s.database, policy.DefaultCurrency, policy.DefaultTier)
+	result.ProbationEndsAt = ProbationEndsAt(s.database, username, time.Now())
+	return result, nil
+}
+
+func newAuthToken() string {
+	var token = make([]byte, 24)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/dormancy"
+	"github.com/bryantjandra/goapi/internal/freezes"
+	"github.com/bryantjandra/goapi/internal/gifts"
+	"github.com/bryantjandra/goapi/internal/holds"
+	"github.com/bryantjandra/goapi/internal/lockout"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// Account states, when several apply the first one listed wins
+const (
+	StateFrozen     = "frozen"
+	StateLocked     = "locked"
+	StateSweepable  = "sweepable"
+	StateDormant    = "dormant"
+	StateRestricted = "restricted"
+	StateActive     = "active"
+)
+
+// AccountStatus is what an account card shows: its state and what the balance is made of
+type AccountStatus struct {
+	State string
+
+	// Set while failed sign-ins keep the account locked
+	LockedUntil time.Time
+
+	// Balance = Available + Held. Pending counts gifts waiting to be accepted and
+	// payment holds waiting to be captured, outgoing (also in Held) and incoming (not
+	// yet in Balance).
+	Balance   int64
+	Available int64
+	Held      int64
+	Pending   int64
+
+	// Active freezes making up Held, and what they hold back
+	Freezes int
+	Frozen  int64
+
+	LastTransactionAt time.Time
+}
+
+// Status works out the account's state from lockouts, dormancy and freezes
+func (s *Service) Status(details tools.CoinDetails) (AccountStatus, error) {
+	totals, err := freezes.Summarize(s.database, details.Username)
+	if err != nil {
+		return AccountStatus{}, err
+	}
+
+	var status = AccountStatus{
+		State:       StateActive,
+		LockedUntil: lockout.Check(s.database, lockout.Username(details.Username)),
+		Balance:     details.Coins,
+		Available:   details.Available(),
+		Freezes:     totals.Count,
+		Frozen:      totals.Amount,
+	}
+	status.Held = status.Balance - status.Available
+
+	outgoing, incoming, err := gifts.Pending(s.database, details.Username)
+	if err != nil {
+		return AccountStatus{}, err
+	}
+	status.Pending = outgoing + incoming
+	outgoing, incoming, err = holds.Pending(s.database, details.Username)
+	if err != nil {
+		return AccountStatus{}, err
+	}
+	status.Pending += outgoing + incoming
+
+	s.recent(details.Username, func(tx tools.TransactionLog) bool {
+		if tx.Status == "SUCCESS" {
+			status.LastTransactionAt = tx.Timestamp
+			return false
+		}
+		return true
+	})
+
+	var dormancyStatus string = dormancy.StatusOf(details.Username, dormancy.CurrentPolicy(), time.Now())
+	switch {
+	case details.Frozen:
+		status.State = StateFrozen
+	case !status.LockedUntil.IsZero():
+		status.State = StateLocked
+	case dormancyStatus == dormancy.StatusSweepable:
+		status.State = StateSweepable
+	case dormancyStatus == dormancy.StatusDormant:
+		status.State = StateDormant
+	case totals.Count > 0:
+		status.State = StateRestricted
+	}
+	return status, nil
+}
@@ -0,0 +1,309 @@
+// Package sideeffects runs the work that follows a domain event, like webhook
+// deliveries, away from the request that recorded it. Effects are queued when the
+// event is recorded and run at least once by background workers. Failures are
+// retried with backoff, and an effect that keeps failing is set aside as a dead
+// letter for an admin to requeue. A failing effect never fails the request.
+package sideeffects
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// Attempts an effect gets before it becomes a dead letter
+const MaxAttempts = 5
+
+// Wait before the first retry, doubled for each one after
+const baseBackoff = time.Second
+
+var ErrNotFound = errors.New("dead letter not found")
+
+// Handler runs one effect, an error schedules a retry
+type Handler func(effect Effect) error
+
+// Effect is one piece of work queued for an event
+type Effect struct {
+	ID   string
+	Kind string
+
+	// What the effect is for within its kind, e.g. the webhook ID
+	Key   string
+	Event events.Event
+
+	// Attempts made so far, the current one included while the handler runs
+	Attempts      int
+	LastError     string
+	QueuedAt      time.Time
+	NextAttemptAt time.Time
+
+	// Set once the effect ran out of attempts
+	DeadAt time.Time
+
+	running bool
+}
+
+// Final is true on the last attempt the effect gets
+func (e Effect) Final() bool {
+	return e.Attempts >= MaxAttempts
+}
+
+// Metrics are kept per kind
+type Metrics struct {
+	Queued       int
+	DeadLetters  int
+	Succeeded    int64
+	Retried      int64
+	DeadLettered int64
+	LastError    string
+	LastErrorAt  time.Time
+}
+
+var (
+	mu       sync.Mutex
+	handlers = map[string]Handler{}
+	queue    = map[string]*Effect{}
+	dead     = map[string]*Effect{}
+	counts   = map[string]*Metrics{}
+
+	// Wakes a worker when an effect is queued
+	wake = make(chan struct{}, 1)
+)
+
+func newID() string {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// Handle sets the handler for kind, effects of a kind without one wait in the queue
+func Handle(kind string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[kind] = handler
+}
+
+func metricsLocked(kind string) *Metrics {
+	metrics, ok := counts[kind]
+	if !ok {
+		metrics = &Metrics{}
+		counts[kind] = metrics
+	}
+	return metrics
+}
+
+// Enqueue queues an effect of kind for event, due straight away. It only takes the
+// lock, so it is safe to call from an events subscriber.
+func Enqueue(kind string, key string, event events.Event) Effect {
+	var now time.Time = time.Now()
+
+	mu.Lock()
+	var effect = &Effect{
+		ID:            newID(),
+		Kind:          kind,
+		Key:           key,
+		Event:         event,
+		QueuedAt:      now,
+		NextAttemptAt: now,
+	}
+	queue[effect.ID] = effect
+	metricsLocked(kind)
+	var result = *effect
+	mu.Unlock()
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return result
+}
+
+// claim takes the longest waiting effect due at now
+func claim(now time.Time) (*Effect, Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var next *Effect
+	for _, effect := range queue {
+		if effect.running || effect.NextAttemptAt.After(now) || handlers[effect.Kind] == nil {
+			continue
+		}
+		if next == nil || effect.NextAttemptAt.Before(next.NextAttemptAt) {
+			next = effect
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+	next.running = true
+	next.Attempts++
+	return next, handlers[next.Kind]
+}
+
+// call runs handler, a panic counts as a failure
+func call(handler Handler, effect Effect) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("handler panicked: %v", recovered)
+		}
+	}()
+	return handler(effect)
+}
+
+func run(effect *Effect, handler Handler) {
+	mu.Lock()
+	var snapshot = *effect
+	mu.Unlock()
+
+	err := call(handler, snapshot)
+
+	var now time.Time = time.Now()
+	mu.Lock()
+	defer mu.Unlock()
+
+	var metrics *Metrics = metricsLocked(effect.Kind)
+	effect.running = false
+	if err == nil {
+		delete(queue, effect.ID)
+		metrics.Succeeded++
+		return
+	}
+
+	effect.LastError = err.Error()
+	metrics.LastError = effect.LastError
+	metrics.LastErrorAt = now
+	if effect.Attempts >= MaxAttempts {
+		delete(queue, effect.ID)
+		effect.DeadAt = now
+		dead[effect.ID] = effect
+		metrics.DeadLettered++
+		log.WithFields(log.Fields{
+			"effect": effect.ID,
+			"kind":   effect.Kind,
+			"key":    effect.Key,
+			"event":  effect.Event.ID,
+		}).Error("Side effect failed ", effect.Attempts, " times, moved to dead letters: ", err)
+		return
+	}
+
+	effect.NextAttemptAt = now.Add(baseBackoff << (effect.Attempts - 1))
+	metrics.Retried++
+	log.Warn("Side effect ", effect.Kind, " ", effect.ID, " attempt ", effect.Attempts, " failed, retrying at ", effect.NextAttemptAt, ": ", err)
+}
+
+// RunDue runs every effect due at now, one after another, and returns how many ran
+func RunDue(now time.Time) int {
+	var ran int
+	for {
+		effect, handler := claim(now)
+		if effect == nil {
+			return ran
+		}
+		run(effect, handler)
+		ran++
+	}
+}
+
+// Run starts workers that run effects as they come due, until ctx is done. Each one
+// also looks for retries every tick.
+func Run(ctx context.Context, workers int, tick time.Duration) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var ticker *time.Ticker = time.NewTicker(tick)
+			defer ticker.Stop()
+			for {
+				RunDue(time.Now())
+				select {
+				case <-ctx.Done():
+					return
+				case <-wake:
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Pending counts the effects still queued, retries included
+func Pending() int {
+	mu.Lock()
+	defer mu.Unlock()
+	return len(queue)
+}
+
+// KindMetrics returns the metrics of every kind that has had an effect queued
+func KindMetrics() map[string]Metrics {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var result = map[string]Metrics{}
+	for kind, metrics := range counts {
+		var current = *metrics
+		current.Queued, current.DeadLetters = 0, 0
+		for _, effect := range queue {
+			if effect.Kind == kind {
+				current.Queued++
+			}
+		}
+		for _, effect := range dead {
+			if effect.Kind == kind {
+				current.DeadLetters++
+			}
+		}
+		result[kind] = current
+	}
+	return result
+}
+
+// DeadLetters lists the effects that ran out of attempts, newest first. An empty kind
+// lists every kind.
+func DeadLetters(kind string) []Effect {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var result = []Effect{}
+	for _, effect := range dead {
+		if kind == "" || effect.Kind == kind {
+			result = append(result, *effect)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].DeadAt.After(result[j].DeadAt) })
+	return result
+}
+
+// Requeue gives a dead letter a fresh set of attempts, due straight away
+func Requeue(id string, by string) (Effect, error) {
+	mu.Lock()
+	effect, ok := dead[id]
+	if !ok {
+		mu.Unlock()
+		return Effect{}, ErrNotFound
+	}
+	delete(dead, id)
+	effect.Attempts = 0
+	effect.DeadAt = time.Time{}
+	effect.NextAttemptAt = time.Now()
+	queue[id] = effect
+	var result = *effect
+	mu.Unlock()
+
+	log.WithFields(log.Fields{"effect": id, "kind": result.Kind, "by": by}).Info("Dead letter requeued")
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return result, nil
+}
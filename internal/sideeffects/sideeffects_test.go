@@ -0,0 +1,110 @@
+package sideeffects
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+)
+
+func TestRetries(t *testing.T) {
+	var calls = map[string]int{}
+	Handle("test_flaky", func(effect Effect) error {
+		calls[effect.Key]++
+		if effect.Key == "broken" || effect.Attempts < 3 {
+			return errors.New("endpoint down")
+		}
+		return nil
+	})
+
+	flaky := Enqueue("test_flaky", "flaky", events.Event{ID: 1})
+	broken := Enqueue("test_flaky", "broken", events.Event{ID: 2})
+
+	// Far enough ahead to be past every backoff
+	var later time.Time = time.Now()
+	for i := 0; i < MaxAttempts; i++ {
+		later = later.Add(time.Hour)
+		RunDue(later)
+	}
+
+	if calls["flaky"] != 3 {
+		t.Errorf("Expected the flaky effect to succeed on its third attempt, ran %d times", calls["flaky"])
+	}
+	if calls["broken"] != MaxAttempts {
+		t.Errorf("Expected the broken effect to get %d attempts, got %d", MaxAttempts, calls["broken"])
+	}
+
+	letters := DeadLetters("test_flaky")
+	if len(letters) != 1 || letters[0].ID != broken.ID || letters[0].LastError != "endpoint down" {
+		t.Fatalf("Expected only the broken effect in dead letters, got %+v", letters)
+	}
+	if letters[0].ID == flaky.ID || Pending() != 0 {
+		t.Errorf("Expected the flaky effect to leave the queue")
+	}
+
+	metrics := KindMetrics()["test_flaky"]
+	if metrics.Succeeded != 1 || metrics.DeadLettered != 1 || metrics.Retried != 2+MaxAttempts-1 || metrics.Queued != 0 || metrics.DeadLetters != 1 {
+		t.Errorf("Unexpected metrics: %+v", metrics)
+	}
+
+	t.Run("Requeue", func(t *testing.T) {
+		Handle("test_flaky", func(effect Effect) error { return nil })
+
+		requeued, err := Requeue(broken.ID, "admin")
+		if err != nil || requeued.Attempts != 0 {
+			t.Fatalf("Expected a fresh set of attempts, got %+v, %v", requeued, err)
+		}
+		if ran := RunDue(time.Now()); ran != 1 {
+			t.Errorf("Expected the requeued effect to run, %d ran", ran)
+		}
+		if len(DeadLetters("test_flaky")) != 0 {
+			t.Errorf("Expected no dead letters left")
+		}
+		if _, err := Requeue(broken.ID, "admin"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestPanicIsFailure(t *testing.T) {
+	var attempts int
+	Handle("test_panic", func(effect Effect) error {
+		attempts++
+		if attempts == 1 {
+			panic("boom")
+		}
+		return nil
+	})
+
+	Enqueue("test_panic", "", events.Event{ID: 3})
+	RunDue(time.Now())
+	RunDue(time.Now().Add(time.Hour))
+
+	if attempts != 2 || KindMetrics()["test_panic"].Succeeded != 1 {
+		t.Errorf("Expected a retry after the panic, got %d attempts and %+v", attempts, KindMetrics()["test_panic"])
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	var done = make(chan string, 1)
+	Handle("test_worker", func(effect Effect) error {
+		done <- effect.Key
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Run(ctx, 2, time.Hour)
+
+	Enqueue("test_worker", "woken", events.Event{ID: 4})
+	select {
+	case key := <-done:
+		if key != "woken" {
+			t.Errorf("Unexpected effect %q", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Queued effect was not run")
+	}
+}
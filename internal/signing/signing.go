@@ -0,0 +1,221 @@
+// Package signing implements HMAC request signing for server-to-server callers, as
+// an alternative to sending the bearer token. A signed request carries
+//
+//	Authorization: GOAPI-HMAC-SHA256 Credential=<username>, Timestamp=<unix seconds>, Nonce=<random>, Signature=<hex>
+//
+// where Signature is the hex HMAC-SHA256, keyed with the caller's shared secret, of
+// StringToSign. Each nonce is only accepted once within the allowed clock skew. The
+// nonces seen are kept in a bounded cache, see Verify.
+package signing
+
+import (
+	"bytes"
+	"container/heap"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const Scheme = "GOAPI-HMAC-SHA256"
+
+// Bodies larger than this can't be signed
+const maxBody = 1 << 20
+
+var (
+	ErrMalformed        = errors.New("malformed request signature")
+	ErrExpired          = errors.New("request timestamp is outside the allowed window")
+	ErrInvalidSignature = errors.New("request signature is invalid")
+	ErrReplayed         = errors.New("request nonce was already used")
+)
+
+type Credentials struct {
+	Username  string
+	Timestamp string
+	Nonce     string
+	Signature string
+}
+
+// IsSigned reports whether an Authorization header uses the signing scheme
+func IsSigned(header string) bool {
+	return strings.HasPrefix(header, Scheme+" ")
+}
+
+// Parse reads the credentials from an Authorization header
+func Parse(header string) (Credentials, error) {
+	if !IsSigned(header) {
+		return Credentials{}, ErrMalformed
+	}
+
+	var credentials Credentials
+	for _, part := range strings.Split(strings.TrimPrefix(header, Scheme+" "), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return Credentials{}, ErrMalformed
+		}
+		switch key {
+		case "Credential":
+			credentials.Username = value
+		case "Timestamp":
+			credentials.Timestamp = value
+		case "Nonce":
+			credentials.Nonce = value
+		case "Signature":
+			credentials.Signature = value
+		}
+	}
+
+	if credentials.Username == "" || credentials.Timestamp == "" || credentials.Nonce == "" || credentials.Signature == "" {
+		return Credentials{}, ErrMalformed
+	}
+	return credentials, nil
+}
+
+// StringToSign joins the method, path, raw query, timestamp, nonce and hex SHA-256 of
+// the body with newlines
+func StringToSign(method string, path string, rawQuery string, timestamp string, nonce string, body []byte) string {
+	var bodyHash = sha256.Sum256(body)
+	return strings.Join([]string{method, path, rawQuery, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")
+}
+
+// Sign returns the hex HMAC-SHA256 of stringToSign
+func Sign(secret string, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readBody returns the request body and puts it back for the handler
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxBody {
+		return nil, ErrMalformed
+	}
+
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// SignRequest adds the Authorization header to a request, for Go callers and tests
+func SignRequest(r *http.Request, username string, secret string) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	var nonce = make([]byte, 16)
+	rand.Read(nonce)
+
+	var credentials = Credentials{
+		Username:  username,
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+		Nonce:     hex.EncodeToString(nonce),
+	}
+	credentials.Signature = Sign(secret, StringToSign(r.Method, r.URL.EscapedPath(), r.URL.RawQuery, credentials.Timestamp, credentials.Nonce, body))
+
+	r.Header.Set("Authorization", Scheme+" Credential="+credentials.Username+", Timestamp="+credentials.Timestamp+
+		", Nonce="+credentials.Nonce+", Signature="+credentials.Signature)
+	return nil
+}
+
+// seenNonce is a burned nonce, forgotten at expires when its timestamp is too old anyway
+type seenNonce struct {
+	key      string
+	signedAt time.Time
+	expires  time.Time
+}
+
+// nonceQueue orders burned nonces by expiry, soonest first
+type nonceQueue []seenNonce
+
+func (q nonceQueue) Len() int            { return len(q) }
+func (q nonceQueue) Less(i, j int) bool  { return q[i].expires.Before(q[j].expires) }
+func (q nonceQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nonceQueue) Push(x interface{}) { *q = append(*q, x.(seenNonce)) }
+func (q *nonceQueue) Pop() interface{} {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return last
+}
+
+var (
+	mu sync.Mutex
+
+	// username + nonce, for every nonce burned and not yet expired
+	nonces = map[string]bool{}
+	queue  nonceQueue
+
+	// Requests signed at or before this are refused. A full cache pushes out its oldest
+	// nonces, and a request from before them can no longer be checked for a replay.
+	floor time.Time
+)
+
+// Verify checks a signed request against the caller's secret. The timestamp must be
+// within maxSkew of now, and the nonce is only burned once the signature is valid. At
+// most capacity nonces are kept, 0 for no bound. When the cache is full the oldest one
+// is dropped, and requests signed no later than it are refused as expired from then on
+// so the bound never lets a replay through.
+func Verify(r *http.Request, credentials Credentials, secret string, maxSkew time.Duration, capacity int) error {
+	seconds, err := strconv.ParseInt(credentials.Timestamp, 10, 64)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	var now = time.Now()
+	var signedAt = time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-maxSkew)) || signedAt.After(now.Add(maxSkew)) {
+		return ErrExpired
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	var expected = Sign(secret, StringToSign(r.Method, r.URL.EscapedPath(), r.URL.RawQuery, credentials.Timestamp, credentials.Nonce, body))
+	if !hmac.Equal([]byte(expected), []byte(credentials.Signature)) {
+		return ErrInvalidSignature
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for queue.Len() > 0 && now.After(queue[0].expires) {
+		delete(nonces, heap.Pop(&queue).(seenNonce).key)
+	}
+
+	var key = credentials.Username + "\n" + credentials.Nonce
+	if nonces[key] {
+		return ErrReplayed
+	}
+	if !signedAt.After(floor) {
+		return ErrExpired
+	}
+
+	for capacity > 0 && queue.Len() >= capacity {
+		oldest := heap.Pop(&queue).(seenNonce)
+		delete(nonces, oldest.key)
+		if oldest.signedAt.After(floor) {
+			floor = oldest.signedAt
+		}
+	}
+	nonces[key] = true
+	heap.Push(&queue, seenNonce{key: key, signedAt: signedAt, expires: signedAt.Add(maxSkew)})
+	return nil
+}
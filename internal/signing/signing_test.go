@@ -0,0 +1,96 @@
+package signing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	credentials, err := Parse(Scheme + " Credential=aaron, Timestamp=1700000000, Nonce=abc, Signature=def")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials != (Credentials{Username: "aaron", Timestamp: "1700000000", Nonce: "abc", Signature: "def"}) {
+		t.Errorf("Unexpected credentials: %+v", credentials)
+	}
+
+	for _, header := range []string{"token", Scheme + " Credential=aaron", Scheme + " Credential=aaron, Timestamp"} {
+		if _, err := Parse(header); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Expected %q to be malformed, got %v", header, err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	newRequest := func(timestamp time.Time) (*http.Request, Credentials) {
+		req := httptest.NewRequest(http.MethodPost, "/account/coins/transfer?username=aaron&to=alex&amount=5", strings.NewReader("body"))
+		var credentials = Credentials{Username: "aaron", Timestamp: strconv.FormatInt(timestamp.Unix(), 10), Nonce: "n-" + timestamp.String()}
+		credentials.Signature = Sign("secret", StringToSign(req.Method, req.URL.EscapedPath(), req.URL.RawQuery, credentials.Timestamp, credentials.Nonce, []byte("body")))
+		return req, credentials
+	}
+
+	req, credentials := newRequest(time.Now())
+	if err := Verify(req, credentials, "secret", time.Minute, 0); err != nil {
+		t.Fatalf("Expected a valid signature, got %v", err)
+	}
+
+	req, _ = newRequest(time.Now())
+	if err := Verify(req, credentials, "secret", time.Minute, 0); !errors.Is(err, ErrReplayed) {
+		t.Errorf("Expected the nonce to be refused the second time, got %v", err)
+	}
+
+	req, credentials = newRequest(time.Now().Add(-2 * time.Minute))
+	if err := Verify(req, credentials, "secret", time.Minute, 0); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected a stale timestamp to be refused, got %v", err)
+	}
+
+	// A bad signature doesn't burn the nonce
+	req, credentials = newRequest(time.Now().Add(time.Second))
+	if err := Verify(req, credentials, "other", time.Minute, 0); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected the wrong secret to be refused, got %v", err)
+	}
+	req, _ = newRequest(time.Now().Add(time.Second))
+	if err := Verify(req, credentials, "secret", time.Minute, 0); err != nil {
+		t.Errorf("Expected the nonce to still be usable, got %v", err)
+	}
+}
+
+func TestVerifyBoundedCache(t *testing.T) {
+	defer func() {
+		nonces, queue, floor = map[string]bool{}, nil, time.Time{}
+	}()
+	nonces, queue, floor = map[string]bool{}, nil, time.Time{}
+
+	var verify = func(signedAt time.Time, nonce string) error {
+		req := httptest.NewRequest(http.MethodPost, "/account/coins/add?username=aaron&amount=5", nil)
+		var credentials = Credentials{Username: "aaron", Timestamp: strconv.FormatInt(signedAt.Unix(), 10), Nonce: nonce}
+		credentials.Signature = Sign("secret", StringToSign(req.Method, req.URL.EscapedPath(), req.URL.RawQuery, credentials.Timestamp, credentials.Nonce, nil))
+		return Verify(req, credentials, "secret", time.Minute, 2)
+	}
+
+	var now = time.Now()
+	for i, nonce := range []string{"a", "b", "c"} {
+		if err := verify(now.Add(time.Duration(i-30)*time.Second), nonce); err != nil {
+			t.Fatalf("Expected nonce %s to be accepted, got %v", nonce, err)
+		}
+	}
+	if len(nonces) != 2 || queue.Len() != 2 {
+		t.Fatalf("Expected the cache to hold 2 nonces, got %d", len(nonces))
+	}
+
+	// a was pushed out, so its replay is refused by its timestamp instead
+	if err := verify(now.Add(-30*time.Second), "a"); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected a replay of the evicted nonce to be refused, got %v", err)
+	}
+	if err := verify(now.Add(-29*time.Second), "b"); !errors.Is(err, ErrReplayed) {
+		t.Errorf("Expected a replay of a cached nonce to be refused, got %v", err)
+	}
+	if err := verify(now, "d"); err != nil {
+		t.Errorf("Expected a fresh request to be accepted, got %v", err)
+	}
+}
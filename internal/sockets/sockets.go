@@ -0,0 +1,60 @@
+// Package sockets counts the wallet sockets open, so they stay within the limits in
+// config
+package sockets
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/bryantjandra/goapi/internal/config"
+)
+
+var (
+	ErrServerFull = errors.New("too many wallet sockets are open, retry shortly")
+	ErrUserFull   = errors.New("too many wallet sockets are open for this account, close one first")
+)
+
+var (
+	mu     sync.Mutex
+	total  int
+	byUser = map[string]int{}
+)
+
+// Acquire counts a new socket for username, or refuses it with ErrServerFull or
+// ErrUserFull. release must be called once the socket has closed.
+func Acquire(username string) (release func(), err error) {
+	var cfg config.Config = config.Get()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if cfg.WalletSocketMaxConnections > 0 && total >= cfg.WalletSocketMaxConnections {
+		return nil, ErrServerFull
+	}
+	if cfg.WalletSocketMaxConnectionsPerUser > 0 && byUser[username] >= cfg.WalletSocketMaxConnectionsPerUser {
+		return nil, ErrUserFull
+	}
+	total++
+	byUser[username]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mu.Lock()
+			defer mu.Unlock()
+
+			total--
+			byUser[username]--
+			if byUser[username] == 0 {
+				delete(byUser, username)
+			}
+		})
+	}, nil
+}
+
+// Open is how many sockets are open, across the server and for username
+func Open(username string) (int, int) {
+	mu.Lock()
+	defer mu.Unlock()
+	return total, byUser[username]
+}
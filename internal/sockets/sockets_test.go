@@ -0,0 +1,55 @@
+package sockets
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/config"
+)
+
+func TestAcquire(t *testing.T) {
+	defer config.Set(config.Get())
+	var cfg config.Config = config.Get()
+	cfg.WalletSocketMaxConnections = 3
+	cfg.WalletSocketMaxConnectionsPerUser = 2
+	config.Set(cfg)
+
+	t.Run("Per_User_Limit", func(t *testing.T) {
+		first, err := Acquire("aaron")
+		if err != nil {
+			t.Fatalf("Expected the first socket accepted, got %v", err)
+		}
+		second, _ := Acquire("aaron")
+		if _, err = Acquire("aaron"); !errors.Is(err, ErrUserFull) {
+			t.Fatalf("Expected ErrUserFull, got %v", err)
+		}
+
+		// Releasing twice only frees one slot
+		first()
+		first()
+		if total, mine := Open("aaron"); total != 1 || mine != 1 {
+			t.Errorf("Expected 1 socket open, got %d and %d", total, mine)
+		}
+		second()
+	})
+
+	t.Run("Server_Limit", func(t *testing.T) {
+		var releases []func()
+		for _, username := range []string{"aaron", "bryan", "carol"} {
+			release, err := Acquire(username)
+			if err != nil {
+				t.Fatalf("Expected %s accepted, got %v", username, err)
+			}
+			releases = append(releases, release)
+		}
+		if _, err := Acquire("dave"); !errors.Is(err, ErrServerFull) {
+			t.Errorf("Expected ErrServerFull, got %v", err)
+		}
+		for _, release := range releases {
+			release()
+		}
+		if total, _ := Open(""); total != 0 {
+			t.Errorf("Expected every socket released, got %d", total)
+		}
+	})
+}
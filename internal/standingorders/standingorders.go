@@ -0,0 +1,664 @@
+// Package standingorders pays a fixed amount from one account to another on a
+// schedule. Orders are kept in a state file so they survive a restart, and each keeps
+// the history of its occurrences: executed, skipped or failed.
+package standingorders
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/profiles"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// Longest memo an order can carry, in bytes
+const MaxMemoLength = 140
+
+// Shortest interval an order can run at
+const MinInterval = time.Minute
+
+// Occurrences kept per order, older ones are dropped
+const maxHistory = 100
+
+// Occurrences waiting for funds per order, past this the oldest is skipped
+const maxQueued = 5
+
+// Most occurrences one order pays at once after the server was down, older ones are
+// skipped
+const maxCatchUp = 10
+
+var (
+	ErrInvalidOrder = errors.New("invalid standing order")
+	ErrNotFound     = errors.New("standing order not found")
+	ErrCancelled    = errors.New("standing order is already cancelled")
+)
+
+// Intervals besides a Go duration, calendar ones keep the time of day across DST
+const (
+	Daily   = "daily"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+)
+
+// What an order does with an occurrence the payer can't fund
+const (
+	InsufficientSkip  = "skip"
+	InsufficientQueue = "queue"
+)
+
+// Kind of the storage hold each payment is made through
+const holdKind = "standing_order"
+
+// Order and occurrence statuses
+const (
+	StatusActive    = "active"
+	StatusCancelled = "cancelled"
+
+	OccurrenceExecuted = "executed"
+	OccurrenceSkipped  = "skipped"
+	OccurrenceFailed   = "failed"
+)
+
+// One due payment and what came of it. At is when it was resolved, later than
+// ScheduledAt if it waited in the queue.
+type Occurrence struct {
+	ScheduledAt   time.Time
+	At            time.Time
+	Status        string
+	Amount        int64
+	TransactionID string
+	Reason        string
+}
+
+type Order struct {
+	ID                  string
+	From                string
+	To                  string
+	Amount              int64
+	Interval            string
+	Memo                string
+	OnInsufficientFunds string
+	Status              string
+	CreatedAt           time.Time
+	NextRunAt           time.Time
+
+	// Set once cancelled, queued occurrences are skipped then
+	CancelledAt time.Time
+
+	// Occurrences waiting for funds, oldest first
+	Queued []time.Time
+
+	// Occurrences NextRunAt has moved past that aren't resolved yet, oldest first
+	Due []time.Time
+
+	// The occurrence being paid, nil between payments
+	Paying *Payment
+
+	// Resolved occurrences, oldest first
+	Occurrences []Occurrence
+}
+
+// Payment is an occurrence on its way to the payee. Key names the storage hold that
+// carries the coins, and each step is saved before the next, so after a crash the hold
+// tells whether the transfer happened and it is never made twice.
+type Payment struct {
+	Key         string
+	ScheduledAt time.Time
+	Amount      int64
+
+	// Set once the hold is placed, from then on a missing hold means it was captured
+	Held bool
+
+	// Why storage refused the payment, its hold is released before it is recorded
+	Failed string
+}
+
+// next is when the occurrence after t is due. Calendar intervals count days and months
+// in the payer's location at the time of day the order was created, and a monthly
+// order created on a day a month doesn't have is paid on that month's last day.
+func next(interval string, anchor time.Time, t time.Time, location *time.Location) time.Time {
+	if !calendar(interval) {
+		duration, _ := time.ParseDuration(interval)
+		return t.Add(duration)
+	}
+
+	var year, month, day = t.In(location).Date()
+	switch interval {
+	case Daily:
+		day++
+	case Weekly:
+		day += 7
+	case Monthly:
+		month++
+		day = min(anchor.In(location).Day(), time.Date(year, month+1, 0, 0, 0, 0, 0, location).Day())
+	}
+	var clock = anchor.In(location)
+	return time.Date(year, month, day, clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), location)
+}
+
+// calendar reports whether the interval counts days rather than a fixed duration
+func calendar(interval string) bool {
+	return interval == Daily || interval == Weekly || interval == Monthly
+}
+
+// ValidInterval returns an error unless interval is daily, weekly, monthly or a Go
+// duration of at least MinInterval
+func ValidInterval(interval string) error {
+	switch interval {
+	case Daily, Weekly, Monthly:
+		return nil
+	}
+	duration, err := time.ParseDuration(interval)
+	if err != nil || duration < MinInterval {
+		return fmt.Errorf("%w: interval must be %s, %s, %s or a duration of at least %s", ErrInvalidOrder, Daily, Weekly, Monthly, MinInterval)
+	}
+	return nil
+}
+
+// Check runs the checks a transfer from the API gets. A refusal skips or queues the
+// occurrence as the order says.
+type Check func(database tools.DatabaseInterface, from string, to string, amount int64) error
+
+var (
+	mu sync.Mutex
+
+	// Every order by ID, cancelled ones are kept for their history
+	orders    = map[string]*Order{}
+	statePath string
+)
+
+func newID() string {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// Load reads the orders from path and writes them back there after every change. A
+// missing file is a first start. With no path the orders only live in memory.
+func Load(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	statePath = path
+	orders = map[string]*Order{}
+	if path == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading standing orders: %w", err)
+	}
+
+	err = json.Unmarshal(content, &orders)
+	if err != nil {
+		return fmt.Errorf("parsing standing orders %s: %w", path, err)
+	}
+	return nil
+}
+
+func saveLocked() {
+	if err := writeLocked(); err != nil {
+		log.Error("Failed to save standing orders: ", err)
+	}
+}
+
+func writeLocked() error {
+	if statePath == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(orders, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename, so a crash mid-write leaves the previous state intact
+	var temporary string = statePath + ".tmp"
+	err = os.WriteFile(temporary, content, 0o600)
+	if err == nil {
+		err = os.Rename(temporary, statePath)
+	}
+	return err
+}
+
+// Compact drops orders cancelled before now minus retention from the state file,
+// history and all, unless a payment is still being finished. Returns the file's size
+// in bytes before and after.
+func Compact(now time.Time, retention time.Duration) (int64, int64, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var before int64 = fileSize(statePath)
+	var dropped int
+	for id, order := range orders {
+		if order.Status == StatusCancelled && order.Paying == nil && order.CancelledAt.Before(now.Add(-retention)) {
+			delete(orders, id)
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		return before, before, nil
+	}
+
+	err := writeLocked()
+	if err != nil {
+		return before, before, fmt.Errorf("compacting standing orders: %w", err)
+	}
+	log.Info("Compacted standing orders, dropped ", dropped, " cancelled")
+	return before, fileSize(statePath), nil
+}
+
+// fileSize is the size of the file at path, 0 if there is none
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// Create adds an order paying amount from from to to every interval, the first
+// payment an interval from now
+func Create(database tools.DatabaseInterface, from string, to string, amount int64, interval string, memo string, onInsufficientFunds string, now time.Time) (Order, error) {
+	if amount <= 0 || from == "" || to == "" || from == to {
+		return Order{}, ErrInvalidOrder
+	}
+	if err := ValidInterval(interval); err != nil {
+		return Order{}, err
+	}
+	if len(memo) > MaxMemoLength {
+		return Order{}, fmt.Errorf("%w: memo must be at most %d bytes", ErrInvalidOrder, MaxMemoLength)
+	}
+	if onInsufficientFunds == "" {
+		onInsufficientFunds = InsufficientSkip
+	}
+	if onInsufficientFunds != InsufficientSkip && onInsufficientFunds != InsufficientQueue {
+		return Order{}, fmt.Errorf("%w: on insufficient funds must be %q or %q", ErrInvalidOrder, InsufficientSkip, InsufficientQueue)
+	}
+
+	var order = &Order{
+		ID:                  newID(),
+		From:                from,
+		To:                  to,
+		Amount:              amount,
+		Interval:            interval,
+		Memo:                memo,
+		OnInsufficientFunds: onInsufficientFunds,
+		Status:              StatusActive,
+		CreatedAt:           now,
+	}
+	order.NextRunAt = next(interval, now, now, location(database, order))
+
+	mu.Lock()
+	orders[order.ID] = order
+	saveLocked()
+	var result = copyOrder(order)
+	mu.Unlock()
+
+	recordChange(database, result)
+	return result, nil
+}
+
+// Cancel stops username's order, nothing more is paid besides a payment already under
+// way
+func Cancel(database tools.DatabaseInterface, id string, username string, now time.Time) (Order, error) {
+	mu.Lock()
+	order, ok := orders[id]
+	if !ok || order.From != username {
+		mu.Unlock()
+		return Order{}, ErrNotFound
+	}
+	if order.Status == StatusCancelled {
+		mu.Unlock()
+		return Order{}, ErrCancelled
+	}
+
+	order.Status = StatusCancelled
+	order.CancelledAt = now
+	for _, scheduledAt := range append(order.Queued, order.Due...) {
+		addOccurrenceLocked(order, Occurrence{ScheduledAt: scheduledAt, At: now, Status: OccurrenceSkipped, Reason: "order cancelled"})
+	}
+	order.Queued = nil
+	order.Due = nil
+	saveLocked()
+	var result = copyOrder(order)
+	mu.Unlock()
+
+	recordChange(database, result)
+	return result, nil
+}
+
+// Get returns username's order
+func Get(id string, username string) (Order, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	order, ok := orders[id]
+	if !ok || order.From != username {
+		return Order{}, ErrNotFound
+	}
+	return copyOrder(order), nil
+}
+
+// List returns the orders username pays, oldest first
+func List(username string) []Order {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var result = []Order{}
+	for _, order := range orders {
+		if order.From == username {
+			result = append(result, copyOrder(order))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// location is where the order's calendar days are counted, the payer's timezone. Only
+// calendar intervals read the profile.
+func location(database tools.DatabaseInterface, order *Order) *time.Location {
+	if !calendar(order.Interval) {
+		return time.UTC
+	}
+	return profiles.Location(database, order.From)
+}
+
+func copyOrder(order *Order) Order {
+	var copied Order = *order
+	copied.Queued = append([]time.Time(nil), order.Queued...)
+	copied.Due = append([]time.Time(nil), order.Due...)
+	if order.Paying != nil {
+		var payment Payment = *order.Paying
+		copied.Paying = &payment
+	}
+	copied.Occurrences = append([]Occurrence(nil), order.Occurrences...)
+	return copied
+}
+
+func addOccurrenceLocked(order *Order, occurrence Occurrence) {
+	order.Occurrences = append(order.Occurrences, occurrence)
+	if len(order.Occurrences) > maxHistory {
+		order.Occurrences = order.Occurrences[len(order.Occurrences)-maxHistory:]
+	}
+}
+
+func recordChange(database tools.DatabaseInterface, order Order) {
+	events.Record(database, events.StandingOrderChanged, order.From, map[string]interface{}{
+		"order":    order.ID,
+		"to":       order.To,
+		"amount":   order.Amount,
+		"interval": order.Interval,
+		"status":   order.Status,
+	})
+}
+
+// paymentKey is the ID of the storage hold paying the order's occurrence at
+// scheduledAt, the same for every attempt at it
+func paymentKey(id string, scheduledAt time.Time) string {
+	return id + ":" + strconv.FormatInt(scheduledAt.Unix(), 10)
+}
+
+// refused reports whether storage turned the payment down, rather than failing to
+// answer
+func refused(err error) bool {
+	return errors.Is(err, tools.ErrAccountFrozen) || errors.Is(err, tools.ErrUserNotFound) ||
+		errors.Is(err, tools.ErrInsufficientFunds) || errors.Is(err, tools.ErrBalanceOverflow) ||
+		errors.Is(err, tools.ErrInvalidAmount) || errors.Is(err, tools.ErrSelfTransfer)
+}
+
+// remove drops t from times, false if it isn't there
+func remove(times []time.Time, t time.Time) ([]time.Time, bool) {
+	for i := range times {
+		if times[i].Equal(t) {
+			return append(times[:i], times[i+1:]...), true
+		}
+	}
+	return times, false
+}
+
+// Execute pays every occurrence due at now, queued ones included. An occurrence check
+// refuses is queued or skipped as its order says, one the storage layer refuses fails.
+// After the server was down an order pays at most maxCatchUp missed occurrences.
+// Orders are saved as they advance, before anything is paid, and again at every step
+// of a payment. A payment a crash or an unavailable storage layer left unfinished is
+// finished first, paying it at most once.
+func Execute(database tools.DatabaseInterface, now time.Time, check Check) []Occurrence {
+	type due struct {
+		id          string
+		scheduledAt time.Time
+		retry       bool
+	}
+
+	var resolved []Occurrence
+	mu.Lock()
+	var unfinished []string
+	for _, order := range orders {
+		if order.Paying != nil {
+			unfinished = append(unfinished, order.ID)
+		}
+	}
+	mu.Unlock()
+	for _, id := range unfinished {
+		if occurrence, ok := pay(database, id, now); ok {
+			resolved = append(resolved, occurrence)
+		}
+	}
+
+	mu.Lock()
+	var pending []due
+	var advanced bool
+	for _, order := range orders {
+		if order.Status != StatusActive {
+			continue
+		}
+
+		var missed []time.Time
+		if !order.NextRunAt.After(now) {
+			var where *time.Location = location(database, order)
+			for ; !order.NextRunAt.After(now); order.NextRunAt = next(order.Interval, order.CreatedAt, order.NextRunAt, where) {
+				missed = append(missed, order.NextRunAt)
+			}
+			advanced = true
+		}
+		for _, scheduledAt := range missed[:max(0, len(missed)-maxCatchUp)] {
+			addOccurrenceLocked(order, Occurrence{ScheduledAt: scheduledAt, At: now, Status: OccurrenceSkipped, Reason: "missed while the server was down"})
+		}
+		order.Due = append(order.Due, missed[max(0, len(missed)-maxCatchUp):]...)
+
+		// An order still finishing a payment waits for it
+		if order.Paying != nil {
+			continue
+		}
+		for _, scheduledAt := range order.Queued {
+			pending = append(pending, due{id: order.ID, scheduledAt: scheduledAt, retry: true})
+		}
+		for _, scheduledAt := range order.Due {
+			pending = append(pending, due{id: order.ID, scheduledAt: scheduledAt})
+		}
+	}
+	if advanced {
+		saveLocked()
+	}
+	mu.Unlock()
+
+	// Oldest first, so a payer short of funds pays their earliest occurrences
+	sort.Slice(pending, func(i, j int) bool { return pending[i].scheduledAt.Before(pending[j].scheduledAt) })
+
+	for _, p := range pending {
+		mu.Lock()
+		order := orders[p.id]
+		var from, to, amount, policy = order.From, order.To, order.Amount, order.OnInsufficientFunds
+		var busy bool = order.Status != StatusActive || order.Paying != nil
+		mu.Unlock()
+		if busy {
+			continue
+		}
+
+		err := check(database, from, to, amount)
+
+		mu.Lock()
+		// Cancelling or skipping the oldest queued one may have resolved it meanwhile
+		var found bool
+		if p.retry {
+			order.Queued, found = remove(order.Queued, p.scheduledAt)
+		} else {
+			order.Due, found = remove(order.Due, p.scheduledAt)
+		}
+		if !found {
+			mu.Unlock()
+			continue
+		}
+
+		if err == nil {
+			order.Paying = &Payment{Key: paymentKey(order.ID, p.scheduledAt), ScheduledAt: p.scheduledAt, Amount: amount}
+			saveLocked()
+			mu.Unlock()
+
+			if occurrence, ok := pay(database, p.id, now); ok {
+				resolved = append(resolved, occurrence)
+			}
+			continue
+		}
+
+		var occurrence = Occurrence{ScheduledAt: p.scheduledAt, At: now, Status: OccurrenceSkipped, Amount: amount, Reason: err.Error()}
+		if policy == InsufficientQueue {
+			order.Queued = append(order.Queued, p.scheduledAt)
+			sort.Slice(order.Queued, func(i, j int) bool { return order.Queued[i].Before(order.Queued[j]) })
+			if len(order.Queued) <= maxQueued {
+				// Retries that are still waiting change nothing worth saving
+				if !p.retry {
+					saveLocked()
+				}
+				mu.Unlock()
+				continue
+			}
+			occurrence.ScheduledAt = order.Queued[0]
+			order.Queued = order.Queued[1:]
+		}
+		addOccurrenceLocked(order, occurrence)
+		saveLocked()
+		mu.Unlock()
+
+		logOccurrence(order, occurrence)
+		resolved = append(resolved, occurrence)
+	}
+	return resolved
+}
+
+// pay takes the order's payment on from the step it last saved: placing its hold,
+// capturing it to the payee, or releasing it after a refusal. false when storage
+// couldn't answer, the payment is taken on again on the next run.
+func pay(database tools.DatabaseInterface, id string, now time.Time) (Occurrence, bool) {
+	mu.Lock()
+	var order *Order = orders[id]
+	var payment Payment = *order.Paying
+	var from, to string = order.From, order.To
+	mu.Unlock()
+
+	// step saves how far the payment got before the next step is taken
+	var step = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		var saved Payment = payment
+		order.Paying = &saved
+		saveLocked()
+	}
+
+	var occurrence = Occurrence{ScheduledAt: payment.ScheduledAt, At: now, Amount: payment.Amount}
+	if !payment.Held && payment.Failed == "" {
+		_, err := database.PlaceHold(tools.Hold{ID: payment.Key, Account: from, Kind: holdKind, Amount: payment.Amount, CreatedAt: now})
+		switch {
+		case refused(err):
+			payment.Failed = err.Error()
+		case err != nil:
+			log.Error("Standing order ", id, " could not set its payment aside: ", err)
+			return Occurrence{}, false
+		default:
+			payment.Held = true
+		}
+		step()
+	}
+
+	if payment.Held && payment.Failed == "" {
+		fromDetails, _, err := database.CaptureHold(context.Background(), payment.Key, to, payment.Amount)
+		switch {
+		case errors.Is(err, tools.ErrHoldNotFound):
+			// Captured by a run that stopped before it could record it
+			occurrence.Status = OccurrenceExecuted
+		case refused(err):
+			payment.Failed = err.Error()
+			step()
+		case err != nil:
+			log.Error("Standing order ", id, " could not pay: ", err)
+			return Occurrence{}, false
+		default:
+			occurrence.Status = OccurrenceExecuted
+			occurrence.TransactionID = fromDetails.TransactionID
+			events.Record(database, events.TransferCompleted, from, map[string]interface{}{
+				"from":           from,
+				"to":             to,
+				"amount":         payment.Amount,
+				"standing_order": id,
+			})
+		}
+	}
+
+	if payment.Failed != "" {
+		if payment.Held {
+			_, err := database.ReleaseHold(payment.Key)
+			if err != nil && !errors.Is(err, tools.ErrHoldNotFound) {
+				log.Error("Standing order ", id, " could not release its refused payment: ", err)
+				return Occurrence{}, false
+			}
+		}
+		occurrence.Status = OccurrenceFailed
+		occurrence.Reason = payment.Failed
+		log.Error("Standing order transfer failed for users: ", from, " -> ", to, " amount: ", payment.Amount, ": ", payment.Failed)
+	}
+
+	mu.Lock()
+	order.Paying = nil
+	addOccurrenceLocked(order, occurrence)
+	saveLocked()
+	mu.Unlock()
+
+	logOccurrence(order, occurrence)
+	return occurrence, true
+}
+
+func logOccurrence(order *Order, occurrence Occurrence) {
+	log.WithFields(log.Fields{
+		"order":     order.ID,
+		"from":      order.From,
+		"to":        order.To,
+		"amount":    occurrence.Amount,
+		"scheduled": occurrence.ScheduledAt,
+		"status":    occurrence.Status,
+		"reason":    occurrence.Reason,
+	}).Info("Standing order occurrence resolved")
+}
+
+// Scheduled pays the occurrences due now once for the scheduler
+func Scheduled(open func() (tools.DatabaseInterface, error), check Check) {
+	database, err := open()
+	if err != nil {
+		log.Error("Standing orders could not open the database: ", err)
+		return
+	}
+	Execute(database, time.Now(), check)
+}
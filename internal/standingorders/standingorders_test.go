@@ -0,0 +1,269 @@
+package standingorders
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/profiles"
+	"github.com/bryantjandra/goapi/internal/tools"
+	"github.com/bryantjandra/goapi/internal/tools/toolstest"
+)
+
+// checkBalance refuses what the payer's balance doesn't cover, like the service check
+func checkBalance(database tools.DatabaseInterface, from string, to string, amount int64) error {
+	coins, err := database.GetUserCoins(from)
+	if err != nil {
+		return err
+	}
+	if amount > coins.Coins {
+		return tools.ErrInsufficientFunds
+	}
+	return nil
+}
+
+// unavailable fails to capture holds like a storage layer that stopped answering,
+// after moving the coins when captured is set
+type unavailable struct {
+	tools.DatabaseInterface
+	captured bool
+}
+
+func (d unavailable) CaptureHold(ctx context.Context, id string, to string, amount int64) (*tools.CoinDetails, *tools.CoinDetails, error) {
+	if d.captured {
+		d.DatabaseInterface.CaptureHold(ctx, id, to, amount)
+	}
+	return nil, nil, tools.ErrStorageUnavailable
+}
+
+func TestStandingOrders(t *testing.T) {
+	var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Pays_Each_Occurrence_When_Due", func(t *testing.T) {
+		Load("")
+		database := toolstest.New(t, nil)
+
+		order, err := Create(database, "aaron", "bryan", 100, Daily, "Rent", "", now)
+		if err != nil || order.OnInsufficientFunds != InsufficientSkip || !order.NextRunAt.Equal(now.AddDate(0, 0, 1)) {
+			t.Fatalf("Expected a daily order skipping by default, got %+v, %v", order, err)
+		}
+
+		if resolved := Execute(database, now.Add(23*time.Hour), checkBalance); len(resolved) != 0 {
+			t.Fatalf("Expected nothing due yet, got %+v", resolved)
+		}
+		resolved := Execute(database, now.AddDate(0, 0, 2), checkBalance)
+		if len(resolved) != 2 || resolved[0].Status != OccurrenceExecuted || resolved[0].TransactionID == "" {
+			t.Fatalf("Expected two executed occurrences, got %+v", resolved)
+		}
+
+		aaron, _ := database.GetUserCoins("aaron")
+		bryan, _ := database.GetUserCoins("bryan")
+		if aaron.Coins != 800 || bryan.Coins != 1200 {
+			t.Errorf("Expected 800 and 1200, got %d and %d", aaron.Coins, bryan.Coins)
+		}
+		order, _ = Get(order.ID, "aaron")
+		if len(order.Occurrences) != 2 || !order.NextRunAt.Equal(now.AddDate(0, 0, 3)) {
+			t.Errorf("Expected two occurrences and the third next, got %+v", order)
+		}
+	})
+
+	t.Run("Skips_Or_Queues_Without_Funds", func(t *testing.T) {
+		Load("")
+		database := toolstest.New(t, nil)
+
+		skipping, _ := Create(database, "aaron", "bryan", 5000, time.Hour.String(), "", InsufficientSkip, now)
+		queueing, _ := Create(database, "bryan", "aaron", 1500, time.Hour.String(), "", InsufficientQueue, now)
+
+		Execute(database, now.Add(time.Hour), checkBalance)
+		skipping, _ = Get(skipping.ID, "aaron")
+		if len(skipping.Occurrences) != 1 || skipping.Occurrences[0].Status != OccurrenceSkipped || skipping.Occurrences[0].Reason == "" {
+			t.Errorf("Expected the occurrence skipped with a reason, got %+v", skipping.Occurrences)
+		}
+		queueing, _ = Get(queueing.ID, "bryan")
+		if len(queueing.Occurrences) != 0 || len(queueing.Queued) != 1 {
+			t.Fatalf("Expected the occurrence queued, got %+v", queueing)
+		}
+
+		database.AddUserCoins("bryan", 600)
+		resolved := Execute(database, now.Add(90*time.Minute), checkBalance)
+		if len(resolved) != 1 || resolved[0].Status != OccurrenceExecuted || !resolved[0].ScheduledAt.Equal(now.Add(time.Hour)) {
+			t.Fatalf("Expected the queued occurrence paid once funded, got %+v", resolved)
+		}
+		queueing, _ = Get(queueing.ID, "bryan")
+		if len(queueing.Queued) != 0 {
+			t.Errorf("Expected the queue empty, got %+v", queueing.Queued)
+		}
+	})
+
+	t.Run("Queue_Is_Bounded", func(t *testing.T) {
+		Load("")
+		database := toolstest.New(t, nil)
+
+		order, _ := Create(database, "aaron", "bryan", 5000, time.Hour.String(), "", InsufficientQueue, now)
+		Execute(database, now.Add(time.Duration(maxQueued+2)*time.Hour), checkBalance)
+
+		order, _ = Get(order.ID, "aaron")
+		if len(order.Queued) != maxQueued || len(order.Occurrences) != 2 || order.Occurrences[0].Status != OccurrenceSkipped {
+			t.Errorf("Expected %d queued and the oldest 2 skipped, got %+v", maxQueued, order)
+		}
+	})
+
+	t.Run("Cancel_Stops_Payments", func(t *testing.T) {
+		Load("")
+		database := toolstest.New(t, nil)
+
+		order, _ := Create(database, "aaron", "bryan", 5000, time.Hour.String(), "", InsufficientQueue, now)
+		Execute(database, now.Add(time.Hour), checkBalance)
+
+		if _, err := Cancel(database, order.ID, "bryan", now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for the payee, got %v", err)
+		}
+		cancelled, err := Cancel(database, order.ID, "aaron", now.Add(time.Hour))
+		if err != nil || cancelled.Status != StatusCancelled || len(cancelled.Queued) != 0 || len(cancelled.Occurrences) != 1 {
+			t.Fatalf("Expected the queued occurrence skipped on cancel, got %+v, %v", cancelled, err)
+		}
+		if _, err := Cancel(database, order.ID, "aaron", now); !errors.Is(err, ErrCancelled) {
+			t.Errorf("Expected ErrCancelled, got %v", err)
+		}
+		if resolved := Execute(database, now.Add(5*time.Hour), checkBalance); len(resolved) != 0 {
+			t.Errorf("Expected nothing paid after cancelling, got %+v", resolved)
+		}
+	})
+
+	t.Run("Survives_A_Restart", func(t *testing.T) {
+		var path string = filepath.Join(t.TempDir(), "standing-orders.json")
+		if err := Load(path); err != nil {
+			t.Fatalf("Failed to load: %v", err)
+		}
+		database := toolstest.New(t, nil)
+
+		order, _ := Create(database, "aaron", "bryan", 10, time.Hour.String(), "", "", now)
+		Execute(database, now.Add(time.Hour), checkBalance)
+
+		if err := Load(path); err != nil {
+			t.Fatalf("Failed to reload: %v", err)
+		}
+		restored, err := Get(order.ID, "aaron")
+		if err != nil || len(restored.Occurrences) != 1 || !restored.NextRunAt.Equal(now.Add(2*time.Hour)) {
+			t.Fatalf("Expected the order and its history back, got %+v, %v", restored, err)
+		}
+
+		// A long outage pays at most maxCatchUp, the rest are skipped
+		resolved := Execute(database, now.Add(time.Duration(maxCatchUp+11)*time.Hour), checkBalance)
+		restored, _ = Get(order.ID, "aaron")
+		if len(resolved) != maxCatchUp || len(restored.Occurrences) != maxCatchUp+11 {
+			t.Errorf("Expected %d paid of %d missed, got %d and %d occurrences", maxCatchUp, maxCatchUp+10, len(resolved), len(restored.Occurrences))
+		}
+	})
+
+	t.Run("Compact_Drops_Long_Cancelled_Orders", func(t *testing.T) {
+		var path string = filepath.Join(t.TempDir(), "standing-orders.json")
+		if err := Load(path); err != nil {
+			t.Fatalf("Failed to load: %v", err)
+		}
+		database := toolstest.New(t, nil)
+
+		old, _ := Create(database, "aaron", "bryan", 10, time.Hour.String(), "", "", now)
+		recent, _ := Create(database, "aaron", "bryan", 10, time.Hour.String(), "", "", now)
+		kept, _ := Create(database, "aaron", "bryan", 10, time.Hour.String(), "", "", now)
+		Cancel(database, old.ID, "aaron", now)
+		Cancel(database, recent.ID, "aaron", now.Add(20*24*time.Hour))
+
+		before, after, err := Compact(now.Add(40*24*time.Hour), 30*24*time.Hour)
+		if err != nil || after >= before {
+			t.Fatalf("Expected the file to shrink, %d to %d bytes: %v", before, after, err)
+		}
+		if err := Load(path); err != nil {
+			t.Fatalf("Failed to reload: %v", err)
+		}
+		if _, err := Get(old.ID, "aaron"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected the order cancelled 40 days ago dropped, got %v", err)
+		}
+		if _, err := Get(recent.ID, "aaron"); err != nil {
+			t.Errorf("Expected the order cancelled 20 days ago kept, got %v", err)
+		}
+		if _, err := Get(kept.ID, "aaron"); err != nil {
+			t.Errorf("Expected the active order kept, got %v", err)
+		}
+	})
+
+	t.Run("Finishes_An_Interrupted_Payment", func(t *testing.T) {
+		var path string = filepath.Join(t.TempDir(), "standing-orders.json")
+		Load(path)
+		database := toolstest.New(t, nil)
+
+		order, _ := Create(database, "aaron", "bryan", 100, time.Hour.String(), "", "", now)
+		if resolved := Execute(unavailable{database, false}, now.Add(time.Hour), checkBalance); len(resolved) != 0 {
+			t.Fatalf("Expected the payment left unfinished, got %+v", resolved)
+		}
+		Load(path)
+		if restored, _ := Get(order.ID, "aaron"); restored.Paying == nil || !restored.Paying.Held || !restored.NextRunAt.Equal(now.Add(2*time.Hour)) {
+			t.Fatalf("Expected the advance and the held payment saved, got %+v", restored)
+		}
+
+		resolved := Execute(database, now.Add(time.Hour), checkBalance)
+		if len(resolved) != 1 || resolved[0].Status != OccurrenceExecuted || resolved[0].TransactionID == "" {
+			t.Fatalf("Expected the payment finished after the restart, got %+v", resolved)
+		}
+
+		// The transfer went through but the answer was lost
+		Execute(unavailable{database, true}, now.Add(2*time.Hour), checkBalance)
+		Load(path)
+		resolved = Execute(database, now.Add(2*time.Hour), checkBalance)
+		if len(resolved) != 1 || resolved[0].Status != OccurrenceExecuted {
+			t.Fatalf("Expected the captured payment recorded, got %+v", resolved)
+		}
+
+		aaron, _ := database.GetUserCoins("aaron")
+		bryan, _ := database.GetUserCoins("bryan")
+		if aaron.Coins != 800 || aaron.Held != 0 || bryan.Coins != 1200 {
+			t.Errorf("Expected each occurrence paid once, got %+v and %+v", aaron, bryan)
+		}
+		if restored, _ := Get(order.ID, "aaron"); restored.Paying != nil || len(restored.Occurrences) != 2 {
+			t.Errorf("Expected two occurrences and nothing in flight, got %+v", restored)
+		}
+	})
+
+	t.Run("Counts_Days_In_The_Payers_Timezone", func(t *testing.T) {
+		Load("")
+		database := toolstest.New(t, nil)
+		if _, err := profiles.SetTimezone(database, "aaron", "America/New_York"); err != nil {
+			t.Fatalf("Failed to set the timezone: %v", err)
+		}
+		newYork, _ := time.LoadLocation("America/New_York")
+
+		// Clocks go forward on 8 March, the order still pays at 9:00 there
+		var created = time.Date(2026, 3, 7, 9, 0, 0, 0, newYork)
+		order, _ := Create(database, "aaron", "bryan", 10, Daily, "", "", created)
+		if want := time.Date(2026, 3, 8, 13, 0, 0, 0, time.UTC); !order.NextRunAt.Equal(want) {
+			t.Errorf("Expected %s, got %s", want, order.NextRunAt.UTC())
+		}
+
+		// A month without the day pays on its last day, then goes back to the day
+		var anchor = time.Date(2026, 1, 31, 9, 0, 0, 0, newYork)
+		february := next(Monthly, anchor, anchor, newYork)
+		march := next(Monthly, anchor, february, newYork)
+		if !february.Equal(time.Date(2026, 2, 28, 9, 0, 0, 0, newYork)) || !march.Equal(time.Date(2026, 3, 31, 9, 0, 0, 0, newYork)) {
+			t.Errorf("Expected 28 February and 31 March, got %s and %s", february, march)
+		}
+	})
+
+	t.Run("Refuses_Invalid_Orders", func(t *testing.T) {
+		Load("")
+		database := toolstest.New(t, nil)
+
+		for _, interval := range []string{"", "30s", "fortnightly"} {
+			if _, err := Create(database, "aaron", "bryan", 10, interval, "", "", now); !errors.Is(err, ErrInvalidOrder) {
+				t.Errorf("Expected ErrInvalidOrder for interval %q, got %v", interval, err)
+			}
+		}
+		if _, err := Create(database, "aaron", "aaron", 10, Daily, "", "", now); !errors.Is(err, ErrInvalidOrder) {
+			t.Errorf("Expected ErrInvalidOrder paying yourself, got %v", err)
+		}
+		if _, err := Create(database, "aaron", "bryan", 10, Daily, "", "later", now); !errors.Is(err, ErrInvalidOrder) {
+			t.Errorf("Expected ErrInvalidOrder for an unknown policy, got %v", err)
+		}
+	})
+}
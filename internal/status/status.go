@@ -0,0 +1,45 @@
+package status
+
+import (
+	"sync"
+	"time"
+)
+
+// Incident note admins publish on the public status page
+type Incident struct {
+	Note  string
+	SetBy string
+	SetAt time.Time
+}
+
+var (
+	mu      sync.RWMutex
+	current *Incident
+)
+
+// SetIncident publishes a note, replacing any previous one
+func SetIncident(note string, setBy string) Incident {
+	mu.Lock()
+	defer mu.Unlock()
+
+	current = &Incident{Note: note, SetBy: setBy, SetAt: time.Now()}
+	return *current
+}
+
+func ClearIncident() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	current = nil
+}
+
+// CurrentIncident returns the published note, if any
+func CurrentIncident() (Incident, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if current == nil {
+		return Incident{}, false
+	}
+	return *current, true
+}
@@ -0,0 +1,155 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// Session is an access token and the refresh token that replaces both once it expires
+type Session struct {
+	Access  Token
+	Refresh Token
+}
+
+// Access tokens revoked before they expire, by ID. Only this process refuses them, other
+// replicas keep accepting one until it expires, so TTL should stay short.
+var (
+	revokedMu sync.Mutex
+	revoked   = map[string]time.Time{}
+)
+
+// StartSession issues username an access token and a refresh token starting a new family.
+// Every refresh token rotated from it shares the family, so reuse can revoke them all.
+func (i *Issuer) StartSession(database tools.DatabaseInterface, username string) (Session, error) {
+	return i.session(database, username, randomID())
+}
+
+// Refresh trades a refresh token for a new session, the refresh token can't be used again.
+// Presenting one that was already used revokes its whole family, since either the client
+// or whoever copied the token is still holding a rotated one.
+func (i *Issuer) Refresh(database tools.DatabaseInterface, value string) (Session, error) {
+	token, err := database.RevokeRefreshToken(HashRefreshToken(value))
+	if errors.Is(err, tools.ErrRefreshTokenNotFound) {
+		return Session{}, ErrInvalidRefreshToken
+	}
+	if errors.Is(err, tools.ErrRefreshTokenRevoked) {
+		count, revokeErr := database.RevokeRefreshTokens(token.Username, token.Family)
+		if revokeErr != nil {
+			return Session{}, fmt.Errorf("revoking reused refresh token family: %w", revokeErr)
+		}
+		log.Warn("Refresh token reused for ", token.Username, ", revoked ", count, " refresh tokens of its family")
+		return Session{}, fmt.Errorf("%w: already used", ErrInvalidRefreshToken)
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return Session{}, fmt.Errorf("%w: expired", ErrInvalidRefreshToken)
+	}
+	// Deleted accounts keep no sessions
+	if database.GetUserLoginDetails(token.Username) == nil {
+		return Session{}, fmt.Errorf("%w: account no longer exists", ErrInvalidRefreshToken)
+	}
+	return i.session(database, token.Username, token.Family)
+}
+
+// Logout revokes the family of username's refresh token value, or every refresh token
+// of username with all, and returns how many were still usable
+func Logout(database tools.DatabaseInterface, username string, value string, all bool) (int, error) {
+	if all {
+		return database.RevokeRefreshTokens(username, "")
+	}
+	if value == "" {
+		return 0, nil
+	}
+
+	token, err := database.RevokeRefreshToken(HashRefreshToken(value))
+	if errors.Is(err, tools.ErrRefreshTokenNotFound) {
+		return 0, ErrInvalidRefreshToken
+	}
+	if err != nil && !errors.Is(err, tools.ErrRefreshTokenRevoked) {
+		return 0, err
+	}
+	if token.Username != username {
+		return 0, fmt.Errorf("%w: issued to another user", ErrInvalidRefreshToken)
+	}
+
+	count, err := database.RevokeRefreshTokens(username, token.Family)
+	if err == nil && token.RevokedAt.IsZero() {
+		count++
+	}
+	return count, err
+}
+
+// Revoke stops this process accepting an access token before it expires
+func Revoke(claims Claims) {
+	revokedMu.Lock()
+	defer revokedMu.Unlock()
+
+	var now time.Time = time.Now()
+	for id, expiresAt := range revoked {
+		if expiresAt.Add(leeway).Before(now) {
+			delete(revoked, id)
+		}
+	}
+	revoked[claims.ID] = claims.ExpiresAt
+}
+
+func isRevoked(id string) bool {
+	revokedMu.Lock()
+	defer revokedMu.Unlock()
+
+	_, ok := revoked[id]
+	return ok
+}
+
+// HashRefreshToken is how a refresh token is stored, so a copy of the store can't be used
+func HashRefreshToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func (i *Issuer) session(database tools.DatabaseInterface, username string, family string) (Session, error) {
+	access, err := i.Issue(username)
+	if err != nil {
+		return Session{}, err
+	}
+
+	var value = make([]byte, 32)
+	rand.Read(value)
+	var now time.Time = time.Now()
+	var refresh = Token{
+		Value:     base64.RawURLEncoding.EncodeToString(value),
+		ExpiresAt: now.Add(i.settings.RefreshTTL),
+	}
+
+	err = database.StoreRefreshToken(tools.RefreshToken{
+		Hash:      HashRefreshToken(refresh.Value),
+		Username:  username,
+		Family:    family,
+		IssuedAt:  now,
+		ExpiresAt: refresh.ExpiresAt,
+	})
+	if err != nil {
+		return Session{}, fmt.Errorf("storing refresh token: %w", err)
+	}
+	return Session{Access: access, Refresh: refresh}, nil
+}
+
+func randomID() string {
+	var id = make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
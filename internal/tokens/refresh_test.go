@@ -0,0 +1,104 @@
+package tokens
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+func TestSessions(t *testing.T) {
+	var settings = Settings{Algorithm: "HS256", Secret: "0123456789abcdef0123456789abcdef", TTL: time.Minute, RefreshTTL: time.Hour}
+	issuer, err := For(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newDatabase := func(t *testing.T) tools.DatabaseInterface {
+		database, err := tools.NewMemoryDatabase(map[string]tools.LoginDetails{
+			"aaron": {AuthToken: "1", Username: "aaron", Role: tools.RoleUser},
+		}, map[string]tools.CoinDetails{
+			"aaron": {Username: "aaron", Coins: 100, Version: 1},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *database
+	}
+
+	t.Run("Refresh_Rotates", func(t *testing.T) {
+		database := newDatabase(t)
+		session, err := issuer.StartSession(database, "aaron")
+		if err != nil {
+			t.Fatalf("Failed to start session: %v", err)
+		}
+
+		refreshed, err := issuer.Refresh(database, session.Refresh.Value)
+		if err != nil {
+			t.Fatalf("Failed to refresh: %v", err)
+		}
+		if refreshed.Refresh.Value == session.Refresh.Value {
+			t.Error("Expected a new refresh token")
+		}
+		if username, err := issuer.Verify("Bearer " + refreshed.Access.Value); username != "aaron" {
+			t.Errorf("Expected the new access token to be aaron's, got %q: %v", username, err)
+		}
+	})
+
+	t.Run("Reuse_Revokes_Family", func(t *testing.T) {
+		database := newDatabase(t)
+		session, _ := issuer.StartSession(database, "aaron")
+		other, _ := issuer.StartSession(database, "aaron")
+		refreshed, _ := issuer.Refresh(database, session.Refresh.Value)
+
+		_, err := issuer.Refresh(database, session.Refresh.Value)
+		if !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Fatalf("Expected the used refresh token to be refused, got %v", err)
+		}
+		if _, err = issuer.Refresh(database, refreshed.Refresh.Value); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("Expected the rotated refresh token to be revoked with its family, got %v", err)
+		}
+		if _, err = issuer.Refresh(database, other.Refresh.Value); err != nil {
+			t.Errorf("Expected the other session to survive, got %v", err)
+		}
+	})
+
+	t.Run("Logout", func(t *testing.T) {
+		database := newDatabase(t)
+		session, _ := issuer.StartSession(database, "aaron")
+		other, _ := issuer.StartSession(database, "aaron")
+
+		if _, err := Logout(database, "bryan", session.Refresh.Value, false); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("Expected another user's refresh token to be refused, got %v", err)
+		}
+		if _, err := Logout(database, "aaron", other.Refresh.Value, false); err != nil {
+			t.Fatalf("Failed to log out: %v", err)
+		}
+		if _, err := issuer.Refresh(database, other.Refresh.Value); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("Expected the logged out refresh token to be refused, got %v", err)
+		}
+
+		claims, err := issuer.VerifyClaims("Bearer " + other.Access.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		Revoke(claims)
+		if _, err = issuer.Verify("Bearer " + other.Access.Value); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected the revoked access token to be refused, got %v", err)
+		}
+		if _, err = issuer.Verify("Bearer " + session.Access.Value); err != nil {
+			t.Errorf("Expected the other access token to still work, got %v", err)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		database := newDatabase(t)
+		expiring, _ := For(Settings{Algorithm: settings.Algorithm, Secret: settings.Secret, TTL: time.Minute, RefreshTTL: -time.Second})
+		session, _ := expiring.StartSession(database, "aaron")
+
+		if _, err := issuer.Refresh(database, session.Refresh.Value); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("Expected an expired refresh token to be refused, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+// Package tokens issues and verifies the access tokens of the jwt auth mode. Clients
+// exchange their static token for one at /login and send it as a bearer token until
+// it expires, then trade the refresh token they got with it for a new pair.
+package tokens
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid access token")
+	ErrInvalidKey   = errors.New("invalid access token signing key")
+)
+
+const (
+	// Names this server as the issuer, so tokens from anything else sharing the key are refused
+	issuer = "goapi"
+
+	// Clock skew allowed on exp, nbf and iat between replicas
+	leeway = 30 * time.Second
+)
+
+type Settings struct {
+	// HS256 signs with Secret, RS256 with the PEM private key in PrivateKeyFile
+	Algorithm      string
+	Secret         string
+	PrivateKeyFile string
+
+	// How long an issued access token stays valid, and the refresh token issued with it
+	TTL        time.Duration
+	RefreshTTL time.Duration
+}
+
+// Token is a signed access token and when it stops being accepted
+type Token struct {
+	Value     string
+	ExpiresAt time.Time
+}
+
+// Claims is what a verified access token says about itself
+type Claims struct {
+	Username  string
+	ID        string
+	ExpiresAt time.Time
+}
+
+type Issuer struct {
+	settings  Settings
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+var (
+	issuersMu sync.Mutex
+	issuers   = map[Settings]*Issuer{}
+)
+
+// For returns the issuer for settings, loading its key only the first time
+func For(settings Settings) (*Issuer, error) {
+	issuersMu.Lock()
+	defer issuersMu.Unlock()
+
+	if issuer, ok := issuers[settings]; ok {
+		return issuer, nil
+	}
+
+	var issuer = &Issuer{settings: settings}
+	switch settings.Algorithm {
+	case jwt.SigningMethodHS256.Alg():
+		if settings.Secret == "" {
+			return nil, fmt.Errorf("%w: no secret for HS256", ErrInvalidKey)
+		}
+		issuer.method = jwt.SigningMethodHS256
+		issuer.signKey = []byte(settings.Secret)
+		issuer.verifyKey = []byte(settings.Secret)
+
+	case jwt.SigningMethodRS256.Alg():
+		contents, err := os.ReadFile(settings.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(contents)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+		issuer.method = jwt.SigningMethodRS256
+		issuer.signKey = key
+		issuer.verifyKey = &key.PublicKey
+
+	default:
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidKey, settings.Algorithm)
+	}
+
+	issuers[settings] = issuer
+	return issuer, nil
+}
+
+// Issue signs a token naming username in its sub claim
+func (i *Issuer) Issue(username string) (Token, error) {
+	var now time.Time = time.Now()
+
+	var claims = jwt.RegisteredClaims{
+		Issuer:    issuer,
+		Subject:   username,
+		ID:        randomID(),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(i.settings.TTL)),
+	}
+
+	signed, err := jwt.NewWithClaims(i.method, claims).SignedString(i.signKey)
+	if err != nil {
+		return Token{}, err
+	}
+	return Token{Value: signed, ExpiresAt: claims.ExpiresAt.Time}, nil
+}
+
+// Verify checks the signature, issuer and lifetime of a bearer token and returns the
+// username it was issued to
+func (i *Issuer) Verify(header string) (string, error) {
+	claims, err := i.VerifyClaims(header)
+	return claims.Username, err
+}
+
+// VerifyClaims is Verify returning the token's ID and expiry too, a revoked token fails it
+func (i *Issuer) VerifyClaims(header string) (Claims, error) {
+	var raw string = strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		return i.verifyKey, nil
+	},
+		// Only the configured algorithm, so an RS256 public key can't verify an HMAC token
+		jwt.WithValidMethods([]string{i.method.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(leeway),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.Subject == "" || len(claims.Subject) > 64 {
+		return Claims{}, fmt.Errorf("%w: sub must be a username of at most 64 characters", ErrInvalidToken)
+	}
+	if isRevoked(claims.ID) {
+		return Claims{}, fmt.Errorf("%w: revoked", ErrInvalidToken)
+	}
+	return Claims{Username: claims.Subject, ID: claims.ID, ExpiresAt: claims.ExpiresAt.Time}, nil
+}
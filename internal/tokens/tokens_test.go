@@ -0,0 +1,90 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyFile string = filepath.Join(t.TempDir(), "key.pem")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hs256 = Settings{Algorithm: "HS256", Secret: "0123456789abcdef0123456789abcdef", TTL: time.Minute}
+	var rs256 = Settings{Algorithm: "RS256", PrivateKeyFile: keyFile, TTL: time.Minute}
+
+	for _, settings := range []Settings{hs256, rs256} {
+		t.Run(settings.Algorithm+"_Round_Trip", func(t *testing.T) {
+			issuer, err := For(settings)
+			if err != nil {
+				t.Fatalf("Failed to load issuer: %v", err)
+			}
+			token, err := issuer.Issue("aaron")
+			if err != nil {
+				t.Fatalf("Failed to issue token: %v", err)
+			}
+
+			username, err := issuer.Verify("Bearer " + token.Value)
+			if err != nil || username != "aaron" {
+				t.Errorf("Expected aaron, got %q: %v", username, err)
+			}
+		})
+	}
+
+	t.Run("Expired_Token", func(t *testing.T) {
+		issuer, _ := For(Settings{Algorithm: "HS256", Secret: hs256.Secret, TTL: -time.Hour})
+		token, _ := issuer.Issue("aaron")
+
+		verifier, _ := For(hs256)
+		_, err := verifier.Verify("Bearer " + token.Value)
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected ErrInvalidToken, got %v", err)
+		}
+	})
+
+	t.Run("Wrong_Secret", func(t *testing.T) {
+		issuer, _ := For(Settings{Algorithm: "HS256", Secret: "another secret of at least 32 bytes", TTL: time.Minute})
+		token, _ := issuer.Issue("aaron")
+
+		verifier, _ := For(hs256)
+		_, err := verifier.Verify("Bearer " + token.Value)
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected ErrInvalidToken, got %v", err)
+		}
+	})
+
+	t.Run("HMAC_Signed_With_Public_Key", func(t *testing.T) {
+		public, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+			Issuer: issuer, Subject: "admin", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}).SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+
+		verifier, _ := For(rs256)
+		_, err := verifier.Verify("Bearer " + forged)
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected ErrInvalidToken, got %v", err)
+		}
+	})
+
+	t.Run("Missing_Key_File", func(t *testing.T) {
+		_, err := For(Settings{Algorithm: "RS256", PrivateKeyFile: filepath.Join(t.TempDir(), "missing.pem"), TTL: time.Minute})
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Expected ErrInvalidKey, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package apitest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bryantjandra/goapi/api"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+func balance(t *testing.T, server *Server, username string) int64 {
+	t.Helper()
+
+	resp, err := server.Client(username).Get(server.URL + "/account/coins")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body api.CoinBalanceResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	return body.Balance
+}
+
+// do sends a request as username and decodes a JSON response into body, if given
+func do(t *testing.T, server *Server, username string, method string, path string, body interface{}) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.URL+path, nil)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	resp, err := server.Client(username).Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if body != nil {
+		json.NewDecoder(resp.Body).Decode(body)
+	}
+	return resp.StatusCode
+}
+
+// events reads the admin event feed
+func events(t *testing.T, server *Server) []api.DomainEvent {
+	t.Helper()
+
+	resp, err := server.Client("admin").Get(server.URL + "/admin/events")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result []api.DomainEvent
+	var decoder = json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var event api.DomainEvent
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatalf("Failed to decode event: %v", err)
+		}
+		result = append(result, event)
+	}
+	return result
+}
+
+func TestServersAreIsolated(t *testing.T) {
+	for _, amount := range []string{"100", "250", "400"} {
+		t.Run("Withdraw_"+amount, func(t *testing.T) {
+			t.Parallel()
+
+			server := New(t)
+			resp, err := server.Client("aaron").Post(server.URL+"/account/coins/withdraw?amount="+amount, "", nil)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected 200, got %d", resp.StatusCode)
+			}
+
+			// Only this server's withdrawal is visible
+			want := map[string]int64{"100": 900, "250": 750, "400": 600}[amount]
+			if got := balance(t, server, "aaron"); got != want {
+				t.Errorf("Expected %d, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestServerStateIsIsolated(t *testing.T) {
+	t.Parallel()
+
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(sink.Close)
+
+	used, fresh := New(t), New(t)
+	if code := do(t, used, "aaron", http.MethodPost, "/account/contacts?counterparty=bryan&nickname=bee", nil); code != http.StatusOK {
+		t.Fatalf("Expected the contact saved, got %d", code)
+	}
+	if code := do(t, used, "aaron", http.MethodPost, "/account/webhooks?url="+sink.URL, nil); code != http.StatusOK {
+		t.Fatalf("Expected the webhook created, got %d", code)
+	}
+	if code := do(t, used, "aaron", http.MethodPost, "/account/coins/add?amount=5", nil); code != http.StatusOK {
+		t.Fatalf("Expected the deposit, got %d", code)
+	}
+	var wrong = &Server{Server: used.Server, logins: map[string]tools.LoginDetails{"bryan": {AuthToken: "wrong"}}}
+	for i := 0; i < 5; i++ {
+		do(t, wrong, "bryan", http.MethodGet, "/account/coins", nil)
+	}
+
+	var lockouts api.LockoutListResponse
+	do(t, used, "admin", http.MethodGet, "/admin/lockouts", &lockouts)
+	if len(lockouts.Lockouts) == 0 || len(events(t, used)) == 0 {
+		t.Fatalf("Expected the server to keep its lockouts and events, got %+v", lockouts)
+	}
+
+	// None of it reaches a server on another database
+	var contacts api.ContactListResponse
+	do(t, fresh, "aaron", http.MethodGet, "/account/contacts", &contacts)
+	if len(contacts.Contacts) != 0 {
+		t.Errorf("Expected no contacts, got %+v", contacts.Contacts)
+	}
+	var webhooks api.WebhookListResponse
+	do(t, fresh, "aaron", http.MethodGet, "/account/webhooks", &webhooks)
+	if len(webhooks.Webhooks) != 0 {
+		t.Errorf("Expected no webhooks, got %+v", webhooks.Webhooks)
+	}
+	if feed := events(t, fresh); len(feed) != 0 {
+		t.Errorf("Expected no events, got %+v", feed)
+	}
+	lockouts = api.LockoutListResponse{}
+	do(t, fresh, "admin", http.MethodGet, "/admin/lockouts", &lockouts)
+	if code := do(t, fresh, "bryan", http.MethodGet, "/account/coins", nil); code != http.StatusOK || len(lockouts.Lockouts) != 0 {
+		t.Errorf("Expected bryan not locked out, got %d and %+v", code, lockouts.Lockouts)
+	}
+}
+
+func TestWithAccount(t *testing.T) {
+	t.Parallel()
+
+	server := New(t, WithAccount("carol", "c", "user", 42))
+	if got := balance(t, server, "carol"); got != 42 {
+		t.Errorf("Expected seeded balance 42, got %d", got)
+	}
+
+	resp, _ := server.Client("carol").Get(server.URL + "/admin/policies")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected a plain user to be refused admin routes, got %d", resp.StatusCode)
+	}
+}
+
+func TestHistorySurvivesRequests(t *testing.T) {
+	t.Parallel()
+
+	server := New(t)
+	for _, amount := range []string{"10", "20"} {
+		resp, err := server.Client("aaron").Post(server.URL+"/account/coins/add?amount="+amount, "", nil)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+	}
+
+	// Both deposits were logged by the one database the router was built with
+	if got := len(server.Database.GetTransactionHistory("aaron")); got != 2 {
+		t.Errorf("Expected 2 logged transactions, got %d", got)
+	}
+}
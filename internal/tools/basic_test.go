@@ -34,7 +34,7 @@ func TestBasicConcurrency(t *testing.T) {
 		wg.Wait()
 
 		// Verify result
-		finalBalance := db.GetUserCoins("aaron")
+		finalBalance, _ := db.GetUserCoins("aaron")
 		expected := int64(130) // 100 + (3 × 10)
 
 		t.Logf("Expected: %d coins, Actually got: %d coins", expected, finalBalance.Coins)
@@ -79,7 +79,7 @@ func TestBasicConcurrency(t *testing.T) {
 		wg.Wait()
 
 		// Verify result
-		finalBalance := db.GetUserCoins("aaron")
+		finalBalance, _ := db.GetUserCoins("aaron")
 		expected := int64(200) // 200 + (3×20) - (2×30) = 200
 
 		t.Logf("Expected: %d coins, Actually got: %d coins", expected, finalBalance.Coins)
@@ -125,8 +125,8 @@ func TestBasicConcurrency(t *testing.T) {
 		wg.Wait()
 
 		// Verify results
-		aaronBalance := db.GetUserCoins("aaron")
-		bryanBalance := db.GetUserCoins("bryan")
+		aaronBalance, _ := db.GetUserCoins("aaron")
+		bryanBalance, _ := db.GetUserCoins("bryan")
 
 		expectedAaron := int64(250) // 300 - (2×50) + (2×25) = 250
 		expectedBryan := int64(250) // 200 + (2×50) - (2×25) = 250
@@ -199,8 +199,8 @@ func TestBasicConcurrency(t *testing.T) {
 		wg.Wait()
 
 		// Verify final state
-		aaronBalance := db.GetUserCoins("aaron")
-		bryanBalance := db.GetUserCoins("bryan")
+		aaronBalance, _ := db.GetUserCoins("aaron")
+		bryanBalance, _ := db.GetUserCoins("bryan")
 
 		// Aaron: 150 + (2×25) - 20 - 40 = 140
 		expectedAaron := int64(140)
@@ -262,8 +262,8 @@ func TestPerformance(t *testing.T) {
 		duration := time.Since(start)
 
 		// Verify final state
-		user1Balance := db.GetUserCoins("user_1")
-		user2Balance := db.GetUserCoins("user_2")
+		user1Balance, _ := db.GetUserCoins("user_1")
+		user2Balance, _ := db.GetUserCoins("user_2")
 
 		t.Logf("Completed %d operations in %v", numOperations, duration)
 		t.Logf("User1 balance: %d, User2 balance: %d", user1Balance.Coins, user2Balance.Coins)
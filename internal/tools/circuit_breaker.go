@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// circuitBreaker opens after threshold consecutive failures, counting both operations
+// that found the backend down and health probes. Probes never run on a caller's path:
+// allow starts one in the background at most once per cooldown, so an open circuit is
+// retried and a backend that only serves reads that can't fail is still watched.
+type circuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	probe     func() bool
+
+	// recover runs in the probe's goroutine when a probe succeeds while the circuit is
+	// open, and must call close once the backend can take traffic again. nil closes it
+	// straight away.
+	recover func()
+
+	mu        sync.Mutex
+	failures  int
+	open      bool
+	openedAt  time.Time
+	probing   bool
+	lastProbe time.Time
+}
+
+func newCircuitBreaker(name string, threshold int, cooldown time.Duration, probe func() bool) *circuitBreaker {
+	if threshold <= 0 {
+		threshold = 3
+	}
+	if cooldown <= 0 {
+		cooldown = 5 * time.Second
+	}
+
+	return &circuitBreaker{name: name, threshold: threshold, cooldown: cooldown, probe: probe, lastProbe: time.Now()}
+}
+
+// allow reports whether the protected backend may be used, starting a background probe
+// when the last one is a cooldown old
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.probing && time.Since(b.lastProbe) >= b.cooldown {
+		b.probing = true
+		b.lastProbe = time.Now()
+		go b.runProbe()
+	}
+	return !b.open
+}
+
+func (b *circuitBreaker) runProbe() {
+	var healthy bool = b.probe()
+
+	b.mu.Lock()
+	b.probing = false
+	var open bool = b.open
+	b.mu.Unlock()
+
+	switch {
+	case !healthy:
+		b.failure("failed health checks")
+	case open && b.recover != nil:
+		b.recover()
+	default:
+		b.close()
+	}
+}
+
+// record counts the outcome of an operation on the backend. Only errors that mean it
+// didn't answer count against it, a refused operation shows it is up.
+func (b *circuitBreaker) record(err error) {
+	if outage(err) {
+		b.failure("failed operations")
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		b.failures = 0
+	}
+}
+
+func (b *circuitBreaker) failure(what string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.open {
+		// Still down, wait another cooldown
+		b.openedAt = time.Now()
+		return
+	}
+	if b.failures >= b.threshold {
+		log.Warn("Circuit ", b.name, " opened after ", b.failures, " ", what)
+		b.open = true
+		b.openedAt = time.Now()
+	}
+}
+
+// close lets traffic through to the backend again
+func (b *circuitBreaker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.open {
+		log.Info("Circuit ", b.name, " closed, backend recovered")
+	}
+	b.open = false
+	b.failures = 0
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.open
+}
+
+// outage reports whether err means the backend didn't answer, anything but the
+// storage layer's own refusals and a caller giving up
+func outage(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, ErrUserNotFound),
+		errors.Is(err, ErrStaleVersion),
+		errors.Is(err, ErrUserExists),
+		errors.Is(err, ErrInsufficientFunds),
+		errors.Is(err, ErrInvalidAmount),
+		errors.Is(err, ErrSelfTransfer),
+		errors.Is(err, ErrBalanceOverflow),
+		errors.Is(err, ErrRefreshTokenNotFound),
+		errors.Is(err, ErrRefreshTokenRevoked),
+		errors.Is(err, ErrOwnerNotFound),
+		errors.Is(err, ErrAccountNotEmpty),
+		errors.Is(err, ErrAccountFrozen),
+		errors.Is(err, ErrRecordNotFound),
+		errors.Is(err, ErrHoldNotFound),
+		errors.Is(err, ErrEventNotFound):
+		return false
+	}
+	return true
+}
+
+func isHealthy(database DatabaseInterface) bool {
+	health := database.GetSystemHealth()
+	return health != nil && health["status"] == "healthy"
+}
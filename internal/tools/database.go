@@ -1,51 +1,185 @@
 package tools
 
 import (
+	"container/heap"
 	"context"
-	"time"
 
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/pkg/storage"
 	log "github.com/sirupsen/logrus"
 )
 
-type LoginDetails struct {
-	AuthToken string
-	Username  string
+// The domain types and DatabaseInterface live in pkg/storage, where other backends can
+// implement them. These aliases keep the names the rest of the tree uses.
+type (
+	DatabaseInterface = storage.DatabaseInterface
+	LoginDetails      = storage.LoginDetails
+	CoinDetails       = storage.CoinDetails
+	TransactionLog    = storage.TransactionLog
+	Posting           = storage.Posting
+	RefreshToken      = storage.RefreshToken
+	AccountOwner      = storage.AccountOwner
+	Capabilities      = storage.Capabilities
+	Subscriber        = storage.Subscriber
+	Record            = storage.Record
+	Hold              = storage.Hold
+	Event             = storage.Event
+	EventFilter       = storage.EventFilter
+)
+
+const (
+	RoleUser    = storage.RoleUser
+	RoleAdmin   = storage.RoleAdmin
+	RoleAuditor = storage.RoleAuditor
+
+	MintAccount    = storage.MintAccount
+	BurnAccount    = storage.BurnAccount
+	CorrectionType = storage.CorrectionType
+
+	FlowSource  = storage.FlowSource
+	FlowSink    = storage.FlowSink
+	FlowNeutral = storage.FlowNeutral
+
+	OwnerView     = storage.OwnerView
+	OwnerTransact = storage.OwnerTransact
+
+	HoldFreeze = storage.HoldFreeze
+)
+
+var (
+	ErrUserNotFound      = storage.ErrUserNotFound
+	ErrStaleVersion      = storage.ErrStaleVersion
+	ErrUserExists        = storage.ErrUserExists
+	ErrInsufficientFunds = storage.ErrInsufficientFunds
+	ErrInvalidAmount     = storage.ErrInvalidAmount
+	ErrSelfTransfer      = storage.ErrSelfTransfer
+	ErrBalanceOverflow   = storage.ErrBalanceOverflow
+
+	ErrRefreshTokenNotFound = storage.ErrRefreshTokenNotFound
+	ErrRefreshTokenRevoked  = storage.ErrRefreshTokenRevoked
+
+	ErrOwnerNotFound = storage.ErrOwnerNotFound
+
+	ErrAccountNotEmpty = storage.ErrAccountNotEmpty
+
+	ErrAccountFrozen = storage.ErrAccountFrozen
+
+	ErrRecordNotFound = storage.ErrRecordNotFound
+
+	ErrHoldNotFound = storage.ErrHoldNotFound
+
+	ErrEventNotFound = storage.ErrEventNotFound
+)
+
+// statusErrors is the error a rejected operation returns for the status it is logged with
+var statusErrors = map[string]error{
+	"FAILED_INVALID_AMOUNT":      ErrInvalidAmount,
+	"FAILED_USER_NOT_FOUND":      ErrUserNotFound,
+	"FAILED_FROM_USER_NOT_FOUND": ErrUserNotFound,
+	"FAILED_TO_USER_NOT_FOUND":   ErrUserNotFound,
+	"FAILED_INSUFFICIENT_FUNDS":  ErrInsufficientFunds,
+	"FAILED_SELF_TRANSFER":       ErrSelfTransfer,
+	"FAILED_OVERFLOW":            ErrBalanceOverflow,
+	"FAILED_ACCOUNT_FROZEN":      ErrAccountFrozen,
+	"FAILED_HOLD_NOT_FOUND":      ErrHoldNotFound,
+}
+
+// FlowOf returns the source/sink tag for a transaction type
+func FlowOf(txType string) string {
+	return storage.FlowOf(txType)
+}
+
+// ForEachAccount calls fn with every balance, a page at a time, see
+// storage.ForEachAccount
+func ForEachAccount(ctx context.Context, database DatabaseInterface, fn func(CoinDetails) error) error {
+	return storage.ForEachAccount(ctx, database, fn)
+}
+
+// Subscribe subscribes to username's ledger entries on database. The channel is closed
+// at once when database doesn't have the Streaming capability.
+func Subscribe(database DatabaseInterface, username string) (<-chan TransactionLog, func()) {
+	subscriber, ok := database.(Subscriber)
+	if !ok || !database.Capabilities().Streaming {
+		var closed = make(chan TransactionLog)
+		close(closed)
+		return closed, func() {}
+	}
+	return subscriber.Subscribe(username)
 }
 
-type CoinDetails struct {
-	Coins    int64
-	Username string
-	Version  int64 // Optimistic locking
+// PageHistory serves GetTransactionHistoryPage from a whole history, see
+// storage.PageHistory
+func PageHistory(history []TransactionLog, username string, before int64, limit int) []TransactionLog {
+	return storage.PageHistory(history, username, before, limit)
 }
 
-// Transaction audit trail
-type TransactionLog struct {
-	ID        string
-	Type      string
-	From      string
-	To        string
-	Amount    int64
-	Timestamp time.Time
-	Status    string
+type databaseContextKey struct{}
+
+// WithDatabase makes OpenDatabase return database for anything carrying the returned context
+func WithDatabase(ctx context.Context, database DatabaseInterface) context.Context {
+	return context.WithValue(ctx, databaseContextKey{}, database)
+}
+
+// OpenDatabase returns the database attached to ctx, or a new connection when there is none
+func OpenDatabase(ctx context.Context) (*DatabaseInterface, error) {
+	if database := AttachedDatabase(ctx); database != nil {
+		return &database, nil
+	}
+	return NewDatabase()
+}
+
+// AttachedDatabase returns the database attached to ctx, nil when there is none
+func AttachedDatabase(ctx context.Context) DatabaseInterface {
+	database, _ := ctx.Value(databaseContextKey{}).(DatabaseInterface)
+	return database
 }
 
-type DatabaseInterface interface {
-	GetUserLoginDetails(username string) *LoginDetails
-	GetUserCoins(username string) *CoinDetails
-	AddUserCoins(username string, amount int64) *CoinDetails
-	WithdrawUserCoins(username string, amount int64) *CoinDetails
-	TransferUserCoins(from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails)
-	SetupDatabase() error
-	TransferUserCoinsWithContext(ctx context.Context, from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error)
-	GetTransactionHistory(username string) []TransactionLog
-	GetSystemHealth() map[string]interface{}
+// The built-in backends, registered like any other
+func init() {
+	storage.Register(config.DriverMock, func(dsn string) (DatabaseInterface, error) {
+		return &mockDB{mu: &mockMu, logins: mockLoginDetails, coins: mockCoinDetails, refreshTokens: mockRefreshTokens, owners: mockAccountOwners, records: mockRecords, holds: mockHolds, events: mockEvents}, nil
+	})
+	storage.Register(config.DriverMySQL, func(dsn string) (DatabaseInterface, error) {
+		return newMySQLDatabase(dsn), nil
+	})
+	storage.Register(config.DriverRedis, func(dsn string) (DatabaseInterface, error) {
+		return newRedisDatabase(dsn), nil
+	})
 }
 
+// NewDatabase opens the backend registered under the configured DB_DRIVER, behind
+// failover to the one under FAILOVER_DB_DRIVER when that is set
 func NewDatabase() (*DatabaseInterface, error) {
 	log.Debug("Creating new database connection")
 
-	var database DatabaseInterface = &mockDB{}
-	var err error = database.SetupDatabase()
+	var cfg config.Config = config.Get()
+	database, err := storage.Open(cfg.DatabaseDriver, cfg.DatabaseDSN)
+	if err != nil {
+		log.Error("Failed to open database: ", err)
+		return nil, err
+	}
+	if cfg.DatabaseDriver == config.DriverMock && cfg.MockLatencyProfile != "" {
+		profile, err := LatencyProfileNamed(cfg.MockLatencyProfile)
+		if err != nil {
+			log.Error("Failed to setup database: ", err)
+			return nil, err
+		}
+		database = WithLatency(database, profile)
+	}
+	if cfg.FailoverDriver != "" {
+		secondary, err := storage.Open(cfg.FailoverDriver, cfg.FailoverDSN)
+		if err != nil {
+			log.Error("Failed to open failover database: ", err)
+			return nil, err
+		}
+		// Sets up both backends
+		return NewFailoverDatabase(database, secondary, FailoverOptions{
+			FailureThreshold: cfg.FailoverThreshold,
+			Cooldown:         cfg.FailoverCooldown,
+			QueueWrites:      cfg.FailoverQueueWrites,
+		})
+	}
+	err = database.SetupDatabase()
 	if err != nil {
 		log.Error("Failed to setup database: ", err)
 		return nil, err
@@ -54,3 +188,53 @@ func NewDatabase() (*DatabaseInterface, error) {
 	log.Debug("Database connection established successfully")
 	return &database, nil
 }
+
+// ranksAbove orders balances for TopUserCoins
+func ranksAbove(a CoinDetails, b CoinDetails) bool {
+	if a.Coins != b.Coins {
+		return a.Coins > b.Coins
+	}
+	return a.Username < b.Username
+}
+
+// lowestFirst is a min-heap with the lowest ranked balance at the root
+type lowestFirst []CoinDetails
+
+func (h lowestFirst) Len() int            { return len(h) }
+func (h lowestFirst) Less(i, j int) bool  { return ranksAbove(h[j], h[i]) }
+func (h lowestFirst) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *lowestFirst) Push(x interface{}) { *h = append(*h, x.(CoinDetails)) }
+func (h *lowestFirst) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// topBalances keeps the limit highest of the balances lookup finds for usernames,
+// in O(n log limit) without sorting every candidate
+func topBalances(usernames []string, limit int, lookup func(username string) (CoinDetails, bool)) []CoinDetails {
+	if limit <= 0 {
+		return []CoinDetails{}
+	}
+
+	var top = make(lowestFirst, 0, limit)
+	for _, username := range usernames {
+		details, ok := lookup(username)
+		if !ok {
+			continue
+		}
+		if len(top) < limit {
+			heap.Push(&top, details)
+		} else if ranksAbove(details, top[0]) {
+			top[0] = details
+			heap.Fix(&top, 0)
+		}
+	}
+
+	var ranked = make([]CoinDetails, len(top))
+	for i := len(ranked) - 1; i >= 0; i-- {
+		ranked[i] = heap.Pop(&top).(CoinDetails)
+	}
+	return ranked
+}
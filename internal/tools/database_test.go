@@ -0,0 +1,415 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+	"github.com/bryantjandra/goapi/pkg/storage"
+)
+
+func TestNewDatabaseUsesRegisteredBackend(t *testing.T) {
+	var original config.Config = config.Get()
+	defer config.Set(original)
+
+	// What a third-party backend looks like from here: registered by name, no DSN needed
+	storage.Register("isolated-memory", func(dsn string) (storage.DatabaseInterface, error) {
+		database, err := NewMemoryDatabase(nil, map[string]CoinDetails{
+			"carol": {Username: "carol", Coins: 42, Version: 1},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return *database, nil
+	})
+
+	var cfg config.Config = original
+	cfg.DatabaseDriver = "isolated-memory"
+	if err := config.Validate(cfg); err != nil {
+		t.Fatalf("Expected a registered backend to pass validation, got %v", err)
+	}
+	config.Set(cfg)
+
+	database, err := NewDatabase()
+	if err != nil {
+		t.Fatalf("Failed to open registered backend: %v", err)
+	}
+	if coins, err := (*database).GetUserCoins("carol"); err != nil || coins.Coins != 42 {
+		t.Errorf("Expected carol's 42 coins from the registered backend, got %+v, %v", coins, err)
+	}
+
+	cfg.DatabaseDriver = "nosuch"
+	if err := config.Validate(cfg); !errors.Is(err, config.ErrInvalidConfig) {
+		t.Errorf("Expected an unregistered driver to be rejected, got %v", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	logins, coins := DemoAccounts()
+	database, err := NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	t.Run("Both_Parties_Get_The_Entry", func(t *testing.T) {
+		aaron, stopAaron := Subscribe(*database, "aaron")
+		defer stopAaron()
+		bryan, stopBryan := Subscribe(*database, "bryan")
+		defer stopBryan()
+
+		(*database).TransferUserCoins("aaron", "bryan", 10)
+		(*database).AddUserCoins("bryan", 5)
+
+		if tx := <-aaron; tx.Type != "TRANSFER" || tx.SequenceFor("aaron") != tx.FromSequence {
+			t.Errorf("Expected aaron's side of the transfer, got %+v", tx)
+		}
+		if tx := <-bryan; tx.Type != "TRANSFER" {
+			t.Errorf("Expected bryan's side of the transfer, got %+v", tx)
+		}
+		if tx := <-bryan; tx.Type != "DEPOSIT" {
+			t.Errorf("Expected bryan's deposit, got %+v", tx)
+		}
+		select {
+		case tx := <-aaron:
+			t.Errorf("Expected nothing more for aaron, got %+v", tx)
+		default:
+		}
+	})
+
+	t.Run("Slow_Subscriber_Is_Dropped", func(t *testing.T) {
+		updates, stop := Subscribe(*database, "aaron")
+		defer stop()
+
+		for i := 0; i <= subscriberBuffer; i++ {
+			(*database).AddUserCoins("aaron", 1)
+		}
+
+		var received int
+		for range updates {
+			received++
+		}
+		if received != subscriberBuffer {
+			t.Errorf("Expected the channel closed after %d entries, got %d", subscriberBuffer, received)
+		}
+	})
+
+	t.Run("Failover_Does_Not_Stream", func(t *testing.T) {
+		failover, err := NewFailoverDatabase(*database, *database, FailoverOptions{})
+		if err != nil {
+			t.Fatalf("Failed to create failover database: %v", err)
+		}
+		updates, _ := Subscribe(*failover, "aaron")
+		if _, ok := <-updates; ok {
+			t.Error("Expected a closed channel from a backend that can't stream")
+		}
+	})
+}
+
+func TestTransactionHistoryIndex(t *testing.T) {
+	logins, coins := DemoAccounts()
+	database, err := NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	// Enough to trim the oldest entries out of the log
+	for i := 0; i < 1200; i++ {
+		if i%3 == 0 {
+			(*database).TransferUserCoins("bryan", "aaron", 1)
+		} else {
+			(*database).AddUserCoins("aaron", 1)
+		}
+	}
+
+	scan := func(username string) []TransactionLog {
+		var history []TransactionLog
+		for _, tx := range (*database).GetAllTransactions() {
+			if tx.From == username || tx.To == username {
+				history = append(history, tx)
+			}
+		}
+		return history
+	}
+
+	t.Run("Matches_A_Scan_After_Trimming", func(t *testing.T) {
+		for _, username := range []string{"aaron", "bryan"} {
+			var indexed, scanned = (*database).GetTransactionHistory(username), scan(username)
+			if len(indexed) != len(scanned) || indexed[0].ID != scanned[0].ID || indexed[len(indexed)-1].ID != scanned[len(scanned)-1].ID {
+				t.Errorf("Expected %s's %d entries, got %d", username, len(scanned), len(indexed))
+			}
+		}
+	})
+
+	t.Run("Pages_Seek_By_Sequence", func(t *testing.T) {
+		var page = (*database).GetTransactionHistoryPage("aaron", 0, 5)
+		if len(page) != 5 || page[0].SequenceFor("aaron") != 1200 || page[4].SequenceFor("aaron") != 1196 {
+			t.Fatalf("Expected aaron's newest 5, got %+v", page)
+		}
+		page = (*database).GetTransactionHistoryPage("aaron", 1196, 2)
+		if len(page) != 2 || page[0].SequenceFor("aaron") != 1195 {
+			t.Errorf("Expected the entries before 1196, got %+v", page)
+		}
+		if page = (*database).GetTransactionHistoryPage("aaron", 100, 5); len(page) != 0 {
+			t.Errorf("Expected nothing before a trimmed entry, got %d", len(page))
+		}
+	})
+
+	t.Run("Entries_Are_Found_By_ID", func(t *testing.T) {
+		var all = (*database).GetAllTransactions()
+		if tx, ok := (*database).GetTransaction(all[len(all)-1].ID); !ok || tx != all[len(all)-1] {
+			t.Errorf("Expected the newest entry by its ID, got %+v", tx)
+		}
+		if tx, ok := (*database).GetTransaction(all[0].ID); !ok || tx.ID != all[0].ID {
+			t.Errorf("Expected the oldest kept entry by its ID, got %+v", tx)
+		}
+		if _, ok := (*database).GetTransaction("nosuch"); ok {
+			t.Error("Expected no entry for an unknown ID")
+		}
+	})
+
+	t.Run("Anonymizing_Moves_The_Index", func(t *testing.T) {
+		var before = len((*database).GetTransactionHistory("bryan"))
+		if err := (*database).AnonymizeUser("bryan", "anon-1"); err != nil {
+			t.Fatalf("Failed to anonymize: %v", err)
+		}
+		if history := (*database).GetTransactionHistory("bryan"); len(history) != 0 {
+			t.Errorf("Expected no entries left under the old name, got %d", len(history))
+		}
+		if history := (*database).GetTransactionHistory("anon-1"); len(history) != before || history[0].From != "anon-1" {
+			t.Errorf("Expected %d entries under the pseudonym, got %d", before, len(history))
+		}
+	})
+}
+
+func TestDeleteUser(t *testing.T) {
+	logins, coins := DemoAccounts()
+	database, err := NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	var db DatabaseInterface = *database
+
+	if err := db.DeleteUser("aaron"); !errors.Is(err, ErrAccountNotEmpty) {
+		t.Errorf("Expected an account holding coins kept, got %v", err)
+	}
+
+	if _, err := db.CreateUser(LoginDetails{Username: "carol", AuthToken: "c", Role: RoleUser}); err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	if err := db.DeleteUser("carol"); err != nil {
+		t.Fatalf("Failed to delete account: %v", err)
+	}
+	if _, err := db.GetUserCoins("carol"); !errors.Is(err, ErrUserNotFound) || db.GetUserLoginDetails("carol") != nil {
+		t.Errorf("Expected carol gone, got %v", err)
+	}
+	if _, err := db.CreateUser(LoginDetails{Username: "carol", Role: RoleUser}); err != nil {
+		t.Errorf("Expected the name free again, got %v", err)
+	}
+	if err := db.DeleteUser("nobody"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+// Both backends that run in tests keep the frozen flag and records the same way
+func TestFrozenAccountsAndRecords(t *testing.T) {
+	logins, coins := DemoAccounts()
+	memory, err := NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	for name, database := range map[string]DatabaseInterface{"memory": *memory, "redis": newTestRedis(t)} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := database.SetUserFrozen("nobody", true); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("Expected ErrUserNotFound, got %v", err)
+			}
+			details, err := database.SetUserFrozen("aaron", true)
+			if err != nil || !details.Frozen {
+				t.Fatalf("Expected aaron frozen, got %+v, %v", details, err)
+			}
+
+			if _, err := database.WithdrawUserCoins("aaron", 1); !errors.Is(err, ErrAccountFrozen) {
+				t.Errorf("Expected ErrAccountFrozen for a withdrawal, got %v", err)
+			}
+			if _, _, err := database.TransferUserCoinsWithContext(context.Background(), "aaron", "bryan", 1); !errors.Is(err, ErrAccountFrozen) {
+				t.Errorf("Expected ErrAccountFrozen for a transfer, got %v", err)
+			}
+			if _, _, err := database.TransferUserCoinsWithContext(context.Background(), "bryan", "aaron", 1); err != nil {
+				t.Errorf("Expected a frozen account to still be paid, got %v", err)
+			}
+			if details, _ := database.GetUserCoins("aaron"); !details.Frozen {
+				t.Errorf("Expected the balance to read as frozen, got %+v", details)
+			}
+
+			if _, err := database.SetUserFrozen("aaron", false); err != nil {
+				t.Fatalf("Failed to unfreeze aaron: %v", err)
+			}
+			if _, err := database.WithdrawUserCoins("aaron", 1); err != nil {
+				t.Errorf("Expected an unfrozen account to withdraw, got %v", err)
+			}
+
+			var at = time.Now().UTC().Truncate(time.Millisecond)
+			for _, record := range []Record{
+				{Kind: "note", ID: "b", Account: "aaron", Data: []byte(`{"n":2}`), UpdatedAt: at},
+				{Kind: "note", ID: "a", Account: "aaron", Data: []byte(`{"n":1}`), UpdatedAt: at},
+				{Kind: "note", ID: "c", Account: "bryan", Data: []byte(`{"n":3}`), UpdatedAt: at},
+				{Kind: "other", ID: "a", Account: "aaron", Data: []byte(`{}`), UpdatedAt: at},
+			} {
+				if err := database.PutRecord(record); err != nil {
+					t.Fatalf("Failed to put record: %v", err)
+				}
+			}
+
+			records, err := database.ListRecords("note", "aaron")
+			if err != nil || len(records) != 2 || records[0].ID != "a" || string(records[1].Data) != `{"n":2}` {
+				t.Errorf("Expected aaron's two notes in ID order, got %+v, %v", records, err)
+			}
+			if records, _ := database.ListRecords("note", ""); len(records) != 3 {
+				t.Errorf("Expected every note, got %+v", records)
+			}
+
+			record, err := database.GetRecord("note", "c")
+			if err != nil || record.Account != "bryan" || !record.UpdatedAt.Equal(at) {
+				t.Errorf("Expected bryan's note, got %+v, %v", record, err)
+			}
+			if err := database.DeleteRecord("note", "c"); err != nil {
+				t.Errorf("Failed to delete record: %v", err)
+			}
+			if _, err := database.GetRecord("note", "c"); !errors.Is(err, ErrRecordNotFound) {
+				t.Errorf("Expected ErrRecordNotFound, got %v", err)
+			}
+			if err := database.DeleteRecord("note", "c"); !errors.Is(err, ErrRecordNotFound) {
+				t.Errorf("Expected ErrRecordNotFound deleting twice, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHolds(t *testing.T) {
+	logins, coins := DemoAccounts()
+	memory, err := NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	for name, database := range map[string]DatabaseInterface{"memory": *memory, "redis": newTestRedis(t)} {
+		t.Run(name, func(t *testing.T) {
+			details, err := database.PlaceHold(Hold{ID: "gift-1", Account: "aaron", Kind: "gift", Amount: 600})
+			if err != nil || details.Held != 600 || details.Available() != 400 {
+				t.Fatalf("Expected 600 held, got %+v, %v", details, err)
+			}
+
+			// Holds and debits both spend what is available, checked as they change it
+			if _, err := database.PlaceHold(Hold{ID: "gift-2", Account: "aaron", Kind: "gift", Amount: 401}); !errors.Is(err, ErrInsufficientFunds) {
+				t.Errorf("Expected ErrInsufficientFunds for a second hold, got %v", err)
+			}
+			if _, err := database.WithdrawUserCoins("aaron", 401); !errors.Is(err, ErrInsufficientFunds) {
+				t.Errorf("Expected ErrInsufficientFunds for a withdrawal of held coins, got %v", err)
+			}
+			if _, _, err := database.TransferUserCoinsWithContext(context.Background(), "aaron", "bryan", 401); !errors.Is(err, ErrInsufficientFunds) {
+				t.Errorf("Expected ErrInsufficientFunds for a transfer of held coins, got %v", err)
+			}
+			if details, err := database.WithdrawUserCoins("aaron", 400); err != nil || details.Held != 600 {
+				t.Errorf("Expected the rest to be withdrawn, got %+v, %v", details, err)
+			}
+
+			// A freeze holds coins back whatever the balance, changing a hold replaces it
+			if details, err := database.PlaceHold(Hold{ID: "freeze-1", Account: "aaron", Kind: HoldFreeze, Amount: 50}); err != nil || details.Held != 650 {
+				t.Errorf("Expected a freeze past the balance, got %+v, %v", details, err)
+			}
+			if details, err := database.PlaceHold(Hold{ID: "gift-1", Account: "aaron", Kind: "gift", Amount: 500}); err != nil || details.Held != 550 {
+				t.Errorf("Expected the hold lowered, got %+v, %v", details, err)
+			}
+			if _, err := database.PlaceHold(Hold{ID: "gift-1", Account: "bryan", Kind: "gift", Amount: 5}); !errors.Is(err, ErrHoldNotFound) {
+				t.Errorf("Expected ErrHoldNotFound for another account's hold, got %v", err)
+			}
+			if _, err := database.PlaceHold(Hold{ID: "gift-3", Account: "nobody", Kind: "gift", Amount: 5}); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("Expected ErrUserNotFound, got %v", err)
+			}
+
+			holds, err := database.GetHolds("aaron")
+			if err != nil || len(holds) != 2 || holds[0].ID != "gift-1" || holds[0].Amount != 500 || holds[1].Kind != HoldFreeze {
+				t.Errorf("Expected aaron's two holds oldest first, got %+v, %v", holds, err)
+			}
+			if holds, _ := database.GetHolds("bryan"); len(holds) != 0 {
+				t.Errorf("Expected no holds on bryan, got %+v", holds)
+			}
+
+			if details, err := database.ReleaseHold("gift-1"); err != nil || details.Held != 50 {
+				t.Errorf("Expected only the freeze left held, got %+v, %v", details, err)
+			}
+			if _, err := database.ReleaseHold("gift-1"); !errors.Is(err, ErrHoldNotFound) {
+				t.Errorf("Expected ErrHoldNotFound releasing twice, got %v", err)
+			}
+			if details, _ := database.GetUserCoins("aaron"); details.Held != 50 || details.Available() != 550 {
+				t.Errorf("Expected 50 held of 600, got %+v", details)
+			}
+
+			// The holds move with an anonymized account
+			if err := database.AnonymizeUser("aaron", "deleted-1"); err != nil {
+				t.Fatalf("Failed to anonymize aaron: %v", err)
+			}
+			if holds, _ := database.GetHolds("deleted-1"); len(holds) != 1 || holds[0].Account != "deleted-1" {
+				t.Errorf("Expected the freeze on the pseudonym, got %+v", holds)
+			}
+			if details, _ := database.GetUserCoins("deleted-1"); details.Held != 50 {
+				t.Errorf("Expected 50 held on the pseudonym, got %+v", details)
+			}
+		})
+	}
+}
+
+func TestCaptureHold(t *testing.T) {
+	logins, coins := DemoAccounts()
+	memory, err := NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	for name, database := range map[string]DatabaseInterface{"memory": *memory, "redis": newTestRedis(t)} {
+		t.Run(name, func(t *testing.T) {
+			var ctx = context.Background()
+			if _, err := database.PlaceHold(Hold{ID: "payment-1", Account: "aaron", Kind: "payment", Amount: 600}); err != nil {
+				t.Fatalf("Failed to place hold: %v", err)
+			}
+			if _, err := database.WithdrawUserCoins("aaron", 400); err != nil {
+				t.Fatalf("Failed to withdraw the unheld coins: %v", err)
+			}
+
+			// The held coins are what the capture spends, never more than the hold
+			if _, _, err := database.CaptureHold(ctx, "payment-1", "bryan", 601); !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("Expected ErrInvalidAmount capturing more than held, got %v", err)
+			}
+			if _, _, err := database.CaptureHold(ctx, "payment-1", "nobody", 100); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("Expected ErrUserNotFound for an unknown payee, got %v", err)
+			}
+			fromDetails, toDetails, err := database.CaptureHold(ctx, "payment-1", "bryan", 250)
+			if err != nil || fromDetails.Coins != 350 || fromDetails.Held != 0 || toDetails.Coins != 1250 || fromDetails.TransactionID == "" {
+				t.Fatalf("Expected 250 captured and the rest released, got %+v, %+v, %v", fromDetails, toDetails, err)
+			}
+			if _, _, err := database.CaptureHold(ctx, "payment-1", "bryan", 250); !errors.Is(err, ErrHoldNotFound) {
+				t.Errorf("Expected ErrHoldNotFound capturing twice, got %v", err)
+			}
+			if holds, _ := database.GetHolds("aaron"); len(holds) != 0 {
+				t.Errorf("Expected no holds left, got %+v", holds)
+			}
+
+			// Without a payee the coins are withdrawn
+			if _, err := database.PlaceHold(Hold{ID: "reservation-1", Account: "aaron", Kind: "reservation", Amount: 100}); err != nil {
+				t.Fatalf("Failed to place hold: %v", err)
+			}
+			fromDetails, toDetails, err = database.CaptureHold(ctx, "reservation-1", "", 100)
+			if err != nil || fromDetails.Coins != 250 || toDetails != nil {
+				t.Fatalf("Expected 100 withdrawn, got %+v, %+v, %v", fromDetails, toDetails, err)
+			}
+
+			history := database.GetTransactionHistory("aaron")
+			var last = history[len(history)-1]
+			if last.Type != "WITHDRAWAL" || last.Amount != 100 || last.Status != "SUCCESS" || last.ID != fromDetails.TransactionID {
+				t.Errorf("Expected the capture logged as a withdrawal, got %+v", last)
+			}
+		})
+	}
+}
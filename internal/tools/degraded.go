@@ -0,0 +1,654 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrStorageUnavailable = errors.New("storage unavailable, only cached balances can be read")
+
+type DegradedOptions struct {
+	// Consecutive failed operations or health probes before reads switch to the cache
+	FailureThreshold int
+
+	// How often storage is probed in the background, and so how long the circuit stays
+	// open at least
+	Cooldown time.Duration
+
+	// Shares cache invalidations with the other replicas in front of the same storage.
+	// Without one a replica can serve balances that another one has since changed.
+	Invalidator Invalidator
+}
+
+// Invalidator is implemented by cachebus.Bus
+type Invalidator interface {
+	// Invalidate tells the other replicas these accounts changed
+	Invalidate(usernames ...string)
+
+	// OnInvalidate registers handler for accounts changed elsewhere, nil means all
+	OnInvalidate(handler func(usernames []string))
+
+	Health() map[string]interface{}
+}
+
+// degradedDB remembers the last balance and login details it saw for every user, and
+// the last records listed for each account. While storage's circuit is open it serves
+// those from memory, with CachedAt set to when a balance was last seen, and rejects
+// every mutation.
+type degradedDB struct {
+	inner   DatabaseInterface
+	breaker *circuitBreaker
+
+	mu       sync.RWMutex
+	balances map[string]CoinDetails
+	logins   map[string]LoginDetails
+	records  map[recordList][]Record
+
+	invalidator Invalidator
+}
+
+// recordList is what ListRecords was asked for
+type recordList struct {
+	kind    string
+	account string
+}
+
+func NewDegradedDatabase(inner DatabaseInterface, options DegradedOptions) (*DatabaseInterface, error) {
+	var degraded = &degradedDB{
+		inner:       inner,
+		balances:    make(map[string]CoinDetails),
+		logins:      make(map[string]LoginDetails),
+		records:     make(map[recordList][]Record),
+		invalidator: options.Invalidator,
+	}
+	degraded.breaker = newCircuitBreaker("storage", options.FailureThreshold, options.Cooldown, func() bool {
+		return isHealthy(inner)
+	})
+	if degraded.invalidator != nil {
+		degraded.invalidator.OnInvalidate(degraded.forget)
+	}
+
+	var database DatabaseInterface = degraded
+	var err error = database.SetupDatabase()
+	if err != nil {
+		log.Error("Failed to setup degraded-mode database: ", err)
+		return nil, err
+	}
+
+	return &database, nil
+}
+
+func (d *degradedDB) SetupDatabase() error {
+	return d.inner.SetupDatabase()
+}
+
+// available reports whether storage's circuit is closed, without waiting on storage
+func (d *degradedDB) available() bool {
+	return d.breaker.allow()
+}
+
+// forget drops cached entries another replica changed, every entry for nil
+func (d *degradedDB) forget(usernames []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if usernames == nil {
+		d.balances = make(map[string]CoinDetails)
+		d.logins = make(map[string]LoginDetails)
+		d.records = make(map[recordList][]Record)
+		return
+	}
+	for _, username := range usernames {
+		delete(d.balances, username)
+		delete(d.logins, username)
+		d.forgetRecords(username)
+	}
+}
+
+// forgetRecords drops the lists that may include account's records, callers hold mu
+func (d *degradedDB) forgetRecords(account string) {
+	for list := range d.records {
+		if list.account == account || list.account == "" {
+			delete(d.records, list)
+		}
+	}
+}
+
+// changed tells the other replicas about a successful mutation
+func (d *degradedDB) changed(usernames ...string) {
+	if d.invalidator != nil {
+		d.invalidator.Invalidate(usernames...)
+	}
+}
+
+func (d *degradedDB) remember(details *CoinDetails) {
+	if details == nil {
+		return
+	}
+
+	var cached CoinDetails = *details
+	cached.CachedAt = time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.balances[details.Username] = cached
+}
+
+func (d *degradedDB) GetUserLoginDetails(username string) *LoginDetails {
+	if !d.available() {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+
+		details, ok := d.logins[username]
+		if !ok {
+			return nil
+		}
+		return &details
+	}
+
+	details := d.inner.GetUserLoginDetails(username)
+	if details != nil {
+		d.mu.Lock()
+		d.logins[username] = *details
+		d.mu.Unlock()
+	}
+	return details
+}
+
+// GetUserCoins serves the cached balance while storage is down, ErrStorageUnavailable
+// if there is none
+func (d *degradedDB) GetUserCoins(username string) (*CoinDetails, error) {
+	if !d.available() {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+
+		details, ok := d.balances[username]
+		if !ok {
+			return nil, ErrStorageUnavailable
+		}
+		return &details, nil
+	}
+
+	details, err := d.inner.GetUserCoins(username)
+	d.breaker.record(err)
+	d.remember(details)
+	return details, err
+}
+
+func (d *degradedDB) AddUserCoins(username string, amount int64) (*CoinDetails, error) {
+	if !d.available() {
+		log.Error("Rejecting deposit for ", username, ": ", ErrStorageUnavailable)
+		return nil, ErrStorageUnavailable
+	}
+
+	details, err := d.inner.AddUserCoins(username, amount)
+	d.breaker.record(err)
+	if err == nil {
+		d.remember(details)
+		d.changed(username)
+	}
+	return details, err
+}
+
+func (d *degradedDB) WithdrawUserCoins(username string, amount int64) (*CoinDetails, error) {
+	if !d.available() {
+		log.Error("Rejecting withdrawal for ", username, ": ", ErrStorageUnavailable)
+		return nil, ErrStorageUnavailable
+	}
+
+	details, err := d.inner.WithdrawUserCoins(username, amount)
+	d.breaker.record(err)
+	if err == nil {
+		d.remember(details)
+		d.changed(username)
+	}
+	return details, err
+}
+
+func (d *degradedDB) SetUserFrozen(username string, frozen bool) (*CoinDetails, error) {
+	if !d.available() {
+		log.Error("Rejecting freeze change for ", username, ": ", ErrStorageUnavailable)
+		return nil, ErrStorageUnavailable
+	}
+
+	details, err := d.inner.SetUserFrozen(username, frozen)
+	d.breaker.record(err)
+	if err == nil {
+		d.remember(details)
+		d.changed(username)
+	}
+	return details, err
+}
+
+func (d *degradedDB) PlaceHold(hold Hold) (*CoinDetails, error) {
+	if !d.available() {
+		log.Error("Rejecting hold on ", hold.Account, ": ", ErrStorageUnavailable)
+		return nil, ErrStorageUnavailable
+	}
+
+	details, err := d.inner.PlaceHold(hold)
+	d.breaker.record(err)
+	if err == nil {
+		d.remember(details)
+		d.changed(hold.Account)
+	}
+	return details, err
+}
+
+func (d *degradedDB) ReleaseHold(id string) (*CoinDetails, error) {
+	if !d.available() {
+		return nil, ErrStorageUnavailable
+	}
+
+	details, err := d.inner.ReleaseHold(id)
+	d.breaker.record(err)
+	if err == nil {
+		d.remember(details)
+		d.changed(details.Username)
+	}
+	return details, err
+}
+
+func (d *degradedDB) CaptureHold(ctx context.Context, id string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error) {
+	if !d.available() {
+		return nil, nil, ErrStorageUnavailable
+	}
+
+	fromDetails, toDetails, err = d.inner.CaptureHold(ctx, id, to, amount)
+	d.breaker.record(err)
+	d.remember(fromDetails)
+	d.remember(toDetails)
+	if err == nil && fromDetails != nil {
+		d.changed(fromDetails.Username)
+		if toDetails != nil {
+			d.changed(toDetails.Username)
+		}
+	}
+	return fromDetails, toDetails, err
+}
+
+func (d *degradedDB) GetHolds(account string) ([]Hold, error) {
+	if !d.available() {
+		return nil, ErrStorageUnavailable
+	}
+
+	holds, err := d.inner.GetHolds(account)
+	d.breaker.record(err)
+	return holds, err
+}
+
+func (d *degradedDB) TransferUserCoins(from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails) {
+	fromResult, toResult, err := d.TransferUserCoinsWithContext(context.Background(), from, to, amount)
+	if err != nil {
+		return nil, nil
+	}
+	return fromResult, toResult
+}
+
+func (d *degradedDB) TransferUserCoinsWithContext(ctx context.Context, from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error) {
+	if !d.available() {
+		return nil, nil, ErrStorageUnavailable
+	}
+
+	fromDetails, toDetails, err = d.inner.TransferUserCoinsWithContext(ctx, from, to, amount)
+	d.breaker.record(err)
+	d.remember(fromDetails)
+	d.remember(toDetails)
+	if err == nil && fromDetails != nil {
+		d.changed(from, to)
+	}
+	return fromDetails, toDetails, err
+}
+
+func (d *degradedDB) GetTransactionHistory(username string) []TransactionLog {
+	if !d.available() {
+		return nil
+	}
+	return d.inner.GetTransactionHistory(username)
+}
+
+func (d *degradedDB) GetTransactionHistoryPage(username string, before int64, limit int) []TransactionLog {
+	if !d.available() {
+		return nil
+	}
+	return d.inner.GetTransactionHistoryPage(username, before, limit)
+}
+
+func (d *degradedDB) GetTransaction(id string) (TransactionLog, bool) {
+	if !d.available() {
+		return TransactionLog{}, false
+	}
+	return d.inner.GetTransaction(id)
+}
+
+func (d *degradedDB) GetAllTransactions() []TransactionLog {
+	if !d.available() {
+		return nil
+	}
+	return d.inner.GetAllTransactions()
+}
+
+func (d *degradedDB) CreateUser(login LoginDetails) (*CoinDetails, error) {
+	if !d.available() {
+		return nil, ErrStorageUnavailable
+	}
+
+	details, err := d.inner.CreateUser(login)
+	d.breaker.record(err)
+	if err == nil {
+		d.remember(details)
+		d.changed(login.Username)
+	}
+	return details, err
+}
+
+func (d *degradedDB) DeleteUser(username string) error {
+	if !d.available() {
+		return ErrStorageUnavailable
+	}
+
+	err := d.inner.DeleteUser(username)
+	d.breaker.record(err)
+	if err == nil {
+		d.forget([]string{username})
+		d.changed(username)
+	}
+	return err
+}
+
+func (d *degradedDB) AnonymizeUser(username string, pseudonym string) error {
+	if !d.available() {
+		return ErrStorageUnavailable
+	}
+
+	err := d.inner.AnonymizeUser(username, pseudonym)
+	d.breaker.record(err)
+	if err == nil {
+		d.forget([]string{username})
+		d.changed(username, pseudonym)
+	}
+	return err
+}
+
+func (d *degradedDB) CorrectUserCoins(username string, version int64, balance int64) (*CoinDetails, error) {
+	if !d.available() {
+		return nil, ErrStorageUnavailable
+	}
+
+	details, err := d.inner.CorrectUserCoins(username, version, balance)
+	d.breaker.record(err)
+	if err == nil {
+		d.remember(details)
+		d.changed(username)
+	}
+	return details, err
+}
+
+// GetAllUserCoins serves the cached balances while storage is down
+func (d *degradedDB) GetAllUserCoins() []CoinDetails {
+	if !d.available() {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+
+		var balances = make([]CoinDetails, 0, len(d.balances))
+		for _, details := range d.balances {
+			balances = append(balances, details)
+		}
+		sort.Slice(balances, func(i, j int) bool {
+			return balances[i].Username < balances[j].Username
+		})
+		return balances
+	}
+
+	balances := d.inner.GetAllUserCoins()
+	for i := range balances {
+		d.remember(&balances[i])
+	}
+	return balances
+}
+
+// ListUserCoins is refused while storage is down, a job walking every account should
+// wait for it rather than act on the cached balances
+func (d *degradedDB) ListUserCoins(ctx context.Context, after string, limit int) ([]CoinDetails, error) {
+	if !d.available() {
+		return nil, ErrStorageUnavailable
+	}
+
+	page, err := d.inner.ListUserCoins(ctx, after, limit)
+	d.breaker.record(err)
+	for i := range page {
+		d.remember(&page[i])
+	}
+	return page, err
+}
+
+// TopUserCoins ranks the cached balances while storage is down
+func (d *degradedDB) TopUserCoins(usernames []string, limit int) []CoinDetails {
+	if !d.available() {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+
+		return topBalances(usernames, limit, func(username string) (CoinDetails, bool) {
+			details, ok := d.balances[username]
+			return details, ok
+		})
+	}
+
+	balances := d.inner.TopUserCoins(usernames, limit)
+	for i := range balances {
+		d.remember(&balances[i])
+	}
+	return balances
+}
+
+func (d *degradedDB) StoreRefreshToken(token RefreshToken) error {
+	if !d.available() {
+		return ErrStorageUnavailable
+	}
+
+	err := d.inner.StoreRefreshToken(token)
+	d.breaker.record(err)
+	return err
+}
+
+func (d *degradedDB) RevokeRefreshToken(hash string) (*RefreshToken, error) {
+	if !d.available() {
+		return nil, ErrStorageUnavailable
+	}
+
+	token, err := d.inner.RevokeRefreshToken(hash)
+	d.breaker.record(err)
+	return token, err
+}
+
+func (d *degradedDB) RevokeRefreshTokens(username string, family string) (int, error) {
+	if !d.available() {
+		return 0, ErrStorageUnavailable
+	}
+
+	count, err := d.inner.RevokeRefreshTokens(username, family)
+	d.breaker.record(err)
+	return count, err
+}
+
+func (d *degradedDB) SetAccountOwner(owner AccountOwner) error {
+	if !d.available() {
+		return ErrStorageUnavailable
+	}
+
+	err := d.inner.SetAccountOwner(owner)
+	d.breaker.record(err)
+	return err
+}
+
+func (d *degradedDB) GetAccountOwners(account string) ([]AccountOwner, error) {
+	if !d.available() {
+		return nil, ErrStorageUnavailable
+	}
+
+	owners, err := d.inner.GetAccountOwners(account)
+	d.breaker.record(err)
+	return owners, err
+}
+
+func (d *degradedDB) RemoveAccountOwner(account string, owner string) error {
+	if !d.available() {
+		return ErrStorageUnavailable
+	}
+
+	err := d.inner.RemoveAccountOwner(account, owner)
+	d.breaker.record(err)
+	return err
+}
+
+func (d *degradedDB) PutRecord(record Record) error {
+	if !d.available() {
+		return ErrStorageUnavailable
+	}
+
+	err := d.inner.PutRecord(record)
+	d.breaker.record(err)
+	if err == nil {
+		d.mu.Lock()
+		d.forgetRecords(record.Account)
+		d.mu.Unlock()
+		d.changed(record.Account)
+	}
+	return err
+}
+
+func (d *degradedDB) GetRecord(kind string, id string) (*Record, error) {
+	if !d.available() {
+		return nil, ErrStorageUnavailable
+	}
+
+	record, err := d.inner.GetRecord(kind, id)
+	d.breaker.record(err)
+	return record, err
+}
+
+// ListRecords serves the last list read while storage is down, so cached balances can
+// still be broken down into what is frozen
+func (d *degradedDB) ListRecords(kind string, account string) ([]Record, error) {
+	var list = recordList{kind: kind, account: account}
+	if !d.available() {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+
+		records, ok := d.records[list]
+		if !ok {
+			return nil, ErrStorageUnavailable
+		}
+		return append([]Record(nil), records...), nil
+	}
+
+	records, err := d.inner.ListRecords(kind, account)
+	d.breaker.record(err)
+	if err == nil {
+		d.mu.Lock()
+		d.records[list] = append([]Record(nil), records...)
+		d.mu.Unlock()
+	}
+	return records, err
+}
+
+// DeleteRecord drops every cached list of kind, it doesn't know the record's account.
+// Records are only deleted as their account is anonymized, which tells the other
+// replicas.
+func (d *degradedDB) DeleteRecord(kind string, id string) error {
+	if !d.available() {
+		return ErrStorageUnavailable
+	}
+
+	err := d.inner.DeleteRecord(kind, id)
+	d.breaker.record(err)
+	if err == nil {
+		d.mu.Lock()
+		for list := range d.records {
+			if list.kind == kind {
+				delete(d.records, list)
+			}
+		}
+		d.mu.Unlock()
+	}
+	return err
+}
+
+// AppendEvent is refused while storage is down like every other write, the events
+// package logs the event it couldn't keep
+func (d *degradedDB) AppendEvent(event Event) (int64, error) {
+	if !d.available() {
+		return 0, ErrStorageUnavailable
+	}
+
+	id, err := d.inner.AppendEvent(event)
+	d.breaker.record(err)
+	return id, err
+}
+
+func (d *degradedDB) ListEvents(filter EventFilter) ([]Event, error) {
+	if !d.available() {
+		return nil, ErrStorageUnavailable
+	}
+
+	events, err := d.inner.ListEvents(filter)
+	d.breaker.record(err)
+	return events, err
+}
+
+func (d *degradedDB) RewriteEvent(event Event) error {
+	if !d.available() {
+		return ErrStorageUnavailable
+	}
+
+	err := d.inner.RewriteEvent(event)
+	d.breaker.record(err)
+	return err
+}
+
+func (d *degradedDB) GetPostings() []Posting {
+	if !d.available() {
+		return nil
+	}
+	return d.inner.GetPostings()
+}
+
+func (d *degradedDB) GetSystemHealth() map[string]interface{} {
+	health := d.inner.GetSystemHealth()
+	if health == nil {
+		health = map[string]interface{}{"status": "unhealthy"}
+	}
+
+	if d.breaker.isOpen() {
+		health["status"] = "degraded"
+	}
+
+	d.mu.RLock()
+	health["cached_balances"] = len(d.balances)
+	d.mu.RUnlock()
+
+	if d.invalidator != nil {
+		health["cache_invalidation"] = d.invalidator.Health()
+	}
+
+	return health
+}
+
+// Subscribe is inner's, nothing is logged while storage is down
+func (d *degradedDB) Subscribe(username string) (<-chan TransactionLog, func()) {
+	return Subscribe(d.inner, username)
+}
+
+// Capabilities are inner's, plus the cached reads served while storage is down
+func (d *degradedDB) Capabilities() Capabilities {
+	capabilities := d.inner.Capabilities()
+	capabilities.Snapshots = false
+	capabilities.StaleReads = true
+	return capabilities
+}
@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestDegradedMode covers serving last-known balances while storage is down
+func TestDegradedMode(t *testing.T) {
+	t.Run("Cached_Balance_Served_Mutations_Rejected", func(t *testing.T) {
+		backend := newMemoryBackend(map[string]int64{"aaron": 100, "bryan": 100})
+
+		database, err := NewDegradedDatabase(backend, DegradedOptions{FailureThreshold: 1, Cooldown: time.Hour})
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+		db := *database
+
+		db.AddUserCoins("aaron", 50)
+		backend.setDown(true)
+
+		// The read that finds storage down opens the circuit
+		if _, err := db.GetUserCoins("aaron"); !errors.Is(err, errBackendDown) {
+			t.Fatalf("Expected the first read to fail, got %v", err)
+		}
+
+		balance, _ := db.GetUserCoins("aaron")
+		if balance == nil || balance.Coins != 150 {
+			t.Fatalf("Expected cached balance 150, got %+v", balance)
+		}
+		if balance.CachedAt.IsZero() {
+			t.Errorf("Cached balance must be marked with CachedAt")
+		}
+
+		// Never seen before the outage, nothing to serve
+		if _, err := db.GetUserCoins("bryan"); err != ErrStorageUnavailable {
+			t.Errorf("Expected ErrStorageUnavailable for an uncached user, got %v", err)
+		}
+
+		if _, err := db.WithdrawUserCoins("aaron", 10); err != ErrStorageUnavailable {
+			t.Errorf("Withdrawals must be rejected while degraded, got %v", err)
+		}
+		if _, _, err := db.TransferUserCoinsWithContext(t.Context(), "aaron", "bryan", 10); err != ErrStorageUnavailable {
+			t.Errorf("Expected ErrStorageUnavailable, got %v", err)
+		}
+
+		if db.GetSystemHealth()["status"] != "degraded" {
+			t.Errorf("Expected degraded health status")
+		}
+	})
+
+	t.Run("Calls_Never_Wait_For_Health_Checks", func(t *testing.T) {
+		backend := newMemoryBackend(map[string]int64{"aaron": 100})
+		backend.hang = make(chan struct{})
+		defer close(backend.hang)
+
+		database, err := NewDegradedDatabase(backend, DegradedOptions{Cooldown: time.Millisecond})
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+
+		var start = time.Now()
+		for i := 0; i < 20; i++ {
+			if _, err := (*database).GetUserCoins("aaron"); err != nil {
+				t.Fatalf("Expected storage to answer, got %v", err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("Expected reads not to wait on a hung health check, took %s", elapsed)
+		}
+	})
+
+	t.Run("Fresh_Reads_Are_Not_Marked", func(t *testing.T) {
+		backend := newMemoryBackend(map[string]int64{"aaron": 100})
+
+		database, err := NewDegradedDatabase(backend, DegradedOptions{})
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+
+		balance, _ := (*database).GetUserCoins("aaron")
+		if balance == nil || !balance.CachedAt.IsZero() {
+			t.Errorf("Expected a fresh balance without CachedAt, got %+v", balance)
+		}
+	})
+
+	t.Run("Reports_Stale_Reads", func(t *testing.T) {
+		database, err := NewDegradedDatabase(newMemoryBackend(nil), DegradedOptions{FailureThreshold: 1, Cooldown: time.Hour})
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+		if capabilities := (*database).Capabilities(); !capabilities.StaleReads || !capabilities.Durable {
+			t.Errorf("Expected the backend's capabilities plus stale reads, got %+v", capabilities)
+		}
+	})
+}
@@ -0,0 +1,668 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrPrimaryUnavailable = errors.New("primary storage unavailable")
+
+type FailoverOptions struct {
+	// Consecutive failed operations or health probes before the circuit opens
+	FailureThreshold int
+
+	// How often the primary is probed in the background, and so how long the circuit
+	// stays open at least
+	Cooldown time.Duration
+
+	// Accept writes on the secondary while the circuit is open and replay them on the primary when it recovers
+	QueueWrites bool
+}
+
+// Write accepted by the secondary while the primary was down
+type queuedWrite struct {
+	txType string
+	from   string
+	to     string
+	amount int64
+}
+
+// failoverDB writes to the primary and mirrors successful writes to the secondary,
+// so reads can fail over when the primary's circuit breaker opens.
+type failoverDB struct {
+	primary   DatabaseInterface
+	secondary DatabaseInterface
+	options   FailoverOptions
+	breaker   *circuitBreaker
+
+	mu      sync.Mutex
+	pending []queuedWrite
+}
+
+func NewFailoverDatabase(primary DatabaseInterface, secondary DatabaseInterface, options FailoverOptions) (*DatabaseInterface, error) {
+	var failover = &failoverDB{
+		primary:   primary,
+		secondary: secondary,
+		options:   options,
+	}
+	failover.breaker = newCircuitBreaker("primary", options.FailureThreshold, options.Cooldown, func() bool {
+		return isHealthy(primary)
+	})
+	failover.breaker.recover = failover.catchUp
+
+	var database DatabaseInterface = failover
+	var err error = database.SetupDatabase()
+	if err != nil {
+		log.Error("Failed to setup failover database: ", err)
+		return nil, err
+	}
+
+	return &database, nil
+}
+
+func (d *failoverDB) SetupDatabase() error {
+	err := d.primary.SetupDatabase()
+	if err != nil {
+		return err
+	}
+	return d.secondary.SetupDatabase()
+}
+
+// primaryAvailable reports whether the primary's circuit is closed. It never waits on
+// the primary, the breaker probes it in the background.
+func (d *failoverDB) primaryAvailable() bool {
+	return d.breaker.allow()
+}
+
+// catchUp runs once a probe finds the primary back. It replays the queued writes on the
+// primary and closes the circuit under d.mu once none are left, so no write is queued
+// after the replay. A replay the primary doesn't answer leaves the rest queued and the
+// circuit open for the next probe.
+func (d *failoverDB) catchUp() {
+	for {
+		d.mu.Lock()
+		if len(d.pending) == 0 {
+			d.breaker.close()
+			d.mu.Unlock()
+			return
+		}
+		var pending []queuedWrite = d.pending
+		d.pending = nil
+		d.mu.Unlock()
+
+		replayed := d.replay(pending)
+		if replayed < len(pending) {
+			d.mu.Lock()
+			d.pending = append(pending[replayed:], d.pending...)
+			d.mu.Unlock()
+			return
+		}
+	}
+}
+
+// replay applies writes on the primary in order and compares the touched accounts
+// across both backends, returning how many it got through before the primary stopped
+// answering
+func (d *failoverDB) replay(writes []queuedWrite) int {
+	touched := make(map[string]bool)
+
+	for i, write := range writes {
+		var err error
+		switch write.txType {
+		case "DEPOSIT":
+			_, err = d.primary.AddUserCoins(write.to, write.amount)
+		case "WITHDRAWAL":
+			_, err = d.primary.WithdrawUserCoins(write.from, write.amount)
+		case "TRANSFER":
+			_, _, err = d.primary.TransferUserCoinsWithContext(context.Background(), write.from, write.to, write.amount)
+		}
+		if outage(err) {
+			log.Error("Catch-up stopped after ", i, " of ", len(writes), " queued writes: ", err)
+			d.breaker.failure("failed catch-up writes")
+			return i
+		}
+		if err != nil {
+			log.Error("Catch-up failed to replay ", write.txType, " of ", write.amount, " (", write.from, " -> ", write.to, "): ", err)
+		}
+
+		if write.from != "" {
+			touched[write.from] = true
+		}
+		if write.to != "" {
+			touched[write.to] = true
+		}
+	}
+
+	log.Info("Catch-up replayed ", len(writes), " queued writes on primary")
+
+	for username := range touched {
+		primaryCoins, primaryErr := d.primary.GetUserCoins(username)
+		secondaryCoins, secondaryErr := d.secondary.GetUserCoins(username)
+		if primaryErr != nil || secondaryErr != nil || primaryCoins.Coins != secondaryCoins.Coins {
+			log.Error("Reconciliation discrepancy for ", username, " after catch-up")
+		}
+	}
+	return len(writes)
+}
+
+func (d *failoverDB) reader() DatabaseInterface {
+	if d.primaryAvailable() {
+		return d.primary
+	}
+	return d.secondary
+}
+
+// read serves from the primary while its circuit is closed, counting the errors that
+// mean it is down, and from the secondary otherwise
+func read[T any](d *failoverDB, get func(database DatabaseInterface) (T, error)) (T, error) {
+	if !d.primaryAvailable() {
+		return get(d.secondary)
+	}
+	result, err := get(d.primary)
+	d.breaker.record(err)
+	return result, err
+}
+
+// queue applies write on the secondary and queues it for the primary, holding d.mu so
+// catchUp can't close the circuit in between. It reports false without applying it once
+// the circuit has closed, the caller then writes to the primary.
+func (d *failoverDB) queue(write queuedWrite, apply func() error) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.breaker.isOpen() {
+		return false, nil
+	}
+	err := apply()
+	if err == nil {
+		d.pending = append(d.pending, write)
+	}
+	return true, err
+}
+
+func (d *failoverDB) GetUserLoginDetails(username string) *LoginDetails {
+	return d.reader().GetUserLoginDetails(username)
+}
+
+func (d *failoverDB) GetUserCoins(username string) (*CoinDetails, error) {
+	return read(d, func(database DatabaseInterface) (*CoinDetails, error) { return database.GetUserCoins(username) })
+}
+
+func (d *failoverDB) AddUserCoins(username string, amount int64) (*CoinDetails, error) {
+	if !d.primaryAvailable() {
+		if !d.options.QueueWrites {
+			log.Error("Rejecting deposit for ", username, ": ", ErrPrimaryUnavailable)
+			return nil, ErrPrimaryUnavailable
+		}
+
+		var result *CoinDetails
+		queued, err := d.queue(queuedWrite{txType: "DEPOSIT", to: username, amount: amount}, func() (err error) {
+			result, err = d.secondary.AddUserCoins(username, amount)
+			return err
+		})
+		if queued {
+			return result, err
+		}
+	}
+
+	result, err := d.primary.AddUserCoins(username, amount)
+	d.breaker.record(err)
+	if err == nil {
+		if _, mirrorErr := d.secondary.AddUserCoins(username, amount); mirrorErr != nil {
+			log.Error("Failed to mirror deposit to secondary for ", username, ": ", mirrorErr)
+		}
+	}
+	return result, err
+}
+
+func (d *failoverDB) WithdrawUserCoins(username string, amount int64) (*CoinDetails, error) {
+	if !d.primaryAvailable() {
+		if !d.options.QueueWrites {
+			log.Error("Rejecting withdrawal for ", username, ": ", ErrPrimaryUnavailable)
+			return nil, ErrPrimaryUnavailable
+		}
+
+		var result *CoinDetails
+		queued, err := d.queue(queuedWrite{txType: "WITHDRAWAL", from: username, amount: amount}, func() (err error) {
+			result, err = d.secondary.WithdrawUserCoins(username, amount)
+			return err
+		})
+		if queued {
+			return result, err
+		}
+	}
+
+	result, err := d.primary.WithdrawUserCoins(username, amount)
+	d.breaker.record(err)
+	if err == nil {
+		if _, mirrorErr := d.secondary.WithdrawUserCoins(username, amount); mirrorErr != nil {
+			log.Error("Failed to mirror withdrawal to secondary for ", username, ": ", mirrorErr)
+		}
+	}
+	return result, err
+}
+
+// SetUserFrozen isn't queued, freezing needs the primary like co-ownership does
+func (d *failoverDB) SetUserFrozen(username string, frozen bool) (*CoinDetails, error) {
+	if !d.primaryAvailable() {
+		return nil, ErrPrimaryUnavailable
+	}
+
+	result, err := d.primary.SetUserFrozen(username, frozen)
+	d.breaker.record(err)
+	if err != nil {
+		return nil, err
+	}
+	if _, mirrorErr := d.secondary.SetUserFrozen(username, frozen); mirrorErr != nil {
+		log.Error("Failed to mirror freeze to secondary for ", username, ": ", mirrorErr)
+	}
+	return result, nil
+}
+
+// PlaceHold needs the primary like a freeze, and is mirrored so the secondary holds the
+// same coins back if it takes over
+func (d *failoverDB) PlaceHold(hold Hold) (*CoinDetails, error) {
+	if !d.primaryAvailable() {
+		return nil, ErrPrimaryUnavailable
+	}
+
+	result, err := d.primary.PlaceHold(hold)
+	d.breaker.record(err)
+	if err != nil {
+		return nil, err
+	}
+	if _, mirrorErr := d.secondary.PlaceHold(hold); mirrorErr != nil {
+		log.Error("Failed to mirror hold ", hold.ID, " to secondary: ", mirrorErr)
+	}
+	return result, nil
+}
+
+func (d *failoverDB) ReleaseHold(id string) (*CoinDetails, error) {
+	if !d.primaryAvailable() {
+		return nil, ErrPrimaryUnavailable
+	}
+
+	result, err := d.primary.ReleaseHold(id)
+	d.breaker.record(err)
+	if err != nil {
+		return nil, err
+	}
+	if _, mirrorErr := d.secondary.ReleaseHold(id); mirrorErr != nil && !errors.Is(mirrorErr, ErrHoldNotFound) {
+		log.Error("Failed to mirror hold release ", id, " to secondary: ", mirrorErr)
+	}
+	return result, nil
+}
+
+// CaptureHold only runs on the primary, the secondary can't queue a hold it may not
+// have. The mirror captures the same hold, so both ledgers log the move.
+func (d *failoverDB) CaptureHold(ctx context.Context, id string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error) {
+	if !d.primaryAvailable() {
+		return nil, nil, ErrPrimaryUnavailable
+	}
+
+	fromDetails, toDetails, err = d.primary.CaptureHold(ctx, id, to, amount)
+	d.breaker.record(err)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, _, mirrorErr := d.secondary.CaptureHold(context.Background(), id, to, amount); mirrorErr != nil {
+		log.Error("Failed to mirror hold capture ", id, " to secondary: ", mirrorErr)
+	}
+	return fromDetails, toDetails, nil
+}
+
+func (d *failoverDB) GetHolds(account string) ([]Hold, error) {
+	return read(d, func(database DatabaseInterface) ([]Hold, error) { return database.GetHolds(account) })
+}
+
+func (d *failoverDB) TransferUserCoins(from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails) {
+	fromResult, toResult, err := d.TransferUserCoinsWithContext(context.Background(), from, to, amount)
+	if err != nil {
+		return nil, nil
+	}
+	return fromResult, toResult
+}
+
+func (d *failoverDB) TransferUserCoinsWithContext(ctx context.Context, from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error) {
+	if !d.primaryAvailable() {
+		if !d.options.QueueWrites {
+			return nil, nil, ErrPrimaryUnavailable
+		}
+
+		queued, err := d.queue(queuedWrite{txType: "TRANSFER", from: from, to: to, amount: amount}, func() (err error) {
+			fromDetails, toDetails, err = d.secondary.TransferUserCoinsWithContext(ctx, from, to, amount)
+			return err
+		})
+		if queued {
+			return fromDetails, toDetails, err
+		}
+	}
+
+	fromDetails, toDetails, err = d.primary.TransferUserCoinsWithContext(ctx, from, to, amount)
+	d.breaker.record(err)
+	if err == nil {
+		_, _, mirrorErr := d.secondary.TransferUserCoinsWithContext(context.Background(), from, to, amount)
+		if mirrorErr != nil {
+			log.Error("Failed to mirror transfer to secondary: ", mirrorErr)
+		}
+	}
+	return fromDetails, toDetails, err
+}
+
+func (d *failoverDB) GetTransactionHistory(username string) []TransactionLog {
+	return d.reader().GetTransactionHistory(username)
+}
+
+func (d *failoverDB) GetTransactionHistoryPage(username string, before int64, limit int) []TransactionLog {
+	return d.reader().GetTransactionHistoryPage(username, before, limit)
+}
+
+func (d *failoverDB) GetTransaction(id string) (TransactionLog, bool) {
+	return d.reader().GetTransaction(id)
+}
+
+func (d *failoverDB) GetAllTransactions() []TransactionLog {
+	return d.reader().GetAllTransactions()
+}
+
+// CreateUser needs the primary, the account is then added to the secondary as well
+func (d *failoverDB) CreateUser(login LoginDetails) (*CoinDetails, error) {
+	if !d.primaryAvailable() {
+		return nil, ErrPrimaryUnavailable
+	}
+
+	result, err := d.primary.CreateUser(login)
+	d.breaker.record(err)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = d.secondary.CreateUser(login)
+	if err != nil && !errors.Is(err, ErrUserExists) {
+		log.Error("Failed to mirror new account to secondary for ", login.Username, ": ", err)
+	}
+	return result, nil
+}
+
+// DeleteUser needs the primary, the account is then removed from the secondary as well
+func (d *failoverDB) DeleteUser(username string) error {
+	if !d.primaryAvailable() {
+		return ErrPrimaryUnavailable
+	}
+
+	err := d.primary.DeleteUser(username)
+	d.breaker.record(err)
+	if err != nil {
+		return err
+	}
+
+	err = d.secondary.DeleteUser(username)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		log.Error("Failed to remove ", username, " from secondary: ", err)
+	}
+	return nil
+}
+
+// AnonymizeUser needs the primary, the secondary is then anonymized the same way
+func (d *failoverDB) AnonymizeUser(username string, pseudonym string) error {
+	if !d.primaryAvailable() {
+		return ErrPrimaryUnavailable
+	}
+
+	err := d.primary.AnonymizeUser(username, pseudonym)
+	d.breaker.record(err)
+	if err != nil {
+		return err
+	}
+
+	err = d.secondary.AnonymizeUser(username, pseudonym)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		log.Error("Failed to anonymize ", username, " on secondary: ", err)
+	}
+	return nil
+}
+
+// CorrectUserCoins needs the primary, the secondary is then set to the same balance
+func (d *failoverDB) CorrectUserCoins(username string, version int64, balance int64) (*CoinDetails, error) {
+	if !d.primaryAvailable() {
+		return nil, ErrPrimaryUnavailable
+	}
+
+	result, err := d.primary.CorrectUserCoins(username, version, balance)
+	d.breaker.record(err)
+	if err != nil {
+		return nil, err
+	}
+
+	mirror, mirrorErr := d.secondary.GetUserCoins(username)
+	if mirrorErr != nil || mirror.Coins != balance {
+		var mirrored bool
+		if mirrorErr == nil {
+			_, mirrorErr := d.secondary.CorrectUserCoins(username, mirror.Version, balance)
+			mirrored = mirrorErr == nil
+		}
+		if !mirrored {
+			log.Error("Failed to mirror balance correction to secondary for ", username)
+		}
+	}
+	return result, nil
+}
+
+// Refresh tokens need the primary. Revocations are mirrored to the secondary, so a
+// failover can't bring a revoked token back, but new tokens aren't: they stop working
+// while the circuit is open.
+func (d *failoverDB) StoreRefreshToken(token RefreshToken) error {
+	if !d.primaryAvailable() {
+		return ErrPrimaryUnavailable
+	}
+
+	err := d.primary.StoreRefreshToken(token)
+	d.breaker.record(err)
+	return err
+}
+
+func (d *failoverDB) RevokeRefreshToken(hash string) (*RefreshToken, error) {
+	if !d.primaryAvailable() {
+		return nil, ErrPrimaryUnavailable
+	}
+
+	token, err := d.primary.RevokeRefreshToken(hash)
+	d.breaker.record(err)
+	return token, err
+}
+
+func (d *failoverDB) RevokeRefreshTokens(username string, family string) (int, error) {
+	if !d.primaryAvailable() {
+		return 0, ErrPrimaryUnavailable
+	}
+
+	count, err := d.primary.RevokeRefreshTokens(username, family)
+	d.breaker.record(err)
+	if err != nil {
+		return count, err
+	}
+	_, err = d.secondary.RevokeRefreshTokens(username, family)
+	if err != nil {
+		log.Error("Failed to mirror refresh token revocation to secondary for ", username, ": ", err)
+	}
+	return count, nil
+}
+
+// Co-owners are changed on the primary and mirrored like revocations, so a failover
+// can't give a removed owner their access back
+func (d *failoverDB) SetAccountOwner(owner AccountOwner) error {
+	if !d.primaryAvailable() {
+		return ErrPrimaryUnavailable
+	}
+
+	err := d.primary.SetAccountOwner(owner)
+	d.breaker.record(err)
+	if err != nil {
+		return err
+	}
+	err = d.secondary.SetAccountOwner(owner)
+	if err != nil {
+		log.Error("Failed to mirror account owner to secondary for ", owner.Account, ": ", err)
+	}
+	return nil
+}
+
+func (d *failoverDB) GetAccountOwners(account string) ([]AccountOwner, error) {
+	return read(d, func(database DatabaseInterface) ([]AccountOwner, error) { return database.GetAccountOwners(account) })
+}
+
+func (d *failoverDB) RemoveAccountOwner(account string, owner string) error {
+	if !d.primaryAvailable() {
+		return ErrPrimaryUnavailable
+	}
+
+	err := d.primary.RemoveAccountOwner(account, owner)
+	d.breaker.record(err)
+	if err != nil {
+		return err
+	}
+	err = d.secondary.RemoveAccountOwner(account, owner)
+	if err != nil && !errors.Is(err, ErrOwnerNotFound) {
+		log.Error("Failed to mirror account owner removal to secondary for ", account, ": ", err)
+	}
+	return nil
+}
+
+func (d *failoverDB) PutRecord(record Record) error {
+	if !d.primaryAvailable() {
+		return ErrPrimaryUnavailable
+	}
+
+	err := d.primary.PutRecord(record)
+	d.breaker.record(err)
+	if err != nil {
+		return err
+	}
+	err = d.secondary.PutRecord(record)
+	if err != nil {
+		log.Error("Failed to mirror ", record.Kind, " record ", record.ID, " to secondary: ", err)
+	}
+	return nil
+}
+
+func (d *failoverDB) GetRecord(kind string, id string) (*Record, error) {
+	return read(d, func(database DatabaseInterface) (*Record, error) { return database.GetRecord(kind, id) })
+}
+
+func (d *failoverDB) ListRecords(kind string, account string) ([]Record, error) {
+	return read(d, func(database DatabaseInterface) ([]Record, error) { return database.ListRecords(kind, account) })
+}
+
+func (d *failoverDB) DeleteRecord(kind string, id string) error {
+	if !d.primaryAvailable() {
+		return ErrPrimaryUnavailable
+	}
+
+	err := d.primary.DeleteRecord(kind, id)
+	d.breaker.record(err)
+	if err != nil {
+		return err
+	}
+	err = d.secondary.DeleteRecord(kind, id)
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		log.Error("Failed to mirror ", kind, " record removal ", id, " to secondary: ", err)
+	}
+	return nil
+}
+
+// AppendEvent needs the primary like a hold, and is mirrored with the primary's ID so
+// the secondary's log reads the same if it takes over
+func (d *failoverDB) AppendEvent(event Event) (int64, error) {
+	if !d.primaryAvailable() {
+		return 0, ErrPrimaryUnavailable
+	}
+
+	id, err := d.primary.AppendEvent(event)
+	d.breaker.record(err)
+	if err != nil {
+		return 0, err
+	}
+	event.ID = id
+	if _, mirrorErr := d.secondary.AppendEvent(event); mirrorErr != nil {
+		log.Error("Failed to mirror event ", id, " to secondary: ", mirrorErr)
+	}
+	return id, nil
+}
+
+func (d *failoverDB) ListEvents(filter EventFilter) ([]Event, error) {
+	return read(d, func(database DatabaseInterface) ([]Event, error) { return database.ListEvents(filter) })
+}
+
+func (d *failoverDB) RewriteEvent(event Event) error {
+	if !d.primaryAvailable() {
+		return ErrPrimaryUnavailable
+	}
+
+	err := d.primary.RewriteEvent(event)
+	d.breaker.record(err)
+	if err != nil {
+		return err
+	}
+	err = d.secondary.RewriteEvent(event)
+	if err != nil && !errors.Is(err, ErrEventNotFound) {
+		log.Error("Failed to mirror event rewrite ", event.ID, " to secondary: ", err)
+	}
+	return nil
+}
+
+func (d *failoverDB) GetAllUserCoins() []CoinDetails {
+	return d.reader().GetAllUserCoins()
+}
+
+// ListUserCoins pages by username on either backend, so a walk can carry on across a
+// failover
+func (d *failoverDB) ListUserCoins(ctx context.Context, after string, limit int) ([]CoinDetails, error) {
+	return read(d, func(database DatabaseInterface) ([]CoinDetails, error) {
+		return database.ListUserCoins(ctx, after, limit)
+	})
+}
+
+func (d *failoverDB) TopUserCoins(usernames []string, limit int) []CoinDetails {
+	return d.reader().TopUserCoins(usernames, limit)
+}
+
+func (d *failoverDB) GetPostings() []Posting {
+	return d.reader().GetPostings()
+}
+
+func (d *failoverDB) GetSystemHealth() map[string]interface{} {
+	available := d.primaryAvailable()
+
+	var health map[string]interface{}
+	if available {
+		health = d.primary.GetSystemHealth()
+	} else {
+		health = d.secondary.GetSystemHealth()
+		health["status"] = "degraded"
+	}
+
+	d.mu.Lock()
+	health["failover"] = map[string]interface{}{
+		"circuit_open":  d.breaker.isOpen(),
+		"queued_writes": len(d.pending),
+	}
+	d.mu.Unlock()
+
+	return health
+}
+
+// Capabilities are only what both databases support, since either may be answering.
+// A subscription would miss whatever the other one logs, so there is no streaming.
+func (d *failoverDB) Capabilities() Capabilities {
+	primary, secondary := d.primary.Capabilities(), d.secondary.Capabilities()
+	return Capabilities{
+		Durable:      primary.Durable && secondary.Durable,
+		Transactions: primary.Transactions && secondary.Transactions,
+		TimeTravel:   primary.TimeTravel && secondary.TimeTravel,
+		StaleReads:   primary.StaleReads || secondary.StaleReads,
+	}
+}
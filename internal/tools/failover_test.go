@@ -0,0 +1,311 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// errBackendDown is what a memoryBackend that is down answers, like a lost connection
+var errBackendDown = errors.New("backend down")
+
+// memoryBackend is an isolated DatabaseInterface whose health can be toggled,
+// mockDB can't be used twice because its tables are package globals.
+type memoryBackend struct {
+	mu    sync.Mutex
+	coins map[string]int64
+	down  bool
+
+	// Health checks wait for this to close when set
+	hang chan struct{}
+}
+
+func newMemoryBackend(balances map[string]int64) *memoryBackend {
+	coins := make(map[string]int64)
+	for k, v := range balances {
+		coins[k] = v
+	}
+	return &memoryBackend{coins: coins}
+}
+
+func (m *memoryBackend) setDown(down bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.down = down
+}
+
+func (m *memoryBackend) SetupDatabase() error { return nil }
+
+func (m *memoryBackend) GetUserLoginDetails(username string) *LoginDetails { return nil }
+
+func (m *memoryBackend) GetUserCoins(username string) (*CoinDetails, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.down {
+		return nil, errBackendDown
+	}
+	coins, ok := m.coins[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &CoinDetails{Username: username, Coins: coins}, nil
+}
+
+func (m *memoryBackend) AddUserCoins(username string, amount int64) (*CoinDetails, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.down {
+		return nil, errBackendDown
+	}
+	if _, ok := m.coins[username]; !ok {
+		return nil, ErrUserNotFound
+	}
+	m.coins[username] += amount
+	return &CoinDetails{Username: username, Coins: m.coins[username]}, nil
+}
+
+func (m *memoryBackend) WithdrawUserCoins(username string, amount int64) (*CoinDetails, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.down {
+		return nil, errBackendDown
+	}
+	coins, ok := m.coins[username]
+	if !ok || coins < amount {
+		return nil, ErrInsufficientFunds
+	}
+	m.coins[username] -= amount
+	return &CoinDetails{Username: username, Coins: m.coins[username]}, nil
+}
+
+func (m *memoryBackend) SetUserFrozen(username string, frozen bool) (*CoinDetails, error) {
+	return m.GetUserCoins(username)
+}
+
+func (m *memoryBackend) PlaceHold(hold Hold) (*CoinDetails, error) {
+	return m.GetUserCoins(hold.Account)
+}
+func (m *memoryBackend) ReleaseHold(id string) (*CoinDetails, error) {
+	return nil, ErrHoldNotFound
+}
+func (m *memoryBackend) GetHolds(account string) ([]Hold, error) { return nil, nil }
+func (m *memoryBackend) CaptureHold(ctx context.Context, id string, to string, amount int64) (*CoinDetails, *CoinDetails, error) {
+	return nil, nil, ErrHoldNotFound
+}
+
+func (m *memoryBackend) TransferUserCoins(from string, to string, amount int64) (*CoinDetails, *CoinDetails) {
+	fromDetails, toDetails, _ := m.TransferUserCoinsWithContext(context.Background(), from, to, amount)
+	return fromDetails, toDetails
+}
+
+func (m *memoryBackend) TransferUserCoinsWithContext(ctx context.Context, from string, to string, amount int64) (*CoinDetails, *CoinDetails, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.down {
+		return nil, nil, errBackendDown
+	}
+	if m.coins[from] < amount {
+		return nil, nil, ErrInsufficientFunds
+	}
+	m.coins[from] -= amount
+	m.coins[to] += amount
+	return &CoinDetails{Username: from, Coins: m.coins[from]}, &CoinDetails{Username: to, Coins: m.coins[to]}, nil
+}
+
+func (m *memoryBackend) GetTransactionHistory(username string) []TransactionLog { return nil }
+
+func (m *memoryBackend) GetTransactionHistoryPage(username string, before int64, limit int) []TransactionLog {
+	return nil
+}
+
+func (m *memoryBackend) GetTransaction(id string) (TransactionLog, bool) {
+	return TransactionLog{}, false
+}
+
+func (m *memoryBackend) GetAllTransactions() []TransactionLog { return nil }
+
+func (m *memoryBackend) GetPostings() []Posting         { return nil }
+func (m *memoryBackend) GetAllUserCoins() []CoinDetails { return nil }
+func (m *memoryBackend) ListUserCoins(ctx context.Context, after string, limit int) ([]CoinDetails, error) {
+	return nil, nil
+}
+func (m *memoryBackend) CreateUser(login LoginDetails) (*CoinDetails, error) {
+	return nil, ErrUserExists
+}
+func (m *memoryBackend) DeleteUser(username string) error {
+	return ErrUserNotFound
+}
+func (m *memoryBackend) TopUserCoins(usernames []string, limit int) []CoinDetails {
+	return nil
+}
+func (m *memoryBackend) AnonymizeUser(username string, pseudonym string) error {
+	return ErrUserNotFound
+}
+func (m *memoryBackend) CorrectUserCoins(username string, version int64, balance int64) (*CoinDetails, error) {
+	return nil, ErrUserNotFound
+}
+
+func (m *memoryBackend) StoreRefreshToken(token RefreshToken) error { return nil }
+func (m *memoryBackend) RevokeRefreshToken(hash string) (*RefreshToken, error) {
+	return nil, ErrRefreshTokenNotFound
+}
+func (m *memoryBackend) RevokeRefreshTokens(username string, family string) (int, error) {
+	return 0, nil
+}
+
+func (m *memoryBackend) SetAccountOwner(owner AccountOwner) error { return nil }
+func (m *memoryBackend) GetAccountOwners(account string) ([]AccountOwner, error) {
+	return []AccountOwner{}, nil
+}
+func (m *memoryBackend) RemoveAccountOwner(account string, owner string) error {
+	return ErrOwnerNotFound
+}
+
+func (m *memoryBackend) PutRecord(record Record) error { return nil }
+func (m *memoryBackend) GetRecord(kind string, id string) (*Record, error) {
+	return nil, ErrRecordNotFound
+}
+func (m *memoryBackend) ListRecords(kind string, account string) ([]Record, error) {
+	return []Record{}, nil
+}
+func (m *memoryBackend) DeleteRecord(kind string, id string) error { return ErrRecordNotFound }
+func (m *memoryBackend) AppendEvent(event Event) (int64, error)    { return event.ID, nil }
+func (m *memoryBackend) ListEvents(filter EventFilter) ([]Event, error) {
+	return []Event{}, nil
+}
+func (m *memoryBackend) RewriteEvent(event Event) error { return ErrEventNotFound }
+
+func (m *memoryBackend) GetSystemHealth() map[string]interface{} {
+	if m.hang != nil {
+		<-m.hang
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.down {
+		return map[string]interface{}{"status": "unhealthy"}
+	}
+	return map[string]interface{}{"status": "healthy"}
+}
+
+// Stands in for a persistent backend
+func (m *memoryBackend) Capabilities() Capabilities {
+	return Capabilities{Durable: true}
+}
+
+// TestFailover covers circuit breaking between a primary and secondary backend
+func TestFailover(t *testing.T) {
+	t.Run("Reads_Fail_Over_When_Circuit_Opens", func(t *testing.T) {
+		balances := map[string]int64{"aaron": 100, "bryan": 100}
+		primary := newMemoryBackend(balances)
+		secondary := newMemoryBackend(balances)
+
+		database, err := NewFailoverDatabase(primary, secondary, FailoverOptions{FailureThreshold: 2, Cooldown: time.Hour})
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+		db := *database
+
+		db.TransferUserCoins("aaron", "bryan", 40)
+		primary.setDown(true)
+
+		// Below the threshold the primary is still used
+		for i := 0; i < 2; i++ {
+			if _, err := db.GetUserCoins("aaron"); !errors.Is(err, errBackendDown) {
+				t.Errorf("Expected primary to serve reads before the circuit opens, got %v", err)
+			}
+		}
+
+		balance, _ := db.GetUserCoins("aaron")
+		if balance == nil || balance.Coins != 60 {
+			t.Errorf("Expected secondary to serve mirrored balance 60, got %+v", balance)
+		}
+
+		if _, err := db.AddUserCoins("aaron", 10); err != ErrPrimaryUnavailable {
+			t.Errorf("Writes must be rejected while the circuit is open without QueueWrites, got %v", err)
+		}
+	})
+
+	t.Run("Queued_Writes_Replayed_On_Recovery", func(t *testing.T) {
+		balances := map[string]int64{"aaron": 100, "bryan": 100}
+		primary := newMemoryBackend(balances)
+		secondary := newMemoryBackend(balances)
+
+		database, err := NewFailoverDatabase(primary, secondary, FailoverOptions{FailureThreshold: 1, Cooldown: time.Millisecond, QueueWrites: true})
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+		db := *database
+
+		// The write that finds the primary down fails and opens the circuit
+		primary.setDown(true)
+		if _, err := db.AddUserCoins("aaron", 1); !errors.Is(err, errBackendDown) && !errors.Is(err, ErrPrimaryUnavailable) {
+			t.Fatalf("Expected the first write to fail, got %v", err)
+		}
+
+		fromDetails, toDetails := db.TransferUserCoins("aaron", "bryan", 30)
+		if fromDetails == nil || toDetails == nil {
+			t.Fatalf("Expected transfer to be accepted by the secondary")
+		}
+		db.AddUserCoins("bryan", 5)
+
+		// A background probe closes the circuit once the queue is replayed
+		primary.setDown(false)
+		var failover map[string]interface{}
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			db.GetUserCoins("aaron")
+			failover = db.GetSystemHealth()["failover"].(map[string]interface{})
+			if failover["circuit_open"] == false {
+				break
+			}
+		}
+		if failover["queued_writes"] != 0 || failover["circuit_open"] != false {
+			t.Fatalf("Expected a closed circuit with an empty queue, got %v", failover)
+		}
+
+		aaron, _ := primary.GetUserCoins("aaron")
+		bryan, _ := primary.GetUserCoins("bryan")
+		if aaron.Coins != 70 || bryan.Coins != 135 {
+			t.Errorf("Primary did not catch up: aaron=%d bryan=%d", aaron.Coins, bryan.Coins)
+		}
+	})
+
+	t.Run("Calls_Never_Wait_For_Health_Checks", func(t *testing.T) {
+		primary := newMemoryBackend(map[string]int64{"aaron": 100})
+		primary.hang = make(chan struct{})
+		defer close(primary.hang)
+
+		database, err := NewFailoverDatabase(primary, newMemoryBackend(nil), FailoverOptions{Cooldown: time.Millisecond})
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+
+		var start = time.Now()
+		for i := 0; i < 20; i++ {
+			if _, err := (*database).GetUserCoins("aaron"); err != nil {
+				t.Fatalf("Expected the primary to answer, got %v", err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("Expected reads not to wait on a hung health check, took %s", elapsed)
+		}
+	})
+
+	t.Run("Capabilities_Are_What_Both_Support", func(t *testing.T) {
+		logins, coins := DemoAccounts()
+		secondary, err := NewMemoryDatabase(logins, coins)
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+
+		database, err := NewFailoverDatabase(newMemoryBackend(nil), *secondary, FailoverOptions{FailureThreshold: 2, Cooldown: time.Hour})
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+		if capabilities := (*database).Capabilities(); capabilities != (Capabilities{}) {
+			t.Errorf("Expected no capabilities over a durable and an in-memory backend, got %+v", capabilities)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"math/rand"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -63,10 +64,10 @@ func TestFinancialSystemScenarios(t *testing.T) {
 			totalSuccessful, totalFailed, numTrades)
 
 		// Verify money conservation
-		finalExchange := db.GetUserCoins("exchange")
-		finalTrader1 := db.GetUserCoins("trader_1")
-		finalTrader2 := db.GetUserCoins("trader_2")
-		finalTrader3 := db.GetUserCoins("trader_3")
+		finalExchange, _ := db.GetUserCoins("exchange")
+		finalTrader1, _ := db.GetUserCoins("trader_1")
+		finalTrader2, _ := db.GetUserCoins("trader_2")
+		finalTrader3, _ := db.GetUserCoins("trader_3")
 
 		totalFinal := finalExchange.Coins + finalTrader1.Coins + finalTrader2.Coins + finalTrader3.Coins
 		expectedTotal := int64(1300000)
@@ -107,9 +108,9 @@ func TestFinancialSystemScenarios(t *testing.T) {
 			go func(customerID string) {
 				defer wg.Done()
 
-				balance := db.GetUserCoins(customerID)
+				balance, _ := db.GetUserCoins(customerID)
 				if balance != nil {
-					result := db.WithdrawUserCoins(customerID, balance.Coins)
+					result, _ := db.WithdrawUserCoins(customerID, balance.Coins)
 					if result != nil {
 						atomic.AddInt64(&totalWithdrawn, balance.Coins)
 					}
@@ -124,7 +125,7 @@ func TestFinancialSystemScenarios(t *testing.T) {
 
 		// Verify no negative balances
 		for _, customer := range customers {
-			balance := db.GetUserCoins(customer)
+			balance, _ := db.GetUserCoins(customer)
 			if balance.Coins < 0 {
 				t.Errorf("Customer %s has negative balance: %d", customer, balance.Coins)
 			}
@@ -201,7 +202,7 @@ func TestFinancialSystemScenarios(t *testing.T) {
 			finalSuccessful, finalFailed, numPayments)
 
 		// Verify processor collected fees
-		processor := db.GetUserCoins("payment_processor")
+		processor, _ := db.GetUserCoins("payment_processor")
 		if processor.Coins < 0 {
 			t.Errorf("Payment processor has negative balance: %d", processor.Coins)
 		}
@@ -209,7 +210,7 @@ func TestFinancialSystemScenarios(t *testing.T) {
 		// Verify money conservation
 		total := int64(0)
 		for _, user := range []string{"merchant_1", "merchant_2", "customer_a", "customer_b", "customer_c", "payment_processor"} {
-			balance := db.GetUserCoins(user)
+			balance, _ := db.GetUserCoins(user)
 			total += balance.Coins
 		}
 
@@ -269,8 +270,8 @@ func TestFinancialSystemScenarios(t *testing.T) {
 		}
 
 		// Verify money conservation
-		balanceA := db.GetUserCoins("account_a")
-		balanceB := db.GetUserCoins("account_b")
+		balanceA, _ := db.GetUserCoins("account_a")
+		balanceB, _ := db.GetUserCoins("account_b")
 		total := balanceA.Coins + balanceB.Coins
 
 		if total != 20000 {
@@ -334,6 +335,76 @@ func TestComplianceAndAuditing(t *testing.T) {
 		}
 	})
 
+	t.Run("Transfer_Returns_Its_Transaction_ID", func(t *testing.T) {
+		logins, coins := DemoAccounts()
+		database, err := NewMemoryDatabase(logins, coins)
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+		db := *database
+
+		fromDetails, toDetails := db.TransferUserCoins("aaron", "bryan", 10)
+		history := db.GetTransactionHistory("aaron")
+		if fromDetails == nil || toDetails == nil || fromDetails.TransactionID != history[len(history)-1].ID || toDetails.TransactionID != fromDetails.TransactionID {
+			t.Errorf("Expected both details to carry the ledger entry's ID, got %+v and %+v", fromDetails, toDetails)
+		}
+		if balance, _ := db.GetUserCoins("aaron"); balance.TransactionID != "" {
+			t.Errorf("Expected stored balances not to keep the ID, got %q", balance.TransactionID)
+		}
+	})
+
+	t.Run("Accounts_Are_Listed_By_Name", func(t *testing.T) {
+		logins, coins := DemoAccounts()
+		database, err := NewMemoryDatabase(logins, coins)
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+
+		var seen []string
+		err = ForEachAccount(t.Context(), *database, func(details CoinDetails) error {
+			seen = append(seen, details.Username)
+			return nil
+		})
+		if err != nil || len(seen) != len(coins) || !sort.StringsAreSorted(seen) {
+			t.Errorf("Expected all %d accounts in order, got %v: %v", len(coins), seen, err)
+		}
+
+		page, _ := (*database).ListUserCoins(t.Context(), seen[0], 1)
+		if len(page) != 1 || page[0].Username != seen[1] {
+			t.Errorf("Expected the page after %s to start at %s, got %+v", seen[0], seen[1], page)
+		}
+	})
+
+	t.Run("Ledger_Sequences_Have_No_Gaps", func(t *testing.T) {
+		logins, coins := DemoAccounts()
+		database, err := NewMemoryDatabase(logins, coins)
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+		db := *database
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				db.TransferUserCoins("aaron", "bryan", 10)
+			}()
+			go func() {
+				defer wg.Done()
+				db.WithdrawUserCoins("bryan", 5)
+			}()
+		}
+		wg.Wait()
+
+		// Rejections and self-transfers are numbered too, the latter once
+		db.TransferUserCoins("aaron", "bryan", 1_000_000)
+		db.TransferUserCoins("aaron", "aaron", 10)
+
+		assertSequences(t, db.GetTransactionHistory("aaron"), "aaron", 22)
+		assertSequences(t, db.GetTransactionHistory("bryan"), "bryan", 41)
+	})
+
 	t.Run("High_Volume_Performance_Test", func(t *testing.T) {
 		// Test realistic financial system load
 		mockCoinDetails = map[string]CoinDetails{
@@ -399,7 +470,7 @@ func TestComplianceAndAuditing(t *testing.T) {
 		// Verify data integrity
 		total := int64(0)
 		for _, user := range users {
-			balance := db.GetUserCoins(user)
+			balance, _ := db.GetUserCoins(user)
 			total += balance.Coins
 		}
 
@@ -408,3 +479,16 @@ func TestComplianceAndAuditing(t *testing.T) {
 		}
 	})
 }
+
+// assertSequences checks username's history is numbered 1 to want in order
+func assertSequences(t *testing.T, history []TransactionLog, username string, want int64) {
+	t.Helper()
+	if int64(len(history)) != want {
+		t.Fatalf("Expected %d entries for %s, got %d", want, username, len(history))
+	}
+	for i, tx := range history {
+		if tx.SequenceFor(username) != int64(i+1) {
+			t.Fatalf("Expected %s's entry %d to be numbered %d, got %+v", username, i, i+1, tx)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrSimulatedFailure      = errors.New("simulated storage failure")
+	ErrUnknownLatencyProfile = errors.New("unknown latency profile")
+)
+
+// Latency is how long one class of operation takes: Base plus up to Jitter more, and
+// Spike on top for a SpikeRate fraction of calls, the slow tail real backends have
+type Latency struct {
+	Base      time.Duration
+	Jitter    time.Duration
+	SpikeRate float64
+	Spike     time.Duration
+}
+
+// LatencyProfile makes the mock backend answer with the timing and failure rate of a
+// real one, so local runs and benchmarks see realistic numbers before one is configured
+type LatencyProfile struct {
+	Name     string
+	Read     Latency
+	Write    Latency
+	Transfer Latency
+
+	// Fraction of mutations that fail without changing anything. Reads never fail,
+	// since handlers would take a missing balance for a missing account.
+	ErrorRate float64
+}
+
+// Built in profiles, rough shapes of each kind of server on a local network
+var latencyProfiles = map[string]LatencyProfile{
+	"postgres-like": {
+		Name:      "postgres-like",
+		Read:      Latency{Base: 500 * time.Microsecond, Jitter: time.Millisecond, SpikeRate: 0.01, Spike: 20 * time.Millisecond},
+		Write:     Latency{Base: 2 * time.Millisecond, Jitter: 2 * time.Millisecond, SpikeRate: 0.01, Spike: 40 * time.Millisecond},
+		Transfer:  Latency{Base: 4 * time.Millisecond, Jitter: 3 * time.Millisecond, SpikeRate: 0.02, Spike: 60 * time.Millisecond},
+		ErrorRate: 0.001,
+	},
+	"mysql-like": {
+		Name:      "mysql-like",
+		Read:      Latency{Base: 400 * time.Microsecond, Jitter: time.Millisecond, SpikeRate: 0.01, Spike: 25 * time.Millisecond},
+		Write:     Latency{Base: 2 * time.Millisecond, Jitter: 3 * time.Millisecond, SpikeRate: 0.02, Spike: 50 * time.Millisecond},
+		Transfer:  Latency{Base: 5 * time.Millisecond, Jitter: 4 * time.Millisecond, SpikeRate: 0.03, Spike: 80 * time.Millisecond},
+		ErrorRate: 0.002,
+	},
+	"redis-like": {
+		Name:      "redis-like",
+		Read:      Latency{Base: 150 * time.Microsecond, Jitter: 200 * time.Microsecond, SpikeRate: 0.001, Spike: 5 * time.Millisecond},
+		Write:     Latency{Base: 250 * time.Microsecond, Jitter: 250 * time.Microsecond, SpikeRate: 0.001, Spike: 5 * time.Millisecond},
+		Transfer:  Latency{Base: 400 * time.Microsecond, Jitter: 400 * time.Microsecond, SpikeRate: 0.002, Spike: 10 * time.Millisecond},
+		ErrorRate: 0.0005,
+	},
+}
+
+var latencyProfilesMu sync.RWMutex
+
+// latencyFile is one profile in a profiles file, with durations like "1.5ms"
+type latencyFile struct {
+	Read      latencyFileEntry `json:"read"`
+	Write     latencyFileEntry `json:"write"`
+	Transfer  latencyFileEntry `json:"transfer"`
+	ErrorRate float64          `json:"error_rate"`
+}
+
+type latencyFileEntry struct {
+	Base      string  `json:"base"`
+	Jitter    string  `json:"jitter"`
+	SpikeRate float64 `json:"spike_rate"`
+	Spike     string  `json:"spike"`
+}
+
+func (e latencyFileEntry) parse() (Latency, error) {
+	var latency = Latency{SpikeRate: e.SpikeRate}
+	for _, field := range []struct {
+		text  string
+		value *time.Duration
+	}{{e.Base, &latency.Base}, {e.Jitter, &latency.Jitter}, {e.Spike, &latency.Spike}} {
+		if field.text == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(field.text)
+		if err != nil {
+			return Latency{}, err
+		}
+		if duration < 0 {
+			return Latency{}, fmt.Errorf("duration %s is negative", field.text)
+		}
+		*field.value = duration
+	}
+	if latency.SpikeRate < 0 || latency.SpikeRate > 1 {
+		return Latency{}, fmt.Errorf("spike rate %v is not between 0 and 1", latency.SpikeRate)
+	}
+	return latency, nil
+}
+
+// LoadLatencyProfiles adds the profiles in the JSON file at path, keyed by name, to the
+// built in ones, replacing any of the same name. Nothing is loaded for an empty path.
+func LoadLatencyProfiles(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading latency profiles: %w", err)
+	}
+	var file map[string]latencyFile
+	err = json.Unmarshal(contents, &file)
+	if err != nil {
+		return fmt.Errorf("parsing latency profiles: %w", err)
+	}
+
+	var loaded = map[string]LatencyProfile{}
+	for name, entry := range file {
+		var profile = LatencyProfile{Name: name, ErrorRate: entry.ErrorRate}
+		if profile.ErrorRate < 0 || profile.ErrorRate > 1 {
+			return fmt.Errorf("latency profile %s: error rate %v is not between 0 and 1", name, profile.ErrorRate)
+		}
+		for _, class := range []struct {
+			entry latencyFileEntry
+			value *Latency
+		}{{entry.Read, &profile.Read}, {entry.Write, &profile.Write}, {entry.Transfer, &profile.Transfer}} {
+			*class.value, err = class.entry.parse()
+			if err != nil {
+				return fmt.Errorf("latency profile %s: %w", name, err)
+			}
+		}
+		loaded[name] = profile
+	}
+
+	latencyProfilesMu.Lock()
+	defer latencyProfilesMu.Unlock()
+
+	for name, profile := range loaded {
+		latencyProfiles[name] = profile
+	}
+	log.Info("Loaded ", len(loaded), " latency profiles from ", path)
+	return nil
+}
+
+// LatencyProfileNamed returns a built in or loaded profile
+func LatencyProfileNamed(name string) (LatencyProfile, error) {
+	latencyProfilesMu.RLock()
+	defer latencyProfilesMu.RUnlock()
+
+	profile, ok := latencyProfiles[name]
+	if !ok {
+		return LatencyProfile{}, fmt.Errorf("%w: %q", ErrUnknownLatencyProfile, name)
+	}
+	return profile, nil
+}
+
+// LatencyProfileNames lists every profile that can be named, sorted
+func LatencyProfileNames() []string {
+	latencyProfilesMu.RLock()
+	defer latencyProfilesMu.RUnlock()
+
+	var names = make([]string, 0, len(latencyProfiles))
+	for name := range latencyProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// latencyDB delays every call to inner by its profile, and fails some mutations
+type latencyDB struct {
+	inner   DatabaseInterface
+	profile LatencyProfile
+}
+
+// WithLatency wraps inner so it answers with profile's timing and failure rate
+func WithLatency(inner DatabaseInterface, profile LatencyProfile) DatabaseInterface {
+	return &latencyDB{inner: inner, profile: profile}
+}
+
+// simulateLatency sleeps for one sample of latency, returning early if ctx is done
+func simulateLatency(ctx context.Context, latency Latency) {
+	var delay time.Duration = latency.Base
+	if latency.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(latency.Jitter)))
+	}
+	if latency.SpikeRate > 0 && rand.Float64() < latency.SpikeRate {
+		delay += latency.Spike
+	}
+	if delay <= 0 {
+		return
+	}
+
+	var timer = time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+func (d *latencyDB) read() {
+	simulateLatency(context.Background(), d.profile.Read)
+}
+
+// mutate waits like a write or transfer and reports whether the call should fail
+func (d *latencyDB) mutate(ctx context.Context, latency Latency, operation string) bool {
+	simulateLatency(ctx, latency)
+	if d.profile.ErrorRate > 0 && rand.Float64() < d.profile.ErrorRate {
+		log.Warn("Simulated ", d.profile.Name, " failure for ", operation)
+		return true
+	}
+	return false
+}
+
+func (d *latencyDB) SetupDatabase() error {
+	return d.inner.SetupDatabase()
+}
+
+func (d *latencyDB) GetUserLoginDetails(username string) *LoginDetails {
+	d.read()
+	return d.inner.GetUserLoginDetails(username)
+}
+
+func (d *latencyDB) GetUserCoins(username string) (*CoinDetails, error) {
+	d.read()
+	return d.inner.GetUserCoins(username)
+}
+
+func (d *latencyDB) CreateUser(login LoginDetails) (*CoinDetails, error) {
+	if d.mutate(context.Background(), d.profile.Write, "create user") {
+		return nil, ErrSimulatedFailure
+	}
+	return d.inner.CreateUser(login)
+}
+
+func (d *latencyDB) DeleteUser(username string) error {
+	if d.mutate(context.Background(), d.profile.Write, "delete user") {
+		return ErrSimulatedFailure
+	}
+	return d.inner.DeleteUser(username)
+}
+
+func (d *latencyDB) AddUserCoins(username string, amount int64) (*CoinDetails, error) {
+	if d.mutate(context.Background(), d.profile.Write, "deposit") {
+		return nil, ErrSimulatedFailure
+	}
+	return d.inner.AddUserCoins(username, amount)
+}
+
+func (d *latencyDB) WithdrawUserCoins(username string, amount int64) (*CoinDetails, error) {
+	if d.mutate(context.Background(), d.profile.Write, "withdrawal") {
+		return nil, ErrSimulatedFailure
+	}
+	return d.inner.WithdrawUserCoins(username, amount)
+}
+
+func (d *latencyDB) SetUserFrozen(username string, frozen bool) (*CoinDetails, error) {
+	if d.mutate(context.Background(), d.profile.Write, "freeze") {
+		return nil, ErrSimulatedFailure
+	}
+	return d.inner.SetUserFrozen(username, frozen)
+}
+
+func (d *latencyDB) PlaceHold(hold Hold) (*CoinDetails, error) {
+	if d.mutate(context.Background(), d.profile.Write, "hold") {
+		return nil, ErrSimulatedFailure
+	}
+	return d.inner.PlaceHold(hold)
+}
+
+func (d *latencyDB) ReleaseHold(id string) (*CoinDetails, error) {
+	if d.mutate(context.Background(), d.profile.Write, "hold release") {
+		return nil, ErrSimulatedFailure
+	}
+	return d.inner.ReleaseHold(id)
+}
+
+// CaptureHold stops waiting when ctx is done, like TransferUserCoinsWithContext
+func (d *latencyDB) CaptureHold(ctx context.Context, id string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error) {
+	if d.mutate(ctx, d.profile.Transfer, "hold capture") {
+		return nil, nil, ErrSimulatedFailure
+	}
+	return d.inner.CaptureHold(ctx, id, to, amount)
+}
+
+func (d *latencyDB) GetHolds(account string) ([]Hold, error) {
+	d.read()
+	return d.inner.GetHolds(account)
+}
+
+func (d *latencyDB) TransferUserCoins(from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails) {
+	fromResult, toResult, err := d.TransferUserCoinsWithContext(context.Background(), from, to, amount)
+	if err != nil {
+		return nil, nil
+	}
+	return fromResult, toResult
+}
+
+// TransferUserCoinsWithContext stops waiting when ctx is done, inner then sees the
+// cancelled context and records the failure itself
+func (d *latencyDB) TransferUserCoinsWithContext(ctx context.Context, from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error) {
+	if d.mutate(ctx, d.profile.Transfer, "transfer") {
+		return nil, nil, ErrSimulatedFailure
+	}
+	return d.inner.TransferUserCoinsWithContext(ctx, from, to, amount)
+}
+
+func (d *latencyDB) GetTransactionHistory(username string) []TransactionLog {
+	d.read()
+	return d.inner.GetTransactionHistory(username)
+}
+
+func (d *latencyDB) GetTransactionHistoryPage(username string, before int64, limit int) []TransactionLog {
+	d.read()
+	return d.inner.GetTransactionHistoryPage(username, before, limit)
+}
+
+func (d *latencyDB) GetTransaction(id string) (TransactionLog, bool) {
+	d.read()
+	return d.inner.GetTransaction(id)
+}
+
+func (d *latencyDB) GetAllTransactions() []TransactionLog {
+	d.read()
+	return d.inner.GetAllTransactions()
+}
+
+func (d *latencyDB) GetAllUserCoins() []CoinDetails {
+	d.read()
+	return d.inner.GetAllUserCoins()
+}
+
+func (d *latencyDB) ListUserCoins(ctx context.Context, after string, limit int) ([]CoinDetails, error) {
+	simulateLatency(ctx, d.profile.Read)
+	return d.inner.ListUserCoins(ctx, after, limit)
+}
+
+func (d *latencyDB) TopUserCoins(usernames []string, limit int) []CoinDetails {
+	d.read()
+	return d.inner.TopUserCoins(usernames, limit)
+}
+
+func (d *latencyDB) CorrectUserCoins(username string, version int64, balance int64) (*CoinDetails, error) {
+	if d.mutate(context.Background(), d.profile.Write, "correction") {
+		return nil, ErrSimulatedFailure
+	}
+	return d.inner.CorrectUserCoins(username, version, balance)
+}
+
+func (d *latencyDB) AnonymizeUser(username string, pseudonym string) error {
+	if d.mutate(context.Background(), d.profile.Write, "anonymization") {
+		return ErrSimulatedFailure
+	}
+	return d.inner.AnonymizeUser(username, pseudonym)
+}
+
+func (d *latencyDB) StoreRefreshToken(token RefreshToken) error {
+	if d.mutate(context.Background(), d.profile.Write, "refresh token") {
+		return ErrSimulatedFailure
+	}
+	return d.inner.StoreRefreshToken(token)
+}
+
+func (d *latencyDB) RevokeRefreshToken(hash string) (*RefreshToken, error) {
+	if d.mutate(context.Background(), d.profile.Write, "refresh token revocation") {
+		return nil, ErrSimulatedFailure
+	}
+	return d.inner.RevokeRefreshToken(hash)
+}
+
+func (d *latencyDB) RevokeRefreshTokens(username string, family string) (int, error) {
+	if d.mutate(context.Background(), d.profile.Write, "refresh token revocation") {
+		return 0, ErrSimulatedFailure
+	}
+	return d.inner.RevokeRefreshTokens(username, family)
+}
+
+func (d *latencyDB) SetAccountOwner(owner AccountOwner) error {
+	if d.mutate(context.Background(), d.profile.Write, "account owner") {
+		return ErrSimulatedFailure
+	}
+	return d.inner.SetAccountOwner(owner)
+}
+
+func (d *latencyDB) GetAccountOwners(account string) ([]AccountOwner, error) {
+	d.read()
+	return d.inner.GetAccountOwners(account)
+}
+
+func (d *latencyDB) RemoveAccountOwner(account string, owner string) error {
+	if d.mutate(context.Background(), d.profile.Write, "account owner removal") {
+		return ErrSimulatedFailure
+	}
+	return d.inner.RemoveAccountOwner(account, owner)
+}
+
+func (d *latencyDB) PutRecord(record Record) error {
+	if d.mutate(context.Background(), d.profile.Write, "record") {
+		return ErrSimulatedFailure
+	}
+	return d.inner.PutRecord(record)
+}
+
+func (d *latencyDB) GetRecord(kind string, id string) (*Record, error) {
+	d.read()
+	return d.inner.GetRecord(kind, id)
+}
+
+func (d *latencyDB) ListRecords(kind string, account string) ([]Record, error) {
+	d.read()
+	return d.inner.ListRecords(kind, account)
+}
+
+func (d *latencyDB) DeleteRecord(kind string, id string) error {
+	if d.mutate(context.Background(), d.profile.Write, "record removal") {
+		return ErrSimulatedFailure
+	}
+	return d.inner.DeleteRecord(kind, id)
+}
+
+func (d *latencyDB) AppendEvent(event Event) (int64, error) {
+	if d.mutate(context.Background(), d.profile.Write, "event") {
+		return 0, ErrSimulatedFailure
+	}
+	return d.inner.AppendEvent(event)
+}
+
+func (d *latencyDB) ListEvents(filter EventFilter) ([]Event, error) {
+	d.read()
+	return d.inner.ListEvents(filter)
+}
+
+func (d *latencyDB) RewriteEvent(event Event) error {
+	if d.mutate(context.Background(), d.profile.Write, "event rewrite") {
+		return ErrSimulatedFailure
+	}
+	return d.inner.RewriteEvent(event)
+}
+
+func (d *latencyDB) GetPostings() []Posting {
+	d.read()
+	return d.inner.GetPostings()
+}
+
+func (d *latencyDB) GetSystemHealth() map[string]interface{} {
+	health := d.inner.GetSystemHealth()
+	if health != nil {
+		health["latency_profile"] = d.profile.Name
+	}
+	return health
+}
+
+// Subscribe is inner's, entries arrive when the delayed operation commits
+func (d *latencyDB) Subscribe(username string) (<-chan TransactionLog, func()) {
+	return Subscribe(d.inner, username)
+}
+
+// Capabilities are inner's, except the wrapper itself can't be snapshotted
+func (d *latencyDB) Capabilities() Capabilities {
+	capabilities := d.inner.Capabilities()
+	capabilities.Snapshots = false
+	return capabilities
+}
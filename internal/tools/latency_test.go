@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/config"
+)
+
+func TestLatencyProfiles(t *testing.T) {
+	newInner := func(t *testing.T) DatabaseInterface {
+		database, err := NewMemoryDatabase(nil, map[string]CoinDetails{
+			"aaron": {Username: "aaron", Coins: 100, Version: 1},
+			"bryan": {Username: "bryan", Coins: 100, Version: 1},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *database
+	}
+
+	t.Run("Delays_By_Class", func(t *testing.T) {
+		database := WithLatency(newInner(t), LatencyProfile{
+			Name:     "slow",
+			Read:     Latency{Base: 5 * time.Millisecond},
+			Transfer: Latency{Base: 20 * time.Millisecond},
+		})
+
+		start := time.Now()
+		database.GetUserCoins("aaron")
+		if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+			t.Errorf("Expected a read to take at least 5ms, took %v", elapsed)
+		}
+
+		start = time.Now()
+		database.TransferUserCoins("aaron", "bryan", 10)
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("Expected a transfer to take at least 20ms, took %v", elapsed)
+		}
+	})
+
+	t.Run("Cancelled_Transfer_Stops_Waiting", func(t *testing.T) {
+		database := WithLatency(newInner(t), LatencyProfile{Name: "stuck", Transfer: Latency{Base: time.Hour}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, _, err := database.TransferUserCoinsWithContext(ctx, "aaron", "bryan", 10)
+		if err == nil {
+			t.Error("Expected the cancelled transfer to fail")
+		}
+	})
+
+	t.Run("Failures_Change_Nothing", func(t *testing.T) {
+		inner := newInner(t)
+		database := WithLatency(inner, LatencyProfile{Name: "broken", ErrorRate: 1})
+
+		_, _, err := database.TransferUserCoinsWithContext(context.Background(), "aaron", "bryan", 10)
+		if !errors.Is(err, ErrSimulatedFailure) {
+			t.Errorf("Expected ErrSimulatedFailure, got %v", err)
+		}
+		if _, err := database.AddUserCoins("aaron", 10); !errors.Is(err, ErrSimulatedFailure) {
+			t.Errorf("Expected the deposit to fail with ErrSimulatedFailure, got %v", err)
+		}
+		if coins, _ := inner.GetUserCoins("aaron"); coins.Coins != 100 {
+			t.Errorf("Expected aaron to keep 100 coins, got %d", coins.Coins)
+		}
+		if len(inner.GetAllTransactions()) != 0 {
+			t.Error("Expected simulated failures to never reach storage")
+		}
+	})
+
+	t.Run("Loads_Profiles_From_File", func(t *testing.T) {
+		var path string = filepath.Join(t.TempDir(), "profiles.json")
+		os.WriteFile(path, []byte(`{"cockroach-like": {"read": {"base": "2ms"}, "transfer": {"base": "8ms", "spike_rate": 0.05, "spike": "100ms"}, "error_rate": 0.01}}`), 0600)
+
+		err := LoadLatencyProfiles(path)
+		if err != nil {
+			t.Fatalf("Failed to load profiles: %v", err)
+		}
+		profile, err := LatencyProfileNamed("cockroach-like")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile.Read.Base != 2*time.Millisecond || profile.Transfer.Spike != 100*time.Millisecond || profile.ErrorRate != 0.01 {
+			t.Errorf("Unexpected profile %+v", profile)
+		}
+
+		os.WriteFile(path, []byte(`{"bad": {"read": {"base": "-1ms"}}}`), 0600)
+		if LoadLatencyProfiles(path) == nil {
+			t.Error("Expected a negative duration to be rejected")
+		}
+	})
+
+	t.Run("NewDatabase_Uses_Configured_Profile", func(t *testing.T) {
+		var original config.Config = config.Get()
+		defer config.Set(original)
+
+		var cfg config.Config = original
+		cfg.MockLatencyProfile = "redis-like"
+		config.Set(cfg)
+
+		database, err := NewDatabase()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile := (*database).GetSystemHealth()["latency_profile"]; profile != "redis-like" {
+			t.Errorf("Expected the redis-like profile, got %v", profile)
+		}
+
+		cfg.MockLatencyProfile = "nosuch"
+		config.Set(cfg)
+		_, err = NewDatabase()
+		if !errors.Is(err, ErrUnknownLatencyProfile) {
+			t.Errorf("Expected ErrUnknownLatencyProfile, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS users (
+    username   VARCHAR(64)  NOT NULL PRIMARY KEY,
+    auth_token VARCHAR(255) NOT NULL,
+    role       VARCHAR(16)  NOT NULL DEFAULT 'user'
+) ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS balances (
+    username VARCHAR(64) NOT NULL PRIMARY KEY,
+    coins    BIGINT      NOT NULL DEFAULT 0,
+    version  BIGINT      NOT NULL DEFAULT 1,
+    CONSTRAINT balances_non_negative CHECK (coins >= 0),
+    FOREIGN KEY (username) REFERENCES users (username)
+) ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id         VARCHAR(32)  NOT NULL PRIMARY KEY,
+    seq        BIGINT       NOT NULL AUTO_INCREMENT UNIQUE,
+    type       VARCHAR(32)  NOT NULL,
+    from_user  VARCHAR(64)  NOT NULL DEFAULT '',
+    to_user    VARCHAR(64)  NOT NULL DEFAULT '',
+    amount     BIGINT       NOT NULL,
+    status     VARCHAR(64)  NOT NULL,
+    flow       VARCHAR(16)  NOT NULL,
+    created_at DATETIME(6)  NOT NULL,
+    INDEX transactions_from (from_user, seq),
+    INDEX transactions_to (to_user, seq)
+) ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS postings (
+    transaction_id VARCHAR(32) NOT NULL,
+    account        VARCHAR(64) NOT NULL,
+    amount         BIGINT      NOT NULL,
+    created_at     DATETIME(6) NOT NULL,
+    PRIMARY KEY (transaction_id, account),
+    FOREIGN KEY (transaction_id) REFERENCES transactions (id)
+) ENGINE=InnoDB;
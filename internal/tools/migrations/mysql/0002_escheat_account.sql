@@ -0,0 +1,3 @@
+-- Holds balances swept from dormant accounts. The empty token can never authenticate.
+INSERT IGNORE INTO users (username, auth_token, role) VALUES ('escheat', '', 'user');
+INSERT IGNORE INTO balances (username, coins, version) VALUES ('escheat', 0, 1);
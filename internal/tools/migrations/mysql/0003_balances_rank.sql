@@ -0,0 +1,2 @@
+-- Serves the leaderboard's top balances without a full table sort
+CREATE INDEX balances_rank ON balances (coins DESC, username);
@@ -0,0 +1,12 @@
+-- Refresh tokens by the SHA-256 of their secret. There is no foreign key to users, so
+-- an account's revoked tokens don't stop it being anonymized.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_hash CHAR(64)    NOT NULL PRIMARY KEY,
+    username   VARCHAR(64) NOT NULL,
+    family     VARCHAR(32) NOT NULL,
+    issued_at  DATETIME(6) NOT NULL,
+    expires_at DATETIME(6) NOT NULL,
+    revoked_at DATETIME(6) NULL,
+    INDEX refresh_tokens_user (username, family),
+    INDEX refresh_tokens_expiry (expires_at)
+) ENGINE=InnoDB;
@@ -0,0 +1,31 @@
+-- Per-account ledger sequence numbers. ledger_sequences holds the last number handed
+-- out to each account, transactions the number each party got for the entry.
+CREATE TABLE IF NOT EXISTS ledger_sequences (
+    username VARCHAR(64) NOT NULL PRIMARY KEY,
+    last_seq BIGINT      NOT NULL
+) ENGINE=InnoDB;
+
+ALTER TABLE transactions
+    ADD COLUMN from_seq BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN to_seq   BIGINT NOT NULL DEFAULT 0;
+
+-- Number the existing entries in log order. The statements may run on different pooled
+-- connections, so the numbering goes in a real table. A self-transfer is one entry in its
+-- account's ledger, so it is numbered once and both sides take that number.
+CREATE TABLE ledger_backfill AS
+SELECT seq, party, ROW_NUMBER() OVER (PARTITION BY party ORDER BY seq) AS n FROM (
+    SELECT seq, from_user AS party FROM transactions WHERE from_user <> ''
+    UNION ALL
+    SELECT seq, to_user FROM transactions WHERE to_user <> '' AND to_user <> from_user
+) parties;
+
+UPDATE transactions t JOIN ledger_backfill b ON b.seq = t.seq AND b.party = t.from_user
+SET t.from_seq = b.n;
+
+UPDATE transactions t JOIN ledger_backfill b ON b.seq = t.seq AND b.party = t.to_user
+SET t.to_seq = b.n;
+
+INSERT INTO ledger_sequences (username, last_seq)
+SELECT party, MAX(n) FROM ledger_backfill GROUP BY party;
+
+DROP TABLE ledger_backfill;
@@ -0,0 +1,12 @@
+-- Co-owners of joint accounts. Anonymizing either side deletes its balances or users
+-- row, which drops the co-ownership with it.
+CREATE TABLE IF NOT EXISTS account_owners (
+    account    VARCHAR(64) NOT NULL,
+    owner      VARCHAR(64) NOT NULL,
+    permission VARCHAR(16) NOT NULL,
+    added_at   DATETIME(6) NOT NULL,
+    PRIMARY KEY (account, owner),
+    INDEX account_owners_owner (owner),
+    FOREIGN KEY (account) REFERENCES balances (username) ON DELETE CASCADE,
+    FOREIGN KEY (owner) REFERENCES users (username) ON DELETE CASCADE
+) ENGINE=InnoDB;
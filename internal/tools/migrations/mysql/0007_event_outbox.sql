@@ -0,0 +1,10 @@
+-- Events waiting for the broker, see internal/publisher. Rows are deleted once
+-- delivered, so the table only grows while the broker is down.
+CREATE TABLE IF NOT EXISTS event_outbox (
+    seq        BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    event_id   CHAR(32)     NOT NULL,
+    topic      VARCHAR(255) NOT NULL,
+    event_key  VARCHAR(64)  NOT NULL,
+    payload    BLOB         NOT NULL,
+    created_at DATETIME(6)  NOT NULL
+) ENGINE=InnoDB;
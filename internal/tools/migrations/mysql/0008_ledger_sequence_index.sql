@@ -0,0 +1,3 @@
+-- Serves history pages, which seek on each party's own sequence number
+CREATE INDEX transactions_from_seq ON transactions (from_user, from_seq);
+CREATE INDEX transactions_to_seq ON transactions (to_user, to_seq);
@@ -0,0 +1,13 @@
+-- Whole-account freezes live with the balance, so a debit checks it under the same lock
+ALTER TABLE balances ADD COLUMN frozen BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Features' own documents, such as freezes with their history and profiles
+CREATE TABLE IF NOT EXISTS records (
+    kind       VARCHAR(32)  NOT NULL,
+    id         VARCHAR(128) NOT NULL,
+    account    VARCHAR(64)  NOT NULL DEFAULT '',
+    data       MEDIUMBLOB   NOT NULL,
+    updated_at DATETIME(6)  NOT NULL,
+    PRIMARY KEY (kind, id),
+    INDEX records_account (kind, account, id)
+) ENGINE=InnoDB;
@@ -0,0 +1,12 @@
+-- Held is the sum of the account's holds, kept on the balance so a debit checks what
+-- is available under the same lock
+ALTER TABLE balances ADD COLUMN held BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS holds (
+    id         VARCHAR(128) NOT NULL PRIMARY KEY,
+    account    VARCHAR(64)  NOT NULL,
+    kind       VARCHAR(32)  NOT NULL,
+    amount     BIGINT       NOT NULL,
+    created_at DATETIME(6)  NOT NULL,
+    INDEX holds_account (account, created_at, id)
+) ENGINE=InnoDB;
@@ -0,0 +1,10 @@
+-- Domain events, see internal/events. Rows are only updated to erase personal data.
+CREATE TABLE IF NOT EXISTS events (
+    id             BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    type           VARCHAR(64)  NOT NULL,
+    schema_version INT          NOT NULL,
+    subject        VARCHAR(64)  NOT NULL,
+    data           MEDIUMBLOB   NOT NULL,
+    occurred_at    DATETIME(6)  NOT NULL,
+    INDEX events_subject (subject, type, id)
+) ENGINE=InnoDB;
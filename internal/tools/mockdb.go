@@ -5,18 +5,62 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/bryantjandra/goapi/internal/buildinfo"
 	log "github.com/sirupsen/logrus"
 )
 
 type mockDB struct {
-	mu sync.RWMutex
+	// Accounts and the lock guarding them. NewDatabase shares the package-level tables
+	// (and mockMu) between every connection, NewMemoryDatabase gets its own.
+	mu     *sync.RWMutex
+	logins map[string]LoginDetails
+	coins  map[string]CoinDetails
 
-	// Audit trail
+	// Refresh tokens by hash, expired ones are dropped as new ones are stored
+	refreshTokens map[string]RefreshToken
+
+	// Co-owners of joint accounts, by account then owner
+	owners map[string]map[string]AccountOwner
+
+	// Features' records, by kind then ID
+	records map[string]map[string]Record
+
+	// Holds by ID, each balance's Held is the sum of its account's
+	holds map[string]Hold
+
+	// Domain events, under their own lock so recording one doesn't wait for the accounts
+	events *eventLog
+
+	// Other packages' state, only for a database from NewMemoryDatabase
+	scope *scope
+
+	// Audit trail and the double-entry postings of successful transactions. Readers
+	// share logMu, so copying out a history doesn't hold up other reads.
 	transactionLogs []TransactionLog
-	logMu           sync.Mutex
+	postings        []Posting
+	logMu           sync.RWMutex
+
+	// Index into transactionLogs, the positions of the entries naming each account,
+	// oldest first. Positions count from the first entry ever logged, logBase is the
+	// position of transactionLogs[0] once older entries have been trimmed.
+	userLogs map[string][]int64
+	logBase  int64
+
+	// Position of each entry in transactionLogs by ID, counted like userLogs
+	logIDs map[string]int64
+
+	// Last ledger sequence number handed out per account, kept when old logs are trimmed
+	sequences map[string]int64
+
+	// Channels subscribed to each account's new ledger entries, guarded by logMu
+	subscribers map[string]map[chan TransactionLog]struct{}
 
 	// Circuit breaker for resilience
 	healthStatus map[string]bool
@@ -27,30 +71,73 @@ type mockDB struct {
 	startTime      time.Time
 }
 
-// Mock login details database
-var mockLoginDetails = map[string]LoginDetails{
-	"aaron": {
-		AuthToken: "1",
-		Username:  "aaron",
-	},
-	"bryan": {
-		AuthToken: "2",
-		Username:  "bryan",
-	},
-}
-
-// Mock coin balance database with versioning
-var mockCoinDetails = map[string]CoinDetails{
-	"aaron": {
-		Coins:    1000,
-		Username: "aaron",
-		Version:  1,
-	},
-	"bryan": {
-		Coins:    1000,
-		Username: "bryan",
-		Version:  1,
-	},
+var mockMu sync.RWMutex
+
+// Mock login and coin balance tables (with versioning) shared by NewDatabase connections
+var mockLoginDetails, mockCoinDetails = DemoAccounts()
+
+var mockRefreshTokens = map[string]RefreshToken{}
+
+var mockAccountOwners = map[string]map[string]AccountOwner{}
+
+var mockRecords = map[string]map[string]Record{}
+
+var mockHolds = map[string]Hold{}
+
+var mockEvents = &eventLog{}
+
+// eventLog is the mock's event table, ordered by ID
+type eventLog struct {
+	mu     sync.RWMutex
+	events []Event
+	lastID int64
+}
+
+// NewMemoryDatabase returns an in-memory database isolated from every other instance,
+// seeded with copies of the given accounts. Balances start at the seeded values.
+func NewMemoryDatabase(logins map[string]LoginDetails, coins map[string]CoinDetails) (*DatabaseInterface, error) {
+	var database = &mockDB{
+		mu:            &sync.RWMutex{},
+		logins:        make(map[string]LoginDetails, len(logins)),
+		coins:         make(map[string]CoinDetails, len(coins)),
+		refreshTokens: make(map[string]RefreshToken),
+		owners:        make(map[string]map[string]AccountOwner),
+		records:       make(map[string]map[string]Record),
+		holds:         make(map[string]Hold),
+		events:        &eventLog{},
+		scope:         newScope(),
+	}
+	for username, details := range logins {
+		database.logins[username] = details
+	}
+	for username, details := range coins {
+		database.coins[username] = details
+	}
+
+	var db DatabaseInterface = database
+	var err error = db.SetupDatabase()
+	if err != nil {
+		return nil, err
+	}
+	return &db, nil
+}
+
+// DemoAccounts returns copies of the accounts the shared mock database starts with
+func DemoAccounts() (map[string]LoginDetails, map[string]CoinDetails) {
+	var logins = map[string]LoginDetails{
+		"aaron":   {AuthToken: "1", Username: "aaron", Role: RoleUser},
+		"bryan":   {AuthToken: "2", Username: "bryan", Role: RoleUser},
+		"admin":   {AuthToken: "admin", Username: "admin", Role: RoleAdmin},
+		"auditor": {AuthToken: "auditor", Username: "auditor", Role: RoleAuditor},
+	}
+	var coins = map[string]CoinDetails{
+		"aaron": {Coins: 1000, Username: "aaron", Version: 1},
+		"bryan": {Coins: 1000, Username: "bryan", Version: 1},
+
+		// Holds balances swept from dormant accounts, it has no login
+		"escheat": {Coins: 0, Username: "escheat", Version: 1},
+	}
+	return logins, coins
 }
 
 func (d *mockDB) SetupDatabase() error {
@@ -61,6 +148,11 @@ func (d *mockDB) SetupDatabase() error {
 	}
 	d.startTime = time.Now()
 	d.transactionLogs = make([]TransactionLog, 0)
+	d.userLogs = make(map[string][]int64)
+	d.logIDs = make(map[string]int64)
+	d.logBase = 0
+	d.sequences = make(map[string]int64)
+	d.subscribers = make(map[string]map[chan TransactionLog]struct{})
 
 	log.Info("Financial database system initialized")
 	return nil
@@ -73,8 +165,8 @@ func generateTransactionID() string {
 	return hex.EncodeToString(bytes)
 }
 
-// Audit logging
-func (d *mockDB) logTransaction(txType, from, to string, amount int64, status string) {
+// Audit logging, successful transactions pass their postings so both are recorded together
+func (d *mockDB) logTransaction(txType, from, to string, amount int64, status string, postings ...Posting) string {
 	d.logMu.Lock()
 	defer d.logMu.Unlock()
 
@@ -86,14 +178,147 @@ func (d *mockDB) logTransaction(txType, from, to string, amount int64, status st
 		Amount:    amount,
 		Timestamp: time.Now(),
 		Status:    status,
+		Flow:      FlowOf(txType),
+	}
+	txLog.FromSequence = d.nextSequence(from)
+	txLog.ToSequence = txLog.FromSequence
+	if to != from {
+		txLog.ToSequence = d.nextSequence(to)
 	}
 
+	var position int64 = d.logBase + int64(len(d.transactionLogs))
 	d.transactionLogs = append(d.transactionLogs, txLog)
+	d.logIDs[txLog.ID] = position
+	d.index(from, position)
+	if to != from {
+		d.index(to, position)
+	}
+	d.notify(from, txLog)
+	if to != from {
+		d.notify(to, txLog)
+	}
+
+	for _, posting := range postings {
+		posting.TransactionID = txLog.ID
+		posting.Timestamp = txLog.Timestamp
+		d.postings = append(d.postings, posting)
+	}
 
 	// Keep only last 1000 transactions (in real systems, this goes to persistent storage)
 	if len(d.transactionLogs) > 1000 {
+		// Postings are appended in log order, so the dropped ones are at the front
+		keep := 0
+		for i, old := range d.transactionLogs[:len(d.transactionLogs)-1000] {
+			for keep < len(d.postings) && d.postings[keep].TransactionID == old.ID {
+				keep++
+			}
+			delete(d.logIDs, old.ID)
+			d.unindex(old.From, d.logBase+int64(i))
+			if old.To != old.From {
+				d.unindex(old.To, d.logBase+int64(i))
+			}
+		}
+		d.logBase += int64(len(d.transactionLogs) - 1000)
 		d.transactionLogs = d.transactionLogs[len(d.transactionLogs)-1000:]
+		d.postings = d.postings[keep:]
 	}
+	return txLog.ID
+}
+
+// index adds the entry at position to username's entries, the caller holds logMu
+func (d *mockDB) index(username string, position int64) {
+	if username == "" {
+		return
+	}
+	d.userLogs[username] = append(d.userLogs[username], position)
+}
+
+// unindex drops a trimmed entry, always username's oldest, the caller holds logMu
+func (d *mockDB) unindex(username string, position int64) {
+	var positions []int64 = d.userLogs[username]
+	if len(positions) == 0 || positions[0] != position {
+		return
+	}
+	if len(positions) == 1 {
+		delete(d.userLogs, username)
+		return
+	}
+	d.userLogs[username] = positions[1:]
+}
+
+// reindex rebuilds userLogs and logIDs after entries were renamed or replaced, the
+// caller holds logMu
+func (d *mockDB) reindex() {
+	d.userLogs = make(map[string][]int64)
+	d.logIDs = make(map[string]int64, len(d.transactionLogs))
+	for i, txLog := range d.transactionLogs {
+		d.logIDs[txLog.ID] = d.logBase + int64(i)
+		d.index(txLog.From, d.logBase+int64(i))
+		if txLog.To != txLog.From {
+			d.index(txLog.To, d.logBase+int64(i))
+		}
+	}
+}
+
+// nextSequence takes username's next ledger sequence number, the caller holds logMu
+func (d *mockDB) nextSequence(username string) int64 {
+	if username == "" {
+		return 0
+	}
+	d.sequences[username]++
+	return d.sequences[username]
+}
+
+// Entries a subscriber can fall behind by before it is dropped
+const subscriberBuffer = 64
+
+// Subscribe returns username's ledger entries as logTransaction adds them
+func (d *mockDB) Subscribe(username string) (<-chan TransactionLog, func()) {
+	var updates = make(chan TransactionLog, subscriberBuffer)
+
+	d.logMu.Lock()
+	if d.subscribers[username] == nil {
+		d.subscribers[username] = make(map[chan TransactionLog]struct{})
+	}
+	d.subscribers[username][updates] = struct{}{}
+	d.logMu.Unlock()
+
+	var once sync.Once
+	return updates, func() {
+		once.Do(func() {
+			d.logMu.Lock()
+			defer d.logMu.Unlock()
+			d.unsubscribe(username, updates)
+		})
+	}
+}
+
+// notify sends txLog to username's subscribers without waiting, dropping any that are
+// full. The caller holds logMu.
+func (d *mockDB) notify(username string, txLog TransactionLog) {
+	if username == "" {
+		return
+	}
+	for updates := range d.subscribers[username] {
+		select {
+		case updates <- txLog:
+		default:
+			log.Warn("Dropping a ledger subscriber for ", username, ", it fell ", subscriberBuffer, " entries behind")
+			d.unsubscribe(username, updates)
+		}
+	}
+}
+
+// unsubscribe closes updates unless it was already dropped, the caller holds logMu
+func (d *mockDB) unsubscribe(username string, updates chan TransactionLog) {
+	if _, ok := d.subscribers[username][updates]; !ok {
+		return
+	}
+	delete(d.subscribers[username], updates)
+	if len(d.subscribers[username]) == 0 {
+		delete(d.subscribers, username)
+	}
+	close(updates)
 }
 
 func (d *mockDB) GetUserLoginDetails(username string) *LoginDetails {
@@ -102,7 +327,7 @@ func (d *mockDB) GetUserLoginDetails(username string) *LoginDetails {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
-	clientData, ok := mockLoginDetails[username]
+	clientData, ok := d.logins[username]
 	if !ok {
 		return nil
 	}
@@ -110,70 +335,564 @@ func (d *mockDB) GetUserLoginDetails(username string) *LoginDetails {
 	return &clientData
 }
 
-func (d *mockDB) GetUserCoins(username string) *CoinDetails {
+func (d *mockDB) GetUserCoins(username string) (*CoinDetails, error) {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
-	clientData, ok := mockCoinDetails[username]
+	clientData, ok := d.coins[username]
 	if !ok {
-		return nil
+		return nil, ErrUserNotFound
 	}
 
-	return &clientData
+	return &clientData, nil
 }
 
-func (d *mockDB) AddUserCoins(username string, amount int64) *CoinDetails {
+func (d *mockDB) CreateUser(login LoginDetails) (*CoinDetails, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.logins[login.Username]; ok {
+		return nil, ErrUserExists
+	}
+
+	var details = CoinDetails{Username: login.Username, Version: 1}
+	d.logins[login.Username] = login
+	d.coins[login.Username] = details
+	return &details, nil
+}
+
+func (d *mockDB) DeleteUser(username string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	details, ok := d.coins[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if details.Coins != 0 {
+		return ErrAccountNotEmpty
+	}
+
+	delete(d.coins, username)
+	delete(d.logins, username)
+	delete(d.owners, username)
+	for _, owners := range d.owners {
+		delete(owners, username)
+	}
+	for id, hold := range d.holds {
+		if hold.Account == username {
+			delete(d.holds, id)
+		}
+	}
+	return nil
+}
+
+func (d *mockDB) AddUserCoins(username string, amount int64) (*CoinDetails, error) {
 	if amount <= 0 {
 		d.logTransaction("DEPOSIT", "", username, amount, "FAILED_INVALID_AMOUNT")
-		return nil
+		return nil, errRejected{"FAILED_INVALID_AMOUNT"}
 	}
 
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	clientData, ok := mockCoinDetails[username]
+	clientData, ok := d.coins[username]
 	if !ok {
 		d.logTransaction("DEPOSIT", "", username, amount, "FAILED_USER_NOT_FOUND")
-		return nil
+		return nil, errRejected{"FAILED_USER_NOT_FOUND"}
+	}
+
+	// Total supply must stay within int64, a huge deposit would wrap the balance negative
+	if amount > math.MaxInt64-d.totalCoins() {
+		d.logTransaction("DEPOSIT", "", username, amount, "FAILED_OVERFLOW")
+		return nil, errRejected{"FAILED_OVERFLOW"}
 	}
 
 	// Optimistic locking simulation
 	clientData.Coins = clientData.Coins + amount
 	clientData.Version++
-	mockCoinDetails[username] = clientData
+	d.coins[username] = clientData
 
-	d.logTransaction("DEPOSIT", "", username, amount, "SUCCESS")
+	d.logTransaction("DEPOSIT", "", username, amount, "SUCCESS",
+		Posting{Account: MintAccount, Amount: -amount},
+		Posting{Account: username, Amount: amount},
+	)
 
-	return &clientData
+	return &clientData, nil
+}
+
+func (d *mockDB) CorrectUserCoins(username string, version int64, balance int64) (*CoinDetails, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	clientData, ok := d.coins[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if clientData.Version != version {
+		return nil, ErrStaleVersion
+	}
+
+	from, to, delta := correctionParties(username, balance-clientData.Coins)
+	clientData.Coins = balance
+	clientData.Version++
+	d.coins[username] = clientData
+
+	d.logTransaction(CorrectionType, from, to, delta, "SUCCESS")
+
+	return &clientData, nil
+}
+
+func (d *mockDB) AnonymizeUser(username string, pseudonym string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	details, ok := d.coins[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if _, taken := d.coins[pseudonym]; taken {
+		return ErrUserExists
+	}
+	if _, taken := d.logins[pseudonym]; taken {
+		return ErrUserExists
+	}
+
+	details.Username = pseudonym
+	d.coins[pseudonym] = details
+	delete(d.coins, username)
+	delete(d.logins, username)
+
+	// Co-ownership names the person, it isn't carried over to the pseudonym
+	delete(d.owners, username)
+	for _, owners := range d.owners {
+		delete(owners, username)
+	}
+	for id, hold := range d.holds {
+		if hold.Account == username {
+			hold.Account = pseudonym
+			d.holds[id] = hold
+		}
+	}
+
+	d.logMu.Lock()
+	defer d.logMu.Unlock()
+
+	for i := range d.transactionLogs {
+		if d.transactionLogs[i].From == username {
+			d.transactionLogs[i].From = pseudonym
+		}
+		if d.transactionLogs[i].To == username {
+			d.transactionLogs[i].To = pseudonym
+		}
+	}
+	for i := range d.postings {
+		if d.postings[i].Account == username {
+			d.postings[i].Account = pseudonym
+		}
+	}
+	if sequence, ok := d.sequences[username]; ok {
+		d.sequences[pseudonym] = sequence
+		delete(d.sequences, username)
+	}
+	d.reindex()
+	return nil
 }
 
-func (d *mockDB) WithdrawUserCoins(username string, amount int64) *CoinDetails {
+func (d *mockDB) StoreRefreshToken(token RefreshToken) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var now time.Time = time.Now()
+	for hash, stored := range d.refreshTokens {
+		if stored.ExpiresAt.Before(now) {
+			delete(d.refreshTokens, hash)
+		}
+	}
+	d.refreshTokens[token.Hash] = token
+	return nil
+}
+
+func (d *mockDB) RevokeRefreshToken(hash string) (*RefreshToken, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	token, ok := d.refreshTokens[hash]
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if !token.RevokedAt.IsZero() {
+		return &token, ErrRefreshTokenRevoked
+	}
+
+	var revoked RefreshToken = token
+	revoked.RevokedAt = time.Now()
+	d.refreshTokens[hash] = revoked
+	return &token, nil
+}
+
+func (d *mockDB) RevokeRefreshTokens(username string, family string) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var count int
+	for hash, token := range d.refreshTokens {
+		if token.Username != username || !token.RevokedAt.IsZero() || (family != "" && token.Family != family) {
+			continue
+		}
+		token.RevokedAt = time.Now()
+		d.refreshTokens[hash] = token
+		count++
+	}
+	return count, nil
+}
+
+func (d *mockDB) SetAccountOwner(owner AccountOwner) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.coins[owner.Account]; !ok {
+		return ErrUserNotFound
+	}
+	if _, ok := d.logins[owner.Owner]; !ok {
+		return ErrUserNotFound
+	}
+	if d.owners[owner.Account] == nil {
+		d.owners[owner.Account] = map[string]AccountOwner{}
+	}
+	d.owners[owner.Account][owner.Owner] = owner
+	return nil
+}
+
+func (d *mockDB) GetAccountOwners(account string) ([]AccountOwner, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var owners = []AccountOwner{}
+	for _, owner := range d.owners[account] {
+		owners = append(owners, owner)
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i].Owner < owners[j].Owner })
+	return owners, nil
+}
+
+func (d *mockDB) RemoveAccountOwner(account string, owner string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.owners[account][owner]; !ok {
+		return ErrOwnerNotFound
+	}
+	delete(d.owners[account], owner)
+	return nil
+}
+
+// SetUserFrozen keeps the flag with the balance, so the debits read it under the same lock
+func (d *mockDB) SetUserFrozen(username string, frozen bool) (*CoinDetails, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	details, ok := d.coins[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	details.Frozen = frozen
+	d.coins[username] = details
+	return &details, nil
+}
+
+// PlaceHold checks and changes Held under the lock the debits take
+func (d *mockDB) PlaceHold(hold Hold) (*CoinDetails, error) {
+	if hold.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	details, ok := d.coins[hold.Account]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	previous, replacing := d.holds[hold.ID]
+	if replacing && previous.Account != hold.Account {
+		return nil, ErrHoldNotFound
+	}
+	if hold.Kind != HoldFreeze {
+		if details.Frozen {
+			return nil, ErrAccountFrozen
+		}
+		if details.Coins-details.Held+previous.Amount < hold.Amount {
+			return nil, ErrInsufficientFunds
+		}
+	}
+
+	if replacing {
+		hold.CreatedAt = previous.CreatedAt
+	} else if hold.CreatedAt.IsZero() {
+		hold.CreatedAt = time.Now()
+	}
+	details.Held += hold.Amount - previous.Amount
+	d.coins[hold.Account] = details
+	d.holds[hold.ID] = hold
+	return &details, nil
+}
+
+func (d *mockDB) ReleaseHold(id string) (*CoinDetails, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hold, ok := d.holds[id]
+	if !ok {
+		return nil, ErrHoldNotFound
+	}
+	delete(d.holds, id)
+
+	details := d.coins[hold.Account]
+	details.Held -= hold.Amount
+	d.coins[hold.Account] = details
+	return &details, nil
+}
+
+// CaptureHold releases the hold and moves the coins under the lock the debits take
+func (d *mockDB) CaptureHold(ctx context.Context, id string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error) {
+	var txType, credited = "TRANSFER", to
+	if to == "" {
+		txType, credited = "WITHDRAWAL", BurnAccount
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hold, ok := d.holds[id]
+	if !ok {
+		return nil, nil, ErrHoldNotFound
+	}
+	var from string = hold.Account
+
+	select {
+	case <-ctx.Done():
+		d.logTransaction(txType, from, to, amount, "FAILED_CONTEXT_CANCELLED")
+		return nil, nil, ctx.Err()
+	default:
+	}
+
+	if amount <= 0 || amount > hold.Amount {
+		d.logTransaction(txType, from, to, amount, "FAILED_INVALID_AMOUNT")
+		return nil, nil, errRejected{"FAILED_INVALID_AMOUNT"}
+	}
+	if from == to {
+		d.logTransaction(txType, from, to, amount, "FAILED_SELF_TRANSFER")
+		return nil, nil, errRejected{"FAILED_SELF_TRANSFER"}
+	}
+
+	fromData := d.coins[from]
+	toData, ok := d.coins[to]
+	if to != "" && !ok {
+		d.logTransaction(txType, from, to, amount, "FAILED_TO_USER_NOT_FOUND")
+		return nil, nil, errRejected{"FAILED_TO_USER_NOT_FOUND"}
+	}
+	if fromData.Frozen {
+		d.logTransaction(txType, from, to, amount, "FAILED_ACCOUNT_FROZEN")
+		return nil, nil, errRejected{"FAILED_ACCOUNT_FROZEN"}
+	}
+	if fromData.Coins-(fromData.Held-hold.Amount) < amount {
+		d.logTransaction(txType, from, to, amount, "FAILED_INSUFFICIENT_FUNDS")
+		return nil, nil, errRejected{"FAILED_INSUFFICIENT_FUNDS"}
+	}
+
+	delete(d.holds, id)
+	fromData.Held -= hold.Amount
+	fromData.Coins -= amount
+	fromData.Version++
+	d.coins[from] = fromData
+	if to != "" {
+		toData.Coins += amount
+		toData.Version++
+		d.coins[to] = toData
+	}
+
+	var transactionID string = d.logTransaction(txType, from, to, amount, "SUCCESS",
+		Posting{Account: from, Amount: -amount},
+		Posting{Account: credited, Amount: amount},
+	)
+
+	fromData.TransactionID = transactionID
+	if to == "" {
+		return &fromData, nil, nil
+	}
+	toData.TransactionID = transactionID
+	return &fromData, &toData, nil
+}
+
+func (d *mockDB) GetHolds(account string) ([]Hold, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var holds = []Hold{}
+	for _, hold := range d.holds {
+		if account == "" || hold.Account == account {
+			holds = append(holds, hold)
+		}
+	}
+	sortHolds(holds)
+	return holds, nil
+}
+
+func (d *mockDB) PutRecord(record Record) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.records[record.Kind] == nil {
+		d.records[record.Kind] = map[string]Record{}
+	}
+	record.Data = slices.Clone(record.Data)
+	d.records[record.Kind][record.ID] = record
+	return nil
+}
+
+func (d *mockDB) GetRecord(kind string, id string) (*Record, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	record, ok := d.records[kind][id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	record.Data = slices.Clone(record.Data)
+	return &record, nil
+}
+
+func (d *mockDB) ListRecords(kind string, account string) ([]Record, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var records = []Record{}
+	for _, record := range d.records[kind] {
+		if account == "" || record.Account == account {
+			record.Data = slices.Clone(record.Data)
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records, nil
+}
+
+func (d *mockDB) DeleteRecord(kind string, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.records[kind][id]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(d.records[kind], id)
+	return nil
+}
+
+func (d *mockDB) AppendEvent(event Event) (int64, error) {
+	var table *eventLog = d.events
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	if event.ID == 0 {
+		event.ID = table.lastID + 1
+	}
+	var i int = sort.Search(len(table.events), func(i int) bool { return table.events[i].ID >= event.ID })
+	if i < len(table.events) && table.events[i].ID == event.ID {
+		return 0, fmt.Errorf("event %d already exists", event.ID)
+	}
+	event.Data = slices.Clone(event.Data)
+	table.events = slices.Insert(table.events, i, event)
+	table.lastID = max(table.lastID, event.ID)
+	return event.ID, nil
+}
+
+// ListEvents scans the log from the first event after filter.AfterID
+func (d *mockDB) ListEvents(filter EventFilter) ([]Event, error) {
+	var table *eventLog = d.events
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+
+	var events = []Event{}
+	var start int = sort.Search(len(table.events), func(i int) bool { return table.events[i].ID > filter.AfterID })
+	for _, event := range table.events[start:] {
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+		if filter.Matches(event) {
+			event.Data = slices.Clone(event.Data)
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (d *mockDB) RewriteEvent(event Event) error {
+	var table *eventLog = d.events
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	var i int = sort.Search(len(table.events), func(i int) bool { return table.events[i].ID >= event.ID })
+	if i == len(table.events) || table.events[i].ID != event.ID {
+		return ErrEventNotFound
+	}
+	table.events[i].Subject = event.Subject
+	table.events[i].Data = slices.Clone(event.Data)
+	return nil
+}
+
+// correctionParties puts the account on the side a correction of delta moves it
+func correctionParties(username string, delta int64) (from string, to string, amount int64) {
+	if delta < 0 {
+		return username, "", -delta
+	}
+	return "", username, delta
+}
+
+// totalCoins sums every balance, callers hold d.mu
+func (d *mockDB) totalCoins() int64 {
+	var total int64
+	for _, details := range d.coins {
+		total += details.Coins
+	}
+	return total
+}
+
+func (d *mockDB) WithdrawUserCoins(username string, amount int64) (*CoinDetails, error) {
 	if amount <= 0 {
 		d.logTransaction("WITHDRAWAL", username, "", amount, "FAILED_INVALID_AMOUNT")
-		return nil
+		return nil, errRejected{"FAILED_INVALID_AMOUNT"}
 	}
 
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	clientData, ok := mockCoinDetails[username]
+	clientData, ok := d.coins[username]
 	if !ok {
 		d.logTransaction("WITHDRAWAL", username, "", amount, "FAILED_USER_NOT_FOUND")
-		return nil
+		return nil, errRejected{"FAILED_USER_NOT_FOUND"}
+	}
+
+	if clientData.Frozen {
+		d.logTransaction("WITHDRAWAL", username, "", amount, "FAILED_ACCOUNT_FROZEN")
+		return nil, errRejected{"FAILED_ACCOUNT_FROZEN"}
 	}
 
-	if amount > clientData.Coins {
+	if amount > clientData.Coins-clientData.Held {
 		d.logTransaction("WITHDRAWAL", username, "", amount, "FAILED_INSUFFICIENT_FUNDS")
-		return nil
+		return nil, errRejected{"FAILED_INSUFFICIENT_FUNDS"}
 	}
 
 	clientData.Coins = clientData.Coins - amount
 	clientData.Version++
-	mockCoinDetails[username] = clientData
+	d.coins[username] = clientData
 
-	d.logTransaction("WITHDRAWAL", username, "", amount, "SUCCESS")
+	d.logTransaction("WITHDRAWAL", username, "", amount, "SUCCESS",
+		Posting{Account: username, Amount: -amount},
+		Posting{Account: BurnAccount, Amount: amount},
+	)
 
-	return &clientData
+	return &clientData, nil
 }
 
 func (d *mockDB) TransferUserCoins(from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails) {
@@ -196,63 +915,179 @@ func (d *mockDB) TransferUserCoinsWithContext(ctx context.Context, from string,
 
 	if amount <= 0 {
 		d.logTransaction("TRANSFER", from, to, amount, "FAILED_INVALID_AMOUNT")
-		return nil, nil, fmt.Errorf("invalid amount")
+		return nil, nil, errRejected{"FAILED_INVALID_AMOUNT"}
 	}
 
 	if from == to {
 		d.logTransaction("TRANSFER", from, to, amount, "FAILED_SELF_TRANSFER")
-		return nil, nil, fmt.Errorf("self-transfer not allowed")
+		return nil, nil, errRejected{"FAILED_SELF_TRANSFER"}
 	}
 
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	fromData, ok := mockCoinDetails[from]
+	fromData, ok := d.coins[from]
 	if !ok {
 		d.logTransaction("TRANSFER", from, to, amount, "FAILED_FROM_USER_NOT_FOUND")
-		return nil, nil, fmt.Errorf("sender not found")
+		return nil, nil, errRejected{"FAILED_FROM_USER_NOT_FOUND"}
 	}
 
-	toData, okTwo := mockCoinDetails[to]
+	toData, okTwo := d.coins[to]
 	if !okTwo {
 		d.logTransaction("TRANSFER", from, to, amount, "FAILED_TO_USER_NOT_FOUND")
-		return nil, nil, fmt.Errorf("recipient not found")
+		return nil, nil, errRejected{"FAILED_TO_USER_NOT_FOUND"}
 	}
 
-	if fromData.Coins < amount {
+	if fromData.Frozen {
+		d.logTransaction("TRANSFER", from, to, amount, "FAILED_ACCOUNT_FROZEN")
+		return nil, nil, errRejected{"FAILED_ACCOUNT_FROZEN"}
+	}
+
+	if fromData.Coins-fromData.Held < amount {
 		d.logTransaction("TRANSFER", from, to, amount, "FAILED_INSUFFICIENT_FUNDS")
-		return nil, nil, fmt.Errorf("insufficient funds")
+		return nil, nil, errRejected{"FAILED_INSUFFICIENT_FUNDS"}
 	}
 
 	// Atomic transfer with version updates
 	fromData.Coins = fromData.Coins - amount
 	fromData.Version++
-	mockCoinDetails[from] = fromData
+	d.coins[from] = fromData
 
 	toData.Coins = toData.Coins + amount
 	toData.Version++
-	mockCoinDetails[to] = toData
+	d.coins[to] = toData
 
-	d.logTransaction("TRANSFER", from, to, amount, "SUCCESS")
+	var id string = d.logTransaction("TRANSFER", from, to, amount, "SUCCESS",
+		Posting{Account: from, Amount: -amount},
+		Posting{Account: to, Amount: amount},
+	)
 
+	fromData.TransactionID, toData.TransactionID = id, id
 	return &fromData, &toData, nil
 }
 
 // Financial system monitoring
+// GetTransactionHistory reads username's entries from the index, without scanning the log
 func (d *mockDB) GetTransactionHistory(username string) []TransactionLog {
-	d.logMu.Lock()
-	defer d.logMu.Unlock()
+	d.logMu.RLock()
+	defer d.logMu.RUnlock()
 
-	var userTxs []TransactionLog
-	for _, tx := range d.transactionLogs {
-		if tx.From == username || tx.To == username {
-			userTxs = append(userTxs, tx)
-		}
+	var positions []int64 = d.userLogs[username]
+	if len(positions) == 0 {
+		return nil
 	}
 
+	var userTxs = make([]TransactionLog, len(positions))
+	for i, position := range positions {
+		userTxs[i] = d.transactionLogs[position-d.logBase]
+	}
 	return userTxs
 }
 
+func (d *mockDB) GetTransaction(id string) (TransactionLog, bool) {
+	d.logMu.RLock()
+	defer d.logMu.RUnlock()
+
+	position, ok := d.logIDs[id]
+	if !ok {
+		return TransactionLog{}, false
+	}
+	return d.transactionLogs[position-d.logBase], true
+}
+
+// GetTransactionHistoryPage seeks to before in username's index, so a page costs its
+// own entries however long the ledger is
+func (d *mockDB) GetTransactionHistoryPage(username string, before int64, limit int) []TransactionLog {
+	d.logMu.RLock()
+	defer d.logMu.RUnlock()
+
+	var positions []int64 = d.userLogs[username]
+
+	// Sequence numbers go up with positions, older entries come first
+	var end int = len(positions)
+	if before > 0 {
+		end = sort.Search(len(positions), func(i int) bool {
+			return d.transactionLogs[positions[i]-d.logBase].SequenceFor(username) >= before
+		})
+	}
+
+	var page = make([]TransactionLog, 0, max(min(limit, end), 0))
+	for i := end - 1; i >= 0 && len(page) < limit; i-- {
+		page = append(page, d.transactionLogs[positions[i]-d.logBase])
+	}
+	return page
+}
+
+// Every balance, by username
+func (d *mockDB) GetAllUserCoins() []CoinDetails {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var balances = make([]CoinDetails, 0, len(d.coins))
+	for _, details := range d.coins {
+		balances = append(balances, details)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Username < balances[j].Username
+	})
+	return balances
+}
+
+// ListUserCoins sorts the usernames for every page, the memory backend has no index
+func (d *mockDB) ListUserCoins(ctx context.Context, after string, limit int) ([]CoinDetails, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var usernames []string
+	for username := range d.coins {
+		if username > after {
+			usernames = append(usernames, username)
+		}
+	}
+	sort.Strings(usernames)
+	usernames = usernames[:min(max(limit, 0), len(usernames))]
+
+	var page = make([]CoinDetails, 0, len(usernames))
+	for _, username := range usernames {
+		page = append(page, d.coins[username])
+	}
+	return page, nil
+}
+
+func (d *mockDB) TopUserCoins(usernames []string, limit int) []CoinDetails {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return topBalances(usernames, limit, func(username string) (CoinDetails, bool) {
+		details, ok := d.coins[username]
+		return details, ok
+	})
+}
+
+// Whole ledger, oldest first
+func (d *mockDB) GetAllTransactions() []TransactionLog {
+	d.logMu.RLock()
+	defer d.logMu.RUnlock()
+
+	var txs = make([]TransactionLog, len(d.transactionLogs))
+	copy(txs, d.transactionLogs)
+	return txs
+}
+
+// Double-entry postings, oldest first
+func (d *mockDB) GetPostings() []Posting {
+	d.logMu.RLock()
+	defer d.logMu.RUnlock()
+
+	var postings = make([]Posting, len(d.postings))
+	copy(postings, d.postings)
+	return postings
+}
+
 // System health monitoring
 func (d *mockDB) GetSystemHealth() map[string]interface{} {
 	d.healthMu.RLock()
@@ -266,6 +1101,115 @@ func (d *mockDB) GetSystemHealth() map[string]interface{} {
 		"operation_count": d.operationCount,
 		"components":      d.healthStatus,
 		"last_check":      time.Now(),
-		"version":         "1.0.0",
+		"version":         buildinfo.Get().Version,
+		"build":           buildinfo.Get().Fields(),
 	}
 }
+
+// Capabilities of the in-memory database, which streams its ledger and which Snapshot
+// and Restore can copy but a restart empties
+func (d *mockDB) Capabilities() Capabilities {
+	return Capabilities{Streaming: true, Snapshots: true}
+}
+
+// Snapshot is a copy of an in-memory database's accounts, refresh tokens, co-owners,
+// records, holds and ledger, taken with Snapshot and put back with Restore. Events
+// aren't included, restoring the ledger doesn't undo what happened.
+type Snapshot struct {
+	logins          map[string]LoginDetails
+	coins           map[string]CoinDetails
+	refreshTokens   map[string]RefreshToken
+	owners          map[string]map[string]AccountOwner
+	records         map[string]map[string]Record
+	holds           map[string]Hold
+	transactionLogs []TransactionLog
+	postings        []Posting
+	sequences       map[string]int64
+}
+
+// Snapshotter is implemented by the in-memory database, so tests can prepare a state
+// once and go back to it before each case
+type Snapshotter interface {
+	Snapshot() Snapshot
+	Restore(snapshot Snapshot)
+}
+
+// Snapshot copies the database's current state. Health and operation counters aren't
+// included.
+func (d *mockDB) Snapshot() Snapshot {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	d.logMu.RLock()
+	defer d.logMu.RUnlock()
+
+	return Snapshot{
+		logins:          maps.Clone(d.logins),
+		coins:           maps.Clone(d.coins),
+		refreshTokens:   maps.Clone(d.refreshTokens),
+		owners:          cloneOwners(d.owners),
+		records:         cloneRecords(d.records),
+		holds:           maps.Clone(d.holds),
+		transactionLogs: slices.Clone(d.transactionLogs),
+		postings:        slices.Clone(d.postings),
+		sequences:       maps.Clone(d.sequences),
+	}
+}
+
+// Restore puts the database back to snapshot, which may come from another in-memory
+// database. The tables are refilled in place, so NewDatabase connections sharing them
+// all see the restored state.
+func (d *mockDB) Restore(snapshot Snapshot) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logMu.Lock()
+	defer d.logMu.Unlock()
+
+	refill(d.logins, snapshot.logins)
+	refill(d.coins, snapshot.coins)
+	refill(d.refreshTokens, snapshot.refreshTokens)
+	refill(d.owners, cloneOwners(snapshot.owners))
+	refill(d.records, cloneRecords(snapshot.records))
+	refill(d.holds, snapshot.holds)
+	d.transactionLogs = slices.Clone(snapshot.transactionLogs)
+	d.postings = slices.Clone(snapshot.postings)
+	d.sequences = maps.Clone(snapshot.sequences)
+	if d.sequences == nil {
+		d.sequences = make(map[string]int64)
+	}
+	d.reindex()
+}
+
+// cloneOwners copies the co-owner table, the inner maps too
+func cloneOwners(owners map[string]map[string]AccountOwner) map[string]map[string]AccountOwner {
+	var clone = make(map[string]map[string]AccountOwner, len(owners))
+	for account, byOwner := range owners {
+		clone[account] = maps.Clone(byOwner)
+	}
+	return clone
+}
+
+// cloneRecords copies the records table, the inner maps too. Data is never changed in
+// place, so it is shared.
+func cloneRecords(records map[string]map[string]Record) map[string]map[string]Record {
+	var clone = make(map[string]map[string]Record, len(records))
+	for kind, byID := range records {
+		clone[kind] = maps.Clone(byID)
+	}
+	return clone
+}
+
+// sortHolds orders holds oldest first, by ID when they were placed together
+func sortHolds(holds []Hold) {
+	sort.Slice(holds, func(i, j int) bool {
+		if !holds[i].CreatedAt.Equal(holds[j].CreatedAt) {
+			return holds[i].CreatedAt.Before(holds[j].CreatedAt)
+		}
+		return holds[i].ID < holds[j].ID
+	})
+}
+
+// refill replaces the contents of table with a copy of source
+func refill[K comparable, V any](table map[K]V, source map[K]V) {
+	clear(table)
+	maps.Copy(table, source)
+}
@@ -0,0 +1,1210 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/buildinfo"
+	"github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+)
+
+//go:embed migrations/mysql/*.sql
+var mysqlMigrations embed.FS
+
+// MySQL error numbers worth retrying: the transaction was rolled back, not failed
+const (
+	mysqlLockWaitTimeout = 1205
+	mysqlDeadlock        = 1213
+	mysqlDuplicateEntry  = 1062
+	mysqlNoReferencedRow = 1452
+
+	mysqlMaxAttempts = 3
+)
+
+// One pool per process, NewDatabase is called per request
+var (
+	mysqlMu   sync.Mutex
+	mysqlPool = map[string]*sql.DB{}
+)
+
+type mysqlDB struct {
+	dsn string
+	db  *sql.DB
+}
+
+func newMySQLDatabase(dsn string) DatabaseInterface {
+	return &mysqlDB{dsn: dsn}
+}
+
+func (d *mysqlDB) SetupDatabase() error {
+	mysqlMu.Lock()
+	defer mysqlMu.Unlock()
+
+	if pool, ok := mysqlPool[d.dsn]; ok {
+		d.db = pool
+		return nil
+	}
+
+	cfg, err := mysql.ParseDSN(d.dsn)
+	if err != nil {
+		return fmt.Errorf("invalid mysql dsn: %w", err)
+	}
+	// DATETIME columns come back as time.Time in UTC
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+
+	pool, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return err
+	}
+
+	err = migrateMySQL(pool)
+	if err != nil {
+		pool.Close()
+		return err
+	}
+
+	mysqlPool[d.dsn] = pool
+	d.db = pool
+
+	log.Info("MySQL database initialized")
+	return nil
+}
+
+// MySQLPool returns the pool SetupDatabase opened for dsn, for tables kept beside the
+// ledger such as the event outbox
+func MySQLPool(dsn string) (*sql.DB, bool) {
+	mysqlMu.Lock()
+	defer mysqlMu.Unlock()
+
+	pool, ok := mysqlPool[dsn]
+	return pool, ok
+}
+
+// migrateMySQL applies every embedded migration not yet recorded in schema_migrations
+func migrateMySQL(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    VARCHAR(64) NOT NULL PRIMARY KEY,
+		applied_at DATETIME(6) NOT NULL
+	) ENGINE=InnoDB`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	entries, err := mysqlMigrations.ReadDir("migrations/mysql")
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var applied int
+		err = db.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version = ?", name).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		contents, err := mysqlMigrations.ReadFile("migrations/mysql/" + name)
+		if err != nil {
+			return err
+		}
+
+		// MySQL commits DDL implicitly, so each statement runs on its own
+		for _, statement := range splitStatements(string(contents)) {
+			_, err = db.Exec(statement)
+			if err != nil {
+				return fmt.Errorf("migration %s failed: %w", name, err)
+			}
+		}
+
+		_, err = db.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", name, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		log.Info("Applied migration ", name)
+	}
+
+	return nil
+}
+
+// splitStatements splits a migration file on semicolons that end a line
+func splitStatements(contents string) []string {
+	var statements []string
+	for _, statement := range strings.Split(contents, ";\n") {
+		statement = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(statement), ";"))
+		if statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+func isRetryable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlDeadlock || mysqlErr.Number == mysqlLockWaitTimeout
+	}
+	return false
+}
+
+// errRejected carries the status logged for a business rule failure, it is not retried
+type errRejected struct {
+	status string
+}
+
+func (e errRejected) Error() string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(e.status, "FAILED_"), "_", " "))
+}
+
+// Unwrap is the sentinel for the status, so errors.Is(err, ErrInsufficientFunds) works
+func (e errRejected) Unwrap() error {
+	return statusErrors[e.status]
+}
+
+// withTx runs fn in a REPEATABLE READ transaction, retrying deadlocks.
+//
+// Under REPEATABLE READ a plain SELECT reads the transaction's snapshot, which can be
+// older than the row another transfer just committed. fn must read balances it is
+// going to change with SELECT ... FOR UPDATE, which always sees the latest version.
+func (d *mysqlDB) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	var err error
+	for attempt := 1; attempt <= mysqlMaxAttempts; attempt++ {
+		err = d.runTx(ctx, fn)
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+		log.Warn("Retrying MySQL transaction after attempt ", attempt, ": ", err)
+	}
+	return err
+}
+
+func (d *mysqlDB) runTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockBalances reads and locks balances in username order, so two transfers between the
+// same pair always lock in the same order and can't deadlock each other
+func lockBalances(tx *sql.Tx, usernames ...string) (map[string]CoinDetails, error) {
+	sorted := append([]string(nil), usernames...)
+	sort.Strings(sorted)
+
+	var result = map[string]CoinDetails{}
+	for _, username := range sorted {
+		var details = CoinDetails{Username: username}
+		err := tx.QueryRow("SELECT coins, version, frozen, held FROM balances WHERE username = ? FOR UPDATE", username).Scan(&details.Coins, &details.Version, &details.Frozen, &details.Held)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[username] = details
+	}
+	return result, nil
+}
+
+func updateBalance(tx *sql.Tx, details *CoinDetails, delta int64) error {
+	details.Coins += delta
+	details.Version++
+	_, err := tx.Exec("UPDATE balances SET coins = ?, version = ? WHERE username = ?", details.Coins, details.Version, details.Username)
+	return err
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// nextSequence takes username's next ledger sequence number. The row stays locked until
+// the transaction ends, so entries are numbered in the order they are logged.
+func nextSequence(db execer, username string) (int64, error) {
+	result, err := db.Exec("INSERT INTO ledger_sequences (username, last_seq) VALUES (?, LAST_INSERT_ID(1)) ON DUPLICATE KEY UPDATE last_seq = LAST_INSERT_ID(last_seq + 1)", username)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (d *mysqlDB) insertTransaction(db execer, txType, from, to string, amount int64, status string, postings ...Posting) error {
+	return d.insertTransactionAs(db, generateTransactionID(), txType, from, to, amount, status, postings...)
+}
+
+// insertTransactionAs is insertTransaction for a transaction whose ID the caller has
+// to know
+func (d *mysqlDB) insertTransactionAs(db execer, id, txType, from, to string, amount int64, status string, postings ...Posting) error {
+	var now = time.Now().UTC()
+
+	// Sequence rows are locked in username order like balances, so entries logged
+	// outside the balance transaction can't deadlock with it
+	var parties = []string{from, to}
+	sort.Strings(parties)
+	var sequences = map[string]int64{}
+	for _, party := range parties {
+		if _, taken := sequences[party]; taken || party == "" {
+			continue
+		}
+		sequence, err := nextSequence(db, party)
+		if err != nil {
+			return err
+		}
+		sequences[party] = sequence
+	}
+
+	_, err := db.Exec("INSERT INTO transactions (id, type, from_user, to_user, amount, status, flow, created_at, from_seq, to_seq) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		id, txType, from, to, amount, status, FlowOf(txType), now, sequences[from], sequences[to])
+	if err != nil {
+		return err
+	}
+
+	for _, posting := range postings {
+		_, err = db.Exec("INSERT INTO postings (transaction_id, account, amount, created_at) VALUES (?, ?, ?, ?)",
+			id, posting.Account, posting.Amount, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logFailure records a rejected operation outside the rolled back transaction
+func (d *mysqlDB) logFailure(txType, from, to string, amount int64, err error) {
+	var status = "FAILED_STORAGE_ERROR"
+	var rejected errRejected
+	if errors.As(err, &rejected) {
+		status = rejected.status
+	}
+
+	// In a transaction of its own, so a sequence number is never taken without the entry
+	logErr := d.withTx(context.Background(), func(tx *sql.Tx) error {
+		return d.insertTransaction(tx, txType, from, to, amount, status)
+	})
+	if logErr != nil {
+		log.Error("Failed to record failed ", txType, ": ", logErr)
+	}
+}
+
+func (d *mysqlDB) GetUserLoginDetails(username string) *LoginDetails {
+	var details = LoginDetails{Username: username}
+
+	// Anonymized accounts keep a users row for the balance but have no login
+	err := d.db.QueryRow("SELECT auth_token, role FROM users WHERE username = ? AND auth_token <> ''", username).Scan(&details.AuthToken, &details.Role)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Error("Failed to read login details: ", err)
+		}
+		return nil
+	}
+	return &details
+}
+
+func (d *mysqlDB) GetUserCoins(username string) (*CoinDetails, error) {
+	var details = CoinDetails{Username: username}
+	err := d.db.QueryRow("SELECT coins, version, frozen, held FROM balances WHERE username = ?", username).Scan(&details.Coins, &details.Version, &details.Frozen, &details.Held)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		log.Error("Failed to read balance: ", err)
+		return nil, err
+	}
+	return &details, nil
+}
+
+func (d *mysqlDB) CreateUser(login LoginDetails) (*CoinDetails, error) {
+	var details = CoinDetails{Username: login.Username, Version: 1}
+	err := d.withTx(context.Background(), func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO users (username, auth_token, role) VALUES (?, ?, ?)", login.Username, login.AuthToken, login.Role)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO balances (username, coins, version) VALUES (?, 0, 1)", login.Username)
+		return err
+	})
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		return nil, ErrUserExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+func (d *mysqlDB) DeleteUser(username string) error {
+	return d.withTx(context.Background(), func(tx *sql.Tx) error {
+		balances, err := lockBalances(tx, username)
+		if err != nil {
+			return err
+		}
+		details, ok := balances[username]
+		if !ok {
+			return ErrUserNotFound
+		}
+		if details.Coins != 0 {
+			return ErrAccountNotEmpty
+		}
+
+		// Co-ownership goes with the users row
+		_, err = tx.Exec("DELETE FROM holds WHERE account = ?", username)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM balances WHERE username = ?", username)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM users WHERE username = ?", username)
+		return err
+	})
+}
+
+func (d *mysqlDB) AddUserCoins(username string, amount int64) (*CoinDetails, error) {
+	var result CoinDetails
+	err := d.withTx(context.Background(), func(tx *sql.Tx) error {
+		if amount <= 0 {
+			return errRejected{"FAILED_INVALID_AMOUNT"}
+		}
+
+		balances, err := lockBalances(tx, username)
+		if err != nil {
+			return err
+		}
+		details, ok := balances[username]
+		if !ok {
+			return errRejected{"FAILED_USER_NOT_FOUND"}
+		}
+
+		err = updateBalance(tx, &details, amount)
+		if err != nil {
+			return err
+		}
+		result = details
+
+		return d.insertTransaction(tx, "DEPOSIT", "", username, amount, "SUCCESS",
+			Posting{Account: MintAccount, Amount: -amount},
+			Posting{Account: username, Amount: amount},
+		)
+	})
+	if err != nil {
+		d.logFailure("DEPOSIT", "", username, amount, err)
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (d *mysqlDB) WithdrawUserCoins(username string, amount int64) (*CoinDetails, error) {
+	var result CoinDetails
+	err := d.withTx(context.Background(), func(tx *sql.Tx) error {
+		if amount <= 0 {
+			return errRejected{"FAILED_INVALID_AMOUNT"}
+		}
+
+		balances, err := lockBalances(tx, username)
+		if err != nil {
+			return err
+		}
+		details, ok := balances[username]
+		if !ok {
+			return errRejected{"FAILED_USER_NOT_FOUND"}
+		}
+		if details.Frozen {
+			return errRejected{"FAILED_ACCOUNT_FROZEN"}
+		}
+		if amount > details.Coins-details.Held {
+			return errRejected{"FAILED_INSUFFICIENT_FUNDS"}
+		}
+
+		err = updateBalance(tx, &details, -amount)
+		if err != nil {
+			return err
+		}
+		result = details
+
+		return d.insertTransaction(tx, "WITHDRAWAL", username, "", amount, "SUCCESS",
+			Posting{Account: username, Amount: -amount},
+			Posting{Account: BurnAccount, Amount: amount},
+		)
+	})
+	if err != nil {
+		d.logFailure("WITHDRAWAL", username, "", amount, err)
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (d *mysqlDB) TransferUserCoins(from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails) {
+	fromResult, toResult, err := d.TransferUserCoinsWithContext(context.Background(), from, to, amount)
+	if err != nil {
+		return nil, nil
+	}
+	return fromResult, toResult
+}
+
+func (d *mysqlDB) TransferUserCoinsWithContext(ctx context.Context, from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error) {
+	var fromResult, toResult CoinDetails
+	var id string = generateTransactionID()
+	err = d.withTx(ctx, func(tx *sql.Tx) error {
+		if amount <= 0 {
+			return errRejected{"FAILED_INVALID_AMOUNT"}
+		}
+		if from == to {
+			return errRejected{"FAILED_SELF_TRANSFER"}
+		}
+
+		balances, err := lockBalances(tx, from, to)
+		if err != nil {
+			return err
+		}
+		fromData, ok := balances[from]
+		if !ok {
+			return errRejected{"FAILED_FROM_USER_NOT_FOUND"}
+		}
+		toData, ok := balances[to]
+		if !ok {
+			return errRejected{"FAILED_TO_USER_NOT_FOUND"}
+		}
+		if fromData.Frozen {
+			return errRejected{"FAILED_ACCOUNT_FROZEN"}
+		}
+		if fromData.Coins-fromData.Held < amount {
+			return errRejected{"FAILED_INSUFFICIENT_FUNDS"}
+		}
+
+		err = updateBalance(tx, &fromData, -amount)
+		if err != nil {
+			return err
+		}
+		err = updateBalance(tx, &toData, amount)
+		if err != nil {
+			return err
+		}
+		fromResult, toResult = fromData, toData
+		fromResult.TransactionID, toResult.TransactionID = id, id
+
+		return d.insertTransactionAs(tx, id, "TRANSFER", from, to, amount, "SUCCESS",
+			Posting{Account: from, Amount: -amount},
+			Posting{Account: to, Amount: amount},
+		)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			err = errRejected{"FAILED_CONTEXT_CANCELLED"}
+		}
+		d.logFailure("TRANSFER", from, to, amount, err)
+		return nil, nil, err
+	}
+	return &fromResult, &toResult, nil
+}
+
+func (d *mysqlDB) SetUserFrozen(username string, frozen bool) (*CoinDetails, error) {
+	var result CoinDetails
+	err := d.withTx(context.Background(), func(tx *sql.Tx) error {
+		balances, err := lockBalances(tx, username)
+		if err != nil {
+			return err
+		}
+		details, ok := balances[username]
+		if !ok {
+			return ErrUserNotFound
+		}
+
+		details.Frozen = frozen
+		_, err = tx.Exec("UPDATE balances SET frozen = ? WHERE username = ?", frozen, username)
+		result = details
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PlaceHold locks the balance like a debit, so the two can't both spend the same coins
+func (d *mysqlDB) PlaceHold(hold Hold) (*CoinDetails, error) {
+	if hold.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if hold.CreatedAt.IsZero() {
+		hold.CreatedAt = time.Now()
+	}
+
+	var result CoinDetails
+	err := d.withTx(context.Background(), func(tx *sql.Tx) error {
+		balances, err := lockBalances(tx, hold.Account)
+		if err != nil {
+			return err
+		}
+		details, ok := balances[hold.Account]
+		if !ok {
+			return ErrUserNotFound
+		}
+
+		var account string
+		var previous int64
+		err = tx.QueryRow("SELECT account, amount FROM holds WHERE id = ? FOR UPDATE", hold.ID).Scan(&account, &previous)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && account != hold.Account {
+			return ErrHoldNotFound
+		}
+		if hold.Kind != HoldFreeze {
+			if details.Frozen {
+				return ErrAccountFrozen
+			}
+			if details.Coins-details.Held+previous < hold.Amount {
+				return ErrInsufficientFunds
+			}
+		}
+
+		details.Held += hold.Amount - previous
+		_, err = tx.Exec("UPDATE balances SET held = ? WHERE username = ?", details.Held, hold.Account)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO holds (id, account, kind, amount, created_at) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE kind = VALUES(kind), amount = VALUES(amount)",
+			hold.ID, hold.Account, hold.Kind, hold.Amount, hold.CreatedAt.UTC())
+		result = details
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (d *mysqlDB) ReleaseHold(id string) (*CoinDetails, error) {
+	var result CoinDetails
+	err := d.withTx(context.Background(), func(tx *sql.Tx) error {
+		// The hold is read first to find the balance, then again under its lock
+		var account string
+		err := tx.QueryRow("SELECT account FROM holds WHERE id = ?", id).Scan(&account)
+		if err == sql.ErrNoRows {
+			return ErrHoldNotFound
+		}
+		if err != nil {
+			return err
+		}
+		balances, err := lockBalances(tx, account)
+		if err != nil {
+			return err
+		}
+
+		var amount int64
+		err = tx.QueryRow("SELECT amount FROM holds WHERE id = ? AND account = ? FOR UPDATE", id, account).Scan(&amount)
+		if err == sql.ErrNoRows {
+			return ErrHoldNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var details = balances[account]
+		details.Held -= amount
+		_, err = tx.Exec("UPDATE balances SET held = ? WHERE username = ?", details.Held, account)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM holds WHERE id = ?", id)
+		result = details
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CaptureHold releases the hold and moves the coins in one transaction, locking the
+// balances before the hold like ReleaseHold
+func (d *mysqlDB) CaptureHold(ctx context.Context, id string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error) {
+	var txType, credited = "TRANSFER", to
+	if to == "" {
+		txType, credited = "WITHDRAWAL", BurnAccount
+	}
+
+	var from string
+	var fromResult, toResult CoinDetails
+	var transactionID string = generateTransactionID()
+	err = d.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRow("SELECT account FROM holds WHERE id = ?", id).Scan(&from)
+		if err == sql.ErrNoRows {
+			return ErrHoldNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if amount <= 0 {
+			return errRejected{"FAILED_INVALID_AMOUNT"}
+		}
+		if from == to {
+			return errRejected{"FAILED_SELF_TRANSFER"}
+		}
+
+		var parties = []string{from}
+		if to != "" {
+			parties = append(parties, to)
+		}
+		balances, err := lockBalances(tx, parties...)
+		if err != nil {
+			return err
+		}
+
+		var held int64
+		err = tx.QueryRow("SELECT amount FROM holds WHERE id = ? AND account = ? FOR UPDATE", id, from).Scan(&held)
+		if err == sql.ErrNoRows {
+			return ErrHoldNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if amount > held {
+			return errRejected{"FAILED_INVALID_AMOUNT"}
+		}
+
+		fromData := balances[from]
+		toData, ok := balances[to]
+		if to != "" && !ok {
+			return errRejected{"FAILED_TO_USER_NOT_FOUND"}
+		}
+		if fromData.Frozen {
+			return errRejected{"FAILED_ACCOUNT_FROZEN"}
+		}
+		if fromData.Coins-(fromData.Held-held) < amount {
+			return errRejected{"FAILED_INSUFFICIENT_FUNDS"}
+		}
+
+		fromData.Held -= held
+		_, err = tx.Exec("UPDATE balances SET held = ? WHERE username = ?", fromData.Held, from)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM holds WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		err = updateBalance(tx, &fromData, -amount)
+		if err != nil {
+			return err
+		}
+		if to != "" {
+			err = updateBalance(tx, &toData, amount)
+			if err != nil {
+				return err
+			}
+		}
+		fromResult, toResult = fromData, toData
+		fromResult.TransactionID, toResult.TransactionID = transactionID, transactionID
+
+		return d.insertTransactionAs(tx, transactionID, txType, from, to, amount, "SUCCESS",
+			Posting{Account: from, Amount: -amount},
+			Posting{Account: credited, Amount: amount},
+		)
+	})
+	if errors.Is(err, ErrHoldNotFound) {
+		return nil, nil, err
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = errRejected{"FAILED_CONTEXT_CANCELLED"}
+		}
+		d.logFailure(txType, from, to, amount, err)
+		return nil, nil, err
+	}
+	if to == "" {
+		return &fromResult, nil, nil
+	}
+	return &fromResult, &toResult, nil
+}
+
+// GetHolds is served by the holds_account index when account is given
+func (d *mysqlDB) GetHolds(account string) ([]Hold, error) {
+	rows, err := d.db.Query("SELECT id, account, kind, amount, created_at FROM holds WHERE (? = '' OR account = ?) ORDER BY created_at, id", account, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds = []Hold{}
+	for rows.Next() {
+		var hold Hold
+		err = rows.Scan(&hold.ID, &hold.Account, &hold.Kind, &hold.Amount, &hold.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+func (d *mysqlDB) queryTransactions(query string, args ...interface{}) []TransactionLog {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		log.Error("Failed to read transactions: ", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var txs []TransactionLog
+	for rows.Next() {
+		var tx TransactionLog
+		err = rows.Scan(&tx.ID, &tx.Type, &tx.From, &tx.To, &tx.Amount, &tx.Status, &tx.Flow, &tx.Timestamp, &tx.FromSequence, &tx.ToSequence)
+		if err != nil {
+			log.Error("Failed to read transaction: ", err)
+			return nil
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+const transactionColumns = "id, type, from_user, to_user, amount, status, flow, created_at, from_seq, to_seq"
+
+func (d *mysqlDB) GetTransactionHistory(username string) []TransactionLog {
+	return d.queryTransactions("SELECT "+transactionColumns+" FROM transactions WHERE from_user = ? OR to_user = ? ORDER BY seq", username, username)
+}
+
+// GetTransactionHistoryPage seeks each side of the entries on its sequence index, so
+// only the page is read. A self-transfer is numbered once, it is taken from the sender.
+func (d *mysqlDB) GetTransactionHistoryPage(username string, before int64, limit int) []TransactionLog {
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+	return d.queryTransactions("SELECT "+transactionColumns+" FROM ("+
+		"(SELECT "+transactionColumns+", from_seq AS user_seq FROM transactions WHERE from_user = ? AND from_seq < ? ORDER BY from_seq DESC LIMIT ?)"+
+		" UNION ALL "+
+		"(SELECT "+transactionColumns+", to_seq FROM transactions WHERE to_user = ? AND from_user <> ? AND to_seq < ? ORDER BY to_seq DESC LIMIT ?)"+
+		") page ORDER BY user_seq DESC LIMIT ?",
+		username, before, max(limit, 0), username, username, before, max(limit, 0), max(limit, 0))
+}
+
+func (d *mysqlDB) GetTransaction(id string) (TransactionLog, bool) {
+	var found []TransactionLog = d.queryTransactions("SELECT "+transactionColumns+" FROM transactions WHERE id = ?", id)
+	if len(found) == 0 {
+		return TransactionLog{}, false
+	}
+	return found[0], true
+}
+
+func (d *mysqlDB) GetAllTransactions() []TransactionLog {
+	return d.queryTransactions("SELECT " + transactionColumns + " FROM transactions ORDER BY seq")
+}
+
+func (d *mysqlDB) queryBalances(query string, args ...interface{}) []CoinDetails {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		log.Error("Failed to read balances: ", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var balances []CoinDetails
+	for rows.Next() {
+		var details CoinDetails
+		err = rows.Scan(&details.Username, &details.Coins, &details.Version, &details.Frozen, &details.Held)
+		if err != nil {
+			log.Error("Failed to read balance: ", err)
+			return nil
+		}
+		balances = append(balances, details)
+	}
+	return balances
+}
+
+func (d *mysqlDB) GetAllUserCoins() []CoinDetails {
+	return d.queryBalances("SELECT username, coins, version, frozen, held FROM balances ORDER BY username")
+}
+
+// ListUserCoins seeks on the balances primary key, so a page deep into millions of
+// accounts costs the same as the first
+func (d *mysqlDB) ListUserCoins(ctx context.Context, after string, limit int) ([]CoinDetails, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT username, coins, version, frozen, held FROM balances WHERE username > ? ORDER BY username LIMIT ?", after, max(limit, 0))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var page = []CoinDetails{}
+	for rows.Next() {
+		var details CoinDetails
+		err = rows.Scan(&details.Username, &details.Coins, &details.Version, &details.Frozen, &details.Held)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, details)
+	}
+	return page, rows.Err()
+}
+
+// TopUserCoins is served by the balances_rank index rather than sorting every row
+func (d *mysqlDB) TopUserCoins(usernames []string, limit int) []CoinDetails {
+	if len(usernames) == 0 || limit <= 0 {
+		return []CoinDetails{}
+	}
+
+	var args = make([]interface{}, 0, len(usernames)+1)
+	for _, username := range usernames {
+		args = append(args, username)
+	}
+	args = append(args, limit)
+
+	var placeholders string = strings.TrimSuffix(strings.Repeat("?,", len(usernames)), ",")
+	return d.queryBalances("SELECT username, coins, version, frozen, held FROM balances WHERE username IN ("+
+		placeholders+") ORDER BY coins DESC, username LIMIT ?", args...)
+}
+
+func (d *mysqlDB) CorrectUserCoins(username string, version int64, balance int64) (*CoinDetails, error) {
+	var result CoinDetails
+	err := d.withTx(context.Background(), func(tx *sql.Tx) error {
+		balances, err := lockBalances(tx, username)
+		if err != nil {
+			return err
+		}
+		details, ok := balances[username]
+		if !ok {
+			return ErrUserNotFound
+		}
+		if details.Version != version {
+			return ErrStaleVersion
+		}
+
+		from, to, delta := correctionParties(username, balance-details.Coins)
+		err = updateBalance(tx, &details, balance-details.Coins)
+		if err != nil {
+			return err
+		}
+		result = details
+
+		return d.insertTransaction(tx, CorrectionType, from, to, delta, "SUCCESS")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AnonymizeUser moves the balance to a new users row without a token, since the
+// foreign key stops the username being updated in place
+func (d *mysqlDB) AnonymizeUser(username string, pseudonym string) error {
+	err := d.withTx(context.Background(), func(tx *sql.Tx) error {
+		balances, err := lockBalances(tx, username)
+		if err != nil {
+			return err
+		}
+		details, ok := balances[username]
+		if !ok {
+			return ErrUserNotFound
+		}
+
+		var statements = []struct {
+			query string
+			args  []interface{}
+		}{
+			{"INSERT INTO users (username, auth_token, role) SELECT ?, '', role FROM users WHERE username = ?", []interface{}{pseudonym, username}},
+			{"INSERT INTO balances (username, coins, version, frozen, held) VALUES (?, ?, ?, ?, ?)", []interface{}{pseudonym, details.Coins, details.Version, details.Frozen, details.Held}},
+			{"DELETE FROM balances WHERE username = ?", []interface{}{username}},
+			{"DELETE FROM users WHERE username = ?", []interface{}{username}},
+			{"UPDATE transactions SET from_user = ? WHERE from_user = ?", []interface{}{pseudonym, username}},
+			{"UPDATE transactions SET to_user = ? WHERE to_user = ?", []interface{}{pseudonym, username}},
+			{"UPDATE postings SET account = ? WHERE account = ?", []interface{}{pseudonym, username}},
+			{"UPDATE ledger_sequences SET username = ? WHERE username = ?", []interface{}{pseudonym, username}},
+			{"UPDATE holds SET account = ? WHERE account = ?", []interface{}{pseudonym, username}},
+		}
+		for _, statement := range statements {
+			_, err = tx.Exec(statement.query, statement.args...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		return ErrUserExists
+	}
+	return err
+}
+
+// StoreRefreshToken also deletes tokens that have expired, they can't be used or reused
+func (d *mysqlDB) StoreRefreshToken(token RefreshToken) error {
+	_, err := d.db.Exec("DELETE FROM refresh_tokens WHERE expires_at < ?", time.Now().UTC())
+	if err != nil {
+		log.Warn("Failed to delete expired refresh tokens: ", err)
+	}
+
+	_, err = d.db.Exec("INSERT INTO refresh_tokens (token_hash, username, family, issued_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		token.Hash, token.Username, token.Family, token.IssuedAt.UTC(), token.ExpiresAt.UTC())
+	return err
+}
+
+func (d *mysqlDB) RevokeRefreshToken(hash string) (*RefreshToken, error) {
+	var token RefreshToken
+	var revoked bool
+	err := d.withTx(context.Background(), func(tx *sql.Tx) error {
+		var revokedAt sql.NullTime
+		err := tx.QueryRow("SELECT token_hash, username, family, issued_at, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = ? FOR UPDATE", hash).
+			Scan(&token.Hash, &token.Username, &token.Family, &token.IssuedAt, &token.ExpiresAt, &revokedAt)
+		if err == sql.ErrNoRows {
+			return ErrRefreshTokenNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if revokedAt.Valid {
+			token.RevokedAt = revokedAt.Time
+			revoked = true
+			return nil
+		}
+
+		_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE token_hash = ?", time.Now().UTC(), hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return &token, ErrRefreshTokenRevoked
+	}
+	return &token, nil
+}
+
+func (d *mysqlDB) RevokeRefreshTokens(username string, family string) (int, error) {
+	result, err := d.db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE username = ? AND revoked_at IS NULL AND (? = '' OR family = ?)",
+		time.Now().UTC(), username, family, family)
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+func (d *mysqlDB) SetAccountOwner(owner AccountOwner) error {
+	_, err := d.db.Exec("INSERT INTO account_owners (account, owner, permission, added_at) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE permission = VALUES(permission)",
+		owner.Account, owner.Owner, owner.Permission, owner.AddedAt.UTC())
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlNoReferencedRow {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (d *mysqlDB) GetAccountOwners(account string) ([]AccountOwner, error) {
+	rows, err := d.db.Query("SELECT account, owner, permission, added_at FROM account_owners WHERE account = ? ORDER BY owner", account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var owners = []AccountOwner{}
+	for rows.Next() {
+		var owner AccountOwner
+		err = rows.Scan(&owner.Account, &owner.Owner, &owner.Permission, &owner.AddedAt)
+		if err != nil {
+			return nil, err
+		}
+		owners = append(owners, owner)
+	}
+	return owners, rows.Err()
+}
+
+func (d *mysqlDB) RemoveAccountOwner(account string, owner string) error {
+	result, err := d.db.Exec("DELETE FROM account_owners WHERE account = ? AND owner = ?", account, owner)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err == nil && count == 0 {
+		return ErrOwnerNotFound
+	}
+	return err
+}
+
+// PutRecord replaces a record in place, keyed on kind and ID
+func (d *mysqlDB) PutRecord(record Record) error {
+	_, err := d.db.Exec("INSERT INTO records (kind, id, account, data, updated_at) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE account = VALUES(account), data = VALUES(data), updated_at = VALUES(updated_at)",
+		record.Kind, record.ID, record.Account, record.Data, record.UpdatedAt.UTC())
+	return err
+}
+
+func (d *mysqlDB) GetRecord(kind string, id string) (*Record, error) {
+	var record = Record{Kind: kind, ID: id}
+	err := d.db.QueryRow("SELECT account, data, updated_at FROM records WHERE kind = ? AND id = ?", kind, id).Scan(&record.Account, &record.Data, &record.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ListRecords is served by the records_account index when account is given
+func (d *mysqlDB) ListRecords(kind string, account string) ([]Record, error) {
+	rows, err := d.db.Query("SELECT id, account, data, updated_at FROM records WHERE kind = ? AND (? = '' OR account = ?) ORDER BY id", kind, account, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records = []Record{}
+	for rows.Next() {
+		var record = Record{Kind: kind}
+		err = rows.Scan(&record.ID, &record.Account, &record.Data, &record.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (d *mysqlDB) DeleteRecord(kind string, id string) error {
+	result, err := d.db.Exec("DELETE FROM records WHERE kind = ? AND id = ?", kind, id)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err == nil && count == 0 {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// AppendEvent lets AUTO_INCREMENT assign the ID, unless the event brings its own
+func (d *mysqlDB) AppendEvent(event Event) (int64, error) {
+	result, err := d.db.Exec("INSERT INTO events (id, type, schema_version, subject, data, occurred_at) VALUES (NULLIF(?, 0), ?, ?, ?, ?, ?)",
+		event.ID, event.Type, event.SchemaVersion, event.Subject, event.Data, event.OccurredAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// ListEvents is served by the events_subject index when filter names a subject
+func (d *mysqlDB) ListEvents(filter EventFilter) ([]Event, error) {
+	var query strings.Builder
+	var args = []interface{}{filter.AfterID}
+	query.WriteString("SELECT id, type, schema_version, subject, data, occurred_at FROM events WHERE id > ?")
+	if filter.Subject != "" {
+		query.WriteString(" AND subject = ?")
+		args = append(args, filter.Subject)
+	}
+	if filter.Type != "" {
+		query.WriteString(" AND type = ?")
+		args = append(args, filter.Type)
+	}
+	query.WriteString(" ORDER BY id")
+	if filter.Limit > 0 {
+		query.WriteString(" LIMIT ?")
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := d.db.Query(query.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events = []Event{}
+	for rows.Next() {
+		var event Event
+		err = rows.Scan(&event.ID, &event.Type, &event.SchemaVersion, &event.Subject, &event.Data, &event.OccurredAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (d *mysqlDB) RewriteEvent(event Event) error {
+	var found int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM events WHERE id = ?", event.ID).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found == 0 {
+		return ErrEventNotFound
+	}
+	_, err = d.db.Exec("UPDATE events SET subject = ?, data = ? WHERE id = ?", event.Subject, event.Data, event.ID)
+	return err
+}
+
+func (d *mysqlDB) GetPostings() []Posting {
+	rows, err := d.db.Query("SELECT p.transaction_id, p.account, p.amount, p.created_at FROM postings p JOIN transactions t ON t.id = p.transaction_id ORDER BY t.seq")
+	if err != nil {
+		log.Error("Failed to read postings: ", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var postings []Posting
+	for rows.Next() {
+		var posting Posting
+		err = rows.Scan(&posting.TransactionID, &posting.Account, &posting.Amount, &posting.Timestamp)
+		if err != nil {
+			log.Error("Failed to read posting: ", err)
+			return nil
+		}
+		postings = append(postings, posting)
+	}
+	return postings
+}
+
+func (d *mysqlDB) GetSystemHealth() map[string]interface{} {
+	var status = "healthy"
+	var components = map[string]bool{"database": true}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := d.db.PingContext(ctx)
+	if err != nil {
+		status = "unhealthy"
+		components["database"] = false
+	}
+
+	var stats sql.DBStats = d.db.Stats()
+	return map[string]interface{}{
+		"status":           status,
+		"driver":           "mysql",
+		"components":       components,
+		"open_connections": stats.OpenConnections,
+		"in_use":           stats.InUse,
+		"last_check":       time.Now(),
+		"build":            buildinfo.Get().Fields(),
+	}
+}
+
+func (d *mysqlDB) Capabilities() Capabilities {
+	return Capabilities{Durable: true}
+}
@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// The MySQL backend itself needs a server, these cover the parts that don't
+func TestMySQLHelpers(t *testing.T) {
+	t.Run("Migrations_Split_Into_Statements", func(t *testing.T) {
+		contents, err := mysqlMigrations.ReadFile("migrations/mysql/0001_init.sql")
+		if err != nil {
+			t.Fatalf("Failed to read migration: %v", err)
+		}
+
+		statements := splitStatements(string(contents))
+		if len(statements) != 4 {
+			t.Fatalf("Expected 4 statements, got %d", len(statements))
+		}
+		for _, statement := range statements {
+			if !strings.HasPrefix(statement, "CREATE TABLE") || strings.HasSuffix(statement, ";") {
+				t.Errorf("Unexpected statement: %q", statement)
+			}
+		}
+	})
+
+	t.Run("Sequence_Backfill_Splits_Into_Statements", func(t *testing.T) {
+		contents, err := mysqlMigrations.ReadFile("migrations/mysql/0005_ledger_sequences.sql")
+		if err != nil {
+			t.Fatalf("Failed to read migration: %v", err)
+		}
+
+		statements := splitStatements(string(contents))
+		if len(statements) != 7 || !strings.HasPrefix(statements[6], "DROP TABLE ledger_backfill") {
+			t.Fatalf("Expected 7 statements ending with the backfill table's drop, got %q", statements)
+		}
+	})
+
+	t.Run("Only_Deadlocks_And_Lock_Timeouts_Retry", func(t *testing.T) {
+		if !isRetryable(&mysql.MySQLError{Number: mysqlDeadlock}) {
+			t.Errorf("Deadlocks should be retried")
+		}
+		if !isRetryable(errors.Join(errors.New("wrapped"), &mysql.MySQLError{Number: mysqlLockWaitTimeout})) {
+			t.Errorf("Wrapped lock wait timeouts should be retried")
+		}
+		if isRetryable(errRejected{"FAILED_INSUFFICIENT_FUNDS"}) || isRetryable(&mysql.MySQLError{Number: 1062}) {
+			t.Errorf("Business rejections and duplicate keys must not be retried")
+		}
+	})
+}
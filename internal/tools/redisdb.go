@@ -0,0 +1,1423 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/buildinfo"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// Every key shares the {goapi} hash tag, so the scripts' keys are in one cluster slot
+const (
+	redisAccountsKey     = "{goapi}:accounts"
+	redisTransactionsKey = "{goapi}:transactions"
+
+	// The same usernames as a sorted set, all scored 0 so it orders by name, for
+	// reading accounts a page at a time
+	redisAccountNamesKey = "{goapi}:account_names"
+
+	redisMaxAttempts = 3
+)
+
+// Lua numbers are doubles, so balances are kept where a double is exact. A change that
+// would take one past this is refused as FAILED_OVERFLOW. The scripts refuse amounts
+// over it first and then compare the balance with the cap less the amount, so they
+// never add past the range where doubles are exact.
+const redisMaxCoins = 1<<53 - 1
+
+func redisLoginKey(username string) string    { return "{goapi}:login:" + username }
+func redisBalanceKey(username string) string  { return "{goapi}:balance:" + username }
+func redisRefreshKey(hash string) string      { return "{goapi}:refresh:" + hash }
+func redisSequenceKey(username string) string { return "{goapi}:sequence:" + username }
+
+// Hashes of username's refresh tokens, some may have expired since
+func redisRefreshTokensKey(username string) string { return "{goapi}:refresh_tokens:" + username }
+
+// Co-owners of account, a hash of owner to their JSON encoded redisOwner, and the
+// accounts username co-owns so anonymizing them can find every entry
+func redisOwnersKey(account string) string { return "{goapi}:owners:" + account }
+func redisOwnedKey(username string) string { return "{goapi}:owned:" + username }
+
+// Records of one kind, a hash of ID to the JSON encoded Record
+func redisRecordsKey(kind string) string { return "{goapi}:records:" + kind }
+
+// A hold's account, kind, amount and created_at, the IDs of account's holds and the IDs
+// of every hold. The balance's held field is the sum of its account's.
+func redisHoldKey(id string) string       { return "{goapi}:hold:" + id }
+func redisHoldsKey(account string) string { return "{goapi}:holds:" + account }
+
+const redisHoldIDsKey = "{goapi}:hold_ids"
+
+// The last event ID handed out, a hash of ID to the JSON encoded Event, and the IDs of
+// every event and of each subject's as sorted sets scored by ID
+const (
+	redisEventIDKey  = "{goapi}:event_id"
+	redisEventsKey   = "{goapi}:events"
+	redisEventLogKey = "{goapi}:event_log"
+)
+
+func redisSubjectEventsKey(subject string) string { return "{goapi}:subject_events:" + subject }
+
+// One client per process, NewDatabase is called per request
+var (
+	redisMu   sync.Mutex
+	redisPool = map[string]*redis.Client{}
+)
+
+// redisStamp appends each party's next ledger sequence number to a JSON entry, as
+// fields that override the zeros Go encoded. A key named twice is numbered once.
+const redisStamp = `
+local function stamp(entry, fields)
+  local taken = {}
+  local suffix = ''
+  for _, field in ipairs(fields) do
+    local key = field[2]
+    if taken[key] == nil then taken[key] = redis.call('INCR', key) end
+    suffix = suffix .. ',"' .. field[1] .. '":' .. taken[key]
+  end
+  return string.sub(entry, 1, -2) .. suffix .. '}'
+end
+`
+
+// redisHeld reads what a balance's holds set aside, accounts that never had one have no
+// held field. balance is the reply of the hold scripts, the whole balance after them.
+const redisHeld = `
+local function held(key)
+  return tonumber(redis.call('HGET', key, 'held') or '0')
+end
+local function balance(key)
+  local frozen = 0
+  if redis.call('HGET', key, 'frozen') == '1' then frozen = 1 end
+  return {'SUCCESS', tonumber(redis.call('HGET', key, 'coins')), tonumber(redis.call('HGET', key, 'version')), held(key), frozen}
+end
+`
+
+// Amounts are passed to HINCRBY as the strings Go formatted, never as Lua numbers,
+// which would turn large values into exponent notation. The entry is only logged if
+// the change is applied.
+var redisDepositScript = redis.NewScript(redisStamp + redisHeld + `
+if redis.call('EXISTS', KEYS[1]) == 0 then return {'FAILED_USER_NOT_FOUND'} end
+local amount, max = tonumber(ARGV[1]), tonumber(ARGV[3])
+if amount > max then return {'FAILED_OVERFLOW'} end
+local coins = tonumber(redis.call('HGET', KEYS[1], 'coins'))
+if coins > max - amount then return {'FAILED_OVERFLOW'} end
+coins = redis.call('HINCRBY', KEYS[1], 'coins', ARGV[1])
+local version = redis.call('HINCRBY', KEYS[1], 'version', 1)
+redis.call('RPUSH', KEYS[2], stamp(ARGV[2], {{'ToSequence', KEYS[3]}}))
+return {'SUCCESS', coins, version, held(KEYS[1])}
+`)
+
+// Only what no hold sets aside can be withdrawn, and no balance holds more than ARGV[3]
+var redisWithdrawScript = redis.NewScript(redisStamp + redisHeld + `
+if redis.call('EXISTS', KEYS[1]) == 0 then return {'FAILED_USER_NOT_FOUND'} end
+if redis.call('HGET', KEYS[1], 'frozen') == '1' then return {'FAILED_ACCOUNT_FROZEN'} end
+local amount = tonumber(ARGV[1])
+if amount > tonumber(ARGV[3]) then return {'FAILED_INSUFFICIENT_FUNDS'} end
+local coins = tonumber(redis.call('HGET', KEYS[1], 'coins'))
+if coins - held(KEYS[1]) < amount then return {'FAILED_INSUFFICIENT_FUNDS'} end
+coins = redis.call('HINCRBY', KEYS[1], 'coins', '-' .. ARGV[1])
+local version = redis.call('HINCRBY', KEYS[1], 'version', 1)
+redis.call('RPUSH', KEYS[2], stamp(ARGV[2], {{'FromSequence', KEYS[3]}}))
+return {'SUCCESS', coins, version, held(KEYS[1])}
+`)
+
+// Both balances are checked before either changes, Redis doesn't roll back a script
+// that fails halfway
+var redisTransferScript = redis.NewScript(redisStamp + redisHeld + `
+if redis.call('EXISTS', KEYS[1]) == 0 then return {'FAILED_FROM_USER_NOT_FOUND'} end
+if redis.call('EXISTS', KEYS[2]) == 0 then return {'FAILED_TO_USER_NOT_FOUND'} end
+if redis.call('HGET', KEYS[1], 'frozen') == '1' then return {'FAILED_ACCOUNT_FROZEN'} end
+local amount, max = tonumber(ARGV[1]), tonumber(ARGV[3])
+if amount > max then return {'FAILED_INSUFFICIENT_FUNDS'} end
+if tonumber(redis.call('HGET', KEYS[1], 'coins')) - held(KEYS[1]) < amount then return {'FAILED_INSUFFICIENT_FUNDS'} end
+if tonumber(redis.call('HGET', KEYS[2], 'coins')) > max - amount then return {'FAILED_OVERFLOW'} end
+local fromCoins = redis.call('HINCRBY', KEYS[1], 'coins', '-' .. ARGV[1])
+local fromVersion = redis.call('HINCRBY', KEYS[1], 'version', 1)
+local toCoins = redis.call('HINCRBY', KEYS[2], 'coins', ARGV[1])
+local toVersion = redis.call('HINCRBY', KEYS[2], 'version', 1)
+redis.call('RPUSH', KEYS[3], stamp(ARGV[2], {{'FromSequence', KEYS[4]}, {'ToSequence', KEYS[5]}}))
+return {'SUCCESS', fromCoins, fromVersion, held(KEYS[1]), toCoins, toVersion, held(KEYS[2])}
+`)
+
+// Places or changes the hold in KEYS[2] on the balance in KEYS[1]. The previous amount
+// is taken off held before the new one is added, both as the strings Redis stored and
+// Go formatted. ARGV[5] is '1' when the account has to have the amount available.
+var redisPlaceHoldScript = redis.NewScript(redisHeld + `
+if redis.call('EXISTS', KEYS[1]) == 0 then return {'FAILED_USER_NOT_FOUND'} end
+local exists = redis.call('EXISTS', KEYS[2]) == 1
+local previous = '0'
+if exists then
+  if redis.call('HGET', KEYS[2], 'account') ~= ARGV[2] then return {'FAILED_HOLD_NOT_FOUND'} end
+  previous = redis.call('HGET', KEYS[2], 'amount')
+end
+if ARGV[5] == '1' then
+  if redis.call('HGET', KEYS[1], 'frozen') == '1' then return {'FAILED_ACCOUNT_FROZEN'} end
+  local coins = tonumber(redis.call('HGET', KEYS[1], 'coins'))
+  if coins - held(KEYS[1]) + tonumber(previous) < tonumber(ARGV[3]) then return {'FAILED_INSUFFICIENT_FUNDS'} end
+end
+if previous ~= '0' then redis.call('HINCRBY', KEYS[1], 'held', '-' .. previous) end
+redis.call('HINCRBY', KEYS[1], 'held', ARGV[3])
+if not exists then redis.call('HSET', KEYS[2], 'account', ARGV[2], 'created_at', ARGV[6]) end
+redis.call('HSET', KEYS[2], 'kind', ARGV[4], 'amount', ARGV[3])
+redis.call('SADD', KEYS[3], ARGV[1])
+redis.call('SADD', KEYS[4], ARGV[1])
+return balance(KEYS[1])
+`)
+
+// Releases the hold in KEYS[2] if it is still ARGV[2]'s, whose balance is KEYS[1]
+var redisReleaseHoldScript = redis.NewScript(redisHeld + `
+if redis.call('EXISTS', KEYS[2]) == 0 or redis.call('HGET', KEYS[2], 'account') ~= ARGV[2] then return {'FAILED_HOLD_NOT_FOUND'} end
+redis.call('HINCRBY', KEYS[1], 'held', '-' .. redis.call('HGET', KEYS[2], 'amount'))
+redis.call('DEL', KEYS[2])
+redis.call('SREM', KEYS[3], ARGV[1])
+redis.call('SREM', KEYS[4], ARGV[1])
+return balance(KEYS[1])
+`)
+
+// Releases the hold in KEYS[2] if it is still ARGV[2]'s and moves ARGV[3] of it out of
+// the balance in KEYS[1], to the balance in KEYS[7] when there is one or else as a
+// withdrawal. Everything is checked before anything changes, like a transfer.
+var redisCaptureHoldScript = redis.NewScript(redisStamp + redisHeld + `
+if redis.call('EXISTS', KEYS[2]) == 0 or redis.call('HGET', KEYS[2], 'account') ~= ARGV[2] then return {'FAILED_HOLD_NOT_FOUND'} end
+local hold = redis.call('HGET', KEYS[2], 'amount')
+local amount = tonumber(ARGV[3])
+if amount > tonumber(hold) then return {'FAILED_INVALID_AMOUNT'} end
+local credit = #KEYS > 6
+if credit and redis.call('EXISTS', KEYS[7]) == 0 then return {'FAILED_TO_USER_NOT_FOUND'} end
+if redis.call('HGET', KEYS[1], 'frozen') == '1' then return {'FAILED_ACCOUNT_FROZEN'} end
+if tonumber(redis.call('HGET', KEYS[1], 'coins')) - held(KEYS[1]) + tonumber(hold) < amount then return {'FAILED_INSUFFICIENT_FUNDS'} end
+if credit and (amount > tonumber(ARGV[5]) or tonumber(redis.call('HGET', KEYS[7], 'coins')) > tonumber(ARGV[5]) - amount) then return {'FAILED_OVERFLOW'} end
+redis.call('HINCRBY', KEYS[1], 'held', '-' .. hold)
+redis.call('DEL', KEYS[2])
+redis.call('SREM', KEYS[3], ARGV[1])
+redis.call('SREM', KEYS[4], ARGV[1])
+local fromCoins = redis.call('HINCRBY', KEYS[1], 'coins', '-' .. ARGV[3])
+local fromVersion = redis.call('HINCRBY', KEYS[1], 'version', 1)
+if not credit then
+  redis.call('RPUSH', KEYS[5], stamp(ARGV[4], {{'FromSequence', KEYS[6]}}))
+  return {'SUCCESS', fromCoins, fromVersion, held(KEYS[1])}
+end
+local toCoins = redis.call('HINCRBY', KEYS[7], 'coins', ARGV[3])
+local toVersion = redis.call('HINCRBY', KEYS[7], 'version', 1)
+redis.call('RPUSH', KEYS[5], stamp(ARGV[4], {{'FromSequence', KEYS[6]}, {'ToSequence', KEYS[8]}}))
+return {'SUCCESS', fromCoins, fromVersion, held(KEYS[1]), toCoins, toVersion, held(KEYS[7])}
+`)
+
+// Appends an entry that changes no balance in the script, KEYS[2] onwards are the
+// sequence keys of the fields named in ARGV[2] onwards
+var redisLogScript = redis.NewScript(redisStamp + `
+local fields = {}
+for i = 2, #KEYS do fields[#fields + 1] = {ARGV[i], KEYS[i]} end
+redis.call('RPUSH', KEYS[1], stamp(ARGV[1], fields))
+return 1
+`)
+
+// Appends the JSON event in ARGV[2] as the ID in ARGV[1], the next one when that is 0,
+// and returns the ID. 0 if an event already has it.
+var redisAppendEventScript = redis.NewScript(`
+local id = tonumber(ARGV[1])
+if id == 0 then
+  id = redis.call('INCR', KEYS[1])
+elseif id > tonumber(redis.call('GET', KEYS[1]) or '0') then
+  redis.call('SET', KEYS[1], ARGV[1])
+end
+if redis.call('HSETNX', KEYS[2], id, ARGV[2]) == 0 then return 0 end
+redis.call('ZADD', KEYS[3], id, id)
+redis.call('ZADD', KEYS[4], id, id)
+return id
+`)
+
+var redisCreateScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 or redis.call('EXISTS', KEYS[2]) == 1 then return 0 end
+redis.call('HSET', KEYS[1], 'token', ARGV[2], 'role', ARGV[3])
+redis.call('HSET', KEYS[2], 'coins', 0, 'version', 1)
+redis.call('SADD', KEYS[3], ARGV[1])
+redis.call('ZADD', KEYS[4], 0, ARGV[1])
+return 1
+`)
+
+// Revokes a refresh token: 0 if it doesn't exist, 2 if it was already revoked, and
+// otherwise 1. With a family in ARGV[2] only a token of that family is revoked.
+var redisRevokeRefreshScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+if redis.call('HEXISTS', KEYS[1], 'revoked_at') == 1 then return 2 end
+if ARGV[2] ~= '' and redis.call('HGET', KEYS[1], 'family') ~= ARGV[2] then return 2 end
+redis.call('HSET', KEYS[1], 'revoked_at', ARGV[1])
+return 1
+`)
+
+// redisTransaction is one entry of the transactions list, with the postings of a
+// successful transaction alongside it
+type redisTransaction struct {
+	TransactionLog
+	Postings []Posting
+}
+
+// redisDB keeps each login and balance in a hash, and the audit log as a list of JSON
+// entries appended by the same script that changes the balances
+type redisDB struct {
+	url    string
+	client *redis.Client
+}
+
+func newRedisDatabase(url string) DatabaseInterface {
+	return &redisDB{url: url}
+}
+
+func (d *redisDB) SetupDatabase() error {
+	redisMu.Lock()
+	defer redisMu.Unlock()
+
+	if client, ok := redisPool[d.url]; ok {
+		d.client = client
+		return nil
+	}
+
+	options, err := redis.ParseURL(d.url)
+	if err != nil {
+		return fmt.Errorf("invalid redis url: %w", err)
+	}
+	var client *redis.Client = redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Holds balances swept from dormant accounts. The empty token can never authenticate.
+	_, err = redisCreateScript.Run(ctx, client,
+		[]string{redisLoginKey("escheat"), redisBalanceKey("escheat"), redisAccountsKey, redisAccountNamesKey},
+		"escheat", "", RoleUser).Result()
+	if err != nil {
+		client.Close()
+		return fmt.Errorf("failed to initialize redis: %w", err)
+	}
+	// Not under the timeout, the first start on a large database indexes every account
+	err = indexAccountNames(context.Background(), client)
+	if err != nil {
+		client.Close()
+		return fmt.Errorf("failed to index redis accounts: %w", err)
+	}
+
+	redisPool[d.url] = client
+	d.client = client
+
+	log.Info("Redis database initialized")
+	return nil
+}
+
+// indexAccountNames adds accounts created before the sorted set existed to it, a batch
+// at a time. It does nothing once both hold the same number of accounts.
+func indexAccountNames(ctx context.Context, client *redis.Client) error {
+	accounts, err := client.SCard(ctx, redisAccountsKey).Result()
+	if err != nil {
+		return err
+	}
+	indexed, err := client.ZCard(ctx, redisAccountNamesKey).Result()
+	if err != nil || indexed >= accounts {
+		return err
+	}
+
+	var cursor uint64
+	for {
+		var usernames []string
+		usernames, cursor, err = client.SScan(ctx, redisAccountsKey, cursor, "", 1000).Result()
+		if err != nil {
+			return err
+		}
+		if len(usernames) > 0 {
+			var members = make([]redis.Z, 0, len(usernames))
+			for _, username := range usernames {
+				members = append(members, redis.Z{Member: username})
+			}
+			if err = client.ZAdd(ctx, redisAccountNamesKey, members...).Err(); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// newEntry builds the list entry for a transaction, with its postings if it succeeded
+func newEntry(txType, from, to string, amount int64, status string, postings ...Posting) string {
+	return newEntryAs(generateTransactionID(), txType, from, to, amount, status, postings...)
+}
+
+// newEntryAs is newEntry for a transaction whose ID the caller has to know
+func newEntryAs(id, txType, from, to string, amount int64, status string, postings ...Posting) string {
+	var entry = redisTransaction{
+		TransactionLog: TransactionLog{
+			ID:        id,
+			Type:      txType,
+			From:      from,
+			To:        to,
+			Amount:    amount,
+			Timestamp: time.Now().UTC(),
+			Status:    status,
+			Flow:      FlowOf(txType),
+		},
+	}
+	for _, posting := range postings {
+		posting.TransactionID = entry.ID
+		posting.Timestamp = entry.Timestamp
+		entry.Postings = append(entry.Postings, posting)
+	}
+
+	encoded, _ := json.Marshal(entry)
+	return string(encoded)
+}
+
+// logScriptArgs are the keys and arguments redisLogScript appends entry with
+func logScriptArgs(entry, from, to string) ([]string, []interface{}) {
+	var keys = []string{redisTransactionsKey}
+	var args = []interface{}{entry}
+	if from != "" {
+		keys = append(keys, redisSequenceKey(from))
+		args = append(args, "FromSequence")
+	}
+	if to != "" {
+		keys = append(keys, redisSequenceKey(to))
+		args = append(args, "ToSequence")
+	}
+	return keys, args
+}
+
+// logFailure records a rejected operation, nothing else changed
+func (d *redisDB) logFailure(txType, from, to string, amount int64, status string) {
+	keys, args := logScriptArgs(newEntry(txType, from, to, amount, status), from, to)
+	err := redisLogScript.Run(context.Background(), d.client, keys, args...).Err()
+	if err != nil {
+		log.Error("Failed to record failed ", txType, ": ", err)
+	}
+}
+
+// runScript returns the status the script reached and the integers that follow it
+func runScript(ctx context.Context, client *redis.Client, script *redis.Script, keys []string, args ...interface{}) (string, []int64, error) {
+	result, err := script.Run(ctx, client, keys, args...).Slice()
+	if err != nil {
+		return "FAILED_STORAGE_ERROR", nil, err
+	}
+
+	status, _ := result[0].(string)
+	var values []int64
+	for _, value := range result[1:] {
+		number, _ := value.(int64)
+		values = append(values, number)
+	}
+	return status, values, nil
+}
+
+func (d *redisDB) GetUserLoginDetails(username string) *LoginDetails {
+	values, err := d.client.HGetAll(context.Background(), redisLoginKey(username)).Result()
+	if err != nil {
+		log.Error("Failed to read login details: ", err)
+		return nil
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return &LoginDetails{AuthToken: values["token"], Username: username, Role: values["role"]}
+}
+
+// parseBalance reads coins, version, frozen and held, false if the account doesn't
+// exist. Accounts that were never frozen or held have no such fields.
+func parseBalance(username string, values []interface{}) (CoinDetails, bool) {
+	var details = CoinDetails{Username: username}
+	coins, ok := values[0].(string)
+	if !ok {
+		return details, false
+	}
+	version, _ := values[1].(string)
+	frozen, _ := values[2].(string)
+	details.Frozen = frozen == "1"
+	held, _ := values[3].(string)
+	details.Held, _ = strconv.ParseInt(held, 10, 64)
+
+	details.Coins, _ = strconv.ParseInt(coins, 10, 64)
+	details.Version, _ = strconv.ParseInt(version, 10, 64)
+	return details, true
+}
+
+func (d *redisDB) GetUserCoins(username string) (*CoinDetails, error) {
+	values, err := d.client.HMGet(context.Background(), redisBalanceKey(username), "coins", "version", "frozen", "held").Result()
+	if err != nil {
+		log.Error("Failed to read balance: ", err)
+		return nil, err
+	}
+
+	details, ok := parseBalance(username, values)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &details, nil
+}
+
+func (d *redisDB) CreateUser(login LoginDetails) (*CoinDetails, error) {
+	created, err := redisCreateScript.Run(context.Background(), d.client,
+		[]string{redisLoginKey(login.Username), redisBalanceKey(login.Username), redisAccountsKey, redisAccountNamesKey},
+		login.Username, login.AuthToken, login.Role).Int()
+	if err != nil {
+		return nil, err
+	}
+	if created == 0 {
+		return nil, ErrUserExists
+	}
+	return &CoinDetails{Username: login.Username, Version: 1}, nil
+}
+
+func (d *redisDB) AddUserCoins(username string, amount int64) (*CoinDetails, error) {
+	if amount <= 0 {
+		d.logFailure("DEPOSIT", "", username, amount, "FAILED_INVALID_AMOUNT")
+		return nil, errRejected{"FAILED_INVALID_AMOUNT"}
+	}
+
+	entry := newEntry("DEPOSIT", "", username, amount, "SUCCESS",
+		Posting{Account: MintAccount, Amount: -amount},
+		Posting{Account: username, Amount: amount},
+	)
+	status, values, err := runScript(context.Background(), d.client, redisDepositScript,
+		[]string{redisBalanceKey(username), redisTransactionsKey, redisSequenceKey(username)}, amount, entry, redisMaxCoins)
+	if err != nil {
+		log.Error("Failed to deposit: ", err)
+	}
+	if status != "SUCCESS" {
+		d.logFailure("DEPOSIT", "", username, amount, status)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errRejected{status}
+	}
+	return &CoinDetails{Username: username, Coins: values[0], Version: values[1], Held: values[2]}, nil
+}
+
+func (d *redisDB) WithdrawUserCoins(username string, amount int64) (*CoinDetails, error) {
+	if amount <= 0 {
+		d.logFailure("WITHDRAWAL", username, "", amount, "FAILED_INVALID_AMOUNT")
+		return nil, errRejected{"FAILED_INVALID_AMOUNT"}
+	}
+
+	entry := newEntry("WITHDRAWAL", username, "", amount, "SUCCESS",
+		Posting{Account: username, Amount: -amount},
+		Posting{Account: BurnAccount, Amount: amount},
+	)
+	status, values, err := runScript(context.Background(), d.client, redisWithdrawScript,
+		[]string{redisBalanceKey(username), redisTransactionsKey, redisSequenceKey(username)}, amount, entry, redisMaxCoins)
+	if err != nil {
+		log.Error("Failed to withdraw: ", err)
+	}
+	if status != "SUCCESS" {
+		d.logFailure("WITHDRAWAL", username, "", amount, status)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errRejected{status}
+	}
+	return &CoinDetails{Username: username, Coins: values[0], Version: values[1], Held: values[2]}, nil
+}
+
+func (d *redisDB) TransferUserCoins(from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails) {
+	fromResult, toResult, err := d.TransferUserCoinsWithContext(context.Background(), from, to, amount)
+	if err != nil {
+		return nil, nil
+	}
+	return fromResult, toResult
+}
+
+func (d *redisDB) TransferUserCoinsWithContext(ctx context.Context, from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error) {
+	var status string
+	switch {
+	case amount <= 0:
+		status = "FAILED_INVALID_AMOUNT"
+	case from == to:
+		status = "FAILED_SELF_TRANSFER"
+	case amount > redisMaxCoins:
+		status = "FAILED_INSUFFICIENT_FUNDS"
+	case ctx.Err() != nil:
+		status = "FAILED_CONTEXT_CANCELLED"
+	}
+	if status != "" {
+		d.logFailure("TRANSFER", from, to, amount, status)
+		return nil, nil, errRejected{status}
+	}
+
+	var id string = generateTransactionID()
+	entry := newEntryAs(id, "TRANSFER", from, to, amount, "SUCCESS",
+		Posting{Account: from, Amount: -amount},
+		Posting{Account: to, Amount: amount},
+	)
+	status, values, err := runScript(ctx, d.client, redisTransferScript,
+		[]string{redisBalanceKey(from), redisBalanceKey(to), redisTransactionsKey, redisSequenceKey(from), redisSequenceKey(to)},
+		amount, entry, redisMaxCoins)
+	if err != nil {
+		log.Error("Failed to transfer: ", err)
+		if ctx.Err() != nil {
+			status = "FAILED_CONTEXT_CANCELLED"
+		}
+	}
+	if status != "SUCCESS" {
+		d.logFailure("TRANSFER", from, to, amount, status)
+		return nil, nil, errRejected{status}
+	}
+
+	return &CoinDetails{Username: from, Coins: values[0], Version: values[1], Held: values[2], TransactionID: id},
+		&CoinDetails{Username: to, Coins: values[3], Version: values[4], Held: values[5], TransactionID: id}, nil
+}
+
+// readTransactions decodes the whole transactions list, oldest first
+func (d *redisDB) readTransactions() []redisTransaction {
+	entries, err := d.client.LRange(context.Background(), redisTransactionsKey, 0, -1).Result()
+	if err != nil {
+		log.Error("Failed to read transactions: ", err)
+		return nil
+	}
+
+	var transactions = make([]redisTransaction, 0, len(entries))
+	for _, entry := range entries {
+		var tx redisTransaction
+		err = json.Unmarshal([]byte(entry), &tx)
+		if err != nil {
+			log.Error("Failed to read transaction: ", err)
+			return nil
+		}
+		transactions = append(transactions, tx)
+	}
+	return transactions
+}
+
+func (d *redisDB) GetTransactionHistory(username string) []TransactionLog {
+	var history []TransactionLog
+	for _, tx := range d.readTransactions() {
+		if tx.From == username || tx.To == username {
+			history = append(history, tx.TransactionLog)
+		}
+	}
+	return history
+}
+
+// GetTransactionHistoryPage reads the whole list like GetTransactionHistory, there is
+// no per-account index of the entries
+func (d *redisDB) GetTransactionHistoryPage(username string, before int64, limit int) []TransactionLog {
+	return PageHistory(d.GetTransactionHistory(username), username, before, limit)
+}
+
+// GetTransaction reads the whole list like GetTransactionHistory, entries aren't
+// indexed by ID
+func (d *redisDB) GetTransaction(id string) (TransactionLog, bool) {
+	for _, tx := range d.readTransactions() {
+		if tx.ID == id {
+			return tx.TransactionLog, true
+		}
+	}
+	return TransactionLog{}, false
+}
+
+func (d *redisDB) GetAllTransactions() []TransactionLog {
+	var all []TransactionLog
+	for _, tx := range d.readTransactions() {
+		all = append(all, tx.TransactionLog)
+	}
+	return all
+}
+
+// readBalances fetches the balances of usernames in one round trip, skipping missing ones
+func (d *redisDB) readBalances(usernames []string) map[string]CoinDetails {
+	var ctx = context.Background()
+	var commands = make([]*redis.SliceCmd, len(usernames))
+	_, err := d.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, username := range usernames {
+			commands[i] = pipe.HMGet(ctx, redisBalanceKey(username), "coins", "version", "frozen", "held")
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to read balances: ", err)
+		return nil
+	}
+
+	var balances = make(map[string]CoinDetails, len(usernames))
+	for i, username := range usernames {
+		if details, ok := parseBalance(username, commands[i].Val()); ok {
+			balances[username] = details
+		}
+	}
+	return balances
+}
+
+func (d *redisDB) GetAllUserCoins() []CoinDetails {
+	usernames, err := d.client.SMembers(context.Background(), redisAccountsKey).Result()
+	if err != nil {
+		log.Error("Failed to read accounts: ", err)
+		return nil
+	}
+
+	var balances []CoinDetails
+	for _, details := range d.readBalances(usernames) {
+		balances = append(balances, details)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Username < balances[j].Username
+	})
+	return balances
+}
+
+// ListUserCoins reads a page of usernames from the sorted set by range, so it doesn't
+// load the accounts set
+func (d *redisDB) ListUserCoins(ctx context.Context, after string, limit int) ([]CoinDetails, error) {
+	var start string = "-"
+	if after != "" {
+		start = "(" + after
+	}
+	usernames, err := d.client.ZRangeByLex(ctx, redisAccountNamesKey, &redis.ZRangeBy{Min: start, Max: "+", Count: int64(max(limit, 0))}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var balances = d.readBalances(usernames)
+	var page = make([]CoinDetails, 0, len(usernames))
+	for _, username := range usernames {
+		if details, ok := balances[username]; ok {
+			page = append(page, details)
+		}
+	}
+	return page, nil
+}
+
+func (d *redisDB) TopUserCoins(usernames []string, limit int) []CoinDetails {
+	if len(usernames) == 0 || limit <= 0 {
+		return []CoinDetails{}
+	}
+
+	var balances = d.readBalances(usernames)
+	return topBalances(usernames, limit, func(username string) (CoinDetails, bool) {
+		details, ok := balances[username]
+		return details, ok
+	})
+}
+
+// watch runs fn as an optimistic transaction on keys, retrying when another client
+// changed one of them first
+func (d *redisDB) watch(fn func(tx *redis.Tx) error, keys ...string) error {
+	var err error
+	for attempt := 1; attempt <= redisMaxAttempts; attempt++ {
+		err = d.client.Watch(context.Background(), fn, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+		log.Warn("Retrying Redis transaction after attempt ", attempt, ": ", err)
+	}
+	return err
+}
+
+func (d *redisDB) CorrectUserCoins(username string, version int64, balance int64) (*CoinDetails, error) {
+	var ctx = context.Background()
+	var result CoinDetails
+	err := d.watch(func(tx *redis.Tx) error {
+		values, err := tx.HMGet(ctx, redisBalanceKey(username), "coins", "version", "frozen", "held").Result()
+		if err != nil {
+			return err
+		}
+		details, ok := parseBalance(username, values)
+		if !ok {
+			return ErrUserNotFound
+		}
+		if details.Version != version {
+			return ErrStaleVersion
+		}
+
+		from, to, delta := correctionParties(username, balance-details.Coins)
+		keys, args := logScriptArgs(newEntry(CorrectionType, from, to, delta, "SUCCESS"), from, to)
+		details.Coins = balance
+		details.Version++
+
+		// EVAL rather than EVALSHA, a queued script can't fall back if it isn't cached
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, redisBalanceKey(username), "coins", details.Coins, "version", details.Version)
+			redisLogScript.Eval(ctx, pipe, keys, args...)
+			return nil
+		})
+		result = details
+		return err
+	}, redisBalanceKey(username))
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (d *redisDB) DeleteUser(username string) error {
+	var ctx = context.Background()
+	return d.watch(func(tx *redis.Tx) error {
+		values, err := tx.HMGet(ctx, redisBalanceKey(username), "coins", "version", "frozen", "held").Result()
+		if err != nil {
+			return err
+		}
+		details, ok := parseBalance(username, values)
+		if !ok {
+			return ErrUserNotFound
+		}
+		if details.Coins != 0 {
+			return ErrAccountNotEmpty
+		}
+
+		owners, err := tx.HKeys(ctx, redisOwnersKey(username)).Result()
+		if err != nil {
+			return err
+		}
+		owned, err := tx.SMembers(ctx, redisOwnedKey(username)).Result()
+		if err != nil {
+			return err
+		}
+		holds, err := tx.SMembers(ctx, redisHoldsKey(username)).Result()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, redisBalanceKey(username), redisLoginKey(username))
+			pipe.Del(ctx, redisOwnersKey(username), redisOwnedKey(username))
+			for _, owner := range owners {
+				pipe.SRem(ctx, redisOwnedKey(owner), username)
+			}
+			for _, account := range owned {
+				pipe.HDel(ctx, redisOwnersKey(account), username)
+			}
+			for _, id := range holds {
+				pipe.Del(ctx, redisHoldKey(id))
+				pipe.SRem(ctx, redisHoldIDsKey, id)
+			}
+			pipe.Del(ctx, redisHoldsKey(username))
+			pipe.SRem(ctx, redisAccountsKey, username)
+			pipe.ZRem(ctx, redisAccountNamesKey, username)
+			return nil
+		})
+		return err
+	}, redisBalanceKey(username), redisOwnersKey(username), redisOwnedKey(username), redisHoldsKey(username))
+}
+
+// AnonymizeUser rewrites every transaction naming username. It watches the whole list,
+// so it retries if any transaction is logged meanwhile.
+func (d *redisDB) AnonymizeUser(username string, pseudonym string) error {
+	var ctx = context.Background()
+	return d.watch(func(tx *redis.Tx) error {
+		values, err := tx.HMGet(ctx, redisBalanceKey(username), "coins", "version", "frozen", "held").Result()
+		if err != nil {
+			return err
+		}
+		details, ok := parseBalance(username, values)
+		if !ok {
+			return ErrUserNotFound
+		}
+		taken, err := tx.Exists(ctx, redisBalanceKey(pseudonym), redisLoginKey(pseudonym)).Result()
+		if err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrUserExists
+		}
+
+		entries, err := tx.LRange(ctx, redisTransactionsKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		var rewritten = map[int64]string{}
+		for i, entry := range entries {
+			var transaction redisTransaction
+			err = json.Unmarshal([]byte(entry), &transaction)
+			if err != nil {
+				return err
+			}
+			if renameParty(&transaction, username, pseudonym) {
+				encoded, _ := json.Marshal(transaction)
+				rewritten[int64(i)] = string(encoded)
+			}
+		}
+
+		sequence, err := tx.Get(ctx, redisSequenceKey(username)).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+
+		// Co-ownership names the person, it isn't carried over to the pseudonym
+		owners, err := tx.HKeys(ctx, redisOwnersKey(username)).Result()
+		if err != nil {
+			return err
+		}
+		owned, err := tx.SMembers(ctx, redisOwnedKey(username)).Result()
+		if err != nil {
+			return err
+		}
+		holds, err := tx.SMembers(ctx, redisHoldsKey(username)).Result()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, redisBalanceKey(pseudonym), "coins", details.Coins, "version", details.Version)
+			if details.Frozen {
+				pipe.HSet(ctx, redisBalanceKey(pseudonym), "frozen", 1)
+			}
+			if details.Held != 0 {
+				pipe.HSet(ctx, redisBalanceKey(pseudonym), "held", details.Held)
+			}
+			for _, id := range holds {
+				pipe.HSet(ctx, redisHoldKey(id), "account", pseudonym)
+			}
+			if len(holds) > 0 {
+				pipe.Rename(ctx, redisHoldsKey(username), redisHoldsKey(pseudonym))
+			}
+			if sequence != "" {
+				pipe.Set(ctx, redisSequenceKey(pseudonym), sequence, 0)
+				pipe.Del(ctx, redisSequenceKey(username))
+			}
+			pipe.Del(ctx, redisBalanceKey(username), redisLoginKey(username))
+			pipe.Del(ctx, redisOwnersKey(username), redisOwnedKey(username))
+			for _, owner := range owners {
+				pipe.SRem(ctx, redisOwnedKey(owner), username)
+			}
+			for _, account := range owned {
+				pipe.HDel(ctx, redisOwnersKey(account), username)
+			}
+			pipe.SRem(ctx, redisAccountsKey, username)
+			pipe.SAdd(ctx, redisAccountsKey, pseudonym)
+			pipe.ZRem(ctx, redisAccountNamesKey, username)
+			pipe.ZAdd(ctx, redisAccountNamesKey, redis.Z{Member: pseudonym})
+			for index, entry := range rewritten {
+				pipe.LSet(ctx, redisTransactionsKey, index, entry)
+			}
+			return nil
+		})
+		return err
+	}, redisBalanceKey(username), redisBalanceKey(pseudonym), redisLoginKey(pseudonym), redisTransactionsKey, redisHoldsKey(username))
+}
+
+// renameParty replaces username in a transaction and its postings, true if it was there
+func renameParty(transaction *redisTransaction, username string, pseudonym string) bool {
+	var renamed bool
+	if transaction.From == username {
+		transaction.From = pseudonym
+		renamed = true
+	}
+	if transaction.To == username {
+		transaction.To = pseudonym
+		renamed = true
+	}
+	for i := range transaction.Postings {
+		if transaction.Postings[i].Account == username {
+			transaction.Postings[i].Account = pseudonym
+			renamed = true
+		}
+	}
+	return renamed
+}
+
+// StoreRefreshToken lets Redis expire the token when it does
+func (d *redisDB) StoreRefreshToken(token RefreshToken) error {
+	var ctx = context.Background()
+	_, err := d.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, redisRefreshKey(token.Hash),
+			"username", token.Username,
+			"family", token.Family,
+			"issued_at", token.IssuedAt.UTC().Format(time.RFC3339Nano),
+			"expires_at", token.ExpiresAt.UTC().Format(time.RFC3339Nano))
+		pipe.ExpireAt(ctx, redisRefreshKey(token.Hash), token.ExpiresAt)
+		pipe.SAdd(ctx, redisRefreshTokensKey(token.Username), token.Hash)
+		pipe.ExpireAt(ctx, redisRefreshTokensKey(token.Username), token.ExpiresAt)
+		return nil
+	})
+	return err
+}
+
+func (d *redisDB) RevokeRefreshToken(hash string) (*RefreshToken, error) {
+	var ctx = context.Background()
+	result, err := redisRevokeRefreshScript.Run(ctx, d.client, []string{redisRefreshKey(hash)},
+		time.Now().UTC().Format(time.RFC3339Nano), "").Int()
+	if err != nil {
+		return nil, err
+	}
+	if result == 0 {
+		return nil, ErrRefreshTokenNotFound
+	}
+
+	// Only revoked_at ever changes, the rest is as it was
+	values, err := d.client.HGetAll(ctx, redisRefreshKey(hash)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrRefreshTokenNotFound
+	}
+
+	var token = RefreshToken{Hash: hash, Username: values["username"], Family: values["family"]}
+	token.IssuedAt, _ = time.Parse(time.RFC3339Nano, values["issued_at"])
+	token.ExpiresAt, _ = time.Parse(time.RFC3339Nano, values["expires_at"])
+	if result == 2 {
+		token.RevokedAt, _ = time.Parse(time.RFC3339Nano, values["revoked_at"])
+		return &token, ErrRefreshTokenRevoked
+	}
+	return &token, nil
+}
+
+func (d *redisDB) RevokeRefreshTokens(username string, family string) (int, error) {
+	var ctx = context.Background()
+	hashes, err := d.client.SMembers(ctx, redisRefreshTokensKey(username)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	var now string = time.Now().UTC().Format(time.RFC3339Nano)
+	for _, hash := range hashes {
+		result, err := redisRevokeRefreshScript.Run(ctx, d.client, []string{redisRefreshKey(hash)}, now, family).Int()
+		if err != nil {
+			return count, err
+		}
+		switch result {
+		case 0:
+			d.client.SRem(ctx, redisRefreshTokensKey(username), hash)
+		case 1:
+			count++
+		}
+	}
+	return count, nil
+}
+
+type redisOwner struct {
+	Permission string
+	AddedAt    time.Time
+}
+
+func (d *redisDB) SetAccountOwner(owner AccountOwner) error {
+	var ctx = context.Background()
+	exists, err := d.client.Exists(ctx, redisBalanceKey(owner.Account), redisLoginKey(owner.Owner)).Result()
+	if err != nil {
+		return err
+	}
+	if exists < 2 {
+		return ErrUserNotFound
+	}
+
+	encoded, _ := json.Marshal(redisOwner{Permission: owner.Permission, AddedAt: owner.AddedAt.UTC()})
+	_, err = d.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, redisOwnersKey(owner.Account), owner.Owner, string(encoded))
+		pipe.SAdd(ctx, redisOwnedKey(owner.Owner), owner.Account)
+		return nil
+	})
+	return err
+}
+
+func (d *redisDB) GetAccountOwners(account string) ([]AccountOwner, error) {
+	values, err := d.client.HGetAll(context.Background(), redisOwnersKey(account)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var owners = []AccountOwner{}
+	for owner, value := range values {
+		var stored redisOwner
+		err = json.Unmarshal([]byte(value), &stored)
+		if err != nil {
+			return nil, err
+		}
+		owners = append(owners, AccountOwner{Account: account, Owner: owner, Permission: stored.Permission, AddedAt: stored.AddedAt})
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i].Owner < owners[j].Owner })
+	return owners, nil
+}
+
+func (d *redisDB) RemoveAccountOwner(account string, owner string) error {
+	var ctx = context.Background()
+	removed, err := d.client.HDel(ctx, redisOwnersKey(account), owner).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrOwnerNotFound
+	}
+	return d.client.SRem(ctx, redisOwnedKey(owner), account).Err()
+}
+
+// SetUserFrozen only changes the flag, so it can't race the scripts that read it
+func (d *redisDB) SetUserFrozen(username string, frozen bool) (*CoinDetails, error) {
+	var ctx = context.Background()
+	var result CoinDetails
+	err := d.watch(func(tx *redis.Tx) error {
+		values, err := tx.HMGet(ctx, redisBalanceKey(username), "coins", "version", "frozen", "held").Result()
+		if err != nil {
+			return err
+		}
+		details, ok := parseBalance(username, values)
+		if !ok {
+			return ErrUserNotFound
+		}
+
+		details.Frozen = frozen
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if frozen {
+				pipe.HSet(ctx, redisBalanceKey(username), "frozen", 1)
+			} else {
+				pipe.HDel(ctx, redisBalanceKey(username), "frozen")
+			}
+			return nil
+		})
+		result = details
+		return err
+	}, redisBalanceKey(username))
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PlaceHold checks what is available and changes held in one script, so it can't race
+// the debits that read them
+func (d *redisDB) PlaceHold(hold Hold) (*CoinDetails, error) {
+	if hold.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if hold.CreatedAt.IsZero() {
+		hold.CreatedAt = time.Now()
+	}
+	var checked = "1"
+	if hold.Kind == HoldFreeze {
+		checked = "0"
+	}
+
+	status, values, err := runScript(context.Background(), d.client, redisPlaceHoldScript,
+		[]string{redisBalanceKey(hold.Account), redisHoldKey(hold.ID), redisHoldsKey(hold.Account), redisHoldIDsKey},
+		hold.ID, hold.Account, hold.Amount, hold.Kind, checked, hold.CreatedAt.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, err
+	}
+	if status != "SUCCESS" {
+		return nil, errRejected{status}
+	}
+	return holdBalance(hold.Account, values), nil
+}
+
+// ReleaseHold finds the hold's account first, the script checks it is still that one's
+func (d *redisDB) ReleaseHold(id string) (*CoinDetails, error) {
+	var ctx = context.Background()
+	account, err := d.client.HGet(ctx, redisHoldKey(id), "account").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrHoldNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status, values, err := runScript(ctx, d.client, redisReleaseHoldScript,
+		[]string{redisBalanceKey(account), redisHoldKey(id), redisHoldsKey(account), redisHoldIDsKey}, id, account)
+	if err != nil {
+		return nil, err
+	}
+	if status != "SUCCESS" {
+		return nil, errRejected{status}
+	}
+	return holdBalance(account, values), nil
+}
+
+// CaptureHold finds the hold's account first like ReleaseHold, the script checks it is
+// still that one's
+func (d *redisDB) CaptureHold(ctx context.Context, id string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error) {
+	from, err := d.client.HGet(ctx, redisHoldKey(id), "account").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil, ErrHoldNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var txType, credited = "TRANSFER", to
+	if to == "" {
+		txType, credited = "WITHDRAWAL", BurnAccount
+	}
+	var status string
+	switch {
+	case amount <= 0:
+		status = "FAILED_INVALID_AMOUNT"
+	case from == to:
+		status = "FAILED_SELF_TRANSFER"
+	case amount > redisMaxCoins:
+		status = "FAILED_INSUFFICIENT_FUNDS"
+	case ctx.Err() != nil:
+		status = "FAILED_CONTEXT_CANCELLED"
+	}
+	if status != "" {
+		d.logFailure(txType, from, to, amount, status)
+		return nil, nil, errRejected{status}
+	}
+
+	var transactionID string = generateTransactionID()
+	entry := newEntryAs(transactionID, txType, from, to, amount, "SUCCESS",
+		Posting{Account: from, Amount: -amount},
+		Posting{Account: credited, Amount: amount},
+	)
+	var keys = []string{redisBalanceKey(from), redisHoldKey(id), redisHoldsKey(from), redisHoldIDsKey, redisTransactionsKey, redisSequenceKey(from)}
+	if to != "" {
+		keys = append(keys, redisBalanceKey(to), redisSequenceKey(to))
+	}
+	status, values, err := runScript(ctx, d.client, redisCaptureHoldScript, keys, id, from, amount, entry, redisMaxCoins)
+	if err != nil {
+		log.Error("Failed to capture hold: ", err)
+		if ctx.Err() != nil {
+			status = "FAILED_CONTEXT_CANCELLED"
+		}
+	}
+	if status == "FAILED_HOLD_NOT_FOUND" {
+		return nil, nil, ErrHoldNotFound
+	}
+	if status != "SUCCESS" {
+		d.logFailure(txType, from, to, amount, status)
+		return nil, nil, errRejected{status}
+	}
+
+	fromDetails = &CoinDetails{Username: from, Coins: values[0], Version: values[1], Held: values[2], TransactionID: transactionID}
+	if to != "" {
+		toDetails = &CoinDetails{Username: to, Coins: values[3], Version: values[4], Held: values[5], TransactionID: transactionID}
+	}
+	return fromDetails, toDetails, nil
+}
+
+// holdBalance reads the balance the hold scripts reply with
+func holdBalance(username string, values []int64) *CoinDetails {
+	return &CoinDetails{Username: username, Coins: values[0], Version: values[1], Held: values[2], Frozen: values[3] == 1}
+}
+
+func (d *redisDB) GetHolds(account string) ([]Hold, error) {
+	var ctx = context.Background()
+	var key = redisHoldIDsKey
+	if account != "" {
+		key = redisHoldsKey(account)
+	}
+	ids, err := d.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var commands = make([]*redis.MapStringStringCmd, len(ids))
+	_, err = d.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			commands[i] = pipe.HGetAll(ctx, redisHoldKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A hold released since the IDs were read is skipped
+	var holds = []Hold{}
+	for i, id := range ids {
+		var values = commands[i].Val()
+		if len(values) == 0 {
+			continue
+		}
+		var hold = Hold{ID: id, Account: values["account"], Kind: values["kind"]}
+		hold.Amount, _ = strconv.ParseInt(values["amount"], 10, 64)
+		hold.CreatedAt, _ = time.Parse(time.RFC3339Nano, values["created_at"])
+		holds = append(holds, hold)
+	}
+	sortHolds(holds)
+	return holds, nil
+}
+
+func (d *redisDB) PutRecord(record Record) error {
+	record.UpdatedAt = record.UpdatedAt.UTC()
+	encoded, _ := json.Marshal(record)
+	return d.client.HSet(context.Background(), redisRecordsKey(record.Kind), record.ID, string(encoded)).Err()
+}
+
+func (d *redisDB) GetRecord(kind string, id string) (*Record, error) {
+	value, err := d.client.HGet(context.Background(), redisRecordsKey(kind), id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record Record
+	err = json.Unmarshal([]byte(value), &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ListRecords reads every record of kind, filtering by account here
+func (d *redisDB) ListRecords(kind string, account string) ([]Record, error) {
+	values, err := d.client.HGetAll(context.Background(), redisRecordsKey(kind)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var records = []Record{}
+	for _, value := range values {
+		var record Record
+		err = json.Unmarshal([]byte(value), &record)
+		if err != nil {
+			return nil, err
+		}
+		if account == "" || record.Account == account {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records, nil
+}
+
+func (d *redisDB) DeleteRecord(kind string, id string) error {
+	removed, err := d.client.HDel(context.Background(), redisRecordsKey(kind), id).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (d *redisDB) AppendEvent(event Event) (int64, error) {
+	event.OccurredAt = event.OccurredAt.UTC()
+	encoded, _ := json.Marshal(event)
+
+	id, err := redisAppendEventScript.Run(context.Background(), d.client,
+		[]string{redisEventIDKey, redisEventsKey, redisEventLogKey, redisSubjectEventsKey(event.Subject)},
+		event.ID, string(encoded)).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		return 0, fmt.Errorf("event %d already exists", event.ID)
+	}
+	return id, nil
+}
+
+// ListEvents reads the IDs from the subject's set when filter names one, and otherwise
+// from the whole log. A Type filter is applied here, so the limit only goes to Redis
+// without one.
+func (d *redisDB) ListEvents(filter EventFilter) ([]Event, error) {
+	var ctx = context.Background()
+	var key = redisEventLogKey
+	if filter.Subject != "" {
+		key = redisSubjectEventsKey(filter.Subject)
+	}
+	var scores = &redis.ZRangeBy{Min: "(" + strconv.FormatInt(filter.AfterID, 10), Max: "+inf"}
+	if filter.Type == "" && filter.Limit > 0 {
+		scores.Count = int64(filter.Limit)
+	}
+	ids, err := d.client.ZRangeByScore(ctx, key, scores).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var events = []Event{}
+	if len(ids) == 0 {
+		return events, nil
+	}
+	values, err := d.client.HMGet(ctx, redisEventsKey, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		encoded, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var event Event
+		err = json.Unmarshal([]byte(encoded), &event)
+		if err != nil {
+			return nil, err
+		}
+		event.ID, _ = strconv.ParseInt(ids[i], 10, 64)
+		if !filter.Matches(event) {
+			continue
+		}
+		events = append(events, event)
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+// RewriteEvent moves the ID to the new subject's set when the subject changes
+func (d *redisDB) RewriteEvent(event Event) error {
+	var ctx = context.Background()
+	var id string = strconv.FormatInt(event.ID, 10)
+	value, err := d.client.HGet(ctx, redisEventsKey, id).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrEventNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var stored Event
+	err = json.Unmarshal([]byte(value), &stored)
+	if err != nil {
+		return err
+	}
+	var previous string = stored.Subject
+	stored.ID = event.ID
+	stored.Subject = event.Subject
+	stored.Data = event.Data
+	encoded, _ := json.Marshal(stored)
+
+	_, err = d.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, redisEventsKey, id, string(encoded))
+		if previous != event.Subject {
+			pipe.ZRem(ctx, redisSubjectEventsKey(previous), id)
+			pipe.ZAdd(ctx, redisSubjectEventsKey(event.Subject), redis.Z{Score: float64(event.ID), Member: id})
+		}
+		return nil
+	})
+	return err
+}
+
+func (d *redisDB) GetPostings() []Posting {
+	var postings []Posting
+	for _, tx := range d.readTransactions() {
+		postings = append(postings, tx.Postings...)
+	}
+	return postings
+}
+
+func (d *redisDB) GetSystemHealth() map[string]interface{} {
+	var status = "healthy"
+	var components = map[string]bool{"database": true}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := d.client.Ping(ctx).Err()
+	if err != nil {
+		status = "unhealthy"
+		components["database"] = false
+	}
+
+	var stats *redis.PoolStats = d.client.PoolStats()
+	return map[string]interface{}{
+		"status":           status,
+		"driver":           "redis",
+		"components":       components,
+		"open_connections": stats.TotalConns,
+		"idle":             stats.IdleConns,
+		"last_check":       time.Now(),
+		"build":            buildinfo.Get().Fields(),
+	}
+}
+
+// Capabilities assumes the server persists its data, Redis without RDB or AOF loses it
+// on restart
+func (d *redisDB) Capabilities() Capabilities {
+	return Capabilities{Durable: true}
+}
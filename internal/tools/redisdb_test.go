@@ -0,0 +1,350 @@
+package tools
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedis returns a redis backend on its own in-process server with aaron and bryan
+func newTestRedis(t *testing.T) *redisDB {
+	server := miniredis.RunT(t)
+
+	var database = &redisDB{url: "redis://" + server.Addr() + "/0"}
+	err := database.SetupDatabase()
+	if err != nil {
+		t.Fatalf("Failed to setup redis database: %v", err)
+	}
+	t.Cleanup(func() {
+		redisMu.Lock()
+		delete(redisPool, database.url)
+		redisMu.Unlock()
+		database.client.Close()
+	})
+
+	for _, username := range []string{"aaron", "bryan"} {
+		_, err = database.CreateUser(LoginDetails{Username: username, AuthToken: username, Role: RoleUser})
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", username, err)
+		}
+		if _, err = database.AddUserCoins(username, 1000); err != nil {
+			t.Fatalf("Failed to fund %s: %v", username, err)
+		}
+	}
+	return database
+}
+
+func TestRedisDatabase(t *testing.T) {
+	t.Run("Concurrent_Transfers_Conserve_Coins", func(t *testing.T) {
+		database := newTestRedis(t)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				database.TransferUserCoins("aaron", "bryan", 30)
+			}()
+			go func() {
+				defer wg.Done()
+				database.TransferUserCoins("bryan", "aaron", 20)
+			}()
+		}
+		wg.Wait()
+
+		aaron, _ := database.GetUserCoins("aaron")
+		bryan, _ := database.GetUserCoins("bryan")
+		if aaron.Coins+bryan.Coins != 2000 || aaron.Coins < 0 || bryan.Coins < 0 {
+			t.Errorf("Expected 2000 coins between two non-negative balances, got %d and %d", aaron.Coins, bryan.Coins)
+		}
+
+		var sum int64
+		for _, posting := range database.GetPostings() {
+			sum += posting.Amount
+		}
+		if sum != 0 {
+			t.Errorf("Expected postings to sum to zero, got %d", sum)
+		}
+	})
+
+	t.Run("Rejections_Are_Logged_Without_Changes", func(t *testing.T) {
+		database := newTestRedis(t)
+
+		_, _, err := database.TransferUserCoinsWithContext(t.Context(), "aaron", "bryan", 5000)
+		if !errors.Is(err, ErrInsufficientFunds) {
+			t.Fatalf("Expected an overdrawn transfer to fail with ErrInsufficientFunds, got %v", err)
+		}
+		if _, err = database.WithdrawUserCoins("nobody", 1); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("Expected ErrUserNotFound for a missing account, got %v", err)
+		}
+		if _, err = database.AddUserCoins("aaron", redisMaxCoins); !errors.Is(err, ErrBalanceOverflow) {
+			t.Errorf("Expected ErrBalanceOverflow past the balance cap, got %v", err)
+		}
+
+		var statuses []string
+		for _, tx := range database.GetAllTransactions() {
+			statuses = append(statuses, tx.Status)
+		}
+		want := []string{"SUCCESS", "SUCCESS", "FAILED_INSUFFICIENT_FUNDS", "FAILED_USER_NOT_FOUND", "FAILED_OVERFLOW"}
+		if len(statuses) != len(want) {
+			t.Fatalf("Expected statuses %v, got %v", want, statuses)
+		}
+		for i := range want {
+			if statuses[i] != want[i] {
+				t.Errorf("Expected statuses %v, got %v", want, statuses)
+				break
+			}
+		}
+		if coins, _ := database.GetUserCoins("aaron"); coins.Coins != 1000 {
+			t.Errorf("Expected aaron to keep 1000 coins, got %d", coins.Coins)
+		}
+	})
+
+	t.Run("Balances_Reach_The_Cap_Exactly", func(t *testing.T) {
+		database := newTestRedis(t)
+
+		if _, err := database.AddUserCoins("bryan", redisMaxCoins-1000); err != nil {
+			t.Fatalf("Expected a deposit up to the cap to succeed, got %v", err)
+		}
+		if _, err := database.AddUserCoins("bryan", 1); !errors.Is(err, ErrBalanceOverflow) {
+			t.Errorf("Expected ErrBalanceOverflow one past the cap, got %v", err)
+		}
+		if _, err := database.AddUserCoins("aaron", math.MaxInt64); !errors.Is(err, ErrBalanceOverflow) {
+			t.Errorf("Expected ErrBalanceOverflow for an amount past the cap, got %v", err)
+		}
+		if _, _, err := database.TransferUserCoinsWithContext(t.Context(), "aaron", "bryan", 1); !errors.Is(err, ErrBalanceOverflow) {
+			t.Errorf("Expected ErrBalanceOverflow for a transfer to a full balance, got %v", err)
+		}
+		if _, err := database.WithdrawUserCoins("bryan", math.MaxInt64); !errors.Is(err, ErrInsufficientFunds) {
+			t.Errorf("Expected ErrInsufficientFunds for an amount past the cap, got %v", err)
+		}
+		if coins, _ := database.GetUserCoins("bryan"); coins.Coins != redisMaxCoins {
+			t.Errorf("Expected bryan to hold exactly %d coins, got %d", int64(redisMaxCoins), coins.Coins)
+		}
+	})
+
+	t.Run("Correction_Checks_Version", func(t *testing.T) {
+		database := newTestRedis(t)
+		details, _ := database.GetUserCoins("aaron")
+
+		corrected, err := database.CorrectUserCoins("aaron", details.Version, 700)
+		if err != nil {
+			t.Fatalf("Failed to correct balance: %v", err)
+		}
+		if corrected.Coins != 700 || corrected.Version != details.Version+1 {
+			t.Errorf("Unexpected corrected balance %+v", corrected)
+		}
+
+		_, err = database.CorrectUserCoins("aaron", details.Version, 800)
+		if !errors.Is(err, ErrStaleVersion) {
+			t.Errorf("Expected ErrStaleVersion, got %v", err)
+		}
+	})
+
+	t.Run("Anonymize_Renames_History", func(t *testing.T) {
+		database := newTestRedis(t)
+		database.TransferUserCoins("aaron", "bryan", 100)
+
+		err := database.AnonymizeUser("aaron", "deleted-1")
+		if err != nil {
+			t.Fatalf("Failed to anonymize: %v", err)
+		}
+		if _, err := database.GetUserCoins("aaron"); database.GetUserLoginDetails("aaron") != nil || !errors.Is(err, ErrUserNotFound) {
+			t.Error("Expected aaron to be gone")
+		}
+		if coins, err := database.GetUserCoins("deleted-1"); err != nil || coins.Coins != 900 {
+			t.Errorf("Expected the pseudonym to keep 900 coins, got %+v", coins)
+		}
+		if history := database.GetTransactionHistory("bryan"); history[len(history)-1].From != "deleted-1" {
+			t.Errorf("Expected bryan's history to name the pseudonym, got %+v", history)
+		}
+		for _, posting := range database.GetPostings() {
+			if posting.Account == "aaron" {
+				t.Errorf("Expected no postings for aaron, got %+v", posting)
+			}
+		}
+	})
+
+	t.Run("Ledger_Sequences_Have_No_Gaps", func(t *testing.T) {
+		database := newTestRedis(t)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				database.TransferUserCoins("aaron", "bryan", 10)
+			}()
+			go func() {
+				defer wg.Done()
+				database.TransferUserCoins("bryan", "aaron", 2000)
+			}()
+		}
+		wg.Wait()
+		database.TransferUserCoins("aaron", "aaron", 10)
+
+		bryan, _ := database.GetUserCoins("bryan")
+		if _, err := database.CorrectUserCoins("bryan", bryan.Version, 0); err != nil {
+			t.Fatalf("Failed to correct: %v", err)
+		}
+		if err := database.AnonymizeUser("aaron", "deleted-1"); err != nil {
+			t.Fatalf("Failed to anonymize: %v", err)
+		}
+		database.TransferUserCoins("deleted-1", "bryan", 10)
+
+		// Each started with its funding deposit
+		assertSequences(t, database.GetTransactionHistory("deleted-1"), "deleted-1", 43)
+		assertSequences(t, database.GetTransactionHistory("bryan"), "bryan", 43)
+	})
+
+	t.Run("Transfer_Returns_Its_Transaction_ID", func(t *testing.T) {
+		database := newTestRedis(t)
+
+		fromDetails, toDetails := database.TransferUserCoins("aaron", "bryan", 10)
+		history := database.GetTransactionHistory("aaron")
+		if fromDetails == nil || toDetails == nil || fromDetails.TransactionID != history[len(history)-1].ID || toDetails.TransactionID != fromDetails.TransactionID {
+			t.Errorf("Expected both details to carry the ledger entry's ID, got %+v and %+v", fromDetails, toDetails)
+		}
+	})
+
+	t.Run("Accounts_Are_Listed_By_Name", func(t *testing.T) {
+		database := newTestRedis(t)
+		if err := database.AnonymizeUser("aaron", "deleted-1"); err != nil {
+			t.Fatalf("Failed to anonymize: %v", err)
+		}
+
+		// Accounts from before the sorted set are indexed on setup
+		database.client.Del(t.Context(), redisAccountNamesKey)
+		if err := indexAccountNames(t.Context(), database.client); err != nil {
+			t.Fatalf("Failed to index: %v", err)
+		}
+
+		page, err := database.ListUserCoins(t.Context(), "", 2)
+		if err != nil || len(page) != 2 || page[0].Username != "bryan" || page[1].Username != "deleted-1" || page[1].Coins != 1000 {
+			t.Fatalf("Expected bryan and deleted-1, got %+v: %v", page, err)
+		}
+		page, err = database.ListUserCoins(t.Context(), "deleted-1", 2)
+		if err != nil || len(page) != 1 || page[0].Username != "escheat" {
+			t.Errorf("Expected only escheat after deleted-1, got %+v: %v", page, err)
+		}
+	})
+
+	t.Run("Refresh_Tokens_Revoke_Once", func(t *testing.T) {
+		database := newTestRedis(t)
+
+		var expiresAt time.Time = time.Now().Add(time.Hour)
+		for _, token := range []RefreshToken{
+			{Hash: "a1", Username: "aaron", Family: "f1", IssuedAt: time.Now(), ExpiresAt: expiresAt},
+			{Hash: "a2", Username: "aaron", Family: "f1", IssuedAt: time.Now(), ExpiresAt: expiresAt},
+			{Hash: "a3", Username: "aaron", Family: "f2", IssuedAt: time.Now(), ExpiresAt: expiresAt},
+		} {
+			if err := database.StoreRefreshToken(token); err != nil {
+				t.Fatalf("Failed to store refresh token: %v", err)
+			}
+		}
+
+		token, err := database.RevokeRefreshToken("a1")
+		if err != nil || token.Username != "aaron" || token.Family != "f1" || !token.ExpiresAt.Equal(expiresAt.UTC()) {
+			t.Fatalf("Expected aaron's f1 token, got %+v: %v", token, err)
+		}
+		token, err = database.RevokeRefreshToken("a1")
+		if !errors.Is(err, ErrRefreshTokenRevoked) || token == nil || token.RevokedAt.IsZero() {
+			t.Errorf("Expected ErrRefreshTokenRevoked with the token, got %+v: %v", token, err)
+		}
+		if _, err = database.RevokeRefreshToken("nosuch"); !errors.Is(err, ErrRefreshTokenNotFound) {
+			t.Errorf("Expected ErrRefreshTokenNotFound, got %v", err)
+		}
+
+		if count, _ := database.RevokeRefreshTokens("aaron", "f1"); count != 1 {
+			t.Errorf("Expected only a2 to be revoked in f1, got %d", count)
+		}
+		if count, _ := database.RevokeRefreshTokens("aaron", ""); count != 1 {
+			t.Errorf("Expected only a3 left to revoke, got %d", count)
+		}
+	})
+
+	t.Run("Account_Owners_Go_With_Anonymization", func(t *testing.T) {
+		database := newTestRedis(t)
+
+		if err := database.SetAccountOwner(AccountOwner{Account: "aaron", Owner: "nosuch", Permission: OwnerView}); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("Expected ErrUserNotFound for an unknown owner, got %v", err)
+		}
+		for _, owner := range []AccountOwner{
+			{Account: "aaron", Owner: "bryan", Permission: OwnerView, AddedAt: time.Now()},
+			{Account: "aaron", Owner: "bryan", Permission: OwnerTransact, AddedAt: time.Now()},
+			{Account: "bryan", Owner: "aaron", Permission: OwnerView, AddedAt: time.Now()},
+		} {
+			if err := database.SetAccountOwner(owner); err != nil {
+				t.Fatalf("Failed to set account owner: %v", err)
+			}
+		}
+
+		owners, err := database.GetAccountOwners("aaron")
+		if err != nil || len(owners) != 1 || owners[0].Owner != "bryan" || owners[0].Permission != OwnerTransact {
+			t.Fatalf("Expected bryan to transact on aaron, got %+v: %v", owners, err)
+		}
+
+		if err := database.AnonymizeUser("aaron", "deleted-1"); err != nil {
+			t.Fatalf("Failed to anonymize: %v", err)
+		}
+		for _, account := range []string{"aaron", "deleted-1", "bryan"} {
+			if owners, _ := database.GetAccountOwners(account); len(owners) != 0 {
+				t.Errorf("Expected no co-owners of %s, got %+v", account, owners)
+			}
+		}
+		if err := database.RemoveAccountOwner("bryan", "aaron"); !errors.Is(err, ErrOwnerNotFound) {
+			t.Errorf("Expected ErrOwnerNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Events_Get_Storage_IDs", func(t *testing.T) {
+		database := newTestRedis(t)
+
+		for _, event := range []Event{
+			{Type: "account_created", Subject: "aaron", Data: []byte(`{}`)},
+			{Type: "transfer_completed", Subject: "bryan", Data: []byte(`{"to":"aaron"}`)},
+			{Type: "transfer_completed", Subject: "aaron", Data: []byte(`{"to":"bryan"}`)},
+		} {
+			if _, err := database.AppendEvent(event); err != nil {
+				t.Fatalf("Failed to append event: %v", err)
+			}
+		}
+		if _, err := database.AppendEvent(Event{ID: 2, Type: "account_created", Subject: "aaron"}); err == nil {
+			t.Error("Expected a taken ID to be refused")
+		}
+		if id, err := database.AppendEvent(Event{ID: 10, Type: "account_created", Subject: "bryan"}); err != nil || id != 10 {
+			t.Fatalf("Expected the mirrored ID 10, got %d: %v", id, err)
+		}
+		if id, _ := database.AppendEvent(Event{Type: "account_created", Subject: "bryan"}); id != 11 {
+			t.Errorf("Expected the next ID after a mirrored one to be 11, got %d", id)
+		}
+
+		all, err := database.ListEvents(EventFilter{AfterID: 1, Limit: 2})
+		if err != nil || len(all) != 2 || all[0].ID != 2 || all[1].ID != 3 {
+			t.Fatalf("Expected events 2 and 3, got %+v: %v", all, err)
+		}
+		transfers, _ := database.ListEvents(EventFilter{Type: "transfer_completed", Subject: "aaron"})
+		if len(transfers) != 1 || transfers[0].ID != 3 {
+			t.Fatalf("Expected aaron's transfer, got %+v", transfers)
+		}
+
+		var rewritten = transfers[0]
+		rewritten.Subject = "deleted-1"
+		if err := database.RewriteEvent(rewritten); err != nil {
+			t.Fatalf("Failed to rewrite event: %v", err)
+		}
+		if events, _ := database.ListEvents(EventFilter{Subject: "aaron"}); len(events) != 1 || events[0].ID != 1 {
+			t.Errorf("Expected only aaron's account_created left, got %+v", events)
+		}
+		if events, _ := database.ListEvents(EventFilter{Subject: "deleted-1"}); len(events) != 1 || events[0].ID != 3 {
+			t.Errorf("Expected the rewritten transfer under deleted-1, got %+v", events)
+		}
+		if err := database.RewriteEvent(Event{ID: 99}); !errors.Is(err, ErrEventNotFound) {
+			t.Errorf("Expected ErrEventNotFound, got %v", err)
+		}
+	})
+}
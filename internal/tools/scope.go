@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+)
+
+// scope holds other packages' state for one isolated in-memory database, so test
+// servers built on their own database don't see each other's lockouts or webhooks.
+// It goes away with the database.
+type scope struct {
+	id     string
+	states sync.Map
+}
+
+func newScope() *scope {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return &scope{id: hex.EncodeToString(bytes)}
+}
+
+// ScopeOf names the package state database uses: "" for the process-wide state every
+// database shares, unless it is an isolated in-memory one from NewMemoryDatabase
+func ScopeOf(database DatabaseInterface) string {
+	if memory, ok := database.(*mockDB); ok && memory.scope != nil {
+		return memory.scope.id
+	}
+	return ""
+}
+
+// Scoped is package state kept once for the process and once more for each isolated
+// in-memory database, see ScopeOf
+type Scoped[T any] struct {
+	create func() *T
+	once   sync.Once
+	shared *T
+}
+
+// NewScoped returns state made by create the first time a scope asks for it
+func NewScoped[T any](create func() *T) *Scoped[T] {
+	return &Scoped[T]{create: create}
+}
+
+// For returns the state database uses, a nil database gets the process-wide one
+func (s *Scoped[T]) For(database DatabaseInterface) *T {
+	if memory, ok := database.(*mockDB); ok && memory.scope != nil {
+		if state, ok := memory.scope.states.Load(s); ok {
+			return state.(*T)
+		}
+		state, _ := memory.scope.states.LoadOrStore(s, s.create())
+		return state.(*T)
+	}
+
+	s.once.Do(func() { s.shared = s.create() })
+	return s.shared
+}
@@ -0,0 +1,86 @@
+// Package toolstest helps tests prepare an in-memory database once and reuse it:
+//
+//	func TestTransfers(t *testing.T) {
+//		database := toolstest.New(t, map[string]int64{"aaron": 1000, "bryan": 1000})
+//		database.TransferUserCoins("aaron", "bryan", 250)
+//		prepared := toolstest.Snapshot(t, database)
+//
+//		t.Run("Drain", func(t *testing.T) {
+//			toolstest.Restore(t, database, prepared)
+//			...
+//		})
+//	}
+//
+// Restoring replaces the accounts, refresh tokens and ledger, so subtests can't see each
+// other's writes. Subtests sharing one database must not run in parallel.
+package toolstest
+
+import (
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// New returns an isolated in-memory database with an account per balance, each with
+// the username as its token. Without balances it has the demo accounts instead, see
+// tools.DemoAccounts.
+func New(t testing.TB, balances map[string]int64) tools.DatabaseInterface {
+	t.Helper()
+
+	if balances == nil {
+		logins, coins := tools.DemoAccounts()
+		return memory(t, logins, coins)
+	}
+
+	var logins = make(map[string]tools.LoginDetails, len(balances))
+	var coins = make(map[string]tools.CoinDetails, len(balances))
+	for username, balance := range balances {
+		logins[username] = tools.LoginDetails{AuthToken: username, Username: username, Role: tools.RoleUser}
+		coins[username] = tools.CoinDetails{Coins: balance, Username: username, Version: 1}
+	}
+
+	return memory(t, logins, coins)
+}
+
+func memory(t testing.TB, logins map[string]tools.LoginDetails, coins map[string]tools.CoinDetails) tools.DatabaseInterface {
+	t.Helper()
+
+	database, err := tools.NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	return *database
+}
+
+// Held is what storage holds back of username's balance
+func Held(t testing.TB, database tools.DatabaseInterface, username string) int64 {
+	t.Helper()
+
+	details, err := database.GetUserCoins(username)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", username, err)
+	}
+	return details.Held
+}
+
+// Snapshot captures database's state, failing the test unless it is in-memory
+func Snapshot(t testing.TB, database tools.DatabaseInterface) tools.Snapshot {
+	t.Helper()
+	return snapshotter(t, database).Snapshot()
+}
+
+// Restore puts database back to snapshot, failing the test unless it is in-memory
+func Restore(t testing.TB, database tools.DatabaseInterface, snapshot tools.Snapshot) {
+	t.Helper()
+	snapshotter(t, database).Restore(snapshot)
+}
+
+func snapshotter(t testing.TB, database tools.DatabaseInterface) tools.Snapshotter {
+	t.Helper()
+
+	snapshotter, ok := database.(tools.Snapshotter)
+	if !ok {
+		t.Fatalf("Database %T doesn't support snapshots, use the in-memory database", database)
+	}
+	return snapshotter
+}
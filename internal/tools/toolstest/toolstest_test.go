@@ -0,0 +1,37 @@
+package toolstest
+
+import (
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	database := New(t, map[string]int64{"aaron": 1000, "bryan": 1000})
+	database.TransferUserCoins("aaron", "bryan", 250)
+	prepared := Snapshot(t, database)
+
+	for _, amount := range []int64{100, 750} {
+		t.Run("Withdraw", func(t *testing.T) {
+			Restore(t, database, prepared)
+
+			details, err := database.WithdrawUserCoins("aaron", amount)
+			if err != nil {
+				t.Fatalf("Failed to withdraw: %v", err)
+			}
+			if details.Coins != 750-amount {
+				t.Errorf("Expected %d left from the prepared 750, got %d", 750-amount, details.Coins)
+			}
+			if history := database.GetTransactionHistory("aaron"); len(history) != 2 || history[1].FromSequence != 2 {
+				t.Errorf("Expected the prepared transfer and this withdrawal numbered 2, got %+v", history)
+			}
+		})
+	}
+
+	// The snapshot itself is unaffected by what happened after it
+	Restore(t, database, prepared)
+	if bryan, _ := database.GetUserCoins("bryan"); bryan.Coins != 1250 {
+		t.Errorf("Expected bryan's prepared 1250, got %d", bryan.Coins)
+	}
+	if postings := database.GetPostings(); len(postings) != 2 {
+		t.Errorf("Expected only the prepared transfer's postings, got %d", len(postings))
+	}
+}
@@ -0,0 +1,211 @@
+// Package warmup primes the server after a deploy before it reports ready. The hottest
+// accounts, configured ones and the most requested ones of the last run, are read so
+// storage caches and connection pools are filled, then every registered hook runs.
+package warmup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// Hook primes something of its own, usernames are the accounts being warmed
+type Hook func(database tools.DatabaseInterface, usernames []string) error
+
+type namedHook struct {
+	name string
+	run  Hook
+}
+
+// Result is what the last warmup did
+type Result struct {
+	Accounts int
+
+	// Accounts that couldn't be read, warmup carries on without them
+	Failed int
+
+	// Hooks that returned an error, by name
+	HookErrors map[string]string
+
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+var (
+	mu    sync.Mutex
+	hooks []namedHook
+
+	// Requests per account since startup
+	hits = map[string]int64{}
+
+	last  Result
+	ready atomic.Bool
+)
+
+// Register adds a hook run after the accounts are read, in registration order
+func Register(name string, hook Hook) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, namedHook{name: name, run: hook})
+}
+
+// Track counts a request for username towards the next run's hottest accounts
+func Track(username string) {
+	if username == "" {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	hits[username]++
+}
+
+// Hottest returns the n most requested accounts, busiest first
+func Hottest(n int) []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var usernames = make([]string, 0, len(hits))
+	for username := range hits {
+		usernames = append(usernames, username)
+	}
+	sort.Slice(usernames, func(i, j int) bool {
+		if hits[usernames[i]] != hits[usernames[j]] {
+			return hits[usernames[i]] > hits[usernames[j]]
+		}
+		return usernames[i] < usernames[j]
+	})
+	if len(usernames) > n {
+		usernames = usernames[:n]
+	}
+	return usernames
+}
+
+// Load reads the accounts Save kept at the end of the last run, none if path is empty
+// or doesn't exist yet
+func Load(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading warmup state: %w", err)
+	}
+
+	var usernames []string
+	err = json.Unmarshal(content, &usernames)
+	if err != nil {
+		return nil, fmt.Errorf("parsing warmup state %s: %w", path, err)
+	}
+	return usernames, nil
+}
+
+// Save keeps this run's n hottest accounts in path for the next one
+func Save(path string, n int) error {
+	if path == "" || n <= 0 {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(Hottest(n), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write then rename, so a crash mid-write leaves the previous state intact
+	var temporary string = path + ".tmp"
+	err = os.WriteFile(temporary, content, 0o600)
+	if err == nil {
+		err = os.Rename(temporary, path)
+	}
+	return err
+}
+
+// Run reads every account in usernames with connections readers at once, so a pooled
+// backend opens that many connections, then runs the hooks and marks the server ready.
+// A failure is logged and skipped, warmup only ever delays readiness.
+func Run(database tools.DatabaseInterface, usernames []string, connections int) Result {
+	var result = Result{HookErrors: map[string]string{}, StartedAt: time.Now()}
+
+	var seen = map[string]bool{}
+	var unique []string
+	for _, username := range usernames {
+		if username != "" && !seen[username] {
+			seen[username] = true
+			unique = append(unique, username)
+		}
+	}
+
+	// Even with no accounts to read, one round trip opens the first connection
+	database.GetSystemHealth()
+
+	var jobs = make(chan string)
+	var failed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < max(connections, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for username := range jobs {
+				if _, err := database.GetUserCoins(username); err != nil {
+					log.Debug("Warmup could not read ", username, ": ", err)
+					failed.Add(1)
+				}
+			}
+		}()
+	}
+	for _, username := range unique {
+		jobs <- username
+	}
+	close(jobs)
+	wg.Wait()
+
+	result.Accounts = len(unique)
+	result.Failed = int(failed.Load())
+
+	mu.Lock()
+	var registered = append([]namedHook{}, hooks...)
+	mu.Unlock()
+	for _, hook := range registered {
+		if err := hook.run(database, unique); err != nil {
+			log.Error("Warmup hook ", hook.name, " failed: ", err)
+			result.HookErrors[hook.name] = err.Error()
+		}
+	}
+
+	result.FinishedAt = time.Now()
+	mu.Lock()
+	last = result
+	mu.Unlock()
+	ready.Store(true)
+
+	log.WithFields(log.Fields{
+		"accounts": result.Accounts,
+		"failed":   result.Failed,
+		"hooks":    len(registered),
+		"duration": result.FinishedAt.Sub(result.StartedAt).String(),
+	}).Info("Warmup finished")
+	return result
+}
+
+// Ready is true once Run has finished
+func Ready() bool {
+	return ready.Load()
+}
+
+// Last returns the result of the finished warmup, zero before Run returns
+func Last() Result {
+	mu.Lock()
+	defer mu.Unlock()
+	return last
+}
@@ -0,0 +1,71 @@
+package warmup
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+func TestHottestSurvivesRestart(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		Track("aaron")
+	}
+	Track("bryan")
+	Track("bryan")
+	Track("carl")
+	Track("")
+
+	if hottest := Hottest(2); !reflect.DeepEqual(hottest, []string{"aaron", "bryan"}) {
+		t.Errorf("Expected the two busiest accounts, got %v", hottest)
+	}
+
+	var path string = filepath.Join(t.TempDir(), "warmup.json")
+	if usernames, err := Load(path); err != nil || len(usernames) != 0 {
+		t.Fatalf("Expected nothing before the first save, got %v, %v", usernames, err)
+	}
+	if err := Save(path, 2); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	usernames, err := Load(path)
+	if err != nil || !reflect.DeepEqual(usernames, []string{"aaron", "bryan"}) {
+		t.Errorf("Expected the saved accounts back, got %v, %v", usernames, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	logins, coins := tools.DemoAccounts()
+	database, err := tools.NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	var primed []string
+	Register("test_primed", func(database tools.DatabaseInterface, usernames []string) error {
+		primed = usernames
+		return nil
+	})
+	Register("test_broken", func(database tools.DatabaseInterface, usernames []string) error {
+		return errors.New("cache down")
+	})
+
+	if Ready() {
+		t.Fatal("Expected not ready before warmup")
+	}
+
+	result := Run(*database, []string{"aaron", "bryan", "aaron", "nobody", ""}, 2)
+	if result.Accounts != 3 || result.Failed != 1 {
+		t.Errorf("Expected 3 accounts with 1 unreadable, got %+v", result)
+	}
+	if !reflect.DeepEqual(primed, []string{"aaron", "bryan", "nobody"}) {
+		t.Errorf("Expected hooks to get the accounts once each, got %v", primed)
+	}
+	if result.HookErrors["test_broken"] != "cache down" {
+		t.Errorf("Expected the failing hook to be reported, got %+v", result.HookErrors)
+	}
+	if !Ready() || Last().Accounts != 3 {
+		t.Errorf("Expected ready after warmup even with failures")
+	}
+}
@@ -0,0 +1,187 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+// Bounds on a subscription's digest interval, 0 turns digests off
+const (
+	MinDigestInterval = time.Minute
+	MaxDigestInterval = 24 * time.Hour
+
+	// Largest batch one digest carries, anything beyond waits for the next one
+	maxDigestEvents = 500
+)
+
+// Type of a digest payload, single event deliveries carry the event's own type
+const DigestType = "digest"
+
+// Digest batches the events a subscription matched since its last digest. Delivery is
+// at least once: events stay queued until the endpoint answers 2xx, so after a failure
+// they are sent again with the next digest. Receivers deduplicate on event ID.
+type Digest struct {
+	Type           string
+	SubscriptionID string
+
+	// Events per type, the summary
+	Counts map[string]int
+	Events []events.Event
+
+	// OccurredAt of the first and last event
+	From time.Time
+	To   time.Time
+}
+
+var (
+	// Subscription ID -> events waiting for its next digest, oldest first. Guarded by mu.
+	pending = map[string][]events.Event{}
+
+	// Subscriptions with a digest delivery in flight
+	flushing = map[string]bool{}
+)
+
+// SetDigest switches a subscription to a digest every interval, or back to one delivery
+// per event with 0. Account webhooks can only be changed by their owner.
+func SetDigest(database tools.DatabaseInterface, tier string, owner string, id string, interval time.Duration) (Subscription, error) {
+	if interval != 0 && (interval < MinDigestInterval || interval > MaxDigestInterval) {
+		return Subscription{}, fmt.Errorf("%w: digest interval must be 0 or between %s and %s", ErrInvalidSubscription, MinDigestInterval, MaxDigestInterval)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	subscription, ok := lookupLocked(database, tier, owner, id)
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+
+	subscription.Digest = interval
+	subscription.NextDigestAt = time.Now().Add(interval)
+
+	copied := *subscription
+	copied.Secret = ""
+	copied.PreviousSecret = ""
+	copied.DigestPending = len(pending[id])
+	return copied, nil
+}
+
+// enqueue holds event for the subscription's next digest
+func enqueue(id string, event events.Event) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	pending[id] = append(pending[id], event)
+}
+
+type digestBatch struct {
+	subscription Subscription
+	events       []events.Event
+}
+
+// takeDue marks every subscription whose digest is due at now as flushing and returns
+// its oldest queued events. With force every queued event is due.
+func takeDue(now time.Time, force bool) []digestBatch {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var batches []digestBatch
+	for id, queued := range pending {
+		subscription, ok := subscriptions[id]
+		if !ok {
+			delete(pending, id)
+			continue
+		}
+		if len(queued) == 0 || flushing[id] {
+			continue
+		}
+
+		// A subscription switched back to single deliveries sends what it still holds
+		var due bool = force || subscription.Digest == 0 || !now.Before(subscription.NextDigestAt)
+		if !due {
+			continue
+		}
+
+		var size int = len(queued)
+		if size > maxDigestEvents {
+			size = maxDigestEvents
+		}
+		flushing[id] = true
+		batches = append(batches, digestBatch{subscription: *subscription, events: append([]events.Event(nil), queued[:size]...)})
+	}
+	return batches
+}
+
+// FlushDigests delivers every digest due at now, or with force every queued event, and
+// returns once the deliveries finish
+func FlushDigests(now time.Time, force bool) {
+	var wg sync.WaitGroup
+	for _, batch := range takeDue(now, force) {
+		wg.Add(1)
+		go func(batch digestBatch) {
+			defer wg.Done()
+			deliverDigest(batch)
+		}(batch)
+	}
+	wg.Wait()
+}
+
+func deliverDigest(batch digestBatch) {
+	var digest = Digest{
+		Type:           DigestType,
+		SubscriptionID: batch.subscription.ID,
+		Counts:         map[string]int{},
+		Events:         batch.events,
+		From:           batch.events[0].OccurredAt,
+		To:             batch.events[len(batch.events)-1].OccurredAt,
+	}
+	for _, event := range batch.events {
+		digest.Counts[event.Type]++
+	}
+
+	body, err := json.Marshal(digest)
+	if err == nil {
+		err = send(batch.subscription, body)
+	} else {
+		log.Error("Failed to encode webhook digest: ", err)
+	}
+
+	mu.Lock()
+	var id string = batch.subscription.ID
+	delete(flushing, id)
+	if subscription, ok := subscriptions[id]; ok {
+		subscription.NextDigestAt = time.Now().Add(subscription.Digest)
+		if err == nil {
+			// Only the delivered events, more may have been queued meanwhile
+			pending[id] = pending[id][len(batch.events):]
+		}
+	}
+	mu.Unlock()
+
+	if err != nil {
+		log.Warn("Webhook ", id, " digest of ", len(batch.events), " events kept for the next attempt: ", err)
+	}
+	recordDelivery(id, err)
+}
+
+// ScheduleDigests checks for due digests every tick until ctx is done
+func ScheduleDigests(ctx context.Context, tick time.Duration) {
+	var ticker *time.Ticker = time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			FlushDigests(now, false)
+		}
+	}
+}
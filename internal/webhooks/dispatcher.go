@@ -0,0 +1,166 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/sideeffects"
+	"github.com/bryantjandra/goapi/internal/tools"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	SignatureHeader = "X-Goapi-Signature"
+	TimestampHeader = "X-Goapi-Timestamp"
+	maxAttempts     = 3
+
+	// Side effect kind of a single delivery, retried by the sideeffects workers
+	EffectKind = "webhook"
+)
+
+var (
+	client = &http.Client{Timeout: 5 * time.Second}
+
+	startOnce sync.Once
+)
+
+// Start subscribes the dispatcher to domain events, safe to call more than once.
+// Deliveries run on the sideeffects workers.
+func Start() {
+	startOnce.Do(func() {
+		sideeffects.Handle(EffectKind, runEffect)
+		events.Subscribe(dispatch)
+	})
+}
+
+func dispatch(database tools.DatabaseInterface, event events.Event) {
+	for _, subscription := range matching(database, event) {
+		var shaped events.Event = subscription.Rules.shape(event)
+
+		// Rotation notices can't wait for a digest
+		if subscription.Digest > 0 && event.Type != events.WebhookSecretRotated {
+			enqueue(subscription.ID, shaped)
+			continue
+		}
+		sideeffects.Enqueue(EffectKind, subscription.ID, shaped)
+	}
+}
+
+// Sign returns the signature header value for a payload: HMAC-SHA256 over "<timestamp>.<body>"
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether header, which may list several comma separated signatures
+// while a secret is being rotated, contains a valid signature for secret
+func Verify(secret string, timestamp string, body []byte, header string) bool {
+	var expected = Sign(secret, timestamp, body)
+	for _, signature := range strings.Split(header, ",") {
+		if hmac.Equal([]byte(strings.TrimSpace(signature)), []byte(expected)) {
+			return true
+		}
+	}
+	return false
+}
+
+// signature is the header value for a delivery, signed with the current secret and,
+// during a rotation overlap, the previous one as well
+func (s Subscription) signature(timestamp string, body []byte) string {
+	var header = Sign(s.Secret, timestamp, body)
+	if s.overlapping(time.Now()) {
+		header += ", " + Sign(s.PreviousSecret, timestamp, body)
+	}
+	return header
+}
+
+// runEffect makes one attempt at a queued delivery. Only its outcome counts towards
+// the webhook's metrics, not each failed attempt.
+func runEffect(effect sideeffects.Effect) error {
+	mu.RLock()
+	subscription, ok := subscriptions[effect.Key]
+	var current Subscription
+	if ok {
+		current = *subscription
+	}
+	mu.RUnlock()
+
+	// Removed since the event, nothing left to deliver to
+	if !ok {
+		return nil
+	}
+
+	err := deliver(current, effect.Event)
+	if err != nil && effect.Final() {
+		recordDelivery(current.ID, err)
+	}
+	return err
+}
+
+// deliver posts event once and records a success
+func deliver(subscription Subscription, event events.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		// Retrying won't encode it either
+		log.Error("Failed to encode webhook payload: ", err)
+		return nil
+	}
+
+	err = post(subscription, body)
+	if err != nil {
+		log.Warn("Webhook ", subscription.ID, " delivery failed: ", err)
+		return err
+	}
+	recordDelivery(subscription.ID, nil)
+	return nil
+}
+
+// send posts a digest, retrying with backoff, and returns the last error
+func send(subscription Subscription, body []byte) error {
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = post(subscription, body)
+		if err == nil {
+			return nil
+		}
+
+		log.Warn("Webhook ", subscription.ID, " delivery attempt ", attempt, " failed: ", err)
+		time.Sleep(time.Duration(attempt*attempt) * 100 * time.Millisecond)
+	}
+	return err
+}
+
+func post(subscription Subscription, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, subscription.signature(timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package webhooks
+
+import (
+	"fmt"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// Largest field selection a subscription can keep
+const maxRuleFields = 32
+
+// Rules narrow what a subscription receives beyond its event types, and trim what
+// each delivery carries. The dispatcher applies them before delivering or queueing
+// for a digest. Rotation notices are exempt.
+type Rules struct {
+	// Only events whose Data amount is at least this many coins, 0 for any amount.
+	// Events without an amount, like limit changes, are not affected.
+	MinAmount int64
+
+	// Only these Data keys are delivered, every key when empty. The event's ID, type,
+	// subject and time are always kept.
+	Fields []string
+}
+
+func (r Rules) validate() error {
+	if r.MinAmount < 0 {
+		return fmt.Errorf("%w: minimum amount can't be negative", ErrInvalidSubscription)
+	}
+	if len(r.Fields) > maxRuleFields {
+		return fmt.Errorf("%w: at most %d fields can be selected", ErrInvalidSubscription, maxRuleFields)
+	}
+	for _, field := range r.Fields {
+		if field == "" {
+			return fmt.Errorf("%w: field names can't be empty", ErrInvalidSubscription)
+		}
+	}
+	return nil
+}
+
+// admits reports whether event passes the amount threshold
+func (r Rules) admits(event events.Event) bool {
+	if r.MinAmount == 0 {
+		return true
+	}
+	amount, ok := amountOf(event.Data)
+	return !ok || amount >= r.MinAmount
+}
+
+// shape returns event with only the selected Data keys, plus the currency of any
+// amount among them
+func (r Rules) shape(event events.Event) events.Event {
+	if len(r.Fields) == 0 || event.Type == events.WebhookSecretRotated {
+		return event
+	}
+
+	var data = make(map[string]interface{}, len(r.Fields)+1)
+	for _, field := range r.Fields {
+		if value, ok := event.Data[field]; ok {
+			data[field] = value
+		}
+	}
+	if currency, ok := event.Data["currency"]; ok && (data["amount"] != nil || data["balance"] != nil) {
+		data["currency"] = currency
+	}
+	event.Data = data
+	return event
+}
+
+// amountOf reads the amount recorded with an event, whichever integer type it was
+// recorded as
+func amountOf(data map[string]interface{}) (int64, bool) {
+	switch amount := data["amount"].(type) {
+	case int64:
+		return amount, true
+	case int:
+		return int64(amount), true
+	case float64:
+		return int64(amount), true
+	}
+	return 0, false
+}
+
+// SetRules replaces a subscription's rules. Account webhooks can only be changed by
+// their owner.
+func SetRules(database tools.DatabaseInterface, tier string, owner string, id string, rules Rules) (Subscription, error) {
+	var err error = rules.validate()
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	subscription, ok := lookupLocked(database, tier, owner, id)
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+
+	subscription.Rules = rules
+
+	copied := *subscription
+	copied.Secret = ""
+	copied.PreviousSecret = ""
+	copied.DigestPending = len(pending[id])
+	return copied, nil
+}
@@ -0,0 +1,297 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+// Subscription tiers. Account webhooks belong to one user and only receive events
+// involving that user; global webhooks are admin-managed and receive everything.
+const (
+	TierAccount = "account"
+	TierGlobal  = "global"
+)
+
+var (
+	ErrInvalidSubscription = errors.New("invalid webhook subscription")
+	ErrNotFound            = errors.New("webhook not found")
+)
+
+type Metrics struct {
+	Delivered      int64
+	Failed         int64
+	LastError      string
+	LastDeliveryAt time.Time
+}
+
+type Subscription struct {
+	ID    string
+	Tier  string
+	Owner string
+	URL   string
+
+	// Event types to deliver, empty means all
+	EventTypes []string
+
+	// Amount threshold and field selection, see Rules
+	Rules Rules
+
+	// Signs every delivery, only shown when the subscription is created or rotated
+	Secret    string
+	CreatedAt time.Time
+	Metrics   Metrics
+
+	// After a rotation the previous secret also signs deliveries until it expires
+	PreviousSecret          string
+	PreviousSecretExpiresAt time.Time
+	SecretRotatedAt         time.Time
+
+	// With a digest interval matching events are batched into one delivery that often.
+	// DigestPending is filled in by List.
+	Digest        time.Duration
+	NextDigestAt  time.Time
+	DigestPending int
+
+	// The database scope it was created in, it only sees that scope's events. See
+	// tools.ScopeOf.
+	scope string
+}
+
+// Longest overlap a rotation can keep the previous secret valid for
+const MaxRotationOverlap = 7 * 24 * time.Hour
+
+var (
+	mu            sync.RWMutex
+	subscriptions = map[string]*Subscription{}
+)
+
+func newID() string {
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+func newSecret() string {
+	bytes := make([]byte, 32)
+	rand.Read(bytes)
+	return "whsec_" + hex.EncodeToString(bytes)
+}
+
+// Create registers a subscription. Owner is the user for account webhooks and the
+// creating admin for global ones.
+func Create(database tools.DatabaseInterface, tier string, owner string, target string, eventTypes []string, rules Rules) (Subscription, error) {
+	if tier != TierAccount && tier != TierGlobal {
+		return Subscription{}, fmt.Errorf("%w: unknown tier %q", ErrInvalidSubscription, tier)
+	}
+	var err error = rules.validate()
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return Subscription{}, fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidSubscription)
+	}
+
+	var subscription = &Subscription{
+		ID:         newID(),
+		Tier:       tier,
+		Owner:      owner,
+		URL:        target,
+		EventTypes: eventTypes,
+		Rules:      rules,
+		Secret:     newSecret(),
+		CreatedAt:  time.Now(),
+		scope:      tools.ScopeOf(database),
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	subscriptions[subscription.ID] = subscription
+	return *subscription, nil
+}
+
+// visible reports whether a caller in scope sees the subscription among tier's, only
+// the owner sees an account webhook
+func (s *Subscription) visible(scope string, tier string, owner string) bool {
+	return s.scope == scope && s.Tier == tier && (tier != TierAccount || s.Owner == owner)
+}
+
+// lookupLocked returns the subscription named id if the caller sees it, the caller
+// holds mu
+func lookupLocked(database tools.DatabaseInterface, tier string, owner string, id string) (*Subscription, bool) {
+	subscription, ok := subscriptions[id]
+	if !ok || !subscription.visible(tools.ScopeOf(database), tier, owner) {
+		return nil, false
+	}
+	return subscription, true
+}
+
+// List returns a tier's subscriptions, for account webhooks only the owner's, without secrets
+func List(database tools.DatabaseInterface, tier string, owner string) []Subscription {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var scope string = tools.ScopeOf(database)
+	var result = []Subscription{}
+	for _, subscription := range subscriptions {
+		if !subscription.visible(scope, tier, owner) {
+			continue
+		}
+		copied := *subscription
+		if !copied.overlapping(time.Now()) {
+			copied.PreviousSecretExpiresAt = time.Time{}
+		}
+		copied.Secret = ""
+		copied.PreviousSecret = ""
+		copied.DigestPending = len(pending[copied.ID])
+		result = append(result, copied)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// Delete removes a subscription. Account webhooks can only be deleted by their owner.
+func Delete(database tools.DatabaseInterface, tier string, owner string, id string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := lookupLocked(database, tier, owner, id); !ok {
+		return ErrNotFound
+	}
+
+	delete(subscriptions, id)
+	delete(pending, id)
+	return nil
+}
+
+// Rotate gives a subscription a new secret. The previous one keeps signing deliveries
+// next to the new one for overlap, 0 revokes it immediately. Account webhooks can only
+// be rotated by their owner.
+func Rotate(database tools.DatabaseInterface, tier string, owner string, id string, overlap time.Duration) (Subscription, error) {
+	if overlap < 0 || overlap > MaxRotationOverlap {
+		return Subscription{}, fmt.Errorf("%w: overlap must be between 0 and %s", ErrInvalidSubscription, MaxRotationOverlap)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	subscription, ok := lookupLocked(database, tier, owner, id)
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+
+	var now = time.Now()
+	subscription.PreviousSecret = subscription.Secret
+	subscription.PreviousSecretExpiresAt = now.Add(overlap)
+	subscription.Secret = newSecret()
+	subscription.SecretRotatedAt = now
+
+	copied := *subscription
+	copied.PreviousSecret = ""
+	return copied, nil
+}
+
+// overlapping reports whether the previous secret is still valid at now
+func (s *Subscription) overlapping(now time.Time) bool {
+	return s.PreviousSecret != "" && now.Before(s.PreviousSecretExpiresAt)
+}
+
+// TierMetrics sums delivery metrics over every subscription in a tier
+func TierMetrics(database tools.DatabaseInterface, tier string) Metrics {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var scope string = tools.ScopeOf(database)
+	var total Metrics
+	for _, subscription := range subscriptions {
+		if subscription.scope != scope || subscription.Tier != tier {
+			continue
+		}
+		total.Delivered += subscription.Metrics.Delivered
+		total.Failed += subscription.Metrics.Failed
+		if subscription.Metrics.LastDeliveryAt.After(total.LastDeliveryAt) {
+			total.LastDeliveryAt = subscription.Metrics.LastDeliveryAt
+			total.LastError = subscription.Metrics.LastError
+		}
+	}
+	return total
+}
+
+// involves reports whether an event concerns username
+func involves(event events.Event, username string) bool {
+	if event.Subject == username {
+		return true
+	}
+	return event.Data["from"] == username || event.Data["to"] == username
+}
+
+func (s *Subscription) matches(event events.Event) bool {
+	// Rotation notices only go to the rotated webhook, whatever its filter
+	if event.Type == events.WebhookSecretRotated {
+		return event.Data["webhook_id"] == s.ID
+	}
+	if s.Tier == TierAccount && !involves(event, s.Owner) {
+		return false
+	}
+	if !s.Rules.admits(event) {
+		return false
+	}
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, eventType := range s.EventTypes {
+		if eventType == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// matching returns copies of every subscription that should receive event, recorded
+// for database
+func matching(database tools.DatabaseInterface, event events.Event) []Subscription {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var scope string = tools.ScopeOf(database)
+	var result []Subscription
+	for _, subscription := range subscriptions {
+		if subscription.scope == scope && subscription.matches(event) {
+			result = append(result, *subscription)
+		}
+	}
+	return result
+}
+
+func recordDelivery(id string, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	subscription, ok := subscriptions[id]
+	if !ok {
+		return
+	}
+
+	subscription.Metrics.LastDeliveryAt = time.Now()
+	if err != nil {
+		subscription.Metrics.Failed++
+		subscription.Metrics.LastError = err.Error()
+		return
+	}
+	subscription.Metrics.Delivered++
+	subscription.Metrics.LastError = ""
+}
@@ -0,0 +1,322 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bryantjandra/goapi/internal/events"
+	"github.com/bryantjandra/goapi/internal/sideeffects"
+)
+
+func TestWebhookTiers(t *testing.T) {
+	t.Run("Account_Webhooks_Only_See_Own_Events", func(t *testing.T) {
+		aaron, _ := Create(nil, TierAccount, "aaron", "https://example.com/aaron", nil, Rules{})
+		global, _ := Create(nil, TierGlobal, "admin", "https://example.com/all", nil, Rules{})
+		defer Delete(nil, TierAccount, "aaron", aaron.ID)
+		defer Delete(nil, TierGlobal, "admin", global.ID)
+
+		var transfer = events.Event{Type: events.TransferCompleted, Subject: "bryan", Data: map[string]interface{}{"from": "bryan", "to": "aaron"}}
+		var deposit = events.Event{Type: events.DepositCompleted, Subject: "bryan"}
+
+		if ids := matchingIDs(transfer); !ids[aaron.ID] || !ids[global.ID] {
+			t.Errorf("Transfer to aaron should reach both tiers, got %v", ids)
+		}
+		if ids := matchingIDs(deposit); ids[aaron.ID] || !ids[global.ID] {
+			t.Errorf("Bryan's deposit should only reach the global webhook, got %v", ids)
+		}
+	})
+
+	t.Run("Event_Type_Filter", func(t *testing.T) {
+		subscription, _ := Create(nil, TierGlobal, "admin", "https://example.com/limits", []string{events.LimitChanged}, Rules{})
+		defer Delete(nil, TierGlobal, "admin", subscription.ID)
+
+		if matchingIDs(events.Event{Type: events.DepositCompleted})[subscription.ID] {
+			t.Errorf("Filtered webhook should not receive deposits")
+		}
+		if !matchingIDs(events.Event{Type: events.LimitChanged})[subscription.ID] {
+			t.Errorf("Filtered webhook should receive limit changes")
+		}
+	})
+
+	t.Run("Owner_Scoping", func(t *testing.T) {
+		subscription, _ := Create(nil, TierAccount, "aaron", "https://example.com/aaron", nil, Rules{})
+		defer Delete(nil, TierAccount, "aaron", subscription.ID)
+
+		if len(List(nil, TierAccount, "bryan")) != 0 {
+			t.Errorf("Bryan must not see aaron's webhooks")
+		}
+		if Delete(nil, TierAccount, "bryan", subscription.ID) != ErrNotFound {
+			t.Errorf("Bryan must not delete aaron's webhook")
+		}
+		if Delete(nil, TierGlobal, "admin", subscription.ID) != ErrNotFound {
+			t.Errorf("Account webhooks are not managed through the global tier")
+		}
+		if listed := List(nil, TierAccount, "aaron"); len(listed) != 1 || listed[0].Secret != "" {
+			t.Errorf("Expected one listed webhook without its secret, got %+v", listed)
+		}
+	})
+
+	t.Run("Invalid_URL_Rejected", func(t *testing.T) {
+		if _, err := Create(nil, TierAccount, "aaron", "ftp://example.com", nil, Rules{}); err == nil {
+			t.Errorf("Expected non-http URL to be rejected")
+		}
+	})
+}
+
+func TestDelivery(t *testing.T) {
+	var received = make(chan *http.Request, 1)
+	var bodies = make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	subscription, _ := Create(nil, TierGlobal, "admin", server.URL, nil, Rules{})
+	defer Delete(nil, TierGlobal, "admin", subscription.ID)
+
+	deliver(subscription, events.Event{ID: 1, Type: events.DepositCompleted, Subject: "aaron"})
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		expected := Sign(subscription.Secret, r.Header.Get(TimestampHeader), body)
+		if r.Header.Get(SignatureHeader) != expected {
+			t.Errorf("Signature mismatch: got %q, expected %q", r.Header.Get(SignatureHeader), expected)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Webhook was not delivered")
+	}
+
+	if metrics := List(nil, TierGlobal, "admin")[0].Metrics; metrics.Delivered != 1 || metrics.Failed != 0 {
+		t.Errorf("Expected one successful delivery, got %+v", metrics)
+	}
+	if TierMetrics(nil, TierAccount).Delivered != 0 {
+		t.Errorf("Global deliveries must not count towards the account tier")
+	}
+}
+
+func TestQueuedDelivery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	subscription, _ := Create(nil, TierGlobal, "admin", server.URL, nil, Rules{})
+	var effect = sideeffects.Effect{Kind: EffectKind, Key: subscription.ID, Event: events.Event{ID: 1, Type: events.DepositCompleted}, Attempts: 1}
+
+	if err := runEffect(effect); err == nil {
+		t.Fatal("Expected the failed attempt to be retried")
+	}
+	if metrics := find(subscription.ID).Metrics; metrics.Failed != 0 {
+		t.Errorf("Expected only the final attempt to count, got %+v", metrics)
+	}
+
+	effect.Attempts = sideeffects.MaxAttempts
+	runEffect(effect)
+	if metrics := find(subscription.ID).Metrics; metrics.Failed != 1 || metrics.LastError == "" {
+		t.Errorf("Expected the final attempt to count as one failure, got %+v", metrics)
+	}
+
+	// A removed webhook has nothing left to retry
+	Delete(nil, TierGlobal, "admin", subscription.ID)
+	if err := runEffect(effect); err != nil {
+		t.Errorf("Expected no retry for a removed webhook, got %v", err)
+	}
+}
+
+func find(id string) Subscription {
+	for _, subscription := range List(nil, TierGlobal, "admin") {
+		if subscription.ID == id {
+			return subscription
+		}
+	}
+	return Subscription{}
+}
+
+func matchingIDs(event events.Event) map[string]bool {
+	var ids = map[string]bool{}
+	for _, subscription := range matching(nil, event) {
+		ids[subscription.ID] = true
+	}
+	return ids
+}
+
+func TestRotation(t *testing.T) {
+	subscription, _ := Create(nil, TierAccount, "aaron", "https://example.com/aaron", []string{events.DepositCompleted}, Rules{})
+	defer Delete(nil, TierAccount, "aaron", subscription.ID)
+
+	if _, err := Rotate(nil, TierAccount, "bryan", subscription.ID, time.Hour); err != ErrNotFound {
+		t.Errorf("Bryan must not rotate aaron's webhook, got %v", err)
+	}
+
+	rotated, err := Rotate(nil, TierAccount, "aaron", subscription.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if rotated.Secret == subscription.Secret || rotated.PreviousSecret != "" {
+		t.Errorf("Expected a new secret and no previous secret in the result")
+	}
+
+	// Both secrets verify deliveries during the overlap
+	current := matching(nil, events.Event{Type: events.DepositCompleted, Subject: "aaron"})[0]
+	var body = []byte(`{"ID":1}`)
+	header := current.signature("1700000000", body)
+	if !Verify(subscription.Secret, "1700000000", body, header) || !Verify(rotated.Secret, "1700000000", body, header) {
+		t.Errorf("Expected old and new secrets to verify %q", header)
+	}
+
+	// The notice reaches the rotated webhook despite its event type filter
+	var notice = events.Event{Type: events.WebhookSecretRotated, Subject: "aaron", Data: map[string]interface{}{"webhook_id": subscription.ID}}
+	if ids := matchingIDs(notice); len(ids) != 1 || !ids[subscription.ID] {
+		t.Errorf("Rotation notice should only reach the rotated webhook, got %v", ids)
+	}
+
+	// Without an overlap the previous secret stops working at once
+	revoked, _ := Rotate(nil, TierAccount, "aaron", subscription.ID, 0)
+	current = matching(nil, events.Event{Type: events.DepositCompleted, Subject: "aaron"})[0]
+	header = current.signature("1700000000", body)
+	if Verify(rotated.Secret, "1700000000", body, header) || !Verify(revoked.Secret, "1700000000", body, header) {
+		t.Errorf("Expected only the newest secret to verify %q", header)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	var failing atomic.Bool
+	var digests = make(chan Digest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var digest Digest
+		json.NewDecoder(r.Body).Decode(&digest)
+		digests <- digest
+	}))
+	defer server.Close()
+
+	subscription, _ := Create(nil, TierAccount, "aaron", server.URL, nil, Rules{})
+	defer Delete(nil, TierAccount, "aaron", subscription.ID)
+
+	if _, err := SetDigest(nil, TierAccount, "aaron", subscription.ID, time.Second); err == nil {
+		t.Errorf("Expected an interval under a minute to be rejected")
+	}
+	if _, err := SetDigest(nil, TierAccount, "aaron", subscription.ID, time.Hour); err != nil {
+		t.Fatalf("SetDigest failed: %v", err)
+	}
+
+	dispatch(nil, events.Event{ID: 101, Type: events.DepositCompleted, Subject: "aaron"})
+	dispatch(nil, events.Event{ID: 102, Type: events.DepositCompleted, Subject: "aaron"})
+	dispatch(nil, events.Event{ID: 103, Type: events.WithdrawalCompleted, Subject: "aaron"})
+
+	if listed := List(nil, TierAccount, "aaron"); listed[0].DigestPending != 3 {
+		t.Fatalf("Expected 3 events held for the digest, got %d", listed[0].DigestPending)
+	}
+
+	// Not due for an hour
+	FlushDigests(time.Now(), false)
+	if listed := List(nil, TierAccount, "aaron"); listed[0].DigestPending != 3 {
+		t.Errorf("Expected nothing sent before the digest is due")
+	}
+
+	// A failed digest keeps its events for the next one
+	failing.Store(true)
+	FlushDigests(time.Now().Add(2*time.Hour), false)
+	if listed := List(nil, TierAccount, "aaron"); listed[0].DigestPending != 3 || listed[0].Metrics.Failed != 1 {
+		t.Errorf("Expected the events kept after a failed digest, got %+v", listed[0])
+	}
+
+	failing.Store(false)
+	dispatch(nil, events.Event{ID: 104, Type: events.DepositCompleted, Subject: "aaron"})
+	FlushDigests(time.Now(), true)
+
+	select {
+	case digest := <-digests:
+		if digest.Type != DigestType || len(digest.Events) != 4 || digest.Events[0].ID != 101 ||
+			digest.Counts[events.DepositCompleted] != 3 || digest.Counts[events.WithdrawalCompleted] != 1 {
+			t.Errorf("Unexpected digest: %+v", digest)
+		}
+	default:
+		t.Fatal("Digest was not delivered")
+	}
+
+	if listed := List(nil, TierAccount, "aaron"); listed[0].DigestPending != 0 || listed[0].Metrics.Delivered != 1 {
+		t.Errorf("Expected the queue emptied by the delivered digest, got %+v", listed[0])
+	}
+}
+
+func TestRules(t *testing.T) {
+	var rules = Rules{MinAmount: 100, Fields: []string{"amount", "to"}}
+	subscription, err := Create(nil, TierGlobal, "admin", "https://example.com/large", nil, rules)
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	defer Delete(nil, TierGlobal, "admin", subscription.ID)
+
+	var small = events.Event{Type: events.TransferCompleted, Data: map[string]interface{}{"from": "aaron", "to": "bryan", "amount": int64(99)}}
+	var large = events.Event{Type: events.TransferCompleted, Data: map[string]interface{}{"from": "aaron", "to": "bryan", "amount": int64(100)}}
+
+	t.Run("Amount_Threshold", func(t *testing.T) {
+		if matchingIDs(small)[subscription.ID] {
+			t.Errorf("A 99 coin transfer should be below the threshold")
+		}
+		if !matchingIDs(large)[subscription.ID] {
+			t.Errorf("A 100 coin transfer should meet the threshold")
+		}
+		if !matchingIDs(events.Event{Type: events.LimitChanged})[subscription.ID] {
+			t.Errorf("Events without an amount should not be filtered by it")
+		}
+	})
+
+	t.Run("Field_Selection", func(t *testing.T) {
+		large.ID = 7
+		shaped := subscription.Rules.shape(large)
+		if len(shaped.Data) != 2 || shaped.Data["to"] != "bryan" || shaped.Data["amount"] != int64(100) {
+			t.Errorf("Expected only amount and to, got %v", shaped.Data)
+		}
+		if shaped.ID != 7 || shaped.Type != events.TransferCompleted {
+			t.Errorf("Envelope fields must be kept, got %+v", shaped)
+		}
+		if len(large.Data) != 3 {
+			t.Errorf("Shaping must not change the event other subscriptions get")
+		}
+	})
+
+	t.Run("Selected_Amounts_Keep_Their_Currency", func(t *testing.T) {
+		var labelled = events.Event{Type: events.TransferCompleted, Data: map[string]interface{}{"to": "bryan", "amount": int64(100), "currency": "COIN"}}
+		if shaped := subscription.Rules.shape(labelled); shaped.Data["currency"] != "COIN" {
+			t.Errorf("Expected the currency to go with the amount, got %v", shaped.Data)
+		}
+
+		toOnly := Rules{Fields: []string{"to"}}
+		if shaped := toOnly.shape(labelled); len(shaped.Data) != 1 {
+			t.Errorf("Expected no currency without an amount, got %v", shaped.Data)
+		}
+	})
+
+	t.Run("Set_And_Validate", func(t *testing.T) {
+		if _, err := SetRules(nil, TierGlobal, "admin", subscription.ID, Rules{MinAmount: -1}); err == nil {
+			t.Errorf("Expected a negative threshold to be rejected")
+		}
+		if _, err := SetRules(nil, TierGlobal, "admin", subscription.ID, Rules{Fields: []string{""}}); err == nil {
+			t.Errorf("Expected an empty field name to be rejected")
+		}
+		if _, err := SetRules(nil, TierAccount, "aaron", subscription.ID, Rules{}); err != ErrNotFound {
+			t.Errorf("Global webhooks are not managed through the account tier, got %v", err)
+		}
+
+		updated, err := SetRules(nil, TierGlobal, "admin", subscription.ID, Rules{})
+		if err != nil || updated.Rules.MinAmount != 0 || updated.Secret != "" {
+			t.Fatalf("Expected cleared rules without the secret, got %+v, %v", updated, err)
+		}
+		if !matchingIDs(small)[subscription.ID] {
+			t.Errorf("Without rules every transfer should match")
+		}
+	})
+}
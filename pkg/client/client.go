@@ -0,0 +1,173 @@
+// Package client calls the API over HTTP for one account, with the request and
+// response types of package api. Mutations are sent as JSON bodies, and a refused
+// request comes back as an *Error carrying the server's status and message.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryantjandra/goapi/api"
+)
+
+// Error is a request the server refused or failed, Status is the HTTP status
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("%d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// Client acts as Username, sending Token as the Authorization header unchanged: a
+// static token as is, an access token with its "Bearer " prefix
+type Client struct {
+	BaseURL  string
+	Username string
+	Token    string
+
+	HTTPClient *http.Client
+}
+
+// New returns a client for the server at baseURL, such as http://localhost:3000
+func New(baseURL string, username string, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Username:   username,
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// HistoryOptions narrow and page History, the zero value is the newest 50 entries
+type HistoryOptions struct {
+	Limit  int
+	Cursor string
+	Type   string
+	Status string
+}
+
+func (c *Client) Balance(ctx context.Context) (*api.CoinBalanceResponse, error) {
+	var response api.CoinBalanceResponse
+	err := c.do(ctx, http.MethodGet, "/account/coins", nil, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *Client) Deposit(ctx context.Context, amount int64) (*api.CoinAdditionResponse, error) {
+	var response api.CoinAdditionResponse
+	err := c.do(ctx, http.MethodPost, "/account/coins/add", nil, api.CoinAdditionParams{Amount: api.Amount(amount)}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *Client) Withdraw(ctx context.Context, amount int64) (*api.CoinWithdrawResponse, error) {
+	var response api.CoinWithdrawResponse
+	err := c.do(ctx, http.MethodPost, "/account/coins/withdraw", nil, api.CoinWithdrawParams{Amount: api.Amount(amount)}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Transfer moves amount from the client's account to to
+func (c *Client) Transfer(ctx context.Context, to string, amount int64) (*api.CoinTransferResponse, error) {
+	var params = api.CoinTransferParams{From: c.Username, To: to, Amount: api.Amount(amount)}
+	var response api.CoinTransferResponse
+	err := c.do(ctx, http.MethodPost, "/account/coins/transfer", nil, params, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// History returns one page of the account's ledger entries, newest first. Pass the
+// page's NextCursor back as options.Cursor for the next one.
+func (c *Client) History(ctx context.Context, options HistoryOptions) (*api.TransactionListResponse, error) {
+	var query = url.Values{}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+	for name, value := range map[string]string{"cursor": options.Cursor, "type": options.Type, "status": options.Status} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	var response api.TransactionListResponse
+	err := c.do(ctx, http.MethodGet, "/account/transactions", query, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// do sends one request as the client's user and decodes a 2xx answer into response
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}, response interface{}) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("username", c.Username)
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path+"?"+query.Encode(), reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", c.Token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	var httpClient *http.Client = c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var refusal api.Error
+		if json.NewDecoder(resp.Body).Decode(&refusal) != nil {
+			refusal.Message = ""
+		}
+		return &Error{Status: resp.StatusCode, Message: refusal.Message}
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(response)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("decoding %s %s response: %w", method, path, err)
+	}
+	return nil
+}
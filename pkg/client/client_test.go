@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bryantjandra/goapi/internal/handlers"
+	"github.com/bryantjandra/goapi/internal/tools"
+)
+
+func TestClient(t *testing.T) {
+	logins, coins := tools.DemoAccounts()
+	database, err := tools.NewMemoryDatabase(logins, coins)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	var server = httptest.NewServer(handlers.New(*database))
+	defer server.Close()
+
+	var ctx = context.Background()
+	var aaron = New(server.URL, "aaron", "1")
+
+	t.Run("Mutations_Move_Coins", func(t *testing.T) {
+		balance, err := aaron.Balance(ctx)
+		if err != nil {
+			t.Fatalf("Balance failed: %v", err)
+		}
+		var start int64 = balance.Balance
+
+		if _, err := aaron.Deposit(ctx, 50); err != nil {
+			t.Fatalf("Deposit failed: %v", err)
+		}
+		if _, err := aaron.Withdraw(ctx, 20); err != nil {
+			t.Fatalf("Withdraw failed: %v", err)
+		}
+		transfer, err := aaron.Transfer(ctx, "bryan", 10)
+		if err != nil {
+			t.Fatalf("Transfer failed: %v", err)
+		}
+		if transfer.FromBalance != start+20 || transfer.TransactionID == "" {
+			t.Errorf("Expected %d left after the transfer, got %+v", start+20, transfer)
+		}
+	})
+
+	t.Run("History_Pages", func(t *testing.T) {
+		page, err := aaron.History(ctx, HistoryOptions{Limit: 1, Type: "transfer"})
+		if err != nil {
+			t.Fatalf("History failed: %v", err)
+		}
+		if len(page.Transactions) != 1 || page.Transactions[0].To != "bryan" {
+			t.Errorf("Expected the transfer to bryan first, got %+v", page.Transactions)
+		}
+	})
+
+	t.Run("Refusals_Are_Errors", func(t *testing.T) {
+		_, err := aaron.Withdraw(ctx, 1_000_000_000)
+		var refused *Error
+		if !errors.As(err, &refused) || refused.Status < 400 || refused.Status > 499 || refused.Message == "" {
+			t.Errorf("Expected a 4xx with a message, got %v", err)
+		}
+
+		_, err = New(server.URL, "aaron", "wrong").Balance(ctx)
+		if !errors.As(err, &refused) || refused.Status < 400 || refused.Status > 499 {
+			t.Errorf("Expected the bad token refused, got %v", err)
+		}
+	})
+}
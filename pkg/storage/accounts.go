@@ -0,0 +1,34 @@
+package storage
+
+import "context"
+
+// How many balances ForEachAccount reads per ListUserCoins call
+const AccountPageSize = 1000
+
+// ForEachAccount calls fn with every account's balance in username order, reading
+// them AccountPageSize at a time so memory stays flat however many accounts there
+// are. Accounts created during the walk are seen if they sort after the current page.
+// It stops at the first error from storage, fn or ctx and returns it.
+func ForEachAccount(ctx context.Context, database DatabaseInterface, fn func(CoinDetails) error) error {
+	var after string
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		page, err := database.ListUserCoins(ctx, after, AccountPageSize)
+		if err != nil {
+			return err
+		}
+		for _, details := range page {
+			if err = fn(details); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < AccountPageSize {
+			return nil
+		}
+		after = page[len(page)-1].Username
+	}
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// pagedBackend serves ListUserCoins from a sorted slice and counts the pages read
+type pagedBackend struct {
+	DatabaseInterface
+	accounts []CoinDetails
+	pages    int
+}
+
+func (b *pagedBackend) ListUserCoins(ctx context.Context, after string, limit int) ([]CoinDetails, error) {
+	b.pages++
+	start := sort.Search(len(b.accounts), func(i int) bool { return b.accounts[i].Username > after })
+	end := min(start+limit, len(b.accounts))
+	return b.accounts[start:end], nil
+}
+
+func TestForEachAccount(t *testing.T) {
+	var backend = &pagedBackend{}
+	for i := 0; i < 2*AccountPageSize+1; i++ {
+		backend.accounts = append(backend.accounts, CoinDetails{Username: fmt.Sprintf("user%06d", i), Coins: int64(i)})
+	}
+
+	t.Run("Visits_Every_Account_Once_In_Order", func(t *testing.T) {
+		backend.pages = 0
+		var seen []string
+		err := ForEachAccount(context.Background(), backend, func(details CoinDetails) error {
+			seen = append(seen, details.Username)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to iterate: %v", err)
+		}
+		if len(seen) != len(backend.accounts) || !sort.StringsAreSorted(seen) {
+			t.Errorf("Expected %d accounts in order, got %d", len(backend.accounts), len(seen))
+		}
+		if backend.pages != 3 {
+			t.Errorf("Expected 3 pages, got %d", backend.pages)
+		}
+	})
+
+	t.Run("Stops_At_The_First_Error", func(t *testing.T) {
+		var stop = errors.New("stop")
+		var visited int
+		err := ForEachAccount(context.Background(), backend, func(CoinDetails) error {
+			visited++
+			if visited == 5 {
+				return stop
+			}
+			return nil
+		})
+		if !errors.Is(err, stop) || visited != 5 {
+			t.Errorf("Expected to stop after 5 accounts with the error, got %d and %v", visited, err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := ForEachAccount(ctx, backend, func(CoinDetails) error { return nil }); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrEventNotFound = errors.New("event not found")
+
+// Event is a domain event as the backend keeps it, see internal/events. IDs are
+// assigned by AppendEvent, increasing in the order events were appended. Data is the
+// events package's own encoding, JSON.
+type Event struct {
+	ID            int64
+	Type          string
+	SchemaVersion int
+	Subject       string
+	Data          []byte
+	OccurredAt    time.Time
+}
+
+// EventFilter selects the events ListEvents returns. Empty Type and Subject match
+// every event, a Limit of 0 returns all that match.
+type EventFilter struct {
+	AfterID int64
+	Type    string
+	Subject string
+	Limit   int
+}
+
+// Matches reports whether event passes the filter's AfterID, Type and Subject
+func (f EventFilter) Matches(event Event) bool {
+	return event.ID > f.AfterID && (f.Type == "" || event.Type == f.Type) && (f.Subject == "" || event.Subject == f.Subject)
+}
@@ -0,0 +1,15 @@
+package storage
+
+// PageHistory serves GetTransactionHistoryPage from username's whole history, oldest
+// first as GetTransactionHistory returns it. It is for backends without a per-user
+// index, a page still costs reading the history.
+func PageHistory(history []TransactionLog, username string, before int64, limit int) []TransactionLog {
+	var page = make([]TransactionLog, 0, max(min(limit, len(history)), 0))
+	for i := len(history) - 1; i >= 0 && len(page) < limit; i-- {
+		if before > 0 && history[i].SequenceFor(username) >= before {
+			continue
+		}
+		page = append(page, history[i])
+	}
+	return page
+}
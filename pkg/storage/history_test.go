@@ -0,0 +1,41 @@
+package storage
+
+import "testing"
+
+func TestPageHistory(t *testing.T) {
+	// aaron's entries 1 to 5, the third is bryan's transfer to him
+	var history []TransactionLog
+	for i := int64(1); i <= 5; i++ {
+		var tx = TransactionLog{From: "aaron", To: "bryan", FromSequence: i, ToSequence: 10 + i}
+		if i == 3 {
+			tx = TransactionLog{From: "bryan", To: "aaron", FromSequence: 13, ToSequence: i}
+		}
+		history = append(history, tx)
+	}
+
+	sequences := func(page []TransactionLog) []int64 {
+		var result []int64
+		for _, tx := range page {
+			result = append(result, tx.SequenceFor("aaron"))
+		}
+		return result
+	}
+
+	t.Run("Newest_First_Without_Before", func(t *testing.T) {
+		if got := sequences(PageHistory(history, "aaron", 0, 2)); len(got) != 2 || got[0] != 5 || got[1] != 4 {
+			t.Errorf("Expected 5 and 4, got %v", got)
+		}
+	})
+
+	t.Run("Before_Uses_The_Callers_Numbers", func(t *testing.T) {
+		if got := sequences(PageHistory(history, "aaron", 4, 10)); len(got) != 3 || got[0] != 3 || got[2] != 1 {
+			t.Errorf("Expected 3 to 1, got %v", got)
+		}
+	})
+
+	t.Run("Nothing_Before_The_First", func(t *testing.T) {
+		if got := PageHistory(history, "aaron", 1, 10); len(got) != 0 {
+			t.Errorf("Expected an empty page, got %v", sequences(got))
+		}
+	})
+}
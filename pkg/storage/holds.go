@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrHoldNotFound = errors.New("hold not found")
+
+// Kind of a hold placed by an admin freeze. It is placed whatever the balance, even on
+// a frozen account, every other kind needs that much available.
+const HoldFreeze = "freeze"
+
+// Hold sets Amount of an account's balance aside, withdrawals and transfers can only
+// spend what isn't held. Kind says which feature placed it, ID is the feature's own.
+type Hold struct {
+	ID        string
+	Account   string
+	Kind      string
+	Amount    int64
+	CreatedAt time.Time
+}
+
+// Available is the part of the balance no hold sets aside, never below zero. Freezes
+// can hold back more than the balance.
+func (c CoinDetails) Available() int64 {
+	return max(0, c.Coins-c.Held)
+}
@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrRecordNotFound = errors.New("record not found")
+
+// Record is a small document a feature keeps next to the accounts, such as a freeze
+// with its audit history or a user's profile, so it lives as long as the balances do.
+// Kind namespaces the IDs, Account is what ListRecords filters on and Data is the
+// feature's own encoding, usually JSON.
+type Record struct {
+	Kind      string
+	ID        string
+	Account   string
+	Data      []byte
+	UpdatedAt time.Time
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var ErrUnknownBackend = errors.New("unknown storage backend")
+
+// Factory returns a backend connected to dsn. The caller runs SetupDatabase on it
+// before first use, so a factory should only check and keep its arguments.
+type Factory func(dsn string) (DatabaseInterface, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// Register makes a backend available under name, normally from an init function. It
+// panics if name is empty, factory is nil, or name is already registered.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if name == "" || factory == nil {
+		panic("storage: Register needs a name and a factory")
+	}
+	if _, exists := factories[name]; exists {
+		panic("storage: Register called twice for backend " + name)
+	}
+	factories[name] = factory
+}
+
+// Open returns a new backend from the factory registered under name
+func Open(name string, dsn string) (DatabaseInterface, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w %q, registered backends are: %v", ErrUnknownBackend, name, Backends())
+	}
+	return factory(dsn)
+}
+
+// Backends lists the registered backend names, sorted
+func Backends() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	var names = make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
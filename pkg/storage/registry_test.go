@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// stubBackend only needs to be told apart, every method panics
+type stubBackend struct {
+	DatabaseInterface
+	dsn string
+}
+
+func TestRegistry(t *testing.T) {
+	Register("stub", func(dsn string) (DatabaseInterface, error) {
+		return &stubBackend{dsn: dsn}, nil
+	})
+
+	t.Run("Open_Passes_DSN", func(t *testing.T) {
+		database, err := Open("stub", "stub://somewhere")
+		if err != nil {
+			t.Fatalf("Failed to open stub: %v", err)
+		}
+		if stub, ok := database.(*stubBackend); !ok || stub.dsn != "stub://somewhere" {
+			t.Errorf("Expected the stub with its DSN, got %#v", database)
+		}
+		if !slices.Contains(Backends(), "stub") {
+			t.Errorf("Expected stub in %v", Backends())
+		}
+	})
+
+	t.Run("Unknown_Backend", func(t *testing.T) {
+		if _, err := Open("missing", ""); !errors.Is(err, ErrUnknownBackend) {
+			t.Errorf("Expected ErrUnknownBackend, got %v", err)
+		}
+	})
+
+	t.Run("Duplicate_Name_Panics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected registering stub twice to panic")
+			}
+		}()
+		Register("stub", func(dsn string) (DatabaseInterface, error) { return nil, nil })
+	})
+}
@@ -0,0 +1,355 @@
+// Package storage is the public extension point for storage backends. It holds the
+// domain types every backend works with and DatabaseInterface, which a backend
+// implements. Register a backend under a name and select it with DB_DRIVER=<name>,
+// its factory gets DB_DSN:
+//
+//	func init() {
+//		storage.Register("postgres", func(dsn string) (storage.DatabaseInterface, error) {
+//			return newPostgres(dsn), nil
+//		})
+//	}
+//
+// The built-in mock, mysql and redis backends are registered the same way.
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+
+	// Read-only access to every account's ledger, with credentials redacted
+	RoleAuditor = "auditor"
+)
+
+// What a co-owner of a joint account may do with it
+const (
+	OwnerView     = "view"
+	OwnerTransact = "transact"
+)
+
+type LoginDetails struct {
+	AuthToken string
+	Username  string
+	Role      string
+}
+
+type CoinDetails struct {
+	Coins    int64
+	Username string
+	Version  int64 // Optimistic locking
+
+	// Set when the balance was served from the last-known cache while storage is down
+	CachedAt time.Time
+
+	// Set on the details a transfer returns, the ID of its TransactionLog entry
+	TransactionID string
+
+	// Set on reads when an admin froze the whole account. Withdrawals and transfers
+	// from it fail with ErrAccountFrozen, deposits still land.
+	Frozen bool
+
+	// Sum of the account's holds, see PlaceHold
+	Held int64
+}
+
+// Transaction audit trail
+type TransactionLog struct {
+	ID        string
+	Type      string
+	From      string
+	To        string
+	Amount    int64
+	Timestamp time.Time
+	Status    string
+
+	// Whether the transaction created coins, destroyed them, or only moved them
+	Flow string
+
+	// Position of the entry in each party's own ledger. Every entry naming an account,
+	// failed ones included, takes the next number, so a client that sees one skipped
+	// knows it missed something. Zero for a side with no account.
+	FromSequence int64
+	ToSequence   int64
+}
+
+// SequenceFor is the entry's number in username's ledger, zero if it doesn't name them
+func (t TransactionLog) SequenceFor(username string) int64 {
+	switch username {
+	case t.From:
+		return t.FromSequence
+	case t.To:
+		return t.ToSequence
+	}
+	return 0
+}
+
+// Counter-accounts that balance deposits and withdrawals in the double-entry postings.
+// They are not real accounts and never appear in the coin balance table.
+const (
+	MintAccount = "_mint"
+	BurnAccount = "_burn"
+)
+
+// Audit log type of a stored balance set back to what the ledger says. It moves no
+// coins in the ledger, so unlike every other successful transaction it has no postings.
+const CorrectionType = "CORRECTION"
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrStaleVersion      = errors.New("balance changed since it was read")
+	ErrUserExists        = errors.New("user already exists")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrInvalidAmount     = errors.New("amount must be positive")
+	ErrSelfTransfer      = errors.New("self-transfer not allowed")
+	ErrBalanceOverflow   = errors.New("balance would overflow")
+
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenRevoked  = errors.New("refresh token was already revoked")
+
+	ErrOwnerNotFound = errors.New("account owner not found")
+
+	ErrAccountNotEmpty = errors.New("account still holds coins")
+
+	ErrAccountFrozen = errors.New("account is frozen, no coins can be sent or withdrawn")
+)
+
+// RefreshToken is kept by the hash of its secret, never the secret itself. Tokens
+// rotated from one another share a Family, so a stolen one can be revoked with all
+// its descendants.
+type RefreshToken struct {
+	Hash      string
+	Username  string
+	Family    string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+
+	// Zero while the token can still be used
+	RevokedAt time.Time
+}
+
+// AccountOwner makes Owner, who keeps logging in with their own credentials, a
+// co-owner of Account with Permission. The account's own login is its holder and is
+// never listed.
+type AccountOwner struct {
+	Account    string
+	Owner      string
+	Permission string
+	AddedAt    time.Time
+}
+
+// One side of a double-entry booking. Every successful transaction produces
+// postings that sum to zero: a debit (negative) and a credit (positive).
+type Posting struct {
+	TransactionID string
+	Account       string
+	Amount        int64
+	Timestamp     time.Time
+}
+
+// Coin flows for the economy report
+const (
+	FlowSource  = "source"
+	FlowSink    = "sink"
+	FlowNeutral = "neutral"
+)
+
+// Every transaction type tagged by what it does to the total coin supply
+var transactionFlows = map[string]string{
+	"DEPOSIT":    FlowSource,
+	"MINT":       FlowSource,
+	"FAUCET":     FlowSource,
+	"INTEREST":   FlowSource,
+	"WITHDRAWAL": FlowSink,
+	"BURN":       FlowSink,
+	"FEE":        FlowSink,
+	"TRANSFER":   FlowNeutral,
+}
+
+// FlowOf returns the source/sink tag for a transaction type
+func FlowOf(txType string) string {
+	flow, ok := transactionFlows[txType]
+	if !ok {
+		return FlowNeutral
+	}
+	return flow
+}
+
+// Capabilities are the optional features a backend has, so callers can check for one
+// rather than fail when they use it. The zero value has none of them, which is what a
+// backend written before a capability existed reports.
+type Capabilities struct {
+	// Data outlives the process
+	Durable bool
+
+	// Several operations can be committed or rolled back together
+	Transactions bool
+
+	// Balances can be read as they were at a past time
+	TimeTravel bool
+
+	// Balance changes can be subscribed to as they happen, the backend is a Subscriber
+	Streaming bool
+
+	// The whole state can be copied and put back in one step
+	Snapshots bool
+
+	// Reads may be answered from a cache while storage is down, with CachedAt set
+	StaleReads bool
+}
+
+// Subscriber is implemented by backends with the Streaming capability
+type Subscriber interface {
+	// Subscribe returns username's ledger entries as they are logged, in sequence order,
+	// and a func that ends the subscription. A subscriber that falls too far behind has
+	// its channel closed, and can read what it missed from GetTransactionHistory.
+	Subscribe(username string) (<-chan TransactionLog, func())
+}
+
+type DatabaseInterface interface {
+	GetUserLoginDetails(username string) *LoginDetails
+
+	// GetUserCoins returns ErrUserNotFound for an unknown account
+	GetUserCoins(username string) (*CoinDetails, error)
+
+	// CreateUser adds an account with a zero balance, ErrUserExists if the name is taken
+	CreateUser(login LoginDetails) (*CoinDetails, error)
+
+	// DeleteUser removes an account's login and balance, undoing CreateUser when what
+	// the account was created for failed. Ledger entries naming it stay. ErrUserNotFound
+	// for an unknown account, ErrAccountNotEmpty unless the balance is zero.
+	DeleteUser(username string) error
+
+	// AddUserCoins and WithdrawUserCoins return ErrInvalidAmount, ErrUserNotFound,
+	// ErrInsufficientFunds, ErrBalanceOverflow or, withdrawing, ErrAccountFrozen when
+	// the operation is refused, other errors when storage failed. Withdrawals and
+	// transfers can only spend the balance no hold sets aside.
+	AddUserCoins(username string, amount int64) (*CoinDetails, error)
+	WithdrawUserCoins(username string, amount int64) (*CoinDetails, error)
+
+	// SetUserFrozen freezes or unfreezes a whole account, reads then report Frozen.
+	// Withdrawals and transfers out of a frozen account fail with ErrAccountFrozen,
+	// checked in the same step that would move the coins. ErrUserNotFound for an
+	// unknown account.
+	SetUserFrozen(username string, frozen bool) (*CoinDetails, error)
+
+	// PlaceHold sets hold.Amount of hold.Account's balance aside, or changes the amount
+	// of its hold with the same ID, and returns the balance with Held updated. Unless
+	// the Kind is HoldFreeze the account has to have that much available, checked in
+	// the same step: ErrAccountFrozen or ErrInsufficientFunds otherwise. ErrInvalidAmount
+	// unless the amount is positive, ErrUserNotFound for an unknown account and
+	// ErrHoldNotFound if the ID is another account's hold. A new hold's CreatedAt
+	// defaults to now, a changed one keeps its own.
+	PlaceHold(hold Hold) (*CoinDetails, error)
+
+	// ReleaseHold removes a hold, giving its amount back to spend. ErrHoldNotFound if
+	// there is no such hold.
+	ReleaseHold(id string) (*CoinDetails, error)
+
+	// GetHolds lists account's holds, or every hold when account is empty, oldest first
+	GetHolds(account string) ([]Hold, error)
+
+	// CaptureHold removes a hold and, in the same step, moves amount of the coins it set
+	// aside out of the account: to to as a transfer or, when to is empty, as a
+	// withdrawal with toDetails nil. The rest is released. It fails like the transfer or
+	// withdrawal would, counting the hold's coins as available, and ErrInvalidAmount
+	// unless amount is positive and at most the hold's. ErrHoldNotFound if there is no
+	// such hold, nothing is logged then.
+	CaptureHold(ctx context.Context, id string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error)
+
+	// TransferUserCoins and TransferUserCoinsWithContext set TransactionID on both
+	// details they return
+	TransferUserCoins(from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails)
+	SetupDatabase() error
+	TransferUserCoinsWithContext(ctx context.Context, from string, to string, amount int64) (fromDetails *CoinDetails, toDetails *CoinDetails, err error)
+	// The user's transactions, oldest first, in a new slice the caller may modify
+	GetTransactionHistory(username string) []TransactionLog
+
+	// GetTransactionHistoryPage returns up to limit of the user's transactions numbered
+	// below before, newest first, or the newest ones when before is 0. The last entry's
+	// SequenceFor the user is before for the next page. A backend should seek in a
+	// per-user index rather than read the whole history, see PageHistory otherwise.
+	GetTransactionHistoryPage(username string, before int64, limit int) []TransactionLog
+
+	// GetTransaction returns the entry with id, false when there is none. A backend
+	// should look it up by key rather than read a history, a receipt reads it after
+	// every transfer.
+	GetTransaction(id string) (TransactionLog, bool)
+	GetAllTransactions() []TransactionLog
+	GetAllUserCoins() []CoinDetails
+
+	// ListUserCoins returns up to limit balances with usernames after after, in
+	// username order, so accounts can be read a page at a time with the last username
+	// as the cursor. A backend should serve it from an index rather than sorting every
+	// account per page, see ForEachAccount.
+	ListUserCoins(ctx context.Context, after string, limit int) ([]CoinDetails, error)
+
+	// TopUserCoins returns the highest balances among usernames, at most limit of them,
+	// highest first with ties broken by username
+	TopUserCoins(usernames []string, limit int) []CoinDetails
+
+	// CorrectUserCoins overwrites a balance, only if it is still at version. The
+	// difference is logged as a CorrectionType entry.
+	CorrectUserCoins(username string, version int64, balance int64) (*CoinDetails, error)
+
+	// AnonymizeUser renames username to pseudonym in the balances, transactions and
+	// postings, and removes its login. The ledger still balances but no longer names
+	// the person. ErrUserExists if pseudonym is taken.
+	AnonymizeUser(username string, pseudonym string) error
+
+	// StoreRefreshToken saves a newly issued refresh token
+	StoreRefreshToken(token RefreshToken) error
+
+	// RevokeRefreshToken marks the token with hash revoked and returns it as it was,
+	// atomically so a token can only be used once. ErrRefreshTokenRevoked, along with
+	// the token, if it already was revoked.
+	RevokeRefreshToken(hash string) (*RefreshToken, error)
+
+	// RevokeRefreshTokens revokes username's live tokens in family, or in every family
+	// when family is empty, and returns how many it revoked
+	RevokeRefreshTokens(username string, family string) (int, error)
+
+	// SetAccountOwner adds a co-owner to an account or changes their permission,
+	// ErrUserNotFound if either account doesn't exist
+	SetAccountOwner(owner AccountOwner) error
+
+	// GetAccountOwners lists account's co-owners ordered by owner
+	GetAccountOwners(account string) ([]AccountOwner, error)
+
+	// RemoveAccountOwner returns ErrOwnerNotFound if owner isn't a co-owner of account
+	RemoveAccountOwner(account string, owner string) error
+
+	// PutRecord adds a record, or replaces the one of the same Kind and ID
+	PutRecord(record Record) error
+
+	// GetRecord returns ErrRecordNotFound when there is no such record
+	GetRecord(kind string, id string) (*Record, error)
+
+	// ListRecords returns the records of kind naming account, every one of kind when
+	// account is empty, ordered by ID
+	ListRecords(kind string, account string) ([]Record, error)
+
+	// DeleteRecord returns ErrRecordNotFound when there is no such record
+	DeleteRecord(kind string, id string) error
+
+	// AppendEvent adds event to the event log and returns its ID, the next one unless
+	// event.ID is already set, as when a failover secondary mirrors the primary's log
+	AppendEvent(event Event) (int64, error)
+
+	// ListEvents returns the events filter selects, oldest first. A backend should
+	// serve a Subject filter from an index, it is read on every transfer.
+	ListEvents(filter EventFilter) ([]Event, error)
+
+	// RewriteEvent replaces the Subject and Data of the event with event.ID, only for
+	// erasing personal data. ErrEventNotFound if there is no such event.
+	RewriteEvent(event Event) error
+	GetPostings() []Posting
+	GetSystemHealth() map[string]interface{}
+
+	// Capabilities reports the optional features this backend supports
+	Capabilities() Capabilities
+}